@@ -0,0 +1,57 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/mephistofox/fxtun.dev/internal/inspect"
+)
+
+const completionLong = `Generate a shell completion script for fxtunnel.
+
+Bash (needs the bash-completion package):
+  fxtunnel completion bash > /etc/bash_completion.d/fxtunnel
+  # or, for the current user only:
+  fxtunnel completion bash > ~/.local/share/bash-completion/completions/fxtunnel
+
+Zsh:
+  fxtunnel completion zsh > "${fpath[1]}/_fxtunnel"
+  # completion must be enabled once with: autoload -U compinit; compinit
+
+Fish:
+  fxtunnel completion fish > ~/.config/fish/completions/fxtunnel.fish
+
+PowerShell:
+  fxtunnel completion powershell | Out-String | Invoke-Expression
+
+Start a new shell for the completions to take effect.`
+
+// fixedCompletion completes a flag from a fixed list of values.
+func fixedCompletion(values ...string) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+		return values, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// setupCompletion documents the completion command cobra generates and
+// teaches it the values of flags that take a fixed set of them.
+func setupCompletion(rootCmd, httpCmd, tcpCmd *cobra.Command) {
+	rootCmd.InitDefaultCompletionCmd()
+	if cmd, _, err := rootCmd.Find([]string{"completion"}); err == nil && cmd != rootCmd {
+		cmd.Long = completionLong
+	}
+
+	_ = rootCmd.MarkPersistentFlagFilename("config", "yaml", "yml")
+	_ = rootCmd.RegisterFlagCompletionFunc("log-level", fixedCompletion("debug", "info", "warn", "error"))
+	_ = rootCmd.RegisterFlagCompletionFunc("log-format", fixedCompletion("console", "json"))
+
+	presets := make([]string, 0, len(presetRegistry))
+	for _, p := range presetRegistry {
+		presets = append(presets, p.Name+"\t"+p.Description)
+	}
+	_ = httpCmd.RegisterFlagCompletionFunc("preset", fixedCompletion(presets...))
+	_ = httpCmd.RegisterFlagCompletionFunc("capture", fixedCompletion(string(inspect.CaptureAll), string(inspect.CaptureErrors), string(inspect.CaptureNone)))
+	_ = tcpCmd.RegisterFlagCompletionFunc("health-check", fixedCompletion("tcp"))
+	for _, cmd := range []*cobra.Command{httpCmd, tcpCmd} {
+		_ = cmd.MarkFlagFilename("ssh-key")
+	}
+}
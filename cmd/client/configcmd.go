@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+)
+
+func newConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Work with the client configuration file",
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "validate",
+		Short: "Check the configuration file without connecting",
+		Long: `Load the configuration the way the client does and report every problem
+found, with the line it is on where possible. Exits with status 1 when the
+configuration is invalid, so it can run in CI.
+
+Examples:
+  fxtunnel config validate                   Check the config the client would load
+  fxtunnel config validate -c client.yaml    Check a specific file`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			report := config.CheckClientConfig(configFile)
+			report.Print(os.Stdout)
+			if report.Failed() {
+				os.Exit(1)
+			}
+		},
+	})
+	return cmd
+}
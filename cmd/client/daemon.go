@@ -39,16 +39,6 @@ Examples:
 	return cmd
 }
 
-func newStatusCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "status",
-		Short: "Show daemon status and active tunnels",
-		Long: `Show the running daemon's status including PID, server address, uptime,
-and a list of all active tunnels with their public URLs.`,
-		RunE: runStatus,
-	}
-}
-
 func newDownCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:   "down",
@@ -121,6 +111,7 @@ func runDaemonForeground() error {
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
+	log = configLogger(cfg)
 
 	if serverAddr != "" {
 		cfg.Server.Address = serverAddr
@@ -128,7 +119,15 @@ func runDaemonForeground() error {
 	if token != "" {
 		cfg.Server.Token = token
 	}
+	if localAddrFlag != "" {
+		cfg.LocalAddr = localAddrFlag
+	}
 	cfg.Server.Address = normalizeServerAddr(cfg.Server.Address)
+	for i, addr := range cfg.Server.Addresses {
+		if addr != "" {
+			cfg.Server.Addresses[i] = normalizeServerAddr(addr)
+		}
+	}
 	cfg.Reconnect.Enabled = true
 
 	c := client.New(cfg, log)
@@ -180,6 +179,9 @@ func runDaemonForeground() error {
 			if httpsURL != "" {
 				fmt.Printf("  HTTPS: %s\n", httpsURL)
 			}
+		} else if t.Config.Type == "socks" {
+			fmt.Printf("  SOCKS5: %s\n", t.Config.GetLocalAddress())
+			continue
 		} else {
 			fmt.Printf("  %s: %s\n", strings.ToUpper(t.Config.Type), t.RemoteAddr)
 		}
@@ -197,20 +199,6 @@ func runDaemonForeground() error {
 	return nil
 }
 
-func runStatus(cmd *cobra.Command, args []string) error {
-	statePath := daemon.DefaultStatePath()
-	st, running := daemon.IsDaemonRunning(statePath)
-	if !running {
-		fmt.Println("Daemon is not running.")
-		return nil
-	}
-
-	fmt.Printf("Daemon running (PID %d)\n", st.PID)
-	fmt.Printf("Server: %s\n", st.Server)
-	printDaemonStatus(st.APIAddr, st.Token)
-	return nil
-}
-
 func runDown(cmd *cobra.Command, args []string) error {
 	statePath := daemon.DefaultStatePath()
 	st, running := daemon.IsDaemonRunning(statePath)
@@ -243,24 +231,31 @@ func runDown(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-func printDaemonStatus(apiAddr, token string) {
+// fetchDaemonStatus reads the running daemon's status from its API.
+func fetchDaemonStatus(apiAddr, token string) (*daemon.StatusResponse, error) {
 	httpClient := &http.Client{Timeout: 5 * time.Second}
 	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://%s/status", apiAddr), nil)
 	if err != nil {
-		fmt.Printf("  Failed to fetch status: %v\n", err)
-		return
+		return nil, err
 	}
 	req.Header.Set("Authorization", "Bearer "+token)
 	resp, err := httpClient.Do(req)
 	if err != nil {
-		fmt.Printf("  Failed to fetch status: %v\n", err)
-		return
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	var status daemon.StatusResponse
 	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
-		fmt.Printf("  Failed to decode status: %v\n", err)
+		return nil, fmt.Errorf("decode status: %w", err)
+	}
+	return &status, nil
+}
+
+func printDaemonStatus(apiAddr, token string) {
+	status, err := fetchDaemonStatus(apiAddr, token)
+	if err != nil {
+		fmt.Printf("  Failed to fetch status: %v\n", err)
 		return
 	}
 
@@ -295,6 +290,15 @@ func addTunnelToDaemon(tunnelCfg config.TunnelConfig) bool {
 		AllowIPs:      tunnelCfg.AllowIPs,
 		AutoClose:     tunnelCfg.AutoClose,
 		MaxLifetime:   tunnelCfg.MaxLifetime,
+
+		HealthCheck:         tunnelCfg.HealthCheck,
+		HealthCheckInterval: tunnelCfg.HealthCheckInterval,
+		Capture:             tunnelCfg.Capture,
+		SubdomainFallback:   tunnelCfg.SubdomainFallback,
+		StripPathPrefix:     tunnelCfg.StripPathPrefix,
+		AddPathPrefix:       tunnelCfg.AddPathPrefix,
+		CacheEnabled:        tunnelCfg.CacheEnabled,
+		CacheMaxSize:        tunnelCfg.CacheMaxSize,
 	}
 
 	body, err := json.Marshal(req)
@@ -2,8 +2,10 @@ package main
 
 import (
 	"bufio"
+	_ "embed"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -15,22 +17,47 @@ import (
 
 const projectConfigFile = "fxtunnel.yaml"
 
+// starterConfig is the commented client.yaml written by 'init --template'.
+//
+//go:embed starter.yaml
+var starterConfig []byte
+
+var (
+	initTemplate bool
+	initOutput   string
+	initForce    bool
+)
+
 type projectConfig struct {
 	Tunnels []config.TunnelConfig `yaml:"tunnels"`
 }
 
 func newInitCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "init",
 		Short: "Initialize tunnel configuration for the current project",
 		Long: `Interactively create fxtunnel.yaml in the current directory.
 Configures tunnels for the project. Requires authentication — if not logged in,
-you will be prompted to run 'fxtunnel login' first.`,
+you will be prompted to run 'fxtunnel login' first.
+
+With --template, write a commented starter client.yaml instead, covering the
+server connection, tunnels, reconnects, the inspector and logging:
+  fxtunnel init --template
+  fxtunnel init --template -o ~/.fxtunnel/client.yaml`,
 		RunE: runInit,
 	}
+	cmd.Flags().BoolVar(&initTemplate, "template", false, "Write a commented starter client.yaml instead of asking")
+	cmd.Flags().StringVarP(&initOutput, "output", "o", "client.yaml", "File --template writes")
+	cmd.Flags().BoolVar(&initForce, "force", false, "Let --template overwrite an existing file")
+	_ = cmd.MarkFlagFilename("output", "yaml", "yml")
+	return cmd
 }
 
 func runInit(cmd *cobra.Command, args []string) error {
+	if initTemplate {
+		return writeStarterConfig(initOutput, initForce)
+	}
+
 	scanner := bufio.NewScanner(os.Stdin)
 
 	// 1. Check authentication
@@ -155,6 +182,28 @@ func runInit(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// writeStarterConfig writes the starter client config to path, creating its
+// directory if needed.
+func writeStarterConfig(path string, force bool) error {
+	if !force {
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("%s already exists (use --force to overwrite)", path)
+		}
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("create config directory: %w", err)
+		}
+	}
+	if err := os.WriteFile(path, starterConfig, 0600); err != nil {
+		return fmt.Errorf("write config: %w", err)
+	}
+
+	fmt.Printf("✓ Wrote %s\n", path)
+	fmt.Printf("Edit the tunnels, then run 'fxtunnel -c %s'.\n", path)
+	return nil
+}
+
 func readLine(scanner *bufio.Scanner) string {
 	if scanner.Scan() {
 		return strings.TrimSpace(scanner.Text())
@@ -4,6 +4,8 @@ import (
 	"bufio"
 	"encoding/json"
 	"fmt"
+	"io"
+	"math"
 	"net"
 	"net/http"
 	"os"
@@ -11,6 +13,7 @@ import (
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -20,8 +23,12 @@ import (
 	"golang.org/x/crypto/bcrypt"
 
 	client "github.com/mephistofox/fxtun.dev/internal/client/core"
+	"github.com/mephistofox/fxtun.dev/internal/client/daemon"
 	"github.com/mephistofox/fxtun.dev/internal/client/keyring"
 	"github.com/mephistofox/fxtun.dev/internal/config"
+	"github.com/mephistofox/fxtun.dev/internal/inspect"
+	"github.com/mephistofox/fxtun.dev/internal/logging"
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
 )
 
 const defaultControlPort = "4443"
@@ -45,19 +52,52 @@ var (
 	authFlag     string
 	allowIPsFlag []string
 
+	// Subdomain fallback flag
+	subdomainFallbackFlag int
+
 	// Auto-close flags
 	autoCloseFlag   string
 	maxLifetimeFlag string
 
+	// Health check flags
+	healthCheckFlag         string
+	healthCheckIntervalFlag string
+
+	// Capture flag
+	captureFlag string
+
+	// Path prefix flags
+	stripPathPrefixFlag string
+	addPathPrefixFlag   string
+
+	// Response cache flags
+	cacheFlag        bool
+	cacheMaxSizeFlag string
+
 	// Preset flag
 	presetFlag string
 
+	// Sink flag
+	sinkBytesFlag string
+
 	// Inspector flags
-	inspectAddr string
-	noInspect   bool
+	inspectAddr    string
+	inspectFlag    bool
+	noInspect      bool
+	printInspector bool
 
 	// TLS flags
 	insecureFlag bool
+
+	// Local host flag
+	localAddrFlag string
+
+	// SSH bastion flags
+	viaSSHFlag string
+	sshKeyFlag string
+
+	// TCP tunnel flags
+	proxyProtocolFlag bool
 )
 
 func main() {
@@ -72,6 +112,7 @@ Quick start:
   fxtunnel http 3000                   Expose local HTTP server
   fxtunnel tcp 22                      Expose local TCP service
   fxtunnel udp 53                      Expose local UDP service
+  fxtunnel socks 1080                  Local SOCKS5 proxy out through the server
 
 Tunneling options:
   fxtunnel http 3000 --domain myapp    Use a custom subdomain
@@ -87,7 +128,7 @@ Security options (HTTP tunnels):
 
 Daemon mode (background):
   fxtunnel up                          Start daemon from config file
-  fxtunnel status                      Show daemon status and tunnels
+  fxtunnel status                      Show running clients and tunnels
   fxtunnel down                        Stop daemon gracefully
 
 Domain management:
@@ -96,7 +137,10 @@ Domain management:
 
 Project setup:
   fxtunnel init                        Create fxtunnel.yaml interactively
+  fxtunnel init --template             Write a commented starter client.yaml
+  fxtunnel config validate             Check the config file for problems
   fxtunnel presets                     List available security presets
+  fxtunnel completion bash|zsh|fish    Print a shell completion script
 
 Authentication:
   fxtunnel login                       Save API token (interactive or -t)
@@ -107,8 +151,11 @@ Configuration:
   -s, --server <host:port>             Server address (default port: 4443)
   -t, --token <token>                  API token (or use 'fxtunnel login')
   --log-level debug|info|warn|error    Log verbosity (default: warn)
+  --inspect                            Start the inspector even if the config disables it
   --inspect-addr <addr>                Inspector address (default 127.0.0.1:4040)
   --no-inspect                         Disable traffic inspector
+  --print-inspector                    Print only the inspector URL to stdout
+  --local-addr <host>                  Host tunnels connect to (default localhost)
 
 For GUI mode, use fxtunnel-gui binary.`,
 		RunE: runConfig,
@@ -120,9 +167,12 @@ For GUI mode, use fxtunnel-gui binary.`,
 	rootCmd.PersistentFlags().StringVarP(&token, "token", "t", "", "Authentication token")
 	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "warn", "Log level (debug, info, warn, error)")
 	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "console", "Log format (console, json)")
+	rootCmd.PersistentFlags().BoolVar(&inspectFlag, "inspect", false, "Start the local traffic inspector even if the config disables it")
 	rootCmd.PersistentFlags().StringVar(&inspectAddr, "inspect-addr", "", "Inspector listen address (default 127.0.0.1:4040)")
 	rootCmd.PersistentFlags().BoolVar(&noInspect, "no-inspect", false, "Disable local traffic inspector")
+	rootCmd.PersistentFlags().BoolVar(&printInspector, "print-inspector", false, "Print only the inspector URL to stdout (banner goes to stderr)")
 	rootCmd.PersistentFlags().BoolVar(&insecureFlag, "insecure", false, "Connect without TLS (for servers without TLS enabled)")
+	rootCmd.PersistentFlags().StringVar(&localAddrFlag, "local-addr", "", "Host that tunnels without their own local_addr connect to (e.g. a container's gateway)")
 
 	// HTTP tunnel command
 	httpCmd := &cobra.Command{
@@ -137,6 +187,22 @@ Security options:
   --max-lifetime 8h        Maximum tunnel lifetime (1m-7d)
   --preset openclaw        Apply security preset (random Basic Auth)
 
+Monitoring options:
+  --health-check /healthz  Path the server periodically requests through the tunnel
+  --capture errors         Keep only failing (4xx/5xx) requests in the inspector
+
+Routing options:
+  --strip-path-prefix /api Remove /api from request paths ("/api/users" -> "/users")
+  --add-path-prefix /v2    Put /v2 in front of request paths
+
+Caching options:
+  --cache                  Let the server answer repeated GET requests from a cache
+  --cache-max-size 16M     Cap the cache size (default: the server's limit)
+
+Bastion options:
+  --via-ssh user@bastion   Reach the local port through an SSH bastion
+  --ssh-key ~/.ssh/key     Key for the bastion (default: SSH agent, then ~/.ssh/id_*)
+
 Presets provide a convenient shorthand for common security configurations.
 Explicit flags override preset values.`,
 		Args: cobra.ExactArgs(1),
@@ -144,11 +210,21 @@ Explicit flags override preset values.`,
 	}
 	httpCmd.Flags().StringVarP(&domain, "domain", "d", "", "Subdomain to use (auto-generated if not set)")
 	httpCmd.Flags().StringVar(&domain, "subdomain", "", "Alias for --domain")
+	httpCmd.Flags().IntVar(&subdomainFallbackFlag, "subdomain-fallback", 0, "If the subdomain is taken, try <subdomain>-2, -3, ... up to this many times")
 	httpCmd.Flags().StringVar(&authFlag, "auth", "", "HTTP Basic Auth credentials (format: user:password, min 8 char password)")
 	httpCmd.Flags().StringSliceVar(&allowIPsFlag, "allow-ip", nil, "Allowed IP/CIDR (repeatable, e.g. 203.0.113.10,10.0.0.0/8)")
 	httpCmd.Flags().StringVar(&autoCloseFlag, "auto-close", "", "Auto-close tunnel after idle duration (e.g. 5m, 30m, 2h)")
 	httpCmd.Flags().StringVar(&maxLifetimeFlag, "max-lifetime", "", "Maximum tunnel lifetime (e.g. 1h, 8h, 7d)")
 	httpCmd.Flags().StringVar(&presetFlag, "preset", "", "Apply a named preset (available: openclaw)")
+	httpCmd.Flags().StringVar(&healthCheckFlag, "health-check", "", "Health-check path probed by the server (e.g. /healthz)")
+	httpCmd.Flags().StringVar(&healthCheckIntervalFlag, "health-check-interval", "", "Health-check interval (default 30s, min 5s)")
+	httpCmd.Flags().StringVar(&captureFlag, "capture", "", "Exchanges kept for inspection: all (default), errors or none")
+	httpCmd.Flags().StringVar(&stripPathPrefixFlag, "strip-path-prefix", "", "Path prefix removed from requests before they reach the local service (e.g. /api)")
+	httpCmd.Flags().StringVar(&addPathPrefixFlag, "add-path-prefix", "", "Path prefix put in front of requests before they reach the local service")
+	httpCmd.Flags().BoolVar(&cacheFlag, "cache", false, "Cache responses on the server as the local service's Cache-Control, ETag and Last-Modified headers allow")
+	httpCmd.Flags().StringVar(&cacheMaxSizeFlag, "cache-max-size", "0", "Maximum response cache size (e.g. 16M); 0 uses the server's limit")
+	httpCmd.Flags().StringVar(&viaSSHFlag, "via-ssh", "", "Reach the local service through an SSH bastion (user@host[:port])")
+	httpCmd.Flags().StringVar(&sshKeyFlag, "ssh-key", "", "Private key for --via-ssh (default: SSH agent, then ~/.ssh/id_*)")
 	rootCmd.AddCommand(httpCmd)
 
 	// TCP tunnel command
@@ -160,7 +236,15 @@ Explicit flags override preset values.`,
 Security options:
   --allow-ip 1.2.3.4      Restrict access to specific IPs/CIDRs (repeatable)
   --auto-close 30m         Auto-close tunnel after idle period (1m-24h)
-  --max-lifetime 8h        Maximum tunnel lifetime (1m-7d)`,
+  --max-lifetime 8h        Maximum tunnel lifetime (1m-7d)
+
+Monitoring options:
+  --health-check tcp       Let the server periodically test-connect to the local port
+
+Bastion options:
+  --via-ssh user@bastion   Reach the local port through an SSH bastion
+  --ssh-key ~/.ssh/key     Key for the bastion (default: SSH agent, then ~/.ssh/id_*)
+  --local-addr db.internal Host to connect to from the bastion (default localhost)`,
 		Args: cobra.ExactArgs(1),
 		RunE: runTCP,
 	}
@@ -168,6 +252,11 @@ Security options:
 	tcpCmd.Flags().StringSliceVar(&allowIPsFlag, "allow-ip", nil, "Allowed IP/CIDR (repeatable, e.g. 203.0.113.10,10.0.0.0/8)")
 	tcpCmd.Flags().StringVar(&autoCloseFlag, "auto-close", "", "Auto-close tunnel after idle duration (e.g. 5m, 30m, 2h)")
 	tcpCmd.Flags().StringVar(&maxLifetimeFlag, "max-lifetime", "", "Maximum tunnel lifetime (e.g. 1h, 8h, 7d)")
+	tcpCmd.Flags().StringVar(&healthCheckFlag, "health-check", "", "Enable server health checks (only \"tcp\" is supported)")
+	tcpCmd.Flags().StringVar(&healthCheckIntervalFlag, "health-check-interval", "", "Health-check interval (default 30s, min 5s)")
+	tcpCmd.Flags().StringVar(&viaSSHFlag, "via-ssh", "", "Reach the local service through an SSH bastion (user@host[:port])")
+	tcpCmd.Flags().StringVar(&sshKeyFlag, "ssh-key", "", "Private key for --via-ssh (default: SSH agent, then ~/.ssh/id_*)")
+	tcpCmd.Flags().BoolVar(&proxyProtocolFlag, "proxy-protocol", false, "Send a PROXY protocol v2 header with the client address to the local service")
 	rootCmd.AddCommand(tcpCmd)
 
 	// UDP tunnel command
@@ -189,6 +278,49 @@ Security options:
 	udpCmd.Flags().StringVar(&maxLifetimeFlag, "max-lifetime", "", "Maximum tunnel lifetime (e.g. 1h, 8h, 7d)")
 	rootCmd.AddCommand(udpCmd)
 
+	// Sink tunnel command (admin-only load testing)
+	sinkCmd := &cobra.Command{
+		Use:   "sink",
+		Short: "Create a sink tunnel for load testing (admin only)",
+		Long: `Create a sink tunnel. The server answers its port itself: uploaded bytes
+are discarded and --bytes zero bytes are streamed to every connection, so
+the data plane can be benchmarked without a local service.
+
+Example:
+  fxtunnel sink --bytes 1G
+  nc <host> <port> > /dev/null              # download 1 GB
+  head -c 1G /dev/zero | nc -N <host> <port>  # upload 1 GB`,
+		Args: cobra.NoArgs,
+		RunE: runSink,
+	}
+	sinkCmd.Flags().IntVarP(&remotePort, "remote-port", "r", 0, "Remote port (auto-assigned if 0)")
+	sinkCmd.Flags().StringVar(&sinkBytesFlag, "bytes", "0", "Bytes streamed to each connection (e.g. 512M, 1G)")
+	sinkCmd.Flags().StringSliceVar(&allowIPsFlag, "allow-ip", nil, "Allowed IP/CIDR (repeatable, e.g. 203.0.113.10,10.0.0.0/8)")
+	sinkCmd.Flags().StringVar(&maxLifetimeFlag, "max-lifetime", "", "Maximum tunnel lifetime (e.g. 1h, 8h, 7d)")
+	rootCmd.AddCommand(sinkCmd)
+
+	// SOCKS tunnel command
+	socksCmd := &cobra.Command{
+		Use:   "socks <local_port>",
+		Short: "Run a local SOCKS5 proxy that connects out through the server",
+		Long: `Run a SOCKS5 proxy on 127.0.0.1:<local_port>. Its connections leave
+through the tunnel server: the server dials each destination and the traffic
+flows over the tunnel connection. The server must enable socks tunnels, and
+its destination policy decides which hosts and ports can be reached.
+
+Only the CONNECT command without authentication is supported, so the proxy
+listens on 127.0.0.1 unless --local-addr says otherwise.
+
+Example:
+  fxtunnel socks 1080
+  curl --socks5-hostname 127.0.0.1:1080 https://example.com`,
+		Args: cobra.ExactArgs(1),
+		RunE: runSocks,
+	}
+	socksCmd.Flags().StringVar(&autoCloseFlag, "auto-close", "", "Auto-close tunnel after idle duration (e.g. 5m, 30m, 2h)")
+	socksCmd.Flags().StringVar(&maxLifetimeFlag, "max-lifetime", "", "Maximum tunnel lifetime (e.g. 1h, 8h, 7d)")
+	rootCmd.AddCommand(socksCmd)
+
 	// Login command
 	loginCmd := &cobra.Command{
 		Use:   "login",
@@ -215,6 +347,9 @@ After logout, you will need to run 'fxtunnel login' or use --token for all comma
 	// Domains command
 	rootCmd.AddCommand(newDomainsCmd())
 
+	// Config command
+	rootCmd.AddCommand(newConfigCmd())
+
 	// Presets command
 	presetsCmd := &cobra.Command{
 		Use:   "presets",
@@ -255,6 +390,8 @@ The server address is taken from --server flag or saved credentials.`,
 	}
 	rootCmd.AddCommand(versionCmd)
 
+	setupCompletion(rootCmd, httpCmd, tcpCmd)
+
 	if err := rootCmd.Execute(); err != nil {
 		os.Exit(1)
 	}
@@ -269,6 +406,7 @@ func runConfig(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to load configuration")
 	}
+	log = configLogger(cfg)
 
 	// Override from flags
 	if serverAddr != "" {
@@ -277,18 +415,21 @@ func runConfig(cmd *cobra.Command, args []string) error {
 	if token != "" {
 		cfg.Server.Token = token
 	}
-	if noInspect {
-		cfg.Inspect.Enabled = false
-	}
-	if inspectAddr != "" {
-		cfg.Inspect.Addr = inspectAddr
-	}
+	applyInspectFlags(cfg)
 	if insecureFlag {
 		cfg.Server.Insecure = true
 	}
+	if localAddrFlag != "" {
+		cfg.LocalAddr = localAddrFlag
+	}
 
 	// Normalize server address (add default port if missing)
 	cfg.Server.Address = normalizeServerAddr(cfg.Server.Address)
+	for i, addr := range cfg.Server.Addresses {
+		if addr != "" {
+			cfg.Server.Addresses[i] = normalizeServerAddr(addr)
+		}
+	}
 
 	if len(cfg.Tunnels) == 0 {
 		_ = cmd.Help()
@@ -370,6 +511,35 @@ func runHTTP(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	// Validate --subdomain-fallback
+	if subdomainFallbackFlag < 0 || subdomainFallbackFlag > config.MaxSubdomainFallback {
+		return fmt.Errorf("invalid --subdomain-fallback: must be between 0 and %d", config.MaxSubdomainFallback)
+	}
+
+	// Validate --capture
+	if _, err := inspect.ParseCaptureMode(captureFlag); err != nil {
+		return fmt.Errorf("invalid --capture: %w", err)
+	}
+
+	// Validate --strip-path-prefix and --add-path-prefix
+	if err := protocol.ValidatePathPrefix(stripPathPrefixFlag); err != nil {
+		return fmt.Errorf("invalid --strip-path-prefix: %w", err)
+	}
+	if err := protocol.ValidatePathPrefix(addPathPrefixFlag); err != nil {
+		return fmt.Errorf("invalid --add-path-prefix: %w", err)
+	}
+
+	// Validate --cache-max-size
+	cacheMaxSize, err := parseByteSize(cacheMaxSizeFlag)
+	if err != nil {
+		return fmt.Errorf("invalid --cache-max-size: %w", err)
+	}
+
+	localSSH, err := parseViaSSH()
+	if err != nil {
+		return err
+	}
+
 	tunnelCfg := config.TunnelConfig{
 		Name:          fmt.Sprintf("http-%d", port),
 		Type:          "http",
@@ -379,6 +549,16 @@ func runHTTP(cmd *cobra.Command, args []string) error {
 		AllowIPs:      allowIPsFlag,
 		AutoClose:     autoCloseFlag,
 		MaxLifetime:   maxLifetimeFlag,
+
+		HealthCheck:         healthCheckFlag,
+		HealthCheckInterval: healthCheckIntervalFlag,
+		Capture:             captureFlag,
+		SubdomainFallback:   subdomainFallbackFlag,
+		StripPathPrefix:     stripPathPrefixFlag,
+		AddPathPrefix:       addPathPrefixFlag,
+		CacheEnabled:        cacheFlag || cacheMaxSize > 0,
+		CacheMaxSize:        cacheMaxSize,
+		LocalSSH:            localSSH,
 	}
 	if addTunnelToDaemon(tunnelCfg) {
 		return nil
@@ -388,6 +568,22 @@ func runHTTP(cmd *cobra.Command, args []string) error {
 	return runClient(cfg, log)
 }
 
+// parseViaSSH returns the bastion set by --via-ssh and --ssh-key, or nil.
+func parseViaSSH() (*config.LocalSSHConfig, error) {
+	if viaSSHFlag == "" {
+		if sshKeyFlag != "" {
+			return nil, fmt.Errorf("--ssh-key needs --via-ssh")
+		}
+		return nil, nil
+	}
+	bastion, err := config.ParseSSHTarget(viaSSHFlag)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --via-ssh: %w", err)
+	}
+	bastion.KeyFile = sshKeyFlag
+	return bastion, nil
+}
+
 func runTCP(cmd *cobra.Command, args []string) error {
 	resolveCredentials()
 	log := setupLogging(logLevel, logFormat)
@@ -412,6 +608,11 @@ func runTCP(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	localSSH, err := parseViaSSH()
+	if err != nil {
+		return err
+	}
+
 	tunnelCfg := config.TunnelConfig{
 		Name:        fmt.Sprintf("tcp-%d", port),
 		Type:        "tcp",
@@ -420,6 +621,11 @@ func runTCP(cmd *cobra.Command, args []string) error {
 		AllowIPs:    allowIPsFlag,
 		AutoClose:   autoCloseFlag,
 		MaxLifetime: maxLifetimeFlag,
+
+		HealthCheck:         healthCheckFlag,
+		HealthCheckInterval: healthCheckIntervalFlag,
+		LocalSSH:            localSSH,
+		ProxyProtocol:       proxyProtocolFlag,
 	}
 	if addTunnelToDaemon(tunnelCfg) {
 		return nil
@@ -470,6 +676,95 @@ func runUDP(cmd *cobra.Command, args []string) error {
 	return runClient(cfg, log)
 }
 
+func runSocks(cmd *cobra.Command, args []string) error {
+	resolveCredentials()
+	log := setupLogging(logLevel, logFormat)
+
+	port, err := parsePort(args[0])
+	if err != nil {
+		return err
+	}
+
+	// Validate --auto-close
+	if err := client.ValidateAutoClose(autoCloseFlag); err != nil {
+		return err
+	}
+
+	// Validate --max-lifetime
+	if err := client.ValidateMaxLifetime(maxLifetimeFlag); err != nil {
+		return err
+	}
+
+	tunnelCfg := config.TunnelConfig{
+		Name:        fmt.Sprintf("socks-%d", port),
+		Type:        "socks",
+		LocalPort:   port,
+		AutoClose:   autoCloseFlag,
+		MaxLifetime: maxLifetimeFlag,
+	}
+	if addTunnelToDaemon(tunnelCfg) {
+		return nil
+	}
+
+	cfg := buildConfig(tunnelCfg)
+	cfg.Inspect.Enabled = false
+	return runClient(cfg, log)
+}
+
+func runSink(cmd *cobra.Command, args []string) error {
+	resolveCredentials()
+	log := setupLogging(logLevel, logFormat)
+
+	sinkBytes, err := parseByteSize(sinkBytesFlag)
+	if err != nil {
+		return fmt.Errorf("invalid --bytes: %w", err)
+	}
+
+	// Validate --allow-ip entries
+	if err := validateAllowIPs(allowIPsFlag); err != nil {
+		return err
+	}
+
+	// Validate --max-lifetime
+	if err := client.ValidateMaxLifetime(maxLifetimeFlag); err != nil {
+		return err
+	}
+
+	// Sink tunnels have no local service, so they are not handed to the daemon.
+	cfg := buildConfig(config.TunnelConfig{
+		Name:        "sink",
+		Type:        "sink",
+		RemotePort:  remotePort,
+		AllowIPs:    allowIPsFlag,
+		MaxLifetime: maxLifetimeFlag,
+		SinkBytes:   sinkBytes,
+	})
+	cfg.Inspect.Enabled = false
+	return runClient(cfg, log)
+}
+
+// parseByteSize parses a byte count with an optional binary suffix:
+// K, M, G or T (e.g. "512M", "1G").
+func parseByteSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	s = strings.TrimSuffix(s, "B")
+	mult := int64(1)
+	if s != "" {
+		if i := strings.IndexByte("KMGT", s[len(s)-1]); i >= 0 {
+			mult = int64(1) << (10 * (i + 1))
+			s = s[:len(s)-1]
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("not a byte size: %q", s)
+	}
+	if n > math.MaxInt64/mult {
+		return 0, fmt.Errorf("byte size too large")
+	}
+	return n * mult, nil
+}
+
 func resolveCredentials() {
 	if token == "" || serverAddr == "" {
 		kr := keyring.New()
@@ -672,7 +967,7 @@ func runUpdate(cmd *cobra.Command, args []string) error {
 	}
 
 	fmt.Printf("  \033[90mDownloading...\033[0m\n")
-	if err := client.SelfUpdate(info.DownloadURL, info.ServerHost); err != nil {
+	if err := client.SelfUpdate(info.DownloadURL, info.SHA256, info.ServerHost); err != nil {
 		fmt.Fprintf(os.Stderr, "  \033[31mUpdate failed: %v\033[0m\n", err)
 		return err
 	}
@@ -693,7 +988,7 @@ func checkAndAutoUpdate(addr string) {
 			fmt.Fprintf(os.Stderr, "  \033[31mNo download available for this platform\033[0m\n")
 			os.Exit(1)
 		}
-		if err := client.SelfUpdateAndRestart(info.DownloadURL, info.ServerHost); err != nil {
+		if err := client.SelfUpdateAndRestart(info.DownloadURL, info.SHA256, info.ServerHost); err != nil {
 			fmt.Fprintf(os.Stderr, "  \033[31mAuto-update failed: %v\033[0m\n", err)
 			os.Exit(1)
 		}
@@ -722,16 +1017,26 @@ func buildConfig(tunnel config.TunnelConfig) *config.ClientConfig {
 			MaxBodySize: 262144,
 			MaxEntries:  1000,
 		},
+		LocalAddr: localAddrFlag,
 	}
 
+	applyInspectFlags(cfg)
+
+	return cfg
+}
+
+// applyInspectFlags applies --inspect, --no-inspect and --inspect-addr on top
+// of the loaded or built config.
+func applyInspectFlags(cfg *config.ClientConfig) {
+	if inspectFlag {
+		cfg.Inspect.Enabled = true
+	}
 	if noInspect {
 		cfg.Inspect.Enabled = false
 	}
 	if inspectAddr != "" {
 		cfg.Inspect.Addr = inspectAddr
 	}
-
-	return cfg
 }
 
 // getInstalledWebsite returns the website URL saved by the install script.
@@ -799,11 +1104,25 @@ func runClient(cfg *config.ClientConfig, log zerolog.Logger) error {
 		Str("server", cfg.Server.Address).
 		Msg("Starting fxTunnel Client")
 
+	if inspectFlag && noInspect {
+		return fmt.Errorf("--inspect and --no-inspect are mutually exclusive")
+	}
+	if printInspector && !cfg.Inspect.Enabled {
+		return fmt.Errorf("--print-inspector requires the inspector (remove --no-inspect)")
+	}
+
+	// With --print-inspector stdout carries only the inspector URL, so the
+	// human-readable banner moves to stderr.
+	out := os.Stdout
+	if printInspector {
+		out = os.Stderr
+	}
+
 	// Create client
 	c := client.New(cfg, log)
 	c.SetVersion(Version)
 
-	fmt.Println("  \033[90mConnecting to fxtunnel server...\033[0m")
+	fmt.Fprintln(out, "  \033[90mConnecting to fxtunnel server...\033[0m")
 
 	// Connect
 	if err := c.Connect(); err != nil {
@@ -814,38 +1133,69 @@ func runClient(cfg *config.ClientConfig, log zerolog.Logger) error {
 	// Background update check (with forced auto-update if incompatible)
 	go checkAndAutoUpdate(cfg.Server.Address)
 
-	fmt.Println("  \033[32mTunnel established!\033[0m")
+	fmt.Fprintln(out, "  \033[32mTunnel established!\033[0m")
 	for _, t := range c.GetTunnels() {
 		if t.URL != "" {
-			fmt.Printf("  HTTP:  %s\n", t.URL)
+			fmt.Fprintf(out, "  HTTP:  %s\n", t.URL)
 			httpsURL := t.HTTPSURL
 			if httpsURL == "" && strings.HasPrefix(t.URL, "http://") {
 				httpsURL = "https://" + strings.TrimPrefix(t.URL, "http://")
 			}
 			if httpsURL != "" {
-				fmt.Printf("  HTTPS: %s\n", httpsURL)
+				fmt.Fprintf(out, "  HTTPS: %s\n", httpsURL)
 			}
-		} else {
-			fmt.Printf("  %s: %s\n", strings.ToUpper(t.Config.Type), t.RemoteAddr)
+			if t.InspectURL != "" {
+				fmt.Fprintf(out, "  Inspect: %s\n", t.InspectURL)
+			}
+		} else if t.Config.Type != "socks" {
+			fmt.Fprintf(out, "  %s: %s\n", strings.ToUpper(t.Config.Type), t.RemoteAddr)
+		}
+		switch t.Config.Type {
+		case "sink":
+			fmt.Fprintf(out, "  Sink: discarding uploads, streaming %d bytes per connection\n", t.Config.SinkBytes)
+		case "socks":
+			fmt.Fprintf(out, "  SOCKS5: %s, connecting out through the server\n", t.Config.GetLocalAddress())
+		default:
+			fmt.Fprintf(out, "  Forwarding to localhost:%d\n", t.Config.LocalPort)
 		}
-		fmt.Printf("  Forwarding to localhost:%d\n", t.Config.LocalPort)
 		if t.BasicAuthEnabled {
-			fmt.Println("  Basic Auth: enabled")
+			fmt.Fprintln(out, "  Basic Auth: enabled")
 		}
 		if t.AllowIPsCount > 0 {
-			fmt.Printf("  IP Allowlist: %d %s\n", t.AllowIPsCount, pluralize(t.AllowIPsCount, "entry", "entries"))
+			fmt.Fprintf(out, "  IP Allowlist: %d %s\n", t.AllowIPsCount, pluralize(t.AllowIPsCount, "entry", "entries"))
 		}
 		if t.AutoClose != "" {
-			fmt.Printf("  Auto-close: %s (idle timeout)\n", t.AutoClose)
+			fmt.Fprintf(out, "  Auto-close: %s (idle timeout)\n", t.AutoClose)
 		}
 		if t.MaxLifetime != "" {
-			fmt.Printf("  Max lifetime: %s\n", t.MaxLifetime)
+			fmt.Fprintf(out, "  Max lifetime: %s\n", t.MaxLifetime)
 		}
 	}
 	if addr := c.InspectorAddr(); addr != "" {
-		fmt.Printf("  Inspector: http://%s\n", addr)
+		inspectorURL := "http://" + addr
+		log.Info().Str("url", inspectorURL).Msg("Inspector listening")
+		fmt.Fprintf(out, "  Inspector: %s\n", inspectorURL)
+		if printInspector {
+			fmt.Println(inspectorURL)
+		}
+		// Let "fxtunnel status" in another terminal find this client
+		lockPath, err := daemon.WriteInspectorLock(daemon.DefaultInspectorLockDir(), &daemon.InspectorLock{
+			PID:       os.Getpid(),
+			Addr:      addr,
+			Server:    cfg.Server.Address,
+			StartedAt: time.Now(),
+		})
+		if err != nil {
+			log.Debug().Err(err).Msg("Failed to write inspector lock")
+		} else {
+			defer daemon.RemoveState(lockPath)
+		}
+	} else if printInspector {
+		// A script waiting for the URL would otherwise wait forever
+		closeClient(c, log)
+		return fmt.Errorf("--print-inspector: the inspector is not running")
 	}
-	fmt.Println("  \033[90mReady to receive connections\033[0m")
+	fmt.Fprintln(out, "  \033[90mReady to receive connections\033[0m")
 
 	// Wait for shutdown signal
 	sigChan := make(chan os.Signal, 1)
@@ -854,6 +1204,12 @@ func runClient(cfg *config.ClientConfig, log zerolog.Logger) error {
 	sig := <-sigChan
 	log.Info().Str("signal", sig.String()).Msg("Received shutdown signal")
 
+	closeClient(c, log)
+	return nil
+}
+
+// closeClient closes c, giving up after 5 seconds.
+func closeClient(c *client.Client, log zerolog.Logger) {
 	done := make(chan struct{})
 	go func() { c.Close(); close(done) }()
 	select {
@@ -861,7 +1217,6 @@ func runClient(cfg *config.ClientConfig, log zerolog.Logger) error {
 	case <-time.After(5 * time.Second):
 		log.Warn().Msg("Close timeout, exiting")
 	}
-	return nil
 }
 
 // pluralize returns singular if count == 1, otherwise plural.
@@ -873,22 +1228,26 @@ func pluralize(count int, singular, plural string) string {
 }
 
 func setupLogging(level, format string) zerolog.Logger {
-	lvl, err := zerolog.ParseLevel(level)
-	if err != nil {
-		lvl = zerolog.InfoLevel
-	}
-	zerolog.SetGlobalLevel(lvl)
+	return newLogger(config.LoggingSettings{Level: level, Format: format})
+}
 
-	var log zerolog.Logger
-	if format == "json" {
-		log = zerolog.New(os.Stdout).With().Timestamp().Logger()
-	} else {
-		output := zerolog.ConsoleWriter{
-			Out:        os.Stdout,
-			TimeFormat: time.RFC3339,
-		}
-		log = zerolog.New(output).With().Timestamp().Logger()
+// newLogger builds the logger from settings, keeping stdout clean for scripts
+// reading the --print-inspector URL.
+func newLogger(settings config.LoggingSettings) zerolog.Logger {
+	var w io.Writer = os.Stdout
+	if printInspector {
+		w = os.Stderr
 	}
+	return logging.New(w, settings)
+}
 
-	return log
+// configLogger applies the log fields selected in the config file on top of
+// the --log-level and --log-format flags.
+func configLogger(cfg *config.ClientConfig) zerolog.Logger {
+	return newLogger(config.LoggingSettings{
+		Level:         logLevel,
+		Format:        logFormat,
+		IncludeFields: cfg.Logging.IncludeFields,
+		ExcludeFields: cfg.Logging.ExcludeFields,
+	})
 }
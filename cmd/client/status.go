@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mephistofox/fxtun.dev/internal/client/daemon"
+)
+
+var statusJSON bool
+
+func newStatusCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show running clients and their tunnels",
+		Long: `Show the running daemon and every client started in the foreground
+(fxtunnel http/tcp/udp or a config file) with their tunnels, request counts
+and error rates.
+
+Foreground clients are found through their traffic inspector, so clients
+started with --no-inspect are not listed.
+
+Examples:
+  fxtunnel status               Print a table
+  fxtunnel status --json        Print JSON for scripts`,
+		RunE: runStatus,
+	}
+	cmd.Flags().BoolVar(&statusJSON, "json", false, "Print machine-readable JSON")
+	return cmd
+}
+
+// inspectorTunnel is a tunnel as the inspector's /api/tunnels reports it.
+type inspectorTunnel struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	Type          string `json:"type"`
+	URL           string `json:"url,omitempty"`
+	RemoteAddr    string `json:"remote_addr,omitempty"`
+	LocalPort     int    `json:"local_port"`
+	ActiveConns   int64  `json:"active_conns"`
+	DialFailures  int64  `json:"dial_failures"`
+	BytesSent     int64  `json:"bytes_sent"`
+	BytesReceived int64  `json:"bytes_received"`
+	Requests      int64  `json:"requests"`
+	Captured      int    `json:"captured"`
+	Errors        int    `json:"errors"`
+
+	LocalUnreachable bool `json:"local_unreachable"`
+}
+
+// clientStatus describes a client running in the foreground.
+type clientStatus struct {
+	PID            int               `json:"pid"`
+	Server         string            `json:"server"`
+	Inspector      string            `json:"inspector"`
+	StartedAt      time.Time         `json:"started_at"`
+	Uptime         string            `json:"uptime"`
+	TotalExchanges int               `json:"total_exchanges"`
+	Tunnels        []inspectorTunnel `json:"tunnels"`
+}
+
+func runStatus(cmd *cobra.Command, args []string) error {
+	var daemonStatus *daemon.StatusResponse
+	st, daemonRunning := daemon.IsDaemonRunning(daemon.DefaultStatePath())
+	if daemonRunning && statusJSON {
+		status, err := fetchDaemonStatus(st.APIAddr, st.Token)
+		if err != nil {
+			return fmt.Errorf("failed to fetch daemon status: %w", err)
+		}
+		daemonStatus = status
+	}
+
+	// A client whose inspector does not answer has exited or is shutting
+	// down, so it is left out rather than reported as an error
+	clients := []clientStatus{}
+	for _, lock := range daemon.ListInspectorLocks(daemon.DefaultInspectorLockDir()) {
+		if status, err := fetchClientStatus(lock); err == nil {
+			clients = append(clients, *status)
+		}
+	}
+
+	if statusJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(map[string]any{
+			"daemon":  daemonStatus,
+			"clients": clients,
+		})
+	}
+
+	if !daemonRunning && len(clients) == 0 {
+		fmt.Println("No running fxtunnel client found.")
+		fmt.Println("Start one with 'fxtunnel http <port>' or run tunnels in the background with 'fxtunnel up'.")
+		return nil
+	}
+
+	if daemonRunning {
+		fmt.Printf("Daemon running (PID %d)\n", st.PID)
+		fmt.Printf("Server: %s\n", st.Server)
+		printDaemonStatus(st.APIAddr, st.Token)
+	}
+	for i, c := range clients {
+		if daemonRunning || i > 0 {
+			fmt.Println()
+		}
+		printClientStatus(c)
+	}
+	return nil
+}
+
+// fetchClientStatus asks the inspector of a foreground client for its
+// status and tunnels.
+func fetchClientStatus(lock *daemon.InspectorLock) (*clientStatus, error) {
+	httpClient := &http.Client{Timeout: 2 * time.Second}
+	base := "http://" + lock.Addr
+
+	var status struct {
+		UptimeSeconds  int `json:"uptime_seconds"`
+		TotalExchanges int `json:"total_exchanges"`
+	}
+	if err := getJSON(httpClient, base+"/api/status", &status); err != nil {
+		return nil, err
+	}
+	var tunnels struct {
+		Tunnels []inspectorTunnel `json:"tunnels"`
+	}
+	if err := getJSON(httpClient, base+"/api/tunnels", &tunnels); err != nil {
+		return nil, err
+	}
+
+	return &clientStatus{
+		PID:            lock.PID,
+		Server:         lock.Server,
+		Inspector:      base,
+		StartedAt:      lock.StartedAt,
+		Uptime:         (time.Duration(status.UptimeSeconds) * time.Second).String(),
+		TotalExchanges: status.TotalExchanges,
+		Tunnels:        tunnels.Tunnels,
+	}, nil
+}
+
+func getJSON(httpClient *http.Client, url string, v any) error {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func printClientStatus(c clientStatus) {
+	fmt.Printf("Client running (PID %d)\n", c.PID)
+	fmt.Printf("Server: %s\n", c.Server)
+	fmt.Printf("Inspector: %s\n", c.Inspector)
+
+	if len(c.Tunnels) == 0 {
+		fmt.Println("  No active tunnels.")
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "  NAME\tTYPE\tADDRESS\tLOCAL\tREQUESTS\tERRORS\tCONNS\tDIAL FAILURES")
+		for _, t := range c.Tunnels {
+			name := t.Name
+			if name == "" {
+				name = "-"
+			}
+			addr := t.URL
+			if addr == "" {
+				addr = t.RemoteAddr
+			}
+			dialFailures := strconv.FormatInt(t.DialFailures, 10)
+			if t.LocalUnreachable {
+				dialFailures += " (local service down)"
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%d\t%d\t%s\t%d\t%s\n",
+				name, strings.ToUpper(t.Type), addr, t.LocalPort, t.Requests, errorRate(t), t.ActiveConns, dialFailures)
+		}
+		_ = w.Flush()
+	}
+	fmt.Printf("  Uptime: %s\n", c.Uptime)
+}
+
+// errorRate formats the share of captured exchanges that failed. Only the
+// inspector's buffer is counted, so tunnels without captures show "-".
+func errorRate(t inspectorTunnel) string {
+	if t.Captured == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d (%.1f%%)", t.Errors, float64(t.Errors)*100/float64(t.Captured))
+}
@@ -4,18 +4,22 @@ import (
 	"context"
 	"crypto/sha256"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"syscall"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
 	"github.com/spf13/cobra"
 
 	"github.com/mephistofox/fxtun.dev/internal/server/api"
 	"github.com/mephistofox/fxtun.dev/internal/server/auth"
 	"github.com/mephistofox/fxtun.dev/internal/config"
+	"github.com/mephistofox/fxtun.dev/internal/logging"
 	server "github.com/mephistofox/fxtun.dev/internal/server/core"
 	"github.com/mephistofox/fxtun.dev/internal/server/database"
 	fxdns "github.com/mephistofox/fxtun.dev/internal/server/dns"
@@ -41,6 +45,8 @@ var (
 	logLevel   string
 	logFormat  string
 	serverMode string
+
+	schedulerDryRun bool
 )
 
 func main() {
@@ -60,6 +66,7 @@ Website: https://fxtun.dev`,
 	rootCmd.Flags().StringVar(&logLevel, "log-level", "info", "Log level (debug, info, warn, error)")
 	rootCmd.Flags().StringVar(&logFormat, "log-format", "console", "Log format (console, json)")
 	rootCmd.Flags().StringVar(&serverMode, "mode", "", "Server mode: standalone, hub, node")
+	rootCmd.Flags().BoolVar(&schedulerDryRun, "scheduler-dry-run", false, "Log what the subscription scheduler would do without changing anything")
 
 	versionCmd := &cobra.Command{
 		Use:   "version",
@@ -72,6 +79,29 @@ Website: https://fxtun.dev`,
 	}
 	rootCmd.AddCommand(versionCmd)
 
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Work with the server configuration file",
+	}
+	validateCmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Check the configuration file without starting the server",
+		Long: `Load the configuration the way the server does and report every problem
+found, with the line it is on where possible. Exits with status 1 when the
+configuration is invalid, so it can run in CI.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			report := config.CheckServerConfig(configFile)
+			report.Print(os.Stdout)
+			if report.Failed() {
+				os.Exit(1)
+			}
+		},
+	}
+	validateCmd.Flags().StringVarP(&configFile, "config", "c", "", "Config file path")
+	configCmd.AddCommand(validateCmd)
+	rootCmd.AddCommand(configCmd)
+
 	if err := rootCmd.Execute(); err != nil {
 		os.Exit(1)
 	}
@@ -98,9 +128,11 @@ func run(cmd *cobra.Command, args []string) error {
 	}
 
 	// Override log settings from config if not set via flags
-	if !cmd.Flags().Changed("log-level") && cfg.Logging.Level != "" {
-		log = setupLogging(cfg.Logging.Level, cfg.Logging.Format)
+	logSettings := cfg.Logging
+	if cmd.Flags().Changed("log-level") || logSettings.Level == "" {
+		logSettings.Level, logSettings.Format = logLevel, logFormat
 	}
+	log = logging.New(os.Stdout, logSettings)
 
 	log.Info().
 		Str("mode", string(cfg.EffectiveMode())).
@@ -181,9 +213,15 @@ func run(cmd *cobra.Command, args []string) error {
 	// Create server
 	srv := server.New(cfg, log)
 
+	// Data-plane metrics are served alongside the API's on /metrics
+	prometheus.MustRegister(srv.MetricsCollector())
+
 	// Set database if initialized
 	if db != nil {
 		srv.SetDatabase(db)
+		if err := srv.LoadSuspensions(); err != nil {
+			log.Warn().Err(err).Msg("Failed to load suspended subdomains")
+		}
 	}
 
 	// Set auth service for JWT validation
@@ -206,6 +244,9 @@ func run(cmd *cobra.Command, args []string) error {
 		srv.SetLocalNodeID(serverID)
 		log.Info().Str("server_id", serverID).Msg("Redis tunnel registry enabled")
 
+		// Bans from the web panel also keep clients out
+		srv.SetIPBanStore(fxredis.NewIPBanStore(redisClient))
+
 		// Set node registry for hub and node modes
 		if cfg.EffectiveMode() == config.ModeHub || cfg.EffectiveMode() == config.ModeNode {
 			nodeRegistry = fxredis.NewNodeRegistry(redisClient)
@@ -228,6 +269,19 @@ func run(cmd *cobra.Command, args []string) error {
 			log.Info().Str("db", cfg.GeoIP.Database).Msg("GeoIP database loaded")
 		}
 	}
+	if cfg.GeoIP.Enabled && cfg.GeoIP.ASNDatabase != "" {
+		asn, err := geoip.NewASN(cfg.GeoIP.ASNDatabase)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to load ASN database, connection policy ignores networks")
+		} else {
+			srv.SetASNLookup(asn)
+			defer asn.Close()
+			log.Info().Str("db", cfg.GeoIP.ASNDatabase).Msg("ASN database loaded")
+		}
+	}
+	if !cfg.GeoIP.Policy.Empty() && !cfg.GeoIP.Enabled {
+		log.Warn().Msg("geoip.policy is set but geoip.enabled is false, connections are not filtered")
+	}
 
 	// Set Telegram notifier on tunnel server
 	if telegramNotifier != nil {
@@ -239,12 +293,59 @@ func run(cmd *cobra.Command, args []string) error {
 		if err := srv.InitCustomDomains(); err != nil {
 			log.Error().Err(err).Msg("Failed to initialize custom domains")
 		}
-		// Set Redis TLS cache if available
-		if redisClient != nil {
-			if cm := srv.CertManager(); cm != nil {
-				cm.SetRedisCache(fxredis.NewTLSCache(redisClient))
-				log.Info().Msg("Redis TLS certificate cache enabled")
+	}
+
+	// Authoritative DNS server (optional). Resolves static records from a YAML
+	// zone file plus dynamic tunnel subdomains from the Redis tunnel registry.
+	// Started before the tunnel server, which may need it for ACME challenges.
+	var dnsSrv *fxdns.Server
+	if cfg.DNS.Enabled && cfg.DNS.ZoneFile != "" {
+		var dnsTunnels fxdns.TunnelLookup
+		var dnsNodes fxdns.NodeLookup
+		if tunnelRegistry != nil {
+			dnsTunnels = tunnelRegistry
+		}
+		if nodeRegistry != nil {
+			dnsNodes = nodeRegistry
+		}
+
+		dnsSrv, err = fxdns.New(fxdns.Config{
+			Enabled:  true,
+			Listen:   cfg.DNS.Listen,
+			ZoneFile: cfg.DNS.ZoneFile,
+		}, dnsTunnels, dnsNodes, log)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to init DNS server")
+		} else if err := dnsSrv.Start(); err != nil {
+			log.Error().Err(err).Msg("Failed to start DNS server")
+			dnsSrv = nil
+		}
+	}
+
+	// Wildcard certificate for the base domain via ACME DNS-01. Set up
+	// before Start so the HTTPS listener serves it.
+	if cfg.TLS.ACMEDNSProvider != "" {
+		var provider fxtls.DNSProvider
+		switch cfg.TLS.ACMEDNSProvider {
+		case "builtin":
+			if dnsSrv != nil {
+				provider = dnsSrv
 			}
+		case "exec":
+			provider = &fxtls.ExecDNSProvider{Path: cfg.TLS.ACMEDNSExec, Propagation: cfg.TLS.ACMEDNSPropagation}
+		}
+		if provider == nil {
+			log.Error().Msg("Wildcard certificate disabled: the built-in DNS server is not running")
+		} else if err := srv.InitWildcardCert(provider); err != nil {
+			log.Error().Err(err).Msg("Failed to initialize wildcard certificate")
+		}
+	}
+
+	// Set Redis TLS cache if available
+	if redisClient != nil {
+		if cm := srv.CertManager(); cm != nil {
+			cm.SetRedisCache(fxredis.NewTLSCache(redisClient))
+			log.Info().Msg("Redis TLS certificate cache enabled")
 		}
 	}
 
@@ -285,6 +386,54 @@ func run(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	// The web API binds after the tunnel server; check its port up front so a
+	// conflict fails the start instead of surfacing later as a runtime error.
+	if cfg.Web.Enabled && !cfg.Web.Unified.Enabled {
+		if err := server.CheckPortAvailable("web", fmt.Sprintf("%s:%d", cfg.Web.Bind, cfg.Web.Port)); err != nil {
+			log.Fatal().Err(err).Msg("Failed to start server")
+		}
+	}
+
+	// Build the web API before the tunnel server starts, so in unified mode
+	// the dashboard hosts are routed to it from the first request instead of
+	// to tunnels.
+	if cfg.Web.Enabled && authService != nil {
+		tunnelProvider := &serverAdapter{srv: srv}
+		var cdm api.CustomDomainManager
+		if cfg.CustomDomains.Enabled {
+			cdm = &customDomainAdapter{srv: srv}
+		}
+		srv.InspectManager().SetStore(db.Exchanges)
+
+		var apiOpts []api.Option
+		if redisClient != nil {
+			apiOpts = append(apiOpts,
+				api.WithDeviceStore(fxredis.NewDeviceStore(redisClient)),
+				api.WithOAuthStore(fxredis.NewOAuthStore(redisClient)),
+				api.WithIPBanStore(fxredis.NewIPBanStore(redisClient)),
+			)
+			// Add node registry for hub mode admin endpoints
+			if cfg.EffectiveMode() == config.ModeHub {
+				apiOpts = append(apiOpts, api.WithNodeRegistry(fxredis.NewNodeRegistry(redisClient)))
+			}
+		}
+
+		apiServer = api.New(cfg, db, authService, tunnelProvider, srv.InspectManager(), cdm, log, apiOpts...)
+		apiServer.SetVersion(Version)
+		apiServer.SetMinVersion(cfg.Server.MinVersion)
+		apiServer.SetReplayProvider(srv.HTTPRouter())
+
+		if telegramNotifier != nil {
+			apiServer.SetTelegramNotifier(telegramNotifier)
+		}
+
+		if cfg.Web.Unified.Enabled {
+			// Share the tunnel HTTP listener: dashboard hosts go to the API,
+			// everything else to tunnels.
+			srv.HTTPRouter().SetDashboard(apiServer.Router(), cfg.DashboardHosts())
+		}
+	}
+
 	// Start server
 	if err := srv.Start(); err != nil {
 		log.Fatal().Err(err).Msg("Failed to start server")
@@ -298,29 +447,11 @@ func run(cmd *cobra.Command, args []string) error {
 		Str("mode", string(cfg.EffectiveMode())).
 		Msg("Server started")
 
-	// Authoritative DNS server (optional). Resolves static records from a YAML
-	// zone file plus dynamic tunnel subdomains from the Redis tunnel registry.
-	var dnsSrv *fxdns.Server
-	if cfg.DNS.Enabled && cfg.DNS.ZoneFile != "" {
-		var dnsTunnels fxdns.TunnelLookup
-		var dnsNodes fxdns.NodeLookup
-		if tunnelRegistry != nil {
-			dnsTunnels = tunnelRegistry
-		}
-		if nodeRegistry != nil {
-			dnsNodes = nodeRegistry
-		}
-
-		dnsSrv, err = fxdns.New(fxdns.Config{
-			Enabled:  true,
-			Listen:   cfg.DNS.Listen,
-			ZoneFile: cfg.DNS.ZoneFile,
-		}, dnsTunnels, dnsNodes, log)
+	var drainStatusServer *http.Server
+	if cfg.Server.DrainStatusAddr != "" {
+		drainStatusServer, err = startDrainStatusServer(cfg.Server.DrainStatusAddr, srv, log)
 		if err != nil {
-			log.Error().Err(err).Msg("Failed to init DNS server")
-		} else if err := dnsSrv.Start(); err != nil {
-			log.Error().Err(err).Msg("Failed to start DNS server")
-			dnsSrv = nil
+			log.Fatal().Err(err).Msg("Failed to start drain status listener")
 		}
 	}
 
@@ -399,48 +530,26 @@ func run(cmd *cobra.Command, args []string) error {
 	}
 
 	// Start API server if web panel is enabled
-	if cfg.Web.Enabled && authService != nil {
-		tunnelProvider := &serverAdapter{srv: srv}
-		var cdm api.CustomDomainManager
-		if cfg.CustomDomains.Enabled {
-			cdm = &customDomainAdapter{srv: srv}
-		}
-		srv.InspectManager().SetStore(db.Exchanges)
-
-		var apiOpts []api.Option
-		if redisClient != nil {
-			apiOpts = append(apiOpts,
-				api.WithDeviceStore(fxredis.NewDeviceStore(redisClient)),
-				api.WithOAuthStore(fxredis.NewOAuthStore(redisClient)),
-				api.WithIPBanStore(fxredis.NewIPBanStore(redisClient)),
-			)
-			// Add node registry for hub mode admin endpoints
-			if cfg.EffectiveMode() == config.ModeHub {
-				apiOpts = append(apiOpts, api.WithNodeRegistry(fxredis.NewNodeRegistry(redisClient)))
-			}
-		}
-
-		apiServer = api.New(cfg, db, authService, tunnelProvider, srv.InspectManager(), cdm, log, apiOpts...)
-		apiServer.SetVersion(Version)
-		apiServer.SetMinVersion(cfg.Server.MinVersion)
-		apiServer.SetReplayProvider(srv.HTTPRouter())
-
-		if telegramNotifier != nil {
-			apiServer.SetTelegramNotifier(telegramNotifier)
-		}
-
+	if apiServer != nil {
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 
-		go func() {
-			if err := apiServer.Start(ctx); err != nil {
-				log.Error().Err(err).Msg("API server error")
-			}
-		}()
+		if cfg.Web.Unified.Enabled {
+			log.Info().
+				Int("port", cfg.Server.HTTPPort).
+				Strs("hosts", cfg.DashboardHosts()).
+				Msg("Web panel API started on the tunnel HTTP listener")
+		} else {
+			go func() {
+				if err := apiServer.Start(ctx); err != nil {
+					log.Error().Err(err).Msg("API server error")
+				}
+			}()
 
-		log.Info().
-			Int("port", cfg.Web.Port).
-			Msg("Web panel API started")
+			log.Info().
+				Int("port", cfg.Web.Port).
+				Msg("Web panel API started")
+		}
 
 		// Start periodic cleanup
 		go func() {
@@ -465,6 +574,12 @@ func run(cmd *cobra.Command, args []string) error {
 					} else if deleted > 0 {
 						log.Info().Int64("deleted", deleted).Msg("Cleaned up old inspect exchanges")
 					}
+					// Share links can no longer be used once expired
+					if deleted, err := db.InspectShares.DeleteExpiredBefore(time.Now()); err != nil {
+						log.Error().Err(err).Msg("Failed to cleanup expired inspect share links")
+					} else if deleted > 0 {
+						log.Info().Int64("deleted", deleted).Msg("Cleaned up expired inspect share links")
+					}
 				}
 			}
 		}()
@@ -503,6 +618,13 @@ func run(cmd *cobra.Command, args []string) error {
 		var emailService *email.Service
 		var notifier *email.Notifier
 		if cfg.SMTP.Enabled {
+			if cfg.SMTP.TemplateDir != "" {
+				n, err := email.LoadTemplates(cfg.SMTP.TemplateDir)
+				if err != nil {
+					log.Fatal().Err(err).Msg("Failed to load email templates")
+				}
+				log.Info().Str("dir", cfg.SMTP.TemplateDir).Int("templates", n).Msg("Custom email templates loaded")
+			}
 			emailService = email.New(&cfg.SMTP, log)
 			baseURL := cfg.SMTP.BaseURL
 			if baseURL == "" {
@@ -539,12 +661,20 @@ func run(cmd *cobra.Command, args []string) error {
 		}
 		apiServer.SetPaymentProviders(providers)
 
+		sched := scheduler.New(db, cfg, providers, log)
+		if schedulerDryRun {
+			sched.SetDryRun(true)
+			log.Warn().Msg("Scheduler dry run: no subscription, payment, history or domain changes will be made")
+		}
+
+		// History pruning runs whether or not payments are enabled
+		go sched.StartHistoryMaintenance(ctx)
+
 		// Start subscription scheduler if payments are enabled
 		if cfg.YooKassa.Enabled || cfg.Creem.Enabled {
-			subscriptionScheduler := scheduler.New(db, cfg, providers, log)
 
 			// Register event handler for logging
-			subscriptionScheduler.OnEvent(func(event scheduler.Event) {
+			sched.OnEvent(func(event scheduler.Event) {
 				switch event.Type {
 				case scheduler.EventSubscriptionExpiring:
 					log.Info().
@@ -572,15 +702,29 @@ func run(cmd *cobra.Command, args []string) error {
 				}
 			})
 
+			// Apply plan changes to connected clients, closing tunnels
+			// above a downgraded plan's limit
+			sched.OnEvent(func(event scheduler.Event) {
+				if event.Type != scheduler.EventSubscriptionExpired && event.Type != scheduler.EventPlanChanged {
+					return
+				}
+				if err := srv.RefreshUserPlan(event.UserID); err != nil {
+					log.Error().Err(err).Int64("user_id", event.UserID).Msg("Failed to apply plan change to connected clients")
+				}
+			})
+
 			// Register email notifier if available
 			if notifier != nil {
-				subscriptionScheduler.OnEvent(notifier.HandleSchedulerEvent)
+				sched.OnEvent(notifier.HandleSchedulerEvent)
 				log.Info().Msg("Email notifications enabled for scheduler")
 			}
 
-			go subscriptionScheduler.Start(ctx)
+			go sched.Start(ctx)
 			log.Info().Msg("Subscription scheduler started")
 		}
+
+		// Started after all handlers are registered, as emit does not lock
+		go sched.StartDomainMaintenance(ctx)
 	}
 
 	// Wait for shutdown signal
@@ -597,41 +741,55 @@ func run(cmd *cobra.Command, args []string) error {
 		dnsSrv.Stop()
 	}
 
+	// The API stays up while the tunnel server drains so /health/drain can
+	// report its progress (in unified mode it shares the tunnel HTTP
+	// listener, which Stop closes first; the drain status listener outlives
+	// the drain in either mode).
+	stopErr := srv.Stop()
+
+	if drainStatusServer != nil {
+		_ = drainStatusServer.Close()
+	}
+
 	if apiServer != nil {
 		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer shutdownCancel()
 		_ = apiServer.Shutdown(shutdownCtx)
 	}
 
-	if err := srv.Stop(); err != nil {
-		log.Error().Err(err).Msg("Error during shutdown")
-		return err
+	if stopErr != nil {
+		log.Error().Err(stopErr).Msg("Error during shutdown")
+		return stopErr
 	}
 
 	return nil
 }
 
-func setupLogging(level, format string) zerolog.Logger {
-	// Parse level
-	lvl, err := zerolog.ParseLevel(level)
+// startDrainStatusServer serves /health/drain on the internal address addr.
+func startDrainStatusServer(addr string, srv *server.Server, log zerolog.Logger) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
 	if err != nil {
-		lvl = zerolog.InfoLevel
+		return nil, fmt.Errorf("listen drain status on %s: %w", addr, err)
 	}
-	zerolog.SetGlobalLevel(lvl)
 
-	// Setup output
-	var log zerolog.Logger
-	if format == "json" {
-		log = zerolog.New(os.Stdout).With().Timestamp().Logger()
-	} else {
-		output := zerolog.ConsoleWriter{
-			Out:        os.Stdout,
-			TimeFormat: time.RFC3339,
-		}
-		log = zerolog.New(output).With().Timestamp().Logger()
+	mux := http.NewServeMux()
+	mux.Handle("GET /health/drain", api.DrainStatusHandler((&serverAdapter{srv: srv}).GetDrainStatus))
+	httpSrv := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
 	}
+	go func() {
+		if err := httpSrv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Error().Err(err).Msg("Drain status server error")
+		}
+	}()
+
+	log.Info().Str("addr", ln.Addr().String()).Msg("Drain status endpoint started")
+	return httpSrv, nil
+}
 
-	return log
+func setupLogging(level, format string) zerolog.Logger {
+	return logging.New(os.Stdout, config.LoggingSettings{Level: level, Format: format})
 }
 
 // serverAdapter wraps *server.Server to implement api.TunnelProvider
@@ -644,15 +802,17 @@ func (a *serverAdapter) GetTunnelsByUserID(userID int64) []api.TunnelInfo {
 	result := make([]api.TunnelInfo, len(serverTunnels))
 	for i, t := range serverTunnels {
 		result[i] = api.TunnelInfo{
-			ID:         t.ID,
-			Type:       t.Type,
-			Name:       t.Name,
-			Subdomain:  t.Subdomain,
-			RemotePort: t.RemotePort,
-			LocalPort:  t.LocalPort,
-			ClientID:   t.ClientID,
-			UserID:     t.UserID,
-			CreatedAt:  t.CreatedAt,
+			ID:           t.ID,
+			Type:         t.Type,
+			Name:         t.Name,
+			Subdomain:    t.Subdomain,
+			RemotePort:   t.RemotePort,
+			LocalPort:    t.LocalPort,
+			ClientID:     t.ClientID,
+			UserID:       t.UserID,
+			CreatedAt:    t.CreatedAt,
+			Health:       convertTunnelHealth(t.Health),
+			LastActivity: t.LastActivity,
 		}
 	}
 	return result
@@ -662,6 +822,78 @@ func (a *serverAdapter) CloseTunnelByID(tunnelID string, userID int64) error {
 	return a.srv.CloseTunnelByID(tunnelID, userID)
 }
 
+func (a *serverAdapter) GetClientsByUserID(userID int64) []api.ClientInfo {
+	return convertClientInfos(a.srv.GetClientsByUserID(userID))
+}
+
+func (a *serverAdapter) GetAllClients() []api.ClientInfo {
+	return convertClientInfos(a.srv.GetAllClients())
+}
+
+func (a *serverAdapter) AdminDisconnectClient(clientID string) error {
+	return a.srv.AdminDisconnectClient(clientID)
+}
+
+func convertClientInfos(serverClients []server.ClientInfo) []api.ClientInfo {
+	result := make([]api.ClientInfo, len(serverClients))
+	for i, c := range serverClients {
+		tunnels := make([]api.TunnelInfo, len(c.Tunnels))
+		for j, t := range c.Tunnels {
+			tunnels[j] = api.TunnelInfo{
+				ID:           t.ID,
+				Type:         t.Type,
+				Name:         t.Name,
+				Subdomain:    t.Subdomain,
+				RemotePort:   t.RemotePort,
+				LocalPort:    t.LocalPort,
+				ClientID:     t.ClientID,
+				UserID:       t.UserID,
+				CreatedAt:    t.CreatedAt,
+				Health:       convertTunnelHealth(t.Health),
+				LastActivity: t.LastActivity,
+			}
+		}
+		result[i] = api.ClientInfo{
+			ID:          c.ID,
+			Hostname:    c.Hostname,
+			RemoteAddr:  c.RemoteAddr,
+			UserID:      c.UserID,
+			ConnectedAt: c.ConnectedAt,
+			Tunnels:     tunnels,
+			Sessions: api.SessionPressure{
+				Sessions:      c.Sessions.Sessions,
+				Streams:       c.Sessions.Streams,
+				PendingWrites: c.Sessions.PendingWrites,
+				Writes:        c.Sessions.Writes,
+				StalledWrites: c.Sessions.StalledWrites,
+				WriteWait:     c.Sessions.WriteWait,
+				StallRatio:    c.Sessions.StallRatio(),
+			},
+		}
+	}
+	return result
+}
+
+func (a *serverAdapter) DisconnectClient(clientID string, userID int64) error {
+	return a.srv.DisconnectClient(clientID, userID)
+}
+
+func (a *serverAdapter) PurgeTunnelCache(tunnelID string, userID int64) (int, error) {
+	return a.srv.PurgeTunnelCache(tunnelID, userID)
+}
+
+func (a *serverAdapter) CloseTunnelBySubdomain(subdomain string) bool {
+	return a.srv.CloseTunnelBySubdomain(subdomain)
+}
+
+func (a *serverAdapter) SuspendSubdomain(subdomain string) int {
+	return a.srv.SuspendSubdomain(subdomain)
+}
+
+func (a *serverAdapter) UnsuspendSubdomain(subdomain string) {
+	a.srv.UnsuspendSubdomain(subdomain)
+}
+
 func (a *serverAdapter) GetStats() api.Stats {
 	s := a.srv.GetStats()
 	return api.Stats{
@@ -670,6 +902,10 @@ func (a *serverAdapter) GetStats() api.Stats {
 		HTTPTunnels:   s.HTTPTunnels,
 		TCPTunnels:    s.TCPTunnels,
 		UDPTunnels:    s.UDPTunnels,
+		UDPFlows:      s.UDPFlows,
+
+		AbnormalTunnelUsers: s.AbnormalTunnelUsers,
+		TunnelCountWarnings: s.TunnelCountWarnings,
 	}
 }
 
@@ -678,15 +914,17 @@ func (a *serverAdapter) GetAllTunnels() []api.TunnelInfo {
 	result := make([]api.TunnelInfo, len(serverTunnels))
 	for i, t := range serverTunnels {
 		result[i] = api.TunnelInfo{
-			ID:         t.ID,
-			Type:       t.Type,
-			Name:       t.Name,
-			Subdomain:  t.Subdomain,
-			RemotePort: t.RemotePort,
-			LocalPort:  t.LocalPort,
-			ClientID:   t.ClientID,
-			UserID:     t.UserID,
-			CreatedAt:  t.CreatedAt,
+			ID:           t.ID,
+			Type:         t.Type,
+			Name:         t.Name,
+			Subdomain:    t.Subdomain,
+			RemotePort:   t.RemotePort,
+			LocalPort:    t.LocalPort,
+			ClientID:     t.ClientID,
+			UserID:       t.UserID,
+			CreatedAt:    t.CreatedAt,
+			Health:       convertTunnelHealth(t.Health),
+			LastActivity: t.LastActivity,
 		}
 	}
 	return result
@@ -696,6 +934,46 @@ func (a *serverAdapter) AdminCloseTunnel(tunnelID string) error {
 	return a.srv.AdminCloseTunnel(tunnelID)
 }
 
+func (a *serverAdapter) GetTunnelHealth(tunnelID string, userID int64) *api.TunnelHealth {
+	return convertTunnelHealth(a.srv.GetTunnelHealth(tunnelID, userID))
+}
+
+func (a *serverAdapter) GetDrainStatus() api.DrainStatus {
+	s := a.srv.GetDrainStatus()
+	return api.DrainStatus{
+		Draining:          s.Draining,
+		ActiveConnections: s.ActiveConnections,
+		TimeLeft:          s.TimeLeft(),
+	}
+}
+
+func (a *serverAdapter) GetMonthlyUsage(userID int64) (api.MonthlyUsage, error) {
+	in, out, err := a.srv.GetMonthlyUsage(userID)
+	return api.MonthlyUsage{BytesIn: in, BytesOut: out}, err
+}
+
+func convertTunnelHealth(h *server.TunnelHealth) *api.TunnelHealth {
+	if h == nil {
+		return nil
+	}
+	out := &api.TunnelHealth{
+		Check:    h.Check,
+		Interval: h.Interval,
+		Status:   h.Status,
+	}
+	if h.Last != nil {
+		last := api.HealthSample(*h.Last)
+		out.Last = &last
+	}
+	if len(h.History) > 0 {
+		out.History = make([]api.HealthSample, len(h.History))
+		for i, sample := range h.History {
+			out.History[i] = api.HealthSample(sample)
+		}
+	}
+	return out
+}
+
 // customDomainAdapter wraps *server.Server to implement api.CustomDomainManager
 type customDomainAdapter struct {
 	srv *server.Server
@@ -10,6 +10,7 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"os"
 	"runtime"
 	"strings"
 	"sync"
@@ -22,6 +23,7 @@ import (
 
 	"github.com/mephistofox/fxtun.dev/internal/config"
 	"github.com/mephistofox/fxtun.dev/internal/inspect"
+	"github.com/mephistofox/fxtun.dev/internal/logging"
 	"github.com/mephistofox/fxtun.dev/internal/protocol"
 )
 
@@ -53,12 +55,26 @@ const (
 	// trafficStatsInterval is the interval for emitting traffic statistics.
 	trafficStatsInterval = 2 * time.Second
 
+	// defaultDataConnectTimeout bounds the setup of one data connection,
+	// from dial to join, when server.data_connect_timeout is not set. Data
+	// connections only add parallelism, so they give up much sooner than
+	// the primary.
+	defaultDataConnectTimeout = 5 * time.Second
+
 	// dataConnectionCount is the number of additional data connections to open (total = 1 primary + N data).
 	dataConnectionCount = 16
 
 	// maxOverflowGoroutines caps the number of goroutines spawned when the worker pool is full.
 	maxOverflowGoroutines = 1024
 
+	// defaultStreamQueueTimeout bounds how long a stream waits for a free worker
+	// when the overflow behavior is "queue".
+	defaultStreamQueueTimeout = 5 * time.Second
+
+	// defaultStreamCompressionThreshold is the smallest write compressed on
+	// streams that use per-stream compression.
+	defaultStreamCompressionThreshold = 16 * 1024
+
 	// defaultReconnectInterval is the default base interval for reconnection attempts.
 	defaultReconnectInterval = 5 * time.Second
 
@@ -76,6 +92,11 @@ type Client struct {
 	log    zerolog.Logger
 	events *EventEmitter
 
+	// connLog writes the per-connection lines and reqSampler thins out the
+	// per-request lines, as set in the logging settings.
+	connLog    zerolog.Logger
+	reqSampler zerolog.Sampler
+
 	conn          net.Conn
 	session       *yamux.Session
 	controlStream net.Conn
@@ -100,10 +121,19 @@ type Client struct {
 	sessionID     string
 	sessionSecret string
 
+	// Session resumption (see resume.go)
+	resumeWindow  time.Duration      // advertised by the server; 0 = not supported
+	resumeToken   string             // authorizes the next resume; rotated by the server
+	primaryCancel context.CancelFunc // stops goroutines bound to the primary connection
+
+	encoding    protocol.Encoding // control encoding picked by the server at auth
+	tunnelBatch bool              // server accepts tunnel batch requests
+
 	tunnels   map[string]*ActiveTunnel
 	tunnelsMu sync.RWMutex
 
-	pendingRequests map[string]chan *protocol.TunnelCreatedMessage
+	pendingRequests map[string]chan *protocol.TunnelBatchResult
+	pendingBatches  map[string]chan *protocol.TunnelBatchResultMessage
 	pendingMu       sync.Mutex
 
 	ctx    context.Context
@@ -120,15 +150,27 @@ type Client struct {
 
 	reconnecting   bool
 	reconnectMu    sync.Mutex
+	reconnectTry   int        // current reconnect attempt, reported during auth
 	mu             sync.Mutex // for writing to control stream
 	tokenRefresher TokenRefresher
 	tokenMu        sync.RWMutex
 
+	// connGate checks visitor connections of tunnels that confirm them
+	// (see conn_gate.go)
+	connGate ConnectionGate
+	gateMu   sync.RWMutex
+
 	lastPong atomic.Int64 // unix nano timestamp of last pong received
 
 	inspector  *Inspector
 	inspectMgr *inspect.Manager
 
+	// Prometheus metrics: reconnect count and the standalone listener used
+	// when metrics.addr is set
+	reconnects    atomic.Int64
+	metricsServer *http.Server
+	metricsAddr   string
+
 	// Edge node info (set after redirect)
 	nodeName      string
 	nodeRegion    string
@@ -161,11 +203,35 @@ type ActiveTunnel struct {
 	BytesSent     atomic.Int64
 	BytesReceived atomic.Int64
 
+	// ActiveConns counts connections currently proxied to the local service,
+	// DialFailures the attempts to reach it that failed and
+	// ConsecutiveDialFailures those since the last successful one.
+	ActiveConns             atomic.Int64
+	DialFailures            atomic.Int64
+	ConsecutiveDialFailures atomic.Int64
+	localUnreachable        atomic.Bool
+
+	// Requests counts HTTP requests proxied to the local service.
+	Requests atomic.Int64
+
+	// InspectURL links to the local inspector filtered to this tunnel; only
+	// set for HTTP tunnels while the inspector is running.
+	InspectURL string
+
 	// Security status (echoed from server on tunnel creation)
 	BasicAuthEnabled bool
 	AllowIPsCount    int
 	AutoClose        string
 	MaxLifetime      string
+
+	// primer holds local connections pre-warmed per Config.Prewarm.
+	primer *localPrimer
+
+	// ssh reaches the local service through Config.LocalSSH (nil without).
+	ssh *sshDialer
+
+	// socks is the local SOCKS5 proxy of a socks tunnel (see socks.go).
+	socks net.Listener
 }
 
 // countingWriter wraps an io.Writer and counts bytes written.
@@ -183,13 +249,17 @@ func (c *countingWriter) Write(p []byte) (int, error) {
 // New creates a new client
 func New(cfg *config.ClientConfig, log zerolog.Logger) *Client {
 	ctx, cancel := context.WithCancel(context.Background())
+	log = log.With().Str("component", "client").Logger()
 
 	return &Client{
 		cfg:               cfg,
-		log:               log.With().Str("component", "client").Logger(),
+		log:               log,
 		events:            NewEventEmitter(),
+		connLog:           logging.Sampled(log, cfg.Logging),
+		reqSampler:        logging.NewSampler(cfg.Logging),
 		tunnels:           make(map[string]*ActiveTunnel),
-		pendingRequests:   make(map[string]chan *protocol.TunnelCreatedMessage),
+		pendingRequests:   make(map[string]chan *protocol.TunnelBatchResult),
+		pendingBatches:    make(map[string]chan *protocol.TunnelBatchResultMessage),
 		autoCloseTimers:   make(map[string]*autoCloseTimer),
 		maxLifetimeTimers: make(map[string]*maxLifetimeTimer),
 		ctx:               ctx,
@@ -234,13 +304,6 @@ type endpoint struct {
 // DPI-resilient tunnel.*:443 TLS endpoint and the fallback the legacy
 // host:4443 plaintext endpoint. Identical/empty addresses are skipped.
 func (c *Client) endpoints() []endpoint {
-	hostOf := func(addr string) string {
-		if h, _, err := net.SplitHostPort(addr); err == nil {
-			return h
-		}
-		return addr
-	}
-
 	eps := []endpoint{{
 		addr:       c.cfg.Server.Address,
 		useTLS:     !c.cfg.Server.Insecure,
@@ -258,10 +321,20 @@ func (c *Client) endpoints() []endpoint {
 	return eps
 }
 
+// hostOf strips the port from a server address for TLS server names.
+func hostOf(addr string) string {
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		return h
+	}
+	return addr
+}
+
 // dialEndpoint establishes a TCP connection to a single endpoint, wrapping it
-// in TLS when the endpoint requires it.
-func (c *Client) dialEndpoint(ep endpoint) (net.Conn, error) {
-	conn, err := net.DialTimeout("tcp", ep.addr, dialTimeout)
+// in TLS when the endpoint requires it. ctx bounds the dial and the TLS
+// handshake, on top of dialTimeout.
+func (c *Client) dialEndpoint(ctx context.Context, ep endpoint) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: dialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", ep.addr)
 	if err != nil {
 		return nil, err
 	}
@@ -280,7 +353,7 @@ func (c *Client) dialEndpoint(ep endpoint) (net.Conn, error) {
 		ServerName:         ep.serverName,
 		InsecureSkipVerify: !ep.tlsVerify,
 	}, utls.HelloChrome_Auto)
-	if err := uconn.HandshakeContext(c.ctx); err != nil {
+	if err := uconn.HandshakeContext(ctx); err != nil {
 		conn.Close()
 		return nil, fmt.Errorf("TLS handshake: %w", err)
 	}
@@ -289,31 +362,56 @@ func (c *Client) dialEndpoint(ep endpoint) (net.Conn, error) {
 
 // dialAndNegotiate dials a specific endpoint and performs compression
 // negotiation, returning the (possibly wrapped) stream.
-func (c *Client) dialAndNegotiate(ep endpoint) (net.Conn, io.ReadWriteCloser, bool, error) {
-	conn, err := c.dialEndpoint(ep)
+func (c *Client) dialAndNegotiate(ctx context.Context, ep endpoint) (net.Conn, io.ReadWriteCloser, protocol.Compression, error) {
+	conn, err := c.dialEndpoint(ctx, ep)
 	if err != nil {
-		return nil, nil, false, err
+		return nil, nil, protocol.CompressionNone, err
+	}
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	rwc, compression, err := protocol.NegotiateCompression(conn, c.cfg.Server.CompressionOffer(), false)
+	if !stop() && err == nil {
+		err = ctx.Err()
 	}
-	rwc, compressed, err := protocol.NegotiateCompression(conn, c.cfg.Server.Compression, false)
 	if err != nil {
 		conn.Close()
-		return nil, nil, false, fmt.Errorf("compression negotiation: %w", err)
+		return nil, nil, protocol.CompressionNone, fmt.Errorf("compression negotiation: %w", err)
 	}
-	return conn, rwc, compressed, nil
+	return conn, rwc, compression, nil
 }
 
 // connectTransport tries each endpoint in order and returns the first that
-// completes both the dial/TLS handshake and the compression negotiation. The
+// completes both the dial/TLS handshake and the compression negotiation. With
+// server.addresses set, the regions are probed first and the fastest one
+// wins; the fallback is only tried when none answers. The
 // fallback covers both dial/TLS failures and a stalled compression handshake —
 // the latter being the signature of DPI/middlebox interference on the
 // non-standard plaintext port.
-func (c *Client) connectTransport() (net.Conn, io.ReadWriteCloser, bool, endpoint, error) {
+func (c *Client) connectTransport() (net.Conn, io.ReadWriteCloser, protocol.Compression, endpoint, error) {
 	eps := c.endpoints()
 	var lastErr error
+	if regions := c.regionEndpoints(); len(regions) > 1 {
+		conn, rwc, compression, ep, err := c.connectFastest(regions)
+		if err == nil {
+			return conn, rwc, compression, ep, nil
+		}
+		var rejected *protocol.RejectedError
+		if errors.As(err, &rejected) {
+			return nil, nil, protocol.CompressionNone, endpoint{}, err
+		}
+		// The primary was probed along with the other regions; only the
+		// fallback is left
+		lastErr = err
+		eps = eps[1:]
+	}
 	for i, ep := range eps {
-		conn, rwc, compressed, err := c.dialAndNegotiate(ep)
+		conn, rwc, compression, err := c.dialAndNegotiate(c.ctx, ep)
 		if err != nil {
 			lastErr = fmt.Errorf("%s: %w", ep.addr, err)
+			var rejected *protocol.RejectedError
+			if errors.As(err, &rejected) {
+				// The server itself refused; the other endpoint leads to it too
+				return nil, nil, protocol.CompressionNone, endpoint{}, lastErr
+			}
 			c.log.Warn().
 				Err(err).
 				Str("endpoint", ep.addr).
@@ -323,9 +421,9 @@ func (c *Client) connectTransport() (net.Conn, io.ReadWriteCloser, bool, endpoin
 				Msg("Endpoint failed, trying next")
 			continue
 		}
-		return conn, rwc, compressed, ep, nil
+		return conn, rwc, compression, ep, nil
 	}
-	return nil, nil, false, endpoint{}, fmt.Errorf("all endpoints failed (the network may be blocking or throttling the tunnel port): %w", lastErr)
+	return nil, nil, protocol.CompressionNone, endpoint{}, fmt.Errorf("all endpoints failed (the network may be blocking or throttling the tunnel port): %w", lastErr)
 }
 
 // Connect connects to the server
@@ -335,14 +433,14 @@ func (c *Client) Connect() error {
 
 	// Dial server: try the primary endpoint, fall back to the secondary on
 	// dial/TLS failure or a stalled compression handshake (DPI signature).
-	conn, rwc, compressed, ep, err := c.connectTransport()
+	conn, rwc, compression, ep, err := c.connectTransport()
 	if err != nil {
 		c.events.EmitError(err)
 		return fmt.Errorf("connect: %w", err)
 	}
 	c.conn = conn
 	c.activeEndpoint = ep
-	c.log.Info().Str("endpoint", ep.addr).Bool("tls", ep.useTLS).Bool("compressed", compressed).Msg("Transport established")
+	c.log.Info().Str("endpoint", ep.addr).Bool("tls", ep.useTLS).Str("compression", compression.String()).Msg("Transport established")
 
 	// Create yamux session FIRST (client mode) with optimized config
 	yamuxCfg := yamux.DefaultConfig()
@@ -393,43 +491,44 @@ func (c *Client) Connect() error {
 	})
 
 	// Start stream worker pool
-	numWorkers := runtime.NumCPU() * 4
+	numWorkers := c.cfg.Streams.Workers
+	if numWorkers <= 0 {
+		numWorkers = runtime.NumCPU() * 4
+	}
 	c.streamWorkers = make(chan net.Conn, numWorkers)
 	for i := 0; i < numWorkers; i++ {
 		c.wg.Add(1)
 		go c.streamWorker()
 	}
 
-	// Start message handler
-	c.wg.Add(1)
-	go c.handleMessages()
-
-	// Start stream acceptor
-	c.wg.Add(1)
-	go c.acceptStreams()
-
-	// Start keepalive
-	c.wg.Add(1)
-	go c.keepalive()
+	// Start message handler, stream acceptor and keepalive
+	c.startPrimary()
 
 	// Open additional data connections for parallelism
 	if c.sessionSecret != "" {
 		c.openDataConnections()
 	}
 
-	// Request tunnels from config
-	for _, tunnelCfg := range c.cfg.Tunnels {
-		if err := c.RequestTunnel(tunnelCfg); err != nil {
-			c.log.Error().Err(err).Str("name", tunnelCfg.Name).Msg("Failed to request tunnel")
-		}
-	}
-
+	// The inspector starts first so new HTTP tunnels get a link to it
 	if c.inspector != nil {
 		c.inspector.SetTunnels(c.tunnels, &c.tunnelsMu)
 		if err := c.inspector.Start(c.ctx); err != nil {
 			c.log.Warn().Err(err).Msg("Failed to start inspector")
 		}
 	}
+	if err := c.startMetricsServer(); err != nil {
+		c.log.Warn().Err(err).Msg("Failed to start metrics endpoint")
+	}
+	if c.cfg.Metrics.Enabled && c.cfg.Metrics.Addr == "" && c.inspector == nil {
+		c.log.Warn().Msg("Metrics are served by the inspector, which is not running; set metrics.addr for a standalone endpoint")
+	}
+
+	// Request tunnels from config
+	for i, err := range c.RequestTunnels(c.cfg.Tunnels) {
+		if err != nil {
+			c.log.Error().Err(err).Str("name", c.cfg.Tunnels[i].Name).Msg("Failed to request tunnel")
+		}
+	}
 
 	return nil
 }
@@ -438,6 +537,7 @@ func (c *Client) authenticate() error {
 	c.tokenMu.RLock()
 	token := c.cfg.Server.Token
 	c.tokenMu.RUnlock()
+	hostname, _ := os.Hostname()
 
 	authMsg := &protocol.AuthMessage{
 		Message:   protocol.NewMessage(protocol.MsgAuth),
@@ -445,6 +545,12 @@ func (c *Client) authenticate() error {
 		ClientID:  generateID(),
 		UserAgent: "fxtunnel-client/1.0",
 		Version:   c.version,
+		Hostname:  hostname,
+
+		StreamCompression: c.cfg.Streams.CompressionThreshold >= 0,
+		ReconnectAttempt:  c.reconnectTry,
+		Resumable:         true,
+		Encodings:         []protocol.Encoding{protocol.EncodingMsgpack},
 	}
 
 	if err := c.controlCodec.Encode(authMsg); err != nil {
@@ -526,6 +632,13 @@ func (c *Client) authenticate() error {
 	c.clientID = result.ClientID
 	c.sessionID = result.SessionID
 	c.sessionSecret = result.SessionSecret
+	c.resumeWindow = time.Duration(result.ResumeWindow) * time.Second
+	c.resumeToken = result.ResumeToken
+
+	// Servers that predate binary control leave Encoding empty: stay on JSON
+	c.encoding = result.Encoding
+	c.controlCodec.SetEncoding(c.encoding)
+	c.tunnelBatch = result.TunnelBatch
 
 	// Apply server-enforced data session limit
 	if result.MaxDataSessions > 0 {
@@ -563,29 +676,29 @@ func (c *Client) applyCapabilities(caps *protocol.ClientCapabilities) {
 	}
 
 	c.inspectMgr = inspect.NewManager(maxEntries, maxBodySize)
+	c.inspectMgr.SetRedactParams(c.cfg.Inspect.RedactParams)
 	c.inspector = NewInspector(c.inspectMgr, c.cfg.Inspect.Addr, maxBodySize, c.log)
+	c.inspector.SetMaxConcurrentQueries(c.cfg.Inspect.MaxConcurrentQueries)
+	c.inspector.SetRemoteReplayTimeout(c.cfg.Inspect.RemoteReplayTimeout)
+	c.inspector.SetReplayMaxBodySize(c.cfg.Inspect.ReplayMaxBodySize)
+	c.inspector.SetEvents(c.events)
+	if c.cfg.Metrics.Enabled && c.cfg.Metrics.Addr == "" {
+		c.inspector.HandleMetrics(c.metricsHandler())
+	}
 }
 
-// RequestTunnel requests a new tunnel
+// RequestTunnel requests a new tunnel. A taken subdomain is retried with
+// numeric suffixes when the tunnel config allows it.
 func (c *Client) RequestTunnel(tunnelCfg config.TunnelConfig) error {
-	requestID := generateID()
+	return c.subdomainFallback(tunnelCfg, c.requestTunnel(tunnelCfg))
+}
 
-	req := &protocol.TunnelRequestMessage{
-		Message:       protocol.NewMessage(protocol.MsgTunnelRequest),
-		TunnelType:    protocol.TunnelType(tunnelCfg.Type),
-		Name:          tunnelCfg.Name,
-		LocalPort:     tunnelCfg.LocalPort,
-		RemotePort:    tunnelCfg.RemotePort,
-		Subdomain:     tunnelCfg.Subdomain,
-		BasicAuthHash: tunnelCfg.BasicAuthHash,
-		AllowIPs:      tunnelCfg.AllowIPs,
-		AutoClose:     tunnelCfg.AutoClose,
-		MaxLifetime:   tunnelCfg.MaxLifetime,
-	}
-	req.RequestID = requestID
+func (c *Client) requestTunnel(tunnelCfg config.TunnelConfig) error {
+	requestID := generateID()
+	req := newTunnelRequest(tunnelCfg, requestID)
 
 	// Create response channel
-	respChan := make(chan *protocol.TunnelCreatedMessage, 1)
+	respChan := make(chan *protocol.TunnelBatchResult, 1)
 	c.pendingMu.Lock()
 	c.pendingRequests[requestID] = respChan
 	c.pendingMu.Unlock()
@@ -603,102 +716,200 @@ func (c *Client) RequestTunnel(tunnelCfg config.TunnelConfig) error {
 	// Wait for response
 	select {
 	case resp := <-respChan:
-		tunnel := &ActiveTunnel{
-			ID:               resp.TunnelID,
-			Config:           tunnelCfg,
-			URL:              resp.URL,
-			HTTPSURL:         resp.HTTPSURL,
-			RemoteAddr:       resp.RemoteAddr,
-			Connected:        time.Now(),
-			BasicAuthEnabled: resp.BasicAuthEnabled,
-			AllowIPsCount:    resp.AllowIPsCount,
-			AutoClose:        resp.AutoClose,
-			MaxLifetime:      resp.MaxLifetime,
+		if resp.Error != nil {
+			return &TunnelRejectedError{Code: resp.Error.Code, Message: resp.Error.Error}
 		}
+		c.activateTunnel(tunnelCfg, resp.Created)
+		return nil
 
-		c.tunnelsMu.Lock()
-		c.tunnels[resp.TunnelID] = tunnel
-		c.tunnelsMu.Unlock()
+	case <-time.After(tunnelResponseTimeout):
+		return fmt.Errorf("timeout waiting for tunnel response")
 
-		// Save assigned subdomain/port back to config for reconnect persistence
-		if resp.Subdomain != "" && tunnelCfg.Subdomain == "" {
-			for i := range c.cfg.Tunnels {
-				if c.cfg.Tunnels[i].Name == tunnelCfg.Name && c.cfg.Tunnels[i].Type == tunnelCfg.Type && c.cfg.Tunnels[i].LocalPort == tunnelCfg.LocalPort {
-					c.cfg.Tunnels[i].Subdomain = resp.Subdomain
-					break
-				}
-			}
-		}
-		if resp.RemotePort > 0 && tunnelCfg.RemotePort == 0 {
-			for i := range c.cfg.Tunnels {
-				if c.cfg.Tunnels[i].Name == tunnelCfg.Name && c.cfg.Tunnels[i].Type == tunnelCfg.Type && c.cfg.Tunnels[i].LocalPort == tunnelCfg.LocalPort {
-					c.cfg.Tunnels[i].RemotePort = resp.RemotePort
-					break
-				}
-			}
+	case <-c.ctx.Done():
+		return fmt.Errorf("client closed")
+	}
+}
+
+// subdomainFallback retries a tunnel whose subdomain was taken as
+// <subdomain>-2, <subdomain>-3, ... for up to SubdomainFallback attempts.
+// Any other outcome of the first request is returned unchanged.
+func (c *Client) subdomainFallback(tunnelCfg config.TunnelConfig, err error) error {
+	if tunnelCfg.Subdomain == "" || tunnelCfg.SubdomainFallback <= 0 || !isSubdomainTaken(err) {
+		return err
+	}
+	base := tunnelCfg.Subdomain
+	for n := 2; n <= tunnelCfg.SubdomainFallback+1 && isSubdomainTaken(err); n++ {
+		tunnelCfg.Subdomain = fmt.Sprintf("%s-%d", base, n)
+		c.log.Info().Str("requested", base).Str("subdomain", tunnelCfg.Subdomain).Msg("Subdomain taken, trying fallback")
+		err = c.requestTunnel(tunnelCfg)
+	}
+	return err
+}
+
+func isSubdomainTaken(err error) bool {
+	var rejected *TunnelRejectedError
+	return errors.As(err, &rejected) && rejected.Code == protocol.ErrCodeSubdomainTaken
+}
+
+func newTunnelRequest(tunnelCfg config.TunnelConfig, requestID string) *protocol.TunnelRequestMessage {
+	req := &protocol.TunnelRequestMessage{
+		Message:       protocol.NewMessage(protocol.MsgTunnelRequest),
+		TunnelType:    protocol.TunnelType(tunnelCfg.Type),
+		Name:          tunnelCfg.Name,
+		LocalPort:     tunnelCfg.LocalPort,
+		RemotePort:    tunnelCfg.RemotePort,
+		Subdomain:     tunnelCfg.Subdomain,
+		BasicAuthHash: tunnelCfg.BasicAuthHash,
+		AllowIPs:      tunnelCfg.AllowIPs,
+		AutoClose:     tunnelCfg.AutoClose,
+		MaxLifetime:   tunnelCfg.MaxLifetime,
+
+		HealthCheck:         tunnelCfg.HealthCheck,
+		HealthCheckInterval: tunnelCfg.HealthCheckInterval,
+		Capture:             tunnelCfg.Capture,
+		HeaderRules:         tunnelCfg.HeaderRules.Protocol(),
+		StripPathPrefix:     tunnelCfg.StripPathPrefix,
+		AddPathPrefix:       tunnelCfg.AddPathPrefix,
+		Cache:               tunnelCfg.CacheEnabled,
+		CacheMaxSize:        tunnelCfg.CacheMaxSize,
+		SinkBytes:           tunnelCfg.SinkBytes,
+		ProxyProtocol:       tunnelCfg.ProxyProtocol,
+		MaxRequestBytes:     tunnelCfg.MaxRequestBytes,
+		ConfirmConnections:  tunnelCfg.ConfirmConnections,
+		NoCompression:       tunnelCfg.NoCompression,
+		RestoreToken:        tunnelCfg.RestoreToken,
+	}
+	req.RequestID = requestID
+	return req
+}
+
+// activateTunnel records a tunnel the server created and starts its timers.
+func (c *Client) activateTunnel(tunnelCfg config.TunnelConfig, resp *protocol.TunnelCreatedMessage) {
+	if tunnelCfg.LocalAddr == "" {
+		tunnelCfg.LocalAddr = c.cfg.LocalAddr
+	}
+	tunnel := &ActiveTunnel{
+		ID:               resp.TunnelID,
+		Config:           tunnelCfg,
+		URL:              resp.URL,
+		HTTPSURL:         resp.HTTPSURL,
+		RemoteAddr:       resp.RemoteAddr,
+		Connected:        time.Now(),
+		BasicAuthEnabled: resp.BasicAuthEnabled,
+		AllowIPsCount:    resp.AllowIPsCount,
+		AutoClose:        resp.AutoClose,
+		MaxLifetime:      resp.MaxLifetime,
+	}
+	if resp.URL != "" && c.inspector != nil {
+		tunnel.InspectURL = c.inspector.TunnelURL(resp.TunnelID)
+	}
+	if c.inspectMgr != nil {
+		if mode, err := inspect.ParseCaptureMode(tunnelCfg.Capture); err == nil {
+			c.inspectMgr.SetCaptureMode(resp.TunnelID, mode)
 		}
+	}
 
-		// Pre-probe local address synchronously so first connection is instant
+	// Pre-probe local address synchronously so first connection is instant.
+	// Sink tunnels are served by the server and have no local address;
+	// socks tunnels listen on theirs.
+	switch {
+	case tunnelCfg.Type == string(protocol.TunnelSOCKS):
+		if err := c.startSOCKS(tunnel); err != nil {
+			c.log.Error().Err(err).Int("port", tunnelCfg.LocalPort).Msg("Failed to start the local SOCKS5 proxy")
+		}
+	case tunnelCfg.LocalSSH != nil:
+		tunnel.ssh = newSSHDialer(*tunnelCfg.LocalSSH, c.log)
+	case tunnelCfg.Type != string(protocol.TunnelSink):
 		ProbeLocalAddress(c.log, tunnelCfg.LocalAddr, tunnelCfg.LocalPort)
+	}
+	if tunnelCfg.Prewarm > 0 {
+		tunnel.primer = newLocalPrimer(tunnelCfg.Prewarm, primerTTL, func() (net.Conn, error) {
+			return c.dialLocalService(tunnel)
+		})
+	}
 
-		// Start auto-close timer (idle timeout)
-		if tunnelCfg.AutoClose != "" {
-			d, _ := parseDuration(tunnelCfg.AutoClose) // already validated by CLI
-			tunnelID := resp.TunnelID
-			c.timersMu.Lock()
-			c.autoCloseTimers[tunnelID] = newAutoCloseTimer(d, func() {
-				c.log.Info().
-					Str("tunnel_id", tunnelID).
-					Str("reason", "idle for "+tunnelCfg.AutoClose).
-					Msg("tunnel auto-closed")
-				c.closeTunnel(tunnelID)
-			})
-			c.timersMu.Unlock()
-		}
-
-		// Start max-lifetime timer.
-		// Note: max-lifetime timer resets on reconnect. This means a tunnel with
-		// --max-lifetime 8h that reconnects after 7h gets another full 8h.
-		// This is acceptable for MVP — the timer measures "time since last connect".
-		if tunnelCfg.MaxLifetime != "" {
-			d, _ := parseDuration(tunnelCfg.MaxLifetime) // already validated by CLI
-			tunnelID := resp.TunnelID
-			c.timersMu.Lock()
-			c.maxLifetimeTimers[tunnelID] = newMaxLifetimeTimer(d, func() {
-				c.log.Info().
-					Str("tunnel_id", tunnelID).
-					Str("reason", "max lifetime "+tunnelCfg.MaxLifetime+" reached").
-					Msg("tunnel auto-closed")
-				c.closeTunnel(tunnelID)
-			})
-			c.timersMu.Unlock()
-		}
+	c.tunnelsMu.Lock()
+	if old, ok := c.tunnels[resp.TunnelID]; ok {
+		old.closeLocal()
+	}
+	c.tunnels[resp.TunnelID] = tunnel
+	c.tunnelsMu.Unlock()
 
-		// Emit tunnel created event
-		c.events.EmitTunnelCreated(tunnel)
+	if resp.AddressChanged {
+		c.log.Warn().
+			Str("name", tunnelCfg.Name).
+			Str("subdomain", resp.Subdomain).
+			Int("remote_port", resp.RemotePort).
+			Msg("Previous tunnel address was taken, tunnel restored on a new one")
+	}
 
-		// Start periodic traffic stats emitter
-		go c.emitTrafficStats(tunnel)
+	// Save assigned subdomain/port and the restore token back to config for
+	// reconnect persistence
+	for i := range c.cfg.Tunnels {
+		saved := &c.cfg.Tunnels[i]
+		if saved.Name != tunnelCfg.Name || saved.Type != tunnelCfg.Type || saved.LocalPort != tunnelCfg.LocalPort {
+			continue
+		}
+		if resp.Subdomain != "" && (tunnelCfg.Subdomain == "" || resp.AddressChanged) {
+			saved.Subdomain = resp.Subdomain
+		}
+		if resp.RemotePort > 0 && (tunnelCfg.RemotePort == 0 || resp.AddressChanged) {
+			saved.RemotePort = resp.RemotePort
+		}
+		saved.RestoreToken = resp.RestoreToken
+		break
+	}
 
-		if resp.URL != "" {
+	// Start auto-close timer (idle timeout)
+	if tunnelCfg.AutoClose != "" {
+		d, _ := parseDuration(tunnelCfg.AutoClose) // already validated by CLI
+		tunnelID := resp.TunnelID
+		c.timersMu.Lock()
+		c.autoCloseTimers[tunnelID] = newAutoCloseTimer(d, func() {
 			c.log.Info().
-				Str("name", tunnelCfg.Name).
-				Str("url", resp.URL).
-				Msg("HTTP tunnel created")
-		} else {
+				Str("tunnel_id", tunnelID).
+				Str("reason", "idle for "+tunnelCfg.AutoClose).
+				Msg("tunnel auto-closed")
+			c.closeTunnel(tunnelID)
+		})
+		c.timersMu.Unlock()
+	}
+
+	// Start max-lifetime timer.
+	// Note: max-lifetime timer resets on reconnect. This means a tunnel with
+	// --max-lifetime 8h that reconnects after 7h gets another full 8h.
+	// This is acceptable for MVP — the timer measures "time since last connect".
+	if tunnelCfg.MaxLifetime != "" {
+		d, _ := parseDuration(tunnelCfg.MaxLifetime) // already validated by CLI
+		tunnelID := resp.TunnelID
+		c.timersMu.Lock()
+		c.maxLifetimeTimers[tunnelID] = newMaxLifetimeTimer(d, func() {
 			c.log.Info().
-				Str("name", tunnelCfg.Name).
-				Str("addr", resp.RemoteAddr).
-				Msg("Tunnel created")
-		}
+				Str("tunnel_id", tunnelID).
+				Str("reason", "max lifetime "+tunnelCfg.MaxLifetime+" reached").
+				Msg("tunnel auto-closed")
+			c.closeTunnel(tunnelID)
+		})
+		c.timersMu.Unlock()
+	}
 
-		return nil
+	// Emit tunnel created event
+	c.events.EmitTunnelCreated(tunnel)
 
-	case <-time.After(tunnelResponseTimeout):
-		return fmt.Errorf("timeout waiting for tunnel response")
+	// Start periodic traffic stats emitter
+	go c.emitTrafficStats(tunnel)
 
-	case <-c.ctx.Done():
-		return fmt.Errorf("client closed")
+	if resp.URL != "" {
+		c.log.Info().
+			Str("name", tunnelCfg.Name).
+			Str("url", resp.URL).
+			Str("inspect_url", tunnel.InspectURL).
+			Msg("HTTP tunnel created")
+	} else {
+		c.log.Info().
+			Str("name", tunnelCfg.Name).
+			Str("addr", resp.RemoteAddr).
+			Msg("Tunnel created")
 	}
 }
 
@@ -708,18 +919,34 @@ func (c *Client) sendControl(msg any) error {
 	return c.controlCodec.Encode(msg)
 }
 
-func (c *Client) handleMessages() {
+// startPrimary starts the goroutines serving the primary connection. They
+// are bound to their own context so a resumed session can replace them
+// without touching data sessions or in-flight streams.
+func (c *Client) startPrimary() {
+	ctx, cancel := context.WithCancel(c.ctx)
+	c.primaryCancel = cancel
+
+	c.wg.Add(3)
+	go c.handleMessages(ctx, c.controlCodec)
+	go c.acceptStreams(ctx, c.session)
+	go c.keepalive(ctx)
+}
+
+func (c *Client) handleMessages(ctx context.Context, codec *protocol.Codec) {
 	defer c.wg.Done()
 
 	for {
 		select {
-		case <-c.ctx.Done():
+		case <-ctx.Done():
 			return
 		default:
 		}
 
-		data, baseMsg, err := c.controlCodec.DecodeRaw()
+		data, baseMsg, err := codec.DecodeRaw()
 		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
 			c.log.Debug().Err(err).Msg("Read error")
 			c.handleDisconnect()
 			return
@@ -730,8 +957,12 @@ func (c *Client) handleMessages() {
 			c.handleTunnelCreated(data)
 		case protocol.MsgTunnelError:
 			c.handleTunnelError(data)
+		case protocol.MsgTunnelBatchResult:
+			c.handleTunnelBatchResult(data)
 		case protocol.MsgTunnelClosed:
 			c.handleTunnelClosed(data)
+		case protocol.MsgNewConnection:
+			c.handleNewConnection(data)
 		case protocol.MsgPing:
 			c.handlePing()
 		case protocol.MsgPong:
@@ -741,13 +972,31 @@ func (c *Client) handleMessages() {
 		case protocol.MsgError:
 			c.handleError(data)
 		default:
-			c.log.Warn().Str("type", string(baseMsg.Type)).Msg("Unknown message type")
+			if !c.handleUnknownMessage(baseMsg.Type) {
+				c.handleDisconnect()
+				return
+			}
 		}
 	}
 }
 
+// handleUnknownMessage applies server.unknown_messages to a control message
+// of an unknown type. It returns false when the connection must be dropped.
+func (c *Client) handleUnknownMessage(msgType protocol.MessageType) bool {
+	switch c.cfg.Server.UnknownMessages {
+	case config.UnknownMessagesIgnore:
+		c.log.Debug().Str("type", string(msgType)).Msg("Ignoring unknown message type")
+	case config.UnknownMessagesDisconnect:
+		c.log.Error().Str("type", string(msgType)).Msg("Unknown message type, disconnecting")
+		return false
+	default:
+		c.log.Warn().Str("type", string(msgType)).Msg("Unknown message type")
+	}
+	return true
+}
+
 func (c *Client) handleTunnelCreated(data []byte) {
-	parsed, err := protocol.ParseMessage(data, protocol.MsgTunnelCreated)
+	parsed, err := c.encoding.ParseMessage(data, protocol.MsgTunnelCreated)
 	if err != nil {
 		c.log.Error().Err(err).Msg("Failed to parse tunnel created")
 		return
@@ -756,19 +1005,31 @@ func (c *Client) handleTunnelCreated(data []byte) {
 
 	c.pendingMu.Lock()
 	if ch, ok := c.pendingRequests[msg.RequestID]; ok {
-		ch <- msg
+		ch <- &protocol.TunnelBatchResult{Created: msg}
 	}
 	c.pendingMu.Unlock()
 }
 
 func (c *Client) handleTunnelError(data []byte) {
-	parsed, err := protocol.ParseMessage(data, protocol.MsgTunnelError)
+	parsed, err := c.encoding.ParseMessage(data, protocol.MsgTunnelError)
 	if err != nil {
 		c.log.Error().Err(err).Msg("Failed to parse tunnel error")
 		return
 	}
 	msg := parsed.(*protocol.TunnelErrorMessage)
 
+	// A rejected request is reported to RequestTunnel, which decides
+	// whether to log it or retry
+	c.pendingMu.Lock()
+	ch, pending := c.pendingRequests[msg.RequestID]
+	if pending {
+		ch <- &protocol.TunnelBatchResult{Error: msg}
+	}
+	c.pendingMu.Unlock()
+	if pending {
+		return
+	}
+
 	c.log.Error().
 		Str("tunnel_id", msg.TunnelID).
 		Str("code", msg.Code).
@@ -777,34 +1038,42 @@ func (c *Client) handleTunnelError(data []byte) {
 }
 
 func (c *Client) handleTunnelClosed(data []byte) {
-	parsed, err := protocol.ParseMessage(data, protocol.MsgTunnelClosed)
+	parsed, err := c.encoding.ParseMessage(data, protocol.MsgTunnelClosed)
 	if err != nil {
 		c.log.Error().Err(err).Msg("Failed to parse tunnel closed")
 		return
 	}
 	msg := parsed.(*protocol.TunnelClosedMessage)
+	if msg.Drain == protocol.DrainTimedOut {
+		c.log.Warn().Str("tunnel_id", msg.TunnelID).Msg("Tunnel closed before all its connections finished")
+	}
+	c.removeTunnel(msg.TunnelID)
+}
 
+// removeTunnel drops a tunnel the server closed from local state.
+func (c *Client) removeTunnel(tunnelID string) {
 	// Capture final traffic stats before removing tunnel
 	var bytesSent, bytesReceived int64
 	c.tunnelsMu.Lock()
-	if tunnel, ok := c.tunnels[msg.TunnelID]; ok {
+	if tunnel, ok := c.tunnels[tunnelID]; ok {
 		bytesSent = tunnel.BytesSent.Load()
 		bytesReceived = tunnel.BytesReceived.Load()
+		tunnel.closeLocal()
 	}
-	delete(c.tunnels, msg.TunnelID)
+	delete(c.tunnels, tunnelID)
 	c.tunnelsMu.Unlock()
 
 	// Stop timers for this tunnel
-	c.stopTunnelTimers(msg.TunnelID)
+	c.stopTunnelTimers(tunnelID)
 
 	// Emit tunnel closed event with final traffic stats
 	c.events.EmitWithPayload(EventTunnelClosed, map[string]interface{}{
-		"tunnel_id":      msg.TunnelID,
+		"tunnel_id":      tunnelID,
 		"bytes_sent":     bytesSent,
 		"bytes_received": bytesReceived,
 	})
 
-	c.log.Info().Str("tunnel_id", msg.TunnelID).Msg("Tunnel closed")
+	c.log.Info().Str("tunnel_id", tunnelID).Msg("Tunnel closed")
 }
 
 func (c *Client) handlePing() {
@@ -815,7 +1084,7 @@ func (c *Client) handlePing() {
 }
 
 func (c *Client) handleError(data []byte) {
-	parsed, err := protocol.ParseMessage(data, protocol.MsgError)
+	parsed, err := c.encoding.ParseMessage(data, protocol.MsgError)
 	if err != nil {
 		c.log.Error().Err(err).Msg("Failed to parse error")
 		return
@@ -834,7 +1103,7 @@ func (c *Client) handleError(data []byte) {
 }
 
 func (c *Client) handleServerShutdown(data []byte) {
-	parsed, err := protocol.ParseMessage(data, protocol.MsgServerShutdown)
+	parsed, err := c.encoding.ParseMessage(data, protocol.MsgServerShutdown)
 	if err != nil {
 		c.log.Error().Err(err).Msg("Failed to parse server shutdown")
 		return
@@ -842,6 +1111,9 @@ func (c *Client) handleServerShutdown(data []byte) {
 	msg := parsed.(*protocol.ServerShutdownMessage)
 
 	c.log.Warn().Str("reason", msg.Reason).Msg("Server is shutting down")
+
+	// The session dies with the server, so there is nothing to resume
+	c.resumeWindow = 0
 	c.events.EmitWithPayload(EventDisconnected, map[string]interface{}{
 		"reason": "server_shutdown",
 	})
@@ -860,14 +1132,14 @@ func (c *Client) handleServerShutdown(data []byte) {
 	}()
 }
 
-func (c *Client) acceptStreams() {
+func (c *Client) acceptStreams(ctx context.Context, session *yamux.Session) {
 	defer c.wg.Done()
 
 	for {
-		stream, err := c.session.Accept()
+		stream, err := session.Accept()
 		if err != nil {
 			select {
-			case <-c.ctx.Done():
+			case <-ctx.Done():
 				return
 			default:
 				c.log.Debug().Err(err).Msg("Stream accept error")
@@ -876,22 +1148,7 @@ func (c *Client) acceptStreams() {
 			}
 		}
 
-		select {
-		case c.streamWorkers <- stream:
-			// Dispatched to worker pool
-		default:
-			// Pool full — use overflow goroutine with cap
-			if c.overflowCount.Load() >= maxOverflowGoroutines {
-				c.log.Warn().Int32("overflow", c.overflowCount.Load()).Msg("Overflow goroutine limit reached, dropping stream")
-				stream.Close()
-				continue
-			}
-			c.overflowCount.Add(1)
-			go func() {
-				defer c.overflowCount.Add(-1)
-				c.handleStream(stream)
-			}()
-		}
+		c.dispatchStream(stream)
 	}
 }
 
@@ -910,19 +1167,56 @@ func (c *Client) acceptDataStreams(session *yamux.Session) {
 			}
 		}
 
+		c.dispatchStream(stream)
+	}
+}
+
+// dispatchStream hands an accepted stream to the worker pool. When every
+// worker is busy the configured overflow behavior decides whether the stream
+// gets its own goroutine, waits for a worker, or is dropped.
+func (c *Client) dispatchStream(stream net.Conn) {
+	select {
+	case c.streamWorkers <- stream:
+		return // dispatched to worker pool
+	default:
+	}
+
+	switch c.cfg.Streams.Overflow {
+	case config.StreamOverflowDrop:
+		c.log.Debug().Msg("Stream worker pool full, dropping stream")
+		stream.Close()
+
+	case config.StreamOverflowQueue:
+		timeout := c.cfg.Streams.QueueTimeout
+		if timeout <= 0 {
+			timeout = defaultStreamQueueTimeout
+		}
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
 		select {
 		case c.streamWorkers <- stream:
-		default:
-			if c.overflowCount.Load() >= maxOverflowGoroutines {
-				stream.Close()
-				continue
-			}
-			c.overflowCount.Add(1)
-			go func() {
-				defer c.overflowCount.Add(-1)
-				c.handleStream(stream)
-			}()
+		case <-timer.C:
+			c.log.Warn().Dur("timeout", timeout).Msg("No stream worker became free in time, dropping stream")
+			stream.Close()
+		case <-c.ctx.Done():
+			stream.Close()
+		}
+
+	default: // spawn
+		limit := int32(c.cfg.Streams.MaxOverflow)
+		if limit <= 0 {
+			limit = maxOverflowGoroutines
 		}
+		if c.overflowCount.Load() >= limit {
+			c.log.Warn().Int32("overflow", c.overflowCount.Load()).Msg("Overflow goroutine limit reached, dropping stream")
+			stream.Close()
+			return
+		}
+		c.overflowCount.Add(1)
+		go func() {
+			defer c.overflowCount.Add(-1)
+			c.handleStream(stream)
+		}()
 	}
 }
 
@@ -939,6 +1233,29 @@ func (c *Client) streamWorker() {
 	}
 }
 
+// streamCompressionThreshold returns the configured minimum write size that is
+// compressed on streams using per-stream compression.
+func (c *Client) streamCompressionThreshold() int {
+	if t := c.cfg.Streams.CompressionThreshold; t > 0 {
+		return t
+	}
+	return defaultStreamCompressionThreshold
+}
+
+// answerTCPHealthCheck dials the tunnel's local service and reports the
+// outcome to the server as a single status byte.
+func (c *Client) answerTCPHealthCheck(stream net.Conn, tunnel *ActiveTunnel) {
+	status := protocol.HealthCheckUp
+	local, err := c.dialLocalService(tunnel)
+	if err != nil {
+		c.log.Debug().Err(err).Int("port", tunnel.Config.LocalPort).Msg("Health check: local service unreachable")
+		status = protocol.HealthCheckDown
+	} else {
+		local.Close()
+	}
+	_, _ = stream.Write([]byte{status})
+}
+
 func (c *Client) handleStream(stream net.Conn) {
 	defer stream.Close()
 
@@ -950,6 +1267,9 @@ func (c *Client) handleStream(stream net.Conn) {
 		}
 		return
 	}
+	if hdr.Compressed {
+		stream = protocol.NewCompressedStream(stream, c.streamCompressionThreshold())
+	}
 
 	// Find tunnel (may arrive before control channel registers it, so retry briefly)
 	var tunnel *ActiveTunnel
@@ -985,38 +1305,52 @@ func (c *Client) handleStream(stream net.Conn) {
 		return
 	}
 
+	// Server health-check probes: TCP checks only need a connect result;
+	// HTTP checks are proxied raw below, bypassing the inspector and request log.
+	probe := hdr.RemoteAddr == protocol.HealthCheckRemoteAddr
+	if probe && tunnel.Config.Type == "tcp" {
+		c.answerTCPHealthCheck(stream, tunnel)
+		return
+	}
+
 	// Connect to local service with IPv4/IPv6 fallback
-	local, err := dialLocalWithFallback(c.log, tunnel.Config.LocalAddr, tunnel.Config.LocalPort, localDialTimeout)
+	local, err := c.dialLocal(tunnel)
 	if err != nil {
+		c.localDialFailed(tunnel, err)
 		c.log.Error().Err(err).Int("port", tunnel.Config.LocalPort).Msg("Failed to connect to local service")
 		return
 	}
+	c.localDialSucceeded(tunnel)
 	defer local.Close()
+	tunnel.ActiveConns.Add(1)
+	defer tunnel.ActiveConns.Add(-1)
 
-	c.log.Debug().
-		Str("tunnel", tunnel.Config.Name).
-		Str("remote", hdr.RemoteAddr).
+	c.connLog.Debug().
+		Str("tunnel_id", tunnel.ID).
+		Str("name", tunnel.Config.Name).
+		Str("remote_ip", logging.RemoteIP(hdr.RemoteAddr)).
 		Str("local", local.RemoteAddr().String()).
 		Msg("Forwarding connection")
 
-	// For HTTP tunnels, peek at the request line and print it
+	// For HTTP tunnels, peek at the request head to print the request line.
+	// Upgraded (WebSocket) connections are not printed: they are long-lived
+	// and proxied as-is.
 	var streamReader io.Reader = stream
 	var reqStart time.Time
 	var httpMethod, httpPath string
-	if tunnel.Config.Type == "http" {
+	upgrade := false
+	if tunnel.Config.Type == "http" && !probe {
 		br := bufio.NewReaderSize(stream, 4096)
-		if line, err := br.ReadString('\n'); err == nil {
-			parts := strings.Fields(line)
-			if len(parts) >= 2 {
-				httpMethod = parts[0]
-				httpPath = parts[1]
-				reqStart = time.Now()
-			}
-			// Prepend consumed line back
-			streamReader = io.MultiReader(strings.NewReader(line), br)
-		} else {
-			streamReader = br
+		head, method, path, isUpgrade := readRequestHead(br)
+		if isUpgrade {
+			upgrade = true
+		} else if method != "" {
+			httpMethod = method
+			httpPath = path
+			reqStart = time.Now()
 		}
+		// Prepend the consumed head back
+		streamReader = io.MultiReader(strings.NewReader(head), br)
 	}
 
 	// Bidirectional copy with byte counting and large buffers
@@ -1025,7 +1359,10 @@ func (c *Client) handleStream(stream net.Conn) {
 		Bool("inspector_exists", c.inspector != nil).
 		Bool("inspectmgr_exists", c.inspectMgr != nil).
 		Msg("handleStream capture check")
-	if tunnel.Config.Type == "http" && c.inspector != nil {
+	if upgrade {
+		proxyUpgraded(tunnel, stream, streamReader, local)
+	} else if tunnel.Config.Type == "http" && c.inspector != nil && !probe &&
+		c.inspectMgr.CaptureMode(tunnel.ID) != inspect.CaptureNone {
 		cap := NewCapture(tunnel.ID, tunnel.Config.Name, c.inspectMgr.MaxBodySize())
 
 		// Parse HTTP request from the stream (server sends a complete HTTP request).
@@ -1066,23 +1403,7 @@ func (c *Client) handleStream(stream net.Conn) {
 				c.log.Debug().Err(writeErr).Msg("Inspector: failed to forward upgrade request")
 				return
 			}
-			done := make(chan struct{}, 2)
-			go func() {
-				bp := proxyBufPool.Get().(*[]byte)
-				_, _ = io.CopyBuffer(&countingWriter{w: local, count: &tunnel.BytesReceived}, reqBuf, *bp)
-				proxyBufPool.Put(bp)
-				done <- struct{}{}
-			}()
-			go func() {
-				bp := proxyBufPool.Get().(*[]byte)
-				_, _ = io.CopyBuffer(&countingWriter{w: stream, count: &tunnel.BytesSent}, local, *bp)
-				proxyBufPool.Put(bp)
-				done <- struct{}{}
-			}()
-			<-done
-			_ = local.Close()
-			_ = stream.Close()
-			<-done
+			proxyUpgraded(tunnel, stream, reqBuf, local)
 			return
 		}
 
@@ -1090,11 +1411,10 @@ func (c *Client) handleStream(stream net.Conn) {
 		cap.CaptureRequest(httpReq)
 
 		// Forward the request to the local service.
-		if writeErr := httpReq.Write(local); writeErr != nil {
+		if writeErr := httpReq.Write(&countingWriter{w: local, count: &tunnel.BytesReceived}); writeErr != nil {
 			c.log.Debug().Err(writeErr).Msg("Inspector: failed to forward request to local")
 			return
 		}
-		tunnel.BytesReceived.Add(httpReq.ContentLength)
 
 		// Read the HTTP response from local service (respects Content-Length/chunked).
 		localBuf := bufio.NewReader(local)
@@ -1108,19 +1428,18 @@ func (c *Client) handleStream(stream net.Conn) {
 		cap.CaptureResponse(resp)
 
 		// Write the HTTP response back to the stream (server).
-		if writeErr := resp.Write(stream); writeErr != nil {
+		if writeErr := resp.Write(&countingWriter{w: stream, count: &tunnel.BytesSent}); writeErr != nil {
 			c.log.Debug().Err(writeErr).Msg("Inspector: failed to write response to stream")
 		}
 		resp.Body.Close()
-		tunnel.BytesSent.Add(resp.ContentLength)
 
 		// Finalize and store exchange.
 		ex, err := cap.Finalize()
 		if err != nil {
 			c.log.Error().Err(err).Msg("Capture finalize failed")
 		} else {
-			c.log.Debug().Str("method", ex.Method).Str("path", ex.Path).Int("status", ex.StatusCode).Msg("Exchange captured")
 			c.inspector.AddExchange(ex)
+			c.log.Debug().Str("method", ex.Method).Str("path", ex.Path).Int("status", ex.StatusCode).Msg("Exchange captured")
 		}
 	} else {
 		done := make(chan struct{}, 2)
@@ -1148,6 +1467,10 @@ func (c *Client) handleStream(stream net.Conn) {
 	}
 
 	if httpMethod != "" {
+		tunnel.Requests.Add(1)
+		if c.reqSampler != nil && !c.reqSampler.Sample(zerolog.InfoLevel) {
+			return
+		}
 		elapsed := time.Since(reqStart).Milliseconds()
 		var methodColor string
 		switch httpMethod {
@@ -1170,7 +1493,7 @@ func (c *Client) handleStream(stream net.Conn) {
 	}
 }
 
-func (c *Client) keepalive() {
+func (c *Client) keepalive(ctx context.Context) {
 	defer c.wg.Done()
 
 	// Initialize lastPong to now so we don't immediately timeout
@@ -1185,7 +1508,7 @@ func (c *Client) keepalive() {
 
 	for {
 		select {
-		case <-c.ctx.Done():
+		case <-ctx.Done():
 			return
 		case <-ticker.C:
 			// Check pong timeout
@@ -1234,6 +1557,31 @@ func (c *Client) handleDisconnect() {
 	go c.reconnect()
 }
 
+// rejectedBackoff reports whether err is the server refusing the connection,
+// and if so why and the least time to wait before trying again. Limits and
+// bans do not clear up within seconds, so retrying at the usual pace would
+// only add load.
+func rejectedBackoff(err error) (string, time.Duration, bool) {
+	var rejected *protocol.RejectedError
+	if errors.As(err, &rejected) {
+		switch rejected.Reason {
+		case protocol.RejectServerFull:
+			return rejected.Reason.String(), 15 * time.Second, true
+		case protocol.RejectPerIPLimit:
+			return rejected.Reason.String(), 30 * time.Second, true
+		case protocol.RejectBanned, protocol.RejectGeoPolicy:
+			return rejected.Reason.String(), maxReconnectBackoff, true
+		default:
+			return rejected.Reason.String(), time.Minute, true
+		}
+	}
+	var authErr *AuthError
+	if errors.As(err, &authErr) && authErr.Code == protocol.ErrCodeRateLimited {
+		return protocol.RejectRateLimited.String(), time.Minute, true
+	}
+	return "", 0, false
+}
+
 // backoffWithJitter returns the duration with ±20% jitter applied.
 func backoffWithJitter(d time.Duration) time.Duration {
 	// jitter ±20%: multiply by 0.8..1.2
@@ -1244,6 +1592,14 @@ func backoffWithJitter(d time.Duration) time.Duration {
 }
 
 func (c *Client) reconnect() {
+	// Keep tunnels and in-flight streams if the server still holds the session
+	if c.tryResume() {
+		c.reconnectMu.Lock()
+		c.reconnecting = false
+		c.reconnectMu.Unlock()
+		return
+	}
+
 	attempts := 0
 	baseInterval := c.cfg.Reconnect.Interval
 	if baseInterval == 0 {
@@ -1300,6 +1656,9 @@ func (c *Client) reconnect() {
 
 		// Clear tunnels and stop timers
 		c.tunnelsMu.Lock()
+		for _, tunnel := range c.tunnels {
+			tunnel.closeLocal()
+		}
 		c.tunnels = make(map[string]*ActiveTunnel)
 		c.tunnelsMu.Unlock()
 
@@ -1322,6 +1681,7 @@ func (c *Client) reconnect() {
 		}
 
 		// Try to connect
+		c.reconnectTry = attempts
 		if err := c.Connect(); err != nil {
 			// Check if the error is due to an expired token (directly or wrapped)
 			var authErr *AuthError
@@ -1356,7 +1716,12 @@ func (c *Client) reconnect() {
 				}
 			}
 
-			c.log.Error().Err(err).Msg("Reconnection failed")
+			if reason, wait, ok := rejectedBackoff(err); ok {
+				currentBackoff = max(currentBackoff, wait)
+				c.log.Warn().Str("reason", reason).Dur("backoff", currentBackoff).Msg("Connection rejected by server")
+			} else {
+				c.log.Error().Err(err).Msg("Reconnection failed")
+			}
 			time.Sleep(backoffWithJitter(currentBackoff))
 			currentBackoff *= 2
 			if currentBackoff > maxBackoff {
@@ -1368,7 +1733,9 @@ func (c *Client) reconnect() {
 		c.reconnectMu.Lock()
 		c.reconnecting = false
 		c.reconnectMu.Unlock()
+		c.reconnectTry = 0
 
+		c.reconnects.Add(1)
 		c.log.Info().Msg("Reconnected successfully")
 		return
 	}
@@ -1427,6 +1794,9 @@ func (c *Client) closeTunnel(tunnelID string) {
 
 	// Remove from local state
 	c.tunnelsMu.Lock()
+	if tunnel, ok := c.tunnels[tunnelID]; ok {
+		tunnel.closeLocal()
+	}
 	delete(c.tunnels, tunnelID)
 	c.tunnelsMu.Unlock()
 
@@ -1463,6 +1833,20 @@ func (c *Client) InspectorAddr() string {
 	return ""
 }
 
+// shutdownWriteTimeout bounds the client_shutdown write in Close, so a
+// stalled connection cannot hold up exiting.
+const shutdownWriteTimeout = time.Second
+
+// sendShutdown tells the server the client is leaving, so it releases the
+// tunnels at once instead of keeping them for the resume window.
+func (c *Client) sendShutdown() {
+	_ = c.controlStream.SetWriteDeadline(time.Now().Add(shutdownWriteTimeout))
+	msg := &protocol.ClientShutdownMessage{Message: protocol.NewMessage(protocol.MsgClientShutdown)}
+	if err := c.sendControl(msg); err != nil {
+		c.log.Debug().Err(err).Msg("Failed to send client shutdown")
+	}
+}
+
 // Close closes the client. It is safe to call multiple times.
 func (c *Client) Close() {
 	c.closeOnce.Do(func() {
@@ -1475,8 +1859,10 @@ func (c *Client) Close() {
 		if c.inspector != nil {
 			_ = c.inspector.Stop()
 		}
+		c.stopMetricsServer()
 
 		if c.controlStream != nil {
+			c.sendShutdown()
 			c.controlStream.Close()
 		}
 		if c.session != nil {
@@ -1552,15 +1938,24 @@ func (c *Client) emitTrafficStats(tunnel *ActiveTunnel) {
 	}
 }
 
+// errDataSessionsDisabled is returned for a join the server refused because
+// it takes no data connections at all.
+var errDataSessionsDisabled = errors.New("server has data connections disabled")
+
 func (c *Client) openDataConnections() {
 	var wg sync.WaitGroup
 	var failCount atomic.Int32
+	var disabled atomic.Bool
 	for i := 0; i < c.maxDataSessions; i++ {
 		wg.Add(1)
 		go func(idx int) {
 			defer wg.Done()
 			if err := c.openDataConnection(idx); err != nil {
 				failCount.Add(1)
+				if errors.Is(err, errDataSessionsDisabled) {
+					disabled.Store(true)
+					return
+				}
 				c.log.Debug().Err(err).Int("index", idx).Msg("Data connection failed")
 			}
 		}(i)
@@ -1569,7 +1964,9 @@ func (c *Client) openDataConnections() {
 
 	failed := int(failCount.Load())
 	opened := c.maxDataSessions - failed
-	if failed > 0 && opened > 0 {
+	if disabled.Load() {
+		c.log.Info().Msg("Server has data connections disabled, using primary connection only")
+	} else if failed > 0 && opened > 0 {
 		c.log.Info().Int("opened", opened).Int("failed", failed).Int("requested", c.maxDataSessions).
 			Msg("Some data connections could not be established (performance may be reduced)")
 	} else if opened == 0 {
@@ -1602,14 +1999,35 @@ func (c *Client) openDataConnection(idx int) error {
 	return lastErr
 }
 
+// dataConnectTimeout returns how long one data connection may take to set
+// up before it is given up.
+func (c *Client) dataConnectTimeout() time.Duration {
+	if d := c.cfg.Server.DataConnectTimeout; d > 0 {
+		return d
+	}
+	return defaultDataConnectTimeout
+}
+
 func (c *Client) tryOpenDataConnection(idx int) error {
+	timeout := c.dataConnectTimeout()
+	ctx, cancel := context.WithTimeout(c.ctx, timeout)
+	defer cancel()
+
 	// Dial the same endpoint the control connection succeeded on, so data
 	// connections don't each re-probe (and stall on) a DPI-blocked primary.
-	conn, rwc, _, err := c.dialAndNegotiate(c.activeEndpoint)
+	conn, rwc, _, err := c.dialAndNegotiate(ctx, c.activeEndpoint)
 	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("dial server: timed out after %s", timeout)
+		}
 		return fmt.Errorf("dial server: %w", err)
 	}
 
+	// A join that stalls past the timeout is cut off by closing the
+	// connection, which fails whatever step it is in
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
 	// Create yamux session (client mode)
 	yamuxCfg := yamux.DefaultConfig()
 	yamuxCfg.EnableKeepAlive = true
@@ -1647,25 +2065,33 @@ func (c *Client) tryOpenDataConnection(idx int) error {
 	}
 
 	// Read result
-	_ = stream.SetReadDeadline(time.Now().Add(authResponseTimeout))
 	var result protocol.JoinSessionResult
 	if err := codec.Decode(&result); err != nil {
 		stream.Close()
 		session.Close()
 		conn.Close()
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("join session: timed out after %s", timeout)
+		}
 		return fmt.Errorf("read join_session result: %w", err)
 	}
-	_ = stream.SetReadDeadline(time.Time{})
 
 	if !result.Success {
 		stream.Close()
 		session.Close()
 		conn.Close()
+		if result.Code == protocol.ErrCodeDataSessionsDisabled {
+			return errDataSessionsDisabled
+		}
 		return fmt.Errorf("join session rejected: %s", result.Error)
 	}
 
 	// Close the handshake stream — server will Open() streams on this session
 	stream.Close()
+	if !stop() {
+		session.Close()
+		return fmt.Errorf("join session: timed out after %s", timeout)
+	}
 
 	// Store data session
 	c.dataSessionMu.Lock()
@@ -1681,6 +2107,72 @@ func (c *Client) tryOpenDataConnection(idx int) error {
 	return nil
 }
 
+// maxRequestHead caps how much of a request head readRequestHead consumes
+// before giving up on parsing it; the server already limits header size.
+const maxRequestHead = 64 * 1024
+
+// readRequestHead reads the request line and headers from br and returns the
+// raw bytes consumed, so the caller can replay them, together with the
+// method, path and whether the request asks for a connection upgrade. The
+// body is never read.
+func readRequestHead(br *bufio.Reader) (head, method, path string, upgrade bool) {
+	var sb strings.Builder
+	var connection, upgradeHdr string
+	for sb.Len() < maxRequestHead {
+		line, err := br.ReadString('\n')
+		sb.WriteString(line)
+		if err != nil {
+			return sb.String(), "", "", false
+		}
+		trimmed := strings.TrimRight(line, "\r\n")
+		if method == "" {
+			if parts := strings.Fields(trimmed); len(parts) >= 2 {
+				method, path = parts[0], parts[1]
+			}
+			continue
+		}
+		if trimmed == "" {
+			break
+		}
+		name, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			continue
+		}
+		switch {
+		case strings.EqualFold(strings.TrimSpace(name), "Connection"):
+			connection += "," + strings.TrimSpace(value)
+		case strings.EqualFold(strings.TrimSpace(name), "Upgrade"):
+			upgradeHdr = strings.TrimSpace(value)
+		}
+	}
+	upgrade = strings.Contains(strings.ToLower(connection), "upgrade") && upgradeHdr != ""
+	return sb.String(), method, path, upgrade
+}
+
+// proxyUpgraded copies an upgraded (WebSocket) connection in both directions
+// without buffering or interpreting frames, so ping/pong and close frames
+// pass through untouched. An EOF on one side is passed on as a half-close and
+// the call returns once both directions are done.
+func proxyUpgraded(tunnel *ActiveTunnel, stream net.Conn, streamReader io.Reader, local net.Conn) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		bp := proxyBufPool.Get().(*[]byte)
+		_, _ = io.CopyBuffer(&countingWriter{w: local, count: &tunnel.BytesReceived}, streamReader, *bp)
+		proxyBufPool.Put(bp)
+		_ = protocol.CloseWrite(local)
+	}()
+	go func() {
+		defer wg.Done()
+		bp := proxyBufPool.Get().(*[]byte)
+		_, _ = io.CopyBuffer(&countingWriter{w: stream, count: &tunnel.BytesSent}, local, *bp)
+		proxyBufPool.Put(bp)
+		_ = protocol.CloseWrite(stream)
+	}()
+	wg.Wait()
+}
+
 // isHTTPUpgrade reports whether the request is a WebSocket or other HTTP upgrade.
 func isHTTPUpgrade(req *http.Request) bool {
 	return strings.Contains(strings.ToLower(req.Header.Get("Connection")), "upgrade") &&
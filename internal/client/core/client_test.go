@@ -0,0 +1,368 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+// newPoolTestClient returns a client whose worker pool has room for exactly
+// one queued stream and no goroutines draining it.
+func newPoolTestClient(streams config.StreamSettings) *Client {
+	c := New(&config.ClientConfig{Streams: streams}, zerolog.Nop())
+	c.streamWorkers = make(chan net.Conn, 1)
+	c.streamWorkers <- nil // occupy the only slot
+	return c
+}
+
+// isClosed reports whether the remote end of a net.Pipe has been closed.
+func isClosed(conn net.Conn) bool {
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err := conn.Read(make([]byte, 1))
+	return err != nil && !isTimeout(err)
+}
+
+func isTimeout(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
+
+func TestDispatchStream_DropWhenPoolFull(t *testing.T) {
+	c := newPoolTestClient(config.StreamSettings{Overflow: config.StreamOverflowDrop})
+	defer c.cancel()
+
+	local, remote := net.Pipe()
+	c.dispatchStream(local)
+
+	if !isClosed(remote) {
+		t.Fatal("expected stream to be dropped when the pool is full")
+	}
+	if n := c.overflowCount.Load(); n != 0 {
+		t.Fatalf("drop mode must not spawn overflow goroutines, got %d", n)
+	}
+}
+
+func TestDispatchStream_QueueWaitsForWorker(t *testing.T) {
+	c := newPoolTestClient(config.StreamSettings{
+		Overflow:     config.StreamOverflowQueue,
+		QueueTimeout: time.Second,
+	})
+	defer c.cancel()
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		<-c.streamWorkers // a worker frees up
+	}()
+
+	local, _ := net.Pipe()
+	c.dispatchStream(local)
+
+	if got := <-c.streamWorkers; got != local {
+		t.Fatal("expected queued stream to be handed to the pool")
+	}
+}
+
+func TestDispatchStream_QueueTimeout(t *testing.T) {
+	c := newPoolTestClient(config.StreamSettings{
+		Overflow:     config.StreamOverflowQueue,
+		QueueTimeout: 20 * time.Millisecond,
+	})
+	defer c.cancel()
+
+	local, remote := net.Pipe()
+	c.dispatchStream(local)
+
+	if !isClosed(remote) {
+		t.Fatal("expected stream to be dropped after the queue timeout")
+	}
+}
+
+func TestDispatchStream_SpawnRespectsMaxOverflow(t *testing.T) {
+	c := newPoolTestClient(config.StreamSettings{MaxOverflow: 1})
+	defer c.cancel()
+	c.overflowCount.Store(1) // cap already reached
+
+	local, remote := net.Pipe()
+	c.dispatchStream(local)
+
+	if !isClosed(remote) {
+		t.Fatal("expected stream to be dropped once max_overflow is reached")
+	}
+}
+
+func TestHandleUnknownMessage(t *testing.T) {
+	tests := []struct {
+		mode string
+		keep bool
+	}{
+		{"", true},
+		{config.UnknownMessagesIgnore, true},
+		{config.UnknownMessagesLog, true},
+		{config.UnknownMessagesDisconnect, false},
+	}
+	for _, tt := range tests {
+		c := newTestClient("127.0.0.1:1", "")
+		c.cfg.Server.UnknownMessages = tt.mode
+		if got := c.handleUnknownMessage("future_feature"); got != tt.keep {
+			t.Errorf("mode %q: expected %v, got %v", tt.mode, tt.keep, got)
+		}
+		c.Close()
+	}
+}
+
+func TestReadRequestHead(t *testing.T) {
+	raw := "GET /chat HTTP/1.1\r\nHost: x\r\nConnection: keep-alive, Upgrade\r\nUpgrade: websocket\r\n\r\n\x81\x05hello"
+	br := bufio.NewReader(strings.NewReader(raw))
+	head, method, path, upgrade := readRequestHead(br)
+	assert.Equal(t, "GET", method)
+	assert.Equal(t, "/chat", path)
+	assert.True(t, upgrade)
+
+	// Everything after the head, e.g. early WebSocket frames, stays unread.
+	rest, _ := io.ReadAll(br)
+	assert.Equal(t, raw, head+string(rest))
+
+	br = bufio.NewReader(strings.NewReader("POST /api HTTP/1.1\r\nConnection: upgrade\r\nContent-Length: 2\r\n\r\nhi"))
+	_, method, _, upgrade = readRequestHead(br)
+	assert.Equal(t, "POST", method)
+	assert.False(t, upgrade, "Connection: upgrade alone is not an upgrade")
+}
+
+// tcpPair returns both ends of a loopback TCP connection.
+func tcpPair(t *testing.T) (net.Conn, net.Conn) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := ln.Accept()
+		accepted <- conn
+	}()
+	a, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	b := <-accepted
+	require.NotNil(t, b)
+	t.Cleanup(func() { a.Close(); b.Close() })
+	return a, b
+}
+
+func TestProxyUpgraded_HalfClose(t *testing.T) {
+	stream, remote := tcpPair(t)
+	local, app := tcpPair(t)
+	tunnel := &ActiveTunnel{}
+
+	done := make(chan struct{})
+	go func() {
+		proxyUpgraded(tunnel, stream, stream, local)
+		close(done)
+	}()
+
+	// A ping frame travels through byte-for-byte, then the remote side
+	// finishes sending.
+	ping := []byte{0x89, 0x00}
+	_, err := remote.Write(ping)
+	require.NoError(t, err)
+	require.NoError(t, remote.(*net.TCPConn).CloseWrite())
+
+	got, err := io.ReadAll(app)
+	require.NoError(t, err)
+	assert.Equal(t, ping, got)
+
+	// The local service can still answer after the remote half-close.
+	pong := []byte{0x8a, 0x00}
+	_, err = app.Write(pong)
+	require.NoError(t, err)
+	require.NoError(t, app.Close())
+
+	got, err = io.ReadAll(remote)
+	require.NoError(t, err)
+	assert.Equal(t, pong, got)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("proxyUpgraded did not return after both sides closed")
+	}
+	assert.Equal(t, int64(len(ping)), tunnel.BytesReceived.Load())
+	assert.Equal(t, int64(len(pong)), tunnel.BytesSent.Load())
+}
+
+// serveTunnelRequests answers tunnel requests on the server end of a control
+// pipe, rejecting the subdomains in taken with ErrCodeSubdomainTaken. Every
+// requested subdomain is sent on requested.
+func serveTunnelRequests(server *protocol.Codec, taken map[string]bool, requested chan<- string) {
+	for i := 0; ; i++ {
+		data, base, err := server.DecodeRaw()
+		if err != nil || base.Type != protocol.MsgTunnelRequest {
+			return
+		}
+		parsed, err := protocol.ParseMessage(data, base.Type)
+		if err != nil {
+			return
+		}
+		req := parsed.(*protocol.TunnelRequestMessage)
+		requested <- req.Subdomain
+
+		if taken[req.Subdomain] {
+			msg := &protocol.TunnelErrorMessage{
+				Message: protocol.NewMessage(protocol.MsgTunnelError),
+				Error:   "subdomain is already taken",
+				Code:    protocol.ErrCodeSubdomainTaken,
+			}
+			msg.RequestID = req.RequestID
+			_ = server.Encode(msg)
+			continue
+		}
+		resp := &protocol.TunnelCreatedMessage{
+			Message:    protocol.NewMessage(protocol.MsgTunnelCreated),
+			TunnelID:   fmt.Sprintf("t-%d", i),
+			TunnelType: req.TunnelType,
+			URL:        fmt.Sprintf("https://%s.example.com", req.Subdomain),
+			Subdomain:  req.Subdomain,
+		}
+		resp.RequestID = req.RequestID
+		_ = server.Encode(resp)
+	}
+}
+
+func TestRequestTunnel_SubdomainFallback(t *testing.T) {
+	c := newTestClient("127.0.0.1:1", "")
+	server := pipeControl(t, c)
+	requested := make(chan string, 10)
+	go serveTunnelRequests(server, map[string]bool{"myapp": true}, requested)
+
+	err := c.RequestTunnel(config.TunnelConfig{
+		Name: "web", Type: "http", LocalPort: 3000,
+		Subdomain: "myapp", SubdomainFallback: 3,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "myapp", <-requested)
+	assert.Equal(t, "myapp-2", <-requested)
+	tunnels := c.GetTunnels()
+	require.Len(t, tunnels, 1)
+	assert.Equal(t, "https://myapp-2.example.com", tunnels[0].URL)
+	assert.Equal(t, "myapp-2", tunnels[0].Config.Subdomain)
+}
+
+func TestRequestTunnel_SubdomainFallbackExhausted(t *testing.T) {
+	c := newTestClient("127.0.0.1:1", "")
+	server := pipeControl(t, c)
+	requested := make(chan string, 10)
+	go serveTunnelRequests(server, map[string]bool{"myapp": true, "myapp-2": true, "myapp-3": true}, requested)
+
+	err := c.RequestTunnel(config.TunnelConfig{
+		Name: "web", Type: "http", LocalPort: 3000,
+		Subdomain: "myapp", SubdomainFallback: 2,
+	})
+
+	var rejected *TunnelRejectedError
+	require.ErrorAs(t, err, &rejected)
+	assert.Equal(t, protocol.ErrCodeSubdomainTaken, rejected.Code)
+	assert.Len(t, requested, 3)
+	assert.Empty(t, c.GetTunnels())
+}
+
+func TestRequestTunnel_SubdomainTakenWithoutFallback(t *testing.T) {
+	c := newTestClient("127.0.0.1:1", "")
+	server := pipeControl(t, c)
+	requested := make(chan string, 10)
+	go serveTunnelRequests(server, map[string]bool{"myapp": true}, requested)
+
+	err := c.RequestTunnel(config.TunnelConfig{Name: "web", Type: "http", LocalPort: 3000, Subdomain: "myapp"})
+
+	var rejected *TunnelRejectedError
+	require.ErrorAs(t, err, &rejected)
+	assert.Len(t, requested, 1)
+}
+
+func TestRequestTunnel_KeepsRestoreToken(t *testing.T) {
+	c := newTestClient("127.0.0.1:1", "")
+	c.cfg.Tunnels = []config.TunnelConfig{{Name: "web", Type: "http", LocalPort: 3000}}
+	server := pipeControl(t, c)
+
+	requests := make(chan *protocol.TunnelRequestMessage, 2)
+	replies := []*protocol.TunnelCreatedMessage{
+		{TunnelID: "t-1", Subdomain: "abc", RestoreToken: "token-1"},
+		{TunnelID: "t-2", Subdomain: "xyz", RestoreToken: "token-2", AddressChanged: true},
+	}
+	go func() {
+		for _, resp := range replies {
+			data, base, err := server.DecodeRaw()
+			if err != nil {
+				return
+			}
+			parsed, err := protocol.ParseMessage(data, base.Type)
+			if err != nil {
+				return
+			}
+			req := parsed.(*protocol.TunnelRequestMessage)
+			requests <- req
+			resp.Message = protocol.NewMessage(protocol.MsgTunnelCreated)
+			resp.TunnelType = req.TunnelType
+			resp.RequestID = req.RequestID
+			_ = server.Encode(resp)
+		}
+	}()
+
+	require.NoError(t, c.RequestTunnel(c.cfg.Tunnels[0]))
+	assert.Empty(t, (<-requests).RestoreToken)
+	assert.Equal(t, "abc", c.cfg.Tunnels[0].Subdomain)
+	assert.Equal(t, "token-1", c.cfg.Tunnels[0].RestoreToken)
+
+	// A reconnect replays the saved address with its token; the server may
+	// hand out a new address if the old one was taken meanwhile
+	require.NoError(t, c.RequestTunnel(c.cfg.Tunnels[0]))
+	req := <-requests
+	assert.Equal(t, "abc", req.Subdomain)
+	assert.Equal(t, "token-1", req.RestoreToken)
+	assert.Equal(t, "xyz", c.cfg.Tunnels[0].Subdomain)
+	assert.Equal(t, "token-2", c.cfg.Tunnels[0].RestoreToken)
+}
+
+func TestActivateTunnel_DefaultLocalAddr(t *testing.T) {
+	c := newTestClient("127.0.0.1:1", "")
+	defer c.Close()
+	c.cfg.LocalAddr = "127.0.0.2"
+
+	c.activateTunnel(config.TunnelConfig{Name: "web", Type: "http", LocalPort: 3000},
+		&protocol.TunnelCreatedMessage{TunnelID: "t-1"})
+	c.activateTunnel(config.TunnelConfig{Name: "db", Type: "tcp", LocalAddr: "10.0.0.5", LocalPort: 5432},
+		&protocol.TunnelCreatedMessage{TunnelID: "t-2"})
+
+	c.tunnelsMu.RLock()
+	defer c.tunnelsMu.RUnlock()
+	assert.Equal(t, "127.0.0.2:3000", c.tunnels["t-1"].Config.GetLocalAddress())
+	assert.Equal(t, "10.0.0.5:5432", c.tunnels["t-2"].Config.GetLocalAddress(), "the tunnel's own address wins")
+}
+
+func TestCheckConnection(t *testing.T) {
+	c := newTestClient("127.0.0.1:1", "")
+	defer c.Close()
+	c.activateTunnel(config.TunnelConfig{Name: "db", Type: "tcp", LocalPort: 5432, ConfirmConnections: true},
+		&protocol.TunnelCreatedMessage{TunnelID: "t-1"})
+
+	conn := &protocol.NewConnectionMessage{TunnelID: "t-1", RemoteAddr: "203.0.113.9:51000"}
+	assert.NoError(t, c.checkConnection(conn), "without a gate every connection is accepted")
+	assert.Error(t, c.checkConnection(&protocol.NewConnectionMessage{TunnelID: "gone"}))
+
+	c.SetConnectionGate(func(tunnel *ActiveTunnel, conn *protocol.NewConnectionMessage) error {
+		if strings.HasPrefix(conn.RemoteAddr, "203.0.113.") {
+			return fmt.Errorf("%s is blocked on %s", conn.RemoteAddr, tunnel.Config.Name)
+		}
+		return nil
+	})
+	assert.EqualError(t, c.checkConnection(conn), "203.0.113.9:51000 is blocked on db")
+	assert.NoError(t, c.checkConnection(&protocol.NewConnectionMessage{TunnelID: "t-1", RemoteAddr: "198.51.100.1:1"}))
+}
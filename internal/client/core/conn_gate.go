@@ -0,0 +1,69 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+// ConnectionGate decides whether a visitor connection of a tunnel with
+// confirm_connections may be forwarded. A non-nil error declines it and is
+// sent to the server as the reason.
+type ConnectionGate func(tunnel *ActiveTunnel, conn *protocol.NewConnectionMessage) error
+
+// SetConnectionGate sets the check run for each visitor connection of
+// tunnels that confirm connections. Without one, every connection is
+// accepted.
+func (c *Client) SetConnectionGate(gate ConnectionGate) {
+	c.gateMu.Lock()
+	defer c.gateMu.Unlock()
+	c.connGate = gate
+}
+
+// handleNewConnection answers the server's announcement of a visitor
+// connection. The gate runs off the control loop so a slow check does not
+// hold up other messages.
+func (c *Client) handleNewConnection(data []byte) {
+	parsed, err := c.encoding.ParseMessage(data, protocol.MsgNewConnection)
+	if err != nil {
+		c.log.Error().Err(err).Msg("Failed to parse new connection")
+		return
+	}
+	msg := parsed.(*protocol.NewConnectionMessage)
+
+	go func() {
+		reply := &protocol.ConnectionAcceptMessage{
+			Message:      protocol.NewMessage(protocol.MsgConnectionAccept),
+			ConnectionID: msg.ConnectionID,
+		}
+		if err := c.checkConnection(msg); err != nil {
+			c.connLog.Info().
+				Err(err).
+				Str("tunnel_id", msg.TunnelID).
+				Str("remote_addr", msg.RemoteAddr).
+				Msg("Declined visitor connection")
+			reply.Reject = true
+			reply.Reason = err.Error()
+		}
+		if err := c.sendControl(reply); err != nil {
+			c.log.Debug().Err(err).Msg("Failed to answer new connection")
+		}
+	}()
+}
+
+func (c *Client) checkConnection(msg *protocol.NewConnectionMessage) error {
+	c.tunnelsMu.RLock()
+	tunnel, ok := c.tunnels[msg.TunnelID]
+	c.tunnelsMu.RUnlock()
+	if !ok {
+		return fmt.Errorf("unknown tunnel")
+	}
+
+	c.gateMu.RLock()
+	gate := c.connGate
+	c.gateMu.RUnlock()
+	if gate == nil {
+		return nil
+	}
+	return gate(tunnel, msg)
+}
@@ -20,6 +20,16 @@ func (e *AuthError) IsTokenExpired() bool {
 	return e.Code == protocol.ErrCodeTokenExpired
 }
 
+// TunnelRejectedError is returned when the server refuses a tunnel request
+type TunnelRejectedError struct {
+	Code    string
+	Message string
+}
+
+func (e *TunnelRejectedError) Error() string {
+	return "tunnel rejected: " + e.Message
+}
+
 // NewAuthError creates a new AuthError with the given code and message
 func NewAuthError(code, message string) *AuthError {
 	return &AuthError{
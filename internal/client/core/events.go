@@ -19,6 +19,12 @@ const (
 	EventError         EventType = "error"
 	EventLog           EventType = "log"
 	EventRedirected    EventType = "redirected"
+
+	// EventLocalUnreachable is emitted when consecutive connects to a
+	// tunnel's local service keep failing, EventLocalRecovered when one
+	// succeeds again.
+	EventLocalUnreachable EventType = "local_unreachable"
+	EventLocalRecovered   EventType = "local_recovered"
 )
 
 // Event represents a client event with optional payload
@@ -32,29 +38,51 @@ type EventHandler func(Event)
 
 // EventEmitter manages event subscriptions and emissions
 type EventEmitter struct {
-	handlers []EventHandler
+	handlers []subscription
+	nextID   uint64
 	mu       sync.RWMutex
 }
 
+type subscription struct {
+	id      uint64
+	handler EventHandler
+}
+
 // NewEventEmitter creates a new event emitter
 func NewEventEmitter() *EventEmitter {
 	return &EventEmitter{
-		handlers: make([]EventHandler, 0),
+		handlers: make([]subscription, 0),
 	}
 }
 
-// Subscribe adds an event handler
-func (e *EventEmitter) Subscribe(handler EventHandler) {
+// Subscribe adds an event handler. The returned function removes it again.
+func (e *EventEmitter) Subscribe(handler EventHandler) (unsubscribe func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.nextID++
+	id := e.nextID
+	e.handlers = append(e.handlers, subscription{id: id, handler: handler})
+	return func() { e.unsubscribe(id) }
+}
+
+func (e *EventEmitter) unsubscribe(id uint64) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
-	e.handlers = append(e.handlers, handler)
+	for i, sub := range e.handlers {
+		if sub.id == id {
+			e.handlers = append(e.handlers[:i], e.handlers[i+1:]...)
+			return
+		}
+	}
 }
 
 // Emit sends an event to all subscribers
 func (e *EventEmitter) Emit(event Event) {
 	e.mu.RLock()
 	handlers := make([]EventHandler, len(e.handlers))
-	copy(handlers, e.handlers)
+	for i, sub := range e.handlers {
+		handlers[i] = sub.handler
+	}
 	e.mu.RUnlock()
 
 	for _, h := range handlers {
@@ -91,6 +119,9 @@ func (e *EventEmitter) EmitTunnelCreated(tunnel *ActiveTunnel) {
 	if tunnel.URL != "" {
 		payload["url"] = tunnel.URL
 	}
+	if tunnel.InspectURL != "" {
+		payload["inspect_url"] = tunnel.InspectURL
+	}
 	if tunnel.RemoteAddr != "" {
 		payload["remote_addr"] = tunnel.RemoteAddr
 	}
@@ -116,5 +147,5 @@ func (e *EventEmitter) EmitLog(level, message string) {
 func (e *EventEmitter) Clear() {
 	e.mu.Lock()
 	defer e.mu.Unlock()
-	e.handlers = make([]EventHandler, 0)
+	e.handlers = make([]subscription, 0)
 }
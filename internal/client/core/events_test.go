@@ -3,6 +3,7 @@ package core
 import (
 	"errors"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -169,6 +170,20 @@ func TestEventEmitter_Clear(t *testing.T) {
 	assert.False(t, called)
 }
 
+func TestEventEmitter_Unsubscribe(t *testing.T) {
+	emitter := NewEventEmitter()
+	var removed, kept atomic.Int32
+	unsubscribe := emitter.Subscribe(func(e Event) { removed.Add(1) })
+	emitter.Subscribe(func(e Event) { kept.Add(1) })
+
+	unsubscribe()
+	unsubscribe() // a second call is a no-op
+	emitter.EmitType(EventConnected)
+	time.Sleep(50 * time.Millisecond)
+	assert.Zero(t, removed.Load())
+	assert.Equal(t, int32(1), kept.Load())
+}
+
 func TestEventEmitter_ConcurrentSafety(t *testing.T) {
 	emitter := NewEventEmitter()
 	var wg sync.WaitGroup
@@ -1,6 +1,8 @@
 package core
 
 import (
+	"bytes"
+	"container/heap"
 	"context"
 	"encoding/base64"
 	"encoding/json"
@@ -9,6 +11,7 @@ import (
 	"io/fs"
 	"net"
 	"net/http"
+	"net/url"
 	"path"
 	"sort"
 	"strconv"
@@ -36,32 +39,65 @@ type Inspector struct {
 	actualAddr  string
 	log         zerolog.Logger
 
+	// replayClient is shared by all replays so connections to the local
+	// service are pooled and kept alive between requests.
+	replayClient *http.Client
+
+	// remoteReplayClient sends replays through public tunnel URLs, which
+	// may take remoteReplayTimeout. remoteReplays holds the marks of those
+	// in flight (see isRemoteReplay).
+	remoteReplayClient  *http.Client
+	remoteReplayTimeout time.Duration
+	remoteReplays       sync.Map
+
+	// replayMaxBodySize caps how much of a replayed response is kept.
+	replayMaxBodySize int
+
+	// querySlots bounds how many list and summary requests walk the
+	// buffers at the same time.
+	querySlots chan struct{}
+
 	// Global broadcast for SSE subscribers.
 	sseSubsMu sync.RWMutex
 	sseSubs   map[chan *inspect.CapturedExchange]struct{}
+
+	// events feeds the WebSocket event stream; nil until SetEvents.
+	events *EventEmitter
 }
 
+// defaultMaxConcurrentQueries is used when no limit is configured.
+const defaultMaxConcurrentQueries = 4
+
 // NewInspector creates a new Inspector with all routes configured.
 func NewInspector(manager *inspect.Manager, addr string, maxBodySize int, log zerolog.Logger) *Inspector {
 	i := &Inspector{
-		manager:     manager,
-		addr:        addr,
-		maxBodySize: maxBodySize,
-		startTime:   time.Now(),
-		mux:         http.NewServeMux(),
-		log:         log.With().Str("component", "inspector").Logger(),
-		sseSubs:     make(map[chan *inspect.CapturedExchange]struct{}),
+		manager:           manager,
+		addr:              addr,
+		maxBodySize:       maxBodySize,
+		replayMaxBodySize: maxBodySize,
+		startTime:         time.Now(),
+		mux:               http.NewServeMux(),
+		log:               log.With().Str("component", "inspector").Logger(),
+		sseSubs:           make(map[chan *inspect.CapturedExchange]struct{}),
+
+		replayClient: newReplayClient(),
+		querySlots:   make(chan struct{}, defaultMaxConcurrentQueries),
+
+		remoteReplayClient:  newRemoteReplayClient(),
+		remoteReplayTimeout: defaultRemoteReplayTimeout,
 	}
 
 	// Register routes. summary must be registered before {id} to be safe.
 	i.mux.HandleFunc("GET /api/requests/http/summary", i.handleSummary)
 	i.mux.HandleFunc("GET /api/requests/http/stream", i.handleSSEStream)
+	i.mux.HandleFunc("GET /api/requests/http/diff", i.handleDiff)
 	i.mux.HandleFunc("GET /api/requests/http/{id}", i.handleGetExchange)
 	i.mux.HandleFunc("GET /api/requests/http", i.handleListExchanges)
 	i.mux.HandleFunc("POST /api/requests/http", i.handleReplay)
 	i.mux.HandleFunc("DELETE /api/requests/http", i.handleDeleteExchanges)
 	i.mux.HandleFunc("GET /api/tunnels", i.handleListTunnels)
 	i.mux.HandleFunc("GET /api/status", i.handleStatus)
+	i.mux.HandleFunc("GET /api/events", i.handleEventStream)
 
 	// Serve embedded UI files with no-cache to prevent stale JS.
 	uiFS, err := fs.Sub(inspectorUIFS, "inspector_ui")
@@ -72,6 +108,11 @@ func NewInspector(manager *inspect.Manager, addr string, maxBodySize int, log ze
 	return i
 }
 
+// HandleMetrics serves h at GET /metrics alongside the inspector API.
+func (i *Inspector) HandleMetrics(h http.Handler) {
+	i.mux.Handle("GET /metrics", h)
+}
+
 // ServeHTTP implements http.Handler with CORS middleware.
 func (i *Inspector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
@@ -129,6 +170,7 @@ func (i *Inspector) Start(ctx context.Context) error {
 
 // Stop gracefully shuts down the inspector HTTP server.
 func (i *Inspector) Stop() error {
+	i.replayClient.CloseIdleConnections()
 	if i.server == nil {
 		return nil
 	}
@@ -142,9 +184,31 @@ func (i *Inspector) Addr() string {
 	return i.actualAddr
 }
 
+// TunnelURL returns a link to the inspector UI filtered to one tunnel, or
+// empty if the inspector is not listening.
+func (i *Inspector) TunnelURL(tunnelID string) string {
+	if i.actualAddr == "" {
+		return ""
+	}
+	return "http://" + i.actualAddr + "/?tunnel=" + url.QueryEscape(tunnelID)
+}
+
 // AddExchange adds a captured exchange to the appropriate tunnel buffer
-// and broadcasts to all SSE subscribers.
+// and broadcasts to all SSE subscribers. Exchanges the tunnel's capture
+// mode filters out are dropped, as are remote replays reaching the local
+// service; secret query parameters are masked first.
 func (i *Inspector) AddExchange(ex *inspect.CapturedExchange) {
+	if i.isRemoteReplay(ex) {
+		return
+	}
+	i.addExchange(ex)
+}
+
+func (i *Inspector) addExchange(ex *inspect.CapturedExchange) {
+	if !i.manager.Captures(ex.TunnelID, ex.StatusCode) {
+		return
+	}
+	ex.Path = i.manager.RedactPath(ex.Path)
 	buf := i.manager.GetOrCreate(ex.TunnelID)
 	if buf != nil {
 		buf.Add(ex)
@@ -167,6 +231,31 @@ func noCacheMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// SetMaxConcurrentQueries limits how many list and summary requests are
+// aggregated at once. It must be called before Start; n < 1 keeps the default.
+func (i *Inspector) SetMaxConcurrentQueries(n int) {
+	if n < 1 {
+		n = defaultMaxConcurrentQueries
+	}
+	i.querySlots = make(chan struct{}, n)
+}
+
+// acquireQuery waits for a free aggregation slot. It reports false, after
+// writing an error response, if the client goes away first.
+func (i *Inspector) acquireQuery(w http.ResponseWriter, r *http.Request) bool {
+	select {
+	case i.querySlots <- struct{}{}:
+		return true
+	case <-r.Context().Done():
+		writeError(w, http.StatusServiceUnavailable, "inspector is busy")
+		return false
+	}
+}
+
+func (i *Inspector) releaseQuery() {
+	<-i.querySlots
+}
+
 // SetTunnels gives the inspector access to the client's active tunnels.
 func (i *Inspector) SetTunnels(tunnels map[string]*ActiveTunnel, mu *sync.RWMutex) {
 	i.tunnels = tunnels
@@ -259,62 +348,62 @@ func (i *Inspector) handleListExchanges(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
-	// Collect all exchanges from all buffers.
-	var all []*inspect.CapturedExchange
-	i.manager.ForEach(func(tunnelID string, buf *inspect.RingBuffer) {
-		entries := buf.List(0, buf.Len())
-		all = append(all, entries...)
-	})
+	if !i.acquireQuery(w, r) {
+		return
+	}
+	defer i.releaseQuery()
 
-	// Apply filters.
-	filtered := make([]*inspect.CapturedExchange, 0, len(all))
-	for _, ex := range all {
-		if filterMethod != "" && !strings.EqualFold(ex.Method, filterMethod) {
-			continue
-		}
-		if filterStatus != "" && !matchStatus(ex.StatusCode, filterStatus) {
-			continue
-		}
-		if filterPath != "" {
-			matched, _ := path.Match(filterPath, ex.Path)
-			if !matched {
-				continue
+	// Walk every buffer once, counting matches but only keeping the newest
+	// offset+limit of them, so a page never costs more than its own size.
+	page := &newestExchanges{keep: offset + limit}
+	total := 0
+	i.manager.ForEach(func(_ string, buf *inspect.RingBuffer) {
+		buf.Range(func(ex *inspect.CapturedExchange) bool {
+			if filterMethod != "" && !strings.EqualFold(ex.Method, filterMethod) {
+				return true
 			}
-		}
-		if filterSearch != "" {
-			found := strings.Contains(string(ex.RequestBody), filterSearch) ||
-				strings.Contains(string(ex.ResponseBody), filterSearch)
-			if !found {
-				continue
+			if filterStatus != "" && !matchStatus(ex.StatusCode, filterStatus) {
+				return true
 			}
-		}
-		if !filterSince.IsZero() && ex.Timestamp.Before(filterSince) {
-			continue
-		}
-		if filterTunnel != "" {
-			if !i.tunnelNameMatches(ex.TunnelID, filterTunnel) {
-				continue
+			if filterPath != "" {
+				matched, _ := path.Match(filterPath, ex.Path)
+				if !matched {
+					return true
+				}
 			}
-		}
-		filtered = append(filtered, ex)
-	}
+			if filterSearch != "" {
+				found := strings.Contains(string(ex.RequestBody), filterSearch) ||
+					strings.Contains(string(ex.ResponseBody), filterSearch)
+				if !found {
+					return true
+				}
+			}
+			if !filterSince.IsZero() && ex.Timestamp.Before(filterSince) {
+				return true
+			}
+			if filterTunnel != "" {
+				if !i.tunnelNameMatches(ex.TunnelID, filterTunnel) {
+					return true
+				}
+			}
+			total++
+			page.offer(ex)
+			return true
+		})
+	})
 
 	// Sort by timestamp descending (newest first).
+	filtered := page.items
 	sort.Slice(filtered, func(a, b int) bool {
 		return filtered[a].Timestamp.After(filtered[b].Timestamp)
 	})
 
-	total := len(filtered)
-
 	// Apply pagination.
 	if offset > len(filtered) {
 		filtered = nil
 	} else {
 		filtered = filtered[offset:]
 	}
-	if len(filtered) > limit {
-		filtered = filtered[:limit]
-	}
 
 	items := make([]exchangeListItem, 0, len(filtered))
 	for _, ex := range filtered {
@@ -327,19 +416,38 @@ func (i *Inspector) handleListExchanges(w http.ResponseWriter, r *http.Request)
 	})
 }
 
-func (i *Inspector) handleGetExchange(w http.ResponseWriter, r *http.Request) {
-	id := r.PathValue("id")
+// newestExchanges keeps the keep most recent exchanges offered to it, as a
+// min-heap on timestamp so the oldest kept entry is evicted first.
+type newestExchanges struct {
+	keep  int
+	items []*inspect.CapturedExchange
+}
 
-	var found *inspect.CapturedExchange
-	i.manager.ForEach(func(_ string, buf *inspect.RingBuffer) {
-		if found != nil {
-			return
-		}
-		if ex := buf.Get(id); ex != nil {
-			found = ex
-		}
-	})
+func (h *newestExchanges) Len() int { return len(h.items) }
+func (h *newestExchanges) Less(a, b int) bool {
+	return h.items[a].Timestamp.Before(h.items[b].Timestamp)
+}
+func (h *newestExchanges) Swap(a, b int) { h.items[a], h.items[b] = h.items[b], h.items[a] }
+func (h *newestExchanges) Push(x any)    { h.items = append(h.items, x.(*inspect.CapturedExchange)) }
+func (h *newestExchanges) Pop() any {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
+
+func (h *newestExchanges) offer(ex *inspect.CapturedExchange) {
+	if len(h.items) < h.keep {
+		heap.Push(h, ex)
+		return
+	}
+	if ex.Timestamp.After(h.items[0].Timestamp) {
+		h.items[0] = ex
+		heap.Fix(h, 0)
+	}
+}
 
+func (i *Inspector) handleGetExchange(w http.ResponseWriter, r *http.Request) {
+	found := i.findExchange(r.PathValue("id"))
 	if found == nil {
 		writeError(w, http.StatusNotFound, "exchange not found")
 		return
@@ -365,7 +473,12 @@ type summaryResponse struct {
 	LastRequestAt *string        `json:"last_request_at"`
 }
 
-func (i *Inspector) handleSummary(w http.ResponseWriter, _ *http.Request) {
+func (i *Inspector) handleSummary(w http.ResponseWriter, r *http.Request) {
+	if !i.acquireQuery(w, r) {
+		return
+	}
+	defer i.releaseQuery()
+
 	byStatus := map[string]int{"2xx": 0, "3xx": 0, "4xx": 0, "5xx": 0}
 	byMethod := map[string]int{}
 	var total int
@@ -373,8 +486,7 @@ func (i *Inspector) handleSummary(w http.ResponseWriter, _ *http.Request) {
 	var lastAt time.Time
 
 	i.manager.ForEach(func(_ string, buf *inspect.RingBuffer) {
-		entries := buf.List(0, buf.Len())
-		for _, ex := range entries {
+		buf.Range(func(ex *inspect.CapturedExchange) bool {
 			total++
 			totalDuration += ex.Duration.Milliseconds()
 
@@ -394,7 +506,8 @@ func (i *Inspector) handleSummary(w http.ResponseWriter, _ *http.Request) {
 			if ex.Timestamp.After(lastAt) {
 				lastAt = ex.Timestamp
 			}
-		}
+			return true
+		})
 	})
 
 	resp := summaryResponse{
@@ -466,24 +579,61 @@ func (i *Inspector) handleSSEStream(w http.ResponseWriter, r *http.Request) {
 
 func (i *Inspector) handleListTunnels(w http.ResponseWriter, _ *http.Request) {
 	type tunnelInfo struct {
-		ID        string `json:"id"`
-		Name      string `json:"name"`
-		Type      string `json:"type"`
-		URL       string `json:"url,omitempty"`
-		LocalPort int    `json:"local_port"`
+		ID         string `json:"id"`
+		Name       string `json:"name"`
+		Type       string `json:"type"`
+		URL        string `json:"url,omitempty"`
+		RemoteAddr string `json:"remote_addr,omitempty"`
+		LocalPort  int    `json:"local_port"`
+
+		ActiveConns   int64 `json:"active_conns"`
+		DialFailures  int64 `json:"dial_failures"`
+		BytesSent     int64 `json:"bytes_sent"`
+		BytesReceived int64 `json:"bytes_received"`
+		Requests      int64 `json:"requests"`
+
+		// ConsecutiveDialFailures counts the failed connects to the local
+		// service since the last successful one; LocalUnreachable is set
+		// once they reach the alert threshold.
+		ConsecutiveDialFailures int64 `json:"consecutive_dial_failures"`
+		LocalUnreachable        bool  `json:"local_unreachable,omitempty"`
+
+		// Captured and Errors count the exchanges in the tunnel's buffer
+		// and those among them with status >= 400.
+		Captured int `json:"captured"`
+		Errors   int `json:"errors"`
 	}
 
 	var tunnels []tunnelInfo
 	if i.tunnelsMu != nil {
 		i.tunnelsMu.RLock()
 		for _, t := range i.tunnels {
-			tunnels = append(tunnels, tunnelInfo{
-				ID:        t.ID,
-				Name:      t.Config.Name,
-				Type:      t.Config.Type,
-				URL:       t.URL,
-				LocalPort: t.Config.LocalPort,
-			})
+			info := tunnelInfo{
+				ID:            t.ID,
+				Name:          t.Config.Name,
+				Type:          t.Config.Type,
+				URL:           t.URL,
+				RemoteAddr:    t.RemoteAddr,
+				LocalPort:     t.Config.LocalPort,
+				ActiveConns:   t.ActiveConns.Load(),
+				DialFailures:  t.DialFailures.Load(),
+				BytesSent:     t.BytesSent.Load(),
+				BytesReceived: t.BytesReceived.Load(),
+				Requests:      t.Requests.Load(),
+
+				ConsecutiveDialFailures: t.ConsecutiveDialFailures.Load(),
+				LocalUnreachable:        t.LocalUnreachable(),
+			}
+			if buf := i.manager.Get(t.ID); buf != nil {
+				buf.Range(func(ex *inspect.CapturedExchange) bool {
+					info.Captured++
+					if ex.StatusCode >= 400 {
+						info.Errors++
+					}
+					return true
+				})
+			}
+			tunnels = append(tunnels, info)
 		}
 		i.tunnelsMu.RUnlock()
 	}
@@ -511,6 +661,33 @@ func (i *Inspector) handleStatus(w http.ResponseWriter, _ *http.Request) {
 	})
 }
 
+const (
+	// replayTimeout bounds a single replay, including reading the response.
+	replayTimeout = 30 * time.Second
+
+	// replayDrainLimit is how much of an unread response body is discarded
+	// so the connection can go back to the pool instead of being closed.
+	replayDrainLimit = 256 * 1024
+)
+
+// newReplayClient returns the HTTP client used to replay requests against
+// local services. Replays always target a handful of local addresses, so the
+// transport keeps a generous number of idle connections per host.
+func newReplayClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{
+				Timeout:   localDialTimeout,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			MaxIdleConns:          100,
+			MaxIdleConnsPerHost:   32,
+			IdleConnTimeout:       90 * time.Second,
+			ResponseHeaderTimeout: replayTimeout,
+		},
+	}
+}
+
 // replayRequest is the JSON body for POST /api/requests/http.
 type replayRequest struct {
 	ID      string            `json:"id"`
@@ -518,6 +695,11 @@ type replayRequest struct {
 	Path    string            `json:"path,omitempty"`
 	Headers map[string]string `json:"headers,omitempty"`
 	Body    string            `json:"body,omitempty"` // base64 encoded
+
+	// Target is replayTargetLocal or replayTargetRemote; Timeout (e.g.
+	// "90s") overrides inspect.remote_replay_timeout for a remote replay.
+	Target  string `json:"target,omitempty"`
+	Timeout string `json:"timeout,omitempty"`
 }
 
 func (i *Inspector) handleReplay(w http.ResponseWriter, r *http.Request) {
@@ -533,25 +715,38 @@ func (i *Inspector) handleReplay(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Find original exchange.
-	var original *inspect.CapturedExchange
-	i.manager.ForEach(func(_ string, buf *inspect.RingBuffer) {
-		if original != nil {
-			return
-		}
-		if ex := buf.Get(req.ID); ex != nil {
-			original = ex
-		}
-	})
-
+	original := i.findExchange(req.ID)
 	if original == nil {
 		writeError(w, http.StatusNotFound, "exchange not found")
 		return
 	}
 
-	// Determine local address from the tunnel.
-	localAddr := i.resolveLocalAddr(original.TunnelID)
-	if localAddr == "" {
-		writeError(w, http.StatusBadRequest, "tunnel not found or no local address")
+	timeout, err := i.replayTimeoutFor(&req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Determine where to send the replay.
+	var base, dest string
+	client := i.replayClient
+	switch req.Target {
+	case "", replayTargetLocal:
+		localAddr := i.resolveLocalAddr(original.TunnelID)
+		if localAddr == "" {
+			writeError(w, http.StatusBadRequest, "tunnel not found or no local address")
+			return
+		}
+		base, dest = "http://"+localAddr, "local service"
+	case replayTargetRemote:
+		base, err = i.resolvePublicURL(original.TunnelID, original.Host)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		dest, client = "public URL", i.remoteReplayClient
+	default:
+		writeError(w, http.StatusBadRequest, `target must be "local" or "remote"`)
 		return
 	}
 
@@ -565,20 +760,34 @@ func (i *Inspector) handleReplay(w http.ResponseWriter, r *http.Request) {
 		reqPath = req.Path
 	}
 
-	var body io.Reader
+	reqBody := original.RequestBody
 	if req.Body != "" {
-		decoded, err := base64.StdEncoding.DecodeString(req.Body)
+		reqBody, err = base64.StdEncoding.DecodeString(req.Body)
 		if err != nil {
 			writeError(w, http.StatusBadRequest, "invalid base64 body")
 			return
 		}
-		body = strings.NewReader(string(decoded))
-	} else if original.RequestBody != nil {
-		body = strings.NewReader(string(original.RequestBody))
+	} else if int64(len(reqBody)) < original.RequestBodySize && isMultipart(original.RequestHeaders.Get("Content-Type")) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf(
+			"captured multipart body is incomplete (%d of %d bytes); send an edited body to replay it",
+			len(reqBody), original.RequestBodySize))
+		return
+	}
+	contentType, err := replayContentType(original.RequestHeaders.Get("Content-Type"), req.Headers, reqBody)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	url := fmt.Sprintf("http://%s%s", localAddr, reqPath)
-	httpReq, err := http.NewRequestWithContext(r.Context(), method, url, body)
+	var body io.Reader
+	if reqBody != nil {
+		body = bytes.NewReader(reqBody)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(ctx, method, base+reqPath, body)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to create request")
 		return
@@ -593,52 +802,58 @@ func (i *Inspector) handleReplay(w http.ResponseWriter, r *http.Request) {
 	for k, v := range req.Headers {
 		httpReq.Header.Set(k, v)
 	}
+	if contentType != "" {
+		httpReq.Header.Set("Content-Type", contentType)
+	}
+	if client == i.remoteReplayClient {
+		mark := i.markRemoteReplay()
+		defer i.unmarkRemoteReplay(mark)
+		httpReq.Header.Set(remoteReplayHeader, mark)
+	}
 
 	// Send request.
 	start := time.Now()
-	client := &http.Client{Timeout: 30 * time.Second}
 	resp, err := client.Do(httpReq)
 	if err != nil {
-		writeError(w, http.StatusBadGateway, fmt.Sprintf("request to local service failed: %v", err))
+		writeError(w, http.StatusBadGateway, fmt.Sprintf("request to %s failed: %v", dest, err))
 		return
 	}
 	defer resp.Body.Close()
 	duration := time.Since(start)
 
-	respBody, err := io.ReadAll(io.LimitReader(resp.Body, int64(i.maxBodySize)))
+	respBody, truncated, err := inspect.ReadBody(resp.Body, i.replayMaxBodySize)
+	// Drain what the capture limit left unread so the connection is reusable.
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, replayDrainLimit))
 	if err != nil {
 		writeError(w, http.StatusBadGateway, "failed to read response body")
 		return
 	}
-
-	// Build request body for the captured exchange.
-	var capturedReqBody []byte
-	if req.Body != "" {
-		capturedReqBody, _ = base64.StdEncoding.DecodeString(req.Body)
-	} else {
-		capturedReqBody = original.RequestBody
+	respBodySize := int64(len(respBody))
+	if truncated && resp.ContentLength > respBodySize {
+		respBodySize = resp.ContentLength
 	}
 
 	// Create new exchange.
 	newEx := &inspect.CapturedExchange{
-		ID:               generateID(),
-		TunnelID:         original.TunnelID,
-		ReplayRef:        original.ID,
-		Timestamp:        time.Now(),
-		Duration:         duration,
-		Method:           method,
-		Path:             reqPath,
-		Host:             original.Host,
-		RequestHeaders:   httpReq.Header,
-		RequestBody:      capturedReqBody,
-		RequestBodySize:  int64(len(capturedReqBody)),
-		StatusCode:       resp.StatusCode,
-		ResponseHeaders:  resp.Header,
-		ResponseBody:     respBody,
-		ResponseBodySize: int64(len(respBody)),
-	}
-
-	i.AddExchange(newEx)
+		ID:                generateID(),
+		TunnelID:          original.TunnelID,
+		ReplayRef:         original.ID,
+		Timestamp:         time.Now(),
+		Duration:          duration,
+		Method:            method,
+		Path:              reqPath,
+		Host:              original.Host,
+		RequestHeaders:    httpReq.Header,
+		RequestBody:       reqBody,
+		RequestBodySize:   int64(len(reqBody)),
+		StatusCode:        resp.StatusCode,
+		ResponseHeaders:   resp.Header,
+		ResponseBody:      respBody,
+		ResponseBodySize:  respBodySize,
+		ResponseTruncated: truncated,
+	}
+
+	i.addExchange(newEx)
 
 	// Build response headers map for JSON.
 	respHeaders := make(map[string]string, len(resp.Header))
@@ -651,6 +866,7 @@ func (i *Inspector) handleReplay(w http.ResponseWriter, r *http.Request) {
 		"response_headers": respHeaders,
 		"response_body":    base64.StdEncoding.EncodeToString(respBody),
 		"exchange_id":      newEx.ID,
+		"truncated":        truncated,
 	})
 }
 
@@ -3,10 +3,12 @@ package core
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
 	"crypto/rand"
 	"encoding/hex"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/mephistofox/fxtun.dev/internal/inspect"
@@ -15,7 +17,7 @@ import (
 // maxCaptureRead is the absolute maximum bytes read into memory for a single
 // request or response body during inspector capture. This prevents OOM when
 // large uploads/downloads flow through an inspected tunnel. Bodies exceeding
-// this limit are truncated in both the capture and the forwarded request.
+// this limit are captured partially but still forwarded in full.
 const maxCaptureRead = 10 * 1024 * 1024 // 10 MB
 
 // Capture records HTTP request/response bytes flowing through a tunnel connection.
@@ -34,6 +36,19 @@ type Capture struct {
 	respBodySize int64
 }
 
+// bodySizeCounter counts the bytes of a body that is streamed past the
+// capture limit so the recorded size still reflects the whole body.
+type bodySizeCounter struct {
+	io.Reader
+	n *int64
+}
+
+func (b *bodySizeCounter) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	*b.n += int64(n)
+	return n, err
+}
+
 // NewCapture creates a new capture for a single HTTP exchange.
 func NewCapture(tunnelID, tunnelName string, maxBodySize int) *Capture {
 	return &Capture{
@@ -63,12 +78,9 @@ func (c *Capture) WrapResponse(r io.Reader) io.Reader {
 func (c *Capture) CaptureRequest(req *http.Request) {
 	c.parsedReq = req
 	if req.Body != nil {
-		body, _ := io.ReadAll(io.LimitReader(req.Body, maxCaptureRead))
-		req.Body.Close()
-		c.reqBody = c.truncateBody(body)
-		c.reqBodySize = int64(len(body))
-		req.Body = io.NopCloser(bytes.NewReader(body))
-		req.ContentLength = int64(len(body))
+		var length int64
+		req.Body, length = c.bufferBody(req.Body, req.ContentLength, req.Header, &c.reqBody, &c.reqBodySize)
+		req.ContentLength = length
 	}
 }
 
@@ -77,15 +89,29 @@ func (c *Capture) CaptureRequest(req *http.Request) {
 // Replaces resp.Body with a new reader so the caller can still use resp.Write().
 // Reads at most maxCaptureRead bytes to prevent OOM on large downloads.
 func (c *Capture) CaptureResponse(resp *http.Response) {
-	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxCaptureRead))
-	resp.Body.Close()
-	// Store captured data.
 	c.parsedResp = resp
-	c.respBody = c.truncateBody(body)
-	c.respBodySize = int64(len(body))
-	// Replace body so resp.Write() can still send it.
-	resp.Body = io.NopCloser(bytes.NewReader(body))
-	resp.ContentLength = int64(len(body))
+	resp.Body, resp.ContentLength = c.bufferBody(resp.Body, resp.ContentLength, resp.Header, &c.respBody, &c.respBodySize)
+}
+
+// bufferBody reads up to maxCaptureRead bytes of body into the capture and
+// returns a replacement body carrying the same bytes, along with the content
+// length to forward. Chunked bodies arrive already decoded by net/http;
+// gzip-encoded ones are decompressed for the stored copy only, so the wire
+// bytes are forwarded unchanged. A body longer than the limit is forwarded
+// as the buffered prefix followed by the rest of the original stream.
+func (c *Capture) bufferBody(body io.ReadCloser, length int64, header http.Header, captured *[]byte, size *int64) (io.ReadCloser, int64) {
+	buf, _ := io.ReadAll(io.LimitReader(body, maxCaptureRead))
+	*captured = c.truncateBody(decodeBody(header, buf))
+	*size = int64(len(buf))
+	if int64(len(buf)) < maxCaptureRead {
+		body.Close()
+		return io.NopCloser(bytes.NewReader(buf)), int64(len(buf))
+	}
+	rest := &bodySizeCounter{Reader: body, n: size}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(buf), rest), body}, length
 }
 
 // Finalize parses captured bytes into a CapturedExchange.
@@ -131,7 +157,7 @@ func (c *Capture) parseRequest(ex *inspect.CapturedExchange) {
 
 	body, _ := io.ReadAll(io.LimitReader(req.Body, maxCaptureRead))
 	ex.RequestBodySize = int64(len(body))
-	ex.RequestBody = c.truncateBody(body)
+	ex.RequestBody = c.truncateBody(decodeBody(req.Header, body))
 }
 
 func (c *Capture) parseResponse(ex *inspect.CapturedExchange) {
@@ -151,7 +177,7 @@ func (c *Capture) parseResponse(ex *inspect.CapturedExchange) {
 
 	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxCaptureRead))
 	ex.ResponseBodySize = int64(len(body))
-	ex.ResponseBody = c.truncateBody(body)
+	ex.ResponseBody = c.truncateBody(decodeBody(resp.Header, body))
 }
 
 func (c *Capture) fillFromRequest(ex *inspect.CapturedExchange, req *http.Request) {
@@ -177,6 +203,31 @@ func (c *Capture) truncateBody(data []byte) []byte {
 	return data
 }
 
+// decodeBody returns body decompressed according to a gzip Content-Encoding
+// header. Other encodings, and bodies that fail to decompress before any
+// output is produced, are returned as-is. A truncated gzip stream yields
+// whatever could be decoded.
+func decodeBody(header http.Header, body []byte) []byte {
+	if len(body) == 0 {
+		return body
+	}
+	switch strings.ToLower(strings.TrimSpace(header.Get("Content-Encoding"))) {
+	case "gzip", "x-gzip":
+	default:
+		return body
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return body
+	}
+	defer zr.Close()
+	decoded, err := io.ReadAll(io.LimitReader(zr, maxCaptureRead))
+	if err != nil && len(decoded) == 0 {
+		return body
+	}
+	return decoded
+}
+
 func generateCaptureID() string {
 	b := make([]byte, 8)
 	_, _ = rand.Read(b)
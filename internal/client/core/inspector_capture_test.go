@@ -1,8 +1,13 @@
 package core
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
+	"fmt"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 
@@ -114,3 +119,67 @@ func TestCaptureBinaryNonHTTP(t *testing.T) {
 	assert.Nil(t, ex.ResponseHeaders)
 	assert.Nil(t, ex.ResponseBody)
 }
+
+func TestCaptureResponseGzipChunked(t *testing.T) {
+	plain := `{"status":"ok"}`
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = zw.Write([]byte(plain))
+	require.NoError(t, zw.Close())
+
+	rawResp := "HTTP/1.1 200 OK\r\n" +
+		"Content-Type: application/json\r\n" +
+		"Content-Encoding: gzip\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"\r\n" +
+		fmt.Sprintf("%x\r\n", gz.Len()) + gz.String() + "\r\n" +
+		"0\r\n\r\n"
+
+	req := httptest.NewRequest(http.MethodGet, "/data", nil)
+	resp, err := http.ReadResponse(bufio.NewReader(strings.NewReader(rawResp)), req)
+	require.NoError(t, err)
+
+	cap := NewCapture("tun-4", "gzip", 4096)
+	cap.CaptureResponse(resp)
+
+	// The forwarded body keeps the compressed bytes.
+	forwarded, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, gz.Bytes(), forwarded)
+
+	ex, err := cap.Finalize()
+	require.NoError(t, err)
+	assert.Equal(t, []byte(plain), ex.ResponseBody, "stored body should be decompressed")
+	assert.Equal(t, int64(gz.Len()), ex.ResponseBodySize, "size should reflect wire bytes")
+}
+
+func TestCaptureRequestLargeBodyForwardedInFull(t *testing.T) {
+	size := maxCaptureRead + 1024
+	req := httptest.NewRequest(http.MethodPost, "/upload", bytes.NewReader(bytes.Repeat([]byte("X"), size)))
+	req.ContentLength = int64(size)
+
+	cap := NewCapture("tun-5", "upload", 1024)
+	cap.CaptureRequest(req)
+	assert.Equal(t, int64(size), req.ContentLength)
+
+	forwarded, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	assert.Len(t, forwarded, size, "body must not be truncated on the wire")
+	require.NoError(t, req.Body.Close())
+
+	ex, err := cap.Finalize()
+	require.NoError(t, err)
+	assert.Len(t, ex.RequestBody, 1024)
+	assert.Equal(t, int64(size), ex.RequestBodySize)
+}
+
+func TestDecodeBody(t *testing.T) {
+	h := http.Header{}
+	assert.Equal(t, []byte("raw"), decodeBody(h, []byte("raw")))
+
+	h.Set("Content-Encoding", "gzip")
+	assert.Equal(t, []byte("not gzip"), decodeBody(h, []byte("not gzip")), "invalid gzip falls back to raw bytes")
+
+	h.Set("Content-Encoding", "br")
+	assert.Equal(t, []byte("brotli"), decodeBody(h, []byte("brotli")))
+}
@@ -0,0 +1,266 @@
+package core
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mephistofox/fxtun.dev/internal/inspect"
+)
+
+const (
+	// maxDiffBodySize is the largest body diffed line by line; larger
+	// bodies are only compared for equality.
+	maxDiffBodySize = 256 * 1024
+
+	// maxDiffCells bounds the work of one line diff: the product of the
+	// line counts left after the common prefix and suffix are cut.
+	maxDiffCells = 1 << 20
+)
+
+// exchangeDiff is the JSON body of GET /api/requests/http/diff.
+type exchangeDiff struct {
+	A               string     `json:"a"`
+	B               string     `json:"b"`
+	Method          valueDiff  `json:"method"`
+	Path            valueDiff  `json:"path"`
+	Status          valueDiff  `json:"status"`
+	RequestHeaders  headerDiff `json:"request_headers"`
+	ResponseHeaders headerDiff `json:"response_headers"`
+	RequestBody     bodyDiff   `json:"request_body"`
+	ResponseBody    bodyDiff   `json:"response_body"`
+}
+
+// valueDiff compares one value of the two exchanges.
+type valueDiff struct {
+	A       any  `json:"a"`
+	B       any  `json:"b"`
+	Changed bool `json:"changed"`
+}
+
+// headerDiff lists the headers only b has (added), only a has (removed)
+// and those whose values differ (changed).
+type headerDiff struct {
+	Added   map[string][]string        `json:"added"`
+	Removed map[string][]string        `json:"removed"`
+	Changed map[string]headerValueDiff `json:"changed"`
+}
+
+type headerValueDiff struct {
+	A []string `json:"a"`
+	B []string `json:"b"`
+}
+
+// bodyDiff compares two bodies. Text bodies get a line diff; binary bodies
+// are returned base64-encoded for the caller to compare. Note says why no
+// line diff was made when there is none.
+type bodyDiff struct {
+	Identical bool       `json:"identical"`
+	Text      bool       `json:"text"`
+	Lines     []diffLine `json:"lines,omitempty"`
+	ABase64   string     `json:"a_base64,omitempty"`
+	BBase64   string     `json:"b_base64,omitempty"`
+	Note      string     `json:"note,omitempty"`
+}
+
+// diffLine is one line of a line diff: Op is " " for a line both bodies
+// have, "-" for one only a has and "+" for one only b has.
+type diffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// handleDiff compares the exchanges given by the a and b query parameters.
+func (i *Inspector) handleDiff(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	idA, idB := q.Get("a"), q.Get("b")
+	if idA == "" || idB == "" {
+		writeError(w, http.StatusBadRequest, "a and b are required")
+		return
+	}
+	a, b := i.findExchange(idA), i.findExchange(idB)
+	if a == nil || b == nil {
+		writeError(w, http.StatusNotFound, "exchange not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, diffExchanges(a, b))
+}
+
+// findExchange looks an exchange up in the buffers of all tunnels.
+func (i *Inspector) findExchange(id string) *inspect.CapturedExchange {
+	var found *inspect.CapturedExchange
+	i.manager.ForEach(func(_ string, buf *inspect.RingBuffer) {
+		if found == nil {
+			found = buf.Get(id)
+		}
+	})
+	return found
+}
+
+func diffExchanges(a, b *inspect.CapturedExchange) exchangeDiff {
+	return exchangeDiff{
+		A:               a.ID,
+		B:               b.ID,
+		Method:          valueDiff{A: a.Method, B: b.Method, Changed: a.Method != b.Method},
+		Path:            valueDiff{A: a.Path, B: b.Path, Changed: a.Path != b.Path},
+		Status:          valueDiff{A: a.StatusCode, B: b.StatusCode, Changed: a.StatusCode != b.StatusCode},
+		RequestHeaders:  diffHeaders(a.RequestHeaders, b.RequestHeaders),
+		ResponseHeaders: diffHeaders(a.ResponseHeaders, b.ResponseHeaders),
+		RequestBody:     diffBodies(a.RequestHeaders, a.RequestBody, b.RequestHeaders, b.RequestBody),
+		ResponseBody:    diffBodies(a.ResponseHeaders, a.ResponseBody, b.ResponseHeaders, b.ResponseBody),
+	}
+}
+
+func diffHeaders(a, b http.Header) headerDiff {
+	d := headerDiff{
+		Added:   map[string][]string{},
+		Removed: map[string][]string{},
+		Changed: map[string]headerValueDiff{},
+	}
+	for k, va := range a {
+		vb, ok := b[k]
+		switch {
+		case !ok:
+			d.Removed[k] = va
+		case !equalStrings(va, vb):
+			d.Changed[k] = headerValueDiff{A: va, B: vb}
+		}
+	}
+	for k, vb := range b {
+		if _, ok := a[k]; !ok {
+			d.Added[k] = vb
+		}
+	}
+	return d
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for n := range a {
+		if a[n] != b[n] {
+			return false
+		}
+	}
+	return true
+}
+
+func diffBodies(headerA http.Header, a []byte, headerB http.Header, b []byte) bodyDiff {
+	d := bodyDiff{Identical: bytes.Equal(a, b)}
+	d.Text = isTextBody(headerA, a) && isTextBody(headerB, b)
+	if !d.Text {
+		if !d.Identical {
+			d.ABase64 = base64.StdEncoding.EncodeToString(a)
+			d.BBase64 = base64.StdEncoding.EncodeToString(b)
+		}
+		return d
+	}
+	if d.Identical {
+		return d
+	}
+	if len(a) > maxDiffBodySize || len(b) > maxDiffBodySize {
+		d.Note = fmt.Sprintf("bodies larger than %d bytes are not diffed", maxDiffBodySize)
+		return d
+	}
+	lines, ok := diffTextLines(splitLines(string(a)), splitLines(string(b)))
+	if !ok {
+		d.Note = "bodies differ in too many lines to diff"
+		return d
+	}
+	d.Lines = lines
+	return d
+}
+
+// isTextBody reports whether a body is text worth a line diff: its content
+// type says so (or there is none) and it is valid UTF-8.
+func isTextBody(header http.Header, body []byte) bool {
+	if ct := header.Get("Content-Type"); ct != "" {
+		mediaType, _, err := mime.ParseMediaType(ct)
+		if err != nil || !isTextMediaType(mediaType) {
+			return false
+		}
+	}
+	return utf8.Valid(body)
+}
+
+func isTextMediaType(mediaType string) bool {
+	if strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml") {
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/xml", "application/javascript",
+		"application/x-www-form-urlencoded", "application/graphql", "application/x-ndjson":
+		return true
+	}
+	return false
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffTextLines returns a line diff of a and b based on their longest
+// common subsequence. It reports false if the lines that differ are too
+// many to diff within maxDiffCells.
+func diffTextLines(a, b []string) ([]diffLine, bool) {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if len(midA)*len(midB) > maxDiffCells {
+		return nil, false
+	}
+
+	lines := make([]diffLine, 0, len(a)+len(b)-prefix-suffix)
+	for _, l := range a[:prefix] {
+		lines = append(lines, diffLine{Op: " ", Text: l})
+	}
+
+	// lcs[x*(m+1)+y] is the LCS length of midA[x:] and midB[y:]
+	n, m := len(midA), len(midB)
+	lcs := make([]int32, (n+1)*(m+1))
+	for x := n - 1; x >= 0; x-- {
+		for y := m - 1; y >= 0; y-- {
+			if midA[x] == midB[y] {
+				lcs[x*(m+1)+y] = lcs[(x+1)*(m+1)+y+1] + 1
+			} else {
+				lcs[x*(m+1)+y] = max(lcs[(x+1)*(m+1)+y], lcs[x*(m+1)+y+1])
+			}
+		}
+	}
+	x, y := 0, 0
+	for x < n || y < m {
+		switch {
+		case x < n && y < m && midA[x] == midB[y]:
+			lines = append(lines, diffLine{Op: " ", Text: midA[x]})
+			x++
+			y++
+		case x < n && (y == m || lcs[(x+1)*(m+1)+y] >= lcs[x*(m+1)+y+1]):
+			lines = append(lines, diffLine{Op: "-", Text: midA[x]})
+			x++
+		default:
+			lines = append(lines, diffLine{Op: "+", Text: midB[y]})
+			y++
+		}
+	}
+
+	for _, l := range a[len(a)-suffix:] {
+		lines = append(lines, diffLine{Op: " ", Text: l})
+	}
+	return lines, true
+}
@@ -0,0 +1,95 @@
+package core
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspectorDiff(t *testing.T) {
+	insp := newTestInspector()
+	a := addTestExchange(insp.manager, "tun-1", "GET", "/api/items", 200)
+	b := addTestExchange(insp.manager, "tun-1", "GET", "/api/items", 500)
+	a.ResponseHeaders = http.Header{"Content-Type": {"application/json"}, "X-Cache": {"HIT"}, "Etag": {`"1"`}}
+	b.ResponseHeaders = http.Header{"Content-Type": {"application/json"}, "Etag": {`"2"`}, "Retry-After": {"5"}}
+	a.ResponseBody = []byte("{\n  \"ok\": true,\n  \"items\": 3\n}\n")
+	b.ResponseBody = []byte("{\n  \"ok\": false,\n  \"items\": 3\n}\n")
+
+	req := httptest.NewRequest("GET", "/api/requests/http/diff?a="+a.ID+"&b="+b.ID, nil)
+	rec := httptest.NewRecorder()
+	insp.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var d exchangeDiff
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &d))
+	assert.True(t, d.Status.Changed)
+	assert.False(t, d.Path.Changed)
+	assert.Equal(t, []string{"5"}, d.ResponseHeaders.Added["Retry-After"])
+	assert.Equal(t, []string{"HIT"}, d.ResponseHeaders.Removed["X-Cache"])
+	assert.Equal(t, headerValueDiff{A: []string{`"1"`}, B: []string{`"2"`}}, d.ResponseHeaders.Changed["Etag"])
+	assert.Empty(t, d.RequestHeaders.Changed)
+
+	assert.True(t, d.RequestBody.Identical)
+	assert.True(t, d.ResponseBody.Text)
+	assert.Equal(t, []diffLine{
+		{" ", "{"},
+		{"-", `  "ok": true,`},
+		{"+", `  "ok": false,`},
+		{" ", `  "items": 3`},
+		{" ", "}"},
+	}, d.ResponseBody.Lines)
+}
+
+func TestInspectorDiff_BinaryAndLargeBodies(t *testing.T) {
+	insp := newTestInspector()
+	a := addTestExchange(insp.manager, "tun-1", "GET", "/logo.png", 200)
+	b := addTestExchange(insp.manager, "tun-1", "GET", "/logo.png", 200)
+	a.ResponseHeaders = http.Header{"Content-Type": {"image/png"}}
+	b.ResponseHeaders = http.Header{"Content-Type": {"image/png"}}
+	a.ResponseBody = []byte{0x89, 'P', 'N', 'G', 1}
+	b.ResponseBody = []byte{0x89, 'P', 'N', 'G', 2}
+
+	d := diffExchanges(a, b)
+	assert.False(t, d.ResponseBody.Text)
+	assert.False(t, d.ResponseBody.Identical)
+	assert.Equal(t, "iVBORwE=", d.ResponseBody.ABase64)
+	assert.Equal(t, "iVBORwI=", d.ResponseBody.BBase64)
+
+	a.ResponseHeaders = http.Header{"Content-Type": {"text/plain"}}
+	b.ResponseHeaders = http.Header{"Content-Type": {"text/plain"}}
+	a.ResponseBody = []byte(strings.Repeat("a\n", maxDiffBodySize))
+	b.ResponseBody = []byte(strings.Repeat("b\n", maxDiffBodySize))
+	d = diffExchanges(a, b)
+	assert.True(t, d.ResponseBody.Text)
+	assert.Empty(t, d.ResponseBody.Lines)
+	assert.NotEmpty(t, d.ResponseBody.Note)
+}
+
+func TestInspectorDiff_Errors(t *testing.T) {
+	insp := newTestInspector()
+	a := addTestExchange(insp.manager, "tun-1", "GET", "/", 200)
+
+	for path, want := range map[string]int{
+		"/api/requests/http/diff?a=" + a.ID:             http.StatusBadRequest,
+		"/api/requests/http/diff?a=" + a.ID + "&b=nope": http.StatusNotFound,
+	} {
+		rec := httptest.NewRecorder()
+		insp.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, want, rec.Code, path)
+	}
+}
+
+func TestDiffTextLines(t *testing.T) {
+	lines, ok := diffTextLines([]string{"a", "b", "c"}, []string{"a", "x", "c", "d"})
+	require.True(t, ok)
+	assert.Equal(t, []diffLine{{" ", "a"}, {"-", "b"}, {"+", "x"}, {" ", "c"}, {"+", "d"}}, lines)
+
+	lines, ok = diffTextLines(nil, []string{"new"})
+	require.True(t, ok)
+	assert.Equal(t, []diffLine{{"+", "new"}}, lines)
+}
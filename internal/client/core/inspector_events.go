@@ -0,0 +1,106 @@
+package core
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// liveEventTypes are the client events streamed on /api/events: enough to
+// follow the connection and the tunnels without polling.
+var liveEventTypes = map[EventType]bool{
+	EventConnected:     true,
+	EventDisconnected:  true,
+	EventReconnecting:  true,
+	EventTunnelCreated: true,
+	EventTunnelClosed:  true,
+	EventTrafficUpdate: true,
+}
+
+const (
+	// eventStreamBuffer is how many events may wait for a slow consumer
+	// before further ones are dropped.
+	eventStreamBuffer    = 64
+	eventStreamWriteWait = 10 * time.Second
+	eventStreamPingEvery = 30 * time.Second
+)
+
+var eventStreamUpgrader = websocket.Upgrader{
+	// The inspector API answers every origin (see ServeHTTP), and so does
+	// its event stream.
+	CheckOrigin: func(*http.Request) bool { return true },
+}
+
+// SetEvents gives the inspector the client's events to stream on /api/events.
+func (i *Inspector) SetEvents(events *EventEmitter) {
+	i.events = events
+}
+
+// handleEventStream streams client events over a WebSocket, one JSON Event
+// per text message. A consumer that falls behind loses events instead of
+// holding up the client.
+func (i *Inspector) handleEventStream(w http.ResponseWriter, r *http.Request) {
+	if i.events == nil {
+		writeError(w, http.StatusServiceUnavailable, "events not available")
+		return
+	}
+
+	// Subscribe before answering, so no event after the upgrade is missed
+	ch := make(chan Event, eventStreamBuffer)
+	var dropped atomic.Int64
+	unsubscribe := i.events.Subscribe(func(e Event) {
+		if !liveEventTypes[e.Type] {
+			return
+		}
+		select {
+		case ch <- e:
+		default:
+			dropped.Add(1)
+		}
+	})
+	defer func() {
+		unsubscribe()
+		if n := dropped.Load(); n > 0 {
+			i.log.Debug().Int64("dropped", n).Msg("Event stream consumer fell behind")
+		}
+	}()
+
+	conn, err := eventStreamUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already answered the request
+		return
+	}
+	defer conn.Close()
+
+	// Nothing is expected from the consumer; reading notices when it leaves
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(eventStreamPingEvery)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-gone:
+			return
+		case e := <-ch:
+			_ = conn.SetWriteDeadline(time.Now().Add(eventStreamWriteWait))
+			if err := conn.WriteJSON(e); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(eventStreamWriteWait)); err != nil {
+				return
+			}
+		}
+	}
+}
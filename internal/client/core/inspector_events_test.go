@@ -0,0 +1,46 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspector_EventStream(t *testing.T) {
+	insp := newTestInspector()
+	events := NewEventEmitter()
+	insp.SetEvents(events)
+	srv := httptest.NewServer(insp)
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/api/events", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// The subscription is in place once the upgrade has been answered
+	events.EmitLog("info", "not streamed")
+	events.EmitWithPayload(EventTunnelCreated, map[string]interface{}{"tunnel_id": "t1"})
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+	var e Event
+	require.NoError(t, conn.ReadJSON(&e))
+	assert.Equal(t, EventTunnelCreated, e.Type)
+	assert.Equal(t, "t1", e.Payload["tunnel_id"])
+
+	events.EmitType(EventDisconnected)
+	require.NoError(t, conn.ReadJSON(&e))
+	assert.Equal(t, EventDisconnected, e.Type)
+}
+
+func TestInspector_EventStreamUnavailable(t *testing.T) {
+	insp := newTestInspector()
+	w := httptest.NewRecorder()
+	insp.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/events", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
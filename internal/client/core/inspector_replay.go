@@ -0,0 +1,218 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mephistofox/fxtun.dev/internal/inspect"
+)
+
+// Replay targets of POST /api/requests/http.
+const (
+	replayTargetLocal  = "local"  // the tunnel's local service (default)
+	replayTargetRemote = "remote" // the tunnel's public URL, through the server
+)
+
+const (
+	// defaultRemoteReplayTimeout is used when inspect.remote_replay_timeout
+	// is not set.
+	defaultRemoteReplayTimeout = time.Minute
+
+	// maxReplayTimeout caps the timeout a replay request may ask for.
+	maxReplayTimeout = 5 * time.Minute
+
+	// remoteReplayHeader marks a remote replay on its way through the
+	// tunnel, so the capture of it arriving at the local service can be
+	// told apart from visitor traffic.
+	remoteReplayHeader = "X-Fxtun-Replay"
+
+	// remoteReplayGrace is how long a replay's mark is honoured after the
+	// replay returned, for a capture that is finalized late.
+	remoteReplayGrace = 30 * time.Second
+)
+
+// newRemoteReplayClient returns the HTTP client used to replay requests
+// against public tunnel URLs. Redirects are returned as they are: following
+// them could leave the tunnel, and the replay shows what visitors get.
+func newRemoteReplayClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   10 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			ForceAttemptHTTP2:   true,
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConnsPerHost: 8,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// SetRemoteReplayTimeout sets how long a replay through the public URL may
+// take when the request does not say; d <= 0 keeps the default.
+func (i *Inspector) SetRemoteReplayTimeout(d time.Duration) {
+	if d <= 0 {
+		d = defaultRemoteReplayTimeout
+	}
+	i.remoteReplayTimeout = d
+}
+
+// SetReplayMaxBodySize sets how much of a replayed response is kept; n <= 0
+// keeps the capture limit (inspect.max_body_size).
+func (i *Inspector) SetReplayMaxBodySize(n int) {
+	if n <= 0 {
+		n = i.maxBodySize
+	}
+	i.replayMaxBodySize = n
+}
+
+// replayTimeoutFor returns the timeout of a replay request: the requested
+// one (a duration like "90s") for remote replays, otherwise the default of
+// the target.
+func (i *Inspector) replayTimeoutFor(req *replayRequest) (time.Duration, error) {
+	if req.Target != replayTargetRemote {
+		if req.Timeout != "" {
+			return 0, errors.New("timeout is only supported for remote replays")
+		}
+		return replayTimeout, nil
+	}
+	if req.Timeout == "" {
+		return i.remoteReplayTimeout, nil
+	}
+	d, err := time.ParseDuration(req.Timeout)
+	if err != nil || d <= 0 || d > maxReplayTimeout {
+		return 0, fmt.Errorf("timeout must be a positive duration of at most %s", maxReplayTimeout)
+	}
+	return d, nil
+}
+
+// resolvePublicURL returns the scheme and host a remote replay of an
+// exchange on the tunnel is sent to. host is the Host the visitor used,
+// which is a custom domain when the tunnel is served under one; HTTPS is
+// used whenever the tunnel has an HTTPS URL.
+func (i *Inspector) resolvePublicURL(tunnelID, host string) (string, error) {
+	if i.tunnelsMu == nil {
+		return "", errors.New("tunnel not found")
+	}
+	i.tunnelsMu.RLock()
+	t, ok := i.tunnels[tunnelID]
+	var public string
+	if ok {
+		public = t.HTTPSURL
+		if public == "" {
+			public = t.URL
+		}
+	}
+	i.tunnelsMu.RUnlock()
+	if !ok {
+		return "", errors.New("tunnel not found")
+	}
+	if public == "" {
+		return "", errors.New("tunnel has no public URL")
+	}
+
+	u, err := url.Parse(public)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid tunnel URL %q", public)
+	}
+	if host != "" {
+		u.Host = host
+	}
+	return u.Scheme + "://" + u.Host, nil
+}
+
+// markRemoteReplay returns a fresh value for remoteReplayHeader.
+func (i *Inspector) markRemoteReplay() string {
+	mark := generateID()
+	i.remoteReplays.Store(mark, struct{}{})
+	return mark
+}
+
+// unmarkRemoteReplay forgets mark after remoteReplayGrace.
+func (i *Inspector) unmarkRemoteReplay(mark string) {
+	time.AfterFunc(remoteReplayGrace, func() { i.remoteReplays.Delete(mark) })
+}
+
+// isRemoteReplay reports whether ex is a remote replay passing through the
+// local service; the replay records its own exchange with the response the
+// public URL gave.
+func (i *Inspector) isRemoteReplay(ex *inspect.CapturedExchange) bool {
+	mark := ex.RequestHeaders.Get(remoteReplayHeader)
+	if mark == "" {
+		return false
+	}
+	_, ok := i.remoteReplays.Load(mark)
+	return ok
+}
+
+// replayContentType returns the Content-Type a replay is sent with: the
+// override among headers, else the original one with its boundary intact.
+// A multipart body must parse with the boundary it is sent with; when an
+// override leaves the boundary out, it is taken from the body.
+func replayContentType(original string, headers map[string]string, body []byte) (string, error) {
+	contentType := original
+	for k, v := range headers {
+		if strings.EqualFold(k, "Content-Type") {
+			contentType = v
+		}
+	}
+	if !isMultipart(contentType) {
+		return contentType, nil
+	}
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", fmt.Errorf("invalid Content-Type: %v", err)
+	}
+	if params["boundary"] == "" {
+		boundary := bodyBoundary(body)
+		if boundary == "" {
+			return "", errors.New("multipart Content-Type has no boundary and the body does not start with one")
+		}
+		params["boundary"] = boundary
+		contentType = mime.FormatMediaType(mediaType, params)
+	}
+
+	mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return contentType, nil
+		}
+		if err == nil {
+			_, err = io.Copy(io.Discard, part)
+		}
+		if err != nil {
+			return "", fmt.Errorf("invalid multipart body: %v", err)
+		}
+	}
+}
+
+// isMultipart reports whether contentType is a multipart/* media type.
+func isMultipart(contentType string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(contentType)), "multipart/")
+}
+
+// bodyBoundary returns the boundary a multipart body opens with, or "".
+func bodyBoundary(body []byte) string {
+	line, _, _ := bufio.NewReader(bytes.NewReader(body)).ReadLine()
+	if !bytes.HasPrefix(line, []byte("--")) {
+		return ""
+	}
+	return strings.TrimSpace(string(line[2:]))
+}
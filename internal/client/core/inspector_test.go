@@ -1,9 +1,20 @@
 package core
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -11,7 +22,9 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/mephistofox/fxtun.dev/internal/config"
 	"github.com/mephistofox/fxtun.dev/internal/inspect"
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
 )
 
 func newTestInspector() *Inspector {
@@ -140,6 +153,30 @@ func TestInspectorSummary(t *testing.T) {
 	assert.NotNil(t, resp.LastRequestAt)
 }
 
+func TestInspectorCaptureErrorsOnly(t *testing.T) {
+	insp := newTestInspector()
+	insp.manager.SetCaptureMode("tun-1", inspect.CaptureErrors)
+	for j := 0; j < 100; j++ {
+		status := 200
+		if j%10 == 0 {
+			status = 503
+		}
+		insp.AddExchange(&inspect.CapturedExchange{
+			ID: generateID(), TunnelID: "tun-1", Timestamp: time.Now(), Method: "GET", Path: "/", StatusCode: status,
+		})
+	}
+
+	req := httptest.NewRequest("GET", "/api/requests/http/summary", nil)
+	rec := httptest.NewRecorder()
+	insp.ServeHTTP(rec, req)
+
+	var resp summaryResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, 10, resp.Total)
+	assert.Equal(t, 10, resp.ByStatus["5xx"])
+	assert.Equal(t, 0, resp.ByStatus["2xx"])
+}
+
 func TestInspectorFilterByMethod(t *testing.T) {
 	insp := newTestInspector()
 	addTestExchange(insp.manager, "tun-1", "GET", "/a", 200)
@@ -230,6 +267,40 @@ func TestInspectorListTunnels(t *testing.T) {
 	assert.Empty(t, resp.Tunnels)
 }
 
+func TestInspectorListTunnelsStats(t *testing.T) {
+	insp := newTestInspector()
+	tunnel := &ActiveTunnel{ID: "tun-1", Config: config.TunnelConfig{Name: "web", Type: "http", LocalPort: 3000}}
+	tunnel.Requests.Add(3)
+	tunnel.ActiveConns.Add(1)
+	var mu sync.RWMutex
+	insp.SetTunnels(map[string]*ActiveTunnel{"tun-1": tunnel}, &mu)
+	addTestExchange(insp.manager, "tun-1", "GET", "/", 200)
+	addTestExchange(insp.manager, "tun-1", "GET", "/missing", 404)
+
+	req := httptest.NewRequest("GET", "/api/tunnels", nil)
+	rec := httptest.NewRecorder()
+	insp.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp struct {
+		Tunnels []struct {
+			Name        string `json:"name"`
+			Requests    int64  `json:"requests"`
+			ActiveConns int64  `json:"active_conns"`
+			Captured    int    `json:"captured"`
+			Errors      int    `json:"errors"`
+		} `json:"tunnels"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Len(t, resp.Tunnels, 1)
+	got := resp.Tunnels[0]
+	assert.Equal(t, "web", got.Name)
+	assert.Equal(t, int64(3), got.Requests)
+	assert.Equal(t, int64(1), got.ActiveConns)
+	assert.Equal(t, 2, got.Captured)
+	assert.Equal(t, 1, got.Errors)
+}
+
 func TestInspectorFilterByExactStatus(t *testing.T) {
 	insp := newTestInspector()
 	addTestExchange(insp.manager, "tun-1", "GET", "/a", 200)
@@ -266,6 +337,54 @@ func TestInspectorPagination(t *testing.T) {
 	assert.Len(t, resp.Requests, 3)
 }
 
+func TestInspectorPaginationAcrossTunnels(t *testing.T) {
+	insp := newTestInspector()
+	base := time.Now()
+	var ids []string // newest first
+	for j := 0; j < 30; j++ {
+		tunnel := "tun-" + strconv.Itoa(j%3)
+		ex := addTestExchange(insp.manager, tunnel, "GET", "/page", 200)
+		ex.Timestamp = base.Add(time.Duration(j) * time.Second)
+		ids = append([]string{ex.ID}, ids...)
+	}
+
+	req := httptest.NewRequest("GET", "/api/requests/http?limit=5&offset=4", nil)
+	rec := httptest.NewRecorder()
+	insp.ServeHTTP(rec, req)
+
+	var resp struct {
+		Requests []exchangeListItem `json:"requests"`
+		Total    int                `json:"total"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, 30, resp.Total)
+	require.Len(t, resp.Requests, 5)
+	for j, item := range resp.Requests {
+		assert.Equal(t, ids[4+j], item.ID)
+	}
+}
+
+func TestInspectorQueryLimit(t *testing.T) {
+	insp := newTestInspector()
+	insp.SetMaxConcurrentQueries(1)
+	addTestExchange(insp.manager, "tun-1", "GET", "/", 200)
+
+	// Hold the only slot; a request whose client gives up is turned away.
+	insp.querySlots <- struct{}{}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req := httptest.NewRequest("GET", "/api/requests/http/summary", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	insp.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	// Once the slot is free the request is served.
+	<-insp.querySlots
+	rec = httptest.NewRecorder()
+	insp.ServeHTTP(rec, httptest.NewRequest("GET", "/api/requests/http/summary", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
 func TestMatchStatus(t *testing.T) {
 	tests := []struct {
 		code   int
@@ -289,3 +408,286 @@ func TestMatchStatus(t *testing.T) {
 		assert.Equal(t, tt.want, got, "matchStatus(%d, %q)", tt.code, tt.filter)
 	}
 }
+
+func TestInspectorReplayReusesConnections(t *testing.T) {
+	var newConns atomic.Int32
+	local := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Larger than the capture limit so the replay has to drain the rest.
+		_, _ = w.Write([]byte(strings.Repeat("x", 64)))
+	}))
+	local.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			newConns.Add(1)
+		}
+	}
+	local.Start()
+	defer local.Close()
+
+	_, portStr, err := net.SplitHostPort(local.Listener.Addr().String())
+	require.NoError(t, err)
+	port, err := strconv.Atoi(portStr)
+	require.NoError(t, err)
+
+	mgr := inspect.NewManager(1000, 262144)
+	insp := NewInspector(mgr, "127.0.0.1:0", 16, zerolog.Nop())
+	defer func() { _ = insp.Stop() }()
+	var mu sync.RWMutex
+	insp.SetTunnels(map[string]*ActiveTunnel{
+		"tun-1": {ID: "tun-1", Config: config.TunnelConfig{LocalAddr: "127.0.0.1", LocalPort: port}},
+	}, &mu)
+	ex := addTestExchange(mgr, "tun-1", "GET", "/", 200)
+
+	for n := 0; n < 100; n++ {
+		req := httptest.NewRequest("POST", "/api/requests/http", strings.NewReader(`{"id":"`+ex.ID+`"}`))
+		rec := httptest.NewRecorder()
+		insp.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	assert.Equal(t, int32(1), newConns.Load())
+}
+
+func TestInspectorReplayTruncated(t *testing.T) {
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.Repeat("x", 64)))
+	}))
+	defer local.Close()
+	_, portStr, err := net.SplitHostPort(local.Listener.Addr().String())
+	require.NoError(t, err)
+	port, err := strconv.Atoi(portStr)
+	require.NoError(t, err)
+
+	mgr := inspect.NewManager(1000, 262144)
+	insp := NewInspector(mgr, "127.0.0.1:0", 262144, zerolog.Nop())
+	var mu sync.RWMutex
+	insp.SetTunnels(map[string]*ActiveTunnel{
+		"tun-1": {ID: "tun-1", Config: config.TunnelConfig{LocalAddr: "127.0.0.1", LocalPort: port}},
+	}, &mu)
+	ex := addTestExchange(mgr, "tun-1", "GET", "/", 200)
+
+	replay := func() (bool, *inspect.CapturedExchange) {
+		req := httptest.NewRequest("POST", "/api/requests/http", strings.NewReader(`{"id":"`+ex.ID+`"}`))
+		rec := httptest.NewRecorder()
+		insp.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var resp struct {
+			ExchangeID string `json:"exchange_id"`
+			Truncated  bool   `json:"truncated"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		return resp.Truncated, mgr.Get("tun-1").Get(resp.ExchangeID)
+	}
+
+	truncated, stored := replay()
+	assert.False(t, truncated)
+	require.NotNil(t, stored)
+	assert.False(t, stored.ResponseTruncated)
+	assert.Len(t, stored.ResponseBody, 64)
+
+	insp.SetReplayMaxBodySize(16)
+	truncated, stored = replay()
+	assert.True(t, truncated)
+	require.NotNil(t, stored)
+	assert.True(t, stored.ResponseTruncated)
+	assert.Len(t, stored.ResponseBody, 16)
+	assert.Equal(t, int64(64), stored.ResponseBodySize, "the size the service sent")
+
+	insp.SetReplayMaxBodySize(64)
+	truncated, _ = replay()
+	assert.False(t, truncated, "a body of exactly the limit is complete")
+}
+
+func TestInspectorReplayMultipart(t *testing.T) {
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file, header, err := r.FormFile("upload")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		data, _ := io.ReadAll(file)
+		_, _ = fmt.Fprintf(w, "%s=%s", header.Filename, data)
+	}))
+	defer local.Close()
+	_, portStr, err := net.SplitHostPort(local.Listener.Addr().String())
+	require.NoError(t, err)
+	port, err := strconv.Atoi(portStr)
+	require.NoError(t, err)
+
+	insp := newTestInspector()
+	var mu sync.RWMutex
+	insp.SetTunnels(map[string]*ActiveTunnel{
+		"tun-1": {ID: "tun-1", Config: config.TunnelConfig{LocalAddr: "127.0.0.1", LocalPort: port}},
+	}, &mu)
+
+	var upload bytes.Buffer
+	mw := multipart.NewWriter(&upload)
+	fw, err := mw.CreateFormFile("upload", "report.csv")
+	require.NoError(t, err)
+	_, _ = fw.Write([]byte("a,b\r\n1,2\r\n"))
+	require.NoError(t, mw.Close())
+
+	ex := addTestExchange(insp.manager, "tun-1", "POST", "/upload", 200)
+	ex.RequestHeaders = http.Header{"Content-Type": {mw.FormDataContentType()}}
+	ex.RequestBody = upload.Bytes()
+	ex.RequestBodySize = int64(upload.Len())
+
+	replay := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/requests/http", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		insp.ServeHTTP(rec, req)
+		return rec
+	}
+	responseBody := func(rec *httptest.ResponseRecorder) string {
+		var resp struct {
+			StatusCode   int    `json:"status_code"`
+			ResponseBody []byte `json:"response_body"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, http.StatusOK, resp.StatusCode, string(resp.ResponseBody))
+		return string(resp.ResponseBody)
+	}
+
+	rec := replay(`{"id":"` + ex.ID + `"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, "report.csv=a,b\r\n1,2\r\n", responseBody(rec))
+
+	// An edited body under a Content-Type without the boundary
+	edited := strings.Replace(upload.String(), "1,2", "3,4", 1)
+	rec = replay(`{"id":"` + ex.ID + `","body":"` + base64.StdEncoding.EncodeToString([]byte(edited)) +
+		`","headers":{"content-type":"multipart/form-data"}}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, "report.csv=a,b\r\n3,4\r\n", responseBody(rec))
+
+	broken := strings.TrimSuffix(upload.String(), "--\r\n")
+	rec = replay(`{"id":"` + ex.ID + `","body":"` + base64.StdEncoding.EncodeToString([]byte(broken)) + `"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "invalid multipart body")
+
+	// The capture kept only part of the upload
+	ex.RequestBodySize = int64(upload.Len()) * 10
+	rec = replay(`{"id":"` + ex.ID + `"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "incomplete")
+}
+
+func TestInspectorReplayRemote(t *testing.T) {
+	mgr := inspect.NewManager(1000, 262144)
+	insp := NewInspector(mgr, "127.0.0.1:0", 262144, zerolog.Nop())
+
+	// The public side of the tunnel: the request passes the local service,
+	// whose capture must not show up next to the replay's own exchange.
+	public := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		insp.AddExchange(&inspect.CapturedExchange{
+			ID:             generateID(),
+			TunnelID:       "tun-1",
+			Method:         r.Method,
+			Path:           r.URL.RequestURI(),
+			StatusCode:     http.StatusOK,
+			RequestHeaders: r.Header,
+		})
+		w.Header().Set("X-Served-By", "edge")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer public.Close()
+	insp.remoteReplayClient = public.Client()
+
+	var mu sync.RWMutex
+	insp.SetTunnels(map[string]*ActiveTunnel{
+		"tun-1": {ID: "tun-1", URL: "http://app.test.local", HTTPSURL: "https://app.test.local"},
+	}, &mu)
+	ex := addTestExchange(mgr, "tun-1", "POST", "/api/v1/users?x=1", 201)
+	// As if the visitor came in through a custom domain
+	ex.Host = public.Listener.Addr().String()
+
+	req := httptest.NewRequest("POST", "/api/requests/http",
+		strings.NewReader(`{"id":"`+ex.ID+`","target":"remote","timeout":"90s"}`))
+	rec := httptest.NewRecorder()
+	insp.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var resp struct {
+		StatusCode int    `json:"status_code"`
+		ExchangeID string `json:"exchange_id"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	buf := mgr.Get("tun-1")
+	assert.Equal(t, 2, buf.Len(), "original and replay only")
+	replay := buf.Get(resp.ExchangeID)
+	require.NotNil(t, replay)
+	assert.Equal(t, ex.ID, replay.ReplayRef)
+	assert.Equal(t, "/api/v1/users?x=1", replay.Path)
+	assert.Equal(t, "edge", replay.ResponseHeaders.Get("X-Served-By"))
+}
+
+func TestInspectorReplayRejectsBadTarget(t *testing.T) {
+	insp := newTestInspector()
+	ex := addTestExchange(insp.manager, "tun-1", "GET", "/", 200)
+
+	for _, body := range []string{
+		`{"id":"` + ex.ID + `","target":"elsewhere"}`,
+		`{"id":"` + ex.ID + `","timeout":"90s"}`,
+		`{"id":"` + ex.ID + `","target":"remote","timeout":"1h"}`,
+	} {
+		req := httptest.NewRequest("POST", "/api/requests/http", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		insp.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+	}
+}
+
+func TestInspectorResolvePublicURL(t *testing.T) {
+	insp := newTestInspector()
+	var mu sync.RWMutex
+	insp.SetTunnels(map[string]*ActiveTunnel{
+		"both":  {ID: "both", URL: "http://a.test.local", HTTPSURL: "https://a.test.local"},
+		"plain": {ID: "plain", URL: "http://b.test.local:8080"},
+	}, &mu)
+
+	got, err := insp.resolvePublicURL("both", "")
+	require.NoError(t, err)
+	assert.Equal(t, "https://a.test.local", got)
+
+	got, err = insp.resolvePublicURL("both", "shop.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "https://shop.example.com", got, "custom domain")
+
+	got, err = insp.resolvePublicURL("plain", "")
+	require.NoError(t, err)
+	assert.Equal(t, "http://b.test.local:8080", got)
+
+	_, err = insp.resolvePublicURL("missing", "")
+	assert.Error(t, err)
+}
+
+func TestInspectorTunnelURL(t *testing.T) {
+	insp := newTestInspector()
+	assert.Empty(t, insp.TunnelURL("t1"), "no link before the inspector listens")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, insp.Start(ctx))
+	defer insp.Stop()
+
+	assert.Equal(t, "http://"+insp.Addr()+"/?tunnel=a+b%26c", insp.TunnelURL("a b&c"))
+}
+
+func TestActivateTunnelInspectURL(t *testing.T) {
+	c := newTestClient("127.0.0.1:1", "")
+	defer c.Close()
+	c.inspector = newTestInspector()
+	require.NoError(t, c.inspector.Start(c.ctx))
+	defer c.inspector.Stop()
+
+	c.activateTunnel(config.TunnelConfig{Name: "web", Type: "http", LocalAddr: "127.0.0.1", LocalPort: 3000},
+		&protocol.TunnelCreatedMessage{TunnelID: "http-1", URL: "http://web.test.local"})
+	c.activateTunnel(config.TunnelConfig{Name: "db", Type: "tcp", LocalAddr: "127.0.0.1", LocalPort: 5432},
+		&protocol.TunnelCreatedMessage{TunnelID: "tcp-1", RemoteAddr: "test.local:30001"})
+
+	c.tunnelsMu.RLock()
+	defer c.tunnelsMu.RUnlock()
+	assert.Equal(t, c.inspector.TunnelURL("http-1"), c.tunnels["http-1"].InspectURL)
+	assert.Empty(t, c.tunnels["tcp-1"].InspectURL, "only HTTP tunnels are inspected")
+}
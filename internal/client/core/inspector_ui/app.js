@@ -6,7 +6,7 @@
 var exchanges = [];
 var selectedId = null;
 var selectedDetail = null;
-var filters = { method: '', status: '', path: '' };
+var filters = { method: '', status: '', path: '', tunnel: tunnelFromURL() };
 var locale = detectLocale();
 var darkMode = detectTheme();
 var eventSource = null;
@@ -276,8 +276,13 @@ function backgroundSync() {
 }
 
 // --------------- Rendering: List ---------------
+function tunnelFromURL() {
+    return new URLSearchParams(window.location.search).get('tunnel') || '';
+}
+
 function getFilteredExchanges() {
     return exchanges.filter(function(ex) {
+        if (filters.tunnel && ex.tunnel_id !== filters.tunnel) return false;
         if (filters.method && ex.method !== filters.method) return false;
         if (filters.status) {
             if (!matchStatusFilter(ex.status_code, filters.status)) return false;
@@ -0,0 +1,70 @@
+package core
+
+// localUnreachableThreshold is the number of consecutive failed connects to
+// a tunnel's local service after which it is reported as unreachable.
+const localUnreachableThreshold = 5
+
+// recordDialFailure counts a failed connect to the local service. It reports
+// true for the failure that makes the service count as unreachable.
+func (t *ActiveTunnel) recordDialFailure() bool {
+	t.DialFailures.Add(1)
+	n := t.ConsecutiveDialFailures.Add(1)
+	return n >= localUnreachableThreshold && t.localUnreachable.CompareAndSwap(false, true)
+}
+
+// recordDialSuccess resets the consecutive failures. It reports true when the
+// local service counted as unreachable until now.
+func (t *ActiveTunnel) recordDialSuccess() bool {
+	if t.ConsecutiveDialFailures.Load() != 0 {
+		t.ConsecutiveDialFailures.Store(0)
+	}
+	return t.localUnreachable.CompareAndSwap(true, false)
+}
+
+// LocalUnreachable reports whether the last localUnreachableThreshold or more
+// connects to the tunnel's local service all failed.
+func (t *ActiveTunnel) LocalUnreachable() bool {
+	return t.localUnreachable.Load()
+}
+
+// localDialFailed records a failed connect to the tunnel's local service and
+// emits EventLocalUnreachable once the failures cross the threshold.
+func (c *Client) localDialFailed(tunnel *ActiveTunnel, err error) {
+	if !tunnel.recordDialFailure() {
+		return
+	}
+	c.log.Warn().
+		Err(err).
+		Str("tunnel_id", tunnel.ID).
+		Str("name", tunnel.Config.Name).
+		Str("event", string(EventLocalUnreachable)).
+		Int("port", tunnel.Config.LocalPort).
+		Int64("consecutive_failures", tunnel.ConsecutiveDialFailures.Load()).
+		Msg("Local service appears to be down")
+	c.events.EmitWithPayload(EventLocalUnreachable, map[string]interface{}{
+		"tunnel_id":            tunnel.ID,
+		"name":                 tunnel.Config.Name,
+		"local_port":           tunnel.Config.LocalPort,
+		"consecutive_failures": tunnel.ConsecutiveDialFailures.Load(),
+		"error":                err.Error(),
+	})
+}
+
+// localDialSucceeded records a successful connect to the tunnel's local
+// service and emits EventLocalRecovered if it was unreachable.
+func (c *Client) localDialSucceeded(tunnel *ActiveTunnel) {
+	if !tunnel.recordDialSuccess() {
+		return
+	}
+	c.log.Info().
+		Str("tunnel_id", tunnel.ID).
+		Str("name", tunnel.Config.Name).
+		Str("event", string(EventLocalRecovered)).
+		Int("port", tunnel.Config.LocalPort).
+		Msg("Local service is reachable again")
+	c.events.EmitWithPayload(EventLocalRecovered, map[string]interface{}{
+		"tunnel_id":  tunnel.ID,
+		"name":       tunnel.Config.Name,
+		"local_port": tunnel.Config.LocalPort,
+	})
+}
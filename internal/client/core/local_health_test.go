@@ -0,0 +1,64 @@
+package core
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+)
+
+func TestActiveTunnel_DialFailureThreshold(t *testing.T) {
+	tunnel := &ActiveTunnel{ID: "t1"}
+
+	for i := 1; i < localUnreachableThreshold; i++ {
+		assert.False(t, tunnel.recordDialFailure(), "failure %d", i)
+	}
+	assert.False(t, tunnel.LocalUnreachable())
+
+	assert.True(t, tunnel.recordDialFailure(), "the threshold is crossed")
+	assert.True(t, tunnel.LocalUnreachable())
+	assert.False(t, tunnel.recordDialFailure(), "reported only once")
+	assert.Equal(t, int64(localUnreachableThreshold+1), tunnel.ConsecutiveDialFailures.Load())
+
+	assert.True(t, tunnel.recordDialSuccess(), "recovery is reported")
+	assert.False(t, tunnel.LocalUnreachable())
+	assert.Zero(t, tunnel.ConsecutiveDialFailures.Load())
+	assert.Equal(t, int64(localUnreachableThreshold+1), tunnel.DialFailures.Load(), "the total is kept")
+	assert.False(t, tunnel.recordDialSuccess())
+}
+
+func TestClient_LocalUnreachableEvent(t *testing.T) {
+	c := New(&config.ClientConfig{}, zerolog.Nop())
+	events := make(chan Event, 4)
+	c.Events().Subscribe(func(e Event) { events <- e })
+
+	tunnel := &ActiveTunnel{ID: "t1", Config: config.TunnelConfig{Name: "web", LocalPort: 3000}}
+	refused := errors.New("connection refused")
+	for i := 0; i < localUnreachableThreshold; i++ {
+		c.localDialFailed(tunnel, refused)
+	}
+
+	select {
+	case e := <-events:
+		require.Equal(t, EventLocalUnreachable, e.Type)
+		assert.Equal(t, "web", e.Payload["name"])
+		assert.Equal(t, 3000, e.Payload["local_port"])
+		assert.Equal(t, int64(localUnreachableThreshold), e.Payload["consecutive_failures"])
+		assert.Equal(t, "connection refused", e.Payload["error"])
+	case <-time.After(time.Second):
+		t.Fatal("no local_unreachable event")
+	}
+
+	c.localDialSucceeded(tunnel)
+	select {
+	case e := <-events:
+		assert.Equal(t, EventLocalRecovered, e.Type)
+	case <-time.After(time.Second):
+		t.Fatal("no local_recovered event")
+	}
+}
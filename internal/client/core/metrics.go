@@ -0,0 +1,136 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	reconnectsDesc = prometheus.NewDesc(
+		"fxtunnel_client_reconnects_total",
+		"Successful reconnects and session resumes after losing the server connection",
+		nil, nil)
+	tunnelBytesDesc = prometheus.NewDesc(
+		"fxtunnel_client_tunnel_bytes_total",
+		"Bytes carried by an active tunnel; direction sent is local service to server",
+		[]string{"tunnel_id", "name", "type", "direction"}, nil)
+	activeConnsDesc = prometheus.NewDesc(
+		"fxtunnel_client_tunnel_active_connections",
+		"Connections currently proxied to the tunnel's local service",
+		[]string{"tunnel_id", "name", "type"}, nil)
+	dialFailuresDesc = prometheus.NewDesc(
+		"fxtunnel_client_local_dial_failures_total",
+		"Failed attempts to connect to the tunnel's local service",
+		[]string{"tunnel_id", "name", "type"}, nil)
+	localUnreachableDesc = prometheus.NewDesc(
+		"fxtunnel_client_local_unreachable",
+		"1 while the last connects to the tunnel's local service all failed",
+		[]string{"tunnel_id", "name", "type"}, nil)
+)
+
+// metricsCollector reads the client's tunnels on every scrape, so closed
+// tunnels drop out of the per-tunnel series.
+type metricsCollector struct {
+	c *Client
+}
+
+// MetricsCollector returns a Prometheus collector for the client: reconnects
+// and, per active tunnel, traffic, open local connections, failed local
+// dials and whether the local service is unreachable.
+func (c *Client) MetricsCollector() prometheus.Collector {
+	return &metricsCollector{c: c}
+}
+
+func (m *metricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- reconnectsDesc
+	ch <- tunnelBytesDesc
+	ch <- activeConnsDesc
+	ch <- dialFailuresDesc
+	ch <- localUnreachableDesc
+}
+
+func (m *metricsCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(reconnectsDesc, prometheus.CounterValue, float64(m.c.reconnects.Load()))
+
+	m.c.tunnelsMu.RLock()
+	defer m.c.tunnelsMu.RUnlock()
+	for _, t := range m.c.tunnels {
+		id, name, typ := t.ID, t.Config.Name, t.Config.Type
+		ch <- prometheus.MustNewConstMetric(tunnelBytesDesc, prometheus.CounterValue,
+			float64(t.BytesSent.Load()), id, name, typ, "sent")
+		ch <- prometheus.MustNewConstMetric(tunnelBytesDesc, prometheus.CounterValue,
+			float64(t.BytesReceived.Load()), id, name, typ, "received")
+		ch <- prometheus.MustNewConstMetric(activeConnsDesc, prometheus.GaugeValue,
+			float64(t.ActiveConns.Load()), id, name, typ)
+		ch <- prometheus.MustNewConstMetric(dialFailuresDesc, prometheus.CounterValue,
+			float64(t.DialFailures.Load()), id, name, typ)
+		var unreachable float64
+		if t.LocalUnreachable() {
+			unreachable = 1
+		}
+		ch <- prometheus.MustNewConstMetric(localUnreachableDesc, prometheus.GaugeValue,
+			unreachable, id, name, typ)
+	}
+}
+
+// metricsHandler serves the client's metrics from a private registry, so the
+// endpoint carries no process-wide metrics of an embedding application.
+func (c *Client) metricsHandler() http.Handler {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c.MetricsCollector())
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+}
+
+// startMetricsServer starts the standalone /metrics listener when metrics
+// are enabled with their own address. It runs once per client and survives
+// reconnects; with no address the inspector serves /metrics instead.
+func (c *Client) startMetricsServer() error {
+	if !c.cfg.Metrics.Enabled || c.cfg.Metrics.Addr == "" || c.metricsServer != nil {
+		return nil
+	}
+
+	ln, err := net.Listen("tcp", c.cfg.Metrics.Addr)
+	if err != nil {
+		return fmt.Errorf("listen metrics on %s: %w", c.cfg.Metrics.Addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", c.metricsHandler())
+	c.metricsServer = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	c.metricsAddr = ln.Addr().String()
+
+	c.log.Info().Str("addr", c.metricsAddr).Msg("Metrics endpoint started")
+
+	go func(srv *http.Server) {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			c.log.Error().Err(err).Msg("Metrics server error")
+		}
+	}(c.metricsServer)
+
+	return nil
+}
+
+// stopMetricsServer shuts down the standalone /metrics listener, if any.
+func (c *Client) stopMetricsServer() {
+	if c.metricsServer == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = c.metricsServer.Shutdown(ctx)
+}
+
+// MetricsAddr returns the address of the standalone metrics listener, or
+// empty if metrics are served by the inspector or disabled.
+func (c *Client) MetricsAddr() string {
+	return c.metricsAddr
+}
@@ -0,0 +1,79 @@
+package core
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+)
+
+func TestMetricsCollector(t *testing.T) {
+	c := New(&config.ClientConfig{}, zerolog.Nop())
+	c.reconnects.Add(2)
+
+	tunnel := &ActiveTunnel{ID: "t1", Config: config.TunnelConfig{Name: "web", Type: "http"}}
+	tunnel.BytesSent.Add(300)
+	tunnel.BytesReceived.Add(100)
+	tunnel.ActiveConns.Add(1)
+	tunnel.DialFailures.Add(4)
+	c.tunnels["t1"] = tunnel
+
+	expected := `
+# HELP fxtunnel_client_local_dial_failures_total Failed attempts to connect to the tunnel's local service
+# TYPE fxtunnel_client_local_dial_failures_total counter
+fxtunnel_client_local_dial_failures_total{name="web",tunnel_id="t1",type="http"} 4
+# HELP fxtunnel_client_local_unreachable 1 while the last connects to the tunnel's local service all failed
+# TYPE fxtunnel_client_local_unreachable gauge
+fxtunnel_client_local_unreachable{name="web",tunnel_id="t1",type="http"} 0
+# HELP fxtunnel_client_reconnects_total Successful reconnects and session resumes after losing the server connection
+# TYPE fxtunnel_client_reconnects_total counter
+fxtunnel_client_reconnects_total 2
+# HELP fxtunnel_client_tunnel_active_connections Connections currently proxied to the tunnel's local service
+# TYPE fxtunnel_client_tunnel_active_connections gauge
+fxtunnel_client_tunnel_active_connections{name="web",tunnel_id="t1",type="http"} 1
+# HELP fxtunnel_client_tunnel_bytes_total Bytes carried by an active tunnel; direction sent is local service to server
+# TYPE fxtunnel_client_tunnel_bytes_total counter
+fxtunnel_client_tunnel_bytes_total{direction="received",name="web",tunnel_id="t1",type="http"} 100
+fxtunnel_client_tunnel_bytes_total{direction="sent",name="web",tunnel_id="t1",type="http"} 300
+`
+	assert.NoError(t, testutil.CollectAndCompare(c.MetricsCollector(), strings.NewReader(expected)))
+}
+
+func TestInspectorServesMetrics(t *testing.T) {
+	c := New(&config.ClientConfig{}, zerolog.Nop())
+	c.reconnects.Add(1)
+
+	i := NewInspector(nil, "127.0.0.1:0", 0, zerolog.Nop())
+	i.HandleMetrics(c.metricsHandler())
+
+	rec := httptest.NewRecorder()
+	i.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	body, err := io.ReadAll(rec.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "fxtunnel_client_reconnects_total 1")
+}
+
+func TestStartMetricsServer(t *testing.T) {
+	c := New(&config.ClientConfig{
+		Metrics: config.MetricsSettings{Enabled: true, Addr: "127.0.0.1:0"},
+	}, zerolog.Nop())
+	require.NoError(t, c.startMetricsServer())
+	defer c.stopMetricsServer()
+
+	resp, err := http.Get("http://" + c.MetricsAddr() + "/metrics")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "fxtunnel_client_reconnects_total 0")
+}
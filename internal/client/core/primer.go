@@ -0,0 +1,124 @@
+package core
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// primerTTL is how long pre-warmed local connections wait to be used. Some
+// services drop connections that stay silent (MySQL's connect_timeout is 10s
+// by default), so leftovers are closed well before that.
+const primerTTL = 5 * time.Second
+
+// localPrimer holds connections to a tunnel's local service that were dialed
+// ahead of time, so the first burst of streams after the tunnel is created
+// skips the dial. It is filled once and never refilled: steady traffic is
+// served by regular dials.
+type localPrimer struct {
+	mu     sync.Mutex
+	conns  []net.Conn
+	closed bool
+	timer  *time.Timer
+}
+
+// newLocalPrimer dials n connections in the background and closes any still
+// unused after ttl.
+func newLocalPrimer(n int, ttl time.Duration, dial func() (net.Conn, error)) *localPrimer {
+	p := &localPrimer{}
+	p.mu.Lock()
+	p.timer = time.AfterFunc(ttl, p.close)
+	p.mu.Unlock()
+	for i := 0; i < n; i++ {
+		go func() {
+			conn, err := dial()
+			if err != nil {
+				return
+			}
+			p.put(conn)
+		}()
+	}
+	return p
+}
+
+func (p *localPrimer) put(conn net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		conn.Close()
+		return
+	}
+	p.conns = append(p.conns, conn)
+}
+
+// take returns a pre-warmed connection, or nil when none is left.
+func (p *localPrimer) take() net.Conn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.conns) == 0 {
+		return nil
+	}
+	conn := p.conns[len(p.conns)-1]
+	p.conns = p.conns[:len(p.conns)-1]
+	return conn
+}
+
+// close closes the unused connections. Connections that finish dialing
+// afterwards are closed as they arrive.
+func (p *localPrimer) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	p.closed = true
+	p.timer.Stop()
+	for _, conn := range p.conns {
+		conn.Close()
+	}
+	p.conns = nil
+}
+
+// dialLocal connects to the tunnel's local service, preferring a connection
+// pre-warmed when the tunnel was created.
+func (c *Client) dialLocal(tunnel *ActiveTunnel) (net.Conn, error) {
+	if tunnel.primer != nil {
+		if conn := tunnel.primer.take(); conn != nil {
+			return conn, nil
+		}
+	}
+	return c.dialLocalService(tunnel)
+}
+
+// dialLocalService opens a new connection to the tunnel's local service,
+// through its SSH bastion if it has one.
+func (c *Client) dialLocalService(tunnel *ActiveTunnel) (net.Conn, error) {
+	if tunnel.ssh != nil {
+		host := tunnel.Config.LocalAddr
+		if host == "" {
+			host = "localhost"
+		}
+		return tunnel.ssh.dial(net.JoinHostPort(host, strconv.Itoa(tunnel.Config.LocalPort)), localDialTimeout)
+	}
+	return dialLocalWithFallback(c.log, tunnel.Config.LocalAddr, tunnel.Config.LocalPort, localDialTimeout)
+}
+
+// closePrimer closes the unused pre-warmed connections of a tunnel.
+func (t *ActiveTunnel) closePrimer() {
+	if t.primer != nil {
+		t.primer.close()
+	}
+}
+
+// closeLocal closes what the tunnel keeps open towards its local service:
+// pre-warmed connections, the SSH bastion connection and the SOCKS5 proxy.
+func (t *ActiveTunnel) closeLocal() {
+	t.closePrimer()
+	if t.ssh != nil {
+		t.ssh.close()
+	}
+	if t.socks != nil {
+		t.socks.Close()
+	}
+}
@@ -0,0 +1,103 @@
+package core
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+)
+
+// acceptCounter accepts connections on a local listener and reports each one.
+func acceptCounter(t *testing.T) (net.Listener, <-chan net.Conn) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	accepted := make(chan net.Conn, 16)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+			accepted <- conn
+		}
+	}()
+	return ln, accepted
+}
+
+func TestLocalPrimer_ServesPrewarmedConns(t *testing.T) {
+	ln, accepted := acceptCounter(t)
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	c := New(&config.ClientConfig{}, zerolog.Nop())
+	tunnel := &ActiveTunnel{Config: config.TunnelConfig{LocalAddr: "127.0.0.1", LocalPort: port}}
+	tunnel.primer = newLocalPrimer(2, time.Minute, func() (net.Conn, error) {
+		return net.Dial("tcp", ln.Addr().String())
+	})
+	defer tunnel.closePrimer()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-accepted:
+		case <-time.After(2 * time.Second):
+			t.Fatal("primer did not dial")
+		}
+	}
+	require.Eventually(t, func() bool {
+		tunnel.primer.mu.Lock()
+		defer tunnel.primer.mu.Unlock()
+		return len(tunnel.primer.conns) == 2
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// The burst is served from the primer without new dials
+	for i := 0; i < 2; i++ {
+		conn, err := c.dialLocal(tunnel)
+		require.NoError(t, err)
+		conn.Close()
+	}
+	select {
+	case <-accepted:
+		t.Fatal("pre-warmed connection was not used")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Once drained, streams dial as usual
+	conn, err := c.dialLocal(tunnel)
+	require.NoError(t, err)
+	conn.Close()
+	select {
+	case <-accepted:
+	case <-time.After(2 * time.Second):
+		t.Fatal("drained primer did not fall back to dialing")
+	}
+}
+
+func TestLocalPrimer_ClosesLeftovers(t *testing.T) {
+	ln, accepted := acceptCounter(t)
+
+	p := newLocalPrimer(1, 50*time.Millisecond, func() (net.Conn, error) {
+		return net.Dial("tcp", ln.Addr().String())
+	})
+
+	var server net.Conn
+	select {
+	case server = <-accepted:
+	case <-time.After(2 * time.Second):
+		t.Fatal("primer did not dial")
+	}
+
+	// The unused connection is closed once the TTL passes
+	require.NoError(t, server.SetReadDeadline(time.Now().Add(2*time.Second)))
+	_, err := server.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Nil(t, p.take())
+}
@@ -0,0 +1,115 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+// regionProbeTimeout bounds the probe of each server region. A region that
+// has not completed its handshake by then counts as down.
+const regionProbeTimeout = 10 * time.Second
+
+// probeResult is the outcome of connecting to one region.
+type probeResult struct {
+	ep          endpoint
+	conn        net.Conn
+	rwc         io.ReadWriteCloser
+	compression protocol.Compression
+	rtt         time.Duration
+	err         error
+}
+
+// regionEndpoints returns an endpoint per server region: the primary address
+// followed by server.addresses, all sharing the primary's TLS settings. It is
+// nil without extra addresses, and after an edge node redirect, which pins
+// the client to the node.
+func (c *Client) regionEndpoints() []endpoint {
+	if len(c.cfg.Server.Addresses) == 0 || c.redirectCount > 0 {
+		return nil
+	}
+	primary := c.endpoints()[0]
+	eps := []endpoint{primary}
+	seen := map[string]bool{primary.addr: true}
+	for _, addr := range c.cfg.Server.Addresses {
+		if addr == "" || seen[addr] {
+			continue
+		}
+		seen[addr] = true
+		ep := primary
+		ep.addr = addr
+		ep.serverName = hostOf(addr)
+		eps = append(eps, ep)
+	}
+	return eps
+}
+
+// connectFastest connects to every region at once and keeps the connection
+// that finishes the dial, TLS and compression handshake first, which is the
+// region with the lowest round trip time. The other probes run to completion
+// in the background so their RTTs can be logged; their connections are
+// closed.
+func (c *Client) connectFastest(eps []endpoint) (net.Conn, io.ReadWriteCloser, protocol.Compression, endpoint, error) {
+	ctx, cancel := context.WithTimeout(c.ctx, regionProbeTimeout)
+	results := make(chan probeResult, len(eps))
+	for _, ep := range eps {
+		go func() {
+			start := time.Now()
+			conn, rwc, compression, err := c.dialAndNegotiate(ctx, ep)
+			results <- probeResult{ep: ep, conn: conn, rwc: rwc, compression: compression, rtt: time.Since(start), err: err}
+		}()
+	}
+
+	var (
+		probed  []probeResult
+		lastErr error
+	)
+	for range eps {
+		r := <-results
+		probed = append(probed, r)
+		if r.err != nil {
+			lastErr = fmt.Errorf("%s: %w", r.ep.addr, r.err)
+			continue
+		}
+
+		c.log.Info().Str("endpoint", r.ep.addr).Dur("rtt", r.rtt).Msg("Selected the fastest server")
+		go c.finishProbes(cancel, results, probed, len(eps)-len(probed))
+		return r.conn, r.rwc, r.compression, r.ep, nil
+	}
+	cancel()
+	c.logProbes(probed)
+	return nil, nil, protocol.CompressionNone, endpoint{}, fmt.Errorf("no server region answered: %w", lastErr)
+}
+
+// finishProbes waits for the probes still running after a region was
+// selected, closes the connections they made and logs every region's RTT.
+func (c *Client) finishProbes(cancel context.CancelFunc, results <-chan probeResult, probed []probeResult, pending int) {
+	defer cancel()
+	for range pending {
+		r := <-results
+		if r.err == nil {
+			r.rwc.Close()
+			r.conn.Close()
+		}
+		probed = append(probed, r)
+	}
+	c.logProbes(probed)
+}
+
+func (c *Client) logProbes(probed []probeResult) {
+	rtts := zerolog.Dict()
+	for _, r := range probed {
+		if r.err != nil {
+			rtts.Str(r.ep.addr, "unreachable")
+		} else {
+			rtts.Str(r.ep.addr, r.rtt.Round(time.Millisecond).String())
+		}
+	}
+	c.log.Info().Dict("rtt", rtts).Msg("Probed server regions")
+}
@@ -0,0 +1,174 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/yamux"
+
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+// resumeRetryInterval is the pause between attempts to resume a session.
+const resumeRetryInterval = time.Second
+
+// errResumeRejected means the server no longer holds the session (window
+// expired, server restarted), so retrying the resume is pointless.
+var errResumeRejected = errors.New("resume rejected")
+
+// tryResume attempts to take over the server-side session over a new control
+// connection. Tunnels, data connections and the streams running over them are
+// left untouched, so a transfer on a data connection survives a brief loss of
+// the control connection. It returns false when a full reconnect is needed.
+func (c *Client) tryResume() bool {
+	if c.resumeWindow <= 0 || c.resumeToken == "" || c.closed.Load() {
+		return false
+	}
+
+	c.log.Info().Dur("window", c.resumeWindow).Msg("Attempting to resume session")
+
+	// Stop the goroutines bound to the lost connection and release it
+	c.primaryCancel()
+	if c.controlStream != nil {
+		c.controlStream.Close()
+	}
+	if c.session != nil {
+		c.session.Close()
+	}
+	if c.conn != nil {
+		c.conn.Close()
+	}
+
+	deadline := time.Now().Add(c.resumeWindow)
+	for attempt := 1; ; attempt++ {
+		if c.closed.Load() {
+			return false
+		}
+
+		err := c.resumeSession()
+		if err == nil {
+			c.reconnects.Add(1)
+			c.log.Info().Int("attempt", attempt).Msg("Session resumed")
+			c.events.EmitWithPayload(EventConnected, map[string]interface{}{
+				"client_id":  c.clientID,
+				"session_id": c.sessionID,
+				"server":     c.cfg.Server.Address,
+				"resumed":    true,
+			})
+			return true
+		}
+		if errors.Is(err, errResumeRejected) {
+			c.log.Info().Err(err).Msg("Session cannot be resumed, reconnecting")
+			return false
+		}
+		if time.Now().Add(resumeRetryInterval).After(deadline) {
+			c.log.Info().Err(err).Msg("Resume window expired, reconnecting")
+			return false
+		}
+		c.log.Debug().Err(err).Int("attempt", attempt).Msg("Resume attempt failed, retrying")
+
+		select {
+		case <-c.ctx.Done():
+			return false
+		case <-time.After(resumeRetryInterval):
+		}
+	}
+}
+
+// resumeSession dials a new primary connection, asks the server to attach it
+// to the existing session and, on success, restarts the primary goroutines.
+func (c *Client) resumeSession() error {
+	conn, rwc, _, err := c.dialAndNegotiate(c.ctx, c.activeEndpoint)
+	if err != nil {
+		return fmt.Errorf("dial server: %w", err)
+	}
+
+	yamuxCfg := yamux.DefaultConfig()
+	yamuxCfg.EnableKeepAlive = true
+	yamuxCfg.KeepAliveInterval = yamuxKeepAliveInterval
+	yamuxCfg.MaxStreamWindowSize = yamuxMaxStreamWindowSize
+	yamuxCfg.ConnectionWriteTimeout = yamuxConnectionWriteTimeout
+	session, err := yamux.Client(rwc, yamuxCfg)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("create yamux session: %w", err)
+	}
+
+	stream, err := session.Open()
+	if err != nil {
+		session.Close()
+		conn.Close()
+		return fmt.Errorf("open control stream: %w", err)
+	}
+
+	codec := protocol.NewCodec(stream, stream)
+
+	resumeMsg := &protocol.ResumeSessionMessage{
+		Message:  protocol.NewMessage(protocol.MsgResumeSession),
+		ClientID: c.clientID,
+		Token:    c.resumeToken,
+	}
+	if err := codec.Encode(resumeMsg); err != nil {
+		session.Close()
+		conn.Close()
+		return fmt.Errorf("send resume_session: %w", err)
+	}
+
+	_ = stream.SetReadDeadline(time.Now().Add(authResponseTimeout))
+	var result protocol.ResumeSessionResult
+	if err := codec.Decode(&result); err != nil {
+		session.Close()
+		conn.Close()
+		return fmt.Errorf("read resume_session result: %w", err)
+	}
+	_ = stream.SetReadDeadline(time.Time{})
+
+	if !result.Success {
+		session.Close()
+		conn.Close()
+		return fmt.Errorf("%w: %s", errResumeRejected, result.Error)
+	}
+	codec.SetEncoding(c.encoding)
+	c.resumeToken = result.ResumeToken
+	c.reattachTunnels(result.TunnelIDs)
+
+	c.mu.Lock()
+	c.conn = conn
+	c.session = session
+	c.controlStream = stream
+	c.controlCodec = codec
+	c.mu.Unlock()
+
+	c.startPrimary()
+	return nil
+}
+
+// reattachTunnels keeps the tunnels the server still holds, with their
+// subdomains and ports, and drops the ones it closed while the control
+// connection was down (their tunnel_closed messages were lost with it).
+func (c *Client) reattachTunnels(kept []string) {
+	keep := make(map[string]bool, len(kept))
+	for _, id := range kept {
+		keep[id] = true
+	}
+
+	var gone []string
+	c.tunnelsMu.RLock()
+	for id, tunnel := range c.tunnels {
+		if keep[id] {
+			addr := tunnel.URL
+			if addr == "" {
+				addr = tunnel.RemoteAddr
+			}
+			c.log.Info().Str("tunnel_id", id).Str("address", addr).Msg("Tunnel reattached")
+		} else {
+			gone = append(gone, id)
+		}
+	}
+	c.tunnelsMu.RUnlock()
+
+	for _, id := range gone {
+		c.removeTunnel(id)
+	}
+}
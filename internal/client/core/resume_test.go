@@ -0,0 +1,132 @@
+package core
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/hashicorp/yamux"
+
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+// resumeServer accepts one connection, reads a resume request and answers
+// it with result. The received request is delivered on the returned channel.
+func resumeServer(t *testing.T, result protocol.ResumeSessionResult) (string, <-chan *protocol.ResumeSessionMessage) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	got := make(chan *protocol.ResumeSessionMessage, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		t.Cleanup(func() { conn.Close() })
+		rwc, _, err := protocol.NegotiateCompression(conn, nil, true)
+		if err != nil {
+			return
+		}
+		session, err := yamux.Server(rwc, nil)
+		if err != nil {
+			return
+		}
+		stream, err := session.Accept()
+		if err != nil {
+			return
+		}
+		codec := protocol.NewCodec(stream, stream)
+		var msg protocol.ResumeSessionMessage
+		if err := codec.Decode(&msg); err != nil {
+			return
+		}
+		got <- &msg
+		result.Message = protocol.NewMessage(protocol.MsgResumeSessionResult)
+		_ = codec.Encode(&result)
+	}()
+	return ln.Addr().String(), got
+}
+
+func newResumeTestClient(addr string) *Client {
+	c := newTestClient(addr, "")
+	c.activeEndpoint = endpoint{addr: addr}
+	c.clientID = "client-1"
+	c.resumeToken = "token-1"
+	c.tunnels["kept"] = &ActiveTunnel{ID: "kept", URL: "http://kept.test.local"}
+	c.tunnels["gone"] = &ActiveTunnel{ID: "gone", RemoteAddr: "test.local:30001"}
+	return c
+}
+
+func TestResumeSession_ReattachesKeptTunnels(t *testing.T) {
+	addr, got := resumeServer(t, protocol.ResumeSessionResult{
+		Success:     true,
+		ResumeToken: "token-2",
+		TunnelIDs:   []string{"kept"},
+	})
+	c := newResumeTestClient(addr)
+	defer c.Close()
+
+	if err := c.resumeSession(); err != nil {
+		t.Fatalf("resumeSession: %v", err)
+	}
+
+	msg := <-got
+	if msg.ClientID != "client-1" || msg.Token != "token-1" {
+		t.Fatalf("unexpected resume request: %+v", msg)
+	}
+	if c.resumeToken != "token-2" {
+		t.Fatalf("expected rotated token, got %q", c.resumeToken)
+	}
+
+	tunnels := c.GetTunnels()
+	if len(tunnels) != 1 || tunnels[0].ID != "kept" {
+		t.Fatalf("expected only the kept tunnel, got %+v", tunnels)
+	}
+}
+
+func TestResumeSession_Rejected(t *testing.T) {
+	addr, _ := resumeServer(t, protocol.ResumeSessionResult{
+		Success: false,
+		Error:   "invalid client_id or resume token",
+	})
+	c := newResumeTestClient(addr)
+	defer c.Close()
+
+	err := c.resumeSession()
+	if !errors.Is(err, errResumeRejected) {
+		t.Fatalf("expected errResumeRejected, got %v", err)
+	}
+	if c.resumeToken != "token-1" {
+		t.Fatalf("token must not change on rejection, got %q", c.resumeToken)
+	}
+	if len(c.GetTunnels()) != 2 {
+		t.Fatal("tunnels must be left for the full reconnect to clear")
+	}
+}
+
+func TestTryResume_NotOffered(t *testing.T) {
+	c := newTestClient("127.0.0.1:1", "")
+	defer c.Close()
+
+	if c.tryResume() {
+		t.Fatal("tryResume must fail when the server offered no resume window")
+	}
+}
+
+func TestResumeSession_KeepsEncoding(t *testing.T) {
+	addr, _ := resumeServer(t, protocol.ResumeSessionResult{Success: true, ResumeToken: "token-2"})
+	c := newResumeTestClient(addr)
+	c.encoding = protocol.EncodingMsgpack
+	defer c.Close()
+
+	if err := c.resumeSession(); err != nil {
+		t.Fatalf("resumeSession: %v", err)
+	}
+	if got := c.controlCodec.Encoding(); got != protocol.EncodingMsgpack {
+		t.Fatalf("expected the negotiated encoding after resume, got %q", got)
+	}
+}
@@ -0,0 +1,219 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+// socksHandshakeTimeout bounds the SOCKS5 handshake of a local connection,
+// including the server's dial of the destination.
+const socksHandshakeTimeout = 30 * time.Second
+
+// SOCKS5 wire values (RFC 1928)
+const (
+	socks5Version      = 0x05
+	socks5NoAuth       = 0x00
+	socks5NoAcceptable = 0xff
+	socks5CmdConnect   = 0x01
+	socks5AddrIPv4     = 0x01
+	socks5AddrDomain   = 0x03
+	socks5AddrIPv6     = 0x04
+
+	socks5CmdNotSupported  = 0x07
+	socks5AddrNotSupported = 0x08
+)
+
+// startSOCKS opens the local SOCKS5 proxy of a socks tunnel on its local
+// port, by default on 127.0.0.1 only.
+func (c *Client) startSOCKS(tunnel *ActiveTunnel) error {
+	ln, err := net.Listen("tcp", tunnel.Config.GetLocalAddress())
+	if err != nil {
+		return err
+	}
+	tunnel.socks = ln
+	go c.serveSOCKS(ln, tunnel)
+	return nil
+}
+
+func (c *Client) serveSOCKS(ln net.Listener, tunnel *ActiveTunnel) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go c.handleSOCKS(conn, tunnel)
+	}
+}
+
+// handleSOCKS serves one connection to the local SOCKS5 proxy: the CONNECT
+// destination is sent to the server on a new stream, and once the server
+// has dialed it the connection is proxied through the stream.
+func (c *Client) handleSOCKS(conn net.Conn, tunnel *ActiveTunnel) {
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(socksHandshakeTimeout))
+	dest, err := readSOCKS5Request(conn)
+	if err != nil {
+		c.log.Debug().Err(err).Str("tunnel_id", tunnel.ID).Msg("SOCKS5 handshake failed")
+		return
+	}
+
+	stream, err := c.openOutboundStream()
+	if err != nil {
+		c.log.Warn().Err(err).Str("tunnel_id", tunnel.ID).Msg("Failed to open outbound stream")
+		_ = writeSOCKS5Reply(conn, protocol.DialFailed)
+		return
+	}
+	defer stream.Close()
+
+	if err := protocol.WriteStreamHeader(stream, tunnel.ID, dest); err != nil {
+		_ = writeSOCKS5Reply(conn, protocol.DialFailed)
+		return
+	}
+	_ = stream.SetReadDeadline(time.Now().Add(socksHandshakeTimeout))
+	code, reason, err := protocol.ReadDialReply(stream)
+	if err != nil {
+		c.log.Debug().Err(err).Str("destination", dest).Msg("No dial reply from the server")
+		_ = writeSOCKS5Reply(conn, protocol.DialFailed)
+		return
+	}
+	_ = stream.SetReadDeadline(time.Time{})
+	if code != protocol.DialSucceeded {
+		c.log.Info().Str("destination", dest).Str("reason", reason).Msg("Outbound connection refused by the server")
+		_ = writeSOCKS5Reply(conn, code)
+		return
+	}
+	if err := writeSOCKS5Reply(conn, protocol.DialSucceeded); err != nil {
+		return
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	tunnel.ActiveConns.Add(1)
+	defer tunnel.ActiveConns.Add(-1)
+
+	done := make(chan struct{}, 2)
+	download := &countingWriter{w: conn, count: &tunnel.BytesReceived}
+	upload := &countingWriter{w: stream, count: &tunnel.BytesSent}
+
+	go func() {
+		bp := proxyBufPool.Get().(*[]byte)
+		_, _ = io.CopyBuffer(download, stream, *bp) // download: stream → local
+		proxyBufPool.Put(bp)
+		done <- struct{}{}
+	}()
+
+	go func() {
+		bp := proxyBufPool.Get().(*[]byte)
+		_, _ = io.CopyBuffer(upload, conn, *bp) // upload: local → stream
+		proxyBufPool.Put(bp)
+		done <- struct{}{}
+	}()
+
+	<-done
+	_ = conn.Close()
+	_ = stream.Close()
+	<-done
+
+	c.log.Debug().Str("tunnel_id", tunnel.ID).Str("destination", dest).Msg("SOCKS connection completed")
+}
+
+// openOutboundStream opens a stream to the server on the primary session,
+// which the server takes for socks tunnels.
+func (c *Client) openOutboundStream() (net.Conn, error) {
+	c.mu.Lock()
+	session := c.session
+	c.mu.Unlock()
+	if session == nil {
+		return nil, errors.New("not connected")
+	}
+	return session.Open()
+}
+
+// readSOCKS5Request runs the SOCKS5 handshake on conn up to the request
+// and returns its destination as host:port. Only the CONNECT command
+// without authentication is supported; other requests are answered with
+// the matching SOCKS5 error before an error is returned.
+func readSOCKS5Request(conn io.ReadWriter) (string, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(conn, head[:]); err != nil {
+		return "", err
+	}
+	if head[0] != socks5Version {
+		return "", fmt.Errorf("unsupported SOCKS version %d", head[0])
+	}
+	methods := make([]byte, head[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", err
+	}
+	noAuth := false
+	for _, m := range methods {
+		if m == socks5NoAuth {
+			noAuth = true
+		}
+	}
+	if !noAuth {
+		_, _ = conn.Write([]byte{socks5Version, socks5NoAcceptable})
+		return "", errors.New("client offers no supported authentication method")
+	}
+	if _, err := conn.Write([]byte{socks5Version, socks5NoAuth}); err != nil {
+		return "", err
+	}
+
+	var req [4]byte
+	if _, err := io.ReadFull(conn, req[:]); err != nil {
+		return "", err
+	}
+	if req[0] != socks5Version {
+		return "", fmt.Errorf("unsupported SOCKS version %d", req[0])
+	}
+	if req[1] != socks5CmdConnect {
+		_ = writeSOCKS5Reply(conn, socks5CmdNotSupported)
+		return "", fmt.Errorf("unsupported SOCKS command %d", req[1])
+	}
+
+	var host string
+	switch req[3] {
+	case socks5AddrIPv4, socks5AddrIPv6:
+		ip := make(net.IP, net.IPv4len)
+		if req[3] == socks5AddrIPv6 {
+			ip = make(net.IP, net.IPv6len)
+		}
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", err
+		}
+		host = ip.String()
+	case socks5AddrDomain:
+		var n [1]byte
+		if _, err := io.ReadFull(conn, n[:]); err != nil {
+			return "", err
+		}
+		name := make([]byte, n[0])
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return "", err
+		}
+		host = string(name)
+	default:
+		_ = writeSOCKS5Reply(conn, socks5AddrNotSupported)
+		return "", fmt.Errorf("unsupported SOCKS address type %d", req[3])
+	}
+
+	var port [2]byte
+	if _, err := io.ReadFull(conn, port[:]); err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port[:])))), nil
+}
+
+// writeSOCKS5Reply answers a SOCKS5 request with code. The bound address
+// is left empty: it would be the server's, which is of no use to the peer.
+func writeSOCKS5Reply(w io.Writer, code byte) error {
+	_, err := w.Write([]byte{socks5Version, code, 0x00, socks5AddrIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
@@ -0,0 +1,134 @@
+package core
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/yamux"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+// socksConnPair returns both ends of a loopback TCP connection. Unlike
+// net.Pipe it buffers, so a peer can send a whole handshake at once.
+func socksConnPair(t *testing.T) (net.Conn, net.Conn) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	peer, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	local, err := ln.Accept()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		peer.Close()
+		local.Close()
+	})
+	return local, peer
+}
+
+func TestReadSOCKS5Request(t *testing.T) {
+	tests := []struct {
+		name    string
+		request []byte
+		want    string
+	}{
+		{"domain", append(append([]byte{5, 1, 0, 5, 1, 0, 3, 11}, "example.com"...), 0x01, 0xbb), "example.com:443"},
+		{"ipv4", []byte{5, 2, 2, 0, 5, 1, 0, 1, 203, 0, 113, 7, 0, 80}, "203.0.113.7:80"},
+		{"ipv6", append(append([]byte{5, 1, 0, 5, 1, 0, 4}, net.ParseIP("2001:db8::1")...), 0x1f, 0x90), "[2001:db8::1]:8080"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local, peer := socksConnPair(t)
+			_, err := peer.Write(tt.request)
+			require.NoError(t, err)
+			dest, err := readSOCKS5Request(local)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, dest)
+		})
+	}
+}
+
+func TestReadSOCKS5Request_Unsupported(t *testing.T) {
+	tests := []struct {
+		name    string
+		request []byte
+		reply   []byte
+	}{
+		{"authentication required", []byte{5, 1, 2}, []byte{5, 0xff}},
+		{"bind command", []byte{5, 1, 0, 5, 2, 0, 1, 127, 0, 0, 1, 0, 80}, []byte{5, 0, 5, socks5CmdNotSupported}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local, peer := socksConnPair(t)
+			_, err := peer.Write(tt.request)
+			require.NoError(t, err)
+			_, err = readSOCKS5Request(local)
+			assert.Error(t, err)
+			local.Close()
+			got, _ := io.ReadAll(peer)
+			require.GreaterOrEqual(t, len(got), len(tt.reply))
+			assert.Equal(t, tt.reply, got[:len(tt.reply)])
+		})
+	}
+}
+
+// TestHandleSOCKS runs a SOCKS5 CONNECT through a fake server that checks
+// the stream header and echoes the stream back.
+func TestHandleSOCKS(t *testing.T) {
+	clientEnd, serverEnd := net.Pipe()
+	clientSession, err := yamux.Client(clientEnd, nil)
+	require.NoError(t, err)
+	defer clientSession.Close()
+	serverSession, err := yamux.Server(serverEnd, nil)
+	require.NoError(t, err)
+	defer serverSession.Close()
+
+	headers := make(chan *protocol.StreamHeader, 1)
+	go func() {
+		stream, err := serverSession.Accept()
+		if err != nil {
+			return
+		}
+		defer stream.Close()
+		hdr, err := protocol.ReadStreamHeader(stream)
+		if err != nil {
+			return
+		}
+		headers <- hdr
+		_ = protocol.WriteDialReply(stream, protocol.DialSucceeded, "")
+		_, _ = io.Copy(stream, stream)
+	}()
+
+	c := &Client{log: zerolog.Nop(), session: clientSession}
+	tunnel := &ActiveTunnel{ID: "socks-1", Config: config.TunnelConfig{Type: "socks"}}
+	local, peer := socksConnPair(t)
+	go c.handleSOCKS(local, tunnel)
+
+	require.NoError(t, peer.SetDeadline(time.Now().Add(5*time.Second)))
+	_, err = peer.Write(append(append([]byte{5, 1, 0, 5, 1, 0, 3, 11}, "example.com"...), 0x01, 0xbb))
+	require.NoError(t, err)
+	reply := make([]byte, 2+10)
+	_, err = io.ReadFull(peer, reply)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{5, 0}, reply[:2], "no authentication")
+	assert.Equal(t, byte(protocol.DialSucceeded), reply[3])
+
+	hdr := <-headers
+	assert.Equal(t, "socks-1", hdr.TunnelID)
+	assert.Equal(t, "example.com:443", hdr.RemoteAddr)
+
+	_, err = peer.Write([]byte("hello"))
+	require.NoError(t, err)
+	echo := make([]byte, 5)
+	_, err = io.ReadFull(peer, echo)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(echo))
+	assert.Equal(t, int64(5), tunnel.BytesSent.Load())
+}
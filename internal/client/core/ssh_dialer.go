@@ -0,0 +1,206 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+)
+
+// defaultSSHKeys are tried in ~/.ssh when a bastion has no key_file.
+var defaultSSHKeys = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// sshDialer connects to a tunnel's local service through an SSH bastion.
+// One SSH connection carries all of the tunnel's local connections; it is
+// opened on first use and again after it breaks.
+type sshDialer struct {
+	cfg config.LocalSSHConfig
+	log zerolog.Logger
+
+	mu        sync.Mutex
+	client    *ssh.Client
+	agentConn net.Conn // to the SSH agent, while its keys are in use
+	closed    bool
+}
+
+func newSSHDialer(cfg config.LocalSSHConfig, log zerolog.Logger) *sshDialer {
+	return &sshDialer{
+		cfg: cfg,
+		log: log.With().Str("bastion", cfg.Addr()).Logger(),
+	}
+}
+
+// dial connects to addr as seen from the bastion.
+func (d *sshDialer) dial(addr string, timeout time.Duration) (net.Conn, error) {
+	client, err := d.connect(timeout)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := client.Dial("tcp", addr)
+	if err == nil {
+		return conn, nil
+	}
+
+	// The target may be down, or the bastion connection may have died
+	// without us noticing; only the latter is worth a second try
+	if _, _, reqErr := client.SendRequest("keepalive@openssh.com", true, nil); reqErr == nil {
+		return nil, fmt.Errorf("failed to connect to %s via %s: %w", addr, d.cfg.Addr(), err)
+	}
+	d.drop(client)
+	client, err = d.connect(timeout)
+	if err != nil {
+		return nil, err
+	}
+	conn, err = client.Dial("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s via %s: %w", addr, d.cfg.Addr(), err)
+	}
+	return conn, nil
+}
+
+// connect returns the open SSH connection, signing in to the bastion if
+// there is none.
+func (d *sshDialer) connect(timeout time.Duration) (*ssh.Client, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return nil, errors.New("ssh dialer closed")
+	}
+	if d.client != nil {
+		return d.client, nil
+	}
+
+	clientCfg, err := d.clientConfig(timeout)
+	if err != nil {
+		return nil, err
+	}
+	client, err := ssh.Dial("tcp", d.cfg.Addr(), clientCfg)
+	if err != nil {
+		return nil, fmt.Errorf("ssh to %s: %w", d.cfg.Addr(), err)
+	}
+	d.client = client
+	d.log.Info().Str("user", d.cfg.User).Msg("Connected to SSH bastion")
+	return client, nil
+}
+
+// drop forgets client if it is still the current connection.
+func (d *sshDialer) drop(client *ssh.Client) {
+	d.mu.Lock()
+	if d.client == client {
+		d.client = nil
+	}
+	d.mu.Unlock()
+	_ = client.Close()
+}
+
+// close closes the SSH connection; later dials fail.
+func (d *sshDialer) close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.closed = true
+	if d.client != nil {
+		_ = d.client.Close()
+		d.client = nil
+	}
+	if d.agentConn != nil {
+		_ = d.agentConn.Close()
+		d.agentConn = nil
+	}
+}
+
+func (d *sshDialer) clientConfig(timeout time.Duration) (*ssh.ClientConfig, error) {
+	home, _ := os.UserHomeDir()
+
+	knownHosts := expandHome(d.cfg.KnownHosts, home)
+	if knownHosts == "" {
+		knownHosts = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeys, err := knownhosts.New(knownHosts)
+	if err != nil {
+		return nil, fmt.Errorf("load known hosts: %w", err)
+	}
+
+	auth, err := d.authMethods(home)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ssh.ClientConfig{
+		User:            d.cfg.User,
+		Auth:            auth,
+		HostKeyCallback: hostKeys,
+		Timeout:         timeout,
+	}, nil
+}
+
+// authMethods returns the configured key, or else the SSH agent's keys
+// and the default key files that exist. It is called with d.mu held.
+func (d *sshDialer) authMethods(home string) ([]ssh.AuthMethod, error) {
+	if d.cfg.KeyFile != "" {
+		signer, err := loadSSHKey(expandHome(d.cfg.KeyFile, home))
+		if err != nil {
+			return nil, err
+		}
+		return []ssh.AuthMethod{ssh.PublicKeys(signer)}, nil
+	}
+
+	var methods []ssh.AuthMethod
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			if d.agentConn != nil {
+				_ = d.agentConn.Close()
+			}
+			d.agentConn = conn
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+	var signers []ssh.Signer
+	for _, name := range defaultSSHKeys {
+		if signer, err := loadSSHKey(filepath.Join(home, ".ssh", name)); err == nil {
+			signers = append(signers, signer)
+		}
+	}
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+	if len(methods) == 0 {
+		return nil, errors.New("no SSH key: set local_ssh.key_file or start an SSH agent")
+	}
+	return methods, nil
+}
+
+// expandHome replaces a leading ~/ in a configured path, which the shell
+// does not expand in config files.
+func expandHome(path, home string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok && home != "" {
+		return filepath.Join(home, rest)
+	}
+	return path
+}
+
+func loadSSHKey(path string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read ssh key: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey(data)
+	if err != nil {
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) {
+			return nil, fmt.Errorf("ssh key %s is encrypted; add it to the SSH agent instead", path)
+		}
+		return nil, fmt.Errorf("parse ssh key %s: %w", path, err)
+	}
+	return signer, nil
+}
@@ -0,0 +1,187 @@
+package core
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+)
+
+// startSSHBastion runs an SSH server that accepts clientKey and forwards
+// direct-tcpip channels. It returns its address and a known_hosts file.
+func startSSHBastion(t *testing.T, clientKey ssh.PublicKey) (addr, knownHostsFile string) {
+	t.Helper()
+
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	require.NoError(t, err)
+
+	serverCfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) == string(clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, io.EOF
+		},
+	}
+	serverCfg.AddHostKey(hostSigner)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSSHForwarding(conn, serverCfg)
+		}
+	}()
+
+	knownHostsFile = filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(ln.Addr().String())}, hostSigner.PublicKey())
+	require.NoError(t, os.WriteFile(knownHostsFile, []byte(line+"\n"), 0o600))
+	return ln.Addr().String(), knownHostsFile
+}
+
+func serveSSHForwarding(conn net.Conn, cfg *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, cfg)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newCh := range chans {
+		if newCh.ChannelType() != "direct-tcpip" {
+			_ = newCh.Reject(ssh.UnknownChannelType, "unsupported")
+			continue
+		}
+		var target struct {
+			Host     string
+			Port     uint32
+			OrigHost string
+			OrigPort uint32
+		}
+		if err := ssh.Unmarshal(newCh.ExtraData(), &target); err != nil {
+			_ = newCh.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		upstream, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+		if err != nil {
+			_ = newCh.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		ch, chReqs, err := newCh.Accept()
+		if err != nil {
+			upstream.Close()
+			continue
+		}
+		go ssh.DiscardRequests(chReqs)
+		go func() {
+			_, _ = io.Copy(ch, upstream)
+			_ = ch.CloseWrite()
+		}()
+		go func() {
+			_, _ = io.Copy(upstream, ch)
+			upstream.Close()
+		}()
+	}
+}
+
+// writeSSHKey writes a new client key file and returns it with its public
+// key.
+func writeSSHKey(t *testing.T) (string, ssh.PublicKey) {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	require.NoError(t, err)
+	keyFile := filepath.Join(t.TempDir(), "id_ed25519")
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(block), 0o600))
+	signer, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+	return keyFile, signer.PublicKey()
+}
+
+func TestSSHDialer_Dial(t *testing.T) {
+	keyFile, clientKey := writeSSHKey(t)
+	bastionAddr, knownHostsFile := startSSHBastion(t, clientKey)
+
+	// The "database" behind the bastion echoes what it gets
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer target.Close()
+	go func() {
+		for {
+			conn, err := target.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	d := newSSHDialer(config.LocalSSHConfig{
+		Host:       bastionAddr,
+		User:       "deploy",
+		KeyFile:    keyFile,
+		KnownHosts: knownHostsFile,
+	}, zerolog.Nop())
+	defer d.close()
+
+	for i := 0; i < 2; i++ {
+		conn, err := d.dial(target.Addr().String(), 5*time.Second)
+		require.NoError(t, err)
+		_, err = conn.Write([]byte("ping"))
+		require.NoError(t, err)
+		buf := make([]byte, 4)
+		_, err = io.ReadFull(conn, buf)
+		require.NoError(t, err)
+		assert.Equal(t, "ping", string(buf))
+		conn.Close()
+	}
+
+	_, err = d.dial("127.0.0.1:1", 5*time.Second)
+	assert.Error(t, err, "nothing listens behind the bastion")
+
+	d.close()
+	_, err = d.dial(target.Addr().String(), time.Second)
+	assert.Error(t, err, "closed dialer")
+}
+
+func TestSSHDialer_UnknownHostKey(t *testing.T) {
+	keyFile, clientKey := writeSSHKey(t)
+	bastionAddr, _ := startSSHBastion(t, clientKey)
+	emptyKnownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	require.NoError(t, os.WriteFile(emptyKnownHosts, nil, 0o600))
+
+	d := newSSHDialer(config.LocalSSHConfig{
+		Host:       bastionAddr,
+		User:       "deploy",
+		KeyFile:    keyFile,
+		KnownHosts: emptyKnownHosts,
+	}, zerolog.Nop())
+	defer d.close()
+
+	_, err := d.dial("127.0.0.1:1", 5*time.Second)
+	assert.ErrorContains(t, err, "knownhosts")
+}
@@ -7,12 +7,17 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io"
 	"math/big"
 	"net"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/hashicorp/yamux"
 	"github.com/rs/zerolog"
 
 	"github.com/mephistofox/fxtun.dev/internal/config"
@@ -38,7 +43,7 @@ func goodControlServer(t *testing.T) (addr string, stop func()) {
 				return
 			}
 			// Complete the server side of the handshake (compression disabled).
-			if _, _, err := protocol.NegotiateCompression(conn, false, true); err != nil {
+			if _, _, err := protocol.NegotiateCompression(conn, nil, true); err != nil {
 				conn.Close()
 				continue
 			}
@@ -117,7 +122,7 @@ func goodTLSControlServer(t *testing.T) (addr string, stop func()) {
 			if err != nil {
 				return
 			}
-			if _, _, err := protocol.NegotiateCompression(conn, false, true); err != nil {
+			if _, _, err := protocol.NegotiateCompression(conn, nil, true); err != nil {
 				conn.Close()
 				continue
 			}
@@ -241,3 +246,287 @@ func TestConnectTransport_FallbackTiming(t *testing.T) {
 		t.Fatalf("fallback took too long (%v); broken primary should fail fast", elapsed)
 	}
 }
+
+// rejectingControlServer refuses every connection with reason.
+func rejectingControlServer(t *testing.T, reason protocol.RejectReason) (addr string, stop func()) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_ = protocol.RejectConnection(conn, reason)
+			conn.Close()
+		}
+	}()
+	return ln.Addr().String(), func() {
+		ln.Close()
+		wg.Wait()
+	}
+}
+
+func TestConnectTransport_RejectedSkipsFallback(t *testing.T) {
+	rejectAddr, stopReject := rejectingControlServer(t, protocol.RejectPerIPLimit)
+	defer stopReject()
+	goodAddr, stopGood := goodControlServer(t)
+	defer stopGood()
+
+	c := newTestClient(rejectAddr, goodAddr)
+	defer c.cancel()
+
+	_, _, _, _, err := c.connectTransport()
+	var rejected *protocol.RejectedError
+	if !errors.As(err, &rejected) {
+		t.Fatalf("expected a rejection, got %v", err)
+	}
+	if rejected.Reason != protocol.RejectPerIPLimit {
+		t.Fatalf("expected the per-IP limit, got %s", rejected.Reason)
+	}
+
+	reason, wait, ok := rejectedBackoff(fmt.Errorf("connect: %w", err))
+	if !ok || reason != "per-IP connection limit" {
+		t.Fatalf("rejectedBackoff = %q, %v, %v", reason, wait, ok)
+	}
+	if wait <= defaultReconnectInterval {
+		t.Fatalf("expected a longer wait than the normal %v, got %v", defaultReconnectInterval, wait)
+	}
+	if _, _, ok := rejectedBackoff(errors.New("connection refused")); ok {
+		t.Fatal("a generic failure is not a rejection")
+	}
+	if _, _, ok := rejectedBackoff(NewAuthError(protocol.ErrCodeRateLimited, "slow down")); !ok {
+		t.Fatal("an auth rate limit is a rejection")
+	}
+}
+
+// stalledControlServer accepts connections and never answers, like a link
+// that drops everything after the TCP handshake.
+func stalledControlServer(t *testing.T) (addr string, stop func()) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	var mu sync.Mutex
+	var conns []net.Conn
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+		}
+	}()
+	return ln.Addr().String(), func() {
+		ln.Close()
+		mu.Lock()
+		for _, c := range conns {
+			c.Close()
+		}
+		mu.Unlock()
+	}
+}
+
+func TestTryOpenDataConnection_TimesOut(t *testing.T) {
+	stalledAddr, stopStalled := stalledControlServer(t)
+	defer stopStalled()
+	// Completes the compression handshake but never answers join_session
+	silentAddr, stopSilent := goodControlServer(t)
+	defer stopSilent()
+
+	for name, addr := range map[string]string{"handshake": stalledAddr, "join": silentAddr} {
+		c := newTestClient(addr, "")
+		c.cfg.Server.DataConnectTimeout = 200 * time.Millisecond
+		c.activeEndpoint = endpoint{addr: addr}
+
+		start := time.Now()
+		err := c.tryOpenDataConnection(0)
+		elapsed := time.Since(start)
+		c.cancel()
+
+		if err == nil {
+			t.Fatalf("%s: expected a timeout error", name)
+		}
+		if elapsed > 2*time.Second {
+			t.Fatalf("%s: data connection took %v to give up (%v)", name, elapsed, err)
+		}
+		if len(c.dataSessions) != 0 {
+			t.Fatalf("%s: timed-out data connection was kept", name)
+		}
+	}
+}
+
+// joinRefusingServer answers every join_session with
+// ErrCodeDataSessionsDisabled and counts the connections it gets.
+func joinRefusingServer(t *testing.T) (addr string, conns *atomic.Int32, stop func()) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	conns = new(atomic.Int32)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns.Add(1)
+			go func(conn net.Conn) {
+				defer conn.Close()
+				rwc, _, err := protocol.NegotiateCompression(conn, nil, true)
+				if err != nil {
+					return
+				}
+				session, err := yamux.Server(rwc, yamux.DefaultConfig())
+				if err != nil {
+					return
+				}
+				defer session.Close()
+				stream, err := session.Accept()
+				if err != nil {
+					return
+				}
+				codec := protocol.NewCodec(stream, stream)
+				var join protocol.JoinSessionMessage
+				if err := codec.Decode(&join); err != nil {
+					return
+				}
+				_ = codec.Encode(&protocol.JoinSessionResult{
+					Message: protocol.NewMessage(protocol.MsgJoinSessionResult),
+					Error:   "data sessions are disabled",
+					Code:    protocol.ErrCodeDataSessionsDisabled,
+				})
+				_, _ = io.Copy(io.Discard, stream)
+			}(conn)
+		}
+	}()
+	return ln.Addr().String(), conns, func() { ln.Close() }
+}
+
+func TestOpenDataConnections_DisabledByServer(t *testing.T) {
+	addr, conns, stop := joinRefusingServer(t)
+	defer stop()
+
+	c := newTestClient(addr, "")
+	defer c.cancel()
+	c.activeEndpoint = endpoint{addr: addr}
+	c.sessionSecret = "secret"
+	c.maxDataSessions = 3
+
+	c.openDataConnections()
+
+	if n := conns.Load(); n != 3 {
+		t.Fatalf("expected one attempt per data connection, got %d connections", n)
+	}
+	if len(c.dataSessions) != 0 {
+		t.Fatalf("expected no data sessions, got %d", len(c.dataSessions))
+	}
+}
+
+// slowControlServer is goodControlServer answering the compression handshake
+// only after delay, standing in for a distant region.
+func slowControlServer(t *testing.T, delay time.Duration) (addr string, stop func()) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer c.Close()
+				select {
+				case <-time.After(delay):
+				case <-done:
+					return
+				}
+				if _, _, err := protocol.NegotiateCompression(c, nil, true); err != nil {
+					return
+				}
+				<-done
+			}(conn)
+		}
+	}()
+	return ln.Addr().String(), func() {
+		close(done)
+		ln.Close()
+	}
+}
+
+func TestConnectTransport_FastestRegion(t *testing.T) {
+	farAddr, stopFar := slowControlServer(t, 300*time.Millisecond)
+	defer stopFar()
+	nearAddr, stopNear := goodControlServer(t)
+	defer stopNear()
+
+	c := newTestClient(farAddr, "")
+	defer c.cancel()
+	c.cfg.Server.Addresses = []string{nearAddr, farAddr}
+
+	conn, _, _, ep, err := c.connectTransport()
+	if err != nil {
+		t.Fatalf("connectTransport: %v", err)
+	}
+	defer conn.Close()
+	if ep.addr != nearAddr {
+		t.Fatalf("expected the nearer region %s, got %s", nearAddr, ep.addr)
+	}
+}
+
+func TestConnectTransport_RegionDown(t *testing.T) {
+	downAddr, stopDown := brokenControlServer(t)
+	defer stopDown()
+	upAddr, stopUp := goodControlServer(t)
+	defer stopUp()
+
+	c := newTestClient(downAddr, "")
+	defer c.cancel()
+	c.cfg.Server.Addresses = []string{upAddr}
+
+	conn, _, _, ep, err := c.connectTransport()
+	if err != nil {
+		t.Fatalf("connectTransport: %v", err)
+	}
+	defer conn.Close()
+	if ep.addr != upAddr {
+		t.Fatalf("expected the region that is up %s, got %s", upAddr, ep.addr)
+	}
+}
+
+func TestConnectTransport_RegionsDownUsesFallback(t *testing.T) {
+	downA, stopA := brokenControlServer(t)
+	defer stopA()
+	downB, stopB := brokenControlServer(t)
+	defer stopB()
+	fallbackAddr, stopFallback := goodControlServer(t)
+	defer stopFallback()
+
+	c := newTestClient(downA, fallbackAddr)
+	defer c.cancel()
+	c.cfg.Server.Addresses = []string{downB}
+
+	conn, _, _, ep, err := c.connectTransport()
+	if err != nil {
+		t.Fatalf("connectTransport: %v", err)
+	}
+	defer conn.Close()
+	if ep.addr != fallbackAddr {
+		t.Fatalf("expected the fallback %s, got %s", fallbackAddr, ep.addr)
+	}
+}
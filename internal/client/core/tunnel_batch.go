@@ -0,0 +1,97 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+// RequestTunnels requests several tunnels and returns one error per config,
+// nil for the tunnels that were created. When the server supports it, all
+// the tunnels are requested in a single round trip; otherwise they are
+// requested one by one.
+func (c *Client) RequestTunnels(tunnelCfgs []config.TunnelConfig) []error {
+	errs := make([]error, len(tunnelCfgs))
+	if !c.tunnelBatch || len(tunnelCfgs) < 2 {
+		for i, tunnelCfg := range tunnelCfgs {
+			errs[i] = c.RequestTunnel(tunnelCfg)
+		}
+		return errs
+	}
+
+	batchID := generateID()
+	batch := &protocol.TunnelBatchRequestMessage{
+		Message: protocol.NewMessage(protocol.MsgTunnelBatchRequest),
+		Tunnels: make([]protocol.TunnelRequestMessage, len(tunnelCfgs)),
+	}
+	batch.RequestID = batchID
+	for i, tunnelCfg := range tunnelCfgs {
+		batch.Tunnels[i] = *newTunnelRequest(tunnelCfg, generateID())
+	}
+
+	respChan := make(chan *protocol.TunnelBatchResultMessage, 1)
+	c.pendingMu.Lock()
+	c.pendingBatches[batchID] = respChan
+	c.pendingMu.Unlock()
+
+	defer func() {
+		c.pendingMu.Lock()
+		delete(c.pendingBatches, batchID)
+		c.pendingMu.Unlock()
+	}()
+
+	fail := func(err error) []error {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+
+	if err := c.sendControl(batch); err != nil {
+		return fail(fmt.Errorf("send tunnel batch request: %w", err))
+	}
+
+	select {
+	case resp := <-respChan:
+		for i, tunnelCfg := range tunnelCfgs {
+			if i >= len(resp.Results) {
+				errs[i] = errors.New("no result for tunnel in batch response")
+				continue
+			}
+			result := resp.Results[i]
+			switch {
+			case result.Created != nil:
+				c.activateTunnel(tunnelCfg, result.Created)
+			case result.Error != nil:
+				errs[i] = c.subdomainFallback(tunnelCfg, &TunnelRejectedError{Code: result.Error.Code, Message: result.Error.Error})
+			default:
+				errs[i] = errors.New("empty tunnel result in batch response")
+			}
+		}
+		return errs
+
+	case <-time.After(tunnelResponseTimeout):
+		return fail(fmt.Errorf("timeout waiting for tunnel batch response"))
+
+	case <-c.ctx.Done():
+		return fail(fmt.Errorf("client closed"))
+	}
+}
+
+func (c *Client) handleTunnelBatchResult(data []byte) {
+	parsed, err := c.encoding.ParseMessage(data, protocol.MsgTunnelBatchResult)
+	if err != nil {
+		c.log.Error().Err(err).Msg("Failed to parse tunnel batch result")
+		return
+	}
+	msg := parsed.(*protocol.TunnelBatchResultMessage)
+
+	c.pendingMu.Lock()
+	if ch, ok := c.pendingBatches[msg.RequestID]; ok {
+		ch <- msg
+	}
+	c.pendingMu.Unlock()
+}
@@ -0,0 +1,124 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+// pipeControl connects the client's control codec to an in-memory server
+// end and starts the message handler. The client is closed after the pipe
+// so the handler is not left blocked on a read.
+func pipeControl(t *testing.T, c *Client) *protocol.Codec {
+	t.Helper()
+	t.Cleanup(func() { c.Close() })
+	clientEnd, serverEnd := net.Pipe()
+	t.Cleanup(func() {
+		clientEnd.Close()
+		serverEnd.Close()
+	})
+	c.controlCodec = protocol.NewCodec(clientEnd, clientEnd)
+
+	ctx, cancel := context.WithCancel(c.ctx)
+	t.Cleanup(cancel)
+	c.wg.Add(1)
+	go c.handleMessages(ctx, c.controlCodec)
+	return protocol.NewCodec(serverEnd, serverEnd)
+}
+
+func batchTunnelConfigs(n int) []config.TunnelConfig {
+	cfgs := make([]config.TunnelConfig, n)
+	for i := range cfgs {
+		cfgs[i] = config.TunnelConfig{Name: fmt.Sprintf("app-%d", i), Type: "http", LocalAddr: "127.0.0.1", LocalPort: 3000 + i}
+	}
+	return cfgs
+}
+
+func TestRequestTunnels_Batch(t *testing.T) {
+	c := newTestClient("127.0.0.1:1", "")
+	c.tunnelBatch = true
+	server := pipeControl(t, c)
+
+	go func() {
+		var batch protocol.TunnelBatchRequestMessage
+		if err := server.Decode(&batch); err != nil {
+			return
+		}
+		result := &protocol.TunnelBatchResultMessage{Message: protocol.NewMessage(protocol.MsgTunnelBatchResult)}
+		result.RequestID = batch.RequestID
+		for i, req := range batch.Tunnels {
+			if i == len(batch.Tunnels)-1 {
+				result.Results = append(result.Results, protocol.TunnelBatchResult{
+					Error: &protocol.TunnelErrorMessage{Error: "subdomain is already taken", Code: protocol.ErrCodeSubdomainTaken},
+				})
+				continue
+			}
+			result.Results = append(result.Results, protocol.TunnelBatchResult{
+				Created: &protocol.TunnelCreatedMessage{
+					TunnelID:   fmt.Sprintf("t-%d", i),
+					TunnelType: req.TunnelType,
+					URL:        fmt.Sprintf("http://%s.test.local", req.Name),
+				},
+			})
+		}
+		_ = server.Encode(result)
+	}()
+
+	errs := c.RequestTunnels(batchTunnelConfigs(20))
+
+	if len(errs) != 20 {
+		t.Fatalf("expected 20 results, got %d", len(errs))
+	}
+	for i, err := range errs[:19] {
+		if err != nil {
+			t.Fatalf("tunnel %d: %v", i, err)
+		}
+	}
+	if errs[19] == nil {
+		t.Fatal("expected the rejected tunnel to report an error")
+	}
+	if got := len(c.GetTunnels()); got != 19 {
+		t.Fatalf("expected 19 active tunnels, got %d", got)
+	}
+}
+
+func TestRequestTunnels_FallsBackWithoutBatchSupport(t *testing.T) {
+	c := newTestClient("127.0.0.1:1", "")
+	server := pipeControl(t, c)
+
+	go func() {
+		for i := 0; i < 2; i++ {
+			data, base, err := server.DecodeRaw()
+			if err != nil || base.Type != protocol.MsgTunnelRequest {
+				return
+			}
+			parsed, err := protocol.ParseMessage(data, base.Type)
+			if err != nil {
+				return
+			}
+			req := parsed.(*protocol.TunnelRequestMessage)
+			resp := &protocol.TunnelCreatedMessage{
+				Message:    protocol.NewMessage(protocol.MsgTunnelCreated),
+				TunnelID:   fmt.Sprintf("t-%d", i),
+				TunnelType: req.TunnelType,
+			}
+			resp.RequestID = req.RequestID
+			_ = server.Encode(resp)
+		}
+	}()
+
+	errs := c.RequestTunnels(batchTunnelConfigs(2))
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("tunnel %d: %v", i, err)
+		}
+	}
+	if got := len(c.GetTunnels()); got != 2 {
+		t.Fatalf("expected 2 active tunnels, got %d", got)
+	}
+}
@@ -28,13 +28,18 @@ func (c *Client) handleUDPStream(stream net.Conn, tunnel *ActiveTunnel) {
 
 	udpConn, err := net.DialUDP("udp", nil, addr)
 	if err != nil {
+		c.localDialFailed(tunnel, err)
 		c.log.Error().Err(err).Int("port", tunnel.Config.LocalPort).Msg("Failed to dial local UDP service")
 		return
 	}
+	c.localDialSucceeded(tunnel)
 	defer udpConn.Close()
+	tunnel.ActiveConns.Add(1)
+	defer tunnel.ActiveConns.Add(-1)
 
 	c.log.Debug().
-		Str("tunnel", tunnel.Config.Name).
+		Str("tunnel_id", tunnel.ID).
+		Str("name", tunnel.Config.Name).
 		Str("local", udpConn.RemoteAddr().String()).
 		Msg("UDP proxy started")
 
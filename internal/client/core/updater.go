@@ -26,7 +26,9 @@ type UpdateInfo struct {
 	ClientVersion string            `json:"client_version"`
 	MinVersion    string            `json:"min_version"`
 	Downloads     map[string]string `json:"downloads"`
+	Checksums     map[string]string `json:"checksums"`
 	DownloadURL   string            `json:"-"` // resolved for current platform
+	SHA256        string            `json:"-"` // expected checksum for current platform, if published
 	ServerHost    string            `json:"-"` // server host for URL validation
 }
 
@@ -62,6 +64,7 @@ func CheckUpdate(serverAddr, currentVersion string) (*UpdateInfo, error) {
 	if dlPath, ok := info.Downloads[platform]; ok {
 		info.DownloadURL = fmt.Sprintf("%s://%s%s", scheme, host, dlPath)
 	}
+	info.SHA256 = info.Checksums[platform]
 
 	// Return info if version is incompatible (forced update needed)
 	if IsVersionIncompatible(info.MinVersion, currentVersion) {
@@ -96,8 +99,9 @@ func ValidateUpdateURL(downloadURL string, extraHosts ...string) error {
 }
 
 // SelfUpdate downloads a new binary and replaces the current executable.
+// When expectedSHA256 is non-empty the downloaded binary must match it.
 // extraHosts allows additional trusted hosts for URL validation.
-func SelfUpdate(downloadURL string, extraHosts ...string) error {
+func SelfUpdate(downloadURL, expectedSHA256 string, extraHosts ...string) error {
 	if err := ValidateUpdateURL(downloadURL, extraHosts...); err != nil {
 		return err
 	}
@@ -133,25 +137,27 @@ func SelfUpdate(downloadURL string, extraHosts ...string) error {
 	}
 	tmpFile.Close()
 
-	// Verify the binary's signature before trusting it. When an update public
-	// key is baked in, an update with a missing or invalid signature is rejected
-	// so a compromised download host cannot push a malicious binary. When no key
-	// is configured, verification is skipped (preserving prior behaviour).
+	// Verify the binary before trusting it. The published checksum guards
+	// against corrupted downloads; when an update public key is baked in, the
+	// signature is also required so a compromised download host cannot push a
+	// malicious binary even if it rewrites the checksum too. When no key is
+	// configured, signature verification is skipped (preserving prior behaviour).
+	var sig string
 	if updateSignatureConfigured() {
-		sig, err := downloadUpdateSignature(downloadURL, extraHosts...)
+		sig, err = downloadUpdateSignature(downloadURL, extraHosts...)
 		if err != nil {
 			os.Remove(tmpPath)
 			return fmt.Errorf("fetch update signature: %w", err)
 		}
-		bin, err := os.ReadFile(tmpPath)
-		if err != nil {
-			os.Remove(tmpPath)
-			return fmt.Errorf("read update for verification: %w", err)
-		}
-		if err := verifyBinarySignature(bin, sig, updatePublicKeyHex); err != nil {
-			os.Remove(tmpPath)
-			return fmt.Errorf("verify update: %w", err)
-		}
+	}
+	bin, err := os.ReadFile(tmpPath)
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("read update for verification: %w", err)
+	}
+	if err := verifyUpdate(bin, expectedSHA256, sig, updatePublicKeyHex); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("verify update: %w", err)
 	}
 
 	// Make executable
@@ -212,8 +218,8 @@ func IsVersionIncompatible(minVersion, currentVersion string) bool {
 // SelfUpdateAndRestart downloads a new binary, replaces the current executable,
 // and restarts the process with the same arguments.
 // extraHosts allows additional trusted hosts for URL validation.
-func SelfUpdateAndRestart(downloadURL string, extraHosts ...string) error {
-	if err := SelfUpdate(downloadURL, extraHosts...); err != nil {
+func SelfUpdateAndRestart(downloadURL, expectedSHA256 string, extraHosts ...string) error {
+	if err := SelfUpdate(downloadURL, expectedSHA256, extraHosts...); err != nil {
 		return err
 	}
 
@@ -2,6 +2,7 @@ package core
 
 import (
 	"crypto/ed25519"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"strings"
@@ -47,3 +48,29 @@ func verifyBinarySignature(binary []byte, sigHex, pubKeyHex string) error {
 	}
 	return nil
 }
+
+// verifyChecksum compares the hex SHA-256 of a downloaded binary against the
+// checksum published by the server. An empty expected value skips the check
+// for servers that predate checksum publishing.
+func verifyChecksum(actual, expected string) error {
+	expected = strings.ToLower(strings.TrimSpace(expected))
+	if expected == "" {
+		return nil
+	}
+	if actual != expected {
+		return fmt.Errorf("checksum mismatch: expected %s, got %s", expected, actual)
+	}
+	return nil
+}
+
+// verifyUpdate runs every integrity check on a downloaded update binary: the
+// server-published checksum first, then the release signature. Both checks
+// must pass; a matching checksum does not excuse a bad signature, since a
+// compromised server can publish checksums for whatever it serves.
+func verifyUpdate(binary []byte, expectedSHA256, sigHex, pubKeyHex string) error {
+	sum := sha256.Sum256(binary)
+	if err := verifyChecksum(hex.EncodeToString(sum[:]), expectedSHA256); err != nil {
+		return err
+	}
+	return verifyBinarySignature(binary, sigHex, pubKeyHex)
+}
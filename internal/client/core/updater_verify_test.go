@@ -3,7 +3,9 @@ package core
 import (
 	"crypto/ed25519"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
+	"strings"
 	"testing"
 )
 
@@ -66,3 +68,43 @@ func TestUpdateSignatureConfigured(t *testing.T) {
 		t.Fatal("expected verification disabled by default (empty embedded key)")
 	}
 }
+
+func TestVerifyChecksum(t *testing.T) {
+	const sum = "4c77b56b7cf3077c725c2f433eb76156bd231c23b56805f5a06fc06b87450a43"
+
+	if err := verifyChecksum(sum, sum); err != nil {
+		t.Fatalf("matching checksum: %v", err)
+	}
+	if err := verifyChecksum(sum, strings.ToUpper(sum)+"\n"); err != nil {
+		t.Fatalf("checksum comparison must ignore case and whitespace: %v", err)
+	}
+	if err := verifyChecksum(sum, ""); err != nil {
+		t.Fatalf("empty expected checksum must skip verification: %v", err)
+	}
+	if err := verifyChecksum(sum, strings.Repeat("0", 64)); err == nil {
+		t.Fatal("expected mismatch error")
+	}
+}
+
+func TestVerifyUpdate_ChecksumDoesNotExcuseBadSignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("keygen: %v", err)
+	}
+	pubHex := hex.EncodeToString(pub)
+
+	release := []byte("genuine release binary")
+	sigHex := hex.EncodeToString(ed25519.Sign(priv, release))
+
+	tampered := []byte("malicious binary")
+	tamperedSum := sha256.Sum256(tampered)
+
+	if err := verifyUpdate(tampered, hex.EncodeToString(tamperedSum[:]), sigHex, pubHex); err == nil {
+		t.Fatal("tampered binary with valid checksum but invalid signature must be rejected")
+	}
+
+	releaseSum := sha256.Sum256(release)
+	if err := verifyUpdate(release, hex.EncodeToString(releaseSum[:]), sigHex, pubHex); err != nil {
+		t.Fatalf("genuine release must verify: %v", err)
+	}
+}
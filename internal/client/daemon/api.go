@@ -21,6 +21,7 @@ type TunnelInfo struct {
 	Subdomain  string `json:"subdomain,omitempty"`
 	URL        string `json:"url,omitempty"`
 	RemoteAddr string `json:"remote_addr,omitempty"`
+	InspectURL string `json:"inspect_url,omitempty"`
 }
 
 type TunnelManager interface {
@@ -48,6 +49,15 @@ type AddTunnelRequest struct {
 	AllowIPs      []string `json:"allow_ips,omitempty"`
 	AutoClose     string   `json:"auto_close,omitempty"`
 	MaxLifetime   string   `json:"max_lifetime,omitempty"`
+
+	HealthCheck         string `json:"health_check,omitempty"`
+	HealthCheckInterval string `json:"health_check_interval,omitempty"`
+	Capture             string `json:"capture,omitempty"`
+	SubdomainFallback   int    `json:"subdomain_fallback,omitempty"`
+	StripPathPrefix     string `json:"strip_path_prefix,omitempty"`
+	AddPathPrefix       string `json:"add_path_prefix,omitempty"`
+	CacheEnabled        bool   `json:"cache_enabled,omitempty"`
+	CacheMaxSize        int64  `json:"cache_max_size,omitempty"`
 }
 
 type API struct {
@@ -166,6 +176,15 @@ func (a *API) handleAddTunnel(w http.ResponseWriter, r *http.Request) {
 		AllowIPs:      req.AllowIPs,
 		AutoClose:     req.AutoClose,
 		MaxLifetime:   req.MaxLifetime,
+
+		HealthCheck:         req.HealthCheck,
+		HealthCheckInterval: req.HealthCheckInterval,
+		Capture:             req.Capture,
+		SubdomainFallback:   req.SubdomainFallback,
+		StripPathPrefix:     req.StripPathPrefix,
+		AddPathPrefix:       req.AddPathPrefix,
+		CacheEnabled:        req.CacheEnabled,
+		CacheMaxSize:        req.CacheMaxSize,
 	})
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
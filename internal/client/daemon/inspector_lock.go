@@ -0,0 +1,76 @@
+package daemon
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// InspectorLock advertises the inspector of a client running in the
+// foreground, so "fxtunnel status" in another terminal can find it.
+type InspectorLock struct {
+	PID       int       `json:"pid"`
+	Addr      string    `json:"addr"`
+	Server    string    `json:"server"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// DefaultInspectorLockDir is where clients write their inspector locks, one
+// file per process.
+func DefaultInspectorLockDir() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".fxtunnel", "inspectors")
+}
+
+// WriteInspectorLock writes l to dir and returns the file's path for
+// RemoveState once the client exits.
+func WriteInspectorLock(dir string, l *InspectorLock) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(l)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, strconv.Itoa(l.PID)+".json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// ListInspectorLocks returns the locks in dir, oldest first. Locks of
+// processes that are gone are removed.
+func ListInspectorLocks(dir string) []*InspectorLock {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var locks []*InspectorLock
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var l InspectorLock
+		if err := json.Unmarshal(data, &l); err != nil || !IsProcessAlive(l.PID) {
+			RemoveState(path)
+			continue
+		}
+		locks = append(locks, &l)
+	}
+
+	sort.Slice(locks, func(i, j int) bool {
+		return locks[i].StartedAt.Before(locks[j].StartedAt)
+	})
+	return locks
+}
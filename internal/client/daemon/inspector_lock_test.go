@@ -0,0 +1,51 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInspectorLocks(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "inspectors")
+	path, err := WriteInspectorLock(dir, &InspectorLock{
+		PID:       os.Getpid(),
+		Addr:      "127.0.0.1:4040",
+		Server:    "example.com:4443",
+		StartedAt: time.Now().Truncate(time.Second),
+	})
+	if err != nil {
+		t.Fatalf("WriteInspectorLock: %v", err)
+	}
+
+	locks := ListInspectorLocks(dir)
+	if len(locks) != 1 || locks[0].Addr != "127.0.0.1:4040" || locks[0].PID != os.Getpid() {
+		t.Fatalf("got %+v, want the written lock", locks)
+	}
+
+	RemoveState(path)
+	if locks := ListInspectorLocks(dir); len(locks) != 0 {
+		t.Fatalf("got %d locks after removal, want 0", len(locks))
+	}
+}
+
+func TestInspectorLocksDropsStale(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "bad.json"), []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if locks := ListInspectorLocks(dir); len(locks) != 0 {
+		t.Fatalf("got %d locks, want 0", len(locks))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "bad.json")); !os.IsNotExist(err) {
+		t.Fatal("unreadable lock should have been removed")
+	}
+}
+
+func TestInspectorLocksMissingDir(t *testing.T) {
+	if locks := ListInspectorLocks(filepath.Join(t.TempDir(), "none")); locks != nil {
+		t.Fatalf("got %+v, want nil", locks)
+	}
+}
@@ -81,5 +81,6 @@ func tunnelInfoFrom(t *client.ActiveTunnel) TunnelInfo {
 		Subdomain:  t.Config.Subdomain,
 		URL:        t.URL,
 		RemoteAddr: t.RemoteAddr,
+		InspectURL: t.InspectURL,
 	}
 }
@@ -39,7 +39,7 @@ type AccountService struct {
 func NewAccountService(app *App) *AccountService {
 	return &AccountService{
 		app: app,
-		log: app.log.With().Str("component", "account-service").Logger(),
+		log: app.log.With().Str("service", "account").Logger(),
 	}
 }
 
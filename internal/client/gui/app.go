@@ -77,7 +77,7 @@ func NewApp(log zerolog.Logger) *App {
 		historyEntries: make(map[string]int64),
 	}
 
-	app.api = &apiClient{app: app, log: app.log.With().Str("component", "api-client").Logger()}
+	app.api = &apiClient{app: app, log: app.log.With().Str("service", "api-client").Logger()}
 
 	// Initialize services
 	app.TunnelService = NewTunnelService(app)
@@ -133,8 +133,8 @@ func (a *App) UpdateLogger(log zerolog.Logger) {
 	a.CustomDomainService.log = a.log.With().Str("service", "custom_domain").Logger()
 	a.SyncService.log = a.log.With().Str("service", "sync").Logger()
 	a.InspectService.log = a.log.With().Str("service", "inspect").Logger()
-	a.AccountService.log = a.log.With().Str("component", "account-service").Logger()
-	a.api.log = a.log.With().Str("component", "api-client").Logger()
+	a.AccountService.log = a.log.With().Str("service", "account").Logger()
+	a.api.log = a.log.With().Str("service", "api-client").Logger()
 }
 
 // Shutdown is called when the app is closing
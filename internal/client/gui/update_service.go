@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+	"sync"
 
 	client "github.com/mephistofox/fxtun.dev/internal/client/core"
 )
@@ -11,6 +12,9 @@ import (
 // UpdateService provides update checking and downloading for the GUI.
 type UpdateService struct {
 	app *App
+
+	mu        sync.Mutex
+	checksums map[string]string // download URL -> expected SHA-256 from the last check
 }
 
 // NewUpdateService creates a new UpdateService.
@@ -42,6 +46,10 @@ func (s *UpdateService) CheckUpdate() (*UpdateInfo, error) {
 		return &UpdateInfo{Available: false}, nil
 	}
 
+	s.mu.Lock()
+	s.checksums = map[string]string{info.DownloadURL: info.SHA256}
+	s.mu.Unlock()
+
 	return &UpdateInfo{
 		Available:     true,
 		ForceUpdate:   client.IsVersionIncompatible(info.MinVersion, s.app.version),
@@ -73,12 +81,20 @@ func (s *UpdateService) DownloadUpdate(downloadURL string) error {
 	if !hostAllowed {
 		return fmt.Errorf("download URL host not allowed: %s", u.Host)
 	}
-	return client.SelfUpdate(downloadURL)
+	return client.SelfUpdate(downloadURL, s.checksumFor(downloadURL))
 }
 
 // ApplyUpdateAndRestart downloads the update and restarts the process.
 // URL is validated inside SelfUpdateAndRestart against trusted hosts.
 func (s *UpdateService) ApplyUpdateAndRestart(downloadURL string) error {
 	host, _, _ := strings.Cut(s.app.serverAddress, ":")
-	return client.SelfUpdateAndRestart(downloadURL, host)
+	return client.SelfUpdateAndRestart(downloadURL, s.checksumFor(downloadURL), host)
+}
+
+// checksumFor returns the checksum published alongside downloadURL by the
+// last CheckUpdate, or "" if none is known.
+func (s *UpdateService) checksumFor(downloadURL string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.checksums[downloadURL]
 }
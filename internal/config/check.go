@@ -0,0 +1,433 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/idna"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// subdomainPattern is the format the server accepts for tunnel subdomains
+	subdomainPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,30}[a-z0-9])?$`)
+
+	// reservedSubdomains cannot be claimed by tunnel clients
+	reservedSubdomains = map[string]bool{
+		"api": true, "www": true, "admin": true, "mail": true,
+		"smtp": true, "imap": true, "pop": true, "ftp": true,
+		"ns1": true, "ns2": true, "ns3": true, "ns4": true,
+		"autoconfig": true, "autodiscover": true, "_dmarc": true,
+		"status": true, "metrics": true, "grafana": true,
+	}
+
+	// yamlLinePattern finds the line number in YAML parse errors
+	yamlLinePattern = regexp.MustCompile(`line (\d+)`)
+
+	// fieldPattern finds the config key a Validate error starts with
+	fieldPattern = regexp.MustCompile(`^(tunnel\[\d+\]|[a-z_]+(?:\.[a-z_]+)+(?:\[\d+\])?)`)
+)
+
+// ValidSubdomain reports whether s has the format the server accepts for a
+// tunnel subdomain.
+func ValidSubdomain(s string) bool {
+	return subdomainPattern.MatchString(s)
+}
+
+// ReservedSubdomain reports whether s is one of the subdomains the server
+// keeps for itself.
+func ReservedSubdomain(s string) bool {
+	return reservedSubdomains[s]
+}
+
+var (
+	// ErrInvalidSubdomain is returned by NormalizeSubdomain for a subdomain
+	// that does not have the accepted format.
+	ErrInvalidSubdomain = errors.New("invalid subdomain format")
+
+	// ErrReservedSubdomain is returned by NormalizeSubdomain for a subdomain
+	// the server keeps for itself.
+	ErrReservedSubdomain = errors.New("subdomain is reserved")
+)
+
+// NormalizeSubdomain returns a requested subdomain in the form the server
+// stores and routes it: lowercased, with an internationalized name in
+// punycode ("Café" becomes "xn--caf-dma"). The tunnel server and the API
+// both go through it, so a name is accepted by one only if the other would
+// take it too. On ErrReservedSubdomain the normalized name is returned
+// along with the error.
+func NormalizeSubdomain(s string) (string, error) {
+	name := strings.ToLower(s)
+	if !isASCII(name) || strings.HasPrefix(name, "xn--") {
+		ascii, err := idna.Lookup.ToASCII(name)
+		if err != nil {
+			return "", ErrInvalidSubdomain
+		}
+		name = ascii
+	}
+	if !ValidSubdomain(name) {
+		return "", ErrInvalidSubdomain
+	}
+	if ReservedSubdomain(name) {
+		return name, ErrReservedSubdomain
+	}
+	return name, nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// Issue is a problem found in a configuration. Field is the config key it
+// concerns, e.g. "tunnels[1].name"; Line is where that key is in the config
+// file, 0 when unknown. Warnings do not fail validation.
+type Issue struct {
+	Field   string
+	Line    int
+	Message string
+	Warning bool
+}
+
+func (i Issue) Error() string {
+	return i.Message
+}
+
+// firstError returns the first issue that is not a warning, or nil.
+func firstError(issues []Issue) error {
+	for _, issue := range issues {
+		if !issue.Warning {
+			return issue
+		}
+	}
+	return nil
+}
+
+// Report is the outcome of checking a configuration file.
+type Report struct {
+	// File is the config file that was read; empty when none was found and
+	// only the defaults and environment were checked.
+	File   string
+	Issues []Issue
+}
+
+// Failed reports whether any issue is an error rather than a warning.
+func (r *Report) Failed() bool {
+	return firstError(r.Issues) != nil
+}
+
+// Print writes the report for a person to read.
+func (r *Report) Print(w io.Writer) {
+	if r.File != "" {
+		fmt.Fprintf(w, "Checking %s\n", r.File)
+	} else {
+		fmt.Fprintln(w, "No config file found, checking defaults and environment")
+	}
+
+	errs, warnings := 0, 0
+	for _, issue := range r.Issues {
+		mark := "✗"
+		if issue.Warning {
+			mark = "!"
+			warnings++
+		} else {
+			errs++
+		}
+		if issue.Line > 0 {
+			fmt.Fprintf(w, "  %s line %d: %s\n", mark, issue.Line, issue.Message)
+		} else {
+			fmt.Fprintf(w, "  %s %s\n", mark, issue.Message)
+		}
+	}
+
+	switch {
+	case errs > 0:
+		fmt.Fprintf(w, "Configuration is invalid: %s, %s\n", plural(errs, "error"), plural(warnings, "warning"))
+	case warnings > 0:
+		fmt.Fprintf(w, "Configuration is valid, with %s\n", plural(warnings, "warning"))
+	default:
+		fmt.Fprintln(w, "✓ Configuration is valid")
+	}
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return "1 " + word
+	}
+	return strconv.Itoa(n) + " " + word + "s"
+}
+
+// CheckClientConfig loads a client config the way LoadClientConfig does and
+// reports every problem found rather than stopping at the first one.
+func CheckClientConfig(configPath string) *Report {
+	cfg, file, err := readClientConfig(configPath)
+	report := &Report{File: file}
+	if err != nil {
+		report.Issues = append(report.Issues, parseIssue(err))
+		return report
+	}
+	if err := cfg.validateFields(); err != nil {
+		report.Issues = append(report.Issues, validateIssue(err))
+	}
+	report.Issues = append(report.Issues, cfg.Check()...)
+	report.locate()
+	return report
+}
+
+// CheckServerConfig loads a server config the way LoadServerConfig does and
+// reports every problem found rather than stopping at the first one.
+func CheckServerConfig(configPath string) *Report {
+	cfg, file, err := readServerConfig(configPath)
+	report := &Report{File: file}
+	if err != nil {
+		report.Issues = append(report.Issues, parseIssue(err))
+		return report
+	}
+	if err := cfg.validateFields(); err != nil {
+		report.Issues = append(report.Issues, validateIssue(err))
+	}
+	report.Issues = append(report.Issues, cfg.Check()...)
+	report.locate()
+	return report
+}
+
+// parseIssue turns a read or unmarshal error into an issue, keeping the line
+// number YAML errors carry.
+func parseIssue(err error) Issue {
+	issue := Issue{Message: err.Error()}
+	if m := yamlLinePattern.FindStringSubmatch(err.Error()); m != nil {
+		issue.Line, _ = strconv.Atoi(m[1])
+	}
+	return issue
+}
+
+// validateIssue turns a Validate error into an issue for the key it names.
+func validateIssue(err error) Issue {
+	issue := Issue{Message: err.Error()}
+	if m := fieldPattern.FindString(err.Error()); m != "" {
+		// Validate names tunnels tunnel[i] while the YAML key is tunnels
+		issue.Field = strings.Replace(m, "tunnel[", "tunnels[", 1)
+	}
+	return issue
+}
+
+// locate fills in the line of each issue's field from the config file.
+func (r *Report) locate() {
+	if r.File == "" {
+		return
+	}
+	data, err := os.ReadFile(r.File)
+	if err != nil {
+		return
+	}
+	var doc yaml.Node
+	if yaml.Unmarshal(data, &doc) != nil || len(doc.Content) == 0 {
+		return
+	}
+	for i := range r.Issues {
+		if r.Issues[i].Line == 0 && r.Issues[i].Field != "" {
+			r.Issues[i].Line = fieldLine(doc.Content[0], r.Issues[i].Field)
+		}
+	}
+}
+
+// fieldLine returns the line of a key such as "tunnels[1].name" in a parsed
+// YAML document, or 0 when the file does not set it.
+func fieldLine(node *yaml.Node, field string) int {
+	line := 0
+	for _, part := range strings.Split(field, ".") {
+		key, index := part, -1
+		if open := strings.IndexByte(part, '['); open > 0 && strings.HasSuffix(part, "]") {
+			key = part[:open]
+			n, err := strconv.Atoi(part[open+1 : len(part)-1])
+			if err != nil {
+				return 0
+			}
+			index = n
+		}
+
+		if node.Kind != yaml.MappingNode {
+			return 0
+		}
+		var value *yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				line = node.Content[i].Line
+				value = node.Content[i+1]
+				break
+			}
+		}
+		if value == nil {
+			return 0
+		}
+		node = value
+
+		if index >= 0 {
+			if node.Kind != yaml.SequenceNode || index >= len(node.Content) {
+				return 0
+			}
+			node = node.Content[index]
+			line = node.Line
+		}
+	}
+	return line
+}
+
+// Check runs the checks that look at the configuration as a whole: the
+// server address formats, duplicate tunnel names, remote ports and
+// subdomains. Issues that are not warnings also fail Validate.
+func (c *ClientConfig) Check() []Issue {
+	var issues []Issue
+	if issue, ok := checkServerAddress("server.address", c.Server.Address); !ok {
+		issues = append(issues, issue)
+	}
+	for i, addr := range c.Server.Addresses {
+		if issue, ok := checkServerAddress(fmt.Sprintf("server.addresses[%d]", i), addr); !ok {
+			issues = append(issues, issue)
+		}
+	}
+	if c.Server.FallbackAddress != "" {
+		if issue, ok := checkServerAddress("server.fallback_address", c.Server.FallbackAddress); !ok {
+			issues = append(issues, issue)
+		}
+	}
+
+	names := make(map[string]int, len(c.Tunnels))
+	for i, t := range c.Tunnels {
+		if t.Name != "" {
+			if first, ok := names[t.Name]; ok {
+				field := fmt.Sprintf("tunnels[%d].name", i)
+				issues = append(issues, Issue{Field: field,
+					Message: fmt.Sprintf("%s: duplicate tunnel name %q, also used by tunnels[%d]", field, t.Name, first)})
+			} else {
+				names[t.Name] = i
+			}
+		}
+
+		if t.RemotePort < 0 || t.RemotePort > 65535 {
+			field := fmt.Sprintf("tunnels[%d].remote_port", i)
+			issues = append(issues, Issue{Field: field,
+				Message: fmt.Sprintf("%s: must be between 1 and 65535, or 0 for any port, got %d", field, t.RemotePort)})
+		} else if t.RemotePort != 0 && t.Type != "tcp" && t.Type != "udp" {
+			field := fmt.Sprintf("tunnels[%d].remote_port", i)
+			issues = append(issues, Issue{Field: field, Warning: true,
+				Message: fmt.Sprintf("%s: only used by tcp and udp tunnels", field)})
+		}
+
+		if t.Subdomain != "" {
+			field := fmt.Sprintf("tunnels[%d].subdomain", i)
+			_, err := NormalizeSubdomain(t.Subdomain)
+			switch {
+			case errors.Is(err, ErrInvalidSubdomain):
+				issues = append(issues, Issue{Field: field,
+					Message: fmt.Sprintf("%s: %q is not a valid subdomain: use up to 32 letters, digits and inner hyphens", field, t.Subdomain)})
+			case errors.Is(err, ErrReservedSubdomain):
+				issues = append(issues, Issue{Field: field,
+					Message: fmt.Sprintf("%s: %q is reserved by the server", field, t.Subdomain)})
+			case t.Type != "http":
+				issues = append(issues, Issue{Field: field, Warning: true,
+					Message: fmt.Sprintf("%s: only used by http tunnels", field)})
+			}
+		}
+	}
+	return issues
+}
+
+// checkServerAddress checks a host or host:port the client dials. A missing
+// port is fine: the CLI adds the default one.
+func checkServerAddress(field, addr string) (Issue, bool) {
+	fail := func(format string, args ...any) (Issue, bool) {
+		return Issue{Field: field, Message: field + ": " + fmt.Sprintf(format, args...)}, false
+	}
+	if strings.Contains(addr, "://") {
+		return fail("must be host or host:port, not a URL: %s", addr)
+	}
+	if !strings.Contains(addr, ":") {
+		return Issue{}, true
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fail("must be host or host:port: %s", addr)
+	}
+	if host == "" {
+		return fail("host is missing: %s", addr)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fail("invalid port: %s", port)
+	}
+	return Issue{}, true
+}
+
+// Check runs the checks that look at the configuration as a whole: port
+// ranges, listeners clashing with them, the base domain and subdomains
+// tokens may use. Issues that are not warnings also fail Validate.
+func (c *ServerConfig) Check() []Issue {
+	var issues []Issue
+	for _, r := range []struct {
+		field string
+		ports PortRange
+	}{
+		{"server.tcp_port_range", c.Server.TCPPortRange},
+		{"server.udp_port_range", c.Server.UDPPortRange},
+	} {
+		if r.ports.Max != 0 && (r.ports.Min < 1 || r.ports.Max > 65535) {
+			issues = append(issues, Issue{Field: r.field,
+				Message: fmt.Sprintf("%s: must lie within 1-65535, got %d-%d", r.field, r.ports.Min, r.ports.Max)})
+		}
+	}
+
+	type listener struct {
+		field string
+		port  int
+	}
+	tcp := c.Server.TCPPortRange
+	listeners := []listener{
+		{"server.control_port", c.Server.ControlPort},
+		{"server.http_port", c.Server.HTTPPort},
+	}
+	if c.TLS.Enabled {
+		listeners = append(listeners, listener{"tls.https_port", c.TLS.HTTPSPort})
+	}
+	if c.Web.Enabled && !c.Web.Unified.Enabled {
+		listeners = append(listeners, listener{"web.port", c.Web.Port})
+	}
+	for _, l := range listeners {
+		if tcp.Max != 0 && l.port >= tcp.Min && l.port <= tcp.Max {
+			issues = append(issues, Issue{Field: l.field, Warning: true,
+				Message: fmt.Sprintf("%s: %d is inside server.tcp_port_range, so TCP tunnels asking for it will fail", l.field, l.port)})
+		}
+	}
+
+	if strings.Contains(c.Domain.Base, "/") {
+		issues = append(issues, Issue{Field: "domain.base",
+			Message: fmt.Sprintf("domain.base: must be a domain, not a URL: %s", c.Domain.Base)})
+	}
+
+	for i, token := range c.Auth.Tokens {
+		for j, pattern := range token.AllowedSubdomains {
+			if strings.Contains(pattern, "*") {
+				continue
+			}
+			field := fmt.Sprintf("auth.tokens[%d].allowed_subdomains[%d]", i, j)
+			switch {
+			case !ValidSubdomain(pattern):
+				issues = append(issues, Issue{Field: field, Warning: true,
+					Message: fmt.Sprintf("%s: %q is not a valid subdomain and can never be used", field, pattern)})
+			case ReservedSubdomain(pattern):
+				issues = append(issues, Issue{Field: field, Warning: true,
+					Message: fmt.Sprintf("%s: %q is reserved and can never be used", field, pattern)})
+			}
+		}
+	}
+	return issues
+}
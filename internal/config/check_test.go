@@ -0,0 +1,151 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientConfigCheck(t *testing.T) {
+	cfg := validClientConfig()
+	cfg.Tunnels = []TunnelConfig{
+		{Name: "web", Type: "http", LocalPort: 3000, Subdomain: "Admin"},
+		{Name: "web", Type: "tcp", LocalPort: 22, RemotePort: 70000},
+		{Name: "dns", Type: "udp", LocalPort: 53, Subdomain: "dns"},
+	}
+
+	issues := cfg.Check()
+	require.Len(t, issues, 4)
+	assert.Equal(t, "tunnels[0].subdomain", issues[0].Field)
+	assert.Contains(t, issues[0].Message, "reserved")
+	assert.Equal(t, "tunnels[1].name", issues[1].Field)
+	assert.Equal(t, "tunnels[1].remote_port", issues[2].Field)
+	assert.Equal(t, "tunnels[2].subdomain", issues[3].Field)
+	assert.True(t, issues[3].Warning, "a subdomain on a udp tunnel is only ignored")
+
+	assert.ErrorContains(t, cfg.Validate(), "tunnels[0].subdomain", "the runtime path refuses the config too")
+}
+
+func TestClientConfigCheck_ServerAddress(t *testing.T) {
+	for addr, ok := range map[string]bool{
+		"tunnel.example.com":         true,
+		"tunnel.example.com:4443":    true,
+		"[::1]:4443":                 true,
+		"https://tunnel.example.com": false,
+		"tunnel.example.com:0":       false,
+		":4443":                      false,
+	} {
+		cfg := validClientConfig()
+		cfg.Server.Address = addr
+		if ok {
+			assert.NoError(t, cfg.Validate(), addr)
+		} else {
+			assert.ErrorContains(t, cfg.Validate(), "server.address", addr)
+		}
+	}
+}
+
+func TestServerConfigCheck(t *testing.T) {
+	cfg := validServerConfig()
+	cfg.Server.TCPPortRange = PortRange{Min: 4000, Max: 9000}
+	cfg.Auth.Tokens = []TokenConfig{{Name: "ci", AllowedSubdomains: []string{"www", "app-*", "ok"}}}
+
+	issues := cfg.Check()
+	require.Len(t, issues, 3)
+	for _, issue := range issues {
+		assert.True(t, issue.Warning, issue.Message)
+	}
+	assert.Equal(t, "server.control_port", issues[0].Field)
+	assert.Equal(t, "server.http_port", issues[1].Field)
+	assert.Equal(t, "auth.tokens[0].allowed_subdomains[0]", issues[2].Field)
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Server.UDPPortRange = PortRange{Min: 20001, Max: 70000}
+	assert.ErrorContains(t, cfg.Validate(), "server.udp_port_range")
+}
+
+func TestCheckClientConfig_Lines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "client.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`server:
+  address: tunnel.example.com:4443
+tunnels:
+  - name: web
+    type: http
+    local_port: 3000
+  - name: web
+    type: http
+    local_port: 0
+`), 0o600))
+
+	report := CheckClientConfig(path)
+	assert.Equal(t, path, report.File)
+	assert.True(t, report.Failed())
+	require.Len(t, report.Issues, 2)
+	assert.Equal(t, 7, report.Issues[0].Line, "validate errors point at their tunnel")
+	assert.Contains(t, report.Issues[0].Message, "invalid local_port")
+	assert.Equal(t, 7, report.Issues[1].Line)
+	assert.Contains(t, report.Issues[1].Message, "duplicate tunnel name")
+
+	var out bytes.Buffer
+	report.Print(&out)
+	assert.Contains(t, out.String(), "line 7: tunnel[1]: invalid local_port: 0")
+	assert.Contains(t, out.String(), "Configuration is invalid: 2 errors, 0 warnings")
+}
+
+func TestCheckClientConfig_ParseError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "client.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("server:\n  address: x\n tunnels: [\n"), 0o600))
+
+	report := CheckClientConfig(path)
+	require.Len(t, report.Issues, 1)
+	assert.True(t, report.Failed())
+	assert.Positive(t, report.Issues[0].Line)
+}
+
+func TestCheckServerConfig_Valid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("domain:\n  base: tunnel.example.com\n"), 0o600))
+
+	report := CheckServerConfig(path)
+	assert.False(t, report.Failed())
+	assert.Empty(t, report.Issues)
+
+	var out bytes.Buffer
+	report.Print(&out)
+	assert.Contains(t, out.String(), "Configuration is valid")
+}
+
+func TestNormalizeSubdomain(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		err  error
+	}{
+		{"myapp", "myapp", nil},
+		{"MyApp", "myapp", nil},
+		{"a", "a", nil},
+		{"my--app", "my--app", nil},
+		{"Café", "xn--caf-dma", nil},
+		{"xn--caf-dma", "xn--caf-dma", nil},
+		{"Admin", "admin", ErrReservedSubdomain},
+		{"ａｐｉ", "api", ErrReservedSubdomain},
+		{"", "", ErrInvalidSubdomain},
+		{"-app", "", ErrInvalidSubdomain},
+		{"my_app", "", ErrInvalidSubdomain},
+		{"my.app", "", ErrInvalidSubdomain},
+		{"xn--zz", "", ErrInvalidSubdomain},
+		{"ééééééééééééééééééééééééééééééé", "", ErrInvalidSubdomain},
+		{"a‍b", "", ErrInvalidSubdomain},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := NormalizeSubdomain(tt.in)
+			assert.ErrorIs(t, err, tt.err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
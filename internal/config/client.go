@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"strings"
@@ -9,6 +10,9 @@ import (
 
 	"github.com/spf13/viper"
 	"golang.org/x/crypto/bcrypt"
+
+	"github.com/mephistofox/fxtun.dev/internal/inspect"
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
 )
 
 // ClientConfig holds all client configuration
@@ -18,6 +22,12 @@ type ClientConfig struct {
 	Reconnect ReconnectSettings    `mapstructure:"reconnect"`
 	Inspect   InspectSettings      `mapstructure:"inspect"`
 	Logging   LoggingSettings      `mapstructure:"logging"`
+	Streams   StreamSettings       `mapstructure:"streams"`
+	Metrics   MetricsSettings      `mapstructure:"metrics"`
+
+	// LocalAddr is the host tunnels without their own local_addr connect
+	// to, e.g. a container's gateway. Empty means localhost.
+	LocalAddr string `mapstructure:"local_addr"`
 }
 
 // ClientServerSettings contains server connection settings
@@ -27,6 +37,16 @@ type ClientServerSettings struct {
 	Insecure    bool   `mapstructure:"insecure"`
 	TLSVerify   bool   `mapstructure:"tls_verify"`
 	Compression bool   `mapstructure:"compression"`
+	// CompressionAlgorithms are the connection compression algorithms the
+	// client offers when Compression is on: zstd, snappy. Empty means zstd
+	// alone, the only offer servers before snappy support compress.
+	CompressionAlgorithms []string `mapstructure:"compression_algorithms"`
+
+	// Addresses are servers in other regions. When set, the client connects
+	// to Address and each of these at once on every connect and reconnect,
+	// and keeps the one that finishes the handshake first. They share
+	// Address's TLS settings.
+	Addresses []string `mapstructure:"addresses"`
 
 	// FallbackAddress is an optional secondary endpoint tried when the primary
 	// fails to dial or stalls during the compression handshake (the signature
@@ -35,25 +55,174 @@ type ClientServerSettings struct {
 	// FallbackAddress to the legacy host:4443 plaintext endpoint.
 	FallbackAddress  string `mapstructure:"fallback_address"`
 	FallbackInsecure bool   `mapstructure:"fallback_insecure"`
+
+	// UnknownMessages selects what happens when the server sends a control
+	// message of an unknown type: ignore, log (default) or disconnect.
+	UnknownMessages string `mapstructure:"unknown_messages"`
+
+	// DataConnectTimeout bounds the setup of each extra data connection
+	// opened next to the primary one. A data connection that takes longer
+	// is skipped; the client works without it.
+	DataConnectTimeout time.Duration `mapstructure:"data_connect_timeout"`
 }
 
 // TunnelConfig defines a single tunnel
 type TunnelConfig struct {
 	Name       string `mapstructure:"name" yaml:"name"`
-	Type       string `mapstructure:"type" yaml:"type"` // http, tcp, udp
+	Type       string `mapstructure:"type" yaml:"type"` // http, tcp, udp, sink
 	LocalAddr  string `mapstructure:"local_addr" yaml:"local_addr,omitempty"`
 	LocalPort  int    `mapstructure:"local_port" yaml:"local_port"`
 	RemotePort int    `mapstructure:"remote_port" yaml:"remote_port,omitempty"` // For TCP/UDP, 0 = auto-assign
 	Subdomain  string `mapstructure:"subdomain" yaml:"subdomain,omitempty"`     // For HTTP tunnels
 
+	// SubdomainFallback is how many suffixed subdomains (myapp-2, myapp-3,
+	// ...) the client tries when Subdomain is taken. 0 gives up at once.
+	SubdomainFallback int `mapstructure:"subdomain_fallback" yaml:"subdomain_fallback,omitempty"`
+
+	// Prewarm is how many connections to the local service the client opens
+	// right after the tunnel is created, so the first burst of requests does
+	// not wait for cold dials. 0 disables it.
+	Prewarm int `mapstructure:"prewarm" yaml:"prewarm,omitempty"`
+
 	// Security features
 	BasicAuth     string   `mapstructure:"basic_auth"      yaml:"basic_auth,omitempty"`   // "user:password"
 	BasicAuthHash string   `mapstructure:"basic_auth_hash" yaml:"-"`                      // derived bcrypt hash, never in YAML
 	AllowIPs      []string `mapstructure:"allow_ips"       yaml:"allow_ips,omitempty"`    // CIDR list
 	AutoClose     string   `mapstructure:"auto_close"      yaml:"auto_close,omitempty"`   // "30m", "2h"
 	MaxLifetime   string   `mapstructure:"max_lifetime"    yaml:"max_lifetime,omitempty"` // "8h"
+
+	// Server-side health check: a path ("/healthz") for HTTP tunnels or
+	// "tcp" for a TCP connect check on TCP tunnels.
+	HealthCheck         string `mapstructure:"health_check"          yaml:"health_check,omitempty"`
+	HealthCheckInterval string `mapstructure:"health_check_interval" yaml:"health_check_interval,omitempty"` // "30s"
+
+	// Capture limits which exchanges of an HTTP tunnel the inspector keeps
+	// (an inspect.CaptureMode): "all" (default), "errors" for responses with
+	// status >= 400 only, or "none" to skip capture entirely and avoid
+	// buffering large transfers.
+	Capture string `mapstructure:"capture" yaml:"capture,omitempty"`
+
+	// HeaderRules rewrite request and response headers of an HTTP tunnel as
+	// the server proxies it.
+	HeaderRules *HeaderRules `mapstructure:"header_rules" yaml:"header_rules,omitempty"`
+
+	// StripPathPrefix is removed from request paths that start with it
+	// before they reach the local service ("/api/users" becomes "/users"),
+	// then AddPathPrefix is put in front of the path.
+	StripPathPrefix string `mapstructure:"strip_path_prefix" yaml:"strip_path_prefix,omitempty"`
+	AddPathPrefix   string `mapstructure:"add_path_prefix"   yaml:"add_path_prefix,omitempty"`
+
+	// CacheEnabled lets the server answer repeated GET requests of an HTTP
+	// tunnel from a response cache, following the Cache-Control, ETag and
+	// Last-Modified headers of the local service. CacheMaxSize caps the
+	// cache in bytes; 0 uses the server's limit, which also caps larger
+	// values.
+	CacheEnabled bool  `mapstructure:"cache_enabled"  yaml:"cache_enabled,omitempty"`
+	CacheMaxSize int64 `mapstructure:"cache_max_size" yaml:"cache_max_size,omitempty"`
+
+	// LocalSSH reaches the local service through an SSH bastion: the client
+	// signs in to the bastion and connects to LocalAddr (default localhost)
+	// and LocalPort from there. Only for http and tcp tunnels.
+	LocalSSH *LocalSSHConfig `mapstructure:"local_ssh" yaml:"local_ssh,omitempty"`
+
+	// ProxyProtocol has the server put a PROXY protocol v2 header with the
+	// visitor's address in front of each connection of a TCP tunnel, so the
+	// local service (which must expect it) sees the real source.
+	ProxyProtocol bool `mapstructure:"proxy_protocol" yaml:"proxy_protocol,omitempty"`
+
+	// MaxRequestBytes caps the request bodies visitors may send through an
+	// HTTP tunnel; larger uploads are cut off with 413. 0 uses the server's
+	// limit, which also caps larger values.
+	MaxRequestBytes int64 `mapstructure:"max_request_bytes" yaml:"max_request_bytes,omitempty"`
+
+	// ConfirmConnections has the server ask the client before it forwards
+	// each visitor connection (each request for HTTP tunnels), so the
+	// client's connection gate can decline it. Only for http and tcp
+	// tunnels; costs a control round trip per connection.
+	ConfirmConnections bool `mapstructure:"confirm_connections" yaml:"confirm_connections,omitempty"`
+
+	// NoCompression keeps the tunnel's streams out of per-stream
+	// compression, for traffic that is already compressed or encrypted
+	// (TLS passthrough, media). Only for http and tcp tunnels.
+	NoCompression bool `mapstructure:"no_compression" yaml:"no_compression,omitempty"`
+
+	// SinkBytes is how many bytes the server streams to each connection of a
+	// sink tunnel (admin-only, for load testing). Sink tunnels need no
+	// local service.
+	SinkBytes int64 `mapstructure:"sink_bytes" yaml:"sink_bytes,omitempty"`
+
+	// RestoreToken is issued by the server with the tunnel and sent back on
+	// a full reconnect, so the tunnel gets its previous address again even
+	// after a server restart. It lives in memory only.
+	RestoreToken string `mapstructure:"-" yaml:"-" json:"-"`
+}
+
+// LocalSSHConfig is the SSH bastion a tunnel's local service is reached
+// through.
+type LocalSSHConfig struct {
+	Host string `mapstructure:"host" yaml:"host"` // "bastion" or "bastion:2222", port 22 by default
+	User string `mapstructure:"user" yaml:"user"`
+	// KeyFile is an unencrypted private key. Without one the client tries
+	// the SSH agent, then ~/.ssh/id_ed25519, id_ecdsa and id_rsa.
+	KeyFile string `mapstructure:"key_file" yaml:"key_file,omitempty"`
+	// KnownHosts verifies the bastion's host key; ~/.ssh/known_hosts by
+	// default.
+	KnownHosts string `mapstructure:"known_hosts" yaml:"known_hosts,omitempty"`
+}
+
+// ParseSSHTarget parses a "user@host[:port]" bastion as given on the
+// command line.
+func ParseSSHTarget(target string) (*LocalSSHConfig, error) {
+	user, host, ok := strings.Cut(target, "@")
+	if !ok || user == "" || host == "" {
+		return nil, fmt.Errorf("ssh target must be user@host[:port]: %s", target)
+	}
+	return &LocalSSHConfig{Host: host, User: user}, nil
+}
+
+// Addr returns the bastion's host:port.
+func (s *LocalSSHConfig) Addr() string {
+	if _, _, err := net.SplitHostPort(s.Host); err == nil {
+		return s.Host
+	}
+	return net.JoinHostPort(s.Host, "22")
+}
+
+// HeaderRules configures header rewriting for an HTTP tunnel. In each
+// direction headers are removed first, then set, then added.
+type HeaderRules struct {
+	Request  HeaderRuleSet `mapstructure:"request"  yaml:"request,omitempty"`
+	Response HeaderRuleSet `mapstructure:"response" yaml:"response,omitempty"`
+	// StripSecureCookies drops the Secure attribute from Set-Cookie when the
+	// tunnel is visited over plain HTTP.
+	StripSecureCookies bool `mapstructure:"strip_secure_cookies" yaml:"strip_secure_cookies,omitempty"`
 }
 
+// HeaderRuleSet lists the header edits for one direction.
+type HeaderRuleSet struct {
+	Remove []string          `mapstructure:"remove" yaml:"remove,omitempty"`
+	Set    map[string]string `mapstructure:"set"    yaml:"set,omitempty"`
+	Add    map[string]string `mapstructure:"add"    yaml:"add,omitempty"`
+}
+
+// Protocol converts the rules to their wire form; nil stays nil.
+func (r *HeaderRules) Protocol() *protocol.HeaderRules {
+	if r == nil {
+		return nil
+	}
+	return &protocol.HeaderRules{
+		Request:            protocol.HeaderRuleSet(r.Request),
+		Response:           protocol.HeaderRuleSet(r.Response),
+		StripSecureCookies: r.StripSecureCookies,
+	}
+}
+
+// MaxSubdomainFallback caps TunnelConfig.SubdomainFallback.
+const MaxSubdomainFallback = 20
+
+// MaxPrewarm caps TunnelConfig.Prewarm.
+const MaxPrewarm = 32
+
 // ReconnectSettings contains reconnection configuration
 type ReconnectSettings struct {
 	Enabled     bool          `mapstructure:"enabled"`
@@ -61,8 +230,53 @@ type ReconnectSettings struct {
 	MaxAttempts int           `mapstructure:"max_attempts"` // 0 = infinite
 }
 
+// Stream overflow behaviors for StreamSettings.Overflow.
+const (
+	StreamOverflowSpawn = "spawn" // handle in an extra goroutine, up to MaxOverflow
+	StreamOverflowQueue = "queue" // wait up to QueueTimeout for a free worker
+	StreamOverflowDrop  = "drop"  // close the stream immediately
+)
+
+// StreamSettings tunes the worker pool that handles incoming tunnel streams.
+// Zero values select the built-in defaults, so constrained devices only need
+// to set what they want to cap.
+type StreamSettings struct {
+	Workers      int           `mapstructure:"workers"`       // 0 = NumCPU*4
+	Overflow     string        `mapstructure:"overflow"`      // spawn (default), queue, drop
+	MaxOverflow  int           `mapstructure:"max_overflow"`  // cap on overflow goroutines for "spawn"; 0 = 1024
+	QueueTimeout time.Duration `mapstructure:"queue_timeout"` // max wait for a worker in "queue" mode; 0 = 5s
+
+	// CompressionThreshold is the smallest write compressed on data streams
+	// when the server enables per-stream compression. 0 = 16KB, -1 = never
+	// offer per-stream compression to the server.
+	CompressionThreshold int `mapstructure:"compression_threshold"`
+}
+
+// MetricsSettings controls the client's Prometheus /metrics endpoint. With
+// an empty Addr the endpoint is served by the inspector; set Addr to give it
+// its own listener, e.g. for a headless client running with --no-inspect.
+type MetricsSettings struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Addr    string `mapstructure:"addr"`
+}
+
 // LoadClientConfig loads client configuration from file
 func LoadClientConfig(configPath string) (*ClientConfig, error) {
+	cfg, _, err := readClientConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("validate config: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// readClientConfig loads client configuration without validating it and
+// returns the config file used, empty when none was found.
+func readClientConfig(configPath string) (*ClientConfig, string, error) {
 	v := viper.New()
 
 	// Set defaults
@@ -70,6 +284,8 @@ func LoadClientConfig(configPath string) (*ClientConfig, error) {
 	v.SetDefault("server.insecure", false)
 	v.SetDefault("server.tls_verify", true)
 	v.SetDefault("server.compression", true)
+	v.SetDefault("server.unknown_messages", UnknownMessagesLog)
+	v.SetDefault("server.data_connect_timeout", "5s")
 	// No default fallback_address: it is opt-in and shipped explicitly in
 	// SaaS-distributed configs. Defaulting it would inject the public
 	// fxtun.dev:4443 into self-hosted configs that only set server.address,
@@ -82,8 +298,20 @@ func LoadClientConfig(configPath string) (*ClientConfig, error) {
 	v.SetDefault("inspect.addr", "127.0.0.1:4040")
 	v.SetDefault("inspect.max_body_size", 262144)
 	v.SetDefault("inspect.max_entries", 1000)
+	v.SetDefault("inspect.max_concurrent_queries", 4)
+	v.SetDefault("inspect.remote_replay_timeout", "60s")
 	v.SetDefault("logging.level", "info")
 	v.SetDefault("logging.format", "console")
+	v.SetDefault("logging.sample_every", 0)
+	v.SetDefault("logging.sample_per_second", 0)
+	v.SetDefault("streams.workers", 0)
+	v.SetDefault("streams.overflow", StreamOverflowSpawn)
+	v.SetDefault("streams.max_overflow", 0)
+	v.SetDefault("streams.queue_timeout", "0s")
+	v.SetDefault("streams.compression_threshold", 0)
+	v.SetDefault("metrics.enabled", false)
+	v.SetDefault("metrics.addr", "")
+	v.SetDefault("local_addr", "")
 
 	if configPath != "" {
 		v.SetConfigFile(configPath)
@@ -109,30 +337,88 @@ func LoadClientConfig(configPath string) (*ClientConfig, error) {
 	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	v.AutomaticEnv()
 
-	if err := v.ReadInConfig(); err != nil {
+	if err := readConfigWithEnv(v); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
-			return nil, fmt.Errorf("read config: %w", err)
+			return nil, v.ConfigFileUsed(), fmt.Errorf("read config: %w", err)
 		}
 	}
 
 	var cfg ClientConfig
 	if err := v.Unmarshal(&cfg); err != nil {
-		return nil, fmt.Errorf("unmarshal config: %w", err)
+		return nil, v.ConfigFileUsed(), fmt.Errorf("unmarshal config: %w", err)
 	}
 
-	if err := cfg.Validate(); err != nil {
-		return nil, fmt.Errorf("validate config: %w", err)
-	}
+	return &cfg, v.ConfigFileUsed(), nil
+}
 
-	return &cfg, nil
+// CompressionOffer returns the connection compression algorithms the client
+// offers; nil when compression is off.
+func (s *ClientServerSettings) CompressionOffer() []protocol.Compression {
+	if !s.Compression {
+		return nil
+	}
+	if len(s.CompressionAlgorithms) == 0 {
+		return []protocol.Compression{protocol.CompressionZstd}
+	}
+	algs, _ := protocol.ParseCompressions(s.CompressionAlgorithms) // checked by Validate
+	return algs
 }
 
 // Validate checks the configuration for errors
 func (c *ClientConfig) Validate() error {
+	if err := c.validateFields(); err != nil {
+		return err
+	}
+	return firstError(c.Check())
+}
+
+// validateFields checks the settings one by one, stopping at the first error.
+func (c *ClientConfig) validateFields() error {
 	if c.Server.Address == "" {
 		return fmt.Errorf("server address is required")
 	}
 
+	switch c.Server.UnknownMessages {
+	case "", UnknownMessagesIgnore, UnknownMessagesLog, UnknownMessagesDisconnect:
+	default:
+		return fmt.Errorf("server.unknown_messages: unknown behavior: %s", c.Server.UnknownMessages)
+	}
+	if c.Server.DataConnectTimeout < 0 {
+		return fmt.Errorf("server.data_connect_timeout: must not be negative")
+	}
+	if _, err := protocol.ParseCompressions(c.Server.CompressionAlgorithms); err != nil {
+		return fmt.Errorf("server.compression_algorithms: %w", err)
+	}
+
+	switch c.Streams.Overflow {
+	case "", StreamOverflowSpawn, StreamOverflowQueue, StreamOverflowDrop:
+	default:
+		return fmt.Errorf("streams.overflow: unknown behavior: %s", c.Streams.Overflow)
+	}
+	if c.Streams.Workers < 0 || c.Streams.MaxOverflow < 0 || c.Streams.QueueTimeout < 0 {
+		return fmt.Errorf("streams: workers, max_overflow and queue_timeout must not be negative")
+	}
+	if c.Streams.CompressionThreshold < -1 {
+		return fmt.Errorf("streams.compression_threshold: must be -1 (disabled) or more")
+	}
+	if c.Inspect.MaxConcurrentQueries < 0 {
+		return fmt.Errorf("inspect.max_concurrent_queries: must not be negative")
+	}
+	if c.Inspect.RemoteReplayTimeout < 0 {
+		return fmt.Errorf("inspect.remote_replay_timeout: must not be negative")
+	}
+	if c.Inspect.ReplayMaxBodySize < 0 {
+		return fmt.Errorf("inspect.replay_max_body_size: must not be negative")
+	}
+	if c.Metrics.Addr != "" {
+		if _, _, err := net.SplitHostPort(c.Metrics.Addr); err != nil {
+			return fmt.Errorf("metrics.addr: %w", err)
+		}
+	}
+	if _, _, err := net.SplitHostPort(c.LocalAddr); err == nil {
+		return fmt.Errorf("local_addr: must be a host without a port: %s", c.LocalAddr)
+	}
+
 	for i := range c.Tunnels {
 		t := &c.Tunnels[i]
 		if t.Type == "" {
@@ -144,13 +430,93 @@ func (c *ClientConfig) Validate() error {
 			if t.LocalPort < 1 || t.LocalPort > 65535 {
 				return fmt.Errorf("tunnel[%d]: invalid local_port: %d", i, t.LocalPort)
 			}
-		case "tcp", "udp":
+		case "tcp", "udp", "socks":
 			if t.LocalPort < 1 || t.LocalPort > 65535 {
 				return fmt.Errorf("tunnel[%d]: invalid local_port: %d", i, t.LocalPort)
 			}
+		case "sink":
+			if t.SinkBytes < 0 {
+				return fmt.Errorf("tunnel[%d]: sink_bytes must not be negative", i)
+			}
 		default:
 			return fmt.Errorf("tunnel[%d]: unknown type: %s", i, t.Type)
 		}
+		if t.Capture != "" {
+			if t.Type != "http" {
+				return fmt.Errorf("tunnel[%d]: capture is only supported for http tunnels", i)
+			}
+			if _, err := inspect.ParseCaptureMode(t.Capture); err != nil {
+				return fmt.Errorf("tunnel[%d]: %w", i, err)
+			}
+		}
+		if t.SubdomainFallback != 0 {
+			if t.Type != "http" {
+				return fmt.Errorf("tunnel[%d]: subdomain_fallback is only supported for http tunnels", i)
+			}
+			if t.SubdomainFallback < 0 || t.SubdomainFallback > MaxSubdomainFallback {
+				return fmt.Errorf("tunnel[%d]: subdomain_fallback must be between 0 and %d", i, MaxSubdomainFallback)
+			}
+		}
+		if t.Prewarm != 0 {
+			if t.Type != "http" && t.Type != "tcp" {
+				return fmt.Errorf("tunnel[%d]: prewarm is only supported for http and tcp tunnels", i)
+			}
+			if t.Prewarm < 0 || t.Prewarm > MaxPrewarm {
+				return fmt.Errorf("tunnel[%d]: prewarm must be between 0 and %d", i, MaxPrewarm)
+			}
+		}
+		if t.StripPathPrefix != "" || t.AddPathPrefix != "" {
+			if t.Type != "http" {
+				return fmt.Errorf("tunnel[%d]: path prefixes are only supported for http tunnels", i)
+			}
+			if err := protocol.ValidatePathPrefix(t.StripPathPrefix); err != nil {
+				return fmt.Errorf("tunnel[%d]: strip_path_prefix: %w", i, err)
+			}
+			if err := protocol.ValidatePathPrefix(t.AddPathPrefix); err != nil {
+				return fmt.Errorf("tunnel[%d]: add_path_prefix: %w", i, err)
+			}
+		}
+		if t.CacheEnabled || t.CacheMaxSize != 0 {
+			if t.Type != "http" {
+				return fmt.Errorf("tunnel[%d]: cache is only supported for http tunnels", i)
+			}
+			if t.CacheMaxSize < 0 {
+				return fmt.Errorf("tunnel[%d]: cache_max_size must not be negative", i)
+			}
+		}
+		if t.MaxRequestBytes != 0 {
+			if t.Type != "http" {
+				return fmt.Errorf("tunnel[%d]: max_request_bytes is only supported for http tunnels", i)
+			}
+			if t.MaxRequestBytes < 0 {
+				return fmt.Errorf("tunnel[%d]: max_request_bytes must not be negative", i)
+			}
+		}
+		if t.ConfirmConnections && t.Type != "http" && t.Type != "tcp" {
+			return fmt.Errorf("tunnel[%d]: confirm_connections is only supported for http and tcp tunnels", i)
+		}
+		if t.NoCompression && t.Type != "http" && t.Type != "tcp" {
+			return fmt.Errorf("tunnel[%d]: no_compression is only supported for http and tcp tunnels", i)
+		}
+		if t.ProxyProtocol && t.Type != "tcp" {
+			return fmt.Errorf("tunnel[%d]: proxy_protocol is only supported for tcp tunnels", i)
+		}
+		if t.LocalSSH != nil {
+			if t.Type != "http" && t.Type != "tcp" {
+				return fmt.Errorf("tunnel[%d]: local_ssh is only supported for http and tcp tunnels", i)
+			}
+			if t.LocalSSH.Host == "" || t.LocalSSH.User == "" {
+				return fmt.Errorf("tunnel[%d]: local_ssh needs a host and a user", i)
+			}
+		}
+		if t.HeaderRules != nil {
+			if t.Type != "http" {
+				return fmt.Errorf("tunnel[%d]: header_rules are only supported for http tunnels", i)
+			}
+			if err := t.HeaderRules.Protocol().Validate(); err != nil {
+				return fmt.Errorf("tunnel[%d]: header_rules: %w", i, err)
+			}
+		}
 
 		if err := t.deriveHashes(); err != nil {
 			return fmt.Errorf("tunnel[%d]: %w", i, err)
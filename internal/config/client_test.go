@@ -4,9 +4,12 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/mephistofox/fxtun.dev/internal/inspect"
 )
 
 func validClientConfig() *ClientConfig {
@@ -57,6 +60,41 @@ func TestClientConfigValidate_TCPUDPTunnels(t *testing.T) {
 	assert.NoError(t, cfg.Validate())
 }
 
+func TestClientConfigValidate_LocalSSH(t *testing.T) {
+	bastion, err := ParseSSHTarget("deploy@bastion.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "deploy", bastion.User)
+	assert.Equal(t, "bastion.example.com:22", bastion.Addr())
+
+	bastion, err = ParseSSHTarget("deploy@bastion.example.com:2222")
+	require.NoError(t, err)
+	assert.Equal(t, "bastion.example.com:2222", bastion.Addr())
+
+	for _, target := range []string{"bastion", "@bastion", "deploy@"} {
+		_, err := ParseSSHTarget(target)
+		assert.Error(t, err, target)
+	}
+
+	cfg := validClientConfig()
+	cfg.Tunnels = []TunnelConfig{{Type: "tcp", LocalPort: 5432, LocalSSH: bastion}}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Tunnels = []TunnelConfig{{Type: "udp", LocalPort: 53, LocalSSH: bastion}}
+	assert.Error(t, cfg.Validate(), "no UDP over SSH")
+
+	cfg.Tunnels = []TunnelConfig{{Type: "tcp", LocalPort: 5432, LocalSSH: &LocalSSHConfig{Host: "bastion"}}}
+	assert.Error(t, cfg.Validate(), "user is required")
+}
+
+func TestClientConfigValidate_ProxyProtocol(t *testing.T) {
+	cfg := validClientConfig()
+	cfg.Tunnels = []TunnelConfig{{Type: "tcp", LocalPort: 8443, ProxyProtocol: true}}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Tunnels = []TunnelConfig{{Type: "http", LocalPort: 3000, ProxyProtocol: true}}
+	assert.Error(t, cfg.Validate())
+}
+
 func TestTunnelConfigGetLocalAddress(t *testing.T) {
 	tc := &TunnelConfig{LocalPort: 3000}
 	assert.Equal(t, "127.0.0.1:3000", tc.GetLocalAddress())
@@ -81,6 +119,7 @@ func TestLoadClientConfig_Defaults(t *testing.T) {
 	// fallback_address is opt-in (no default) to avoid leaking self-hosted
 	// tokens to the public server; SaaS configs set it explicitly.
 	assert.Empty(t, cfg.Server.FallbackAddress)
+	assert.Equal(t, UnknownMessagesLog, cfg.Server.UnknownMessages)
 	assert.True(t, cfg.Reconnect.Enabled)
 }
 
@@ -130,6 +169,7 @@ server:
 	assert.Equal(t, "127.0.0.1:4040", cfg.Inspect.Addr)
 	assert.Equal(t, 262144, cfg.Inspect.MaxBodySize)
 	assert.Equal(t, 1000, cfg.Inspect.MaxEntries)
+	assert.Equal(t, 4, cfg.Inspect.MaxConcurrentQueries)
 }
 
 func TestInspectConfigOverride(t *testing.T) {
@@ -143,6 +183,7 @@ inspect:
   addr: "0.0.0.0:9090"
   max_body_size: 1048576
   max_entries: 500
+  max_concurrent_queries: 2
 `
 	require.NoError(t, os.WriteFile(cfgFile, []byte(yaml), 0600))
 
@@ -152,6 +193,32 @@ inspect:
 	assert.Equal(t, "0.0.0.0:9090", cfg.Inspect.Addr)
 	assert.Equal(t, 1048576, cfg.Inspect.MaxBodySize)
 	assert.Equal(t, 500, cfg.Inspect.MaxEntries)
+	assert.Equal(t, 2, cfg.Inspect.MaxConcurrentQueries)
+}
+
+func TestMetricsConfig(t *testing.T) {
+	dir := t.TempDir()
+	cfgFile := filepath.Join(dir, "client.yaml")
+	require.NoError(t, os.WriteFile(cfgFile, []byte("server:\n  address: \"localhost:4443\"\n"), 0600))
+
+	cfg, err := LoadClientConfig(cfgFile)
+	require.NoError(t, err)
+	assert.False(t, cfg.Metrics.Enabled)
+	assert.Empty(t, cfg.Metrics.Addr)
+
+	yaml := `
+server:
+  address: "localhost:4443"
+metrics:
+  enabled: true
+  addr: "127.0.0.1:9464"
+`
+	require.NoError(t, os.WriteFile(cfgFile, []byte(yaml), 0600))
+
+	cfg, err = LoadClientConfig(cfgFile)
+	require.NoError(t, err)
+	assert.True(t, cfg.Metrics.Enabled)
+	assert.Equal(t, "127.0.0.1:9464", cfg.Metrics.Addr)
 }
 
 func TestLoadClientConfig_FromFile(t *testing.T) {
@@ -185,3 +252,188 @@ reconnect:
 	assert.Equal(t, "tcp", cfg.Tunnels[1].Type)
 	assert.False(t, cfg.Reconnect.Enabled)
 }
+
+func TestClientConfigValidate_UnknownMessages(t *testing.T) {
+	cfg := validClientConfig()
+	cfg.Server.UnknownMessages = UnknownMessagesDisconnect
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Server.UnknownMessages = "panic"
+	assert.Error(t, cfg.Validate())
+}
+
+func TestClientConfigValidate_DataConnectTimeout(t *testing.T) {
+	cfg := validClientConfig()
+	cfg.Server.DataConnectTimeout = 2 * time.Second
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Server.DataConnectTimeout = -time.Second
+	assert.Error(t, cfg.Validate())
+}
+
+func TestClientConfigValidate_Capture(t *testing.T) {
+	cfg := validClientConfig()
+	cfg.Tunnels = []TunnelConfig{{Name: "web", Type: "http", LocalPort: 3000, Capture: string(inspect.CaptureErrors)}}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Tunnels[0].Capture = "slow"
+	assert.Error(t, cfg.Validate())
+
+	cfg.Tunnels = []TunnelConfig{{Name: "ssh", Type: "tcp", LocalPort: 22, Capture: string(inspect.CaptureErrors)}}
+	assert.Error(t, cfg.Validate())
+}
+
+func TestClientConfigValidate_HeaderRules(t *testing.T) {
+	rules := &HeaderRules{Request: HeaderRuleSet{Set: map[string]string{"Host": "app.local"}}}
+	cfg := validClientConfig()
+	cfg.Tunnels = []TunnelConfig{{Name: "web", Type: "http", LocalPort: 3000, HeaderRules: rules}}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Tunnels[0].HeaderRules = &HeaderRules{Request: HeaderRuleSet{Set: map[string]string{"X-A": "1\r\nX-B: 2"}}}
+	assert.Error(t, cfg.Validate())
+
+	cfg.Tunnels = []TunnelConfig{{Name: "ssh", Type: "tcp", LocalPort: 22, HeaderRules: rules}}
+	assert.Error(t, cfg.Validate())
+}
+
+func TestClientConfigValidate_Streams(t *testing.T) {
+	for _, mode := range []string{"", StreamOverflowSpawn, StreamOverflowQueue, StreamOverflowDrop} {
+		cfg := validClientConfig()
+		cfg.Streams.Overflow = mode
+		assert.NoError(t, cfg.Validate(), "overflow %q should be valid", mode)
+	}
+
+	cfg := validClientConfig()
+	cfg.Streams.Overflow = "block"
+	assert.Error(t, cfg.Validate())
+
+	cfg = validClientConfig()
+	cfg.Streams.Workers = -1
+	assert.Error(t, cfg.Validate())
+
+	cfg = validClientConfig()
+	cfg.Streams.CompressionThreshold = -1
+	assert.NoError(t, cfg.Validate())
+	cfg.Streams.CompressionThreshold = -2
+	assert.Error(t, cfg.Validate())
+}
+
+func TestClientConfigValidate_SubdomainFallback(t *testing.T) {
+	cfg := validClientConfig()
+	cfg.Tunnels[0].SubdomainFallback = 3
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Tunnels[0].SubdomainFallback = MaxSubdomainFallback + 1
+	assert.Error(t, cfg.Validate())
+
+	cfg.Tunnels[0].SubdomainFallback = -1
+	assert.Error(t, cfg.Validate())
+
+	cfg = validClientConfig()
+	cfg.Tunnels = []TunnelConfig{{Type: "tcp", LocalPort: 22, SubdomainFallback: 2}}
+	assert.Error(t, cfg.Validate())
+}
+
+func TestClientConfigValidate_Prewarm(t *testing.T) {
+	cfg := validClientConfig()
+	cfg.Tunnels[0].Prewarm = 4
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Tunnels[0].Prewarm = MaxPrewarm + 1
+	assert.Error(t, cfg.Validate())
+
+	cfg.Tunnels[0].Prewarm = -1
+	assert.Error(t, cfg.Validate())
+
+	cfg = validClientConfig()
+	cfg.Tunnels = []TunnelConfig{{Type: "udp", LocalPort: 53, Prewarm: 2}}
+	assert.Error(t, cfg.Validate())
+}
+
+func TestClientConfigValidate_PathPrefix(t *testing.T) {
+	cfg := validClientConfig()
+	cfg.Tunnels[0].StripPathPrefix = "/api"
+	cfg.Tunnels[0].AddPathPrefix = "/v2"
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Tunnels[0].StripPathPrefix = "/api/"
+	assert.ErrorContains(t, cfg.Validate(), "strip_path_prefix")
+
+	cfg = validClientConfig()
+	cfg.Tunnels = []TunnelConfig{{Type: "tcp", LocalPort: 22, StripPathPrefix: "/api"}}
+	assert.Error(t, cfg.Validate())
+}
+
+func TestClientConfigValidate_Cache(t *testing.T) {
+	cfg := validClientConfig()
+	cfg.Tunnels[0].CacheEnabled = true
+	cfg.Tunnels[0].CacheMaxSize = 8 << 20
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Tunnels[0].CacheMaxSize = -1
+	assert.ErrorContains(t, cfg.Validate(), "cache_max_size")
+
+	cfg = validClientConfig()
+	cfg.Tunnels = []TunnelConfig{{Type: "tcp", LocalPort: 22, CacheEnabled: true}}
+	assert.Error(t, cfg.Validate())
+}
+
+func TestClientConfigValidate_MaxRequestBytes(t *testing.T) {
+	cfg := validClientConfig()
+	cfg.Tunnels[0].MaxRequestBytes = 10 << 20
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Tunnels[0].MaxRequestBytes = -1
+	assert.ErrorContains(t, cfg.Validate(), "max_request_bytes")
+
+	cfg = validClientConfig()
+	cfg.Tunnels = []TunnelConfig{{Type: "tcp", LocalPort: 22, MaxRequestBytes: 1024}}
+	assert.Error(t, cfg.Validate())
+}
+
+func TestClientConfigValidate_ConfirmConnections(t *testing.T) {
+	cfg := validClientConfig()
+	cfg.Tunnels = []TunnelConfig{{Type: "tcp", LocalPort: 22, ConfirmConnections: true}}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Tunnels = []TunnelConfig{{Type: "udp", LocalPort: 53, ConfirmConnections: true}}
+	assert.ErrorContains(t, cfg.Validate(), "confirm_connections")
+}
+
+func TestClientConfigValidate_NoCompression(t *testing.T) {
+	cfg := validClientConfig()
+	cfg.Tunnels = []TunnelConfig{{Type: "tcp", LocalPort: 443, NoCompression: true}}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Tunnels = []TunnelConfig{{Type: "udp", LocalPort: 53, NoCompression: true}}
+	assert.ErrorContains(t, cfg.Validate(), "no_compression")
+}
+
+func TestClientConfigValidate_MetricsAddr(t *testing.T) {
+	cfg := validClientConfig()
+	cfg.Metrics.Addr = "127.0.0.1:9464"
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Metrics.Addr = "9464"
+	assert.Error(t, cfg.Validate())
+}
+
+func TestClientConfigValidate_LocalAddr(t *testing.T) {
+	cfg := validClientConfig()
+	for _, addr := range []string{"172.17.0.1", "host.docker.internal", "::1"} {
+		cfg.LocalAddr = addr
+		assert.NoError(t, cfg.Validate(), addr)
+	}
+
+	cfg.LocalAddr = "172.17.0.1:3000"
+	assert.Error(t, cfg.Validate())
+}
+
+func TestClientConfigValidate_Sink(t *testing.T) {
+	cfg := validClientConfig()
+	cfg.Tunnels = []TunnelConfig{{Name: "sink", Type: "sink", SinkBytes: 1 << 30}}
+	assert.NoError(t, cfg.Validate(), "sink tunnels need no local_port")
+
+	cfg.Tunnels[0].SinkBytes = -1
+	assert.Error(t, cfg.Validate())
+}
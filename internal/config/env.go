@@ -0,0 +1,109 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// envRefPattern matches ${VAR} and ${VAR:-default} in config values.
+var envRefPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?:(:-)([^}]*))?\}`)
+
+// expandEnv replaces the ${VAR} and ${VAR:-default} references in s. The
+// default is used when VAR is unset or empty; a reference to an unset
+// variable without a default is an error.
+func expandEnv(s string) (string, error) {
+	var missing string
+	out := envRefPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		m := envRefPattern.FindStringSubmatch(ref)
+		value, ok := os.LookupEnv(m[1])
+		if m[2] != "" && value == "" {
+			return m[3]
+		}
+		if !ok && missing == "" {
+			missing = m[1]
+		}
+		return value
+	})
+	if missing != "" {
+		return "", fmt.Errorf("environment variable %s is not set", missing)
+	}
+	return out, nil
+}
+
+// expandEnvNode expands the environment references in every string value
+// of a YAML node; keys are left alone. path names the node in errors.
+func expandEnvNode(node *yaml.Node, path string) error {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, n := range node.Content {
+			if err := expandEnvNode(n, path); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			if path != "" {
+				key = path + "." + key
+			}
+			if err := expandEnvNode(node.Content[i+1], key); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		for i, n := range node.Content {
+			if err := expandEnvNode(n, path+"["+strconv.Itoa(i)+"]"); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		if node.Tag != "!!str" {
+			return nil
+		}
+		value, err := expandEnv(node.Value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		node.Value = value
+	}
+	return nil
+}
+
+// readConfigWithEnv reads the config file into v with the environment
+// references in its values expanded.
+func readConfigWithEnv(v *viper.Viper) error {
+	if err := v.ReadInConfig(); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(v.ConfigFileUsed())
+	if err != nil {
+		return err
+	}
+	expanded, err := expandEnvYAML(data)
+	if err != nil {
+		return err
+	}
+	return v.ReadConfig(bytes.NewReader(expanded))
+}
+
+// expandEnvYAML returns a YAML document with the environment references in
+// its values expanded. Documents without references are returned as is.
+func expandEnvYAML(data []byte) ([]byte, error) {
+	if !bytes.Contains(data, []byte("${")) {
+		return data, nil
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if err := expandEnvNode(&doc, ""); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(&doc)
+}
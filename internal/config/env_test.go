@@ -0,0 +1,103 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("FXT_TEST_SET", "value")
+	t.Setenv("FXT_TEST_EMPTY", "")
+
+	tests := []struct {
+		in, want string
+	}{
+		{"plain", "plain"},
+		{"${FXT_TEST_SET}", "value"},
+		{"pre-${FXT_TEST_SET}-post", "pre-value-post"},
+		{"${FXT_TEST_UNSET:-fallback}", "fallback"},
+		{"${FXT_TEST_EMPTY:-fallback}", "fallback"},
+		{"${FXT_TEST_SET:-fallback}", "value"},
+		{"${FXT_TEST_UNSET:-}", ""},
+		{"${FXT_TEST_EMPTY}", ""},
+		{"pa$$word $HOME", "pa$$word $HOME"},
+	}
+	for _, tt := range tests {
+		got, err := expandEnv(tt.in)
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.want, got, tt.in)
+	}
+
+	_, err := expandEnv("${FXT_TEST_UNSET}")
+	assert.EqualError(t, err, "environment variable FXT_TEST_UNSET is not set")
+}
+
+func TestLoadServerConfig_EnvExpansion(t *testing.T) {
+	t.Setenv("FXT_TEST_JWT", "jwt-secret-from-the-environment-0123")
+	cfgFile := filepath.Join(t.TempDir(), "server.yaml")
+	yaml := `
+server:
+  control_port: ${FXT_TEST_CONTROL_PORT:-5555}
+domain:
+  base: "${FXT_TEST_DOMAIN:-example.com}"
+auth:
+  jwt_secret: ${FXT_TEST_JWT}
+yookassa:
+  secret_key: ${FXT_TEST_JWT}
+payments:
+  domains:
+    fxtun.ru:
+      message: "${FXT_TEST_MESSAGE:-Payments are paused}"
+`
+	require.NoError(t, os.WriteFile(cfgFile, []byte(yaml), 0600))
+
+	cfg, err := LoadServerConfig(cfgFile)
+	require.NoError(t, err)
+	assert.Equal(t, 5555, cfg.Server.ControlPort)
+	assert.Equal(t, "example.com", cfg.Domain.Base)
+	assert.Equal(t, "jwt-secret-from-the-environment-0123", cfg.Auth.JWTSecret)
+	assert.Equal(t, "jwt-secret-from-the-environment-0123", cfg.YooKassa.SecretKey)
+	assert.Equal(t, "Payments are paused", cfg.Payments.Domains["fxtun.ru"].Message)
+}
+
+func TestLoadServerConfig_EnvUnset(t *testing.T) {
+	cfgFile := filepath.Join(t.TempDir(), "server.yaml")
+	require.NoError(t, os.WriteFile(cfgFile, []byte("auth:\n  jwt_secret: ${FXT_TEST_UNSET}\n"), 0600))
+
+	_, err := LoadServerConfig(cfgFile)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "auth.jwt_secret: environment variable FXT_TEST_UNSET is not set")
+}
+
+func TestLoadClientConfig_EnvExpansion(t *testing.T) {
+	t.Setenv("FXT_TEST_TOKEN", "sk_from_env")
+	t.Setenv("FXT_TEST_PORT", "3000")
+	cfgFile := filepath.Join(t.TempDir(), "client.yaml")
+	yaml := `
+server:
+  address: "myserver.com:5555"
+  token: ${FXT_TEST_TOKEN}
+tunnels:
+  - name: web
+    type: http
+    local_port: ${FXT_TEST_PORT}
+    subdomain: ${FXT_TEST_SUBDOMAIN:-myapp}
+`
+	require.NoError(t, os.WriteFile(cfgFile, []byte(yaml), 0600))
+
+	cfg, err := LoadClientConfig(cfgFile)
+	require.NoError(t, err)
+	assert.Equal(t, "sk_from_env", cfg.Server.Token)
+	require.Len(t, cfg.Tunnels, 1)
+	assert.Equal(t, 3000, cfg.Tunnels[0].LocalPort)
+	assert.Equal(t, "myapp", cfg.Tunnels[0].Subdomain)
+
+	require.NoError(t, os.WriteFile(cfgFile, []byte("tunnels:\n  - name: web\n    type: http\n    local_port: ${FXT_TEST_UNSET}\n"), 0600))
+	_, err = LoadClientConfig(cfgFile)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "tunnels[0].local_port: environment variable FXT_TEST_UNSET is not set")
+}
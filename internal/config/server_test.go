@@ -1,9 +1,12 @@
 package config
 
 import (
+	"encoding/base64"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -64,6 +67,43 @@ func TestServerConfigValidate_TLSWithCerts(t *testing.T) {
 	assert.NoError(t, cfg.Validate())
 }
 
+func TestServerConfigValidate_ACMEDNSProvider(t *testing.T) {
+	cfg := validServerConfig()
+	cfg.TLS = TLSSettings{Enabled: true, ACMEDNSProvider: "exec", ACMEDNSExec: "/usr/local/bin/dns-hook"}
+	assert.NoError(t, cfg.Validate(), "wildcard issuance replaces static certs")
+
+	cfg.TLS.ACMEDNSExec = ""
+	assert.Error(t, cfg.Validate(), "exec without a command")
+
+	cfg.TLS = TLSSettings{ACMEDNSProvider: "builtin"}
+	assert.Error(t, cfg.Validate(), "builtin without the DNS server")
+	cfg.DNS = DNSSettings{Enabled: true, Listen: ":53", ZoneFile: "/etc/fxtunnel/zones.yaml"}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.TLS.ACMEDNSProvider = "route53"
+	assert.Error(t, cfg.Validate())
+}
+
+func TestServerConfigValidate_SessionTicketKeys(t *testing.T) {
+	hexKey := strings.Repeat("ab", 32)
+	b64Key := base64.StdEncoding.EncodeToString(make([]byte, 32))
+
+	cfg := validServerConfig()
+	cfg.TLS.SessionTicketKeys = []string{hexKey, b64Key}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.TLS.SessionTicketKeys = []string{hexKey, "short"}
+	assert.Error(t, cfg.Validate())
+
+	cfg.TLS.SessionTicketKeys = []string{hexKey}
+	cfg.TLS.SessionTicketKeysFile = "/etc/fxtunnel/ticket-keys"
+	assert.Error(t, cfg.Validate(), "keys and file together")
+
+	key, err := ParseSessionTicketKey(hexKey)
+	require.NoError(t, err)
+	assert.Equal(t, byte(0xab), key[31])
+}
+
 func TestFindToken(t *testing.T) {
 	cfg := validServerConfig()
 	cfg.Auth.Tokens = []TokenConfig{
@@ -149,6 +189,287 @@ func TestValidate_SecretsNotRequiredWhenWebDisabled(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestValidate_UnifiedRequiresWeb(t *testing.T) {
+	cfg := validServerConfig()
+	cfg.Web.Unified.Enabled = true
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "web.unified.enabled")
+}
+
+func TestValidate_NegativeReplayLimits(t *testing.T) {
+	cfg := validServerConfig()
+	cfg.Web.Replay.MaxConcurrent = -1
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "web.replay")
+}
+
+func TestValidate_NegativeHistoryRetention(t *testing.T) {
+	cfg := validServerConfig()
+	cfg.History.RetentionDays = -1
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "history.retention_days")
+}
+
+func TestValidate_NegativeResumeWindow(t *testing.T) {
+	cfg := validServerConfig()
+	cfg.Server.ResumeWindow = -time.Second
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "server.resume_window")
+}
+
+func TestValidate_ShortRestoreSecret(t *testing.T) {
+	cfg := validServerConfig()
+	cfg.Server.RestoreSecret = "too-short"
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "server.restore_secret")
+
+	cfg.Server.RestoreSecret = strings.Repeat("k", 32)
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestValidate_NegativeMaxMessageSize(t *testing.T) {
+	cfg := validServerConfig()
+	cfg.Server.MaxMessageSize = -1
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "server.max_message_size")
+}
+
+func TestValidate_UnknownMessages(t *testing.T) {
+	for _, mode := range []string{"", UnknownMessagesIgnore, UnknownMessagesLog, UnknownMessagesDisconnect} {
+		cfg := validServerConfig()
+		cfg.Server.UnknownMessages = mode
+		assert.NoError(t, cfg.Validate(), "unknown_messages %q should be valid", mode)
+	}
+
+	cfg := validServerConfig()
+	cfg.Server.UnknownMessages = "panic"
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "server.unknown_messages")
+}
+
+func TestValidate_AccessLog(t *testing.T) {
+	for _, format := range []string{"", AccessLogCombined, AccessLogJSON} {
+		cfg := validServerConfig()
+		cfg.Server.AccessLog.Format = format
+		assert.NoError(t, cfg.Validate(), "access log format %q should be valid", format)
+	}
+
+	cfg := validServerConfig()
+	cfg.Server.AccessLog.Format = "common"
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "server.access_log.format")
+
+	cfg = validServerConfig()
+	cfg.Server.AccessLog.BufferSize = -1
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidate_NegativeTunnelCacheMaxSize(t *testing.T) {
+	cfg := validServerConfig()
+	cfg.Server.TunnelCacheMaxSize = -1
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "server.tunnel_cache_max_size")
+}
+
+func TestValidate_NegativeMaxRequestBytes(t *testing.T) {
+	cfg := validServerConfig()
+	cfg.Server.MaxRequestBytes = -1
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "server.max_request_bytes")
+}
+
+func TestValidate_DrainStatusAddr(t *testing.T) {
+	cfg := validServerConfig()
+	cfg.Server.DrainStatusAddr = "127.0.0.1:9465"
+	require.NoError(t, cfg.Validate())
+
+	cfg.Server.DrainStatusAddr = "9465"
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "server.drain_status_addr")
+}
+
+func TestValidate_GitLabBaseURL(t *testing.T) {
+	cfg := validServerConfig()
+	cfg.OAuth.GitLab.BaseURL = "gitlab.example.com"
+	assert.NoError(t, cfg.Validate(), "base_url is not checked while GitLab is not configured")
+
+	cfg.OAuth.GitLab.ClientID = "id"
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "oauth.gitlab.base_url")
+
+	cfg.OAuth.GitLab.BaseURL = "https://gitlab.example.com/"
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestValidate_PlanDowngrade(t *testing.T) {
+	for _, mode := range []string{"", PlanDowngradeCloseNewest, PlanDowngradeCloseOldest, PlanDowngradeKeep} {
+		cfg := validServerConfig()
+		cfg.Server.PlanDowngrade = mode
+		assert.NoError(t, cfg.Validate(), "plan_downgrade %q should be valid", mode)
+	}
+
+	cfg := validServerConfig()
+	cfg.Server.PlanDowngrade = "close_all"
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "server.plan_downgrade")
+}
+
+func TestValidate_StreamCompressionSkipTypes(t *testing.T) {
+	cfg := validServerConfig()
+	cfg.Server.StreamCompressionSkipTypes = []string{"tcp"}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Server.StreamCompressionSkipTypes = []string{"udp"}
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "server.stream_compression_skip_types")
+}
+
+func TestValidate_Interstitial(t *testing.T) {
+	for _, mode := range []string{"", InterstitialAll, InterstitialFree, InterstitialOff} {
+		cfg := validServerConfig()
+		cfg.Server.Interstitial.Mode = mode
+		assert.NoError(t, cfg.Validate(), "interstitial mode %q should be valid", mode)
+	}
+
+	cfg := validServerConfig()
+	cfg.Server.Interstitial.Mode = "paid"
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "server.interstitial.mode")
+
+	cfg = validServerConfig()
+	cfg.Server.Interstitial.ConsentTTL = -time.Hour
+	err = cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "server.interstitial.consent_ttl")
+}
+
+func TestValidate_Webhooks(t *testing.T) {
+	cfg := validServerConfig()
+	cfg.Server.Webhooks = WebhookSettings{
+		URL:    "https://hooks.example.com/fxtunnel",
+		Events: []string{WebhookTunnelCreated, WebhookTunnelError},
+	}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Server.Webhooks.URL = "hooks.example.com"
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "server.webhooks.url")
+
+	cfg.Server.Webhooks.URL = "https://hooks.example.com/fxtunnel"
+	cfg.Server.Webhooks.Events = []string{"tunnel.renamed"}
+	err = cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "server.webhooks.events")
+}
+
+func TestValidate_Reputation(t *testing.T) {
+	cfg := validServerConfig()
+	cfg.Server.Reputation = ReputationSettings{Provider: ReputationSafeBrowsing, APIKey: "key"}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Server.Reputation.APIKey = ""
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "server.reputation.api_key")
+
+	cfg.Server.Reputation = ReputationSettings{Provider: ReputationHTTP, URL: "https://rep.example.com/check", Action: ReputationSuspend}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Server.Reputation.URL = ""
+	err = cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "server.reputation.url")
+
+	cfg.Server.Reputation = ReputationSettings{Provider: "virustotal"}
+	err = cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "server.reputation.provider")
+
+	cfg.Server.Reputation = ReputationSettings{Provider: ReputationSafeBrowsing, APIKey: "key", Action: "ban"}
+	err = cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "server.reputation.action")
+}
+
+func TestValidate_SOCKS(t *testing.T) {
+	cfg := validServerConfig()
+	cfg.Server.SOCKS = SOCKSSettings{
+		Enabled:   true,
+		Allow:     []string{"example.com", "203.0.113.0/24", "2001:db8::1"},
+		Deny:      []string{"ads.example.com"},
+		DenyPorts: []int{25, 465},
+	}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Server.SOCKS.Deny = []string{"*.example.com"}
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "server.socks.deny")
+
+	cfg.Server.SOCKS.Deny = nil
+	cfg.Server.SOCKS.DenyPorts = []int{0}
+	err = cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "server.socks.deny_ports")
+
+	cfg.Server.SOCKS.DenyPorts = nil
+	cfg.Server.SOCKS.MaxConns = -1
+	err = cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "server.socks")
+}
+
+func TestValidate_GeoPolicy(t *testing.T) {
+	cfg := validServerConfig()
+	cfg.GeoIP.Policy = GeoPolicySettings{DenyCountries: []string{"XX", "ru"}, DenyASNs: []uint{14061}}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.GeoIP.Policy.AllowCountries = []string{"USA"}
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "geoip.policy.allow_countries")
+}
+
+func TestValidate_Listener(t *testing.T) {
+	cfg := validServerConfig()
+	cfg.Server.Listener.Backlog = -1
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "server.listener.backlog")
+
+	cfg = validServerConfig()
+	linger := -1
+	cfg.Server.Listener.Linger = &linger
+	err = cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "server.listener.linger")
+}
+
+func TestDashboardHosts(t *testing.T) {
+	cfg := validServerConfig()
+	cfg.Domain.Base = "example.com"
+	assert.Equal(t, []string{"example.com", "www.example.com"}, cfg.DashboardHosts())
+
+	cfg.Web.Unified.Hosts = []string{"app.example.com"}
+	assert.Equal(t, []string{"app.example.com"}, cfg.DashboardHosts())
+}
+
 func TestLoadServerConfig_Defaults(t *testing.T) {
 	// Use a temp dir with no config files so defaults are used
 	dir := t.TempDir()
@@ -165,6 +486,45 @@ func TestLoadServerConfig_Defaults(t *testing.T) {
 	assert.Equal(t, 20001, cfg.Server.UDPPortRange.Min)
 	assert.Equal(t, 30000, cfg.Server.UDPPortRange.Max)
 	assert.Equal(t, "localhost", cfg.Domain.Base)
+	assert.Zero(t, cfg.History.RetentionDays, "history is kept forever by default")
+	assert.Zero(t, cfg.History.MaxEntriesPerUser)
+	assert.Equal(t, 30*time.Second, cfg.Server.ResumeWindow)
+	assert.Equal(t, 1<<20, cfg.Server.MaxMessageSize)
+	assert.Equal(t, int64(32<<20), cfg.Server.TunnelCacheMaxSize)
+	assert.Equal(t, "https://gitlab.com", cfg.OAuth.GitLab.BaseURL)
+	assert.True(t, cfg.Server.BinaryControl)
+	assert.Equal(t, UnknownMessagesLog, cfg.Server.UnknownMessages)
+	assert.Equal(t, 0, cfg.Server.Listener.Backlog)
+	assert.True(t, cfg.Server.Listener.ReusePort)
+	assert.True(t, cfg.Server.Listener.ReuseAddr)
+	assert.Nil(t, cfg.Server.Listener.Linger)
+	assert.Equal(t, 15*time.Second, cfg.Web.Replay.Timeout)
+	assert.Equal(t, 30, cfg.Web.Replay.PerMin)
+	assert.Equal(t, 3, cfg.Web.Replay.MaxConcurrent)
+	assert.False(t, cfg.Server.SOCKS.Enabled)
+	assert.Equal(t, []int{25}, cfg.Server.SOCKS.DenyPorts)
+	assert.Equal(t, 10*time.Second, cfg.Server.SOCKS.DialTimeout)
+}
+
+func TestLoadServerConfig_Listener(t *testing.T) {
+	dir := t.TempDir()
+	cfgFile := filepath.Join(dir, "server.yaml")
+	yaml := `
+server:
+  listener:
+    backlog: 4096
+    reuse_addr: false
+    linger: 0
+`
+	require.NoError(t, os.WriteFile(cfgFile, []byte(yaml), 0600))
+
+	cfg, err := LoadServerConfig(cfgFile)
+	require.NoError(t, err)
+	assert.Equal(t, 4096, cfg.Server.Listener.Backlog)
+	assert.True(t, cfg.Server.Listener.ReusePort)
+	assert.False(t, cfg.Server.Listener.ReuseAddr)
+	require.NotNil(t, cfg.Server.Listener.Linger)
+	assert.Equal(t, 0, *cfg.Server.Listener.Linger)
 }
 
 func TestLoadServerConfig_FromFile(t *testing.T) {
@@ -555,6 +555,35 @@ func TestLargePayload(t *testing.T) {
 	assert.True(t, bytes.Equal(payload, body), "payload data should be identical")
 }
 
+// --- Test 8: Reconnect After Graceful Close ---
+
+func TestReconnectAfterGracefulClose(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping E2E test in short mode")
+	}
+
+	h := NewHarness(t)
+	// A dropped client keeps its tunnels this long; a closed one must not
+	h.ServerCfg.Server.ResumeWindow = time.Minute
+	h.Start()
+	t.Cleanup(func() { h.Stop() })
+
+	tunnels := []config.TunnelConfig{
+		{Name: "web", Type: "http", LocalPort: getFreePort(t), Subdomain: "restart"},
+	}
+	first := h.ConnectClient(tunnels)
+	require.Len(t, first.GetTunnels(), 1)
+
+	first.Close()
+	require.Eventually(t, func() bool {
+		return h.Server.GetStats().ActiveClients == 0
+	}, 5*time.Second, 20*time.Millisecond, "server should release the client without waiting for a resume")
+
+	second := h.ConnectClient(tunnels)
+	require.Len(t, second.GetTunnels(), 1, "subdomain should be free again")
+	assert.Contains(t, second.GetTunnels()[0].URL, "restart."+testDomain)
+}
+
 // --- helper ---
 
 func newClientFromCfg(t *testing.T, cfg *config.ClientConfig, log zerolog.Logger) *clientcore.Client {
@@ -0,0 +1,148 @@
+// Package i18n translates the user-facing text the server generates: API
+// errors, tunnel rejections and email subjects.
+//
+// Each locale is a JSON catalog in locales/ named after it (en.json,
+// ru.json) mapping message keys to text; adding a locale is a matter of
+// adding its catalog. Keys missing from a catalog fall back to the default
+// locale.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Default is the locale of untranslated text and of the keys' fallback.
+const Default = "en"
+
+// UserSetting is the user_settings key holding the locale a user chose.
+const UserSetting = "locale"
+
+//go:embed locales/*.json
+var catalogFiles embed.FS
+
+var (
+	// catalogs maps a locale to its messages by key
+	catalogs map[string]map[string]string
+	// keysByText maps a message of the default locale back to its key
+	keysByText map[string]string
+)
+
+func init() {
+	var err error
+	catalogs, err = loadCatalogs()
+	if err != nil {
+		panic(err)
+	}
+	keysByText = make(map[string]string, len(catalogs[Default]))
+	for key, text := range catalogs[Default] {
+		keysByText[text] = key
+	}
+}
+
+func loadCatalogs() (map[string]map[string]string, error) {
+	files, err := catalogFiles.ReadDir("locales")
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]map[string]string, len(files))
+	for _, f := range files {
+		data, err := catalogFiles.ReadFile(path.Join("locales", f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return nil, fmt.Errorf("i18n: catalog %s: %w", f.Name(), err)
+		}
+		result[strings.TrimSuffix(f.Name(), ".json")] = messages
+	}
+	if _, ok := result[Default]; !ok {
+		return nil, fmt.Errorf("i18n: no catalog for the default locale %q", Default)
+	}
+	return result, nil
+}
+
+// Locales returns the available locales, sorted.
+func Locales() []string {
+	locales := make([]string, 0, len(catalogs))
+	for l := range catalogs {
+		locales = append(locales, l)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Supported reports whether there is a catalog for locale.
+func Supported(locale string) bool {
+	_, ok := catalogs[locale]
+	return ok
+}
+
+// T returns the message for key in locale, formatted with args. A key the
+// locale lacks falls back to the default locale, and an unknown key is
+// returned as is.
+func T(locale, key string, args ...any) string {
+	text, ok := catalogs[locale][key]
+	if !ok {
+		text, ok = catalogs[Default][key]
+	}
+	if !ok {
+		text = key
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(text, args...)
+	}
+	return text
+}
+
+// Translate returns text, a message in the default locale, in locale. Text
+// that is not in the default catalog is returned unchanged.
+func Translate(locale, text string) string {
+	if locale == "" || locale == Default {
+		return text
+	}
+	key, ok := keysByText[text]
+	if !ok {
+		return text
+	}
+	if translated, ok := catalogs[locale][key]; ok {
+		return translated
+	}
+	return text
+}
+
+// Match returns the available locale an Accept-Language header prefers
+// most, empty when it names none of them. A regional tag such as ru-RU
+// matches its language.
+func Match(acceptLanguage string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q <= bestQ {
+			continue
+		}
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if Supported(tag) {
+			best, bestQ = tag, q
+			continue
+		}
+		if lang, _, ok := strings.Cut(tag, "-"); ok && Supported(lang) {
+			best, bestQ = lang, q
+		}
+	}
+	return best
+}
@@ -0,0 +1,63 @@
+package i18n
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCatalogsMatchDefault(t *testing.T) {
+	for _, locale := range Locales() {
+		for key, text := range catalogs[locale] {
+			def, ok := catalogs[Default][key]
+			if !assert.True(t, ok, "%s: key %s is not in the default catalog", locale, key) {
+				continue
+			}
+			assert.Equal(t, strings.Count(def, "%"), strings.Count(text, "%"), "%s: %s has different format verbs", locale, key)
+		}
+		for key := range catalogs[Default] {
+			assert.Contains(t, catalogs[locale], key, "%s: missing %s", locale, key)
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	assert.Equal(t, "Подписка истекает через 3 дн.", T("ru", "email.subject.subscription_expiring", 3))
+	assert.Equal(t, "Your subscription expires in 3 day(s)", T("en", "email.subject.subscription_expiring", 3))
+	assert.Equal(t, "Plan changed", T("de", "email.subject.plan_changed"), "unknown locales fall back to the default")
+	assert.Equal(t, "no.such.key", T("ru", "no.such.key"))
+}
+
+func TestTranslate(t *testing.T) {
+	assert.Equal(t, "требуется авторизация", Translate("ru", "unauthorized"))
+	assert.Equal(t, "unauthorized", Translate("en", "unauthorized"))
+	assert.Equal(t, "unauthorized", Translate("", "unauthorized"))
+	assert.Equal(t, "unauthorized", Translate("de", "unauthorized"))
+	assert.Equal(t, "something new", Translate("ru", "something new"))
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		header, want string
+	}{
+		{"", ""},
+		{"ru", "ru"},
+		{"ru-RU,ru;q=0.9,en-US;q=0.8,en;q=0.7", "ru"},
+		{"de-DE,de;q=0.9,en;q=0.5", "en"},
+		{"en;q=0.4, RU;q=0.8", "ru"},
+		{"de, fr;q=0.9", ""},
+		{"ru;q=0", ""},
+		{"ru;q=bad, en", "en"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Match(tt.header), tt.header)
+	}
+}
+
+func TestSupported(t *testing.T) {
+	assert.True(t, Supported("en"))
+	assert.True(t, Supported("ru"))
+	assert.False(t, Supported("de"))
+	assert.Equal(t, []string{"en", "ru"}, Locales())
+}
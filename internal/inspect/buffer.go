@@ -69,6 +69,17 @@ func (rb *RingBuffer) List(offset, limit int) []*CapturedExchange {
 	return result
 }
 
+// Range calls fn for each exchange newest-first until fn returns false.
+// fn runs on a snapshot taken under the lock, so a slow fn (searching
+// bodies) does not hold up Add, and fn may call back into the buffer.
+func (rb *RingBuffer) Range(fn func(ex *CapturedExchange) bool) {
+	for _, ex := range rb.List(0, rb.capacity) {
+		if !fn(ex) {
+			return
+		}
+	}
+}
+
 // Get finds an exchange by ID. Returns nil if not found.
 func (rb *RingBuffer) Get(id string) *CapturedExchange {
 	rb.mu.RLock()
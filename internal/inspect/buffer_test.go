@@ -53,6 +53,34 @@ func TestRingBuffer_Pagination(t *testing.T) {
 	assert.Equal(t, "e2", list[1].ID)
 }
 
+func TestRingBuffer_Range(t *testing.T) {
+	rb := NewRingBuffer(3)
+	for i := 0; i < 5; i++ {
+		rb.Add(makeExchange(fmt.Sprintf("e%d", i)))
+	}
+
+	var seen []string
+	rb.Range(func(ex *CapturedExchange) bool {
+		seen = append(seen, ex.ID)
+		return len(seen) < 2
+	})
+	assert.Equal(t, []string{"e4", "e3"}, seen)
+}
+
+func TestRingBuffer_RangeUnlocked(t *testing.T) {
+	rb := NewRingBuffer(3)
+	rb.Add(makeExchange("e0"))
+
+	var seen []string
+	rb.Range(func(ex *CapturedExchange) bool {
+		seen = append(seen, ex.ID)
+		rb.Add(makeExchange("e1")) // would deadlock under the read lock
+		return true
+	})
+	assert.Equal(t, []string{"e0"}, seen)
+	assert.Equal(t, 2, rb.Len())
+}
+
 func TestRingBuffer_GetByID(t *testing.T) {
 	rb := NewRingBuffer(5)
 	rb.Add(makeExchange("x"))
@@ -0,0 +1,36 @@
+package inspect
+
+import "fmt"
+
+// CaptureMode selects which exchanges a tunnel keeps in its buffer.
+type CaptureMode string
+
+const (
+	CaptureAll    CaptureMode = "all"    // every exchange (default)
+	CaptureErrors CaptureMode = "errors" // only responses with status >= 400
+	CaptureNone   CaptureMode = "none"   // nothing; bodies are not buffered at all
+)
+
+// ParseCaptureMode validates a capture mode; an empty string means CaptureAll.
+func ParseCaptureMode(s string) (CaptureMode, error) {
+	switch CaptureMode(s) {
+	case "", CaptureAll:
+		return CaptureAll, nil
+	case CaptureErrors:
+		return CaptureErrors, nil
+	case CaptureNone:
+		return CaptureNone, nil
+	}
+	return "", fmt.Errorf("unknown capture mode %q (want %q, %q or %q)", s, CaptureAll, CaptureErrors, CaptureNone)
+}
+
+// Keeps reports whether an exchange with the given status is stored.
+func (m CaptureMode) Keeps(status int) bool {
+	switch m {
+	case CaptureErrors:
+		return status >= 400
+	case CaptureNone:
+		return false
+	}
+	return true
+}
@@ -1,6 +1,7 @@
 package inspect
 
 import (
+	"io"
 	"net/http"
 	"time"
 )
@@ -12,6 +13,18 @@ type ReplayResult struct {
 	StatusCode int
 	Headers    http.Header
 	Body       []byte
+	// Truncated is set when the body was cut at MaxBodySize.
+	Truncated bool
+}
+
+// ReadBody reads up to limit bytes of a response body. truncated reports
+// whether the body went on past the limit.
+func ReadBody(r io.Reader, limit int) (body []byte, truncated bool, err error) {
+	body, err = io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if len(body) > limit {
+		return body[:limit], true, err
+	}
+	return body, false, err
 }
 
 type CapturedExchange struct {
@@ -34,6 +47,8 @@ type CapturedExchange struct {
 	ResponseHeaders  http.Header `json:"response_headers"`
 	ResponseBody     []byte      `json:"response_body,omitempty"`
 	ResponseBodySize int64       `json:"response_body_size"`
+	// ResponseTruncated marks a response body cut at the size limit.
+	ResponseTruncated bool `json:"response_truncated,omitempty"`
 }
 
 type ExchangeSummary struct {
@@ -50,6 +65,8 @@ type ExchangeSummary struct {
 	RequestBodySize  int64         `json:"request_body_size"`
 	ResponseBodySize int64         `json:"response_body_size"`
 	RemoteAddr       string        `json:"remote_addr"`
+	// ResponseTruncated marks a response body cut at the size limit.
+	ResponseTruncated bool `json:"response_truncated,omitempty"`
 }
 
 func (e *CapturedExchange) Summary() ExchangeSummary {
@@ -57,6 +74,6 @@ func (e *CapturedExchange) Summary() ExchangeSummary {
 		ID: e.ID, TunnelID: e.TunnelID, TraceID: e.TraceID, ReplayRef: e.ReplayRef, Timestamp: e.Timestamp, Duration: e.Duration,
 		Method: e.Method, Path: e.Path, Host: e.Host, StatusCode: e.StatusCode,
 		RequestBodySize: e.RequestBodySize, ResponseBodySize: e.ResponseBodySize,
-		RemoteAddr: e.RemoteAddr,
+		RemoteAddr: e.RemoteAddr, ResponseTruncated: e.ResponseTruncated,
 	}
 }
@@ -2,6 +2,7 @@ package inspect
 
 import (
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 )
@@ -62,3 +63,26 @@ func TestCapturedExchange_Summary(t *testing.T) {
 		t.Errorf("RemoteAddr: got %q, want %q", s.RemoteAddr, ex.RemoteAddr)
 	}
 }
+
+func TestReadBody(t *testing.T) {
+	tests := []struct {
+		body      string
+		limit     int
+		want      string
+		truncated bool
+	}{
+		{"", 4, "", false},
+		{"abc", 4, "abc", false},
+		{"abcd", 4, "abcd", false},
+		{"abcde", 4, "abcd", true},
+	}
+	for _, tt := range tests {
+		got, truncated, err := ReadBody(strings.NewReader(tt.body), tt.limit)
+		if err != nil {
+			t.Fatalf("ReadBody(%q): %v", tt.body, err)
+		}
+		if string(got) != tt.want || truncated != tt.truncated {
+			t.Errorf("ReadBody(%q, %d) = %q, %v; want %q, %v", tt.body, tt.limit, got, truncated, tt.want, tt.truncated)
+		}
+	}
+}
@@ -3,14 +3,20 @@ package inspect
 import (
 	"log"
 	"sync"
+	"sync/atomic"
 )
 
+// persistQueueSize is how many exchanges may wait to be persisted; more
+// are dropped rather than slowing the proxy down.
+const persistQueueSize = 10000
+
 // Store is an interface for persistent exchange storage.
 type Store interface {
 	Save(ex *CapturedExchange, userID int64) error
 	ListByTunnelID(tunnelID string, offset, limit int) ([]*CapturedExchange, int, error)
 	ListByHostAndUser(host string, userID int64, offset, limit int) ([]*CapturedExchange, int, error)
 	GetByID(id string) (*CapturedExchange, error)
+	GetByIDAndUser(id string, userID int64) (*CapturedExchange, error)
 	DeleteByTunnelID(tunnelID string) (int64, error)
 }
 
@@ -19,16 +25,33 @@ type persistJob struct {
 	userID int64
 }
 
+// PersistStats counts what became of the exchanges queued for the store.
+type PersistStats struct {
+	Queued    int   // waiting in the queue
+	Persisted int64 // saved
+	Failed    int64 // the store returned an error
+	Dropped   int64 // the queue was full
+}
+
 // Manager manages per-tunnel RingBuffers.
 type Manager struct {
 	mu          sync.RWMutex
 	buffers     map[string]*RingBuffer
 	userIDs     map[string]int64
+	modes       map[string]CaptureMode
+	redact      []string
 	capacity    int
 	maxBodySize int
 	store       Store
 	persistCh   chan *persistJob
 	persistWg   sync.WaitGroup
+
+	persisted atomic.Int64
+	failed    atomic.Int64
+	dropped   atomic.Int64
+	// dropping is set while the queue overflows, so a run of drops is
+	// logged once
+	dropping atomic.Bool
 }
 
 // NewManager creates a new Manager. If capacity is 0, inspection is disabled.
@@ -36,6 +59,8 @@ func NewManager(capacity, maxBodySize int) *Manager {
 	return &Manager{
 		buffers:     make(map[string]*RingBuffer),
 		userIDs:     make(map[string]int64),
+		modes:       make(map[string]CaptureMode),
+		redact:      DefaultRedactParams,
 		capacity:    capacity,
 		maxBodySize: maxBodySize,
 	}
@@ -45,18 +70,42 @@ func NewManager(capacity, maxBodySize int) *Manager {
 func (m *Manager) SetStore(store Store) {
 	m.store = store
 	if store != nil {
-		m.persistCh = make(chan *persistJob, 10000)
+		m.persistCh = make(chan *persistJob, persistQueueSize)
 		m.persistWg.Add(1)
 		go m.persistWorker()
 	}
 }
 
+// persistWorker saves queued exchanges. While the store keeps failing
+// (a full disk, a locked table) only the first and the recovery are
+// logged; the exchanges stay in the in-memory buffers either way.
 func (m *Manager) persistWorker() {
 	defer m.persistWg.Done()
+	var failures int64
 	for job := range m.persistCh {
 		if err := m.store.Save(job.ex, job.userID); err != nil {
-			log.Printf("[inspect] failed to persist exchange %s: %v", job.ex.ID, err)
+			m.failed.Add(1)
+			if failures == 0 {
+				log.Printf("[inspect] failed to persist exchange %s, live inspection continues: %v", job.ex.ID, err)
+			}
+			failures++
+			continue
 		}
+		m.persisted.Add(1)
+		if failures > 0 {
+			log.Printf("[inspect] persisting exchanges again after %d failures", failures)
+			failures = 0
+		}
+	}
+}
+
+// PersistStats returns the persistence counters.
+func (m *Manager) PersistStats() PersistStats {
+	return PersistStats{
+		Queued:    len(m.persistCh),
+		Persisted: m.persisted.Load(),
+		Failed:    m.failed.Load(),
+		Dropped:   m.dropped.Load(),
 	}
 }
 
@@ -73,6 +122,25 @@ func (m *Manager) MaxBodySize() int {
 // GetOrCreate returns the RingBuffer for the given tunnel ID, creating one if needed.
 // Returns nil if the manager is disabled.
 func (m *Manager) GetOrCreate(tunnelID string) *RingBuffer {
+	return m.getOrCreate(tunnelID, m.capacity)
+}
+
+// GetOrCreateWithUser returns the RingBuffer for the given tunnel ID and tracks the user ID.
+// A new buffer keeps capacity exchanges, the manager's capacity if capacity is 0 or less.
+func (m *Manager) GetOrCreateWithUser(tunnelID string, userID int64, capacity int) *RingBuffer {
+	if capacity <= 0 {
+		capacity = m.capacity
+	}
+	buf := m.getOrCreate(tunnelID, capacity)
+	if buf != nil {
+		m.mu.Lock()
+		m.userIDs[tunnelID] = userID
+		m.mu.Unlock()
+	}
+	return buf
+}
+
+func (m *Manager) getOrCreate(tunnelID string, capacity int) *RingBuffer {
 	if !m.Enabled() {
 		return nil
 	}
@@ -91,20 +159,58 @@ func (m *Manager) GetOrCreate(tunnelID string) *RingBuffer {
 	if buf, ok = m.buffers[tunnelID]; ok {
 		return buf
 	}
-	buf = NewRingBuffer(m.capacity)
+	buf = NewRingBuffer(capacity)
 	m.buffers[tunnelID] = buf
 	return buf
 }
 
-// GetOrCreateWithUser returns the RingBuffer for the given tunnel ID and tracks the user ID.
-func (m *Manager) GetOrCreateWithUser(tunnelID string, userID int64) *RingBuffer {
-	buf := m.GetOrCreate(tunnelID)
-	if buf != nil {
-		m.mu.Lock()
-		m.userIDs[tunnelID] = userID
-		m.mu.Unlock()
+// SetCaptureMode sets which exchanges are kept for the given tunnel.
+func (m *Manager) SetCaptureMode(tunnelID string, mode CaptureMode) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if mode == CaptureAll || mode == "" {
+		delete(m.modes, tunnelID)
+		return
 	}
-	return buf
+	m.modes[tunnelID] = mode
+}
+
+// CaptureMode returns the capture mode of the given tunnel.
+func (m *Manager) CaptureMode(tunnelID string) CaptureMode {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if mode, ok := m.modes[tunnelID]; ok {
+		return mode
+	}
+	return CaptureAll
+}
+
+// Captures reports whether an exchange with the given status should be
+// stored for the tunnel under its capture mode.
+func (m *Manager) Captures(tunnelID string, status int) bool {
+	m.mu.RLock()
+	mode := m.modes[tunnelID]
+	m.mu.RUnlock()
+	return mode.Keeps(status)
+}
+
+// SetRedactParams replaces the query parameters masked in captured paths.
+// An empty list keeps DefaultRedactParams.
+func (m *Manager) SetRedactParams(params []string) {
+	if len(params) == 0 {
+		params = DefaultRedactParams
+	}
+	m.mu.Lock()
+	m.redact = params
+	m.mu.Unlock()
+}
+
+// RedactPath masks the configured secret query parameters in path.
+func (m *Manager) RedactPath(path string) string {
+	m.mu.RLock()
+	params := m.redact
+	m.mu.RUnlock()
+	return RedactPath(path, params)
 }
 
 // Get returns the RingBuffer for the given tunnel ID, or nil if not found.
@@ -115,7 +221,14 @@ func (m *Manager) Get(tunnelID string) *RingBuffer {
 }
 
 // AddAndPersist adds the exchange to the in-memory buffer and enqueues async DB persistence.
+// It never blocks: when the queue is full the exchange is only kept in memory.
+// Exchanges the tunnel's capture mode filters out are dropped; secret query
+// parameters are masked in the stored path.
 func (m *Manager) AddAndPersist(tunnelID string, ex *CapturedExchange) {
+	if !m.Captures(tunnelID, ex.StatusCode) {
+		return
+	}
+	ex.Path = m.RedactPath(ex.Path)
 	buf := m.Get(tunnelID)
 	if buf != nil {
 		buf.Add(ex)
@@ -130,8 +243,12 @@ func (m *Manager) AddAndPersist(tunnelID string, ex *CapturedExchange) {
 
 	select {
 	case m.persistCh <- &persistJob{ex: ex, userID: userID}:
+		m.dropping.Store(false)
 	default:
-		log.Printf("[inspect] persist queue full, dropping exchange %s", ex.ID)
+		m.dropped.Add(1)
+		if !m.dropping.Swap(true) {
+			log.Printf("[inspect] persist queue full, dropping exchanges until it drains")
+		}
 	}
 }
 
@@ -159,6 +276,15 @@ func (m *Manager) GetPersisted(id string) (*CapturedExchange, error) {
 	return m.store.GetByID(id)
 }
 
+// GetPersistedByUser is GetPersisted limited to exchanges captured on the
+// user's tunnels.
+func (m *Manager) GetPersistedByUser(id string, userID int64) (*CapturedExchange, error) {
+	if m.store == nil {
+		return nil, nil
+	}
+	return m.store.GetByIDAndUser(id, userID)
+}
+
 // Remove closes and removes the buffer for the given tunnel ID.
 func (m *Manager) Remove(tunnelID string) {
 	m.mu.Lock()
@@ -167,18 +293,24 @@ func (m *Manager) Remove(tunnelID string) {
 		delete(m.buffers, tunnelID)
 	}
 	delete(m.userIDs, tunnelID)
+	delete(m.modes, tunnelID)
 	m.mu.Unlock()
 	if ok {
 		buf.Close()
 	}
 }
 
-// ForEach calls fn for each tunnel's RingBuffer under a read lock.
-// The callback receives the tunnel ID and its buffer.
+// ForEach calls fn for each tunnel's RingBuffer. The callback receives
+// the tunnel ID and its buffer; it runs after the read lock is released,
+// so a search across buffers does not hold up tunnels coming and going.
 func (m *Manager) ForEach(fn func(tunnelID string, buf *RingBuffer)) {
 	m.mu.RLock()
-	defer m.mu.RUnlock()
+	buffers := make(map[string]*RingBuffer, len(m.buffers))
 	for id, buf := range m.buffers {
+		buffers[id] = buf
+	}
+	m.mu.RUnlock()
+	for id, buf := range buffers {
 		fn(id, buf)
 	}
 }
@@ -195,6 +327,7 @@ func (m *Manager) Close() {
 	buffers := m.buffers
 	m.buffers = make(map[string]*RingBuffer)
 	m.userIDs = make(map[string]int64)
+	m.modes = make(map[string]CaptureMode)
 	m.mu.Unlock()
 	for _, buf := range buffers {
 		buf.Close()
@@ -1,8 +1,11 @@
 package inspect
 
 import (
+	"errors"
+	"fmt"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -50,24 +53,49 @@ func TestManager_Disabled(t *testing.T) {
 func TestManager_GetOrCreateWithUser(t *testing.T) {
 	m := NewManager(64, 4096)
 
-	buf := m.GetOrCreateWithUser("tunnel-1", 42)
+	buf := m.GetOrCreateWithUser("tunnel-1", 42, 0)
 	require.NotNil(t, buf)
 
 	// Verify same buffer returned
-	buf2 := m.GetOrCreateWithUser("tunnel-1", 42)
+	buf2 := m.GetOrCreateWithUser("tunnel-1", 42, 0)
 	assert.Same(t, buf, buf2)
 }
 
+func TestManager_GetOrCreateWithUserCapacity(t *testing.T) {
+	m := NewManager(4, 4096)
+
+	fill := func(buf *RingBuffer) {
+		for i := 0; i < 10; i++ {
+			buf.Add(&CapturedExchange{ID: fmt.Sprintf("ex-%d", i)})
+		}
+	}
+
+	big := m.GetOrCreateWithUser("tunnel-pro", 1, 8)
+	fill(big)
+	assert.Equal(t, 8, big.Len())
+
+	def := m.GetOrCreateWithUser("tunnel-free", 2, 0)
+	fill(def)
+	assert.Equal(t, 4, def.Len(), "capacity 0 falls back to the manager's")
+
+	assert.Same(t, big, m.GetOrCreateWithUser("tunnel-pro", 1, 2), "an existing buffer keeps its capacity")
+}
+
 // mockStore is a thread-safe in-memory store for testing.
 type mockStore struct {
-	mu    sync.Mutex
-	saved []*CapturedExchange
+	mu      sync.Mutex
+	saved   []*CapturedExchange
+	userIDs map[string]int64
 }
 
 func (s *mockStore) Save(ex *CapturedExchange, userID int64) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.saved = append(s.saved, ex)
+	if s.userIDs == nil {
+		s.userIDs = make(map[string]int64)
+	}
+	s.userIDs[ex.ID] = userID
 	return nil
 }
 
@@ -106,6 +134,16 @@ func (s *mockStore) GetByID(id string) (*CapturedExchange, error) {
 	return nil, nil
 }
 
+func (s *mockStore) GetByIDAndUser(id string, userID int64) (*CapturedExchange, error) {
+	ex, _ := s.GetByID(id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ex == nil || s.userIDs[id] != userID {
+		return nil, nil
+	}
+	return ex, nil
+}
+
 func (s *mockStore) DeleteByTunnelID(tunnelID string) (int64, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -135,7 +173,7 @@ func TestManager_AddAndPersist(t *testing.T) {
 	store := &mockStore{}
 	m.SetStore(store)
 
-	m.GetOrCreateWithUser("tunnel-1", 42)
+	m.GetOrCreateWithUser("tunnel-1", 42, 0)
 
 	ex := &CapturedExchange{ID: "ex-1", TunnelID: "tunnel-1", Method: "GET", Path: "/test"}
 	m.AddAndPersist("tunnel-1", ex)
@@ -148,6 +186,61 @@ func TestManager_AddAndPersist(t *testing.T) {
 	assert.Equal(t, "ex-1", saved[0].ID)
 }
 
+func TestManager_CaptureErrorsOnly(t *testing.T) {
+	m := NewManager(64, 4096)
+	store := &mockStore{}
+	m.SetStore(store)
+
+	m.GetOrCreateWithUser("tunnel-1", 42, 0)
+	m.SetCaptureMode("tunnel-1", CaptureErrors)
+	assert.True(t, m.Captures("tunnel-2", 200), "other tunnels keep capturing everything")
+
+	m.AddAndPersist("tunnel-1", &CapturedExchange{ID: "ok", TunnelID: "tunnel-1", StatusCode: 200})
+	m.AddAndPersist("tunnel-1", &CapturedExchange{ID: "missing", TunnelID: "tunnel-1", StatusCode: 404})
+	m.AddAndPersist("tunnel-1", &CapturedExchange{ID: "boom", TunnelID: "tunnel-1", StatusCode: 502})
+
+	list := m.Get("tunnel-1").List(0, 10)
+	require.Len(t, list, 2)
+	assert.Equal(t, "boom", list[0].ID)
+	assert.Equal(t, "missing", list[1].ID)
+
+	m.Close()
+	assert.Len(t, store.getSaved(), 2)
+}
+
+func TestParseCaptureMode(t *testing.T) {
+	mode, err := ParseCaptureMode("")
+	require.NoError(t, err)
+	assert.Equal(t, CaptureAll, mode)
+
+	mode, err = ParseCaptureMode("errors")
+	require.NoError(t, err)
+	assert.Equal(t, CaptureErrors, mode)
+	assert.False(t, mode.Keeps(399))
+	assert.True(t, mode.Keeps(400))
+
+	mode, err = ParseCaptureMode("none")
+	require.NoError(t, err)
+	assert.Equal(t, CaptureNone, mode)
+	assert.False(t, mode.Keeps(200))
+	assert.False(t, mode.Keeps(500))
+
+	_, err = ParseCaptureMode("slow")
+	assert.Error(t, err)
+}
+
+func TestManager_CaptureMode(t *testing.T) {
+	m := NewManager(64, 4096)
+	assert.Equal(t, CaptureAll, m.CaptureMode("tunnel-1"))
+
+	m.SetCaptureMode("tunnel-1", CaptureNone)
+	assert.Equal(t, CaptureNone, m.CaptureMode("tunnel-1"))
+	assert.False(t, m.Captures("tunnel-1", 500))
+
+	m.Remove("tunnel-1")
+	assert.Equal(t, CaptureAll, m.CaptureMode("tunnel-1"))
+}
+
 func TestManager_AddAndPersist_NoUserID(t *testing.T) {
 	m := NewManager(64, 4096)
 	store := &mockStore{}
@@ -206,3 +299,99 @@ func TestManager_GetPersisted(t *testing.T) {
 	require.NoError(t, err)
 	assert.Nil(t, ex2)
 }
+
+func TestManager_GetPersistedByUser(t *testing.T) {
+	m := NewManager(64, 4096)
+	store := &mockStore{}
+	m.SetStore(store)
+	require.NoError(t, store.Save(&CapturedExchange{ID: "ex-1", TunnelID: "tun-1"}, 42))
+
+	ex, err := m.GetPersistedByUser("ex-1", 42)
+	require.NoError(t, err)
+	require.NotNil(t, ex)
+
+	ex, err = m.GetPersistedByUser("ex-1", 7)
+	require.NoError(t, err)
+	assert.Nil(t, ex, "another user's exchange")
+}
+
+func TestManager_AddAndPersistRedactsPath(t *testing.T) {
+	m := NewManager(64, 4096)
+	store := &mockStore{}
+	m.SetStore(store)
+	m.GetOrCreateWithUser("tunnel-1", 42, 0)
+
+	m.AddAndPersist("tunnel-1", &CapturedExchange{ID: "ex-1", TunnelID: "tunnel-1", Path: "/cb?token=abc&page=2", StatusCode: 200})
+
+	list := m.Get("tunnel-1").List(0, 10)
+	require.Len(t, list, 1)
+	assert.Equal(t, "/cb?token=***&page=2", list[0].Path)
+
+	m.Close()
+	saved := store.getSaved()
+	require.Len(t, saved, 1)
+	assert.Equal(t, "/cb?token=***&page=2", saved[0].Path)
+}
+
+// failingStore is a store whose writes fail, like one on a full disk; a
+// non-nil block makes every write wait on it instead.
+type failingStore struct {
+	mockStore
+	block chan struct{}
+}
+
+func (s *failingStore) Save(ex *CapturedExchange, userID int64) error {
+	if s.block != nil {
+		<-s.block
+	}
+	return errors.New("no space left on device")
+}
+
+func TestManager_PersistFailureKeepsLiveInspection(t *testing.T) {
+	m := NewManager(64, 4096)
+	m.SetStore(&failingStore{})
+	buf := m.GetOrCreateWithUser("tunnel-1", 42, 0)
+	sub := buf.Subscribe()
+
+	m.AddAndPersist("tunnel-1", &CapturedExchange{ID: "ex-1", TunnelID: "tunnel-1"})
+	m.AddAndPersist("tunnel-1", &CapturedExchange{ID: "ex-2", TunnelID: "tunnel-1"})
+
+	assert.Equal(t, "ex-1", (<-sub).ID)
+	assert.Equal(t, "ex-2", (<-sub).ID)
+	assert.Equal(t, 2, buf.Len())
+
+	m.Close()
+	assert.Equal(t, PersistStats{Failed: 2}, m.PersistStats())
+}
+
+func TestManager_PersistQueueFullDrops(t *testing.T) {
+	m := NewManager(64, 4096)
+	store := &failingStore{block: make(chan struct{})}
+	m.SetStore(store)
+	m.GetOrCreateWithUser("tunnel-1", 42, 0)
+	m.AddAndPersist("tunnel-1", &CapturedExchange{ID: "ex-first", TunnelID: "tunnel-1"})
+	require.Eventually(t, func() bool { return m.PersistStats().Queued == 0 }, 5*time.Second, time.Millisecond,
+		"the worker is stuck writing the first exchange")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < persistQueueSize+10; i++ {
+			m.AddAndPersist("tunnel-1", &CapturedExchange{ID: fmt.Sprintf("ex-%d", i), TunnelID: "tunnel-1"})
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("AddAndPersist blocked on a stalled store")
+	}
+
+	stats := m.PersistStats()
+	assert.Equal(t, persistQueueSize, stats.Queued)
+	assert.Equal(t, int64(10), stats.Dropped)
+	assert.Equal(t, 64, m.Get("tunnel-1").Len(), "the buffer keeps the latest exchanges")
+
+	close(store.block)
+	m.Close()
+	assert.Equal(t, int64(persistQueueSize+1), m.PersistStats().Failed)
+}
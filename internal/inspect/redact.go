@@ -0,0 +1,55 @@
+package inspect
+
+import (
+	"net/url"
+	"strings"
+)
+
+// RedactedValue replaces the value of a redacted query parameter.
+const RedactedValue = "***"
+
+// DefaultRedactParams lists the query parameters masked in captured paths
+// when no explicit list is configured. It holds only names that always
+// carry a secret; generic ones such as key or sig are often ordinary
+// parameters and are left to inspect.redact_params.
+var DefaultRedactParams = []string{
+	"token", "access_token", "refresh_token", "id_token",
+	"api_key", "apikey", "secret", "client_secret",
+	"password", "passwd",
+}
+
+// RedactPath masks the values of the named query parameters in a request
+// URI. Parameter names match case-insensitively; order and all other
+// parameters are left untouched.
+func RedactPath(path string, params []string) string {
+	if len(params) == 0 {
+		return path
+	}
+	base, query, ok := strings.Cut(path, "?")
+	if !ok || query == "" {
+		return path
+	}
+
+	pairs := strings.Split(query, "&")
+	changed := false
+	for i, pair := range pairs {
+		name, _, hasValue := strings.Cut(pair, "=")
+		if !hasValue {
+			continue
+		}
+		if decoded, err := url.QueryUnescape(name); err == nil {
+			name = decoded
+		}
+		for _, p := range params {
+			if strings.EqualFold(name, p) {
+				pairs[i] = pair[:strings.IndexByte(pair, '=')+1] + RedactedValue
+				changed = true
+				break
+			}
+		}
+	}
+	if !changed {
+		return path
+	}
+	return base + "?" + strings.Join(pairs, "&")
+}
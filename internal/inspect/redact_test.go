@@ -0,0 +1,31 @@
+package inspect
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactPath(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		params []string
+		want   string
+	}{
+		{"no query", "/cb", DefaultRedactParams, "/cb"},
+		{"token", "/cb?token=abc", DefaultRedactParams, "/cb?token=***"},
+		{"keeps order and others", "/x?a=1&api_key=k&b=2", DefaultRedactParams, "/x?a=1&api_key=***&b=2"},
+		{"case insensitive", "/x?API_KEY=k", DefaultRedactParams, "/x?API_KEY=***"},
+		{"escaped name", "/x?api%5Fkey=k", DefaultRedactParams, "/x?api%5Fkey=***"},
+		{"flag without value", "/x?token", DefaultRedactParams, "/x?token"},
+		{"generic names kept", "/x?key=en&sig=1", DefaultRedactParams, "/x?key=en&sig=1"},
+		{"custom list", "/x?token=abc&session=s", []string{"session"}, "/x?token=abc&session=***"},
+		{"disabled", "/x?token=abc", nil, "/x?token=abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, RedactPath(tt.path, tt.params))
+		})
+	}
+}
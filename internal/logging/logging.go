@@ -0,0 +1,124 @@
+// Package logging builds the zerolog loggers of the server and the client.
+//
+// JSON entries of both share one field schema, so log aggregation can index
+// them without per-component mapping. Besides zerolog's level, time, message
+// and error, entries use these names wherever the value applies:
+//
+//	component  subsystem that wrote the entry (server, api, client, inspector, ...)
+//	tunnel_id  ID of the tunnel the entry is about
+//	client_id  ID of the connected client (server side)
+//	user_id    ID of the user account
+//	remote_ip  IP address of the remote peer, without the port
+//	event      machine-readable name of what happened, where one exists
+//
+// Components add their own fields next to these.
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+)
+
+// New sets the global level and returns a logger writing to w in the
+// configured format. Excluded fields are left out of both formats; JSON
+// entries are also limited to the included fields, if any are set.
+func New(w io.Writer, cfg config.LoggingSettings) zerolog.Logger {
+	lvl, err := zerolog.ParseLevel(cfg.Level)
+	if err != nil || cfg.Level == "" {
+		lvl = zerolog.InfoLevel
+	}
+	zerolog.SetGlobalLevel(lvl)
+
+	if cfg.Format == "json" {
+		if len(cfg.IncludeFields) > 0 || len(cfg.ExcludeFields) > 0 {
+			w = newFieldFilter(w, cfg.IncludeFields, cfg.ExcludeFields)
+		}
+		return zerolog.New(w).With().Timestamp().Logger()
+	}
+
+	output := zerolog.ConsoleWriter{
+		Out:           w,
+		TimeFormat:    time.RFC3339,
+		FieldsExclude: cfg.ExcludeFields,
+	}
+	return zerolog.New(output).With().Timestamp().Logger()
+}
+
+// RemoteIP returns the IP of a host:port address for the remote_ip field.
+// Addresses without a port are returned as they are.
+func RemoteIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// fieldFilter drops fields from JSON log entries. Entries come out with
+// their fields sorted by name.
+type fieldFilter struct {
+	w       io.Writer
+	include map[string]bool
+	exclude map[string]bool
+}
+
+// alwaysKept are the fields an entry cannot be read without.
+var alwaysKept = map[string]bool{
+	zerolog.LevelFieldName:     true,
+	zerolog.TimestampFieldName: true,
+	zerolog.MessageFieldName:   true,
+}
+
+func newFieldFilter(w io.Writer, include, exclude []string) *fieldFilter {
+	f := &fieldFilter{w: w, exclude: make(map[string]bool, len(exclude))}
+	if len(include) > 0 {
+		f.include = make(map[string]bool, len(include))
+		for _, name := range include {
+			f.include[name] = true
+		}
+	}
+	for _, name := range exclude {
+		f.exclude[name] = true
+	}
+	return f
+}
+
+func (f *fieldFilter) keep(name string) bool {
+	if alwaysKept[name] {
+		return true
+	}
+	if f.exclude[name] {
+		return false
+	}
+	return f.include == nil || f.include[name]
+}
+
+func (f *fieldFilter) Write(p []byte) (int, error) {
+	var entry map[string]json.RawMessage
+	if err := json.Unmarshal(p, &entry); err != nil {
+		// Not a single JSON object; pass it on untouched
+		return f.w.Write(p)
+	}
+	for name := range entry {
+		if !f.keep(name) {
+			delete(entry, name)
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(entry); err != nil {
+		return 0, err
+	}
+	if _, err := f.w.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
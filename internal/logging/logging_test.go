@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+)
+
+func decodeEntry(t *testing.T, line []byte) map[string]any {
+	t.Helper()
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(line, &entry), string(line))
+	return entry
+}
+
+func TestNew_JSONFields(t *testing.T) {
+	defer zerolog.SetGlobalLevel(zerolog.GlobalLevel())
+
+	var buf bytes.Buffer
+	log := New(&buf, config.LoggingSettings{
+		Level:         "debug",
+		Format:        "json",
+		ExcludeFields: []string{"client_id"},
+	})
+	log.Info().Str("component", "server").Str("client_id", "c1").Int64("user_id", 7).Msg("Client authenticated")
+
+	entry := decodeEntry(t, buf.Bytes())
+	assert.Equal(t, "info", entry["level"])
+	assert.Equal(t, "Client authenticated", entry["message"])
+	assert.Equal(t, "server", entry["component"])
+	assert.Equal(t, float64(7), entry["user_id"])
+	assert.Contains(t, entry, "time")
+	assert.NotContains(t, entry, "client_id")
+}
+
+func TestNew_JSONIncludeFields(t *testing.T) {
+	defer zerolog.SetGlobalLevel(zerolog.GlobalLevel())
+
+	var buf bytes.Buffer
+	log := New(&buf, config.LoggingSettings{
+		Format:        "json",
+		IncludeFields: []string{"tunnel_id", "remote_ip"},
+		ExcludeFields: []string{"remote_ip"},
+	})
+	log.Warn().Str("component", "monitor").Str("tunnel_id", "t1").Str("remote_ip", "203.0.113.7").Msg("<rate limited>")
+
+	entry := decodeEntry(t, buf.Bytes())
+	assert.Equal(t, map[string]any{
+		"level":     "warn",
+		"time":      entry["time"],
+		"message":   "<rate limited>",
+		"tunnel_id": "t1",
+	}, entry)
+	assert.Equal(t, byte('\n'), buf.Bytes()[buf.Len()-1])
+	assert.NotContains(t, buf.String(), `\u003c`, "HTML is not escaped")
+}
+
+func TestNew_Level(t *testing.T) {
+	defer zerolog.SetGlobalLevel(zerolog.GlobalLevel())
+
+	var buf bytes.Buffer
+	log := New(&buf, config.LoggingSettings{Level: "warn", Format: "json"})
+	log.Info().Msg("hidden")
+	assert.Zero(t, buf.Len())
+
+	New(&buf, config.LoggingSettings{Level: "bogus", Format: "json"})
+	assert.Equal(t, zerolog.InfoLevel, zerolog.GlobalLevel(), "unknown levels fall back to info")
+}
+
+func TestRemoteIP(t *testing.T) {
+	assert.Equal(t, "203.0.113.7", RemoteIP("203.0.113.7:51234"))
+	assert.Equal(t, "2001:db8::1", RemoteIP("[2001:db8::1]:443"))
+	assert.Equal(t, "203.0.113.7", RemoteIP("203.0.113.7"))
+}
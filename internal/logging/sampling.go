@@ -0,0 +1,50 @@
+package logging
+
+import (
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+)
+
+// NewSampler returns the sampler for lines written per request or per
+// connection, or nil when cfg does not sample.
+func NewSampler(cfg config.LoggingSettings) zerolog.Sampler {
+	var s sampler
+	if cfg.SampleEvery > 1 {
+		s.every = &zerolog.BasicSampler{N: uint32(cfg.SampleEvery)} //nolint:gosec // checked positive
+	}
+	if cfg.SamplePerSecond > 0 {
+		s.perSecond = &zerolog.BurstSampler{
+			Burst:  uint32(cfg.SamplePerSecond), //nolint:gosec // checked positive
+			Period: time.Second,
+		}
+	}
+	if s.every == nil && s.perSecond == nil {
+		return nil
+	}
+	return &s
+}
+
+// Sampled returns log with the sampling of cfg applied. Use it only for the
+// per-request and per-connection lines; everything else must stay complete.
+func Sampled(log zerolog.Logger, cfg config.LoggingSettings) zerolog.Logger {
+	if s := NewSampler(cfg); s != nil {
+		return log.Sample(s)
+	}
+	return log
+}
+
+// sampler passes a line when both the 1-in-N and the per-second sampler do.
+type sampler struct {
+	every     *zerolog.BasicSampler
+	perSecond *zerolog.BurstSampler
+}
+
+func (s *sampler) Sample(lvl zerolog.Level) bool {
+	if s.every != nil && !s.every.Sample(lvl) {
+		return false
+	}
+	return s.perSecond == nil || s.perSecond.Sample(lvl)
+}
@@ -0,0 +1,48 @@
+package logging
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+)
+
+func TestNewSampler_Off(t *testing.T) {
+	assert.Nil(t, NewSampler(config.LoggingSettings{}))
+	assert.Nil(t, NewSampler(config.LoggingSettings{SampleEvery: 1}))
+}
+
+func TestSampled_Every(t *testing.T) {
+	var buf bytes.Buffer
+	log := Sampled(zerolog.New(&buf), config.LoggingSettings{SampleEvery: 100})
+
+	for i := 0; i < 5000; i++ {
+		log.Info().Msg("request")
+	}
+	assert.Equal(t, 50, bytes.Count(buf.Bytes(), []byte("\n")))
+}
+
+func TestSampled_PerSecond(t *testing.T) {
+	var buf bytes.Buffer
+	log := Sampled(zerolog.New(&buf), config.LoggingSettings{SamplePerSecond: 20})
+
+	for i := 0; i < 1000; i++ {
+		log.Info().Msg("request")
+	}
+	assert.Equal(t, 20, bytes.Count(buf.Bytes(), []byte("\n")))
+}
+
+func TestSampled_Both(t *testing.T) {
+	s := NewSampler(config.LoggingSettings{SampleEvery: 10, SamplePerSecond: 3})
+
+	passed := 0
+	for i := 0; i < 1000; i++ {
+		if s.Sample(zerolog.InfoLevel) {
+			passed++
+		}
+	}
+	assert.Equal(t, 3, passed, "1 in 10 is 100, capped at 3 per second")
+}
@@ -3,9 +3,11 @@ package protocol
 import (
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"sync"
+	"sync/atomic"
 )
 
 const (
@@ -15,6 +17,44 @@ const (
 	HeaderSize = 4
 )
 
+// Encoding is the serialization used for control message payloads.
+type Encoding string
+
+const (
+	// EncodingJSON is the default, understood by every peer.
+	EncodingJSON Encoding = "json"
+	// EncodingMsgpack is a compact binary encoding negotiated at auth.
+	EncodingMsgpack Encoding = "msgpack"
+)
+
+// Marshal encodes v with the given encoding.
+func (e Encoding) Marshal(v any) ([]byte, error) {
+	if e == EncodingMsgpack {
+		return MarshalMsgpack(v)
+	}
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes data with the given encoding.
+func (e Encoding) Unmarshal(data []byte, v any) error {
+	if e == EncodingMsgpack {
+		return UnmarshalMsgpack(data, v)
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Frame errors. A peer that triggers one has violated the protocol and the
+// stream can no longer be trusted to be in sync.
+var (
+	ErrMessageTooLarge = errors.New("message too large")
+	ErrInvalidFrame    = errors.New("invalid frame")
+)
+
+// IsFrameError reports whether err is a frame-level protocol violation.
+func IsFrameError(err error) bool {
+	return errors.Is(err, ErrMessageTooLarge) || errors.Is(err, ErrInvalidFrame)
+}
+
 // codecBufPool reuses buffers for Encode to avoid per-message allocations.
 var codecBufPool = sync.Pool{
 	New: func() any {
@@ -26,9 +66,11 @@ var codecBufPool = sync.Pool{
 // Codec handles encoding and decoding of protocol messages.
 // Write operations are protected by a mutex for concurrent safety.
 type Codec struct {
-	reader io.Reader
-	writer io.Writer
-	wmu    sync.Mutex
+	reader   io.Reader
+	writer   io.Writer
+	wmu      sync.Mutex
+	maxSize  uint32       // 0 = MaxMessageSize
+	encoding atomic.Value // Encoding; unset = EncodingJSON
 }
 
 // NewCodec creates a new codec for the given reader/writer
@@ -39,16 +81,61 @@ func NewCodec(r io.Reader, w io.Writer) *Codec {
 	}
 }
 
+// SetMaxMessageSize limits the size of messages read and written by this
+// codec. n <= 0 or above MaxMessageSize restores the default. It must be
+// called before the codec is used.
+func (c *Codec) SetMaxMessageSize(n int) {
+	if n <= 0 || n > MaxMessageSize {
+		c.maxSize = 0
+		return
+	}
+	c.maxSize = uint32(n) //nolint:gosec // bounded by MaxMessageSize above
+}
+
+// SetEncoding switches the payload encoding for the messages that follow.
+// Both peers switch right after the auth or resume result. It is safe to
+// call while other goroutines use the codec, since the server may already
+// have registered the client by then.
+func (c *Codec) SetEncoding(e Encoding) {
+	c.encoding.Store(e)
+}
+
+// Encoding returns the payload encoding in use.
+func (c *Codec) Encoding() Encoding {
+	if e, _ := c.encoding.Load().(Encoding); e != "" {
+		return e
+	}
+	return EncodingJSON
+}
+
+func (c *Codec) limit() uint32 {
+	if c.maxSize == 0 {
+		return MaxMessageSize
+	}
+	return c.maxSize
+}
+
+// checkLength validates a frame length from a header or an outgoing payload.
+func (c *Codec) checkLength(length uint32) error {
+	if length == 0 {
+		return fmt.Errorf("%w: empty payload", ErrInvalidFrame)
+	}
+	if limit := c.limit(); length > limit {
+		return fmt.Errorf("%w: %d > %d", ErrMessageTooLarge, length, limit)
+	}
+	return nil
+}
+
 // Encode writes a message to the writer with length prefix.
 // Thread-safe: protected by write mutex.
 func (c *Codec) Encode(msg any) error {
-	data, err := json.Marshal(msg)
+	data, err := c.Encoding().Marshal(msg)
 	if err != nil {
 		return fmt.Errorf("marshal message: %w", err)
 	}
 
-	if len(data) > MaxMessageSize {
-		return fmt.Errorf("message too large: %d > %d", len(data), MaxMessageSize)
+	if len(data) > int(c.limit()) {
+		return fmt.Errorf("%w: %d > %d", ErrMessageTooLarge, len(data), c.limit())
 	}
 
 	// Write length prefix + payload in single write using pooled buffer
@@ -84,8 +171,8 @@ func (c *Codec) Decode(msg any) error {
 	}
 
 	length := binary.BigEndian.Uint32(header[:])
-	if length > MaxMessageSize {
-		return fmt.Errorf("message too large: %d > %d", length, MaxMessageSize)
+	if err := c.checkLength(length); err != nil {
+		return err
 	}
 
 	// Read payload using pooled buffer
@@ -102,7 +189,7 @@ func (c *Codec) Decode(msg any) error {
 		return fmt.Errorf("read payload: %w", err)
 	}
 
-	err := json.Unmarshal(buf, msg)
+	err := c.Encoding().Unmarshal(buf, msg)
 	*bp = buf[:0]
 	codecBufPool.Put(bp)
 	if err != nil {
@@ -112,7 +199,8 @@ func (c *Codec) Decode(msg any) error {
 	return nil
 }
 
-// DecodeRaw reads a message and returns raw JSON along with the base message
+// DecodeRaw reads a message and returns the raw payload, in the codec's
+// encoding, along with the base message
 func (c *Codec) DecodeRaw() ([]byte, *Message, error) {
 	// Read length prefix
 	header := make([]byte, HeaderSize)
@@ -121,8 +209,8 @@ func (c *Codec) DecodeRaw() ([]byte, *Message, error) {
 	}
 
 	length := binary.BigEndian.Uint32(header)
-	if length > MaxMessageSize {
-		return nil, nil, fmt.Errorf("message too large: %d > %d", length, MaxMessageSize)
+	if err := c.checkLength(length); err != nil {
+		return nil, nil, err
 	}
 
 	// Read payload
@@ -133,8 +221,11 @@ func (c *Codec) DecodeRaw() ([]byte, *Message, error) {
 
 	// Decode base message to get type
 	var msg Message
-	if err := json.Unmarshal(data, &msg); err != nil {
-		return nil, nil, fmt.Errorf("unmarshal base message: %w", err)
+	if err := c.Encoding().Unmarshal(data, &msg); err != nil {
+		return nil, nil, fmt.Errorf("%w: unmarshal base message: %v", ErrInvalidFrame, err)
+	}
+	if msg.Type == "" {
+		return nil, nil, fmt.Errorf("%w: missing message type", ErrInvalidFrame)
 	}
 
 	return data, &msg, nil
@@ -142,8 +233,8 @@ func (c *Codec) DecodeRaw() ([]byte, *Message, error) {
 
 // EncodeBytes writes raw bytes with length prefix
 func (c *Codec) EncodeBytes(data []byte) error {
-	if len(data) > MaxMessageSize {
-		return fmt.Errorf("message too large: %d > %d", len(data), MaxMessageSize)
+	if len(data) > int(c.limit()) {
+		return fmt.Errorf("%w: %d > %d", ErrMessageTooLarge, len(data), c.limit())
 	}
 
 	// Write length prefix + payload in single write using pooled buffer
@@ -172,6 +263,12 @@ func (c *Codec) EncodeBytes(data []byte) error {
 
 // ParseMessage parses raw JSON into the appropriate message type
 func ParseMessage(data []byte, msgType MessageType) (any, error) {
+	return EncodingJSON.ParseMessage(data, msgType)
+}
+
+// ParseMessage parses a payload in this encoding into the appropriate
+// message type
+func (e Encoding) ParseMessage(data []byte, msgType MessageType) (any, error) {
 	var msg any
 
 	switch msgType {
@@ -203,15 +300,25 @@ func ParseMessage(data []byte, msgType MessageType) (any, error) {
 		msg = &ErrorMessage{}
 	case MsgServerShutdown:
 		msg = &ServerShutdownMessage{}
+	case MsgClientShutdown:
+		msg = &ClientShutdownMessage{}
 	case MsgJoinSession:
 		msg = &JoinSessionMessage{}
 	case MsgJoinSessionResult:
 		msg = &JoinSessionResult{}
+	case MsgResumeSession:
+		msg = &ResumeSessionMessage{}
+	case MsgResumeSessionResult:
+		msg = &ResumeSessionResult{}
+	case MsgTunnelBatchRequest:
+		msg = &TunnelBatchRequestMessage{}
+	case MsgTunnelBatchResult:
+		msg = &TunnelBatchResultMessage{}
 	default:
 		return nil, fmt.Errorf("unknown message type: %s", msgType)
 	}
 
-	if err := json.Unmarshal(data, msg); err != nil {
+	if err := e.Unmarshal(data, msg); err != nil {
 		return nil, fmt.Errorf("unmarshal %s: %w", msgType, err)
 	}
 
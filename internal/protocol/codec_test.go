@@ -272,5 +272,56 @@ func TestDecodeRawInvalidJSON(t *testing.T) {
 	assert.Contains(t, err.Error(), "unmarshal")
 }
 
+func TestCodecMaxMessageSize(t *testing.T) {
+	var buf bytes.Buffer
+	header := make([]byte, HeaderSize)
+	binary.BigEndian.PutUint32(header, 2048)
+	buf.Write(header)
+	buf.Write(make([]byte, 2048))
+
+	codec := NewCodec(&buf, &buf)
+	codec.SetMaxMessageSize(1024)
+
+	_, _, err := codec.DecodeRaw()
+	require.ErrorIs(t, err, ErrMessageTooLarge)
+	assert.True(t, IsFrameError(err))
+	assert.Equal(t, 2048, buf.Len(), "payload must not be read")
+
+	err = codec.EncodeBytes(make([]byte, 1025))
+	require.ErrorIs(t, err, ErrMessageTooLarge)
+}
+
+func TestCodecSetMaxMessageSizeDefault(t *testing.T) {
+	codec := NewCodec(nil, nil)
+	codec.SetMaxMessageSize(MaxMessageSize * 4)
+	assert.Equal(t, uint32(MaxMessageSize), codec.limit())
+	codec.SetMaxMessageSize(0)
+	assert.Equal(t, uint32(MaxMessageSize), codec.limit())
+}
+
+func TestDecodeRawInvalidFrames(t *testing.T) {
+	frame := func(payload []byte) *bytes.Buffer {
+		var buf bytes.Buffer
+		header := make([]byte, HeaderSize)
+		binary.BigEndian.PutUint32(header, uint32(len(payload))) //nolint:gosec // test data, len() is small
+		buf.Write(header)
+		buf.Write(payload)
+		return &buf
+	}
+
+	tests := map[string][]byte{
+		"empty":        {},
+		"no type":      []byte(`{"timestamp":1}`),
+		"invalid json": []byte("{not json"),
+	}
+	for name, payload := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := NewCodec(frame(payload), nil).DecodeRaw()
+			require.ErrorIs(t, err, ErrInvalidFrame)
+			assert.True(t, IsFrameError(err))
+		})
+	}
+}
+
 // Ensure io import is used
 var _ io.Reader
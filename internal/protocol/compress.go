@@ -4,111 +4,205 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"strings"
 	"time"
 
+	"github.com/klauspost/compress/s2"
 	"github.com/klauspost/compress/zstd"
 )
 
+// Compression is a connection-level compression algorithm.
+type Compression byte
+
+// The values double as the server's answer in the handshake. The client
+// offers algorithm a as bit 1<<(a-1), so a zstd-only offer is the byte 0x01
+// that clients sent before algorithms other than zstd existed.
 const (
-	compressNone byte = 0x00
-	compressZstd byte = 0x01
+	CompressionNone   Compression = 0x00
+	CompressionZstd   Compression = 0x01
+	CompressionSnappy Compression = 0x02
 )
 
-// NegotiateCompression performs a 1-byte handshake and wraps conn in zstd if both sides agree.
-// For client: sends preference, reads server response.
-// For server: reads client preference, sends response.
-// Returns the (possibly wrapped) ReadWriteCloser, whether compression is active, and any error.
-func NegotiateCompression(conn net.Conn, wantCompress bool, isServer bool) (io.ReadWriteCloser, bool, error) {
-	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
-	defer func() { _ = conn.SetDeadline(time.Time{}) }()
+// snappyMaxBlock is the largest block of the Snappy framing format.
+const snappyMaxBlock = 64 << 10
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionZstd:
+		return "zstd"
+	case CompressionSnappy:
+		return "snappy"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(c))
+	}
+}
+
+// ParseCompression returns the algorithm called name (none, zstd or snappy).
+func ParseCompression(name string) (Compression, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "none":
+		return CompressionNone, nil
+	case "zstd":
+		return CompressionZstd, nil
+	case "snappy":
+		return CompressionSnappy, nil
+	default:
+		return CompressionNone, fmt.Errorf("unknown compression algorithm %q", name)
+	}
+}
 
-	var pref byte
-	if wantCompress {
-		pref = compressZstd
+// ParseCompressions parses a list of algorithm names, keeping their order.
+func ParseCompressions(names []string) ([]Compression, error) {
+	algs := make([]Compression, 0, len(names))
+	for _, name := range names {
+		alg, err := ParseCompression(name)
+		if err != nil {
+			return nil, err
+		}
+		algs = append(algs, alg)
 	}
+	return algs, nil
+}
+
+func (c Compression) offerBit() byte {
+	if c == CompressionNone || c > CompressionSnappy {
+		return 0
+	}
+	return 1 << (c - 1)
+}
+
+// NegotiateCompression performs a 1-byte handshake and wraps conn in the
+// agreed compression. The client sends the set of algorithms it accepts,
+// the server answers with the first of its own algorithms in that set, or
+// CompressionNone. No compression is always acceptable, so CompressionNone
+// in algorithms changes nothing; an empty list never compresses.
+// Returns the (possibly wrapped) ReadWriteCloser, the agreed algorithm, and any error.
+func NegotiateCompression(conn net.Conn, algorithms []Compression, isServer bool) (io.ReadWriteCloser, Compression, error) {
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+	defer func() { _ = conn.SetDeadline(time.Time{}) }()
 
 	if isServer {
-		// Server: read client preference
+		// Server: read the client's offer
 		buf := []byte{0}
 		if _, err := io.ReadFull(conn, buf); err != nil {
-			return nil, false, fmt.Errorf("read compression preference: %w", err)
+			return nil, CompressionNone, fmt.Errorf("read compression preference: %w", err)
 		}
-		clientWants := buf[0] == compressZstd
-
-		accepted := clientWants && wantCompress
-		var resp byte
-		if accepted {
-			resp = compressZstd
+		offer := buf[0]
+
+		chosen := CompressionNone
+		for _, alg := range algorithms {
+			if bit := alg.offerBit(); bit != 0 && offer&bit != 0 {
+				chosen = alg
+				break
+			}
 		}
-		if _, err := conn.Write([]byte{resp}); err != nil {
-			return nil, false, fmt.Errorf("write compression response: %w", err)
+		if _, err := conn.Write([]byte{byte(chosen)}); err != nil {
+			return nil, CompressionNone, fmt.Errorf("write compression response: %w", err)
 		}
-
-		if accepted {
-			return wrapZstd(conn)
-		}
-		return conn, false, nil
+		return wrapCompression(conn, chosen)
 	}
 
-	// Client: send preference, read response
-	if _, err := conn.Write([]byte{pref}); err != nil {
-		return nil, false, fmt.Errorf("write compression preference: %w", err)
+	// Client: send the offer, read the server's choice
+	var offer byte
+	for _, alg := range algorithms {
+		offer |= alg.offerBit()
+	}
+	if _, err := conn.Write([]byte{offer}); err != nil {
+		return nil, CompressionNone, fmt.Errorf("write compression preference: %w", err)
 	}
 
 	buf := []byte{0}
 	if _, err := io.ReadFull(conn, buf); err != nil {
-		return nil, false, fmt.Errorf("read compression response: %w", err)
+		return nil, CompressionNone, fmt.Errorf("read compression response: %w", err)
+	}
+	if buf[0] == rejectMarker {
+		// An unreadable reason still means the server refused us
+		buf[0] = 0
+		_, _ = io.ReadFull(conn, buf)
+		return nil, CompressionNone, &RejectedError{Reason: RejectReason(buf[0])}
 	}
+	chosen := Compression(buf[0])
+	if chosen != CompressionNone && offer&chosen.offerBit() == 0 {
+		return nil, CompressionNone, fmt.Errorf("server chose compression %s, which was not offered", chosen)
+	}
+	return wrapCompression(conn, chosen)
+}
 
-	if buf[0] == compressZstd && wantCompress {
+func wrapCompression(conn net.Conn, alg Compression) (io.ReadWriteCloser, Compression, error) {
+	switch alg {
+	case CompressionZstd:
 		return wrapZstd(conn)
+	case CompressionSnappy:
+		return wrapSnappy(conn), CompressionSnappy, nil
+	default:
+		return conn, CompressionNone, nil
 	}
-	return conn, false, nil
 }
 
-func wrapZstd(conn net.Conn) (io.ReadWriteCloser, bool, error) {
+func wrapZstd(conn net.Conn) (io.ReadWriteCloser, Compression, error) {
 	encoder, err := zstd.NewWriter(conn, zstd.WithEncoderLevel(zstd.SpeedDefault))
 	if err != nil {
-		return nil, false, fmt.Errorf("create zstd encoder: %w", err)
+		return nil, CompressionNone, fmt.Errorf("create zstd encoder: %w", err)
 	}
 	decoder, err := zstd.NewReader(conn)
 	if err != nil {
 		encoder.Close()
-		return nil, false, fmt.Errorf("create zstd decoder: %w", err)
+		return nil, CompressionNone, fmt.Errorf("create zstd decoder: %w", err)
 	}
 	return &compressedConn{
-		Conn:    conn,
-		encoder: encoder,
-		decoder: decoder,
-	}, true, nil
+		Conn:   conn,
+		reader: decoder,
+		writer: encoder,
+		close: func() {
+			encoder.Close()
+			decoder.Close()
+		},
+	}, CompressionZstd, nil
 }
 
-// compressedConn wraps a net.Conn with zstd compression.
+// wrapSnappy uses the Snappy framing format. It needs far less memory than
+// zstd, at a lower ratio.
+func wrapSnappy(conn net.Conn) io.ReadWriteCloser {
+	writer := s2.NewWriter(conn, s2.WriterSnappyCompat(), s2.WriterConcurrency(1))
+	return &compressedConn{
+		Conn:   conn,
+		reader: s2.NewReader(conn, s2.ReaderMaxBlockSize(snappyMaxBlock)),
+		writer: writer,
+		close:  func() { _ = writer.Close() },
+	}
+}
+
+// compressedConn wraps a net.Conn with a compressor and a decompressor.
 // It delegates all net.Conn methods except Read/Write/Close.
 type compressedConn struct {
 	net.Conn
-	encoder *zstd.Encoder
-	decoder *zstd.Decoder
+	reader io.Reader
+	writer interface {
+		io.Writer
+		Flush() error
+	}
+	close func()
 }
 
 func (c *compressedConn) Read(p []byte) (int, error) {
-	return c.decoder.Read(p)
+	return c.reader.Read(p)
 }
 
 func (c *compressedConn) Write(p []byte) (int, error) {
-	n, err := c.encoder.Write(p)
+	n, err := c.writer.Write(p)
 	if err != nil {
 		return n, err
 	}
 	// Flush to ensure data is sent immediately (important for interactive protocols)
-	if err := c.encoder.Flush(); err != nil {
+	if err := c.writer.Flush(); err != nil {
 		return n, err
 	}
 	return n, nil
 }
 
 func (c *compressedConn) Close() error {
-	c.encoder.Close()
-	c.decoder.Close()
+	c.close()
 	return c.Conn.Close()
 }
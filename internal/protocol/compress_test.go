@@ -0,0 +1,126 @@
+package protocol
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// negotiate runs both sides of the handshake over a pipe.
+func negotiate(t *testing.T, client, server []Compression) (io.ReadWriteCloser, io.ReadWriteCloser, Compression, Compression) {
+	t.Helper()
+	clientConn, serverConn := net.Pipe()
+	t.Cleanup(func() {
+		clientConn.Close()
+		serverConn.Close()
+	})
+
+	type result struct {
+		rwc io.ReadWriteCloser
+		alg Compression
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		rwc, alg, err := NegotiateCompression(serverConn, server, true)
+		done <- result{rwc, alg, err}
+	}()
+	crwc, calg, err := NegotiateCompression(clientConn, client, false)
+	require.NoError(t, err)
+	res := <-done
+	require.NoError(t, res.err)
+	return crwc, res.rwc, calg, res.alg
+}
+
+func TestNegotiateCompression(t *testing.T) {
+	zstd, snappy := CompressionZstd, CompressionSnappy
+	tests := []struct {
+		name           string
+		client, server []Compression
+		want           Compression
+	}{
+		{"both off", nil, nil, CompressionNone},
+		{"client off", nil, []Compression{zstd, snappy}, CompressionNone},
+		{"server off", []Compression{zstd}, nil, CompressionNone},
+		{"zstd only", []Compression{zstd}, []Compression{zstd, snappy}, zstd},
+		{"server preference wins", []Compression{snappy, zstd}, []Compression{zstd, snappy}, zstd},
+		{"snappy only", []Compression{snappy}, []Compression{zstd, snappy}, snappy},
+		{"no common algorithm", []Compression{snappy}, []Compression{zstd}, CompressionNone},
+		{"none is a no-op", []Compression{CompressionNone, snappy}, []Compression{CompressionNone}, CompressionNone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			crwc, srwc, calg, salg := negotiate(t, tt.client, tt.server)
+			assert.Equal(t, tt.want, calg)
+			assert.Equal(t, tt.want, salg)
+
+			msg := strings.Repeat("compressible ", 1000)
+			go func() { _, _ = crwc.Write([]byte(msg)) }()
+			buf := make([]byte, len(msg))
+			_, err := io.ReadFull(srwc, buf)
+			require.NoError(t, err)
+			assert.Equal(t, msg, string(buf))
+		})
+	}
+}
+
+// TestNegotiateCompression_Legacy checks the handshake against peers that
+// only know zstd: they send and accept the single byte 0x01.
+func TestNegotiateCompression_Legacy(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	// A legacy client asking for zstd
+	go func() { _, _ = clientConn.Write([]byte{0x01}) }()
+	done := make(chan Compression, 1)
+	go func() {
+		_, alg, _ := NegotiateCompression(serverConn, []Compression{CompressionSnappy, CompressionZstd}, true)
+		done <- alg
+	}()
+	resp := make([]byte, 1)
+	_, err := io.ReadFull(clientConn, resp)
+	require.NoError(t, err)
+	assert.Equal(t, byte(0x01), resp[0])
+	assert.Equal(t, CompressionZstd, <-done)
+
+	// A legacy server answers anything but 0x01 with no compression
+	clientConn2, serverConn2 := net.Pipe()
+	defer clientConn2.Close()
+	defer serverConn2.Close()
+	go func() {
+		buf := make([]byte, 1)
+		_, _ = io.ReadFull(serverConn2, buf)
+		_, _ = serverConn2.Write([]byte{0x00})
+	}()
+	_, alg, err := NegotiateCompression(clientConn2, []Compression{CompressionZstd, CompressionSnappy}, false)
+	require.NoError(t, err)
+	assert.Equal(t, CompressionNone, alg)
+}
+
+func TestNegotiateCompression_UnofferedChoice(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+	go func() {
+		buf := make([]byte, 1)
+		_, _ = io.ReadFull(serverConn, buf)
+		_, _ = serverConn.Write([]byte{byte(CompressionSnappy)})
+	}()
+	_, _, err := NegotiateCompression(clientConn, []Compression{CompressionZstd}, false)
+	assert.Error(t, err)
+}
+
+func TestParseCompressions(t *testing.T) {
+	algs, err := ParseCompressions([]string{"snappy", " ZSTD", "none"})
+	require.NoError(t, err)
+	assert.Equal(t, []Compression{CompressionSnappy, CompressionZstd, CompressionNone}, algs)
+	assert.Equal(t, "snappy", algs[0].String())
+
+	_, err = ParseCompressions([]string{"zstd", "lz4"})
+	assert.Error(t, err)
+}
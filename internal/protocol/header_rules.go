@@ -0,0 +1,141 @@
+package protocol
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// HeaderRules rewrite the headers of an HTTP tunnel's traffic at the server.
+// Within each direction Remove is applied first, then Set replaces every
+// value of a header, then Add appends one more value. Header names are
+// case-insensitive.
+type HeaderRules struct {
+	Request  HeaderRuleSet `json:"request"`
+	Response HeaderRuleSet `json:"response"`
+
+	// StripSecureCookies drops the Secure attribute from Set-Cookie response
+	// headers when the request reached the server over plain HTTP, so the
+	// browser keeps cookies an upstream marked Secure.
+	StripSecureCookies bool `json:"strip_secure_cookies,omitempty"`
+}
+
+// HeaderRuleSet is the set of header edits for one direction.
+type HeaderRuleSet struct {
+	Remove []string          `json:"remove,omitempty"`
+	Set    map[string]string `json:"set,omitempty"`
+	Add    map[string]string `json:"add,omitempty"`
+}
+
+const (
+	// MaxHeaderRules caps the total number of edits in one HeaderRules.
+	MaxHeaderRules = 64
+	// MaxHeaderRuleValue caps the length of a single header value.
+	MaxHeaderRuleValue = 4096
+)
+
+// protectedHeaders frame the HTTP message or the connection itself; letting
+// a rule rewrite them would allow request smuggling through the proxy.
+var protectedHeaders = map[string]bool{
+	"Connection":        true,
+	"Content-Length":    true,
+	"Keep-Alive":        true,
+	"Proxy-Connection":  true,
+	"Te":                true,
+	"Trailer":           true,
+	"Transfer-Encoding": true,
+	"Upgrade":           true,
+}
+
+// Empty reports whether the rules change nothing.
+func (r *HeaderRules) Empty() bool {
+	return r == nil || (r.Request.empty() && r.Response.empty() && !r.StripSecureCookies)
+}
+
+func (s HeaderRuleSet) empty() bool {
+	return len(s.Remove) == 0 && len(s.Set) == 0 && len(s.Add) == 0
+}
+
+// Validate checks that every rule names a valid, non-protected header and
+// carries a value that cannot inject extra header lines. On requests Host
+// may only be set, since it is not an ordinary header field.
+func (r *HeaderRules) Validate() error {
+	if r == nil {
+		return nil
+	}
+	count := 0
+	for _, dir := range []struct {
+		name    string
+		set     HeaderRuleSet
+		request bool
+	}{
+		{"request", r.Request, true},
+		{"response", r.Response, false},
+	} {
+		count += len(dir.set.Remove) + len(dir.set.Set) + len(dir.set.Add)
+		for _, name := range dir.set.Remove {
+			if err := validateRuleHeader(dir.name, "remove", name, dir.request); err != nil {
+				return err
+			}
+		}
+		for op, values := range map[string]map[string]string{"set": dir.set.Set, "add": dir.set.Add} {
+			for name, value := range values {
+				if err := validateRuleHeader(dir.name, op, name, dir.request); err != nil {
+					return err
+				}
+				if err := validateRuleValue(value); err != nil {
+					return fmt.Errorf("%s %s %s: %w", dir.name, op, name, err)
+				}
+			}
+		}
+	}
+	if count > MaxHeaderRules {
+		return fmt.Errorf("too many header rules: %d (max %d)", count, MaxHeaderRules)
+	}
+	return nil
+}
+
+func validateRuleHeader(dir, op, name string, request bool) error {
+	if !validHeaderName(name) {
+		return fmt.Errorf("%s %s: invalid header name %q", dir, op, name)
+	}
+	canonical := http.CanonicalHeaderKey(name)
+	if protectedHeaders[canonical] {
+		return fmt.Errorf("%s %s: header %s cannot be rewritten", dir, op, canonical)
+	}
+	if request && canonical == "Host" && op != "set" {
+		return fmt.Errorf("%s %s: Host can only be set", dir, op)
+	}
+	return nil
+}
+
+// validHeaderName reports whether name is an RFC 7230 token.
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// validateRuleValue rejects control characters (CR and LF in particular),
+// which would let a value terminate its header line and start another.
+func validateRuleValue(value string) error {
+	if len(value) > MaxHeaderRuleValue {
+		return fmt.Errorf("value longer than %d bytes", MaxHeaderRuleValue)
+	}
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; (c < 0x20 && c != '\t') || c == 0x7f {
+			return fmt.Errorf("value contains control character 0x%02x", c)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package protocol
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeaderRulesValidate(t *testing.T) {
+	valid := &HeaderRules{
+		Request: HeaderRuleSet{
+			Remove: []string{"Cookie"},
+			Set:    map[string]string{"host": "localhost:3000"},
+			Add:    map[string]string{"X-Env": "dev"},
+		},
+		Response: HeaderRuleSet{Set: map[string]string{"Cache-Control": "no-store"}},
+	}
+	require.NoError(t, valid.Validate())
+	assert.NoError(t, (*HeaderRules)(nil).Validate())
+
+	cases := map[string]*HeaderRules{
+		"header injection": {Request: HeaderRuleSet{Set: map[string]string{"X-A": "ok\r\nX-Evil: 1"}}},
+		"invalid name":     {Response: HeaderRuleSet{Add: map[string]string{"Bad Name": "v"}}},
+		"empty name":       {Request: HeaderRuleSet{Remove: []string{""}}},
+		"protected":        {Request: HeaderRuleSet{Set: map[string]string{"content-length": "0"}}},
+		"remove host":      {Request: HeaderRuleSet{Remove: []string{"Host"}}},
+		"add host":         {Request: HeaderRuleSet{Add: map[string]string{"Host": "a"}}},
+		"long value":       {Response: HeaderRuleSet{Set: map[string]string{"X-A": strings.Repeat("a", MaxHeaderRuleValue+1)}}},
+	}
+	for name, rules := range cases {
+		assert.Error(t, rules.Validate(), name)
+	}
+
+	many := &HeaderRules{}
+	for i := 0; i <= MaxHeaderRules; i++ {
+		many.Request.Remove = append(many.Request.Remove, "X-Remove")
+	}
+	assert.Error(t, many.Validate())
+}
+
+func TestHeaderRulesEmpty(t *testing.T) {
+	assert.True(t, (*HeaderRules)(nil).Empty())
+	assert.True(t, (&HeaderRules{}).Empty())
+	assert.False(t, (&HeaderRules{StripSecureCookies: true}).Empty())
+	assert.False(t, (&HeaderRules{Response: HeaderRuleSet{Remove: []string{"Server"}}}).Empty())
+}
@@ -17,6 +17,10 @@ const (
 	MsgTunnelClosed  MessageType = "tunnel_closed"
 	MsgTunnelError   MessageType = "tunnel_error"
 
+	// Tunnel batching: many tunnel requests in one round trip
+	MsgTunnelBatchRequest MessageType = "tunnel_batch_request"
+	MsgTunnelBatchResult  MessageType = "tunnel_batch_result"
+
 	// Connection notifications
 	MsgNewConnection    MessageType = "new_connection"
 	MsgConnectionAccept MessageType = "connection_accept"
@@ -29,10 +33,17 @@ const (
 	// Server lifecycle
 	MsgServerShutdown MessageType = "server_shutdown"
 
+	// Client lifecycle
+	MsgClientShutdown MessageType = "client_shutdown"
+
 	// Session pooling
 	MsgJoinSession       MessageType = "join_session"
 	MsgJoinSessionResult MessageType = "join_session_result"
 
+	// Session resumption
+	MsgResumeSession       MessageType = "resume_session"
+	MsgResumeSessionResult MessageType = "resume_session_result"
+
 	// Errors
 	MsgError MessageType = "error"
 )
@@ -44,6 +55,14 @@ const (
 	TunnelHTTP TunnelType = "http"
 	TunnelTCP  TunnelType = "tcp"
 	TunnelUDP  TunnelType = "udp"
+	// TunnelSink is an admin-only tunnel the server answers itself: uploads
+	// are discarded and SinkBytes are streamed back, so the data plane can be
+	// load-tested without a local service.
+	TunnelSink TunnelType = "sink"
+	// TunnelSOCKS runs the other way round: the client serves a local SOCKS5
+	// proxy and opens a stream to the server for each connection, which the
+	// server dials out to (see WriteDialReply).
+	TunnelSOCKS TunnelType = "socks"
 )
 
 // Message is the base structure for all control messages
@@ -68,6 +87,26 @@ type AuthMessage struct {
 	ClientID  string `json:"client_id,omitempty"`
 	UserAgent string `json:"user_agent,omitempty"`
 	Version   string `json:"version,omitempty"` // client protocol version
+
+	// Hostname names the client's machine in the user's list of connected
+	// clients.
+	Hostname string `json:"hostname,omitempty"`
+
+	// StreamCompression advertises that the client understands per-stream
+	// compression (see WriteCompressedStreamHeader).
+	StreamCompression bool `json:"stream_compression,omitempty"`
+
+	// ReconnectAttempt is non-zero when the client is re-authenticating
+	// after losing its session; the value is the attempt that succeeded.
+	ReconnectAttempt int `json:"reconnect_attempt,omitempty"`
+
+	// Resumable advertises that the client can resume a detached session
+	// over a new control connection (see ResumeSessionMessage).
+	Resumable bool `json:"resumable,omitempty"`
+
+	// Encodings lists the binary payload encodings the client can use for
+	// control messages after auth, in order of preference.
+	Encodings []Encoding `json:"encodings,omitempty"`
 }
 
 // ClientCapabilities describes features available based on the user's plan.
@@ -92,6 +131,18 @@ type AuthResultMessage struct {
 	Capabilities    *ClientCapabilities `json:"capabilities,omitempty"`
 	MaxDataSessions int                 `json:"max_data_sessions,omitempty"`
 
+	// ResumeWindow is how long (in seconds) the server keeps a session's
+	// tunnels and data connections after the control connection drops.
+	// Zero means the server does not support resumption.
+	ResumeWindow int `json:"resume_window,omitempty"`
+	// ResumeToken authorizes a later ResumeSessionMessage for this session.
+	ResumeToken string `json:"resume_token,omitempty"`
+	// Encoding is used for every control message after this one, and again
+	// after a resume result. Empty means JSON.
+	Encoding Encoding `json:"encoding,omitempty"`
+	// TunnelBatch is set by servers that accept TunnelBatchRequestMessage.
+	TunnelBatch bool `json:"tunnel_batch,omitempty"`
+
 	// Edge node redirect: hub tells client to connect to a specific node
 	RedirectAddr   string `json:"redirect_addr,omitempty"`
 	RedirectNodeID string `json:"redirect_node_id,omitempty"`
@@ -128,8 +179,63 @@ type TunnelRequestMessage struct {
 	AllowIPs      []string `json:"allow_ips,omitempty"`       // CIDR notation or exact IPs
 	AutoClose     string   `json:"auto_close,omitempty"`      // duration: "30m", "2h"
 	MaxLifetime   string   `json:"max_lifetime,omitempty"`    // duration: "8h"
+
+	// Health check run by the server through the tunnel: a request path
+	// ("/healthz") for HTTP tunnels or HealthCheckTCP for a TCP connect check.
+	HealthCheck         string `json:"health_check,omitempty"`
+	HealthCheckInterval string `json:"health_check_interval,omitempty"` // duration, default 30s
+
+	// Capture limits which exchanges of an HTTP tunnel are kept for
+	// inspection: "errors" stores only responses with status >= 400,
+	// "none" stores nothing.
+	Capture string `json:"capture,omitempty"`
+
+	// HeaderRules rewrite request and response headers of an HTTP tunnel.
+	HeaderRules *HeaderRules `json:"header_rules,omitempty"`
+
+	// StripPathPrefix is removed from the path of requests to an HTTP
+	// tunnel that start with it, then AddPathPrefix is put in front of the
+	// path (see ValidatePathPrefix).
+	StripPathPrefix string `json:"strip_path_prefix,omitempty"`
+	AddPathPrefix   string `json:"add_path_prefix,omitempty"`
+
+	// Cache asks the server to keep a response cache for an HTTP tunnel of
+	// at most CacheMaxSize bytes (0: the server's limit).
+	Cache        bool  `json:"cache,omitempty"`
+	CacheMaxSize int64 `json:"cache_max_size,omitempty"`
+
+	// SinkBytes is how many bytes a sink tunnel streams to each connection.
+	SinkBytes int64 `json:"sink_bytes,omitempty"`
+
+	// ProxyProtocol asks the server to send a PROXY protocol v2 header
+	// (see WriteProxyHeaderV2) at the start of each stream of a TCP tunnel.
+	ProxyProtocol bool `json:"proxy_protocol,omitempty"`
+
+	// MaxRequestBytes caps the request body an HTTP tunnel accepts from a
+	// visitor (0: the server's limit, which also caps larger values).
+	MaxRequestBytes int64 `json:"max_request_bytes,omitempty"`
+
+	// ConfirmConnections asks the server to announce each visitor
+	// connection of an HTTP or TCP tunnel with a NewConnectionMessage and
+	// to open a stream only once the client accepts it.
+	ConfirmConnections bool `json:"confirm_connections,omitempty"`
+
+	// NoCompression asks the server to leave the streams of an HTTP or TCP
+	// tunnel uncompressed even when the session uses per-stream
+	// compression; their stream headers then carry no compressed flag.
+	NoCompression bool `json:"no_compression,omitempty"`
+
+	// RestoreToken is the token of a TunnelCreatedMessage from an earlier
+	// session. It asks for the tunnel's previous subdomain or port again;
+	// if that address was taken meanwhile, a new one is allocated instead
+	// of rejecting the request.
+	RestoreToken string `json:"restore_token,omitempty"`
 }
 
+// HealthCheckTCP is the TunnelRequestMessage.HealthCheck value that enables a
+// TCP connect check on a TCP tunnel.
+const HealthCheckTCP = "tcp"
+
 // TunnelCreatedMessage is the server response when tunnel is created
 type TunnelCreatedMessage struct {
 	Message
@@ -151,6 +257,13 @@ type TunnelCreatedMessage struct {
 	AllowIPsCount    int    `json:"allow_ips_count,omitempty"`
 	AutoClose        string `json:"auto_close,omitempty"`
 	MaxLifetime      string `json:"max_lifetime,omitempty"`
+
+	// RestoreToken is signed by the server and survives its restarts; the
+	// client sends it back in TunnelRequestMessage after a reconnect.
+	RestoreToken string `json:"restore_token,omitempty"`
+	// AddressChanged is set when a restore request could not get the
+	// previous subdomain or port and the tunnel got a new address.
+	AddressChanged bool `json:"address_changed,omitempty"`
 }
 
 // TunnelCloseMessage is sent to close a tunnel
@@ -163,8 +276,18 @@ type TunnelCloseMessage struct {
 type TunnelClosedMessage struct {
 	Message
 	TunnelID string `json:"tunnel_id"`
+	// Drain tells how the connections in flight when the tunnel was closed
+	// ended: DrainComplete or DrainTimedOut. Empty when the server does not
+	// drain tunnels.
+	Drain string `json:"drain,omitempty"`
 }
 
+// Outcomes of draining a closed tunnel
+const (
+	DrainComplete = "complete" // every connection finished on its own
+	DrainTimedOut = "timeout"  // the rest were cut at the drain timeout
+)
+
 // TunnelErrorMessage indicates an error with a tunnel operation
 type TunnelErrorMessage struct {
 	Message
@@ -173,7 +296,30 @@ type TunnelErrorMessage struct {
 	Code     string `json:"code,omitempty"`
 }
 
-// NewConnectionMessage notifies client of incoming connection
+// TunnelBatchRequestMessage asks for several tunnels at once. The server
+// handles the requests in order, exactly as if they were sent one by one.
+type TunnelBatchRequestMessage struct {
+	Message
+	Tunnels []TunnelRequestMessage `json:"tunnels"`
+}
+
+// TunnelBatchResultMessage answers a TunnelBatchRequestMessage with one
+// result per requested tunnel, in request order.
+type TunnelBatchResultMessage struct {
+	Message
+	Results []TunnelBatchResult `json:"results"`
+}
+
+// TunnelBatchResult is the outcome of one request of a batch: exactly one
+// of Created and Error is set.
+type TunnelBatchResult struct {
+	Created *TunnelCreatedMessage `json:"created,omitempty"`
+	Error   *TunnelErrorMessage   `json:"error,omitempty"`
+}
+
+// NewConnectionMessage notifies client of incoming connection. It is only
+// sent for tunnels that confirm connections, and must be answered with a
+// ConnectionAcceptMessage carrying the same ConnectionID.
 type NewConnectionMessage struct {
 	Message
 	TunnelID     string `json:"tunnel_id"`
@@ -186,10 +332,13 @@ type NewConnectionMessage struct {
 	Path   string `json:"path,omitempty"`
 }
 
-// ConnectionAcceptMessage tells server client is ready for data
+// ConnectionAcceptMessage tells server client is ready for data, or with
+// Reject set that the connection must be closed instead of forwarded.
 type ConnectionAcceptMessage struct {
 	Message
 	ConnectionID string `json:"connection_id"`
+	Reject       bool   `json:"reject,omitempty"`
+	Reason       string `json:"reason,omitempty"`
 }
 
 // ConnectionCloseMessage notifies about connection closure
@@ -223,6 +372,13 @@ type ServerShutdownMessage struct {
 	Reason string `json:"reason,omitempty"`
 }
 
+// ClientShutdownMessage is sent by a client that is closing on purpose, so
+// the server releases its tunnels right away instead of holding them for a
+// resume.
+type ClientShutdownMessage struct {
+	Message
+}
+
 // JoinSessionMessage is sent by client to join an existing session with additional data connections
 type JoinSessionMessage struct {
 	Message
@@ -235,6 +391,29 @@ type JoinSessionResult struct {
 	Message
 	Success bool   `json:"success"`
 	Error   string `json:"error,omitempty"`
+	Code    string `json:"code,omitempty"`
+}
+
+// ResumeSessionMessage is sent by client on a fresh connection to take over
+// a session whose control connection was lost
+type ResumeSessionMessage struct {
+	Message
+	ClientID string `json:"client_id"`
+	Token    string `json:"token"` // resume token from the auth or last resume result
+}
+
+// ResumeSessionResult is the server response to a resume session request
+type ResumeSessionResult struct {
+	Message
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+
+	// ResumeToken replaces the token used for this resume, which is no
+	// longer valid.
+	ResumeToken string `json:"resume_token,omitempty"`
+	// TunnelIDs lists the tunnels still registered for the session; tunnels
+	// closed while the client was away are missing from it.
+	TunnelIDs []string `json:"tunnel_ids,omitempty"`
 }
 
 // Error codes
@@ -251,4 +430,15 @@ const (
 	ErrCodeInternalError    = "INTERNAL_ERROR"
 	ErrCodeProtocolError    = "PROTOCOL_ERROR"
 	ErrCodeRedirect         = "REDIRECT"
+	ErrCodeQuotaExceeded    = "QUOTA_EXCEEDED"
+	ErrCodeDisconnected     = "DISCONNECTED"
+	ErrCodeRateLimited      = "RATE_LIMITED"
+
+	// ErrCodeSubdomainSuspended refuses or closes a tunnel on a subdomain
+	// an admin suspended for abuse.
+	ErrCodeSubdomainSuspended = "SUBDOMAIN_SUSPENDED"
+
+	// ErrCodeDataSessionsDisabled rejects a join_session on a server that
+	// does not take data connections; the client stays on its primary one.
+	ErrCodeDataSessionsDisabled = "DATA_SESSIONS_DISABLED"
 )
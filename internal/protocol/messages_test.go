@@ -196,6 +196,8 @@ func TestTunnelCreatedSecurityFieldsRoundTrip(t *testing.T) {
 		AllowIPsCount:    3,
 		AutoClose:        "30m",
 		MaxLifetime:      "8h",
+		RestoreToken:     "payload.signature",
+		AddressChanged:   true,
 	}
 
 	// Test JSON round-trip
@@ -247,6 +249,10 @@ func TestTunnelCreatedSecurityFieldsRoundTrip(t *testing.T) {
 	if codecDecoded.MaxLifetime != orig.MaxLifetime {
 		t.Errorf("codec MaxLifetime = %q, want %q", codecDecoded.MaxLifetime, orig.MaxLifetime)
 	}
+	if codecDecoded.RestoreToken != orig.RestoreToken || codecDecoded.AddressChanged != orig.AddressChanged {
+		t.Errorf("codec restore fields = %q/%v, want %q/%v",
+			codecDecoded.RestoreToken, codecDecoded.AddressChanged, orig.RestoreToken, orig.AddressChanged)
+	}
 }
 
 func TestTunnelCreatedSecurityFieldsOmitempty(t *testing.T) {
@@ -267,7 +273,7 @@ func TestTunnelCreatedSecurityFieldsOmitempty(t *testing.T) {
 		t.Fatalf("unmarshal raw: %v", err)
 	}
 
-	for _, key := range []string{"basic_auth_enabled", "allow_ips_count", "auto_close", "max_lifetime"} {
+	for _, key := range []string{"basic_auth_enabled", "allow_ips_count", "auto_close", "max_lifetime", "restore_token", "address_changed"} {
 		if _, found := raw[key]; found {
 			t.Errorf("expected %q key to be absent when zero/empty (omitempty)", key)
 		}
@@ -0,0 +1,209 @@
+package protocol
+
+import (
+	"bytes"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// MessagePack control payloads follow the json tags of the message structs,
+// so a message has the same shape in both encodings.
+const msgpackStructTag = "json"
+
+// msgpackEncoder is a pooled encoder together with the buffer it fills.
+type msgpackEncoder struct {
+	buf bytes.Buffer
+	enc *msgpack.Encoder
+}
+
+var msgpackEncoders = sync.Pool{
+	New: func() any {
+		e := &msgpackEncoder{}
+		e.enc = msgpack.NewEncoder(&e.buf)
+		e.enc.SetCustomStructTag(msgpackStructTag)
+		e.enc.UseCompactInts(true)
+		return e
+	},
+}
+
+// msgpackDecoder is a pooled decoder together with the reader it reads.
+type msgpackDecoder struct {
+	r   bytes.Reader
+	dec *msgpack.Decoder
+}
+
+var msgpackDecoders = sync.Pool{
+	New: func() any {
+		d := &msgpackDecoder{}
+		d.dec = msgpack.NewDecoder(&d.r)
+		d.dec.SetCustomStructTag(msgpackStructTag)
+		return d
+	},
+}
+
+// MarshalMsgpack encodes v as MessagePack.
+func MarshalMsgpack(v any) ([]byte, error) {
+	e := msgpackEncoders.Get().(*msgpackEncoder)
+	defer msgpackEncoders.Put(e)
+
+	e.buf.Reset()
+	if err := encodeMsgpack(e.enc, reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return bytes.Clone(e.buf.Bytes()), nil
+}
+
+// UnmarshalMsgpack decodes MessagePack data into v. Keys without a matching
+// field are skipped.
+func UnmarshalMsgpack(data []byte, v any) error {
+	d := msgpackDecoders.Get().(*msgpackDecoder)
+	defer msgpackDecoders.Put(d)
+
+	d.r.Reset(data)
+	d.dec.ResetReader(&d.r)
+	return d.dec.Decode(v)
+}
+
+// protocolPkgPath is the package whose structs encodeMsgpack writes itself.
+var protocolPkgPath = reflect.TypeFor[Message]().PkgPath()
+
+// encodeMsgpack writes v. Message structs of this package, and the strings
+// and slices in them, are written here; the library checks every omitempty
+// field through reflect.Value.Interface, which allocates once per field of
+// every message. Anything else is left to the library.
+func encodeMsgpack(enc *msgpack.Encoder, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return enc.EncodeNil()
+		}
+		if elem := v.Elem(); isProtocolStruct(elem.Type()) {
+			return encodeMsgpackStruct(enc, elem)
+		}
+	case reflect.Struct:
+		if isProtocolStruct(v.Type()) {
+			return encodeMsgpackStruct(enc, v)
+		}
+	case reflect.Slice:
+		if v.IsNil() {
+			return enc.EncodeNil()
+		}
+		if elem := v.Type().Elem(); isProtocolStruct(elem) || elem.Kind() == reflect.String {
+			if err := enc.EncodeArrayLen(v.Len()); err != nil {
+				return err
+			}
+			for i := range v.Len() {
+				if err := encodeMsgpack(enc, v.Index(i)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	case reflect.String:
+		return enc.EncodeString(v.String())
+	}
+	if !v.IsValid() {
+		return enc.EncodeNil()
+	}
+	return enc.EncodeValue(v)
+}
+
+func isProtocolStruct(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t.PkgPath() == protocolPkgPath
+}
+
+// encodeMsgpackStruct writes a struct as a map keyed by the json names of
+// its fields, leaving out empty omitempty fields the way encoding/json does.
+func encodeMsgpackStruct(enc *msgpack.Encoder, v reflect.Value) error {
+	fields := msgpackStructFields(v.Type())
+	n := 0
+	for i := range fields {
+		if !fields[i].omitted(v) {
+			n++
+		}
+	}
+	if err := enc.EncodeMapLen(n); err != nil {
+		return err
+	}
+	for i := range fields {
+		f := &fields[i]
+		if f.omitted(v) {
+			continue
+		}
+		if err := enc.EncodeString(f.name); err != nil {
+			return err
+		}
+		if err := encodeMsgpack(enc, v.FieldByIndex(f.index)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// msgpackField is a struct field as it appears in the encoded map.
+type msgpackField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+// omitted reports whether the field is left out of the encoding of v.
+func (f *msgpackField) omitted(v reflect.Value) bool {
+	if !f.omitEmpty {
+		return false
+	}
+	fv := v.FieldByIndex(f.index)
+	switch fv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return fv.Len() == 0
+	case reflect.Struct:
+		return false
+	default:
+		return fv.IsZero()
+	}
+}
+
+// msgpackFieldCache holds the fields of each struct type encoded so far.
+var msgpackFieldCache sync.Map // reflect.Type -> []msgpackField
+
+func msgpackStructFields(t reflect.Type) []msgpackField {
+	if fields, ok := msgpackFieldCache.Load(t); ok {
+		return fields.([]msgpackField)
+	}
+	fields, _ := msgpackFieldCache.LoadOrStore(t, appendMsgpackFields(nil, t, nil))
+	return fields.([]msgpackField)
+}
+
+// appendMsgpackFields appends the encoded fields of t, found at index,
+// inlining embedded structs without a name in their tag.
+func appendMsgpackFields(fields []msgpackField, t reflect.Type, index []int) []msgpackField {
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		tag := sf.Tag.Get(msgpackStructTag)
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		fieldIndex := append(slices.Clone(index), i)
+		if sf.Anonymous && name == "" && sf.Type.Kind() == reflect.Struct {
+			fields = appendMsgpackFields(fields, sf.Type, fieldIndex)
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fields = append(fields, msgpackField{
+			name:      name,
+			index:     fieldIndex,
+			omitEmpty: slices.Contains(strings.Split(opts, ","), "omitempty"),
+		})
+	}
+	return fields
+}
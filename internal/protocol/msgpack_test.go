@@ -0,0 +1,157 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func msgpackTestMessages() []any {
+	return []any{
+		&AuthMessage{Message: NewMessage(MsgAuth), Token: "tk_123", ClientID: "c1", Resumable: true,
+			Encodings: []Encoding{EncodingMsgpack}},
+		&AuthResultMessage{Message: NewMessage(MsgAuthResult), Success: true, ClientID: "c1", MaxTunnels: 5,
+			Capabilities:       &ClientCapabilities{InspectorEnabled: true, MaxBodySize: 1 << 20},
+			RedirectCandidates: []NodeRedirectCandidate{{Addr: "edge:4443", NodeID: "n1", Region: "eu"}},
+			Encoding:           EncodingMsgpack},
+		&TunnelRequestMessage{Message: NewMessage(MsgTunnelRequest), TunnelType: TunnelHTTP, Subdomain: "test",
+			LocalPort: 8080, AllowIPs: []string{"10.0.0.0/8", "::1"},
+			HeaderRules: &HeaderRules{Request: HeaderRuleSet{Set: map[string]string{"Host": "localhost"}},
+				Response: HeaderRuleSet{Remove: []string{"Server"}}, StripSecureCookies: true}},
+		&TunnelCreatedMessage{Message: NewMessage(MsgTunnelCreated), TunnelID: "t1", TunnelType: TunnelTCP, RemotePort: 65535},
+		&TunnelCloseMessage{Message: NewMessage(MsgTunnelClose), TunnelID: "t1"},
+		&TunnelErrorMessage{Message: NewMessage(MsgTunnelError), Error: "fail", Code: ErrCodeInternalError},
+		&PingMessage{Message: NewMessage(MsgPing)},
+		&ErrorMessage{Message: NewMessage(MsgError), Error: "bad", Fatal: true},
+		&ResumeSessionResult{Message: NewMessage(MsgResumeSessionResult), Success: true, ResumeToken: "r2",
+			TunnelIDs: []string{"t1", "t2"}},
+	}
+}
+
+func TestMsgpackRoundTripMatchesJSON(t *testing.T) {
+	for _, msg := range msgpackTestMessages() {
+		data, err := MarshalMsgpack(msg)
+		require.NoError(t, err)
+
+		dst := cloneEmpty(msg)
+		if dst == nil {
+			dst = &ResumeSessionResult{}
+		}
+		require.NoError(t, UnmarshalMsgpack(data, dst))
+
+		origJSON, _ := json.Marshal(msg)
+		dstJSON, _ := json.Marshal(dst)
+		assert.JSONEq(t, string(origJSON), string(dstJSON))
+
+		assert.Less(t, len(data), len(origJSON), "msgpack should be smaller than JSON for %T", msg)
+	}
+}
+
+func TestMsgpackMatchesLibraryEncoding(t *testing.T) {
+	for _, msg := range msgpackTestMessages() {
+		data, err := MarshalMsgpack(msg)
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		enc := msgpack.NewEncoder(&buf)
+		enc.SetCustomStructTag(msgpackStructTag)
+		enc.UseCompactInts(true)
+		require.NoError(t, enc.Encode(msg))
+
+		var got, want map[string]any
+		require.NoError(t, msgpack.Unmarshal(data, &got))
+		require.NoError(t, msgpack.Unmarshal(buf.Bytes(), &want))
+		assert.Equal(t, want, got, "%T", msg)
+	}
+}
+
+func TestMsgpackSkipsUnknownKeys(t *testing.T) {
+	data, err := MarshalMsgpack(map[string]any{
+		"type":    "ping",
+		"extra":   []any{1, "two", map[string]any{"three": 3.5}},
+		"enabled": true,
+	})
+	require.NoError(t, err)
+
+	var msg PingMessage
+	require.NoError(t, UnmarshalMsgpack(data, &msg))
+	assert.Equal(t, MsgPing, msg.Type)
+}
+
+func TestMsgpackRejectsMalformed(t *testing.T) {
+	for _, data := range [][]byte{
+		{0x81},             // map missing its entry
+		{0x81, 0xa4, 't'},  // truncated key
+		{0xc1},             // reserved
+		{0xdb, 0xff, 0xff}, // truncated str32 length
+	} {
+		var msg Message
+		assert.Error(t, UnmarshalMsgpack(data, &msg), "% x", data)
+	}
+}
+
+func TestCodecMsgpackEncoding(t *testing.T) {
+	var buf bytes.Buffer
+	codec := NewCodec(&buf, &buf)
+	codec.SetEncoding(EncodingMsgpack)
+	assert.Equal(t, EncodingMsgpack, codec.Encoding())
+
+	sent := &TunnelRequestMessage{Message: NewMessage(MsgTunnelRequest), TunnelType: TunnelTCP, LocalPort: 22}
+	require.NoError(t, codec.Encode(sent))
+
+	data, base, err := codec.DecodeRaw()
+	require.NoError(t, err)
+	assert.Equal(t, MsgTunnelRequest, base.Type)
+
+	parsed, err := EncodingMsgpack.ParseMessage(data, base.Type)
+	require.NoError(t, err)
+	assert.Equal(t, sent, parsed)
+
+	// JSON peers cannot read the payload
+	_, err = ParseMessage(data, base.Type)
+	assert.Error(t, err)
+}
+
+func TestCodecDecodeRawInvalidMsgpack(t *testing.T) {
+	var buf bytes.Buffer
+	codec := NewCodec(&buf, &buf)
+	codec.SetEncoding(EncodingMsgpack)
+	require.NoError(t, codec.EncodeBytes([]byte(`{"type":"ping"}`)))
+
+	_, _, err := codec.DecodeRaw()
+	assert.True(t, IsFrameError(err), "got %v", err)
+}
+
+// benchmarkControlCodec encodes and parses a tunnel request. MessagePack
+// should take less time and fewer bytes per message than JSON.
+func benchmarkControlCodec(b *testing.B, e Encoding) {
+	msg := &TunnelRequestMessage{Message: NewMessage(MsgTunnelRequest), TunnelType: TunnelHTTP,
+		Subdomain: "my-app", LocalPort: 3000, AllowIPs: []string{"10.0.0.0/8"}, AutoClose: "30m"}
+
+	var buf bytes.Buffer
+	codec := NewCodec(&buf, &buf)
+	codec.SetEncoding(e)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := codec.Encode(msg); err != nil {
+			b.Fatal(err)
+		}
+		b.SetBytes(int64(buf.Len()))
+		data, base, err := codec.DecodeRaw()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := e.ParseMessage(data, base.Type); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkControlCodecJSON(b *testing.B)    { benchmarkControlCodec(b, EncodingJSON) }
+func BenchmarkControlCodecMsgpack(b *testing.B) { benchmarkControlCodec(b, EncodingMsgpack) }
@@ -0,0 +1,35 @@
+package protocol
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MaxPathPrefix caps the length of a tunnel's strip or add path prefix.
+const MaxPathPrefix = 256
+
+// ValidatePathPrefix checks a path prefix an HTTP tunnel strips from or adds
+// to request paths: an absolute path of one or more segments, without a
+// trailing slash, query or fragment. An empty prefix disables the rewrite.
+func ValidatePathPrefix(prefix string) error {
+	if prefix == "" {
+		return nil
+	}
+	if len(prefix) > MaxPathPrefix {
+		return fmt.Errorf("path prefix longer than %d bytes", MaxPathPrefix)
+	}
+	if !strings.HasPrefix(prefix, "/") || prefix == "/" || strings.HasSuffix(prefix, "/") {
+		return fmt.Errorf("path prefix %q must start and must not end with /", prefix)
+	}
+	for _, segment := range strings.Split(prefix[1:], "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return fmt.Errorf("path prefix %q has an empty or dot segment", prefix)
+		}
+	}
+	for i := 0; i < len(prefix); i++ {
+		if c := prefix[i]; c <= ' ' || c == 0x7f || c == '?' || c == '#' || c == '%' {
+			return fmt.Errorf("path prefix %q contains %q", prefix, c)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package protocol
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatePathPrefix(t *testing.T) {
+	for _, prefix := range []string{"", "/api", "/api/v1", "/a-b_c.d~e"} {
+		assert.NoError(t, ValidatePathPrefix(prefix), prefix)
+	}
+
+	for _, prefix := range []string{
+		"/", "api", "/api/", "/api//v1", "/api/../admin", "/./api",
+		"/api?x=1", "/api#top", "/a b", "/api%2F", "/api\r\nX-Evil: 1",
+		"/" + strings.Repeat("a", MaxPathPrefix),
+	} {
+		assert.Error(t, ValidatePathPrefix(prefix), prefix)
+	}
+}
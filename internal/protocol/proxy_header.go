@@ -0,0 +1,54 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+)
+
+// proxyV2Signature starts every PROXY protocol v2 header.
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+const (
+	proxyV2Local = 0x20 // version 2, LOCAL: no address follows
+	proxyV2Proxy = 0x21 // version 2, PROXY: the connection is relayed
+
+	proxyV2Unspec   = 0x00
+	proxyV2TCPOver4 = 0x11
+	proxyV2TCPOver6 = 0x21
+)
+
+// AppendProxyHeaderV2 appends a PROXY protocol v2 header for a TCP
+// connection from src to dst. When both are IPv4 the header carries IPv4
+// addresses, otherwise IPv6 ones (IPv4 as v4-mapped). Addresses that are
+// not TCP addresses give a LOCAL header, which tells the receiver to use
+// the connection's own addresses.
+func AppendProxyHeaderV2(b []byte, src, dst net.Addr) []byte {
+	b = append(b, proxyV2Signature...)
+
+	srcTCP, ok1 := src.(*net.TCPAddr)
+	dstTCP, ok2 := dst.(*net.TCPAddr)
+	if !ok1 || !ok2 || srcTCP.IP == nil || dstTCP.IP == nil {
+		return append(b, proxyV2Local, proxyV2Unspec, 0, 0)
+	}
+
+	srcIP, dstIP := srcTCP.IP.To4(), dstTCP.IP.To4()
+	family := byte(proxyV2TCPOver4)
+	if srcIP == nil || dstIP == nil {
+		srcIP, dstIP = srcTCP.IP.To16(), dstTCP.IP.To16()
+		family = proxyV2TCPOver6
+	}
+	b = append(b, proxyV2Proxy, family)
+	b = binary.BigEndian.AppendUint16(b, uint16(2*len(srcIP)+4))
+	b = append(b, srcIP...)
+	b = append(b, dstIP...)
+	b = binary.BigEndian.AppendUint16(b, uint16(srcTCP.Port))
+	return binary.BigEndian.AppendUint16(b, uint16(dstTCP.Port))
+}
+
+// WriteProxyHeaderV2 writes the header of AppendProxyHeaderV2 to w in a
+// single write, so it cannot interleave with payload.
+func WriteProxyHeaderV2(w io.Writer, src, dst net.Addr) error {
+	_, err := w.Write(AppendProxyHeaderV2(make([]byte, 0, 52), src, dst))
+	return err
+}
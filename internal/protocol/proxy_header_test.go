@@ -0,0 +1,53 @@
+package protocol
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteProxyHeaderV2_IPv4(t *testing.T) {
+	src := &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 51234}
+	dst := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 5432}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteProxyHeaderV2(&buf, src, dst))
+
+	want := append([]byte("\r\n\r\n\x00\r\nQUIT\n"),
+		0x21, 0x11, 0x00, 0x0C,
+		203, 0, 113, 7,
+		10, 0, 0, 1,
+		0xC8, 0x22,
+		0x15, 0x38,
+	)
+	assert.Equal(t, want, buf.Bytes())
+}
+
+func TestWriteProxyHeaderV2_IPv6(t *testing.T) {
+	src := &net.TCPAddr{IP: net.ParseIP("2001:db8::7"), Port: 443}
+	dst := &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 8443}
+
+	b := AppendProxyHeaderV2(nil, src, dst)
+	require.Len(t, b, 16+36)
+	assert.Equal(t, []byte{0x21, 0x21, 0x00, 0x24}, b[12:16])
+	assert.Equal(t, []byte(src.IP.To16()), b[16:32])
+	assert.Equal(t, []byte(dst.IP.To16()), b[32:48])
+	assert.Equal(t, []byte{0x01, 0xBB, 0x20, 0xFB}, b[48:52])
+}
+
+func TestWriteProxyHeaderV2_MixedFamilies(t *testing.T) {
+	src := &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 1}
+	dst := &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 2}
+
+	b := AppendProxyHeaderV2(nil, src, dst)
+	assert.Equal(t, byte(0x21), b[13], "IPv4 source is sent as v4-mapped IPv6")
+	assert.Equal(t, []byte(net.ParseIP("::ffff:203.0.113.7")), b[16:32])
+}
+
+func TestWriteProxyHeaderV2_Local(t *testing.T) {
+	b := AppendProxyHeaderV2(nil, &net.UnixAddr{Name: "/tmp/s", Net: "unix"}, nil)
+	assert.Equal(t, []byte{0x20, 0x00, 0x00, 0x00}, b[12:])
+}
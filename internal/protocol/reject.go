@@ -0,0 +1,74 @@
+package protocol
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// RejectReason says why the server refused a client connection before its
+// yamux session started.
+type RejectReason byte
+
+const (
+	RejectServerFull  RejectReason = 0x01 // server-wide connection limit
+	RejectPerIPLimit  RejectReason = 0x02 // connection limit for the client's IP
+	RejectBanned      RejectReason = 0x03 // the client's IP is banned
+	RejectRateLimited RejectReason = 0x04 // too many connection attempts
+	RejectGeoPolicy   RejectReason = 0x05 // the client's country or network is not allowed
+)
+
+// rejectMarker takes the place of the compression answer and is followed by
+// the reason byte. Clients that do not know it fail on the yamux handshake,
+// as they did when the server closed the connection without a word.
+const rejectMarker byte = 0xFF
+
+// rejectTimeout bounds how long a rejected client may take to send its
+// compression offer.
+const rejectTimeout = 2 * time.Second
+
+func (r RejectReason) String() string {
+	switch r {
+	case RejectServerFull:
+		return "server connection limit"
+	case RejectPerIPLimit:
+		return "per-IP connection limit"
+	case RejectBanned:
+		return "banned"
+	case RejectRateLimited:
+		return "rate limited"
+	case RejectGeoPolicy:
+		return "network not allowed"
+	default:
+		return fmt.Sprintf("unknown reason %d", byte(r))
+	}
+}
+
+// RejectedError is returned by NegotiateCompression on the client when the
+// server refused the connection.
+type RejectedError struct {
+	Reason RejectReason
+}
+
+func (e *RejectedError) Error() string {
+	return "rejected by server: " + e.Reason.String()
+}
+
+// RejectConnection answers the client's compression offer with reason
+// instead of a compression choice. The caller closes conn afterwards.
+func RejectConnection(conn net.Conn, reason RejectReason) error {
+	_ = conn.SetDeadline(time.Now().Add(rejectTimeout))
+	defer func() { _ = conn.SetDeadline(time.Time{}) }()
+
+	// Read the offer first: closing with unread data resets the connection,
+	// which can discard the reason before the client reads it
+	buf := []byte{0}
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return fmt.Errorf("read compression preference: %w", err)
+	}
+	if _, err := conn.Write([]byte{rejectMarker, byte(reason)}); err != nil {
+		return fmt.Errorf("write reject reason: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package protocol
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRejectConnection(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	done := make(chan error, 1)
+	go func() { done <- RejectConnection(serverConn, RejectBanned) }()
+
+	_, _, err := NegotiateCompression(clientConn, []Compression{CompressionZstd}, false)
+	var rejected *RejectedError
+	require.True(t, errors.As(err, &rejected), "got %v", err)
+	assert.Equal(t, RejectBanned, rejected.Reason)
+	assert.Equal(t, "rejected by server: banned", err.Error())
+	require.NoError(t, <-done)
+}
@@ -0,0 +1,52 @@
+package protocol
+
+import (
+	"fmt"
+	"io"
+)
+
+// Outbound streams of socks tunnels are opened by the client. Each starts
+// with a stream header whose TunnelID names the socks tunnel and whose
+// RemoteAddr is the destination as host:port; the server answers with a
+// dial reply before any data flows.
+//
+// Wire format: [1 byte: code][1 byte: reason_len][reason bytes]
+
+// Dial reply codes. They are the SOCKS5 reply codes (RFC 1928), so the
+// client passes them on unchanged.
+const (
+	DialSucceeded          byte = 0x00
+	DialFailed             byte = 0x01
+	DialNotAllowed         byte = 0x02
+	DialNetworkUnreachable byte = 0x03
+	DialHostUnreachable    byte = 0x04
+	DialConnectionRefused  byte = 0x05
+	DialTimedOut           byte = 0x06
+)
+
+// WriteDialReply writes the outcome of an outbound dial to w. Reasons longer
+// than 255 bytes are cut.
+func WriteDialReply(w io.Writer, code byte, reason string) error {
+	if len(reason) > 255 {
+		reason = reason[:255]
+	}
+	buf := make([]byte, 2+len(reason))
+	buf[0] = code
+	buf[1] = byte(len(reason)) //nolint:gosec // bounded above
+	copy(buf[2:], reason)
+	_, err := w.Write(buf)
+	return err
+}
+
+// ReadDialReply reads a dial reply from r.
+func ReadDialReply(r io.Reader) (code byte, reason string, err error) {
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return 0, "", fmt.Errorf("read dial reply: %w", err)
+	}
+	msg := make([]byte, head[1])
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return 0, "", fmt.Errorf("read dial reply reason: %w", err)
+	}
+	return head[0], string(msg), nil
+}
@@ -0,0 +1,39 @@
+package protocol
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDialReply_RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteDialReply(&buf, DialNotAllowed, "destination not allowed"))
+	require.NoError(t, WriteDialReply(&buf, DialSucceeded, ""))
+
+	code, reason, err := ReadDialReply(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, DialNotAllowed, code)
+	assert.Equal(t, "destination not allowed", reason)
+
+	code, reason, err = ReadDialReply(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, DialSucceeded, code)
+	assert.Empty(t, reason)
+}
+
+func TestDialReply_LongReasonIsCut(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteDialReply(&buf, DialFailed, strings.Repeat("x", 300)))
+	_, reason, err := ReadDialReply(&buf)
+	require.NoError(t, err)
+	assert.Len(t, reason, 255)
+}
+
+func TestDialReply_Truncated(t *testing.T) {
+	_, _, err := ReadDialReply(bytes.NewReader([]byte{DialFailed, 5, 'a'}))
+	assert.Error(t, err)
+}
@@ -0,0 +1,156 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	frameRaw  byte = 0x00
+	frameZstd byte = 0x01
+
+	frameHeaderSize = 5 // [1 byte: kind][4 bytes: payload length]
+
+	// MaxFramePayload caps the decoded size of a single frame; larger writes
+	// are split so the reader never has to buffer more than this.
+	MaxFramePayload = 64 * 1024
+)
+
+var (
+	frameCodecOnce sync.Once
+	frameEncoder   *zstd.Encoder
+	frameDecoder   *zstd.Decoder
+	frameCodecErr  error
+)
+
+// frameCodec returns the shared stateless zstd encoder/decoder. EncodeAll and
+// DecodeAll are safe for concurrent use, so one pair serves every stream.
+func frameCodec() (*zstd.Encoder, *zstd.Decoder, error) {
+	frameCodecOnce.Do(func() {
+		frameEncoder, frameCodecErr = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest))
+		if frameCodecErr != nil {
+			return
+		}
+		frameDecoder, frameCodecErr = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(MaxFramePayload))
+	})
+	return frameEncoder, frameDecoder, frameCodecErr
+}
+
+// compressedStream frames a stream so each write is sent either as-is or
+// zstd-compressed. Writes of at least threshold bytes are compressed; smaller
+// ones (request lines, interactive traffic) skip the CPU cost entirely.
+//
+// Frame format: [1 byte: frameRaw|frameZstd][4 bytes: payload length][payload]
+type compressedStream struct {
+	net.Conn
+	threshold int
+
+	pending []byte // decoded bytes not yet returned by Read
+	readBuf []byte
+}
+
+// NewCompressedStream wraps a data stream whose header was written with
+// WriteCompressedStreamHeader. Both peers must wrap the stream. A threshold
+// of zero or less disables compression of outgoing frames.
+func NewCompressedStream(conn net.Conn, threshold int) net.Conn {
+	return &compressedStream{Conn: conn, threshold: threshold}
+}
+
+// CloseWrite half-closes the underlying stream. Frames are written whole,
+// so the peer never sees a partial frame before EOF.
+func (s *compressedStream) CloseWrite() error {
+	return CloseWrite(s.Conn)
+}
+
+func (s *compressedStream) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > MaxFramePayload {
+			chunk = chunk[:MaxFramePayload]
+		}
+		if err := s.writeFrame(chunk); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
+
+func (s *compressedStream) writeFrame(chunk []byte) error {
+	frame := make([]byte, frameHeaderSize, frameHeaderSize+len(chunk))
+	frame[0] = frameRaw
+
+	if s.threshold > 0 && len(chunk) >= s.threshold {
+		enc, _, err := frameCodec()
+		if err != nil {
+			return err
+		}
+		compressed := enc.EncodeAll(chunk, frame)
+		// Keep the compressed form only if it actually saves space.
+		if len(compressed)-frameHeaderSize < len(chunk) {
+			frame = compressed
+			frame[0] = frameZstd
+		}
+	}
+	if frame[0] == frameRaw {
+		frame = append(frame, chunk...)
+	}
+
+	binary.BigEndian.PutUint32(frame[1:frameHeaderSize], uint32(len(frame)-frameHeaderSize)) //nolint:gosec // bounded by MaxFramePayload
+	_, err := s.Conn.Write(frame)
+	return err
+}
+
+func (s *compressedStream) Read(p []byte) (int, error) {
+	for len(s.pending) == 0 {
+		if err := s.readFrame(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+func (s *compressedStream) readFrame() error {
+	var hdr [frameHeaderSize]byte
+	if _, err := io.ReadFull(s.Conn, hdr[:]); err != nil {
+		return err
+	}
+	size := binary.BigEndian.Uint32(hdr[1:])
+	if size > MaxFramePayload {
+		return fmt.Errorf("frame too large: %d", size)
+	}
+	if cap(s.readBuf) < int(size) {
+		s.readBuf = make([]byte, size)
+	}
+	payload := s.readBuf[:size]
+	if _, err := io.ReadFull(s.Conn, payload); err != nil {
+		return fmt.Errorf("read frame: %w", err)
+	}
+
+	switch hdr[0] {
+	case frameRaw:
+		s.pending = payload
+	case frameZstd:
+		_, dec, err := frameCodec()
+		if err != nil {
+			return err
+		}
+		out, err := dec.DecodeAll(payload, nil)
+		if err != nil {
+			return fmt.Errorf("decompress frame: %w", err)
+		}
+		s.pending = out
+	default:
+		return fmt.Errorf("unknown frame kind: %#x", hdr[0])
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamHeader_CompressedFlag(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteCompressedStreamHeader(&buf, "abc123", "1.2.3.4:5678"))
+
+	hdr, err := ReadStreamHeader(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, "abc123", hdr.TunnelID)
+	assert.Equal(t, "1.2.3.4:5678", hdr.RemoteAddr)
+	assert.True(t, hdr.Compressed)
+
+	buf.Reset()
+	require.NoError(t, WriteStreamHeader(&buf, "abc123", "replay"))
+	hdr, err = ReadStreamHeader(&buf)
+	require.NoError(t, err)
+	assert.False(t, hdr.Compressed)
+
+	assert.Error(t, WriteStreamHeader(&buf, string(make([]byte, maxTunnelIDLen+1)), ""))
+}
+
+// recordingConn captures everything written to it.
+type recordingConn struct {
+	net.Conn
+	buf bytes.Buffer
+}
+
+func (r *recordingConn) Write(p []byte) (int, error) { return r.buf.Write(p) }
+
+// frameKinds returns the kind byte of every frame in raw.
+func frameKinds(t *testing.T, raw []byte) []byte {
+	t.Helper()
+	var kinds []byte
+	for len(raw) > 0 {
+		require.GreaterOrEqual(t, len(raw), frameHeaderSize)
+		size := int(binary.BigEndian.Uint32(raw[1:frameHeaderSize]))
+		kinds = append(kinds, raw[0])
+		raw = raw[frameHeaderSize+size:]
+	}
+	return kinds
+}
+
+func TestCompressedStream_Threshold(t *testing.T) {
+	rec := &recordingConn{}
+	s := NewCompressedStream(rec, 1024)
+
+	small := []byte("GET / HTTP/1.1\r\n")
+	large := bytes.Repeat([]byte("compressible payload "), 1000)
+
+	_, err := s.Write(small)
+	require.NoError(t, err)
+	_, err = s.Write(large)
+	require.NoError(t, err)
+
+	assert.Equal(t, []byte{frameRaw, frameZstd}, frameKinds(t, rec.buf.Bytes()))
+	assert.Less(t, rec.buf.Len(), len(large), "large write should shrink on the wire")
+}
+
+func TestCompressedStream_DisabledThreshold(t *testing.T) {
+	rec := &recordingConn{}
+	s := NewCompressedStream(rec, 0)
+
+	_, err := s.Write(bytes.Repeat([]byte("a"), 4096))
+	require.NoError(t, err)
+	assert.Equal(t, []byte{frameRaw}, frameKinds(t, rec.buf.Bytes()))
+}
+
+func TestCompressedStream_RoundTrip(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	writer := NewCompressedStream(a, 512)
+	reader := NewCompressedStream(b, 512)
+
+	// Larger than one frame, mixing compressible and tiny writes.
+	payload := append([]byte("hi"), bytes.Repeat([]byte("0123456789abcdef"), 3*MaxFramePayload/16+7)...)
+
+	go func() {
+		_, _ = writer.Write(payload[:2])
+		_, _ = writer.Write(payload[2:])
+		_ = writer.Close()
+	}()
+
+	got, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, payload, got)
+}
+
+func TestCompressedStream_RejectsOversizedFrame(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	go func() {
+		var hdr [frameHeaderSize]byte
+		hdr[0] = frameRaw
+		binary.BigEndian.PutUint32(hdr[1:], MaxFramePayload+1)
+		_, _ = a.Write(hdr[:])
+	}()
+
+	_, err := NewCompressedStream(b, 0).Read(make([]byte, 16))
+	assert.ErrorContains(t, err, "frame too large")
+}
+
+func TestCompressedStream_CloseWriteHalfCloses(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := ln.Accept()
+		accepted <- conn
+	}()
+	raw, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer raw.Close()
+	peerRaw := <-accepted
+	require.NotNil(t, peerRaw)
+	defer peerRaw.Close()
+
+	local := NewCompressedStream(raw, 0)
+	peer := NewCompressedStream(peerRaw, 0)
+
+	_, err = local.Write([]byte("bye"))
+	require.NoError(t, err)
+	require.NoError(t, CloseWrite(local))
+
+	got, err := io.ReadAll(peer)
+	require.NoError(t, err)
+	assert.Equal(t, "bye", string(got))
+
+	// The other direction still works after the half-close.
+	_, err = peer.Write([]byte("ack"))
+	require.NoError(t, err)
+	buf := make([]byte, 3)
+	_, err = io.ReadFull(local, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "ack", string(buf))
+}
@@ -3,22 +3,56 @@ package protocol
 import (
 	"fmt"
 	"io"
+
+	"github.com/hashicorp/yamux"
+)
+
+// HealthCheckRemoteAddr is the remote address the server puts in the stream
+// header of health-check probes. Clients recognise it to keep probes out of
+// the inspector and request log, and to answer TCP connect checks with a
+// single status byte (HealthCheckUp or HealthCheckDown) instead of proxying.
+const HealthCheckRemoteAddr = "healthcheck"
+
+// Status bytes a client writes back on a TCP health-check stream.
+const (
+	HealthCheckDown byte = 0
+	HealthCheckUp   byte = 1
 )
 
 // StreamHeader is the binary header sent at the start of each data stream
 // to identify the tunnel and remote address.
 //
-// Wire format: [1 byte: tunnel_id_len][tunnel_id bytes][1 byte: remote_addr_len][remote_addr bytes]
+// Wire format: [1 byte: flags|tunnel_id_len][tunnel_id bytes][1 byte: remote_addr_len][remote_addr bytes]
+//
+// The high bit of the first byte is the compressed flag: when set, everything
+// after the header is framed by NewCompressedStream in both directions.
 type StreamHeader struct {
 	TunnelID   string
 	RemoteAddr string
+	Compressed bool
 }
 
+const (
+	streamFlagCompressed byte = 0x80
+	maxTunnelIDLen            = 0x7f
+)
+
 // WriteStreamHeader writes a compact binary header to w.
 func WriteStreamHeader(w io.Writer, tunnelID, remoteAddr string) error {
+	return writeStreamHeader(w, tunnelID, remoteAddr, 0)
+}
+
+// WriteCompressedStreamHeader writes a stream header that tells the peer the
+// rest of the stream uses per-frame compression. Only send it to clients that
+// advertised AuthMessage.StreamCompression.
+func WriteCompressedStreamHeader(w io.Writer, tunnelID, remoteAddr string) error {
+	return writeStreamHeader(w, tunnelID, remoteAddr, streamFlagCompressed)
+}
+
+func writeStreamHeader(w io.Writer, tunnelID, remoteAddr string, flags byte) error {
 	tidLen := len(tunnelID)
 	raLen := len(remoteAddr)
-	if tidLen > 255 {
+	if tidLen > maxTunnelIDLen {
 		return fmt.Errorf("tunnel_id too long: %d", tidLen)
 	}
 	if raLen > 255 {
@@ -26,7 +60,7 @@ func WriteStreamHeader(w io.Writer, tunnelID, remoteAddr string) error {
 	}
 
 	buf := make([]byte, 1+tidLen+1+raLen)
-	buf[0] = byte(tidLen) //nolint:gosec // bounded above
+	buf[0] = flags | byte(tidLen) //nolint:gosec // bounded above
 	copy(buf[1:], tunnelID)
 	buf[1+tidLen] = byte(raLen) //nolint:gosec // bounded above
 	copy(buf[2+tidLen:], remoteAddr)
@@ -43,7 +77,8 @@ func ReadStreamHeader(r io.Reader) (*StreamHeader, error) {
 	if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
 		return nil, fmt.Errorf("read tunnel_id length: %w", err)
 	}
-	tidLen := int(lenBuf[0])
+	compressed := lenBuf[0]&streamFlagCompressed != 0
+	tidLen := int(lenBuf[0] &^ streamFlagCompressed)
 	tid := make([]byte, tidLen)
 	if tidLen > 0 {
 		if _, err := io.ReadFull(r, tid); err != nil {
@@ -66,5 +101,22 @@ func ReadStreamHeader(r io.Reader) (*StreamHeader, error) {
 	return &StreamHeader{
 		TunnelID:   string(tid),
 		RemoteAddr: string(ra),
+		Compressed: compressed,
 	}, nil
 }
+
+// CloseWrite half-closes a data stream or connection so the peer reads EOF
+// while data can still flow the other way. Connections with a CloseWrite
+// method (TCP, TLS, compressed streams) use it; yamux data streams already
+// treat Close as sending FIN and keep reading until the peer closes too.
+// Any other connection cannot be half-closed and is left open, for the
+// caller to close once the other direction is done.
+func CloseWrite(conn io.Closer) error {
+	switch c := conn.(type) {
+	case interface{ CloseWrite() error }:
+		return c.CloseWrite()
+	case *yamux.Stream:
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package protocol
+
+import (
+	"io"
+	"net"
+	"testing"
+
+	"github.com/hashicorp/yamux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloseWrite_YamuxStreamKeepsReading(t *testing.T) {
+	clientEnd, serverEnd := net.Pipe()
+	client, err := yamux.Client(clientEnd, nil)
+	require.NoError(t, err)
+	defer client.Close()
+	server, err := yamux.Server(serverEnd, nil)
+	require.NoError(t, err)
+	defer server.Close()
+
+	local, err := client.OpenStream()
+	require.NoError(t, err)
+	defer local.Close()
+	_, err = local.Write([]byte("bye"))
+	require.NoError(t, err)
+	peer, err := server.AcceptStream()
+	require.NoError(t, err)
+	defer peer.Close()
+
+	require.NoError(t, CloseWrite(local))
+	got, err := io.ReadAll(peer)
+	require.NoError(t, err)
+	assert.Equal(t, "bye", string(got))
+
+	_, err = peer.Write([]byte("ack"))
+	require.NoError(t, err)
+	buf := make([]byte, 3)
+	_, err = io.ReadFull(local, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "ack", string(buf))
+}
+
+func TestCloseWrite_LeavesOtherConnsOpen(t *testing.T) {
+	local, peer := net.Pipe()
+	defer local.Close()
+	defer peer.Close()
+
+	require.NoError(t, CloseWrite(local))
+
+	// Without a half-close the connection stays usable both ways
+	go func() { _, _ = peer.Write([]byte("ack")) }()
+	buf := make([]byte, 3)
+	_, err := io.ReadFull(local, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "ack", string(buf))
+
+	go func() { _, _ = local.Write([]byte("more")) }()
+	buf = make([]byte, 4)
+	_, err = io.ReadFull(peer, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "more", string(buf))
+}
@@ -35,6 +35,51 @@ type TunnelInfo struct {
 	ClientID   string
 	UserID     int64
 	CreatedAt  time.Time
+	Health     *TunnelHealth // nil when the tunnel has no health check
+
+	// LastActivity is when traffic last went through the tunnel, or when
+	// it was created if none has yet.
+	LastActivity time.Time
+}
+
+// ClientInfo represents a connected tunnel client and its tunnels
+type ClientInfo struct {
+	ID          string
+	Hostname    string
+	RemoteAddr  string
+	UserID      int64
+	ConnectedAt time.Time
+	Tunnels     []TunnelInfo
+	Sessions    SessionPressure
+}
+
+// SessionPressure represents the flow-control load on a client's yamux
+// sessions
+type SessionPressure struct {
+	Sessions      int
+	Streams       int
+	PendingWrites int64
+	Writes        int64
+	StalledWrites int64
+	WriteWait     time.Duration
+	StallRatio    float64 // share of writes that waited for window space
+}
+
+// TunnelHealth represents the state of a tunnel's server-run health check
+type TunnelHealth struct {
+	Check    string
+	Interval time.Duration
+	Status   string // up, down, unknown
+	Last     *HealthSample
+	History  []HealthSample
+}
+
+// HealthSample represents a single health check probe result
+type HealthSample struct {
+	Time      time.Time
+	Status    string
+	LatencyMs int64
+	Error     string
 }
 
 // Stats represents server statistics
@@ -44,6 +89,24 @@ type Stats struct {
 	HTTPTunnels   int
 	TCPTunnels    int
 	UDPTunnels    int
+	UDPFlows      int
+
+	AbnormalTunnelUsers int
+	TunnelCountWarnings int64
+}
+
+// DrainStatus represents the progress of a graceful server shutdown
+type DrainStatus struct {
+	Draining          bool
+	ActiveConnections int64
+	TimeLeft          time.Duration
+}
+
+// MonthlyUsage is a user's tunnel traffic for the current month, including
+// traffic the tunnel server has not yet written to the database
+type MonthlyUsage struct {
+	BytesIn  int64
+	BytesOut int64
 }
 
 // TunnelProvider is an interface for getting tunnel information
@@ -53,6 +116,17 @@ type TunnelProvider interface {
 	GetStats() Stats
 	GetAllTunnels() []TunnelInfo
 	AdminCloseTunnel(tunnelID string) error
+	GetTunnelHealth(tunnelID string, userID int64) *TunnelHealth
+	GetDrainStatus() DrainStatus
+	GetMonthlyUsage(userID int64) (MonthlyUsage, error)
+	GetClientsByUserID(userID int64) []ClientInfo
+	DisconnectClient(clientID string, userID int64) error
+	GetAllClients() []ClientInfo
+	AdminDisconnectClient(clientID string) error
+	PurgeTunnelCache(tunnelID string, userID int64) (int, error)
+	CloseTunnelBySubdomain(subdomain string) bool
+	SuspendSubdomain(subdomain string) int
+	UnsuspendSubdomain(subdomain string)
 }
 
 // InspectProvider provides access to traffic inspection buffers.
@@ -62,7 +136,7 @@ type InspectProvider interface {
 	AddAndPersist(tunnelID string, ex *inspect.CapturedExchange)
 	ListPersisted(tunnelID string, offset, limit int) ([]*inspect.CapturedExchange, int, error)
 	ListPersistedByHostAndUser(host string, userID int64, offset, limit int) ([]*inspect.CapturedExchange, int, error)
-	GetPersisted(id string) (*inspect.CapturedExchange, error)
+	GetPersistedByUser(id string, userID int64) (*inspect.CapturedExchange, error)
 }
 
 // ReplayProvider sends an HTTP request through a tunnel and returns the response.
@@ -86,6 +160,7 @@ type Server struct {
 	inspectProvider     InspectProvider
 	customDomainManager CustomDomainManager
 	replayProvider      ReplayProvider
+	replaySlots         *replaySlots
 	notifier            *email.Notifier
 	telegramNotifier    *telegram.AdminNotifier
 	paymentProviders    *payment.Registry
@@ -94,12 +169,15 @@ type Server struct {
 	log                 zerolog.Logger
 	baseDomain          string
 	downloadsPath       string
+	downloadSums        checksumCache
 	version             string
 	minVersion          string
 	deviceStore         store.DeviceStore
 	oauthStore          store.OAuthStore
 	nodeRegistry        store.NodeRegistry
 	ipBanStore          store.IPBanStore
+	oauthClient         *http.Client
+	oauthProviders      []OAuthProvider
 	shutdownCh          chan struct{}
 }
 
@@ -139,18 +217,21 @@ func New(cfg *config.ServerConfig, db *database.Database, authService *auth.Serv
 		tunnelProvider:      tunnelProvider,
 		inspectProvider:     inspectProvider,
 		customDomainManager: customDomainManager,
+		replaySlots:         newReplaySlots(cfg.Web.Replay.MaxConcurrent),
 		log:                 log.With().Str("component", "api").Logger(),
 		baseDomain:          cfg.Domain.Base,
 		downloadsPath:       cfg.Downloads.Path,
 		deviceStore:         memDevice,
 		oauthStore:          memOAuth,
 		ipBanStore:          memIPBan,
+		oauthClient:         newOAuthClient(cfg.OAuth.Timeout),
 		shutdownCh:          make(chan struct{}),
 	}
 
 	for _, opt := range opts {
 		opt(s)
 	}
+	s.oauthProviders = newOAuthProviders(&cfg.OAuth, s.oauthClient, s.log)
 
 	// Start cleanup goroutines only for in-memory stores
 	if s.deviceStore == memDevice {
@@ -238,6 +319,9 @@ func (s *Server) setupRoutes() {
 		MaxAge:           300,
 	}))
 
+	// Error messages in the user's language
+	r.Use(localeMiddleware)
+
 	// Health check
 	r.Get("/health", s.handleHealth)
 	r.Get("/install.sh", s.handleInstallScript)
@@ -246,6 +330,7 @@ func (s *Server) setupRoutes() {
 		r.Use(auth.MiddlewareWithDB(s.authService, s.db))
 		r.Use(auth.AdminMiddleware)
 		r.Handle("/metrics", metricsHandler())
+		r.Get("/health/drain", s.handleDrainStatus)
 	})
 
 	// API routes
@@ -273,11 +358,12 @@ func (s *Server) setupRoutes() {
 			r.Post("/refresh", s.handleRefresh)
 			r.Post("/device/code", s.handleDeviceCode)
 			r.Get("/device/token", s.handleDevicePoll)
-			r.Get("/github", s.handleGitHubAuth)
-			r.Get("/github/callback", s.handleGitHubCallback)
-			r.Get("/google", s.handleGoogleAuth)
-			r.Get("/google/callback", s.handleGoogleCallback)
+			for _, p := range s.oauthProviders {
+				r.Get("/"+p.Name(), s.handleOAuthLogin(p))
+				r.Get("/"+p.Name()+"/callback", s.handleOAuthCallback(p))
+			}
 			r.Post("/exchange", s.handleOAuthExchange)
+			r.Get("/verify-email", s.handleVerifyEmail)
 		})
 
 		// Downloads (public)
@@ -288,6 +374,14 @@ func (s *Server) setupRoutes() {
 
 		// Plans (public)
 		r.Get("/plans/public", s.handleListPublicPlans)
+		r.With(auth.OptionalMiddleware(s.authService)).Get("/plans", s.handleListAvailablePlans)
+
+		// Shared inspector links (public, read-only, authorized by the token)
+		r.Route("/inspect/shared/{token}", func(r chi.Router) {
+			r.Get("/", s.handleSharedListExchanges)
+			r.Get("/stream", s.handleSharedInspectStream)
+			r.Get("/{exchangeId}", s.handleSharedGetExchange)
+		})
 
 		// Exchange rate (public, cached)
 		r.Get("/exchange-rate", s.handleExchangeRate)
@@ -317,6 +411,7 @@ func (s *Server) setupRoutes() {
 		// SSE inspect stream (no timeout, long-lived connection)
 		r.Group(func(r chi.Router) {
 			r.Use(auth.MiddlewareWithDB(s.authService, s.db))
+			r.Use(userLocaleMiddleware)
 			r.Get("/tunnels/{id}/inspect/stream", s.handleInspectStream)
 		})
 
@@ -331,12 +426,22 @@ func (s *Server) setupRoutes() {
 		r.Group(func(r chi.Router) {
 			r.Use(middleware.Timeout(30 * time.Second))
 			r.Use(auth.MiddlewareWithDB(s.authService, s.db))
+			r.Use(userLocaleMiddleware)
+
+			// Replays are limited per user on top of the global limit
+			var replayLimit chi.Middlewares
+			if s.cfg.Web.RateLimit.Enabled && s.cfg.Web.Replay.PerMin > 0 {
+				replayRL := newIPRateLimiter(s.cfg.Web.Replay.PerMin)
+				replayRL.cleanup(s.shutdownCh, 5*time.Minute)
+				replayLimit = chi.Chain(userRateLimitMiddleware(replayRL))
+			}
 
 			// Auth
 			r.Post("/auth/logout", s.handleLogout)
 			r.Post("/auth/device/authorize", s.handleDeviceAuthorize)
-			r.Post("/auth/github/link", s.handleGitHubLink)
-			r.Post("/auth/google/link", s.handleGoogleLink)
+			for _, p := range s.oauthProviders {
+				r.Post("/auth/"+p.Name()+"/link", s.handleOAuthLink(p))
+			}
 
 			// TOTP
 			r.Route("/auth/totp", func(r chi.Router) {
@@ -350,6 +455,13 @@ func (s *Server) setupRoutes() {
 				r.Get("/", s.handleGetProfile)
 				r.Put("/", s.handleUpdateProfile)
 				r.Put("/password", s.handleChangePassword)
+				if s.cfg.Web.RateLimit.Enabled {
+					verifyRL := newIPRateLimiter(emailVerificationsPerMin)
+					verifyRL.cleanup(s.shutdownCh, 5*time.Minute)
+					r.With(userRateLimitMiddleware(verifyRL)).Post("/email", s.handleSendEmailVerification)
+				} else {
+					r.Post("/email", s.handleSendEmailVerification)
+				}
 			})
 
 			// Tokens
@@ -362,7 +474,13 @@ func (s *Server) setupRoutes() {
 			// Domains
 			r.Route("/domains", func(r chi.Router) {
 				r.Get("/", s.handleListDomains)
-				r.Post("/", s.handleReserveDomain)
+				if s.cfg.Web.RateLimit.Enabled {
+					reserveRL := newIPRateLimiter(domainReservationsPerMin)
+					reserveRL.cleanup(s.shutdownCh, 5*time.Minute)
+					r.With(userRateLimitMiddleware(reserveRL)).Post("/", s.handleReserveDomain)
+				} else {
+					r.Post("/", s.handleReserveDomain)
+				}
 				r.Delete("/{id}", s.handleReleaseDomain)
 				r.Get("/check/{subdomain}", s.handleCheckDomain)
 			})
@@ -379,11 +497,37 @@ func (s *Server) setupRoutes() {
 			r.Route("/tunnels", func(r chi.Router) {
 				r.Get("/", s.handleListTunnels)
 				r.Delete("/{id}", s.handleCloseTunnel)
+				r.Get("/{id}/health", s.handleTunnelHealth)
 				r.Get("/{id}/inspect", s.handleListExchanges)
 				r.Get("/{id}/inspect/status", s.handleInspectStatus)
 				r.Get("/{id}/inspect/{exchangeId}", s.handleGetExchange)
 				r.Delete("/{id}/inspect", s.handleClearExchanges)
-				r.Post("/{id}/inspect/{exchangeId}/replay", s.handleReplayExchange)
+				r.Delete("/{id}/inspect/cache", s.handlePurgeCache)
+				r.With(replayLimit...).Post("/{id}/inspect/{exchangeId}/replay", s.handleReplayExchange)
+				r.Post("/{id}/inspect/share", s.handleCreateInspectShare)
+			})
+
+			// Inspector share links
+			r.Route("/inspect/shares", func(r chi.Router) {
+				r.Get("/", s.handleListInspectShares)
+				r.Delete("/{shareId}", s.handleRevokeInspectShare)
+			})
+
+			// Saved inspector requests
+			r.Route("/collections", func(r chi.Router) {
+				r.Get("/", s.handleListCollections)
+				r.Post("/", s.handleCreateCollection)
+				r.Delete("/{id}", s.handleDeleteCollection)
+				r.Get("/{id}/items", s.handleListCollectionItems)
+				r.Post("/{id}/items", s.handleCreateCollectionItem)
+				r.Delete("/{id}/items/{itemId}", s.handleDeleteCollectionItem)
+				r.With(replayLimit...).Post("/{id}/items/{itemId}/run", s.handleRunCollectionItem)
+			})
+
+			// Connected clients
+			r.Route("/clients", func(r chi.Router) {
+				r.Get("/", s.handleListClients)
+				r.Delete("/{id}", s.handleDisconnectClient)
 			})
 
 			// Sync
@@ -397,6 +541,9 @@ func (s *Server) setupRoutes() {
 				r.Get("/history/stats", s.handleGetHistoryStats)
 			})
 
+			// Monthly traffic usage
+			r.Get("/usage", s.handleGetUsage)
+
 			// Subscription
 			r.Route("/subscription", func(r chi.Router) {
 				r.Get("/", s.handleGetSubscription)
@@ -418,6 +565,8 @@ func (s *Server) setupRoutes() {
 				r.Get("/audit-logs", s.handleListAuditLogs)
 				r.Get("/tunnels", s.handleListAllTunnels)
 				r.Delete("/tunnels/{id}", s.handleAdminCloseTunnel)
+				r.Get("/clients", s.handleAdminListClients)
+				r.Post("/clients/{id}/disconnect", s.handleAdminDisconnectClient)
 
 				r.Post("/users/merge", s.handleMergeUsers)
 				r.Post("/users/{id}/reset-password", s.handleAdminResetPassword)
@@ -467,6 +616,13 @@ func (s *Server) setupRoutes() {
 				r.Get("/ip-bans", s.handleListIPBans)
 				r.Post("/ip-bans", s.handleCreateIPBan)
 				r.Delete("/ip-bans/{ip}", s.handleDeleteIPBan)
+
+				// Abuse reports and suspended subdomains
+				r.Get("/abuse-reports", s.handleListAbuseReports)
+				r.Post("/abuse-reports/{id}/suspend", s.handleSuspendAbuseReport)
+				r.Post("/abuse-reports/{id}/dismiss", s.handleDismissAbuseReport)
+				r.Get("/suspended-subdomains", s.handleListSuspendedSubdomains)
+				r.Delete("/suspended-subdomains/{subdomain}", s.handleUnsuspendSubdomain)
 			})
 		})
 	})
@@ -558,11 +714,11 @@ func (s *Server) respondJSON(w http.ResponseWriter, status int, data interface{}
 }
 
 func (s *Server) respondError(w http.ResponseWriter, status int, message string) {
-	s.respondJSON(w, status, dto.ErrorResponse{Error: message})
+	s.respondJSON(w, status, dto.ErrorResponse{Error: s.localize(w, message)})
 }
 
 func (s *Server) respondErrorWithCode(w http.ResponseWriter, status int, code, message string) {
-	s.respondJSON(w, status, dto.ErrorResponse{Error: message, Code: code})
+	s.respondJSON(w, status, dto.ErrorResponse{Error: s.localize(w, message), Code: code})
 }
 
 func (s *Server) decodeJSON(r *http.Request, v interface{}) error {
@@ -580,3 +736,33 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 		Timestamp: time.Now().Unix(),
 	})
 }
+
+// handleDrainStatus reports shutdown progress so orchestrators can wait for
+// the proxied connections to finish before killing the process.
+func (s *Server) handleDrainStatus(w http.ResponseWriter, r *http.Request) {
+	s.respondJSON(w, http.StatusOK, drainStatusResponse(s.tunnelProvider.GetDrainStatus()))
+}
+
+// DrainStatusHandler serves the drain progress reported by drain without
+// auth, for the internal listener of server.drain_status_addr.
+func DrainStatusHandler(drain func() DrainStatus) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(drainStatusResponse(drain()))
+	})
+}
+
+func drainStatusResponse(drain DrainStatus) dto.DrainStatusResponse {
+	resp := dto.DrainStatusResponse{
+		Status:            "serving",
+		ActiveConnections: drain.ActiveConnections,
+	}
+	if drain.Draining {
+		resp.Status = "draining"
+		if drain.ActiveConnections == 0 {
+			resp.Status = "drained"
+		}
+		resp.TimeLeftSeconds = int(drain.TimeLeft.Round(time.Second) / time.Second)
+	}
+	return resp
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// downloadsManifestFile is the optional release manifest read from the
+// downloads directory. It carries the metadata that cannot be derived from the
+// binaries themselves:
+//
+//	{
+//	  "version": "v1.4.0",
+//	  "release_notes": "Bug fixes",
+//	  "platforms": {
+//	    "cli-linux-arm64": {"version": "v1.4.1", "release_notes": "ARM hotfix"}
+//	  }
+//	}
+//
+// Per-platform entries override the top-level values. Checksums are never read
+// from the manifest; they are always computed from the files being served.
+const downloadsManifestFile = "manifest.json"
+
+// downloadsManifest is the parsed form of manifest.json.
+type downloadsManifest struct {
+	Version      string                            `json:"version"`
+	ReleaseNotes string                            `json:"release_notes"`
+	Platforms    map[string]downloadsManifestEntry `json:"platforms"`
+}
+
+// downloadsManifestEntry overrides manifest metadata for a single platform.
+type downloadsManifestEntry struct {
+	Version      string `json:"version"`
+	ReleaseNotes string `json:"release_notes"`
+}
+
+// loadDownloadsManifest reads manifest.json from the downloads directory.
+// A missing or malformed manifest yields an empty one so downloads keep working.
+func (s *Server) loadDownloadsManifest() *downloadsManifest {
+	m := &downloadsManifest{}
+	data, err := os.ReadFile(filepath.Join(s.downloadsPath, downloadsManifestFile))
+	if err != nil {
+		return m
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		s.log.Warn().Err(err).Msg("Invalid downloads manifest")
+		return &downloadsManifest{}
+	}
+	return m
+}
+
+// lookup returns the version and release notes for a platform.
+func (m *downloadsManifest) lookup(platform string) (version, notes string) {
+	version, notes = m.Version, m.ReleaseNotes
+	if e, ok := m.Platforms[platform]; ok {
+		if e.Version != "" {
+			version = e.Version
+		}
+		if e.ReleaseNotes != "" {
+			notes = e.ReleaseNotes
+		}
+	}
+	return version, notes
+}
+
+// version returns the manifest's release version, or fallback when unset.
+func (m *downloadsManifest) version(fallback string) string {
+	if m.Version != "" {
+		return m.Version
+	}
+	return fallback
+}
+
+// checksumCache memoizes SHA-256 sums of download binaries so the directory
+// scan on every request does not rehash unchanged files. Entries are keyed by
+// path and invalidated when the file's size or modification time changes.
+// The zero value is ready to use.
+type checksumCache struct {
+	mu      sync.Mutex
+	entries map[string]checksumEntry
+}
+
+type checksumEntry struct {
+	size    int64
+	modTime time.Time
+	sum     string
+}
+
+// sum returns the hex-encoded SHA-256 of the file at path.
+func (c *checksumCache) sum(path string, fi fs.FileInfo) (string, error) {
+	c.mu.Lock()
+	if e, ok := c.entries[path]; ok && e.size == fi.Size() && e.modTime.Equal(fi.ModTime()) {
+		c.mu.Unlock()
+		return e.sum, nil
+	}
+	c.mu.Unlock()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("hash %s: %w", filepath.Base(path), err)
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	c.mu.Lock()
+	if c.entries == nil {
+		c.entries = make(map[string]checksumEntry)
+	}
+	c.entries[path] = checksumEntry{size: fi.Size(), modTime: fi.ModTime(), sum: sum}
+	c.mu.Unlock()
+
+	return sum, nil
+}
@@ -27,7 +27,14 @@ type ChangePasswordRequest struct {
 
 // UpdateProfileRequest represents a profile update request
 type UpdateProfileRequest struct {
-	DisplayName string `json:"display_name" validate:"max=100"`
+	DisplayName string  `json:"display_name" validate:"max=100"`
+	Locale      *string `json:"locale,omitempty"` // language of server messages; "" resets it
+}
+
+// SendEmailVerificationRequest asks for a verification link for Email,
+// which becomes the user's email if it is not already
+type SendEmailVerificationRequest struct {
+	Email string `json:"email" validate:"required,email,max=254"`
 }
 
 // CreateTokenRequest represents an API token creation request
@@ -40,7 +47,11 @@ type CreateTokenRequest struct {
 
 // ReserveDomainRequest represents a domain reservation request
 type ReserveDomainRequest struct {
-	Subdomain string `json:"subdomain" validate:"required,min=3,max=32,alphanum"`
+	// Subdomain is normalized and checked by config.NormalizeSubdomain
+	Subdomain string `json:"subdomain" validate:"required,max=63"`
+	// ExpiresIn releases the reservation after this many seconds; 0 keeps it
+	// until the user releases it.
+	ExpiresIn int64 `json:"expires_in,omitempty" validate:"omitempty,min=3600,max=31536000"`
 }
 
 // TOTPVerifyRequest represents a TOTP verification request
@@ -84,6 +95,9 @@ type CreatePlanRequest struct {
 	RateLimitHTTP      int     `json:"rate_limit_http"`
 	CreemProductID     string  `json:"creem_product_id"`
 	MaxDataSessions    int     `json:"max_data_sessions"`
+	MonthlyBytes       int64   `json:"monthly_bytes"`
+	InspectMaxEntries  int     `json:"inspect_max_entries"`
+	SOCKSEnabled       bool    `json:"socks_enabled"`
 }
 
 // UpdatePlanRequest represents a plan update request
@@ -104,6 +118,9 @@ type UpdatePlanRequest struct {
 	RateLimitHTTP      *int     `json:"rate_limit_http,omitempty"`
 	CreemProductID     *string  `json:"creem_product_id,omitempty"`
 	MaxDataSessions    *int     `json:"max_data_sessions,omitempty"`
+	MonthlyBytes       *int64   `json:"monthly_bytes,omitempty"`
+	InspectMaxEntries  *int     `json:"inspect_max_entries,omitempty"`
+	SOCKSEnabled       *bool    `json:"socks_enabled,omitempty"`
 }
 
 // MergeUsersRequest represents a request to merge two users
@@ -147,6 +164,34 @@ type ReplayExchangeRequest struct {
 	Body    *string             `json:"body,omitempty"` // base64-encoded
 }
 
+// CreateCollectionRequest creates a collection of saved requests
+type CreateCollectionRequest struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+// CreateCollectionItemRequest saves a request to a collection: a captured
+// exchange (TunnelID and ExchangeID) with optional modifications, or a
+// request given in full (Method and Path at least)
+type CreateCollectionItemRequest struct {
+	Name       string              `json:"name,omitempty" validate:"max=200"`
+	TunnelID   string              `json:"tunnel_id,omitempty"`
+	ExchangeID string              `json:"exchange_id,omitempty"`
+	Method     *string             `json:"method,omitempty" validate:"omitempty,min=1,max=16"`
+	Path       *string             `json:"path,omitempty" validate:"omitempty,startswith=/"`
+	Headers    map[string][]string `json:"headers,omitempty"`
+	Body       *string             `json:"body,omitempty"` // base64-encoded
+}
+
+// RunCollectionItemRequest sends a saved request through a tunnel
+type RunCollectionItemRequest struct {
+	TunnelID string `json:"tunnel_id" validate:"required"`
+}
+
+// CreateInspectShareRequest creates a read-only link to a tunnel's inspector
+type CreateInspectShareRequest struct {
+	ExpiresIn int `json:"expires_in,omitempty"` // seconds, one hour if 0
+}
+
 // BulkUsersRequest is used for bulk user operations
 type BulkUsersRequest struct {
 	Action  string  `json:"action"`   // "block", "unblock", "delete", "change_plan"
@@ -42,6 +42,9 @@ type PlanDTO struct {
 	CreemProductID     string  `json:"creem_product_id"`
 	MaxDataSessions    int     `json:"max_data_sessions"`
 	UDPEnabled         bool    `json:"udp_enabled"`
+	MonthlyBytes       int64   `json:"monthly_bytes"`
+	InspectMaxEntries  int     `json:"inspect_max_entries"`
+	SOCKSEnabled       bool    `json:"socks_enabled"`
 }
 
 // PlanFromModel converts a database Plan to PlanDTO
@@ -70,41 +73,48 @@ func PlanFromModel(p *database.Plan) *PlanDTO {
 		CreemProductID:     p.CreemProductID,
 		MaxDataSessions:    p.MaxDataSessions,
 		UDPEnabled:         p.UDPEnabled,
+		MonthlyBytes:       p.MonthlyBytes,
+		InspectMaxEntries:  p.InspectMaxEntries,
+		SOCKSEnabled:       p.SOCKSEnabled,
 	}
 }
 
 // UserDTO represents a user in API responses
 type UserDTO struct {
-	ID          int64      `json:"id"`
-	Phone       string     `json:"phone"`
-	DisplayName string     `json:"display_name"`
-	IsAdmin     bool       `json:"is_admin"`
-	IsActive    bool       `json:"is_active"`
-	PlanID      int64      `json:"plan_id"`
-	Plan        *PlanDTO   `json:"plan,omitempty"`
-	GitHubID    *int64     `json:"github_id,omitempty"`
-	GoogleID    *string    `json:"google_id,omitempty"`
-	Email       string     `json:"email,omitempty"`
-	AvatarURL   string     `json:"avatar_url,omitempty"`
-	CreatedAt   time.Time  `json:"created_at"`
-	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+	ID            int64      `json:"id"`
+	Phone         string     `json:"phone"`
+	DisplayName   string     `json:"display_name"`
+	IsAdmin       bool       `json:"is_admin"`
+	IsActive      bool       `json:"is_active"`
+	PlanID        int64      `json:"plan_id"`
+	Plan          *PlanDTO   `json:"plan,omitempty"`
+	GitHubID      *int64     `json:"github_id,omitempty"`
+	GoogleID      *string    `json:"google_id,omitempty"`
+	GitLabID      *int64     `json:"gitlab_id,omitempty"`
+	Email         string     `json:"email,omitempty"`
+	EmailVerified bool       `json:"email_verified"`
+	AvatarURL     string     `json:"avatar_url,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	LastLoginAt   *time.Time `json:"last_login_at,omitempty"`
 }
 
 // UserFromModel converts a database User to UserDTO
 func UserFromModel(u *database.User) *UserDTO {
 	return &UserDTO{
-		ID:          u.ID,
-		Phone:       u.Phone,
-		DisplayName: u.DisplayName,
-		IsAdmin:     u.IsAdmin,
-		IsActive:    u.IsActive,
-		PlanID:      u.PlanID,
-		GitHubID:    u.GitHubID,
-		GoogleID:    u.GoogleID,
-		Email:       u.Email,
-		AvatarURL:   u.AvatarURL,
-		CreatedAt:   u.CreatedAt,
-		LastLoginAt: u.LastLoginAt,
+		ID:            u.ID,
+		Phone:         u.Phone,
+		DisplayName:   u.DisplayName,
+		IsAdmin:       u.IsAdmin,
+		IsActive:      u.IsActive,
+		PlanID:        u.PlanID,
+		GitHubID:      u.GitHubID,
+		GoogleID:      u.GoogleID,
+		GitLabID:      u.GitLabID,
+		Email:         u.Email,
+		EmailVerified: u.EmailVerified,
+		AvatarURL:     u.AvatarURL,
+		CreatedAt:     u.CreatedAt,
+		LastLoginAt:   u.LastLoginAt,
 	}
 }
 
@@ -125,6 +135,7 @@ type ProfileResponse struct {
 	TokenCount      int               `json:"token_count"`
 	TunnelCount     int               `json:"tunnel_count"`
 	Plan            *PlanDTO          `json:"plan,omitempty"`
+	Locale          string            `json:"locale,omitempty"`
 }
 
 // TokenDTO represents an API token in API responses
@@ -166,10 +177,11 @@ type TokensListResponse struct {
 
 // DomainDTO represents a reserved domain in API responses
 type DomainDTO struct {
-	ID        int64     `json:"id"`
-	Subdomain string    `json:"subdomain"`
-	URL       string    `json:"url"`
-	CreatedAt time.Time `json:"created_at"`
+	ID        int64      `json:"id"`
+	Subdomain string     `json:"subdomain"`
+	URL       string     `json:"url"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
 }
 
 // DomainFromModel converts a database ReservedDomain to DomainDTO
@@ -179,6 +191,7 @@ func DomainFromModel(d *database.ReservedDomain, baseDomain string) *DomainDTO {
 		Subdomain: d.Subdomain,
 		URL:       "https://" + d.Subdomain + "." + baseDomain,
 		CreatedAt: d.CreatedAt,
+		ExpiresAt: d.ExpiresAt,
 	}
 }
 
@@ -198,15 +211,38 @@ type DomainCheckResponse struct {
 
 // TunnelDTO represents a tunnel in API responses
 type TunnelDTO struct {
-	ID         string    `json:"id"`
-	Type       string    `json:"type"` // http, tcp, udp
-	Name       string    `json:"name"`
-	Subdomain  string    `json:"subdomain,omitempty"`
-	RemotePort int       `json:"remote_port,omitempty"`
-	LocalPort  int       `json:"local_port"`
-	URL        string    `json:"url,omitempty"`
-	ClientID   string    `json:"client_id"`
-	CreatedAt  time.Time `json:"created_at"`
+	ID         string           `json:"id"`
+	Type       string           `json:"type"` // http, tcp, udp
+	Name       string           `json:"name"`
+	Subdomain  string           `json:"subdomain,omitempty"`
+	RemotePort int              `json:"remote_port,omitempty"`
+	LocalPort  int              `json:"local_port"`
+	URL        string           `json:"url,omitempty"`
+	ClientID   string           `json:"client_id"`
+	CreatedAt  time.Time        `json:"created_at"`
+	Health     *TunnelHealthDTO `json:"health,omitempty"`
+
+	LastActivity time.Time `json:"last_activity"`
+	IdleSeconds  int64     `json:"idle_seconds"`
+}
+
+// TunnelHealthDTO represents a tunnel's health check state in API responses
+type TunnelHealthDTO struct {
+	Check           string            `json:"check"` // HTTP path or "tcp"
+	IntervalSeconds int               `json:"interval_seconds"`
+	Status          string            `json:"status"` // up, down, unknown
+	LastCheckedAt   *time.Time        `json:"last_checked_at,omitempty"`
+	LatencyMs       int64             `json:"latency_ms,omitempty"`
+	Error           string            `json:"error,omitempty"`
+	History         []HealthSampleDTO `json:"history,omitempty"`
+}
+
+// HealthSampleDTO represents a single health check result
+type HealthSampleDTO struct {
+	Time      time.Time `json:"time"`
+	Status    string    `json:"status"`
+	LatencyMs int64     `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
 }
 
 // TunnelsListResponse represents a list of tunnels
@@ -215,6 +251,40 @@ type TunnelsListResponse struct {
 	Total   int          `json:"total"`
 }
 
+// ClientDTO represents a connected tunnel client in API responses
+type ClientDTO struct {
+	ID          string       `json:"id"`
+	Hostname    string       `json:"hostname,omitempty"`
+	IP          string       `json:"ip"`
+	ConnectedAt time.Time    `json:"connected_at"`
+	Tunnels     []*TunnelDTO `json:"tunnels"`
+	Sessions    SessionsDTO  `json:"sessions"`
+}
+
+// SessionsDTO represents the flow-control load on a client's sessions. A
+// stall ratio near 1 means full stream windows limit the client's throughput.
+type SessionsDTO struct {
+	Count         int     `json:"count"`
+	Streams       int     `json:"streams"`
+	PendingWrites int64   `json:"pending_writes"`
+	Writes        int64   `json:"writes"`
+	StalledWrites int64   `json:"stalled_writes"`
+	WriteWaitMs   int64   `json:"write_wait_ms"`
+	StallRatio    float64 `json:"stall_ratio"`
+}
+
+// ClientsListResponse represents a list of connected clients
+type ClientsListResponse struct {
+	Clients []*ClientDTO `json:"clients"`
+	Total   int          `json:"total"`
+}
+
+// CachePurgeResponse reports how many stored responses a tunnel cache purge
+// dropped
+type CachePurgeResponse struct {
+	Purged int `json:"purged"`
+}
+
 // TOTPEnableResponse represents a TOTP enable response
 type TOTPEnableResponse struct {
 	Secret      string   `json:"secret"`
@@ -224,19 +294,23 @@ type TOTPEnableResponse struct {
 
 // DownloadDTO represents a client download in API responses
 type DownloadDTO struct {
-	Platform   string `json:"platform"`    // linux-amd64, darwin-arm64, windows-amd64
-	OS         string `json:"os"`          // Linux, macOS, Windows
-	Arch       string `json:"arch"`        // amd64, arm64
-	Size       int64  `json:"size"`        // bytes
-	URL        string `json:"url"`         // /api/downloads/:platform
-	ClientType string `json:"client_type"` // cli, gui
+	Platform     string `json:"platform"`                // linux-amd64, darwin-arm64, windows-amd64
+	OS           string `json:"os"`                      // Linux, macOS, Windows
+	Arch         string `json:"arch"`                    // amd64, arm64
+	Size         int64  `json:"size"`                    // bytes
+	URL          string `json:"url"`                     // /api/downloads/:platform
+	ClientType   string `json:"client_type"`             // cli, gui
+	Version      string `json:"version,omitempty"`       // release version from the downloads manifest
+	SHA256       string `json:"sha256"`                  // hex-encoded SHA-256 of the binary
+	ReleaseNotes string `json:"release_notes,omitempty"` // release notes from the downloads manifest
 }
 
 // DownloadsListResponse represents a list of available downloads
 type DownloadsListResponse struct {
-	Clients    []*DownloadDTO `json:"clients"`     // CLI clients (deprecated, use cli field)
-	CLI        []*DownloadDTO `json:"cli"`         // CLI clients
-	GUI        []*DownloadDTO `json:"gui"`         // GUI clients
+	Version string         `json:"version,omitempty"` // latest release version
+	Clients []*DownloadDTO `json:"clients"`           // CLI clients (deprecated, use cli field)
+	CLI     []*DownloadDTO `json:"cli"`               // CLI clients
+	GUI     []*DownloadDTO `json:"gui"`               // GUI clients
 }
 
 // StatsResponse represents server statistics
@@ -246,8 +320,14 @@ type StatsResponse struct {
 	HTTPTunnels      int   `json:"http_tunnels"`
 	TCPTunnels       int   `json:"tcp_tunnels"`
 	UDPTunnels       int   `json:"udp_tunnels"`
+	UDPFlows         int   `json:"udp_flows"`
 	TotalUsers       int   `json:"total_users"`
 	TotalConnections int64 `json:"total_connections"`
+
+	// Users at or above the server's soft per-user tunnel cap, and how often
+	// the cap was reached since startup.
+	AbnormalTunnelUsers int   `json:"abnormal_tunnel_users"`
+	TunnelCountWarnings int64 `json:"tunnel_count_warnings"`
 }
 
 // HealthResponse represents a health check response
@@ -257,6 +337,13 @@ type HealthResponse struct {
 	Timestamp int64  `json:"timestamp"`
 }
 
+// DrainStatusResponse represents the graceful shutdown progress
+type DrainStatusResponse struct {
+	Status            string `json:"status"` // serving, draining, drained
+	ActiveConnections int64  `json:"active_connections"`
+	TimeLeftSeconds   int    `json:"time_left_seconds"`
+}
+
 // AuditLogDTO represents an audit log entry in API responses
 type AuditLogDTO struct {
 	ID        int64                  `json:"id"`
@@ -300,6 +387,27 @@ type AdminTunnelDTO struct {
 	UserID     int64     `json:"user_id"`
 	UserPhone  string    `json:"user_phone"`
 	CreatedAt  time.Time `json:"created_at"`
+
+	LastActivity time.Time `json:"last_activity"`
+	IdleSeconds  int64     `json:"idle_seconds"`
+}
+
+// AdminClientDTO represents a connected tunnel client for admin
+type AdminClientDTO struct {
+	ID           string    `json:"id"`
+	Hostname     string    `json:"hostname,omitempty"`
+	IP           string    `json:"ip"`
+	UserID       int64     `json:"user_id"`
+	UserPhone    string    `json:"user_phone"`
+	ConnectedAt  time.Time `json:"connected_at"`
+	TunnelCount  int       `json:"tunnel_count"`
+	DataSessions int       `json:"data_sessions"`
+}
+
+// AdminClientsListResponse represents a list of clients for admin
+type AdminClientsListResponse struct {
+	Clients []*AdminClientDTO `json:"clients"`
+	Total   int               `json:"total"`
 }
 
 // AdminTunnelsListResponse represents a list of all tunnels for admin
@@ -486,6 +594,8 @@ type TunnelHistoryDTO struct {
 	DisconnectedAt *time.Time `json:"disconnected_at,omitempty"`
 	BytesSent      int64      `json:"bytes_sent"`
 	BytesReceived  int64      `json:"bytes_received"`
+	Event          string     `json:"event"`
+	Details        string     `json:"details,omitempty"`
 }
 
 // TunnelHistoryStatsDTO represents tunnel history stats
@@ -495,12 +605,47 @@ type TunnelHistoryStatsDTO struct {
 	TotalBytesReceived int64 `json:"total_bytes_received"`
 }
 
+// UsageDTO represents a user's month-to-date tunnel traffic
+type UsageDTO struct {
+	Period     string `json:"period"` // YYYY-MM, UTC
+	BytesIn    int64  `json:"bytes_in"`
+	BytesOut   int64  `json:"bytes_out"`
+	BytesTotal int64  `json:"bytes_total"`
+	LimitBytes int64  `json:"limit_bytes"` // 0 = unlimited
+}
+
+// InspectShareResponse is a read-only link to a tunnel's inspector. URL
+// opens the inspector page, APIURL serves the same data as JSON.
+type InspectShareResponse struct {
+	ID        int64     `json:"id"`
+	Token     string    `json:"token"`
+	URL       string    `json:"url"`
+	APIURL    string    `json:"api_url"`
+	Subdomain string    `json:"subdomain"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// InspectShareDTO is a share link still in force, without its token
+type InspectShareDTO struct {
+	ID        int64     `json:"id"`
+	Subdomain string    `json:"subdomain"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// InspectSharesListResponse lists the user's share links
+type InspectSharesListResponse struct {
+	Shares []*InspectShareDTO `json:"shares"`
+}
+
 // ReplayResponse represents the result of a replay operation
 type ReplayResponse struct {
 	StatusCode      int                 `json:"status_code"`
 	ResponseHeaders map[string][]string `json:"response_headers"`
 	ResponseBody    []byte              `json:"response_body"`
 	ExchangeID      string              `json:"exchange_id"`
+	// Truncated is set when the response body was cut at the size limit
+	Truncated bool `json:"truncated"`
 }
 
 // ChartDataPoint represents a single data point for admin charts
@@ -78,6 +78,8 @@ type HistoryDTO struct {
 	DisconnectedAt *time.Time `json:"disconnected_at,omitempty"`
 	BytesSent      int64      `json:"bytes_sent"`
 	BytesReceived  int64      `json:"bytes_received"`
+	Event          string     `json:"event"`
+	Details        string     `json:"details,omitempty"`
 }
 
 // SettingDTO represents a setting in API responses
@@ -115,6 +117,8 @@ func HistoryDTOFromModel(entry *database.UserHistoryEntry) HistoryDTO {
 		DisconnectedAt: entry.DisconnectedAt,
 		BytesSent:      entry.BytesSent,
 		BytesReceived:  entry.BytesReceived,
+		Event:          entry.Event,
+		Details:        entry.Details,
 	}
 }
 
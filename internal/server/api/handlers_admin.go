@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"runtime"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -35,7 +36,11 @@ func (s *Server) handleGetStats(w http.ResponseWriter, r *http.Request) {
 		HTTPTunnels:   stats.HTTPTunnels,
 		TCPTunnels:    stats.TCPTunnels,
 		UDPTunnels:    stats.UDPTunnels,
+		UDPFlows:      stats.UDPFlows,
 		TotalUsers:    totalUsers,
+
+		AbnormalTunnelUsers: stats.AbnormalTunnelUsers,
+		TunnelCountWarnings: stats.TunnelCountWarnings,
 	})
 }
 
@@ -165,7 +170,62 @@ func (s *Server) handleListAuditLogs(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// handleListAllTunnels returns all active tunnels for admin with optional type and user_id filters
+// adminTunnelFilter narrows the admin tunnel list. Zero fields match all.
+type adminTunnelFilter struct {
+	subdomain  string // substring, lowercase
+	tunnelType string
+	userID     *int64
+	remotePort int
+}
+
+// parseAdminTunnelFilter reads the subdomain, type, user_id and port query
+// parameters. A subdomain may be given as a full hostname of the base
+// domain, e.g. "suspicious.example.com".
+func parseAdminTunnelFilter(r *http.Request, baseDomain string) (adminTunnelFilter, error) {
+	q := r.URL.Query()
+	f := adminTunnelFilter{tunnelType: q.Get("type")}
+
+	f.subdomain = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(q.Get("subdomain")), "."))
+	if baseDomain != "" {
+		f.subdomain = strings.TrimSuffix(f.subdomain, "."+strings.ToLower(baseDomain))
+	}
+
+	if v := q.Get("user_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return f, errors.New("invalid user_id")
+		}
+		f.userID = &id
+	}
+	if v := q.Get("port"); v != "" {
+		port, err := strconv.Atoi(v)
+		if err != nil || port < 1 || port > 65535 {
+			return f, errors.New("invalid port")
+		}
+		f.remotePort = port
+	}
+	return f, nil
+}
+
+func (f adminTunnelFilter) matches(t TunnelInfo) bool {
+	if f.tunnelType != "" && t.Type != f.tunnelType {
+		return false
+	}
+	if f.userID != nil && t.UserID != *f.userID {
+		return false
+	}
+	if f.remotePort != 0 && t.RemotePort != f.remotePort {
+		return false
+	}
+	if f.subdomain != "" && !strings.Contains(strings.ToLower(t.Subdomain), f.subdomain) {
+		return false
+	}
+	return true
+}
+
+// handleListAllTunnels returns all active tunnels for admin, optionally
+// filtered by subdomain substring, type, user_id, remote port and idle time,
+// and sorted by creation or idle time.
 func (s *Server) handleListAllTunnels(w http.ResponseWriter, r *http.Request) {
 	if s.tunnelProvider == nil {
 		s.respondJSON(w, http.StatusOK, dto.AdminTunnelsListResponse{
@@ -175,27 +235,25 @@ func (s *Server) handleListAllTunnels(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get all tunnels
-	tunnels := s.tunnelProvider.GetAllTunnels()
-
-	// Task 6: Filter in-memory by type and user_id
-	tunnelType := r.URL.Query().Get("type")
-	userIDStr := r.URL.Query().Get("user_id")
-	var filterUserID int64
-	if userIDStr != "" {
-		filterUserID, _ = strconv.ParseInt(userIDStr, 10, 64)
+	filter, err := parseAdminTunnelFilter(r, s.baseDomain)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	query, err := parseTunnelListQuery(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
 	var filtered []TunnelInfo
-	for _, t := range tunnels {
-		if tunnelType != "" && t.Type != tunnelType {
-			continue
-		}
-		if userIDStr != "" && t.UserID != filterUserID {
-			continue
+	for _, t := range s.tunnelProvider.GetAllTunnels() {
+		if filter.matches(t) {
+			filtered = append(filtered, t)
 		}
-		filtered = append(filtered, t)
 	}
+	now := time.Now()
+	filtered = query.apply(filtered, now)
 
 	// Batch fetch users for tunnels
 	userIDs := make([]int64, 0)
@@ -223,17 +281,19 @@ func (s *Server) handleListAllTunnels(w http.ResponseWriter, r *http.Request) {
 		}
 
 		tunnelDTOs[i] = &dto.AdminTunnelDTO{
-			ID:         t.ID,
-			Type:       t.Type,
-			Name:       t.Name,
-			Subdomain:  t.Subdomain,
-			RemotePort: t.RemotePort,
-			LocalPort:  t.LocalPort,
-			URL:        url,
-			ClientID:   t.ClientID,
-			UserID:     t.UserID,
-			UserPhone:  userPhone,
-			CreatedAt:  t.CreatedAt,
+			ID:           t.ID,
+			Type:         t.Type,
+			Name:         t.Name,
+			Subdomain:    t.Subdomain,
+			RemotePort:   t.RemotePort,
+			LocalPort:    t.LocalPort,
+			URL:          url,
+			ClientID:     t.ClientID,
+			UserID:       t.UserID,
+			UserPhone:    userPhone,
+			CreatedAt:    t.CreatedAt,
+			LastActivity: tunnelLastActivity(t),
+			IdleSeconds:  int64(tunnelIdle(t, now) / time.Second),
 		}
 	}
 
@@ -524,6 +584,88 @@ func (s *Server) handleAdminCloseTunnel(w http.ResponseWriter, r *http.Request)
 	})
 }
 
+// handleAdminListClients returns every connected tunnel client (admin only)
+func (s *Server) handleAdminListClients(w http.ResponseWriter, r *http.Request) {
+	if s.tunnelProvider == nil {
+		s.respondJSON(w, http.StatusOK, dto.AdminClientsListResponse{
+			Clients: []*dto.AdminClientDTO{},
+			Total:   0,
+		})
+		return
+	}
+
+	clients := s.tunnelProvider.GetAllClients()
+
+	// Batch fetch users for clients
+	usersMap := map[int64]*database.User{}
+	if s.db != nil {
+		userIDs := make([]int64, 0)
+		for _, c := range clients {
+			if c.UserID > 0 {
+				userIDs = append(userIDs, c.UserID)
+			}
+		}
+		usersMap, _ = s.db.Users.GetByIDs(userIDs)
+	}
+
+	clientDTOs := make([]*dto.AdminClientDTO, len(clients))
+	for i, c := range clients {
+		var userPhone string
+		if user, ok := usersMap[c.UserID]; ok {
+			userPhone = user.Phone
+		}
+		clientDTOs[i] = &dto.AdminClientDTO{
+			ID:          c.ID,
+			Hostname:    c.Hostname,
+			IP:          clientIP(c.RemoteAddr),
+			UserID:      c.UserID,
+			UserPhone:   userPhone,
+			ConnectedAt: c.ConnectedAt,
+			TunnelCount: len(c.Tunnels),
+			// Sessions counts the primary session too
+			DataSessions: max(c.Sessions.Sessions-1, 0),
+		}
+	}
+
+	s.respondJSON(w, http.StatusOK, dto.AdminClientsListResponse{
+		Clients: clientDTOs,
+		Total:   len(clientDTOs),
+	})
+}
+
+// handleAdminDisconnectClient disconnects any client (admin only). The
+// client is told the disconnect is final, so it does not reconnect.
+func (s *Server) handleAdminDisconnectClient(w http.ResponseWriter, r *http.Request) {
+	clientID := chi.URLParam(r, "id")
+	if clientID == "" {
+		s.respondError(w, http.StatusBadRequest, "client id is required")
+		return
+	}
+
+	if s.tunnelProvider == nil {
+		s.respondError(w, http.StatusServiceUnavailable, "tunnel provider not available")
+		return
+	}
+
+	if err := s.tunnelProvider.AdminDisconnectClient(clientID); err != nil {
+		s.respondError(w, http.StatusNotFound, "client not found")
+		return
+	}
+
+	if s.db != nil {
+		currentUser := auth.GetUserFromContext(r.Context())
+		_ = s.db.Audit.Log(&currentUser.ID, database.ActionClientDisconnected, map[string]interface{}{
+			"client_id": clientID,
+			"admin":     true,
+		}, auth.GetClientIP(r))
+	}
+
+	s.respondJSON(w, http.StatusOK, dto.SuccessResponse{
+		Success: true,
+		Message: "client disconnected",
+	})
+}
+
 // handleListPlans returns all plans
 func (s *Server) handleListPlans(w http.ResponseWriter, r *http.Request) {
 	plans, err := s.db.Plans.List()
@@ -552,6 +694,38 @@ func (s *Server) handleListPublicPlans(w http.ResponseWriter, r *http.Request) {
 	s.respondJSON(w, http.StatusOK, map[string]interface{}{"plans": planDTOs})
 }
 
+// publicPlansMaxAge is how long clients and proxies may cache the plan list.
+const publicPlansMaxAge = 5 * time.Minute
+
+// handleListAvailablePlans lists the public plans with their prices and
+// limits. Admins also get the plans that are not public; only the
+// anonymous answer may be cached.
+// GET /api/plans
+func (s *Server) handleListAvailablePlans(w http.ResponseWriter, r *http.Request) {
+	list := s.db.Plans.ListPublic
+	w.Header().Set("Vary", "Authorization")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(publicPlansMaxAge.Seconds())))
+	if user := auth.GetUserFromContext(r.Context()); user != nil && user.IsAdmin {
+		// The token's admin flag is confirmed, so a revoked admin keeps
+		// seeing only public plans.
+		if u, err := s.db.Users.GetByID(user.ID); err == nil && u.IsAdmin {
+			list = s.db.Plans.List
+			w.Header().Set("Cache-Control", "private, no-store")
+		}
+	}
+
+	plans, err := list()
+	if err != nil {
+		s.respondError(w, http.StatusInternalServerError, "failed to list plans")
+		return
+	}
+	planDTOs := make([]*dto.PlanDTO, len(plans))
+	for i, p := range plans {
+		planDTOs[i] = dto.PlanFromModel(p)
+	}
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{"plans": planDTOs})
+}
+
 // handleCreatePlan creates a new plan
 func (s *Server) handleCreatePlan(w http.ResponseWriter, r *http.Request) {
 	var req dto.CreatePlanRequest
@@ -563,6 +737,14 @@ func (s *Server) handleCreatePlan(w http.ResponseWriter, r *http.Request) {
 		s.respondError(w, http.StatusBadRequest, "slug and name are required")
 		return
 	}
+	if req.MonthlyBytes < 0 {
+		s.respondError(w, http.StatusBadRequest, "monthly_bytes must not be negative")
+		return
+	}
+	if req.InspectMaxEntries < 0 {
+		s.respondError(w, http.StatusBadRequest, "inspect_max_entries must not be negative")
+		return
+	}
 	plan := &database.Plan{
 		Slug: req.Slug, Name: req.Name, Price: req.Price,
 		MaxTunnels: req.MaxTunnels, MaxDomains: req.MaxDomains,
@@ -572,6 +754,8 @@ func (s *Server) handleCreatePlan(w http.ResponseWriter, r *http.Request) {
 		IsPublic: req.IsPublic, IsRecommended: req.IsRecommended,
 		RateLimitTCP: req.RateLimitTCP, RateLimitUDP: req.RateLimitUDP, RateLimitHTTP: req.RateLimitHTTP,
 		CreemProductID: req.CreemProductID, MaxDataSessions: req.MaxDataSessions,
+		MonthlyBytes: req.MonthlyBytes, InspectMaxEntries: req.InspectMaxEntries,
+		SOCKSEnabled: req.SOCKSEnabled,
 	}
 	if err := s.db.Plans.Create(plan); err != nil {
 		s.respondError(w, http.StatusInternalServerError, "failed to create plan")
@@ -649,6 +833,23 @@ func (s *Server) handleUpdatePlan(w http.ResponseWriter, r *http.Request) {
 	if req.MaxDataSessions != nil {
 		plan.MaxDataSessions = *req.MaxDataSessions
 	}
+	if req.MonthlyBytes != nil {
+		if *req.MonthlyBytes < 0 {
+			s.respondError(w, http.StatusBadRequest, "monthly_bytes must not be negative")
+			return
+		}
+		plan.MonthlyBytes = *req.MonthlyBytes
+	}
+	if req.InspectMaxEntries != nil {
+		if *req.InspectMaxEntries < 0 {
+			s.respondError(w, http.StatusBadRequest, "inspect_max_entries must not be negative")
+			return
+		}
+		plan.InspectMaxEntries = *req.InspectMaxEntries
+	}
+	if req.SOCKSEnabled != nil {
+		plan.SOCKSEnabled = *req.SOCKSEnabled
+	}
 	if err := s.db.Plans.Update(plan); err != nil {
 		s.respondError(w, http.StatusInternalServerError, "failed to update plan")
 		return
@@ -1115,6 +1316,8 @@ func (s *Server) handleGetUserDetail(w http.ResponseWriter, r *http.Request) {
 			DisconnectedAt: h.DisconnectedAt,
 			BytesSent:      h.BytesSent,
 			BytesReceived:  h.BytesReceived,
+			Event:          h.Event,
+			Details:        h.Details,
 		})
 	}
 
@@ -1288,7 +1491,11 @@ func (s *Server) sendAdminStatsEvent(w http.ResponseWriter, flusher http.Flusher
 		HTTPTunnels:   stats.HTTPTunnels,
 		TCPTunnels:    stats.TCPTunnels,
 		UDPTunnels:    stats.UDPTunnels,
+		UDPFlows:      stats.UDPFlows,
 		TotalUsers:    totalUsers,
+
+		AbnormalTunnelUsers: stats.AbnormalTunnelUsers,
+		TunnelCountWarnings: stats.TunnelCountWarnings,
 	})
 
 	_, _ = fmt.Fprintf(w, "event: stats_update\ndata: %s\n\n", data)
@@ -0,0 +1,196 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/mephistofox/fxtun.dev/internal/server/api/dto"
+	"github.com/mephistofox/fxtun.dev/internal/server/auth"
+	"github.com/mephistofox/fxtun.dev/internal/server/database"
+)
+
+type suspendAbuseRequest struct {
+	Reason string `json:"reason"`
+}
+
+// handleListAbuseReports returns the abuse report queue, newest first.
+// ?status= narrows it to open, suspended or dismissed reports.
+func (s *Server) handleListAbuseReports(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", database.AbuseStatusOpen, database.AbuseStatusSuspended, database.AbuseStatusDismissed:
+	default:
+		s.respondError(w, http.StatusBadRequest, "invalid status")
+		return
+	}
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 100
+	}
+	offset := (page - 1) * limit
+
+	reports, total, err := s.db.Abuse.ListReports(status, limit, offset)
+	if err != nil {
+		s.log.Error().Err(err).Msg("Failed to list abuse reports")
+		s.respondError(w, http.StatusInternalServerError, "failed to list abuse reports")
+		return
+	}
+	if reports == nil {
+		reports = []*database.AbuseReport{}
+	}
+
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"reports": reports,
+		"total":   total,
+		"page":    page,
+		"limit":   limit,
+	})
+}
+
+// handleSuspendAbuseReport takes down the subdomain of a report in one
+// step: it is suspended, its tunnels are closed, every open report for it
+// is resolved and its owner is flagged.
+func (s *Server) handleSuspendAbuseReport(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	var req suspendAbuseRequest
+	if r.ContentLength > 0 {
+		if err := s.decodeJSON(r, &req); err != nil {
+			s.respondError(w, http.StatusBadRequest, "invalid JSON")
+			return
+		}
+	}
+
+	report, err := s.db.Abuse.GetReport(id)
+	if err != nil {
+		if errors.Is(err, database.ErrAbuseReportNotFound) {
+			s.respondError(w, http.StatusNotFound, "abuse report not found")
+			return
+		}
+		s.log.Error().Err(err).Int64("id", id).Msg("Failed to get abuse report")
+		s.respondError(w, http.StatusInternalServerError, "failed to get abuse report")
+		return
+	}
+
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		reason = report.Category
+	}
+	currentUser := auth.GetUserFromContext(r.Context())
+	suspension := &database.SuspendedSubdomain{
+		Subdomain:   report.Subdomain,
+		UserID:      report.UserID,
+		Reason:      reason,
+		ReportID:    &report.ID,
+		SuspendedBy: &currentUser.ID,
+	}
+	if err := s.db.Abuse.Suspend(suspension); err != nil {
+		s.log.Error().Err(err).Int64("id", id).Str("subdomain", report.Subdomain).Msg("Failed to suspend subdomain")
+		s.respondError(w, http.StatusInternalServerError, "failed to suspend subdomain")
+		return
+	}
+
+	closed := 0
+	if s.tunnelProvider != nil {
+		closed = s.tunnelProvider.SuspendSubdomain(report.Subdomain)
+	}
+
+	_ = s.db.Audit.Log(&currentUser.ID, database.ActionSubdomainSuspended, map[string]interface{}{
+		"subdomain": report.Subdomain,
+		"report_id": report.ID,
+		"user_id":   report.UserID,
+		"reason":    reason,
+	}, auth.GetClientIP(r))
+
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"suspension":     suspension,
+		"closed_tunnels": closed,
+	})
+}
+
+// handleDismissAbuseReport closes an open report without action.
+func (s *Server) handleDismissAbuseReport(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	currentUser := auth.GetUserFromContext(r.Context())
+	if err := s.db.Abuse.DismissReport(id, currentUser.ID); err != nil {
+		if errors.Is(err, database.ErrAbuseReportNotFound) {
+			s.respondError(w, http.StatusNotFound, "open abuse report not found")
+			return
+		}
+		s.log.Error().Err(err).Int64("id", id).Msg("Failed to dismiss abuse report")
+		s.respondError(w, http.StatusInternalServerError, "failed to dismiss abuse report")
+		return
+	}
+
+	_ = s.db.Audit.Log(&currentUser.ID, database.ActionAbuseDismissed, map[string]interface{}{
+		"report_id": id,
+	}, auth.GetClientIP(r))
+
+	s.respondJSON(w, http.StatusOK, dto.SuccessResponse{
+		Success: true,
+		Message: "abuse report dismissed",
+	})
+}
+
+// handleListSuspendedSubdomains returns all subdomains suspended for abuse.
+func (s *Server) handleListSuspendedSubdomains(w http.ResponseWriter, r *http.Request) {
+	list, err := s.db.Abuse.ListSuspended()
+	if err != nil {
+		s.log.Error().Err(err).Msg("Failed to list suspended subdomains")
+		s.respondError(w, http.StatusInternalServerError, "failed to list suspended subdomains")
+		return
+	}
+	if list == nil {
+		list = []*database.SuspendedSubdomain{}
+	}
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"subdomains": list,
+		"total":      len(list),
+	})
+}
+
+// handleUnsuspendSubdomain lifts a suspension. The owner stays flagged.
+func (s *Server) handleUnsuspendSubdomain(w http.ResponseWriter, r *http.Request) {
+	subdomain := strings.ToLower(chi.URLParam(r, "subdomain"))
+
+	if err := s.db.Abuse.Unsuspend(subdomain); err != nil {
+		if errors.Is(err, database.ErrNotSuspended) {
+			s.respondError(w, http.StatusNotFound, "subdomain is not suspended")
+			return
+		}
+		s.log.Error().Err(err).Str("subdomain", subdomain).Msg("Failed to unsuspend subdomain")
+		s.respondError(w, http.StatusInternalServerError, "failed to unsuspend subdomain")
+		return
+	}
+	if s.tunnelProvider != nil {
+		s.tunnelProvider.UnsuspendSubdomain(subdomain)
+	}
+
+	currentUser := auth.GetUserFromContext(r.Context())
+	_ = s.db.Audit.Log(&currentUser.ID, database.ActionSubdomainUnsuspended, map[string]interface{}{
+		"subdomain": subdomain,
+	}, auth.GetClientIP(r))
+
+	s.respondJSON(w, http.StatusOK, dto.SuccessResponse{
+		Success: true,
+		Message: "subdomain unsuspended",
+	})
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/mephistofox/fxtun.dev/internal/server/database"
+)
+
+func TestAdminAbuse_SuspendFromReport(t *testing.T) {
+	env := setupTestEnv(t)
+	admin := env.createTestAdmin(t, "+10000000041", "adminpass1", "Admin")
+	owner := env.createTestUser(t, "+10000000042", "userpass12", "Owner")
+
+	report := &database.AbuseReport{
+		Subdomain: "phish",
+		URL:       "https://phish.test.localhost/login",
+		Category:  database.AbuseCategoryPhishing,
+		UserID:    &owner.User.ID,
+	}
+	if err := env.DB.Abuse.CreateReport(report); err != nil {
+		t.Fatalf("failed to create report: %v", err)
+	}
+
+	do := func(method, path string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, env.Server.URL+path, nil)
+		req.Header.Set("Authorization", "Bearer "+admin.AccessToken)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		return resp
+	}
+
+	resp := do("POST", fmt.Sprintf("/api/admin/abuse-reports/%d/suspend", report.ID))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if len(env.TunnelProvider.suspended) != 1 || env.TunnelProvider.suspended[0] != "phish" {
+		t.Errorf("expected phish to be suspended on the tunnel server, got %v", env.TunnelProvider.suspended)
+	}
+
+	resp = do("GET", "/api/admin/abuse-reports?status=suspended")
+	var result struct {
+		Reports []*database.AbuseReport `json:"reports"`
+		Total   int                     `json:"total"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	resp.Body.Close()
+	if result.Total != 1 || !result.Reports[0].OwnerFlagged {
+		t.Errorf("expected one suspended report with a flagged owner, got %+v", result.Reports)
+	}
+
+	resp = do("DELETE", "/api/admin/suspended-subdomains/phish")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	resp = do("DELETE", "/api/admin/suspended-subdomains/phish")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for a subdomain that is not suspended, got %d", resp.StatusCode)
+	}
+}
+
+func TestAdminAbuse_DismissOnlyOpen(t *testing.T) {
+	env := setupTestEnv(t)
+	admin := env.createTestAdmin(t, "+10000000043", "adminpass1", "Admin")
+
+	report := &database.AbuseReport{Subdomain: "app", Category: database.AbuseCategorySpam}
+	if err := env.DB.Abuse.CreateReport(report); err != nil {
+		t.Fatalf("failed to create report: %v", err)
+	}
+
+	for _, want := range []int{http.StatusOK, http.StatusNotFound} {
+		req, _ := http.NewRequest("POST", fmt.Sprintf("%s/api/admin/abuse-reports/%d/dismiss", env.Server.URL, report.ID), nil)
+		req.Header.Set("Authorization", "Bearer "+admin.AccessToken)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("expected %d, got %d", want, resp.StatusCode)
+		}
+	}
+}
@@ -3,6 +3,8 @@ package api
 import (
 	"encoding/json"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -164,3 +166,184 @@ func TestAdminListTunnels(t *testing.T) {
 		t.Errorf("expected subdomain 'myapp', got '%s'", result.Tunnels[0].Subdomain)
 	}
 }
+
+func TestAdminTunnelFilter(t *testing.T) {
+	tunnels := []TunnelInfo{
+		{ID: "web", Type: "http", Subdomain: "suspicious", UserID: 7},
+		{ID: "ssh", Type: "tcp", RemotePort: 30022, UserID: 8},
+		{ID: "dns", Type: "udp", RemotePort: 30053, UserID: 8},
+		{ID: "anon", Type: "http", Subdomain: "myapp"},
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"web", "ssh", "dns", "anon"}},
+		{"subdomain=SUSP", []string{"web"}},
+		{"subdomain=suspicious.example.com", []string{"web"}},
+		{"subdomain=app", []string{"anon"}},
+		{"port=30022", []string{"ssh"}},
+		{"user_id=8&type=udp", []string{"dns"}},
+		{"user_id=0", []string{"anon"}},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/api/admin/tunnels?"+tt.query, nil)
+		f, err := parseAdminTunnelFilter(r, "example.com")
+		if err != nil {
+			t.Fatalf("%q: %v", tt.query, err)
+		}
+		var got []string
+		for _, tun := range tunnels {
+			if f.matches(tun) {
+				got = append(got, tun.ID)
+			}
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%q: got %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	for _, query := range []string{"port=abc", "port=70000", "user_id=x"} {
+		r := httptest.NewRequest("GET", "/api/admin/tunnels?"+query, nil)
+		if _, err := parseAdminTunnelFilter(r, "example.com"); err == nil {
+			t.Errorf("%q: expected an error", query)
+		}
+	}
+}
+
+func TestTunnelListQuery(t *testing.T) {
+	now := time.Now()
+	tunnels := []TunnelInfo{
+		{ID: "busy", CreatedAt: now.Add(-3 * time.Hour), LastActivity: now.Add(-time.Minute)},
+		{ID: "stale", CreatedAt: now.Add(-2 * time.Hour), LastActivity: now.Add(-2 * time.Hour)},
+		{ID: "new", CreatedAt: now.Add(-10 * time.Minute)}, // no activity recorded
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"busy", "stale", "new"}},
+		{"sort_by=idle", []string{"stale", "new", "busy"}},
+		{"sort_by=idle&order=asc", []string{"busy", "new", "stale"}},
+		{"sort_by=created_at", []string{"busy", "stale", "new"}},
+		{"sort_by=created_at&order=desc", []string{"new", "stale", "busy"}},
+		{"min_idle=300", []string{"stale", "new"}},
+		{"min_idle=3600&sort_by=idle", []string{"stale"}},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/api/tunnels?"+tt.query, nil)
+		q, err := parseTunnelListQuery(r)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.query, err)
+		}
+		var got []string
+		for _, tun := range q.apply(tunnels, now) {
+			got = append(got, tun.ID)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%q: got %v, want %v", tt.query, got, tt.want)
+		}
+	}
+	if tunnels[0].ID != "busy" || tunnels[1].ID != "stale" {
+		t.Error("apply reordered its input")
+	}
+
+	for _, query := range []string{"min_idle=-1", "min_idle=1h", "sort_by=name", "order=up"} {
+		r := httptest.NewRequest("GET", "/api/tunnels?"+query, nil)
+		if _, err := parseTunnelListQuery(r); err == nil {
+			t.Errorf("%q: expected an error", query)
+		}
+	}
+}
+
+func TestAdminListTunnels_SortByIdle(t *testing.T) {
+	env := setupTestEnv(t)
+	admin := env.createTestAdmin(t, "+10000000017", "adminpass1", "Admin")
+
+	now := time.Now()
+	env.TunnelProvider.tunnels = []TunnelInfo{
+		{ID: "busy", Type: "tcp", CreatedAt: now.Add(-time.Hour), LastActivity: now},
+		{ID: "stale", Type: "tcp", CreatedAt: now.Add(-time.Hour), LastActivity: now.Add(-45 * time.Minute)},
+	}
+
+	req, _ := http.NewRequest("GET", env.Server.URL+"/api/admin/tunnels?sort_by=idle", nil)
+	req.Header.Set("Authorization", "Bearer "+admin.AccessToken)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	var result dto.AdminTunnelsListResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(result.Tunnels) != 2 || result.Tunnels[0].ID != "stale" {
+		t.Fatalf("expected the stale tunnel first, got %+v", result.Tunnels)
+	}
+	if idle := result.Tunnels[0].IdleSeconds; idle < 45*60 || idle > 46*60 {
+		t.Errorf("expected about 2700 idle seconds, got %d", idle)
+	}
+}
+
+func TestListAvailablePlans(t *testing.T) {
+	env := setupTestEnv(t)
+	admin := env.createTestAdmin(t, "+10000000071", "adminpass1", "Admin")
+	user := env.createTestUser(t, "+10000000072", "userpass1", "User")
+
+	list := func(token string) (map[string]*dto.PlanDTO, string) {
+		t.Helper()
+		req, _ := http.NewRequest("GET", env.Server.URL+"/api/plans", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d", resp.StatusCode)
+		}
+		var body struct {
+			Plans []*dto.PlanDTO `json:"plans"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		bySlug := make(map[string]*dto.PlanDTO, len(body.Plans))
+		for _, p := range body.Plans {
+			bySlug[p.Slug] = p
+		}
+		return bySlug, resp.Header.Get("Cache-Control")
+	}
+
+	plans, cache := list("")
+	if plans["pro"] == nil || plans["free"] == nil {
+		t.Fatalf("expected the public plans, got %v", plans)
+	}
+	if plans["admin"] != nil {
+		t.Error("anonymous callers must not see non-public plans")
+	}
+	if !strings.HasPrefix(cache, "public") {
+		t.Errorf("expected a cacheable answer, got Cache-Control %q", cache)
+	}
+
+	if plans, _ := list(user.AccessToken); plans["admin"] != nil {
+		t.Error("users must not see non-public plans")
+	}
+
+	plans, cache = list(admin.AccessToken)
+	if plans["admin"] == nil {
+		t.Error("admins must see non-public plans")
+	}
+	if !strings.Contains(cache, "private") {
+		t.Errorf("the admin answer must not be cached by proxies, got Cache-Control %q", cache)
+	}
+}
@@ -166,7 +166,7 @@ func (s *Server) handleRefresh(w http.ResponseWriter, r *http.Request) {
 	user, tokenPair, err := s.authService.RefreshTokens(req.RefreshToken, r.UserAgent(), r.RemoteAddr)
 	if err != nil {
 		if errors.Is(err, auth.ErrTokenReuse) {
-			s.respondErrorWithCode(w, http.StatusUnauthorized, "TOKEN_REUSE", "refresh token reuse detected; all sessions revoked")
+			s.respondErrorWithCode(w, http.StatusUnauthorized, "TOKEN_REUSE", "refresh token reuse detected; sessions of this device revoked")
 			return
 		}
 		if errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrTokenExpired) {
@@ -286,7 +286,7 @@ func (s *Server) respondTarpitRegister(w http.ResponseWriter, r *http.Request, r
 	ipAddress := auth.GetClientIP(r)
 	userAgent := r.UserAgent()
 	s.log.Warn().
-		Str("ip", ipAddress).
+		Str("remote_ip", ipAddress).
 		Str("phone", auth.MaskPhone(req.Phone)).
 		Str("display_name", req.DisplayName).
 		Str("user_agent", userAgent).
@@ -303,7 +303,7 @@ func (s *Server) respondTarpitRegister(w http.ResponseWriter, r *http.Request, r
 		var err error
 		isNewBan, err = s.ipBanStore.Ban(ipAddress, "registration tarpit", banTTL)
 		if err != nil {
-			s.log.Warn().Err(err).Str("ip", ipAddress).Msg("failed to record tarpit IP ban")
+			s.log.Warn().Err(err).Str("remote_ip", ipAddress).Msg("failed to record tarpit IP ban")
 		}
 	}
 
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mephistofox/fxtun.dev/internal/server/api/dto"
+	"github.com/mephistofox/fxtun.dev/internal/server/auth"
+	"github.com/mephistofox/fxtun.dev/internal/server/database"
+)
+
+// handleListClients returns the user's connected tunnel clients with their tunnels
+func (s *Server) handleListClients(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		s.respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	if s.tunnelProvider == nil {
+		s.respondJSON(w, http.StatusOK, dto.ClientsListResponse{
+			Clients: []*dto.ClientDTO{},
+			Total:   0,
+		})
+		return
+	}
+
+	clients := s.tunnelProvider.GetClientsByUserID(user.ID)
+	now := time.Now()
+
+	clientDTOs := make([]*dto.ClientDTO, len(clients))
+	for i, c := range clients {
+		clientDTO := &dto.ClientDTO{
+			ID:          c.ID,
+			Hostname:    c.Hostname,
+			IP:          clientIP(c.RemoteAddr),
+			ConnectedAt: c.ConnectedAt,
+			Tunnels:     make([]*dto.TunnelDTO, len(c.Tunnels)),
+			Sessions: dto.SessionsDTO{
+				Count:         c.Sessions.Sessions,
+				Streams:       c.Sessions.Streams,
+				PendingWrites: c.Sessions.PendingWrites,
+				Writes:        c.Sessions.Writes,
+				StalledWrites: c.Sessions.StalledWrites,
+				WriteWaitMs:   c.Sessions.WriteWait.Milliseconds(),
+				StallRatio:    c.Sessions.StallRatio,
+			},
+		}
+		for j, t := range c.Tunnels {
+			clientDTO.Tunnels[j] = s.tunnelToDTO(t, now)
+		}
+		clientDTOs[i] = clientDTO
+	}
+
+	s.respondJSON(w, http.StatusOK, dto.ClientsListResponse{
+		Clients: clientDTOs,
+		Total:   len(clientDTOs),
+	})
+}
+
+// handleDisconnectClient disconnects one of the user's clients. The client
+// exits rather than reconnecting.
+func (s *Server) handleDisconnectClient(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		s.respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	clientID := chi.URLParam(r, "id")
+	if clientID == "" {
+		s.respondError(w, http.StatusBadRequest, "client id is required")
+		return
+	}
+
+	if s.tunnelProvider == nil {
+		s.respondError(w, http.StatusNotFound, "client not found")
+		return
+	}
+
+	if err := s.tunnelProvider.DisconnectClient(clientID, user.ID); err != nil {
+		s.respondError(w, http.StatusNotFound, "client not found or access denied")
+		return
+	}
+
+	if s.db != nil {
+		_ = s.db.Audit.Log(&user.ID, database.ActionClientDisconnected, map[string]interface{}{
+			"client_id": clientID,
+		}, auth.GetClientIP(r))
+	}
+
+	s.respondJSON(w, http.StatusOK, dto.SuccessResponse{
+		Success: true,
+		Message: "client disconnected",
+	})
+}
+
+// clientIP strips the port from a client's remote address.
+func clientIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
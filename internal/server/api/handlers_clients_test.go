@@ -0,0 +1,147 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mephistofox/fxtun.dev/internal/server/api/dto"
+	"github.com/mephistofox/fxtun.dev/internal/server/auth"
+)
+
+func clientsRequest(method, clientID string, user *auth.AuthenticatedUser) *http.Request {
+	req := httptest.NewRequest(method, "/api/clients/"+clientID, nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", clientID)
+	ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+	if user != nil {
+		ctx = context.WithValue(ctx, auth.UserContextKey, user)
+	}
+	return req.WithContext(ctx)
+}
+
+func TestHandleListClients(t *testing.T) {
+	connected := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	provider := newMockTunnelProvider()
+	provider.clients = map[int64][]ClientInfo{
+		7: {
+			{
+				ID: "c1", Hostname: "laptop", RemoteAddr: "1.2.3.4:50000", UserID: 7, ConnectedAt: connected,
+				Tunnels: []TunnelInfo{
+					{ID: "t1", Type: "http", Subdomain: "app", LocalPort: 3000, ClientID: "c1", UserID: 7},
+					{ID: "t2", Type: "tcp", RemotePort: 10022, LocalPort: 22, ClientID: "c1", UserID: 7},
+				},
+				Sessions: SessionPressure{Sessions: 2, Streams: 5, Writes: 40, StalledWrites: 30,
+					WriteWait: 3 * time.Second, StallRatio: 0.75},
+			},
+			{ID: "c2", RemoteAddr: "[2001:db8::1]:40000", UserID: 7, ConnectedAt: connected, Tunnels: []TunnelInfo{}},
+		},
+	}
+	s := &Server{tunnelProvider: provider, baseDomain: "example.com", log: zerolog.Nop()}
+
+	w := httptest.NewRecorder()
+	s.handleListClients(w, clientsRequest("GET", "", &auth.AuthenticatedUser{ID: 7}))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var got dto.ClientsListResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+	require.Equal(t, 2, got.Total)
+
+	laptop := got.Clients[0]
+	assert.Equal(t, "laptop", laptop.Hostname)
+	assert.Equal(t, "1.2.3.4", laptop.IP)
+	assert.True(t, connected.Equal(laptop.ConnectedAt))
+	require.Len(t, laptop.Tunnels, 2)
+	assert.Equal(t, "https://app.example.com", laptop.Tunnels[0].URL)
+	assert.Equal(t, 10022, laptop.Tunnels[1].RemotePort)
+	assert.Equal(t, 2, laptop.Sessions.Count)
+	assert.Equal(t, 5, laptop.Sessions.Streams)
+	assert.Equal(t, int64(3000), laptop.Sessions.WriteWaitMs)
+	assert.Equal(t, 0.75, laptop.Sessions.StallRatio)
+
+	assert.Equal(t, "2001:db8::1", got.Clients[1].IP)
+	assert.NotNil(t, got.Clients[1].Tunnels)
+
+	// Another user sees none of them
+	w = httptest.NewRecorder()
+	s.handleListClients(w, clientsRequest("GET", "", &auth.AuthenticatedUser{ID: 8}))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+	assert.Equal(t, 0, got.Total)
+	assert.NotNil(t, got.Clients)
+}
+
+func TestHandleDisconnectClient(t *testing.T) {
+	provider := newMockTunnelProvider()
+	provider.clients = map[int64][]ClientInfo{7: {{ID: "c1", UserID: 7}}}
+	s := &Server{tunnelProvider: provider, log: zerolog.Nop()}
+
+	w := httptest.NewRecorder()
+	s.handleDisconnectClient(w, clientsRequest("DELETE", "c1", &auth.AuthenticatedUser{ID: 7}))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	s.handleDisconnectClient(w, clientsRequest("DELETE", "c1", &auth.AuthenticatedUser{ID: 8}))
+	assert.Equal(t, http.StatusNotFound, w.Code, "clients of other users cannot be disconnected")
+
+	w = httptest.NewRecorder()
+	s.handleDisconnectClient(w, clientsRequest("DELETE", "c1", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestHandleAdminListClients(t *testing.T) {
+	connected := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	provider := newMockTunnelProvider()
+	provider.clients = map[int64][]ClientInfo{
+		7: {{
+			ID: "c1", Hostname: "laptop", RemoteAddr: "1.2.3.4:50000", UserID: 7, ConnectedAt: connected,
+			Tunnels:  []TunnelInfo{{ID: "t1", Type: "http"}, {ID: "t2", Type: "tcp"}},
+			Sessions: SessionPressure{Sessions: 3},
+		}},
+		8: {{ID: "c2", RemoteAddr: "5.6.7.8:40000", UserID: 8, ConnectedAt: connected, Sessions: SessionPressure{Sessions: 1}}},
+	}
+	s := &Server{tunnelProvider: provider, log: zerolog.Nop()}
+
+	w := httptest.NewRecorder()
+	s.handleAdminListClients(w, clientsRequest("GET", "", &auth.AuthenticatedUser{ID: 1, IsAdmin: true}))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var got dto.AdminClientsListResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+	require.Equal(t, 2, got.Total)
+	byID := map[string]*dto.AdminClientDTO{}
+	for _, c := range got.Clients {
+		byID[c.ID] = c
+	}
+	require.Contains(t, byID, "c1")
+	assert.Equal(t, "1.2.3.4", byID["c1"].IP)
+	assert.Equal(t, int64(7), byID["c1"].UserID)
+	assert.Equal(t, 2, byID["c1"].TunnelCount)
+	assert.Equal(t, 2, byID["c1"].DataSessions)
+	assert.True(t, connected.Equal(byID["c1"].ConnectedAt))
+	require.Contains(t, byID, "c2")
+	assert.Equal(t, 0, byID["c2"].DataSessions)
+}
+
+func TestHandleAdminDisconnectClient(t *testing.T) {
+	provider := newMockTunnelProvider()
+	provider.clients = map[int64][]ClientInfo{7: {{ID: "c1", UserID: 7}}}
+	s := &Server{tunnelProvider: provider, log: zerolog.Nop()}
+	admin := &auth.AuthenticatedUser{ID: 1, IsAdmin: true}
+
+	w := httptest.NewRecorder()
+	s.handleAdminDisconnectClient(w, clientsRequest("POST", "c1", admin))
+	assert.Equal(t, http.StatusOK, w.Code, "admins may disconnect any user's client")
+
+	w = httptest.NewRecorder()
+	s.handleAdminDisconnectClient(w, clientsRequest("POST", "missing", admin))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
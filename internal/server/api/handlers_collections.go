@@ -0,0 +1,279 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/mephistofox/fxtun.dev/internal/server/api/dto"
+	"github.com/mephistofox/fxtun.dev/internal/server/auth"
+	"github.com/mephistofox/fxtun.dev/internal/server/database"
+)
+
+// collectionUser returns the authenticated user when they may use the
+// inspector, writing the error otherwise.
+func (s *Server) collectionUser(w http.ResponseWriter, r *http.Request) *auth.AuthenticatedUser {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		s.respondError(w, http.StatusUnauthorized, "unauthorized")
+		return nil
+	}
+	if !s.checkInspectorAccess(w, user) {
+		return nil
+	}
+	return user
+}
+
+// userCollection loads the collection named by the {id} URL parameter and
+// checks that it belongs to user, writing the error otherwise.
+func (s *Server) userCollection(w http.ResponseWriter, r *http.Request, user *auth.AuthenticatedUser) *database.Collection {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid id")
+		return nil
+	}
+	collection, err := s.db.Collections.GetByID(id)
+	if err != nil {
+		s.respondError(w, http.StatusNotFound, "collection not found")
+		return nil
+	}
+	if collection.UserID != user.ID {
+		s.respondError(w, http.StatusForbidden, "access denied")
+		return nil
+	}
+	return collection
+}
+
+// collectionItem loads the item named by the {itemId} URL parameter from
+// collection, writing the error otherwise.
+func (s *Server) collectionItem(w http.ResponseWriter, r *http.Request, collection *database.Collection) *database.CollectionItem {
+	id, err := strconv.ParseInt(chi.URLParam(r, "itemId"), 10, 64)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid item id")
+		return nil
+	}
+	item, err := s.db.Collections.GetItem(collection.ID, id)
+	if err != nil {
+		s.respondError(w, http.StatusNotFound, "collection item not found")
+		return nil
+	}
+	return item
+}
+
+func (s *Server) handleListCollections(w http.ResponseWriter, r *http.Request) {
+	user := s.collectionUser(w, r)
+	if user == nil {
+		return
+	}
+
+	collections, err := s.db.Collections.ListByUser(user.ID)
+	if err != nil {
+		s.log.Error().Err(err).Msg("Failed to list collections")
+		s.respondError(w, http.StatusInternalServerError, "failed to list collections")
+		return
+	}
+	if collections == nil {
+		collections = []*database.Collection{}
+	}
+
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"collections": collections,
+		"total":       len(collections),
+	})
+}
+
+func (s *Server) handleCreateCollection(w http.ResponseWriter, r *http.Request) {
+	user := s.collectionUser(w, r)
+	if user == nil {
+		return
+	}
+
+	var req dto.CreateCollectionRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	collection := &database.Collection{UserID: user.ID, Name: req.Name}
+	if err := s.db.Collections.Create(collection); err != nil {
+		if errors.Is(err, database.ErrCollectionExists) {
+			s.respondErrorWithCode(w, http.StatusConflict, "COLLECTION_EXISTS", "collection already exists")
+			return
+		}
+		s.log.Error().Err(err).Msg("Failed to create collection")
+		s.respondError(w, http.StatusInternalServerError, "failed to create collection")
+		return
+	}
+
+	s.respondJSON(w, http.StatusCreated, collection)
+}
+
+func (s *Server) handleDeleteCollection(w http.ResponseWriter, r *http.Request) {
+	user := s.collectionUser(w, r)
+	if user == nil {
+		return
+	}
+	collection := s.userCollection(w, r, user)
+	if collection == nil {
+		return
+	}
+
+	if err := s.db.Collections.Delete(collection.ID); err != nil {
+		s.respondError(w, http.StatusInternalServerError, "failed to delete collection")
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+}
+
+func (s *Server) handleListCollectionItems(w http.ResponseWriter, r *http.Request) {
+	user := s.collectionUser(w, r)
+	if user == nil {
+		return
+	}
+	collection := s.userCollection(w, r, user)
+	if collection == nil {
+		return
+	}
+
+	items, err := s.db.Collections.ListItems(collection.ID)
+	if err != nil {
+		s.log.Error().Err(err).Int64("collection_id", collection.ID).Msg("Failed to list collection items")
+		s.respondError(w, http.StatusInternalServerError, "failed to list collection items")
+		return
+	}
+	if items == nil {
+		items = []*database.CollectionItem{}
+	}
+
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{
+		"items": items,
+		"total": len(items),
+	})
+}
+
+// handleCreateCollectionItem saves a request to a collection. With a
+// tunnel and exchange ID the captured request is copied and the given
+// fields override it; otherwise the request is taken from the body alone.
+func (s *Server) handleCreateCollectionItem(w http.ResponseWriter, r *http.Request) {
+	user := s.collectionUser(w, r)
+	if user == nil {
+		return
+	}
+	collection := s.userCollection(w, r, user)
+	if collection == nil {
+		return
+	}
+
+	var req dto.CreateCollectionItemRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	item := &database.CollectionItem{CollectionID: collection.ID, Name: req.Name}
+	if req.ExchangeID != "" {
+		tunnelID := s.resolveActiveTunnelID(req.TunnelID)
+		if err := s.checkTunnelAccess(tunnelID, user); err != nil {
+			s.respondError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		ex := s.findExchange(tunnelID, req.ExchangeID, user.ID)
+		if ex == nil {
+			s.respondError(w, http.StatusNotFound, "exchange not found")
+			return
+		}
+		item.Method = ex.Method
+		item.Path = ex.Path
+		item.Host = ex.Host
+		item.Headers = ex.RequestHeaders.Clone()
+		item.Body = ex.RequestBody
+		item.SourceExchangeID = ex.ID
+	} else if req.Method == nil || req.Path == nil {
+		s.respondError(w, http.StatusBadRequest, "method and path are required without an exchange")
+		return
+	}
+
+	if req.Method != nil {
+		item.Method = *req.Method
+	}
+	if req.Path != nil {
+		item.Path = *req.Path
+	}
+	if req.Headers != nil {
+		item.Headers = req.Headers
+	}
+	if req.Body != nil {
+		body, err := base64.StdEncoding.DecodeString(*req.Body)
+		if err != nil {
+			s.respondError(w, http.StatusBadRequest, "body must be base64-encoded")
+			return
+		}
+		item.Body = body
+	}
+	if item.Name == "" {
+		item.Name = item.Method + " " + item.Path
+	}
+
+	if err := s.db.Collections.CreateItem(item); err != nil {
+		s.log.Error().Err(err).Int64("collection_id", collection.ID).Msg("Failed to save collection item")
+		s.respondError(w, http.StatusInternalServerError, "failed to save collection item")
+		return
+	}
+
+	s.respondJSON(w, http.StatusCreated, item)
+}
+
+func (s *Server) handleDeleteCollectionItem(w http.ResponseWriter, r *http.Request) {
+	user := s.collectionUser(w, r)
+	if user == nil {
+		return
+	}
+	collection := s.userCollection(w, r, user)
+	if collection == nil {
+		return
+	}
+	item := s.collectionItem(w, r, collection)
+	if item == nil {
+		return
+	}
+
+	if err := s.db.Collections.DeleteItem(collection.ID, item.ID); err != nil {
+		s.respondError(w, http.StatusInternalServerError, "failed to delete collection item")
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+}
+
+// handleRunCollectionItem sends a saved request through one of the user's
+// tunnels, the same way a replay does.
+func (s *Server) handleRunCollectionItem(w http.ResponseWriter, r *http.Request) {
+	user := s.collectionUser(w, r)
+	if user == nil {
+		return
+	}
+	collection := s.userCollection(w, r, user)
+	if collection == nil {
+		return
+	}
+	item := s.collectionItem(w, r, collection)
+	if item == nil {
+		return
+	}
+
+	var req dto.RunCollectionItemRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	tunnelID := s.resolveActiveTunnelID(req.TunnelID)
+	if err := s.checkTunnelAccess(tunnelID, user); err != nil {
+		s.respondError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	// The saved host may belong to another tunnel; the tunnel's own
+	// subdomain is used instead
+	s.replayThroughTunnel(w, r, user, tunnelID, item.SourceExchangeID, "", item.Method, item.Path, http.Header(item.Headers).Clone(), item.Body)
+}
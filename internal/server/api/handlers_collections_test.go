@@ -0,0 +1,157 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/mephistofox/fxtun.dev/internal/inspect"
+	"github.com/mephistofox/fxtun.dev/internal/server/api/dto"
+	"github.com/mephistofox/fxtun.dev/internal/server/database"
+)
+
+type mockReplayProvider struct {
+	subdomain string
+	req       *http.Request
+	body      []byte
+}
+
+func (m *mockReplayProvider) ReplayRequest(subdomain string, req *http.Request) (*inspect.ReplayResult, error) {
+	m.subdomain = subdomain
+	m.req = req
+	m.body, _ = io.ReadAll(req.Body)
+	return &inspect.ReplayResult{StatusCode: http.StatusAccepted, Body: []byte("ok")}, nil
+}
+
+func TestCollections_SaveAndRun(t *testing.T) {
+	env := setupTestEnv(t)
+	owner := env.createTestAdmin(t, "+10000000051", "adminpass1", "Owner")
+	other := env.createTestAdmin(t, "+10000000052", "adminpass2", "Other")
+	env.TunnelProvider.userTunnels[owner.User.ID] = []TunnelInfo{{ID: "t1", Type: "http", Subdomain: "app", UserID: owner.User.ID}}
+	replay := &mockReplayProvider{}
+	env.APIServer.SetReplayProvider(replay)
+
+	do := func(user *testUser, method, path string, body interface{}) *http.Response {
+		t.Helper()
+		var reader io.Reader
+		if body != nil {
+			data, _ := json.Marshal(body)
+			reader = bytes.NewReader(data)
+		}
+		req, _ := http.NewRequest(method, env.Server.URL+path, reader)
+		req.Header.Set("Authorization", "Bearer "+user.AccessToken)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		return resp
+	}
+
+	resp := do(owner, "POST", "/api/collections", map[string]string{"name": "smoke"})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", resp.StatusCode)
+	}
+	var collection database.Collection
+	if err := json.NewDecoder(resp.Body).Decode(&collection); err != nil {
+		t.Fatalf("failed to decode collection: %v", err)
+	}
+	resp.Body.Close()
+
+	resp = do(owner, "POST", "/api/collections", map[string]string{"name": "smoke"})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("expected 409 for a duplicate name, got %d", resp.StatusCode)
+	}
+
+	itemsPath := fmt.Sprintf("/api/collections/%d/items", collection.ID)
+	resp = do(owner, "POST", itemsPath, map[string]interface{}{
+		"method":  "POST",
+		"path":    "/hook",
+		"headers": map[string][]string{"X-Token": {"abc"}},
+		"body":    base64.StdEncoding.EncodeToString([]byte("ping")),
+	})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", resp.StatusCode)
+	}
+	var item database.CollectionItem
+	if err := json.NewDecoder(resp.Body).Decode(&item); err != nil {
+		t.Fatalf("failed to decode item: %v", err)
+	}
+	resp.Body.Close()
+	if item.Name != "POST /hook" {
+		t.Errorf("expected a default name, got %q", item.Name)
+	}
+
+	resp = do(other, "GET", itemsPath, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 for another user's collection, got %d", resp.StatusCode)
+	}
+
+	runPath := fmt.Sprintf("%s/%d/run", itemsPath, item.ID)
+	resp = do(owner, "POST", runPath, map[string]string{"tunnel_id": "t2"})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403 for an unknown tunnel, got %d", resp.StatusCode)
+	}
+
+	resp = do(owner, "POST", runPath, map[string]string{"tunnel_id": "t1"})
+	var result dto.ReplayResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("failed to decode replay response: %v", err)
+	}
+	resp.Body.Close()
+	if result.StatusCode != http.StatusAccepted {
+		t.Errorf("expected the replayed status, got %d", result.StatusCode)
+	}
+	if replay.subdomain != "app" || replay.req.Host != "app.test.localhost" {
+		t.Errorf("expected the request to go to app.test.localhost, got %s / %s", replay.subdomain, replay.req.Host)
+	}
+	if replay.req.Method != "POST" || replay.req.URL.Path != "/hook" || string(replay.body) != "ping" || replay.req.Header.Get("X-Token") != "abc" {
+		t.Errorf("saved request not replayed as stored: %s %s %q %v", replay.req.Method, replay.req.URL.Path, replay.body, replay.req.Header)
+	}
+
+	resp = do(owner, "DELETE", fmt.Sprintf("%s/%d", itemsPath, item.ID), nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	resp = do(owner, "GET", "/api/collections", nil)
+	var list struct {
+		Collections []*database.Collection `json:"collections"`
+		Total       int                    `json:"total"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatalf("failed to decode collections: %v", err)
+	}
+	resp.Body.Close()
+	if list.Total != 1 || list.Collections[0].ItemCount != 0 {
+		t.Errorf("expected one empty collection, got %+v", list.Collections)
+	}
+}
+
+func TestCollections_RequestWithoutExchange(t *testing.T) {
+	env := setupTestEnv(t)
+	owner := env.createTestAdmin(t, "+10000000053", "adminpass1", "Owner")
+	collection := &database.Collection{UserID: owner.User.ID, Name: "api"}
+	if err := env.DB.Collections.Create(collection); err != nil {
+		t.Fatalf("failed to create collection: %v", err)
+	}
+
+	body, _ := json.Marshal(dto.CreateCollectionItemRequest{Name: "no path"})
+	req, _ := http.NewRequest("POST", fmt.Sprintf("%s/api/collections/%d/items", env.Server.URL, collection.ID), bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+owner.AccessToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 without method and path, got %d", resp.StatusCode)
+	}
+}
@@ -3,17 +3,16 @@ package api
 import (
 	"errors"
 	"net/http"
-	"regexp"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/mephistofox/fxtun.dev/internal/config"
 	"github.com/mephistofox/fxtun.dev/internal/server/api/dto"
 	"github.com/mephistofox/fxtun.dev/internal/server/auth"
 	"github.com/mephistofox/fxtun.dev/internal/server/database"
 )
 
-var subdomainRegex = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,30}[a-z0-9])?$`)
-
 // handleListDomains returns the user's reserved domains
 func (s *Server) handleListDomains(w http.ResponseWriter, r *http.Request) {
 	user := auth.GetUserFromContext(r.Context())
@@ -34,22 +33,25 @@ func (s *Server) handleListDomains(w http.ResponseWriter, r *http.Request) {
 		domainDTOs[i] = dto.DomainFromModel(d, s.baseDomain)
 	}
 
-	maxDomains := 1
-	if user.Plan != nil {
-		if user.Plan.MaxDomains < 0 {
-			maxDomains = -1
-		} else {
-			maxDomains = user.Plan.MaxDomains
-		}
-	}
-
 	s.respondJSON(w, http.StatusOK, dto.DomainsListResponse{
 		Domains:    domainDTOs,
 		Total:      len(domainDTOs),
-		MaxDomains: maxDomains,
+		MaxDomains: planMaxDomains(user),
 	})
 }
 
+// planMaxDomains returns how many subdomains the user may reserve; -1 means
+// no limit.
+func planMaxDomains(user *auth.AuthenticatedUser) int {
+	if user.Plan == nil {
+		return 1
+	}
+	if user.Plan.MaxDomains < 0 {
+		return -1
+	}
+	return user.Plan.MaxDomains
+}
+
 // handleReserveDomain reserves a subdomain for the user
 func (s *Server) handleReserveDomain(w http.ResponseWriter, r *http.Request) {
 	user := auth.GetUserFromContext(r.Context())
@@ -63,40 +65,32 @@ func (s *Server) handleReserveDomain(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate subdomain format
-	if !subdomainRegex.MatchString(req.Subdomain) {
-		s.respondErrorWithCode(w, http.StatusBadRequest, "INVALID_SUBDOMAIN", "subdomain must be 3-32 characters, alphanumeric and hyphens only")
+	// Validate subdomain by the rules the tunnel server applies
+	subdomain, err := config.NormalizeSubdomain(req.Subdomain)
+	if errors.Is(err, config.ErrReservedSubdomain) {
+		s.respondErrorWithCode(w, http.StatusBadRequest, "RESERVED_SUBDOMAIN", "subdomain is reserved by the server")
 		return
 	}
-
-	// Check max domains limit
-	count, err := s.db.Domains.Count(user.ID)
 	if err != nil {
-		s.log.Error().Err(err).Msg("Failed to count domains")
-		s.respondError(w, http.StatusInternalServerError, "failed to reserve domain")
-		return
-	}
-
-	maxDomains := 1
-	if user.Plan != nil {
-		if user.Plan.MaxDomains < 0 {
-			maxDomains = -1
-		} else {
-			maxDomains = user.Plan.MaxDomains
-		}
-	}
-	if maxDomains >= 0 && count >= maxDomains {
-		s.respondErrorWithCode(w, http.StatusForbidden, "MAX_DOMAINS", "maximum domains reached")
+		s.respondErrorWithCode(w, http.StatusBadRequest, "INVALID_SUBDOMAIN", "subdomain must be 1-32 characters: letters, digits and inner hyphens")
 		return
 	}
 
-	// Create reservation
+	// Create reservation; the plan limit is checked in the same statement
 	domain := &database.ReservedDomain{
 		UserID:    user.ID,
-		Subdomain: req.Subdomain,
+		Subdomain: subdomain,
+	}
+	if req.ExpiresIn > 0 {
+		expiresAt := time.Now().Add(time.Duration(req.ExpiresIn) * time.Second)
+		domain.ExpiresAt = &expiresAt
 	}
 
-	if err := s.db.Domains.Create(domain); err != nil {
+	if err := s.db.Domains.CreateWithinLimit(domain, planMaxDomains(user)); err != nil {
+		if errors.Is(err, database.ErrMaxDomainsReached) {
+			s.respondErrorWithCode(w, http.StatusForbidden, "MAX_DOMAINS", "maximum domains reached")
+			return
+		}
 		if errors.Is(err, database.ErrDomainAlreadyExists) {
 			s.respondErrorWithCode(w, http.StatusConflict, "SUBDOMAIN_TAKEN", "subdomain is already reserved")
 			return
@@ -108,9 +102,13 @@ func (s *Server) handleReserveDomain(w http.ResponseWriter, r *http.Request) {
 
 	// Log audit
 	ipAddress := auth.GetClientIP(r)
-	_ = s.db.Audit.Log(&user.ID, database.ActionDomainReserved, map[string]interface{}{
-		"subdomain": req.Subdomain,
-	}, ipAddress)
+	details := map[string]interface{}{
+		"subdomain": subdomain,
+	}
+	if domain.ExpiresAt != nil {
+		details["expires_at"] = domain.ExpiresAt
+	}
+	_ = s.db.Audit.Log(&user.ID, database.ActionDomainReserved, details, ipAddress)
 
 	s.respondJSON(w, http.StatusCreated, dto.DomainFromModel(domain, s.baseDomain))
 }
@@ -155,6 +153,11 @@ func (s *Server) handleReleaseDomain(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The subdomain is free for anyone now; drop a tunnel still serving it
+	if s.tunnelProvider != nil {
+		s.tunnelProvider.CloseTunnelBySubdomain(domain.Subdomain)
+	}
+
 	// Log audit
 	ipAddress := auth.GetClientIP(r)
 	_ = s.db.Audit.Log(&user.ID, database.ActionDomainReleased, map[string]interface{}{
@@ -169,13 +172,22 @@ func (s *Server) handleReleaseDomain(w http.ResponseWriter, r *http.Request) {
 
 // handleCheckDomain checks if a subdomain is available
 func (s *Server) handleCheckDomain(w http.ResponseWriter, r *http.Request) {
-	subdomain := chi.URLParam(r, "subdomain")
+	requested := chi.URLParam(r, "subdomain")
 
-	// Validate subdomain format
-	if !subdomainRegex.MatchString(subdomain) {
+	// Validate subdomain by the rules the tunnel server applies
+	subdomain, err := config.NormalizeSubdomain(requested)
+	if errors.Is(err, config.ErrReservedSubdomain) {
 		s.respondJSON(w, http.StatusOK, dto.DomainCheckResponse{
 			Subdomain: subdomain,
 			Available: false,
+			Reason:    "reserved",
+		})
+		return
+	}
+	if err != nil {
+		s.respondJSON(w, http.StatusOK, dto.DomainCheckResponse{
+			Subdomain: requested,
+			Available: false,
 			Reason:    "invalid",
 		})
 		return
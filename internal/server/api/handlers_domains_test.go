@@ -2,12 +2,16 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/mephistofox/fxtun.dev/internal/server/api/dto"
+	"github.com/mephistofox/fxtun.dev/internal/server/database"
 	"github.com/stretchr/testify/require"
 )
 
@@ -137,6 +141,46 @@ func TestReleaseDomain_Success(t *testing.T) {
 	if !result.Success {
 		t.Fatal("expected success to be true")
 	}
+	require.Equal(t, []string{"releaseme"}, env.TunnelProvider.closedSubs, "tunnel on the released subdomain is closed")
+}
+
+func TestReserveDomain_ExpiresIn(t *testing.T) {
+	env := setupTestEnv(t)
+	user := env.createTestUser(t, "+20000000006", "password123", "Expiring User")
+
+	reserve := func(body string) *http.Response {
+		req, _ := http.NewRequest(http.MethodPost, env.Server.URL+"/api/domains", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+user.AccessToken)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		return resp
+	}
+
+	resp := reserve(`{"subdomain":"shortlived","expires_in":60}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for a TTL under an hour, got %d", resp.StatusCode)
+	}
+
+	resp = reserve(`{"subdomain":"shortlived","expires_in":7200}`)
+	var result dto.DomainDTO
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", resp.StatusCode)
+	}
+	require.NotNil(t, result.ExpiresAt)
+	require.WithinDuration(t, time.Now().Add(2*time.Hour), *result.ExpiresAt, time.Minute)
+
+	// The free plan allows one reservation
+	resp = reserve(`{"subdomain":"another"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected status 403 over the plan limit, got %d", resp.StatusCode)
+	}
 }
 
 func TestCheckDomain_Available(t *testing.T) {
@@ -197,3 +241,98 @@ func TestDomains_Unauthorized(t *testing.T) {
 		})
 	}
 }
+
+func TestReserveDomain_Normalized(t *testing.T) {
+	env := setupTestEnv(t)
+
+	tests := []struct {
+		subdomain string
+		status    int
+		want      string
+	}{
+		{"MyUpper", http.StatusCreated, "myupper"},
+		{"Café", http.StatusCreated, "xn--caf-dma"},
+		{"Admin", http.StatusBadRequest, ""},
+		{"my_app", http.StatusBadRequest, ""},
+	}
+	for i, tt := range tests {
+		t.Run(tt.subdomain, func(t *testing.T) {
+			user := env.createTestUser(t, fmt.Sprintf("+2000000010%d", i), "password123", "Normalize User")
+			body := fmt.Sprintf(`{"subdomain":%q}`, tt.subdomain)
+			req, _ := http.NewRequest(http.MethodPost, env.Server.URL+"/api/domains", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+user.AccessToken)
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			require.Equal(t, tt.status, resp.StatusCode)
+			if tt.want == "" {
+				return
+			}
+			var result dto.DomainDTO
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+			require.Equal(t, tt.want, result.Subdomain)
+		})
+	}
+}
+
+func TestCheckDomain_Reserved(t *testing.T) {
+	env := setupTestEnv(t)
+	user := env.createTestUser(t, "+20000000006", "password123", "Check Reserved User")
+
+	for path, reason := range map[string]string{"API": "reserved", "my_app": "invalid"} {
+		req, _ := http.NewRequest(http.MethodGet, env.Server.URL+"/api/domains/check/"+path, nil)
+		req.Header.Set("Authorization", "Bearer "+user.AccessToken)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+
+		var result dto.DomainCheckResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		resp.Body.Close()
+		require.False(t, result.Available, path)
+		require.Equal(t, reason, result.Reason, path)
+	}
+}
+
+func TestReserveDomain_ConcurrentLimit(t *testing.T) {
+	env := setupTestEnv(t)
+	user := env.createTestUser(t, "+20000000031", "password123", "Racing Domain User")
+
+	const attempts, limit = 10, 3
+	errs := make(chan error, attempts)
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- env.DB.Domains.CreateWithinLimit(&database.ReservedDomain{
+				UserID:    user.User.ID,
+				Subdomain: fmt.Sprintf("race%d", i),
+			}, limit)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	created := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			created++
+		case !errors.Is(err, database.ErrMaxDomainsReached):
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if created != limit {
+		t.Fatalf("expected %d reservations, got %d", limit, created)
+	}
+
+	count, err := env.DB.Domains.Count(user.User.ID)
+	if err != nil {
+		t.Fatalf("count domains: %v", err)
+	}
+	if count != limit {
+		t.Fatalf("expected %d stored reservations, got %d", limit, count)
+	}
+}
@@ -1,7 +1,9 @@
 package api
 
 import (
+	"crypto/ed25519"
 	_ "embed"
+	"encoding/hex"
 	"fmt"
 	"net/http"
 	"os"
@@ -29,6 +31,7 @@ type platformInfo struct {
 	OS         string
 	Arch       string
 	ClientType string // "cli" or "gui"
+	SHA256     string // hex-encoded, filled in by scanDownloads
 }
 
 var osNames = map[string]string{
@@ -38,9 +41,10 @@ var osNames = map[string]string{
 // parseBinaryName extracts platform info from binary filename.
 // Patterns: fxtunnel-{os}-{arch}[.exe], fxtunnel-gui-{os}-{arch}[.exe]
 func parseBinaryName(filename string) (platform string, info platformInfo, ok bool) {
-	// Detached signatures live next to binaries but are not themselves a
-	// downloadable platform; they are served via the .sig suffix in handleDownload.
-	if strings.HasSuffix(filename, ".sig") {
+	// Detached signatures and checksum files live next to binaries but are not
+	// themselves a downloadable platform; they are served via the .sig and
+	// .sha256 suffixes in handleDownload.
+	if strings.HasSuffix(filename, ".sig") || strings.HasSuffix(filename, ".sha256") {
 		return "", platformInfo{}, false
 	}
 	name := strings.TrimSuffix(filename, ".exe")
@@ -86,6 +90,8 @@ func (s *Server) scanDownloads() (map[string]platformInfo, []*dto.DownloadDTO, [
 		return found, nil, nil
 	}
 
+	manifest := s.loadDownloadsManifest()
+
 	for _, e := range entries {
 		if e.IsDir() {
 			continue
@@ -98,14 +104,25 @@ func (s *Server) scanDownloads() (map[string]platformInfo, []*dto.DownloadDTO, [
 		if err != nil {
 			continue
 		}
+		sum, err := s.downloadSums.sum(filepath.Join(s.downloadsPath, e.Name()), fi)
+		if err != nil {
+			s.log.Warn().Err(err).Str("file", e.Name()).Msg("Failed to checksum download")
+			continue
+		}
+		info.SHA256 = sum
 		found[platform] = info
+
+		version, notes := manifest.lookup(platform)
 		d := &dto.DownloadDTO{
-			Platform:   platform,
-			OS:         info.OS,
-			Arch:       info.Arch,
-			Size:       fi.Size(),
-			URL:        "/api/downloads/" + platform,
-			ClientType: info.ClientType,
+			Platform:     platform,
+			OS:           info.OS,
+			Arch:         info.Arch,
+			Size:         fi.Size(),
+			URL:          "/api/downloads/" + platform,
+			ClientType:   info.ClientType,
+			Version:      version,
+			SHA256:       sum,
+			ReleaseNotes: notes,
 		}
 		if info.ClientType == "gui" {
 			guiClients = append(guiClients, d)
@@ -124,6 +141,7 @@ func (s *Server) handleListDownloads(w http.ResponseWriter, r *http.Request) {
 	allClients := append(cliClients, guiClients...)
 
 	s.respondJSON(w, http.StatusOK, dto.DownloadsListResponse{
+		Version: s.loadDownloadsManifest().version(s.version),
 		Clients: allClients,
 		CLI:     cliClients,
 		GUI:     guiClients,
@@ -134,9 +152,12 @@ func (s *Server) handleListDownloads(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
 	platform := chi.URLParam(r, "platform")
 
-	// A ".sig" suffix requests the binary's detached update signature.
+	// A ".sig" suffix requests the binary's detached update signature and a
+	// ".sha256" suffix its checksum in sha256sum(1) format.
 	sigRequested := strings.HasSuffix(platform, ".sig")
 	platform = strings.TrimSuffix(platform, ".sig")
+	sumRequested := strings.HasSuffix(platform, ".sha256")
+	platform = strings.TrimSuffix(platform, ".sha256")
 
 	found, _, _ := s.scanDownloads()
 	info, ok := found[platform]
@@ -145,6 +166,13 @@ func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if sumRequested {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "%s  %s\n", info.SHA256, info.Filename)
+		return
+	}
+
 	filename := info.Filename
 	if sigRequested {
 		filename += ".sig"
@@ -200,9 +228,11 @@ func (s *Server) handleInstallScript(w http.ResponseWriter, r *http.Request) {
 	data := struct {
 		BaseURL    string
 		WebsiteURL string
+		PublicKey  string
 	}{
 		BaseURL:    fmt.Sprintf("https://%s/api/downloads", domain),
 		WebsiteURL: fmt.Sprintf("https://%s", domain),
+		PublicKey:  s.releasePublicKey(),
 	}
 	if err := installTmpl.Execute(w, data); err != nil {
 		s.log.Error().Err(err).Msg("failed to execute install script template")
@@ -231,3 +261,20 @@ func (s *Server) handleInstallPS1(w http.ResponseWriter, r *http.Request) {
 		s.log.Error().Err(err).Msg("failed to execute PowerShell install script template")
 	}
 }
+
+// releasePublicKey returns the configured release signing key, or "" when
+// signature verification is not provisioned. Only a well-formed ed25519 key is
+// returned so a typo cannot be interpolated into the install script.
+func (s *Server) releasePublicKey() string {
+	if s.cfg == nil {
+		return ""
+	}
+	key := strings.ToLower(strings.TrimSpace(s.cfg.Downloads.PublicKey))
+	if b, err := hex.DecodeString(key); err != nil || len(b) != ed25519.PublicKeySize {
+		if key != "" {
+			s.log.Warn().Msg("Ignoring invalid downloads.public_key")
+		}
+		return ""
+	}
+	return key
+}
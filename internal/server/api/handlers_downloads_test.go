@@ -2,6 +2,7 @@ package api
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -9,6 +10,7 @@ import (
 	"testing"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/mephistofox/fxtun.dev/internal/server/api/dto"
 	"github.com/rs/zerolog"
 )
 
@@ -69,3 +71,42 @@ func TestHandleDownload_ServesBinaryAndSignature(t *testing.T) {
 		}
 	})
 }
+
+func TestDownloads_ChecksumsAndManifest(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "fxtunnel-linux-amd64"), []byte("BINARY"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	manifest := `{"version":"v1.2.0","release_notes":"notes","platforms":{"cli-linux-amd64":{"version":"v1.2.1"}}}`
+	if err := os.WriteFile(filepath.Join(dir, "manifest.json"), []byte(manifest), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// sha256("BINARY")
+	const want = "4c77b56b7cf3077c725c2f433eb76156bd231c23b56805f5a06fc06b87450a43"
+
+	s := &Server{downloadsPath: dir, log: zerolog.Nop()}
+
+	t.Run("list", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		s.handleListDownloads(rec, httptest.NewRequest(http.MethodGet, "/api/downloads/", nil))
+		var resp dto.DownloadsListResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Version != "v1.2.0" || len(resp.CLI) != 1 {
+			t.Fatalf("unexpected list: %+v", resp)
+		}
+		d := resp.CLI[0]
+		if d.SHA256 != want || d.Version != "v1.2.1" || d.ReleaseNotes != "notes" {
+			t.Fatalf("unexpected download: %+v", d)
+		}
+	})
+
+	t.Run("checksum file", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		s.handleDownload(rec, downloadReq(t, "cli-linux-amd64.sha256"))
+		if rec.Code != http.StatusOK || rec.Body.String() != want+"  fxtunnel-linux-amd64\n" {
+			t.Fatalf("checksum: code=%d body=%q", rec.Code, rec.Body.String())
+		}
+	})
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mephistofox/fxtun.dev/internal/server/api/dto"
+)
+
+func TestHandleDrainStatus(t *testing.T) {
+	tests := []struct {
+		name  string
+		drain DrainStatus
+		want  dto.DrainStatusResponse
+	}{
+		{"Serving", DrainStatus{ActiveConnections: 3},
+			dto.DrainStatusResponse{Status: "serving", ActiveConnections: 3}},
+		{"Draining", DrainStatus{Draining: true, ActiveConnections: 2, TimeLeft: 7400 * time.Millisecond},
+			dto.DrainStatusResponse{Status: "draining", ActiveConnections: 2, TimeLeftSeconds: 7}},
+		{"Drained", DrainStatus{Draining: true, TimeLeft: 4 * time.Second},
+			dto.DrainStatusResponse{Status: "drained", TimeLeftSeconds: 4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newMockTunnelProvider()
+			provider.drain = tt.drain
+			s := &Server{tunnelProvider: provider}
+
+			w := httptest.NewRecorder()
+			s.handleDrainStatus(w, httptest.NewRequest("GET", "/health/drain", nil))
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var got dto.DrainStatusResponse
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+			assert.Equal(t, tt.want, got)
+
+			w = httptest.NewRecorder()
+			DrainStatusHandler(provider.GetDrainStatus).ServeHTTP(w, httptest.NewRequest("GET", "/health/drain", nil))
+			got = dto.DrainStatusResponse{}
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+			assert.Equal(t, tt.want, got, "the internal listener reports the same")
+		})
+	}
+}
@@ -2,10 +2,12 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -48,6 +50,17 @@ func (s *Server) handleListExchanges(w http.ResponseWriter, r *http.Request) {
 		limit = 50
 	}
 
+	// Host is stable across server restarts / tunnel reconnects.
+	host := s.tunnelSubdomain(tunnelID)
+	if host != "" {
+		host = host + "." + s.baseDomain
+	}
+	s.respondExchanges(w, user.ID, tunnelID, host, offset, limit)
+}
+
+// respondExchanges writes a page of the user's exchanges on host, falling
+// back to those of tunnelID. Either may be empty.
+func (s *Server) respondExchanges(w http.ResponseWriter, userID int64, tunnelID, host string, offset, limit int) {
 	if s.inspectProvider == nil {
 		s.respondJSON(w, http.StatusOK, map[string]interface{}{
 			"exchanges": []interface{}{},
@@ -60,12 +73,8 @@ func (s *Server) handleListExchanges(w http.ResponseWriter, r *http.Request) {
 	// DB contains full history; in-memory buffer is only for live SSE streaming.
 
 	// 1. Try by host (stable across server restarts / tunnel reconnects).
-	host := s.tunnelSubdomain(tunnelID)
-	if host != "" {
-		host = host + "." + s.baseDomain
-	}
 	if host != "" {
-		exchanges, total, err := s.inspectProvider.ListPersistedByHostAndUser(host, user.ID, offset, limit)
+		exchanges, total, err := s.inspectProvider.ListPersistedByHostAndUser(host, userID, offset, limit)
 		if err != nil {
 			s.log.Error().Err(err).Str("host", host).Msg("Failed to list persisted exchanges by host")
 			s.respondError(w, http.StatusInternalServerError, "failed to load exchanges")
@@ -85,6 +94,13 @@ func (s *Server) handleListExchanges(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 2. Fallback: try by tunnel_id (current session data only).
+	if tunnelID == "" {
+		s.respondJSON(w, http.StatusOK, map[string]interface{}{
+			"exchanges": []interface{}{},
+			"total":     0,
+		})
+		return
+	}
 	exchanges, total, err := s.inspectProvider.ListPersisted(tunnelID, offset, limit)
 	if err != nil {
 		s.log.Error().Err(err).Str("tunnel_id", tunnelID).Msg("Failed to list persisted exchanges by tunnel_id")
@@ -138,7 +154,7 @@ func (s *Server) handleGetExchange(w http.ResponseWriter, r *http.Request) {
 
 	// Fallback to persisted data
 	if s.inspectProvider != nil {
-		ex, err := s.inspectProvider.GetPersisted(exchangeID)
+		ex, err := s.inspectProvider.GetPersistedByUser(exchangeID, user.ID)
 		if err == nil && ex != nil {
 			s.respondJSON(w, http.StatusOK, ex)
 			return
@@ -172,6 +188,28 @@ func (s *Server) handleClearExchanges(w http.ResponseWriter, r *http.Request) {
 	s.respondJSON(w, http.StatusOK, map[string]interface{}{"success": true})
 }
 
+// handlePurgeCache drops the stored responses of a tunnel's response cache,
+// so the next requests reach the local service again.
+func (s *Server) handlePurgeCache(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		s.respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	if s.tunnelProvider == nil {
+		s.respondError(w, http.StatusNotFound, "tunnel not found")
+		return
+	}
+
+	purged, err := s.tunnelProvider.PurgeTunnelCache(chi.URLParam(r, "id"), user.ID)
+	if err != nil {
+		s.respondError(w, http.StatusNotFound, "tunnel not found or access denied")
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, dto.CachePurgeResponse{Purged: purged})
+}
+
 func (s *Server) handleInspectStream(w http.ResponseWriter, r *http.Request) {
 	user := auth.GetUserFromContext(r.Context())
 	if user == nil {
@@ -194,6 +232,12 @@ func (s *Server) handleInspectStream(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.streamExchanges(w, r, buf, nil)
+}
+
+// streamExchanges sends the exchanges added to buf as server-sent events
+// until the client goes away or stop is closed; a nil stop never is.
+func (s *Server) streamExchanges(w http.ResponseWriter, r *http.Request, buf *inspect.RingBuffer, stop <-chan struct{}) {
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
@@ -226,6 +270,8 @@ func (s *Server) handleInspectStream(w http.ResponseWriter, r *http.Request) {
 			flusher.Flush()
 		case <-r.Context().Done():
 			return
+		case <-stop:
+			return
 		}
 	}
 }
@@ -288,22 +334,65 @@ func (s *Server) handleReplayExchange(w http.ResponseWriter, r *http.Request) {
 	exchangeID := chi.URLParam(r, "exchangeId")
 
 	// Find original exchange from buffer or DB
+	ex := s.findExchange(tunnelID, exchangeID, user.ID)
+	if ex == nil {
+		s.respondError(w, http.StatusNotFound, "exchange not found")
+		return
+	}
+
+	// Apply modifications or use original values
+	method := ex.Method
+	if mods.Method != nil {
+		method = *mods.Method
+	}
+	path := ex.Path
+	if mods.Path != nil {
+		path = *mods.Path
+	}
+	reqHeaders := ex.RequestHeaders.Clone()
+	if mods.Headers != nil {
+		reqHeaders = http.Header(mods.Headers)
+	}
+	reqBody := ex.RequestBody
+	if mods.Body != nil {
+		decoded, err := base64.StdEncoding.DecodeString(*mods.Body)
+		if err == nil {
+			reqBody = decoded
+		}
+	}
+
+	s.replayThroughTunnel(w, r, user, tunnelID, exchangeID, ex.Host, method, path, reqHeaders, reqBody)
+}
+
+// findExchange looks an exchange of the tunnel up in its inspect buffer,
+// then among the exchanges persisted for the user. It returns nil when
+// there is none.
+func (s *Server) findExchange(tunnelID, exchangeID string, userID int64) *inspect.CapturedExchange {
 	var ex *inspect.CapturedExchange
 	if buf := s.getInspectBuffer(tunnelID); buf != nil {
 		ex = buf.Get(exchangeID)
 	}
 	if ex == nil && s.inspectProvider != nil {
-		ex, _ = s.inspectProvider.GetPersisted(exchangeID)
-	}
-	if ex == nil {
-		s.respondError(w, http.StatusNotFound, "exchange not found")
-		return
+		ex, _ = s.inspectProvider.GetPersistedByUser(exchangeID, userID)
 	}
+	return ex
+}
 
+// replayThroughTunnel sends a request to the local service behind one of
+// the user's tunnels, records it as a new exchange linked to replayRef and
+// writes the result. An empty host stands for the tunnel's own subdomain.
+// The replay is bounded by web.replay.timeout and the user's replays in
+// flight by web.replay.max_concurrent.
+func (s *Server) replayThroughTunnel(w http.ResponseWriter, r *http.Request, user *auth.AuthenticatedUser, tunnelID, replayRef, host, method, path string, reqHeaders http.Header, reqBody []byte) {
 	if s.replayProvider == nil {
 		s.respondError(w, http.StatusServiceUnavailable, "replay not available")
 		return
 	}
+	if !s.replaySlots.acquire(user.ID) {
+		s.respondErrorWithCode(w, http.StatusTooManyRequests, "REPLAY_BUSY", "too many replays in progress, wait for one to finish")
+		return
+	}
+	defer s.replaySlots.release(user.ID)
 
 	// Find subdomain for this tunnel from the tunnel provider
 	var subdomain string
@@ -320,63 +409,58 @@ func (s *Server) handleReplayExchange(w http.ResponseWriter, r *http.Request) {
 		s.respondError(w, http.StatusNotFound, "tunnel subdomain not found")
 		return
 	}
-
-	// Apply modifications or use original values
-	method := ex.Method
-	if mods.Method != nil {
-		method = *mods.Method
-	}
-	path := ex.Path
-	if mods.Path != nil {
-		path = *mods.Path
-	}
-	reqHeaders := ex.RequestHeaders.Clone()
-	if mods.Headers != nil {
-		reqHeaders = http.Header(mods.Headers)
+	if host == "" {
+		host = subdomain + "." + s.cfg.Domain.Base
 	}
-	reqBody := ex.RequestBody
-	if mods.Body != nil {
-		decoded, err := base64.StdEncoding.DecodeString(*mods.Body)
-		if err == nil {
-			reqBody = decoded
-		}
+
+	timeout := s.cfg.Web.Replay.Timeout
+	if timeout <= 0 {
+		timeout = defaultReplayTimeout
 	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
 
 	// Build replay request
 	bodyReader := bytes.NewReader(reqBody)
-	replayReq, err := http.NewRequest(method, path, bodyReader)
+	replayReq, err := http.NewRequestWithContext(ctx, method, path, bodyReader)
 	if err != nil {
 		s.respondError(w, http.StatusInternalServerError, "failed to create replay request")
 		return
 	}
-	replayReq.Host = ex.Host
+	replayReq.Host = host
 	replayReq.Header = reqHeaders
 
 	startTime := time.Now()
 	result, err := s.replayProvider.ReplayRequest(subdomain, replayReq)
 	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			s.respondErrorWithCode(w, http.StatusGatewayTimeout, "REPLAY_TIMEOUT",
+				fmt.Sprintf("replay timed out: the local service did not answer within %s", timeout))
+			return
+		}
 		s.respondError(w, http.StatusBadGateway, fmt.Sprintf("replay failed: %v", err))
 		return
 	}
 
 	// Build new CapturedExchange from replay
 	newEx := &inspect.CapturedExchange{
-		ID:               generateReplayID(),
-		TunnelID:         tunnelID,
-		ReplayRef:        exchangeID,
-		Timestamp:        startTime,
-		Duration:         time.Since(startTime),
-		Method:           method,
-		Path:             path,
-		Host:             ex.Host,
-		RequestHeaders:   reqHeaders,
-		RequestBody:      reqBody,
-		RequestBodySize:  int64(len(reqBody)),
-		RemoteAddr:       "replay",
-		StatusCode:       result.StatusCode,
-		ResponseHeaders:  result.Headers,
-		ResponseBody:     result.Body,
-		ResponseBodySize: int64(len(result.Body)),
+		ID:                generateReplayID(),
+		TunnelID:          tunnelID,
+		ReplayRef:         replayRef,
+		Timestamp:         startTime,
+		Duration:          time.Since(startTime),
+		Method:            method,
+		Path:              path,
+		Host:              host,
+		RequestHeaders:    reqHeaders,
+		RequestBody:       reqBody,
+		RequestBodySize:   int64(len(reqBody)),
+		RemoteAddr:        "replay",
+		StatusCode:        result.StatusCode,
+		ResponseHeaders:   result.Headers,
+		ResponseBody:      result.Body,
+		ResponseBodySize:  int64(len(result.Body)),
+		ResponseTruncated: result.Truncated,
 	}
 
 	// Add to inspect buffer + persist
@@ -395,6 +479,7 @@ func (s *Server) handleReplayExchange(w http.ResponseWriter, r *http.Request) {
 		ResponseHeaders: respHeaders,
 		ResponseBody:    result.Body,
 		ExchangeID:      newEx.ID,
+		Truncated:       result.Truncated,
 	})
 }
 
@@ -0,0 +1,277 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/mephistofox/fxtun.dev/internal/server/api/dto"
+	"github.com/mephistofox/fxtun.dev/internal/server/auth"
+	"github.com/mephistofox/fxtun.dev/internal/server/database"
+)
+
+const (
+	// defaultShareTTL is how long a share link lasts unless asked otherwise.
+	defaultShareTTL = time.Hour
+	// maxShareTTL caps the lifetime of a share link.
+	maxShareTTL = 24 * time.Hour
+	// shareRevokeCheckInterval is how often a live stream through a share
+	// link checks whether the link has been revoked.
+	shareRevokeCheckInterval = 30 * time.Second
+)
+
+// handleCreateInspectShare issues a link that gives read-only access to the
+// inspector of one of the user's tunnels until it expires or is revoked,
+// without access to the account.
+// POST /api/tunnels/{id}/inspect/share
+func (s *Server) handleCreateInspectShare(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		s.respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	if !s.checkInspectorAccess(w, user) {
+		return
+	}
+
+	var req dto.CreateInspectShareRequest
+	if r.ContentLength > 0 {
+		if err := s.decodeJSON(r, &req); err != nil {
+			s.respondError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+	}
+	ttl := defaultShareTTL
+	if req.ExpiresIn != 0 {
+		ttl = time.Duration(req.ExpiresIn) * time.Second
+		if ttl < time.Minute || ttl > maxShareTTL {
+			s.respondError(w, http.StatusBadRequest, fmt.Sprintf("expires_in must be between 60 and %d seconds", int(maxShareTTL.Seconds())))
+			return
+		}
+	}
+
+	tunnelID := s.resolveActiveTunnelID(chi.URLParam(r, "id"))
+	var subdomain string
+	if s.tunnelProvider != nil {
+		for _, t := range s.tunnelProvider.GetTunnelsByUserID(user.ID) {
+			if t.ID == tunnelID {
+				subdomain = t.Subdomain
+				break
+			}
+		}
+	}
+	if subdomain == "" {
+		s.respondError(w, http.StatusNotFound, "tunnel not found or access denied")
+		return
+	}
+
+	share := &database.InspectShare{UserID: user.ID, Subdomain: subdomain, ExpiresAt: time.Now().Add(ttl)}
+	if err := s.db.InspectShares.Create(share); err != nil {
+		s.log.Error().Err(err).Int64("user_id", user.ID).Msg("Failed to store inspect share")
+		s.respondError(w, http.StatusInternalServerError, "failed to create share link")
+		return
+	}
+	token, expiresAt, err := s.authService.GetJWTManager().GenerateShareToken(share.ID, user.ID, subdomain, ttl)
+	if err != nil {
+		s.log.Error().Err(err).Int64("user_id", user.ID).Msg("Failed to issue inspect share token")
+		s.respondError(w, http.StatusInternalServerError, "failed to create share link")
+		return
+	}
+
+	scheme := "https"
+	if r.TLS == nil {
+		scheme = "http"
+	}
+	s.respondJSON(w, http.StatusCreated, dto.InspectShareResponse{
+		ID:        share.ID,
+		Token:     token,
+		URL:       fmt.Sprintf("%s://%s/inspect/shared/%s", scheme, r.Host, token),
+		APIURL:    fmt.Sprintf("%s://%s/api/inspect/shared/%s", scheme, r.Host, token),
+		Subdomain: subdomain,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// handleListInspectShares lists the user's share links still in force.
+// GET /api/inspect/shares
+func (s *Server) handleListInspectShares(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		s.respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	shares, err := s.db.InspectShares.ListActiveByUser(user.ID)
+	if err != nil {
+		s.log.Error().Err(err).Int64("user_id", user.ID).Msg("Failed to list inspect shares")
+		s.respondError(w, http.StatusInternalServerError, "failed to list share links")
+		return
+	}
+	resp := dto.InspectSharesListResponse{Shares: make([]*dto.InspectShareDTO, 0, len(shares))}
+	for _, share := range shares {
+		resp.Shares = append(resp.Shares, &dto.InspectShareDTO{
+			ID:        share.ID,
+			Subdomain: share.Subdomain,
+			ExpiresAt: share.ExpiresAt,
+			CreatedAt: share.CreatedAt,
+		})
+	}
+	s.respondJSON(w, http.StatusOK, resp)
+}
+
+// handleRevokeInspectShare ends one of the user's share links before it
+// expires.
+// DELETE /api/inspect/shares/{shareId}
+func (s *Server) handleRevokeInspectShare(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		s.respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "shareId"), 10, 64)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, "invalid share link ID")
+		return
+	}
+	if err := s.db.InspectShares.Revoke(id, user.ID); err != nil {
+		if errors.Is(err, database.ErrInspectShareNotFound) {
+			s.respondError(w, http.StatusNotFound, "share link not found")
+			return
+		}
+		s.log.Error().Err(err).Int64("share_id", id).Msg("Failed to revoke inspect share")
+		s.respondError(w, http.StatusInternalServerError, "failed to revoke share link")
+		return
+	}
+	s.respondJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+}
+
+// sharedInspect validates the share token of the request and checks that
+// its link has not been revoked. On failure it writes the error and returns
+// nil.
+func (s *Server) sharedInspect(w http.ResponseWriter, r *http.Request) *auth.ShareClaims {
+	claims, err := s.authService.GetJWTManager().ValidateShareToken(chi.URLParam(r, "token"))
+	if err != nil {
+		if errors.Is(err, auth.ErrTokenExpired) {
+			s.respondErrorWithCode(w, http.StatusGone, "SHARE_EXPIRED", "share link expired")
+			return nil
+		}
+		s.respondErrorWithCode(w, http.StatusUnauthorized, "SHARE_INVALID", "invalid share link")
+		return nil
+	}
+
+	share, err := s.db.InspectShares.GetByID(claims.ShareID)
+	if err != nil && !errors.Is(err, database.ErrInspectShareNotFound) {
+		s.log.Error().Err(err).Int64("share_id", claims.ShareID).Msg("Failed to load inspect share")
+		s.respondError(w, http.StatusInternalServerError, "failed to load share link")
+		return nil
+	}
+	if share == nil || share.RevokedAt != nil || share.UserID != claims.UserID {
+		s.respondErrorWithCode(w, http.StatusGone, "SHARE_REVOKED", "share link revoked")
+		return nil
+	}
+	return claims
+}
+
+// sharedTunnelID returns the ID of the shared tunnel while it is connected,
+// empty otherwise.
+func (s *Server) sharedTunnelID(claims *auth.ShareClaims) string {
+	if s.tunnelProvider == nil {
+		return ""
+	}
+	for _, t := range s.tunnelProvider.GetTunnelsByUserID(claims.UserID) {
+		if t.Subdomain == claims.Subdomain {
+			return t.ID
+		}
+	}
+	return ""
+}
+
+// handleSharedListExchanges lists the exchanges of a shared tunnel.
+// GET /api/inspect/shared/{token}
+func (s *Server) handleSharedListExchanges(w http.ResponseWriter, r *http.Request) {
+	claims := s.sharedInspect(w, r)
+	if claims == nil {
+		return
+	}
+
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+
+	host := claims.Subdomain + "." + s.baseDomain
+	s.respondExchanges(w, claims.UserID, s.sharedTunnelID(claims), host, offset, limit)
+}
+
+// handleSharedGetExchange returns an exchange of a shared tunnel: one in
+// the buffer of the live tunnel, or one persisted for the link's owner on
+// the shared subdomain.
+// GET /api/inspect/shared/{token}/{exchangeId}
+func (s *Server) handleSharedGetExchange(w http.ResponseWriter, r *http.Request) {
+	claims := s.sharedInspect(w, r)
+	if claims == nil {
+		return
+	}
+
+	tunnelID := s.sharedTunnelID(claims)
+	ex := s.findExchange(tunnelID, chi.URLParam(r, "exchangeId"), claims.UserID)
+	if ex == nil || (ex.Host != claims.Subdomain+"."+s.baseDomain && (tunnelID == "" || ex.TunnelID != tunnelID)) {
+		s.respondError(w, http.StatusNotFound, "exchange not found")
+		return
+	}
+	s.respondJSON(w, http.StatusOK, ex)
+}
+
+// handleSharedInspectStream streams the live traffic of a shared tunnel
+// until the link expires or is revoked.
+// GET /api/inspect/shared/{token}/stream
+func (s *Server) handleSharedInspectStream(w http.ResponseWriter, r *http.Request) {
+	claims := s.sharedInspect(w, r)
+	if claims == nil {
+		return
+	}
+
+	buf := s.getInspectBuffer(s.sharedTunnelID(claims))
+	if buf == nil {
+		s.respondError(w, http.StatusNotFound, "inspection not available")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	stop := make(chan struct{})
+	go s.watchShare(ctx, claims, stop)
+	s.streamExchanges(w, r, buf, stop)
+}
+
+// watchShare closes stop once the share link expires or turns out to be
+// revoked, unless ctx is done first.
+func (s *Server) watchShare(ctx context.Context, claims *auth.ShareClaims, stop chan<- struct{}) {
+	expired := time.NewTimer(time.Until(claims.ExpiresAt.Time))
+	defer expired.Stop()
+	ticker := time.NewTicker(shareRevokeCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-expired.C:
+			close(stop)
+			return
+		case <-ticker.C:
+			share, err := s.db.InspectShares.GetByID(claims.ShareID)
+			if errors.Is(err, database.ErrInspectShareNotFound) || (err == nil && share.RevokedAt != nil) {
+				close(stop)
+				return
+			}
+		}
+	}
+}
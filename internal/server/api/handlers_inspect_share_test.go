@@ -0,0 +1,127 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mephistofox/fxtun.dev/internal/server/api/dto"
+)
+
+func TestInspectShare(t *testing.T) {
+	env := setupTestEnv(t)
+	owner := env.createTestAdmin(t, "+10000000061", "adminpass1", "Owner")
+	other := env.createTestAdmin(t, "+10000000062", "adminpass2", "Other")
+	env.TunnelProvider.userTunnels[owner.User.ID] = []TunnelInfo{{ID: "t1", Type: "http", Subdomain: "app", UserID: owner.User.ID}}
+
+	do := func(method, url, token string, body interface{}) *http.Response {
+		t.Helper()
+		var reader io.Reader
+		if body != nil {
+			data, _ := json.Marshal(body)
+			reader = bytes.NewReader(data)
+		}
+		req, _ := http.NewRequest(method, url, reader)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		return resp
+	}
+	sharePath := env.Server.URL + "/api/tunnels/t1/inspect/share"
+
+	resp := do("POST", sharePath, owner.AccessToken, map[string]int{"expires_in": 30})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for a too short link, got %d", resp.StatusCode)
+	}
+
+	resp = do("POST", sharePath, other.AccessToken, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for another user's tunnel, got %d", resp.StatusCode)
+	}
+
+	resp = do("POST", sharePath, owner.AccessToken, nil)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", resp.StatusCode)
+	}
+	var share dto.InspectShareResponse
+	if err := json.NewDecoder(resp.Body).Decode(&share); err != nil {
+		t.Fatalf("failed to decode share link: %v", err)
+	}
+	resp.Body.Close()
+	if share.Subdomain != "app" || !strings.HasSuffix(share.URL, "/inspect/shared/"+share.Token) ||
+		!strings.HasSuffix(share.APIURL, "/api/inspect/shared/"+share.Token) || strings.Contains(share.URL, "/api/") {
+		t.Errorf("unexpected share link %+v", share)
+	}
+	if d := time.Until(share.ExpiresAt); d < 59*time.Minute || d > time.Hour {
+		t.Errorf("expected the link to last an hour, expires in %s", d)
+	}
+
+	resp = do("GET", share.APIURL, "", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 listing through the link, got %d", resp.StatusCode)
+	}
+
+	resp = do("GET", share.APIURL+"x", "", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a forged link, got %d", resp.StatusCode)
+	}
+
+	resp = do("GET", env.Server.URL+"/api/profile", share.Token, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("a share token must not grant account access, got %d", resp.StatusCode)
+	}
+
+	expired, _, err := env.AuthService.GetJWTManager().GenerateShareToken(share.ID, owner.User.ID, "app", time.Millisecond)
+	if err != nil {
+		t.Fatalf("failed to issue share token: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	resp = do("GET", env.Server.URL+"/api/inspect/shared/"+expired, "", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusGone {
+		t.Errorf("expected 410 for an expired link, got %d", resp.StatusCode)
+	}
+
+	sharesPath := env.Server.URL + "/api/inspect/shares"
+	resp = do("GET", sharesPath, owner.AccessToken, nil)
+	var list dto.InspectSharesListResponse
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatalf("failed to decode share links: %v", err)
+	}
+	resp.Body.Close()
+	if len(list.Shares) != 1 || list.Shares[0].ID != share.ID {
+		t.Errorf("expected the link in the list, got %+v", list.Shares)
+	}
+
+	resp = do("DELETE", fmt.Sprintf("%s/%d", sharesPath, share.ID), other.AccessToken, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 revoking another user's link, got %d", resp.StatusCode)
+	}
+
+	resp = do("DELETE", fmt.Sprintf("%s/%d", sharesPath, share.ID), owner.AccessToken, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 revoking the link, got %d", resp.StatusCode)
+	}
+
+	resp = do("GET", share.APIURL, "", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusGone {
+		t.Errorf("expected 410 for a revoked link, got %d", resp.StatusCode)
+	}
+}
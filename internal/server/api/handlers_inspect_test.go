@@ -0,0 +1,50 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mephistofox/fxtun.dev/internal/server/api/dto"
+	"github.com/mephistofox/fxtun.dev/internal/server/auth"
+)
+
+func purgeCacheRequest(tunnelID string, user *auth.AuthenticatedUser) *http.Request {
+	req := httptest.NewRequest(http.MethodDelete, "/api/tunnels/"+tunnelID+"/inspect/cache", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", tunnelID)
+	ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+	if user != nil {
+		ctx = context.WithValue(ctx, auth.UserContextKey, user)
+	}
+	return req.WithContext(ctx)
+}
+
+func TestHandlePurgeCache(t *testing.T) {
+	provider := newMockTunnelProvider()
+	provider.userTunnels[7] = []TunnelInfo{{ID: "t1", Type: "http", Subdomain: "app", UserID: 7}}
+	provider.cached = map[string]int{"t1": 3}
+	s := &Server{tunnelProvider: provider, log: zerolog.Nop()}
+
+	w := httptest.NewRecorder()
+	s.handlePurgeCache(w, purgeCacheRequest("t1", &auth.AuthenticatedUser{ID: 8}))
+	assert.Equal(t, http.StatusNotFound, w.Code, "tunnels of other users cannot be purged")
+
+	w = httptest.NewRecorder()
+	s.handlePurgeCache(w, purgeCacheRequest("t1", &auth.AuthenticatedUser{ID: 7}))
+	require.Equal(t, http.StatusOK, w.Code)
+	var got dto.CachePurgeResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+	assert.Equal(t, 3, got.Purged)
+
+	w = httptest.NewRecorder()
+	s.handlePurgeCache(w, purgeCacheRequest("t1", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -1,506 +1,195 @@
 package api
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/mephistofox/fxtun.dev/internal/server/auth"
-	"github.com/mephistofox/fxtun.dev/internal/config"
 	"github.com/mephistofox/fxtun.dev/internal/server/store"
 )
 
-const (
-	githubAuthorizeURL  = "https://github.com/login/oauth/authorize"
-	githubTokenURL      = "https://github.com/login/oauth/access_token" //nolint:gosec // not a credential, this is GitHub's OAuth endpoint URL
-	githubUserURL       = "https://api.github.com/user"
-	githubUserEmailsURL = "https://api.github.com/user/emails"
-)
-
-type githubTokenResponse struct {
-	AccessToken string `json:"access_token"`
-	TokenType   string `json:"token_type"`
-	Scope       string `json:"scope"`
-}
-
-type githubUser struct {
-	ID        int64  `json:"id"`
-	Login     string `json:"login"`
-	Email     string `json:"email"`
-	Name      string `json:"name"`
-	AvatarURL string `json:"avatar_url"`
-}
-
-type githubUserEmail struct {
-	Email    string `json:"email"`
-	Primary  bool   `json:"primary"`
-	Verified bool   `json:"verified"`
-}
+// defaultOAuthTimeout bounds provider calls when oauth.timeout is unset.
+const defaultOAuthTimeout = 10 * time.Second
 
-// handleGitHubAuth initiates the GitHub OAuth login flow.
-func (s *Server) handleGitHubAuth(w http.ResponseWriter, r *http.Request) {
-	creds := s.cfg.OAuth.GitHub.GetCredentials(r.Host)
-	if creds == nil {
-		s.respondError(w, http.StatusNotImplemented, "GitHub OAuth is not configured for this domain")
-		return
-	}
+// errOAuthTimeout is returned when an OAuth provider does not answer in time.
+var errOAuthTimeout = errors.New("OAuth provider timed out")
 
-	entry := &store.OAuthStateEntry{Purpose: "login"}
-	if desktopRedirect := r.URL.Query().Get("redirect_uri"); desktopRedirect != "" {
-		if isLocalhostURI(desktopRedirect) {
-			entry.DesktopRedirect = desktopRedirect
-		}
-	}
-
-	state, err := s.oauthStore.CreateState(entry)
-	if err != nil {
-		s.respondError(w, http.StatusInternalServerError, "failed to create OAuth state")
-		return
+// newOAuthClient returns the HTTP client used for all OAuth provider calls.
+func newOAuthClient(timeout time.Duration) *http.Client {
+	if timeout <= 0 {
+		timeout = defaultOAuthTimeout
 	}
-
-	params := url.Values{}
-	params.Set("client_id", creds.ClientID)
-	params.Set("redirect_uri", s.buildRedirectURI(r))
-	params.Set("scope", "read:user,user:email")
-	params.Set("state", state)
-
-	http.Redirect(w, r, githubAuthorizeURL+"?"+params.Encode(), http.StatusTemporaryRedirect)
+	return &http.Client{Timeout: timeout}
 }
 
-// handleGitHubLink initiates the GitHub OAuth account linking flow (authenticated).
-func (s *Server) handleGitHubLink(w http.ResponseWriter, r *http.Request) {
-	creds := s.cfg.OAuth.GitHub.GetCredentials(r.Host)
-	if creds == nil {
-		s.respondError(w, http.StatusNotImplemented, "GitHub OAuth is not configured for this domain")
-		return
-	}
-
-	user := auth.GetUserFromContext(r.Context())
-	if user == nil {
-		s.respondError(w, http.StatusUnauthorized, "authentication required")
-		return
-	}
-
-	state, err := s.oauthStore.CreateState(&store.OAuthStateEntry{
-		Purpose: "link",
-		UserID:  user.ID,
-	})
+// doOAuthRequest sends a request to an OAuth provider, reporting timeouts as
+// errOAuthTimeout so callers can tell a stalled provider from a rejection.
+func doOAuthRequest(client *http.Client, req *http.Request) (*http.Response, error) {
+	resp, err := client.Do(req)
 	if err != nil {
-		s.respondError(w, http.StatusInternalServerError, "failed to create OAuth state")
-		return
-	}
-
-	params := url.Values{}
-	params.Set("client_id", creds.ClientID)
-	params.Set("redirect_uri", s.buildRedirectURI(r))
-	params.Set("scope", "read:user,user:email")
-	params.Set("state", state)
-
-	oauthURL := githubAuthorizeURL + "?" + params.Encode()
-	s.respondJSON(w, http.StatusOK, map[string]string{"url": oauthURL})
-}
-
-// handleGitHubCallback handles the GitHub OAuth callback.
-func (s *Server) handleGitHubCallback(w http.ResponseWriter, r *http.Request) {
-	code := r.URL.Query().Get("code")
-	stateParam := r.URL.Query().Get("state")
-
-	if code == "" {
-		s.redirectWithError(w, r, "missing authorization code", "")
-		return
-	}
-
-	// Validate CSRF state
-	stateEntry := s.oauthStore.ConsumeState(stateParam)
-	if stateEntry == nil {
-		s.redirectWithError(w, r, "invalid or expired OAuth state", "")
-		return
-	}
-
-	// Get credentials for this domain
-	creds := s.cfg.OAuth.GitHub.GetCredentials(r.Host)
-	if creds == nil {
-		s.redirectWithError(w, r, "GitHub OAuth is not configured for this domain", stateEntry.DesktopRedirect)
-		return
-	}
-
-	// Exchange code for access token
-	ghToken, err := s.exchangeGitHubCode(code, s.buildRedirectURI(r), creds)
-	if err != nil {
-		s.log.Error().Err(err).Msg("GitHub code exchange failed")
-		s.redirectWithError(w, r, "failed to exchange authorization code", stateEntry.DesktopRedirect)
-		return
-	}
-
-	// Get GitHub user info
-	ghUser, err := s.getGitHubUser(ghToken)
-	if err != nil {
-		s.log.Error().Err(err).Msg("GitHub user info request failed")
-		s.redirectWithError(w, r, "failed to get GitHub user info", stateEntry.DesktopRedirect)
-		return
-	}
-
-	// Account linking flow
-	if stateEntry.Purpose == "link" {
-		s.handleGitHubLinkCallback(w, r, stateEntry.UserID, ghUser)
-		return
-	}
-
-	// Login / register flow
-	displayName := ghUser.Name
-	if displayName == "" {
-		displayName = ghUser.Login
-	}
-
-	info := &auth.OAuthUserInfo{
-		GitHubID:    ghUser.ID,
-		Email:       ghUser.Email,
-		DisplayName: displayName,
-		AvatarURL:   ghUser.AvatarURL,
-	}
-
-	userAgent := r.UserAgent()
-	ipAddress := r.RemoteAddr
-
-	user, tokenPair, isNew, err := s.authService.RegisterOrLoginOAuth(info, userAgent, ipAddress)
-	if err != nil {
-		s.log.Error().Err(err).Msg("OAuth register/login failed")
-		s.redirectWithError(w, r, "authentication failed", stateEntry.DesktopRedirect)
-		return
-	}
-
-	if isNew && s.telegramNotifier != nil {
-		s.telegramNotifier.NotifyNewUser(user.ID, user.DisplayName, user.Email)
-	}
-
-	s.redirectWithTokens(w, r, tokenPair, stateEntry.DesktopRedirect)
-}
-
-// handleGitHubLinkCallback processes the GitHub account linking after OAuth callback.
-func (s *Server) handleGitHubLinkCallback(w http.ResponseWriter, r *http.Request, userID int64, ghUser *githubUser) {
-	// Check if another user already has this GitHub ID
-	existingUser, err := s.db.Users.GetByGitHubID(ghUser.ID)
-	if err == nil && existingUser.ID != userID {
-		// This GitHub account is linked to a different user — refuse to proceed
-		s.log.Warn().Int64("user_id", userID).Int64("existing_user_id", existingUser.ID).Int64("github_id", ghUser.ID).Msg("GitHub account already linked to another user")
-		s.redirectWithError(w, r, "this GitHub account is already linked to another user", "")
-		return
-	}
-
-	// If already linked to the same user, just redirect success
-	if err == nil && existingUser.ID == userID {
-		http.Redirect(w, r, "/profile?github_linked=true", http.StatusTemporaryRedirect)
-		return
-	}
-
-	// Link the GitHub account to the current user
-	if err := s.authService.LinkGitHub(userID, ghUser.ID, ghUser.Email, ghUser.AvatarURL); err != nil {
-		s.log.Error().Err(err).Int64("user_id", userID).Msg("GitHub account linking failed")
-		s.redirectWithError(w, r, "failed to link GitHub account", "")
-		return
+		if errors.Is(err, context.DeadlineExceeded) || os.IsTimeout(err) {
+			return nil, fmt.Errorf("%w after %s: %s %s", errOAuthTimeout, client.Timeout, req.Method, req.URL.Host)
+		}
+		return nil, fmt.Errorf("send request: %w", err)
 	}
-
-	http.Redirect(w, r, "/profile?github_linked=true", http.StatusTemporaryRedirect)
+	return resp, nil
 }
 
-// exchangeGitHubCode exchanges an authorization code for an access token.
-func (s *Server) exchangeGitHubCode(code, redirectURI string, creds *config.GitHubDomainCredentials) (string, error) {
-	data := url.Values{}
-	data.Set("client_id", creds.ClientID)
-	data.Set("client_secret", creds.ClientSecret)
-	data.Set("code", code)
-	data.Set("redirect_uri", redirectURI)
-
-	req, err := http.NewRequest("POST", githubTokenURL, strings.NewReader(data.Encode()))
-	if err != nil {
-		return "", fmt.Errorf("create request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("Accept", "application/json")
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("send request: %w", err)
-	}
-	defer func() { _ = resp.Body.Close() }()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("read response: %w", err)
+// oauthErrorMessage returns the user-facing message for a failed provider call.
+func oauthErrorMessage(err error, fallback string) string {
+	if errors.Is(err, errOAuthTimeout) {
+		return "authorization provider did not respond, please try again"
 	}
-
-	var tokenResp githubTokenResponse
-	if err := json.Unmarshal(body, &tokenResp); err != nil {
-		return "", fmt.Errorf("decode response: %w", err)
-	}
-
-	if tokenResp.AccessToken == "" {
-		return "", fmt.Errorf("empty access token in response")
-	}
-
-	return tokenResp.AccessToken, nil
+	return fallback
 }
 
-// getGitHubUser fetches the authenticated user's info from GitHub.
-// If the user has a private email, it falls back to /user/emails endpoint.
-func (s *Server) getGitHubUser(accessToken string) (*githubUser, error) {
-	req, err := http.NewRequest("GET", githubUserURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
-	}
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	req.Header.Set("Accept", "application/json")
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("send request: %w", err)
-	}
-	defer func() { _ = resp.Body.Close() }()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
-	}
+// handleOAuthLogin returns the handler that starts the login flow with p.
+func (s *Server) handleOAuthLogin(p OAuthProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !p.Configured(r.Host) {
+			s.respondError(w, http.StatusNotImplemented, p.Title()+" OAuth is not configured for this domain")
+			return
+		}
 
-	var user githubUser
-	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
-		return nil, fmt.Errorf("decode response: %w", err)
-	}
+		entry := &store.OAuthStateEntry{Purpose: oauthPurposeLogin}
+		if desktopRedirect := r.URL.Query().Get("redirect_uri"); desktopRedirect != "" {
+			if isLocalhostURI(desktopRedirect) {
+				entry.DesktopRedirect = desktopRedirect
+			}
+		}
 
-	if user.Email == "" {
-		email, err := s.getGitHubPrimaryEmail(accessToken)
+		state, err := s.oauthStore.CreateState(entry)
 		if err != nil {
-			s.log.Warn().Err(err).Int64("github_id", user.ID).Msg("failed to fetch GitHub primary email")
-		} else {
-			user.Email = email
+			s.respondError(w, http.StatusInternalServerError, "failed to create OAuth state")
+			return
 		}
-	}
-
-	return &user, nil
-}
 
-// getGitHubPrimaryEmail fetches the primary verified email from /user/emails.
-func (s *Server) getGitHubPrimaryEmail(accessToken string) (string, error) {
-	req, err := http.NewRequest("GET", githubUserEmailsURL, nil)
-	if err != nil {
-		return "", fmt.Errorf("create request: %w", err)
-	}
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	req.Header.Set("Accept", "application/json")
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("send request: %w", err)
-	}
-	defer func() { _ = resp.Body.Close() }()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("unexpected status %d", resp.StatusCode)
-	}
-
-	var emails []githubUserEmail
-	if err := json.NewDecoder(resp.Body).Decode(&emails); err != nil {
-		return "", fmt.Errorf("decode response: %w", err)
+		http.Redirect(w, r, p.AuthorizeURL(r.Host, oauthRedirectURI(r, p), state), http.StatusTemporaryRedirect)
 	}
+}
 
-	// Prefer primary+verified, then any verified, then any email
-	var verified, fallback string
-	for _, e := range emails {
-		if e.Primary && e.Verified {
-			return e.Email, nil
+// handleOAuthLink returns the handler that starts linking an account at p
+// to the authenticated user.
+func (s *Server) handleOAuthLink(p OAuthProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !p.Configured(r.Host) {
+			s.respondError(w, http.StatusNotImplemented, p.Title()+" OAuth is not configured for this domain")
+			return
 		}
-		if e.Verified && verified == "" {
-			verified = e.Email
+
+		user := auth.GetUserFromContext(r.Context())
+		if user == nil {
+			s.respondError(w, http.StatusUnauthorized, "authentication required")
+			return
 		}
-		if fallback == "" {
-			fallback = e.Email
+
+		state, err := s.oauthStore.CreateState(&store.OAuthStateEntry{
+			Purpose: oauthPurposeLink,
+			UserID:  user.ID,
+		})
+		if err != nil {
+			s.respondError(w, http.StatusInternalServerError, "failed to create OAuth state")
+			return
 		}
-	}
 
-	if verified != "" {
-		return verified, nil
-	}
-	if fallback != "" {
-		return fallback, nil
+		s.respondJSON(w, http.StatusOK, map[string]string{"url": p.AuthorizeURL(r.Host, oauthRedirectURI(r, p), state)})
 	}
-
-	return "", fmt.Errorf("no emails found")
 }
 
-const (
-	googleAuthorizeURL = "https://accounts.google.com/o/oauth2/v2/auth"
-	googleTokenURL     = "https://oauth2.googleapis.com/token"        //nolint:gosec // not a credential, this is Google's OAuth endpoint URL
-	googleUserInfoURL  = "https://www.googleapis.com/oauth2/v2/userinfo"
-)
-
-type googleTokenResponse struct {
-	AccessToken string `json:"access_token"`
-	TokenType   string `json:"token_type"`
-}
+// handleOAuthCallback returns the handler for p's OAuth callback, which
+// finishes both the login and the linking flow.
+func (s *Server) handleOAuthCallback(p OAuthProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		code := r.URL.Query().Get("code")
+		stateParam := r.URL.Query().Get("state")
 
-type googleUser struct {
-	ID      string `json:"id"`
-	Email   string `json:"email"`
-	Name    string `json:"name"`
-	Picture string `json:"picture"`
-}
+		if code == "" {
+			s.redirectWithError(w, r, "missing authorization code", "")
+			return
+		}
 
-// handleGoogleAuth initiates the Google OAuth login flow.
-func (s *Server) handleGoogleAuth(w http.ResponseWriter, r *http.Request) {
-	clientID := s.cfg.OAuth.Google.ClientID
-	if clientID == "" {
-		s.respondError(w, http.StatusNotImplemented, "Google OAuth is not configured")
-		return
-	}
+		// Validate CSRF state
+		stateEntry := s.oauthStore.ConsumeState(stateParam)
+		if stateEntry == nil {
+			s.redirectWithError(w, r, "invalid or expired OAuth state", "")
+			return
+		}
 
-	entry := &store.OAuthStateEntry{Purpose: "login"}
-	if desktopRedirect := r.URL.Query().Get("redirect_uri"); desktopRedirect != "" {
-		if isLocalhostURI(desktopRedirect) {
-			entry.DesktopRedirect = desktopRedirect
+		if !p.Configured(r.Host) {
+			s.redirectWithError(w, r, p.Title()+" OAuth is not configured for this domain", stateEntry.DesktopRedirect)
+			return
 		}
-	}
 
-	state, err := s.oauthStore.CreateState(entry)
-	if err != nil {
-		s.respondError(w, http.StatusInternalServerError, "failed to create OAuth state")
-		return
-	}
+		// Exchange code for access token
+		token, err := p.ExchangeCode(r.Context(), r.Host, code, oauthRedirectURI(r, p))
+		if err != nil {
+			s.log.Error().Err(err).Str("provider", p.Name()).Msg("OAuth code exchange failed")
+			s.redirectWithError(w, r, oauthErrorMessage(err, "failed to exchange authorization code"), stateEntry.DesktopRedirect)
+			return
+		}
 
-	params := url.Values{}
-	params.Set("client_id", clientID)
-	params.Set("redirect_uri", s.buildGoogleRedirectURI(r))
-	params.Set("response_type", "code")
-	params.Set("scope", "openid email profile")
-	params.Set("state", state)
+		info, err := p.FetchUser(r.Context(), token)
+		if err != nil {
+			s.log.Error().Err(err).Str("provider", p.Name()).Msg("OAuth user info request failed")
+			s.redirectWithError(w, r, oauthErrorMessage(err, "failed to get "+p.Title()+" user info"), stateEntry.DesktopRedirect)
+			return
+		}
 
-	http.Redirect(w, r, googleAuthorizeURL+"?"+params.Encode(), http.StatusTemporaryRedirect)
-}
+		// Account linking flow
+		if stateEntry.Purpose == oauthPurposeLink {
+			s.handleOAuthLinkCallback(w, r, p, stateEntry.UserID, info)
+			return
+		}
 
-// handleGoogleLink initiates the Google OAuth account linking flow (authenticated).
-func (s *Server) handleGoogleLink(w http.ResponseWriter, r *http.Request) {
-	clientID := s.cfg.OAuth.Google.ClientID
-	if clientID == "" {
-		s.respondError(w, http.StatusNotImplemented, "Google OAuth is not configured")
-		return
-	}
+		// Login / register flow
+		user, tokenPair, isNew, err := s.authService.RegisterOrLoginOAuth(info, r.UserAgent(), r.RemoteAddr)
+		if err != nil {
+			s.log.Error().Err(err).Str("provider", p.Name()).Msg("OAuth register/login failed")
+			s.redirectWithError(w, r, "authentication failed", stateEntry.DesktopRedirect)
+			return
+		}
 
-	user := auth.GetUserFromContext(r.Context())
-	if user == nil {
-		s.respondError(w, http.StatusUnauthorized, "authentication required")
-		return
-	}
+		if isNew && s.telegramNotifier != nil {
+			s.telegramNotifier.NotifyNewUser(user.ID, user.DisplayName, user.Email)
+		}
 
-	state, err := s.oauthStore.CreateState(&store.OAuthStateEntry{
-		Purpose: "link",
-		UserID:  user.ID,
-	})
-	if err != nil {
-		s.respondError(w, http.StatusInternalServerError, "failed to create OAuth state")
-		return
+		s.redirectWithTokens(w, r, tokenPair, stateEntry.DesktopRedirect)
 	}
-
-	params := url.Values{}
-	params.Set("client_id", clientID)
-	params.Set("redirect_uri", s.buildGoogleRedirectURI(r))
-	params.Set("response_type", "code")
-	params.Set("scope", "openid email profile")
-	params.Set("state", state)
-
-	oauthURL := googleAuthorizeURL + "?" + params.Encode()
-	s.respondJSON(w, http.StatusOK, map[string]string{"url": oauthURL})
 }
 
-// handleGoogleCallback handles the Google OAuth callback.
-func (s *Server) handleGoogleCallback(w http.ResponseWriter, r *http.Request) {
-	code := r.URL.Query().Get("code")
-	stateParam := r.URL.Query().Get("state")
+// handleOAuthLinkCallback links the account at p to the user after the OAuth
+// callback. An account linked to another user is refused, never merged.
+func (s *Server) handleOAuthLinkCallback(w http.ResponseWriter, r *http.Request, p OAuthProvider, userID int64, info *auth.OAuthUserInfo) {
+	linkedURL := "/profile?" + p.Name() + "_linked=true"
 
-	if code == "" {
-		s.redirectWithError(w, r, "missing authorization code", "")
-		return
-	}
-
-	// Validate CSRF state
-	stateEntry := s.oauthStore.ConsumeState(stateParam)
-	if stateEntry == nil {
-		s.redirectWithError(w, r, "invalid or expired OAuth state", "")
-		return
-	}
-
-	// Exchange code for access token
-	gToken, err := s.exchangeGoogleCode(code, s.buildGoogleRedirectURI(r))
-	if err != nil {
-		s.log.Error().Err(err).Msg("Google code exchange failed")
-		s.redirectWithError(w, r, "failed to exchange authorization code", stateEntry.DesktopRedirect)
-		return
-	}
-
-	// Get Google user info
-	gUser, err := s.getGoogleUser(gToken)
-	if err != nil {
-		s.log.Error().Err(err).Msg("Google user info request failed")
-		s.redirectWithError(w, r, "failed to get Google user info", stateEntry.DesktopRedirect)
-		return
-	}
-
-	// Account linking flow
-	if stateEntry.Purpose == "link" {
-		s.handleGoogleLinkCallback(w, r, stateEntry.UserID, gUser)
-		return
-	}
-
-	// Login / register flow
-	info := &auth.GoogleOAuthUserInfo{
-		GoogleID:    gUser.ID,
-		Email:       gUser.Email,
-		DisplayName: gUser.Name,
-		AvatarURL:   gUser.Picture,
-	}
-
-	userAgent := r.UserAgent()
-	ipAddress := r.RemoteAddr
-
-	user, tokenPair, isNew, err := s.authService.RegisterOrLoginGoogleOAuth(info, userAgent, ipAddress)
-	if err != nil {
-		s.log.Error().Err(err).Msg("Google OAuth register/login failed")
-		s.redirectWithError(w, r, "authentication failed", stateEntry.DesktopRedirect)
-		return
-	}
-
-	if isNew && s.telegramNotifier != nil {
-		s.telegramNotifier.NotifyNewUser(user.ID, user.DisplayName, user.Email)
-	}
-
-	s.redirectWithTokens(w, r, tokenPair, stateEntry.DesktopRedirect)
-}
-
-// handleGoogleLinkCallback processes the Google account linking after OAuth callback.
-func (s *Server) handleGoogleLinkCallback(w http.ResponseWriter, r *http.Request, userID int64, gUser *googleUser) {
-	// Check if another user already has this Google ID
-	existingUser, err := s.db.Users.GetByGoogleID(gUser.ID)
+	// Check if another user already has this provider account
+	existingUser, err := s.authService.GetUserByOAuth(info)
 	if err == nil && existingUser.ID != userID {
-		// This Google account is linked to a different user — refuse to proceed
-		s.log.Warn().Int64("user_id", userID).Int64("existing_user_id", existingUser.ID).Str("google_id", gUser.ID).Msg("Google account already linked to another user")
-		s.redirectWithError(w, r, "this Google account is already linked to another user", "")
+		// Linked to a different user — refuse to proceed
+		s.log.Warn().Int64("user_id", userID).Int64("existing_user_id", existingUser.ID).Str("provider", p.Name()).Str("provider_id", info.ID).Msg("OAuth account already linked to another user")
+		s.redirectWithError(w, r, "this "+p.Title()+" account is already linked to another user", "")
 		return
 	}
 
 	// If already linked to the same user, just redirect success
 	if err == nil && existingUser.ID == userID {
-		http.Redirect(w, r, "/profile?google_linked=true", http.StatusTemporaryRedirect)
+		http.Redirect(w, r, linkedURL, http.StatusTemporaryRedirect)
 		return
 	}
 
-	// Link the Google account to the current user
-	if err := s.authService.LinkGoogle(userID, gUser.ID, gUser.Email, gUser.Picture); err != nil {
-		s.log.Error().Err(err).Int64("user_id", userID).Msg("Google account linking failed")
-		s.redirectWithError(w, r, "failed to link Google account", "")
+	if err := s.authService.LinkOAuth(userID, info); err != nil {
+		s.log.Error().Err(err).Int64("user_id", userID).Str("provider", p.Name()).Msg("OAuth account linking failed")
+		s.redirectWithError(w, r, "failed to link "+p.Title()+" account", "")
 		return
 	}
 
-	http.Redirect(w, r, "/profile?google_linked=true", http.StatusTemporaryRedirect)
+	http.Redirect(w, r, linkedURL, http.StatusTemporaryRedirect)
 }
 
 // handleOAuthExchange exchanges a one-time authorization code for tokens.
@@ -553,80 +242,9 @@ func (s *Server) redirectWithTokens(w http.ResponseWriter, r *http.Request, toke
 	http.Redirect(w, r, "/auth/callback?"+params.Encode(), http.StatusTemporaryRedirect)
 }
 
-// exchangeGoogleCode exchanges an authorization code for an access token.
-func (s *Server) exchangeGoogleCode(code, redirectURI string) (string, error) {
-	data := url.Values{}
-	data.Set("client_id", s.cfg.OAuth.Google.ClientID)
-	data.Set("client_secret", s.cfg.OAuth.Google.ClientSecret)
-	data.Set("code", code)
-	data.Set("redirect_uri", redirectURI)
-	data.Set("grant_type", "authorization_code")
-
-	req, err := http.NewRequest("POST", googleTokenURL, strings.NewReader(data.Encode()))
-	if err != nil {
-		return "", fmt.Errorf("create request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("Accept", "application/json")
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("send request: %w", err)
-	}
-	defer func() { _ = resp.Body.Close() }()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("read response: %w", err)
-	}
-
-	var tokenResp googleTokenResponse
-	if err := json.Unmarshal(body, &tokenResp); err != nil {
-		return "", fmt.Errorf("decode response: %w", err)
-	}
-
-	if tokenResp.AccessToken == "" {
-		return "", fmt.Errorf("empty access token in response")
-	}
-
-	return tokenResp.AccessToken, nil
-}
-
-// getGoogleUser fetches the authenticated user's info from Google.
-func (s *Server) getGoogleUser(accessToken string) (*googleUser, error) {
-	req, err := http.NewRequest("GET", googleUserInfoURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
-	}
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	req.Header.Set("Accept", "application/json")
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("send request: %w", err)
-	}
-	defer func() { _ = resp.Body.Close() }()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
-	}
-
-	var user googleUser
-	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
-		return nil, fmt.Errorf("decode response: %w", err)
-	}
-
-	return &user, nil
-}
-
-// buildGoogleRedirectURI constructs the Google OAuth callback URL from the request host.
-func (s *Server) buildGoogleRedirectURI(r *http.Request) string {
-	return fmt.Sprintf("https://%s/api/auth/google/callback", requestHost(r))
-}
-
-// buildRedirectURI constructs the OAuth callback URL from the request host.
-func (s *Server) buildRedirectURI(r *http.Request) string {
-	return fmt.Sprintf("https://%s/api/auth/github/callback", requestHost(r))
+// oauthRedirectURI constructs p's OAuth callback URL from the request host.
+func oauthRedirectURI(r *http.Request, p OAuthProvider) string {
+	return fmt.Sprintf("https://%s/api/auth/%s/callback", requestHost(r), p.Name())
 }
 
 // requestHost extracts the domain (without port) from the request.
@@ -1,10 +1,18 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
 
+	"github.com/rs/zerolog"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+	"github.com/mephistofox/fxtun.dev/internal/server/auth"
 	"github.com/mephistofox/fxtun.dev/internal/server/database"
 )
 
@@ -16,7 +24,7 @@ func TestGitHubLinkCallback_ConflictWhenLinkedToAnotherUser(t *testing.T) {
 	user2 := env.createTestUser(t, "+2222222222", "password2", "User Two")
 
 	// Link GitHub ID 12345 to user2
-	if err := env.AuthService.LinkGitHub(user2.User.ID, 12345, "user2@github.com", ""); err != nil {
+	if err := env.AuthService.LinkOAuth(user2.User.ID, &auth.OAuthUserInfo{Provider: auth.OAuthGitHub, ID: "12345", Email: "user2@github.com"}); err != nil {
 		t.Fatalf("failed to link github to user2: %v", err)
 	}
 
@@ -24,13 +32,13 @@ func TestGitHubLinkCallback_ConflictWhenLinkedToAnotherUser(t *testing.T) {
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest("GET", "/api/auth/github/callback", nil)
 
-	ghUser := &githubUser{
-		ID:    12345,
-		Login: "testuser",
-		Email: "user2@github.com",
+	ghUser := &auth.OAuthUserInfo{
+		Provider: auth.OAuthGitHub,
+		ID:       "12345",
+		Email:    "user2@github.com",
 	}
 
-	env.APIServer.handleGitHubLinkCallback(w, r, user1.User.ID, ghUser)
+	env.APIServer.handleOAuthLinkCallback(w, r, testOAuthProvider(t, env.APIServer, auth.OAuthGitHub), user1.User.ID, ghUser)
 
 	resp := w.Result()
 	defer resp.Body.Close()
@@ -59,7 +67,7 @@ func TestGitHubLinkCallback_SuccessWhenLinkedToSameUser(t *testing.T) {
 	user1 := env.createTestUser(t, "+1111111111", "password1", "User One")
 
 	// Link GitHub ID 12345 to user1
-	if err := env.AuthService.LinkGitHub(user1.User.ID, 12345, "user1@github.com", ""); err != nil {
+	if err := env.AuthService.LinkOAuth(user1.User.ID, &auth.OAuthUserInfo{Provider: auth.OAuthGitHub, ID: "12345", Email: "user1@github.com"}); err != nil {
 		t.Fatalf("failed to link github to user1: %v", err)
 	}
 
@@ -67,13 +75,13 @@ func TestGitHubLinkCallback_SuccessWhenLinkedToSameUser(t *testing.T) {
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest("GET", "/api/auth/github/callback", nil)
 
-	ghUser := &githubUser{
-		ID:    12345,
-		Login: "testuser",
-		Email: "user1@github.com",
+	ghUser := &auth.OAuthUserInfo{
+		Provider: auth.OAuthGitHub,
+		ID:       "12345",
+		Email:    "user1@github.com",
 	}
 
-	env.APIServer.handleGitHubLinkCallback(w, r, user1.User.ID, ghUser)
+	env.APIServer.handleOAuthLinkCallback(w, r, testOAuthProvider(t, env.APIServer, auth.OAuthGitHub), user1.User.ID, ghUser)
 
 	resp := w.Result()
 	defer resp.Body.Close()
@@ -104,13 +112,13 @@ func TestGitHubLinkCallback_SuccessNewLink(t *testing.T) {
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest("GET", "/api/auth/github/callback", nil)
 
-	ghUser := &githubUser{
-		ID:    99999,
-		Login: "newuser",
-		Email: "new@github.com",
+	ghUser := &auth.OAuthUserInfo{
+		Provider: auth.OAuthGitHub,
+		ID:       "99999",
+		Email:    "new@github.com",
 	}
 
-	env.APIServer.handleGitHubLinkCallback(w, r, user1.User.ID, ghUser)
+	env.APIServer.handleOAuthLinkCallback(w, r, testOAuthProvider(t, env.APIServer, auth.OAuthGitHub), user1.User.ID, ghUser)
 
 	resp := w.Result()
 	defer resp.Body.Close()
@@ -148,7 +156,7 @@ func TestGoogleLinkCallback_ConflictWhenLinkedToAnotherUser(t *testing.T) {
 	user2 := env.createTestUser(t, "+4444444444", "password2", "User Two")
 
 	// Link Google ID "google-123" to user2
-	if err := env.AuthService.LinkGoogle(user2.User.ID, "google-123", "user2@google.com", ""); err != nil {
+	if err := env.AuthService.LinkOAuth(user2.User.ID, &auth.OAuthUserInfo{Provider: auth.OAuthGoogle, ID: "google-123", Email: "user2@google.com"}); err != nil {
 		t.Fatalf("failed to link google to user2: %v", err)
 	}
 
@@ -156,13 +164,14 @@ func TestGoogleLinkCallback_ConflictWhenLinkedToAnotherUser(t *testing.T) {
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest("GET", "/api/auth/google/callback", nil)
 
-	gUser := &googleUser{
-		ID:    "google-123",
-		Email: "user2@google.com",
-		Name:  "Test User",
+	gUser := &auth.OAuthUserInfo{
+		Provider:    auth.OAuthGoogle,
+		ID:          "google-123",
+		Email:       "user2@google.com",
+		DisplayName: "Test User",
 	}
 
-	env.APIServer.handleGoogleLinkCallback(w, r, user1.User.ID, gUser)
+	env.APIServer.handleOAuthLinkCallback(w, r, testOAuthProvider(t, env.APIServer, auth.OAuthGoogle), user1.User.ID, gUser)
 
 	resp := w.Result()
 	defer resp.Body.Close()
@@ -191,7 +200,7 @@ func TestGoogleLinkCallback_SuccessWhenLinkedToSameUser(t *testing.T) {
 	user1 := env.createTestUser(t, "+3333333333", "password1", "User One")
 
 	// Link Google ID "google-456" to user1
-	if err := env.AuthService.LinkGoogle(user1.User.ID, "google-456", "user1@google.com", ""); err != nil {
+	if err := env.AuthService.LinkOAuth(user1.User.ID, &auth.OAuthUserInfo{Provider: auth.OAuthGoogle, ID: "google-456", Email: "user1@google.com"}); err != nil {
 		t.Fatalf("failed to link google to user1: %v", err)
 	}
 
@@ -199,13 +208,14 @@ func TestGoogleLinkCallback_SuccessWhenLinkedToSameUser(t *testing.T) {
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest("GET", "/api/auth/google/callback", nil)
 
-	gUser := &googleUser{
-		ID:    "google-456",
-		Email: "user1@google.com",
-		Name:  "User One",
+	gUser := &auth.OAuthUserInfo{
+		Provider:    auth.OAuthGoogle,
+		ID:          "google-456",
+		Email:       "user1@google.com",
+		DisplayName: "User One",
 	}
 
-	env.APIServer.handleGoogleLinkCallback(w, r, user1.User.ID, gUser)
+	env.APIServer.handleOAuthLinkCallback(w, r, testOAuthProvider(t, env.APIServer, auth.OAuthGoogle), user1.User.ID, gUser)
 
 	resp := w.Result()
 	defer resp.Body.Close()
@@ -236,13 +246,14 @@ func TestGoogleLinkCallback_SuccessNewLink(t *testing.T) {
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest("GET", "/api/auth/google/callback", nil)
 
-	gUser := &googleUser{
-		ID:    "google-new-789",
-		Email: "new@google.com",
-		Name:  "New User",
+	gUser := &auth.OAuthUserInfo{
+		Provider:    auth.OAuthGoogle,
+		ID:          "google-new-789",
+		Email:       "new@google.com",
+		DisplayName: "New User",
 	}
 
-	env.APIServer.handleGoogleLinkCallback(w, r, user1.User.ID, gUser)
+	env.APIServer.handleOAuthLinkCallback(w, r, testOAuthProvider(t, env.APIServer, auth.OAuthGoogle), user1.User.ID, gUser)
 
 	resp := w.Result()
 	defer resp.Body.Close()
@@ -273,6 +284,46 @@ func TestGoogleLinkCallback_SuccessNewLink(t *testing.T) {
 	}
 }
 
+func TestGitLabLinkCallback(t *testing.T) {
+	env := setupTestEnv(t)
+
+	user1 := env.createTestUser(t, "+7777777777", "password1", "User One")
+	user2 := env.createTestUser(t, "+8888888888", "password2", "User Two")
+	gitlab := testOAuthProvider(t, env.APIServer, auth.OAuthGitLab)
+
+	// Link a brand new GitLab account to user1
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/api/auth/gitlab/callback", nil)
+	glUser := &auth.OAuthUserInfo{Provider: auth.OAuthGitLab, ID: "4242", Email: "user1@gitlab.com"}
+	env.APIServer.handleOAuthLinkCallback(w, r, gitlab, user1.User.ID, glUser)
+
+	loc, err := w.Result().Location()
+	if err != nil {
+		t.Fatalf("expected Location header: %v", err)
+	}
+	if loc.Query().Get("gitlab_linked") != "true" {
+		t.Fatalf("expected gitlab_linked=true in redirect URL, got %s", loc)
+	}
+	linkedUser, err := env.DB.Users.GetByGitLabID(4242)
+	if err != nil {
+		t.Fatalf("expected to find user by gitlab ID: %v", err)
+	}
+	if linkedUser.ID != user1.User.ID {
+		t.Fatalf("expected gitlab ID linked to user %d, got %d", user1.User.ID, linkedUser.ID)
+	}
+
+	// The same account cannot be linked to user2
+	w = httptest.NewRecorder()
+	env.APIServer.handleOAuthLinkCallback(w, r, gitlab, user2.User.ID, glUser)
+	loc, err = w.Result().Location()
+	if err != nil {
+		t.Fatalf("expected Location header: %v", err)
+	}
+	if errMsg := loc.Query().Get("error"); errMsg != "this GitLab account is already linked to another user" {
+		t.Fatalf("unexpected error message: %q", errMsg)
+	}
+}
+
 // TestGitHubLinkCallback_NoMergeOccurs verifies that the auto-merge vulnerability is fixed:
 // when a GitHub ID is linked to another user, no data is transferred between accounts.
 func TestGitHubLinkCallback_NoMergeOccurs(t *testing.T) {
@@ -294,7 +345,7 @@ func TestGitHubLinkCallback_NoMergeOccurs(t *testing.T) {
 	}
 
 	// Link GitHub ID to user2
-	if err := env.AuthService.LinkGitHub(user2.User.ID, 77777, "user2@github.com", ""); err != nil {
+	if err := env.AuthService.LinkOAuth(user2.User.ID, &auth.OAuthUserInfo{Provider: auth.OAuthGitHub, ID: "77777", Email: "user2@github.com"}); err != nil {
 		t.Fatalf("failed to link github to user2: %v", err)
 	}
 
@@ -302,8 +353,8 @@ func TestGitHubLinkCallback_NoMergeOccurs(t *testing.T) {
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest("GET", "/api/auth/github/callback", nil)
 
-	ghUser := &githubUser{ID: 77777, Login: "testuser", Email: "user2@github.com"}
-	env.APIServer.handleGitHubLinkCallback(w, r, user1.User.ID, ghUser)
+	ghUser := &auth.OAuthUserInfo{Provider: auth.OAuthGitHub, ID: "77777", Email: "user2@github.com"}
+	env.APIServer.handleOAuthLinkCallback(w, r, testOAuthProvider(t, env.APIServer, auth.OAuthGitHub), user1.User.ID, ghUser)
 
 	// Verify user2's token was NOT transferred to user1
 	user1Tokens, err := env.DB.Tokens.GetByUserID(user1.User.ID)
@@ -324,3 +375,173 @@ func TestGitHubLinkCallback_NoMergeOccurs(t *testing.T) {
 	}
 }
 
+// testOAuthProvider returns the server's provider with the given name.
+func testOAuthProvider(t *testing.T, s *Server, name string) OAuthProvider {
+	t.Helper()
+	for _, p := range s.oauthProviders {
+		if p.Name() == name {
+			return p
+		}
+	}
+	t.Fatalf("no %s OAuth provider", name)
+	return nil
+}
+
+// rewriteTransport sends every request to target, keeping path and query, so
+// provider calls can be pointed at a local test server.
+type rewriteTransport struct {
+	target *url.URL
+}
+
+func (rt rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = rt.target.Scheme
+	req.URL.Host = rt.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestGitHubExchangeCode_StalledProviderTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer provider.Close()
+	defer close(release)
+
+	target, _ := url.Parse(provider.URL)
+	client := newOAuthClient(100 * time.Millisecond)
+	client.Transport = rewriteTransport{target: target}
+	gh := &githubProvider{
+		cfg: &config.GitHubOAuthSettings{Domains: []config.GitHubDomainCredentials{
+			{Domain: "example.com", ClientID: "id", ClientSecret: "secret"},
+		}},
+		client: client,
+		log:    zerolog.Nop(),
+	}
+
+	start := time.Now()
+	_, err := gh.ExchangeCode(context.Background(), "example.com", "code", "https://example.com/cb")
+	if !errors.Is(err, errOAuthTimeout) {
+		t.Fatalf("expected errOAuthTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("exchange took %s, expected to fail fast", elapsed)
+	}
+	if msg := oauthErrorMessage(err, "fallback"); msg == "fallback" {
+		t.Fatalf("expected a timeout-specific message, got %q", msg)
+	}
+}
+
+func TestGoogleFetchUser_HonoursRequestContext(t *testing.T) {
+	release := make(chan struct{})
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer provider.Close()
+	defer close(release)
+
+	target, _ := url.Parse(provider.URL)
+	client := newOAuthClient(time.Minute)
+	client.Transport = rewriteTransport{target: target}
+	g := &googleProvider{cfg: &config.GoogleOAuthSettings{ClientID: "id"}, client: client}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	_, err := g.FetchUser(ctx, "token")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestGitLabProvider_SelfHosted(t *testing.T) {
+	instance := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/gitlab/oauth/token":
+			if err := r.ParseForm(); err != nil || r.PostForm.Get("code") != "code" || r.PostForm.Get("grant_type") != "authorization_code" {
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+			_, _ = w.Write([]byte(`{"access_token":"gl-token","token_type":"Bearer"}`))
+		case "/gitlab/api/v4/user":
+			if r.Header.Get("Authorization") != "Bearer gl-token" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte(`{"id":42,"username":"octo","name":"","email":"octo@example.com","avatar_url":"https://example.com/a.png","confirmed_at":"2024-01-02T03:04:05Z"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer instance.Close()
+
+	gl := &gitlabProvider{
+		cfg:    &config.GitLabOAuthSettings{BaseURL: instance.URL + "/gitlab/", ClientID: "id", ClientSecret: "secret"},
+		client: newOAuthClient(time.Second),
+	}
+
+	authURL, err := url.Parse(gl.AuthorizeURL("example.com", "https://example.com/api/auth/gitlab/callback", "state"))
+	if err != nil {
+		t.Fatalf("parse authorize URL: %v", err)
+	}
+	if authURL.Path != "/gitlab/oauth/authorize" || authURL.Query().Get("client_id") != "id" || authURL.Query().Get("state") != "state" {
+		t.Fatalf("unexpected authorize URL %s", authURL)
+	}
+
+	token, err := gl.ExchangeCode(context.Background(), "example.com", "code", "https://example.com/api/auth/gitlab/callback")
+	if err != nil {
+		t.Fatalf("exchange code: %v", err)
+	}
+	info, err := gl.FetchUser(context.Background(), token)
+	if err != nil {
+		t.Fatalf("fetch user: %v", err)
+	}
+	want := auth.OAuthUserInfo{Provider: auth.OAuthGitLab, ID: "42", Email: "octo@example.com", DisplayName: "octo", AvatarURL: "https://example.com/a.png", EmailVerified: true}
+	if *info != want {
+		t.Fatalf("got %+v, want %+v", *info, want)
+	}
+}
+
+func TestGitHubFetchUser_EmailVerified(t *testing.T) {
+	tests := []struct {
+		name     string
+		user     string
+		emails   string
+		email    string
+		verified bool
+	}{
+		{"public email", `{"id":1,"login":"octo","email":"public@example.com"}`, `[]`, "public@example.com", true},
+		{"primary verified", `{"id":1,"login":"octo"}`,
+			`[{"email":"old@example.com","primary":false,"verified":false},{"email":"main@example.com","primary":true,"verified":true}]`,
+			"main@example.com", true},
+		{"only unverified", `{"id":1,"login":"octo"}`, `[{"email":"new@example.com","primary":true,"verified":false}]`, "new@example.com", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/user":
+					_, _ = w.Write([]byte(tt.user))
+				case "/user/emails":
+					_, _ = w.Write([]byte(tt.emails))
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer provider.Close()
+
+			target, _ := url.Parse(provider.URL)
+			client := newOAuthClient(time.Second)
+			client.Transport = rewriteTransport{target: target}
+			gh := &githubProvider{client: client, log: zerolog.Nop()}
+
+			info, err := gh.FetchUser(context.Background(), "token")
+			if err != nil {
+				t.Fatalf("fetch user: %v", err)
+			}
+			if info.Email != tt.email || info.EmailVerified != tt.verified {
+				t.Fatalf("got %q verified=%v, want %q verified=%v", info.Email, info.EmailVerified, tt.email, tt.verified)
+			}
+		})
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/mephistofox/fxtun.dev/internal/logging"
 	"github.com/mephistofox/fxtun.dev/internal/server/api/dto"
 	"github.com/mephistofox/fxtun.dev/internal/server/auth"
 	"github.com/mephistofox/fxtun.dev/internal/server/database"
@@ -168,6 +169,20 @@ func (s *Server) handleCheckout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	dbUser, err := s.db.Users.GetByID(user.ID)
+	if err != nil {
+		s.log.Error().Err(err).Int64("user_id", user.ID).Msg("Failed to get user for checkout")
+		s.respondError(w, http.StatusInternalServerError, "failed to create payment")
+		return
+	}
+
+	// Paying with an unverified email invites chargebacks
+	if s.cfg.Payments.RequireVerifiedEmail && !dbUser.EmailVerified {
+		s.respondErrorWithCode(w, http.StatusForbidden, "EMAIL_NOT_VERIFIED",
+			"verify your email before checkout: confirm it from your profile or link a GitHub, Google or GitLab account with a verified email")
+		return
+	}
+
 	// Check for existing active subscription
 	existingSub, _ := s.db.Subscriptions.GetByUserID(user.ID)
 	if existingSub != nil && existingSub.Status == database.SubscriptionStatusActive {
@@ -209,13 +224,6 @@ func (s *Server) handleCheckout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get user email
-	dbUser, _ := s.db.Users.GetByID(user.ID)
-	email := ""
-	if dbUser != nil {
-		email = dbUser.Email
-	}
-
 	// Determine amount and currency based on provider
 	var amount float64
 	var currency string
@@ -256,7 +264,7 @@ func (s *Server) handleCheckout(w http.ResponseWriter, r *http.Request) {
 		PlanName:       plan.Name,
 		Amount:         amount,
 		Currency:       currency,
-		Email:          email,
+		Email:          dbUser.Email,
 		Recurring:      recurring,
 		Description:    fmt.Sprintf("fxTunnel %s subscription", plan.Name),
 	})
@@ -369,7 +377,7 @@ func (s *Server) activateSubscription(sub *database.Subscription, pmt *database.
 // handlePaymentWebhook handles YooKassa webhook notifications (POST)
 func (s *Server) handlePaymentWebhook(w http.ResponseWriter, r *http.Request) {
 	s.log.Info().
-		Str("remote_addr", r.RemoteAddr).                   // Post-RealIP = actual client IP from nginx
+		Str("remote_ip", logging.RemoteIP(r.RemoteAddr)).   // Post-RealIP = actual client IP from nginx
 		Str("original_tcp_addr", getOriginalRemoteAddr(r)). // Raw TCP = nginx 127.0.0.1
 		Str("method", r.Method).
 		Msg("YooKassa webhook received")
@@ -391,7 +399,7 @@ func (s *Server) handlePaymentWebhook(w http.ResponseWriter, r *http.Request) {
 	// cannot forge a subscription even if test mode is left on.
 	if !webhookSourceAllowed(r.RemoteAddr, s.cfg.YooKassa.TestMode) {
 		s.log.Warn().
-			Str("remote_addr", r.RemoteAddr).
+			Str("remote_ip", logging.RemoteIP(r.RemoteAddr)).
 			Str("original_tcp_addr", getOriginalRemoteAddr(r)).
 			Str("x_forwarded_for", r.Header.Get("X-Forwarded-For")).
 			Bool("test_mode", s.cfg.YooKassa.TestMode).
@@ -419,6 +427,12 @@ func (s *Server) handlePaymentWebhook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if event.Object == nil || event.Object.ID == "" {
+		s.log.Error().Str("event", event.Event).Msg("Webhook event without payment")
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
 	s.log.Info().
 		Str("type", event.Type).
 		Str("event", event.Event).
@@ -426,6 +440,30 @@ func (s *Server) handlePaymentWebhook(w http.ResponseWriter, r *http.Request) {
 		Str("status", event.Object.Status).
 		Msg("Webhook event parsed")
 
+	// YooKassa notifications carry no ID of their own; an event of a
+	// payment happens once, so the pair identifies the delivery.
+	eventID := event.Event + ":" + event.Object.ID
+	if s.db != nil {
+		claimed, err := s.db.Payments.ClaimWebhook("yookassa", eventID, event.Event)
+		if err != nil {
+			s.log.Error().Err(err).Str("event_id", eventID).Msg("Failed to record webhook")
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if !claimed {
+			s.log.Info().Str("event_id", eventID).Msg("Duplicate webhook delivery (ignored)")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		sw := &webhookStatusWriter{ResponseWriter: w}
+		defer func() {
+			if err := s.db.Payments.FinishWebhook("yookassa", eventID, sw.status); err != nil {
+				s.log.Error().Err(err).Str("event_id", eventID).Msg("Failed to record webhook result")
+			}
+		}()
+		w = sw
+	}
+
 	// Handle different event types
 	switch event.Event {
 	case "payment.succeeded":
@@ -442,6 +480,27 @@ func (s *Server) handlePaymentWebhook(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// webhookStatusWriter remembers the status a webhook is answered with, 0
+// if the handler panicked before answering.
+type webhookStatusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *webhookStatusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *webhookStatusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
 // webhookSourceAllowed reports whether a YooKassa webhook from remoteAddr may
 // be trusted. Production: only YooKassa's published IPs. Test mode: also
 // loopback/private addresses for local testing — but public sources are
@@ -1,13 +1,20 @@
 package api
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strconv"
 	"strings"
 	"testing"
 
 	"github.com/mephistofox/fxtun.dev/internal/config"
+	"github.com/mephistofox/fxtun.dev/internal/server/api/dto"
+	"github.com/mephistofox/fxtun.dev/internal/server/auth"
+	"github.com/mephistofox/fxtun.dev/internal/server/database"
+	"github.com/mephistofox/fxtun.dev/internal/server/payment"
 	"github.com/rs/zerolog"
 )
 
@@ -108,3 +115,125 @@ func TestYooKassaWebhook_DisabledReturns503(t *testing.T) {
 		t.Fatalf("expected 503 when YooKassa disabled, got %d", rr.Code)
 	}
 }
+
+// TestYooKassaWebhook_DuplicateDelivery verifies that a redelivered webhook
+// event is acknowledged without being processed again, while an event that
+// failed with a server error is processed on retry.
+func TestYooKassaWebhook_DuplicateDelivery(t *testing.T) {
+	env := setupTestEnv(t)
+	env.APIServer.cfg.YooKassa = config.YooKassaSettings{Enabled: true, TestMode: true}
+	user := env.createTestUser(t, "+79001234567", "password123", "Payer")
+
+	pmt := &database.Payment{UserID: user.User.ID, InvoiceID: 9001, Amount: 100, Status: database.PaymentStatusPending, Provider: "yookassa"}
+	if err := env.DB.Payments.Create(pmt); err != nil {
+		t.Fatalf("failed to create payment: %v", err)
+	}
+
+	deliver := func() int {
+		body := `{"type":"notification","event":"payment.canceled","object":{"id":"pay-1","status":"canceled","metadata":{"invoice_id":"9001"}}}`
+		resp, err := http.Post(env.Server.URL+"/api/payments/webhook", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("webhook request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := deliver(); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	got, _ := env.DB.Payments.GetByInvoiceID(9001)
+	if got.Status != database.PaymentStatusFailed {
+		t.Fatalf("expected the canceled payment to be failed, got %s", got.Status)
+	}
+
+	got.Status = database.PaymentStatusPending
+	if err := env.DB.Payments.Update(got); err != nil {
+		t.Fatalf("failed to reset payment: %v", err)
+	}
+	if code := deliver(); code != http.StatusOK {
+		t.Fatalf("expected 200 for a duplicate, got %d", code)
+	}
+	got, _ = env.DB.Payments.GetByInvoiceID(9001)
+	if got.Status != database.PaymentStatusPending {
+		t.Errorf("a duplicate delivery must not be processed again, payment is %s", got.Status)
+	}
+
+	claimed, err := env.DB.Payments.ClaimWebhook("yookassa", "payment.succeeded:pay-2", "payment.succeeded")
+	if err != nil || !claimed {
+		t.Fatalf("expected a new event to be claimed, got %v, %v", claimed, err)
+	}
+	if claimed, _ := env.DB.Payments.ClaimWebhook("yookassa", "payment.succeeded:pay-2", "payment.succeeded"); claimed {
+		t.Error("an event being processed must not be claimed twice")
+	}
+	if err := env.DB.Payments.FinishWebhook("yookassa", "payment.succeeded:pay-2", http.StatusInternalServerError); err != nil {
+		t.Fatalf("failed to finish webhook: %v", err)
+	}
+	if claimed, _ := env.DB.Payments.ClaimWebhook("yookassa", "payment.succeeded:pay-2", "payment.succeeded"); !claimed {
+		t.Error("an event that failed with a server error must be claimed again")
+	}
+}
+
+// checkoutTestProvider accepts every checkout without contacting anyone.
+type checkoutTestProvider struct{}
+
+func (checkoutTestProvider) Name() string { return "creem" }
+
+func (checkoutTestProvider) CreateCheckoutSession(params payment.CheckoutParams) (*payment.CheckoutResult, error) {
+	return &payment.CheckoutResult{PaymentURL: "https://pay.test/" + strconv.FormatInt(params.InvoiceID, 10)}, nil
+}
+
+func (checkoutTestProvider) HandleWebhook(*http.Request) ([]payment.WebhookEvent, error) {
+	return nil, nil
+}
+
+func (checkoutTestProvider) CancelSubscription(string) error { return nil }
+
+func TestCheckout_RequireVerifiedEmail(t *testing.T) {
+	env := setupTestEnv(t)
+	env.APIServer.cfg.Creem = config.CreemSettings{Enabled: true}
+	env.APIServer.cfg.Payments = config.PaymentsSettings{
+		Domains:              map[string]config.PaymentDomainSettings{"127.0.0.1": {Enabled: true, Provider: "creem"}},
+		RequireVerifiedEmail: true,
+	}
+	env.APIServer.paymentProviders = payment.NewRegistry()
+	env.APIServer.paymentProviders.Register(checkoutTestProvider{})
+
+	plan, err := env.DB.Plans.GetBySlug("pro")
+	if err != nil {
+		t.Fatalf("failed to get plan: %v", err)
+	}
+	checkout := func(user *testUser) (int, dto.ErrorResponse) {
+		body := fmt.Sprintf(`{"plan_id":%d}`, plan.ID)
+		req, _ := http.NewRequest(http.MethodPost, env.Server.URL+"/api/subscription/checkout", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+user.AccessToken)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("checkout request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var errResp dto.ErrorResponse
+		_ = json.NewDecoder(resp.Body).Decode(&errResp)
+		return resp.StatusCode, errResp
+	}
+
+	unverified := env.createTestUser(t, "+79001234568", "password123", "Unverified")
+	if err := env.DB.Users.UpdateEmail(unverified.User.ID, "unverified@example.com"); err != nil {
+		t.Fatalf("failed to set email: %v", err)
+	}
+	code, errResp := checkout(unverified)
+	if code != http.StatusForbidden || errResp.Code != "EMAIL_NOT_VERIFIED" {
+		t.Fatalf("expected 403 EMAIL_NOT_VERIFIED, got %d %q", code, errResp.Code)
+	}
+
+	verified := env.createTestUser(t, "+79001234569", "password123", "Verified")
+	if err := env.AuthService.LinkOAuth(verified.User.ID, &auth.OAuthUserInfo{
+		Provider: auth.OAuthGoogle, ID: "google-verified", Email: "verified@example.com", EmailVerified: true,
+	}); err != nil {
+		t.Fatalf("failed to link account: %v", err)
+	}
+	if code, errResp := checkout(verified); code != http.StatusOK {
+		t.Fatalf("expected a verified user to check out, got %d %q", code, errResp.Error)
+	}
+}
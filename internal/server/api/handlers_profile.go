@@ -3,7 +3,10 @@ package api
 import (
 	"errors"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/mephistofox/fxtun.dev/internal/i18n"
 	"github.com/mephistofox/fxtun.dev/internal/server/api/dto"
 	"github.com/mephistofox/fxtun.dev/internal/server/auth"
 	"github.com/mephistofox/fxtun.dev/internal/server/database"
@@ -72,6 +75,7 @@ func (s *Server) handleGetProfile(w http.ResponseWriter, r *http.Request) {
 		TokenCount:      tokenCount,
 		TunnelCount:     tunnelCount,
 		Plan:            planDTO,
+		Locale:          s.db.UserSettings.GetWithDefault(user.ID, i18n.UserSetting, ""),
 	})
 }
 
@@ -105,6 +109,10 @@ func (s *Server) handleUpdateProfile(w http.ResponseWriter, r *http.Request) {
 		}
 		dbUser.DisplayName = req.DisplayName
 	}
+	if req.Locale != nil && *req.Locale != "" && !i18n.Supported(*req.Locale) {
+		s.respondErrorWithCode(w, http.StatusBadRequest, "INVALID_LOCALE", "unsupported locale")
+		return
+	}
 
 	if err := s.db.Users.Update(dbUser); err != nil {
 		s.log.Error().Err(err).Msg("Failed to update user")
@@ -112,9 +120,104 @@ func (s *Server) handleUpdateProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.Locale != nil {
+		var err error
+		if *req.Locale == "" {
+			err = s.db.UserSettings.Delete(user.ID, i18n.UserSetting)
+		} else {
+			err = s.db.UserSettings.Set(user.ID, i18n.UserSetting, *req.Locale)
+		}
+		if err != nil {
+			s.log.Error().Err(err).Msg("Failed to save locale")
+			s.respondError(w, http.StatusInternalServerError, "failed to update user")
+			return
+		}
+	}
+
 	s.respondJSON(w, http.StatusOK, dto.UserFromModel(dbUser))
 }
 
+// emailVerificationTTL is how long the link in a verification email works.
+const emailVerificationTTL = 24 * time.Hour
+
+// handleSendEmailVerification mails a verification link to the requested
+// address. The address travels in the link's token and only becomes the
+// user's email once the link is opened, so nobody can claim an address
+// they do not receive mail at.
+func (s *Server) handleSendEmailVerification(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		s.respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	if s.notifier == nil {
+		s.respondError(w, http.StatusServiceUnavailable, "email verification is not available")
+		return
+	}
+
+	var req dto.SendEmailVerificationRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+	address := strings.ToLower(strings.TrimSpace(req.Email))
+
+	dbUser, err := s.db.Users.GetByID(user.ID)
+	if err != nil {
+		s.log.Error().Err(err).Msg("Failed to get user")
+		s.respondError(w, http.StatusInternalServerError, "failed to get user")
+		return
+	}
+
+	if strings.EqualFold(dbUser.Email, address) && dbUser.EmailVerified {
+		s.respondError(w, http.StatusBadRequest, "email already verified")
+		return
+	}
+	if other, err := s.db.Users.GetByEmail(address); err == nil && other.ID != user.ID {
+		s.respondError(w, http.StatusConflict, "email already in use")
+		return
+	}
+
+	token, err := s.authService.GetJWTManager().GenerateEmailVerifyToken(user.ID, address, emailVerificationTTL)
+	if err != nil {
+		s.log.Error().Err(err).Msg("Failed to generate email verification token")
+		s.respondError(w, http.StatusInternalServerError, "failed to send verification email")
+		return
+	}
+	if err := s.notifier.SendEmailVerification(user.ID, address, token); err != nil {
+		s.log.Error().Err(err).Int64("user_id", user.ID).Msg("Failed to send verification email")
+		s.respondError(w, http.StatusInternalServerError, "failed to send verification email")
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, dto.SuccessResponse{
+		Success: true,
+		Message: "verification email sent",
+	})
+}
+
+// handleVerifyEmail makes the address in the link of a verification email
+// the user's verified email and redirects to the profile, telling it
+// whether that worked. It fails when another user has taken the address
+// since the link was sent.
+func (s *Server) handleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	claims, err := s.authService.GetJWTManager().ValidateEmailVerifyToken(r.URL.Query().Get("token"))
+	if err != nil {
+		http.Redirect(w, r, "/profile?email_verified=false", http.StatusTemporaryRedirect)
+		return
+	}
+
+	verified, err := s.db.Users.VerifyEmail(claims.UserID, claims.Email)
+	if err != nil && !errors.Is(err, database.ErrUserAlreadyExists) {
+		s.log.Error().Err(err).Int64("user_id", claims.UserID).Msg("Failed to verify email")
+	}
+	if !verified {
+		http.Redirect(w, r, "/profile?email_verified=false", http.StatusTemporaryRedirect)
+		return
+	}
+
+	http.Redirect(w, r, "/profile?email_verified=true", http.StatusTemporaryRedirect)
+}
+
 // handleChangePassword changes the current user's password
 func (s *Server) handleChangePassword(w http.ResponseWriter, r *http.Request) {
 	user := auth.GetUserFromContext(r.Context())
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSendEmailVerification_Unavailable(t *testing.T) {
+	env := setupTestEnv(t)
+	user := env.createTestUser(t, "+79001234570", "password123", "NoSMTP")
+
+	req, _ := http.NewRequest(http.MethodPost, env.Server.URL+"/api/profile/email", strings.NewReader(`{"email":"user@example.com"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+user.AccessToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 without an email service, got %d", resp.StatusCode)
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	env := setupTestEnv(t)
+	user := env.createTestUser(t, "+79001234571", "password123", "Password Only")
+	other := env.createTestUser(t, "+79001234572", "password123", "Other")
+	if err := env.DB.Users.UpdateEmail(other.User.ID, "taken@example.com"); err != nil {
+		t.Fatalf("failed to set email: %v", err)
+	}
+	jwt := env.AuthService.GetJWTManager()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	verify := func(token string) string {
+		t.Helper()
+		resp, err := client.Get(env.Server.URL + "/api/auth/verify-email?token=" + token)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.Header.Get("Location")
+	}
+	current := func() (string, bool) {
+		t.Helper()
+		u, err := env.DB.Users.GetByID(user.User.ID)
+		if err != nil {
+			t.Fatalf("failed to get user: %v", err)
+		}
+		return u.Email, u.EmailVerified
+	}
+
+	taken, err := jwt.GenerateEmailVerifyToken(user.User.ID, "taken@example.com", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc := verify(taken); loc != "/profile?email_verified=false" {
+		t.Fatalf("an address another user has must not verify, got %q", loc)
+	}
+	if email, verified := current(); email != "" || verified {
+		t.Fatalf("email changed to %q (verified %v)", email, verified)
+	}
+	if loc := verify("garbage"); loc != "/profile?email_verified=false" {
+		t.Fatalf("expected failure redirect for an invalid token, got %q", loc)
+	}
+
+	token, err := jwt.GenerateEmailVerifyToken(user.User.ID, "user@example.com", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc := verify(token); loc != "/profile?email_verified=true" {
+		t.Fatalf("expected the email to be verified, got %q", loc)
+	}
+	if email, verified := current(); email != "user@example.com" || !verified {
+		t.Fatalf("expected user@example.com verified, got %q (verified %v)", email, verified)
+	}
+}
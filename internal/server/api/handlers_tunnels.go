@@ -1,7 +1,11 @@
 package api
 
 import (
+	"errors"
 	"net/http"
+	"sort"
+	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/mephistofox/fxtun.dev/internal/server/api/dto"
@@ -25,27 +29,18 @@ func (s *Server) handleListTunnels(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tunnels := s.tunnelProvider.GetTunnelsByUserID(user.ID)
+	query, err := parseTunnelListQuery(r)
+	if err != nil {
+		s.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	now := time.Now()
+	tunnels := query.apply(s.tunnelProvider.GetTunnelsByUserID(user.ID), now)
 
 	tunnelDTOs := make([]*dto.TunnelDTO, len(tunnels))
 	for i, t := range tunnels {
-		tunnelDTO := &dto.TunnelDTO{
-			ID:         t.ID,
-			Type:       t.Type,
-			Name:       t.Name,
-			Subdomain:  t.Subdomain,
-			RemotePort: t.RemotePort,
-			LocalPort:  t.LocalPort,
-			ClientID:   t.ClientID,
-			CreatedAt:  t.CreatedAt,
-		}
-
-		// Generate URL for HTTP tunnels
-		if t.Type == "http" && t.Subdomain != "" {
-			tunnelDTO.URL = "https://" + t.Subdomain + "." + s.baseDomain
-		}
-
-		tunnelDTOs[i] = tunnelDTO
+		tunnelDTOs[i] = s.tunnelToDTO(t, now)
 	}
 
 	s.respondJSON(w, http.StatusOK, dto.TunnelsListResponse{
@@ -54,6 +49,119 @@ func (s *Server) handleListTunnels(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// tunnelToDTO converts a user's tunnel for API responses, with its idle
+// time as of now.
+func (s *Server) tunnelToDTO(t TunnelInfo, now time.Time) *dto.TunnelDTO {
+	tunnelDTO := &dto.TunnelDTO{
+		ID:           t.ID,
+		Type:         t.Type,
+		Name:         t.Name,
+		Subdomain:    t.Subdomain,
+		RemotePort:   t.RemotePort,
+		LocalPort:    t.LocalPort,
+		ClientID:     t.ClientID,
+		CreatedAt:    t.CreatedAt,
+		Health:       tunnelHealthToDTO(t.Health),
+		LastActivity: tunnelLastActivity(t),
+		IdleSeconds:  int64(tunnelIdle(t, now) / time.Second),
+	}
+
+	// Generate URL for HTTP tunnels
+	if t.Type == "http" && t.Subdomain != "" {
+		tunnelDTO.URL = "https://" + t.Subdomain + "." + s.baseDomain
+	}
+
+	return tunnelDTO
+}
+
+// tunnelLastActivity returns when traffic last went through t, falling back
+// to its creation time.
+func tunnelLastActivity(t TunnelInfo) time.Time {
+	if t.LastActivity.IsZero() {
+		return t.CreatedAt
+	}
+	return t.LastActivity
+}
+
+// tunnelIdle returns how long t has gone without traffic at now.
+func tunnelIdle(t TunnelInfo, now time.Time) time.Duration {
+	if idle := now.Sub(tunnelLastActivity(t)); idle > 0 {
+		return idle
+	}
+	return 0
+}
+
+// tunnelListQuery narrows and orders a tunnel listing. The zero value keeps
+// the listing as it is.
+type tunnelListQuery struct {
+	minIdle time.Duration
+	sortBy  string // "", "created_at" or "idle"
+	desc    bool
+}
+
+// parseTunnelListQuery reads the min_idle (seconds), sort_by (created_at or
+// idle) and order (asc or desc) query parameters. Sorting by idle time puts
+// the longest idle tunnel first unless order=asc.
+func parseTunnelListQuery(r *http.Request) (tunnelListQuery, error) {
+	q := r.URL.Query()
+	var lq tunnelListQuery
+
+	if v := q.Get("min_idle"); v != "" {
+		secs, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || secs < 0 {
+			return lq, errors.New("invalid min_idle")
+		}
+		lq.minIdle = time.Duration(secs) * time.Second
+	}
+
+	switch lq.sortBy = q.Get("sort_by"); lq.sortBy {
+	case "", "created_at":
+	case "idle":
+		lq.desc = true
+	default:
+		return lq, errors.New("invalid sort_by")
+	}
+
+	switch q.Get("order") {
+	case "":
+	case "asc":
+		lq.desc = false
+	case "desc":
+		lq.desc = true
+	default:
+		return lq, errors.New("invalid order")
+	}
+	return lq, nil
+}
+
+// apply returns the tunnels idle for at least minIdle at now, sorted as
+// requested. The input slice is left untouched.
+func (q tunnelListQuery) apply(tunnels []TunnelInfo, now time.Time) []TunnelInfo {
+	out := make([]TunnelInfo, 0, len(tunnels))
+	for _, t := range tunnels {
+		if tunnelIdle(t, now) >= q.minIdle {
+			out = append(out, t)
+		}
+	}
+
+	var less func(a, b TunnelInfo) bool
+	switch q.sortBy {
+	case "idle":
+		less = func(a, b TunnelInfo) bool { return tunnelIdle(a, now) < tunnelIdle(b, now) }
+	case "created_at":
+		less = func(a, b TunnelInfo) bool { return a.CreatedAt.Before(b.CreatedAt) }
+	default:
+		return out
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if q.desc {
+			return less(out[j], out[i])
+		}
+		return less(out[i], out[j])
+	})
+	return out
+}
+
 // handleCloseTunnel closes a tunnel
 func (s *Server) handleCloseTunnel(w http.ResponseWriter, r *http.Request) {
 	user := auth.GetUserFromContext(r.Context())
@@ -90,3 +198,61 @@ func (s *Server) handleCloseTunnel(w http.ResponseWriter, r *http.Request) {
 		Message: "tunnel closed successfully",
 	})
 }
+
+// handleTunnelHealth returns a tunnel's health check state and recent history
+func (s *Server) handleTunnelHealth(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		s.respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	tunnelID := chi.URLParam(r, "id")
+	if tunnelID == "" {
+		s.respondError(w, http.StatusBadRequest, "tunnel id is required")
+		return
+	}
+
+	if s.tunnelProvider == nil {
+		s.respondError(w, http.StatusNotFound, "tunnel not found")
+		return
+	}
+
+	health := s.tunnelProvider.GetTunnelHealth(tunnelID, user.ID)
+	if health == nil {
+		s.respondError(w, http.StatusNotFound, "tunnel not found or has no health check")
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, tunnelHealthToDTO(health))
+}
+
+func tunnelHealthToDTO(h *TunnelHealth) *dto.TunnelHealthDTO {
+	if h == nil {
+		return nil
+	}
+
+	out := &dto.TunnelHealthDTO{
+		Check:           h.Check,
+		IntervalSeconds: int(h.Interval.Seconds()),
+		Status:          h.Status,
+	}
+	if h.Last != nil {
+		t := h.Last.Time
+		out.LastCheckedAt = &t
+		out.LatencyMs = h.Last.LatencyMs
+		out.Error = h.Last.Error
+	}
+	if len(h.History) > 0 {
+		out.History = make([]dto.HealthSampleDTO, len(h.History))
+		for i, sample := range h.History {
+			out.History[i] = dto.HealthSampleDTO{
+				Time:      sample.Time,
+				Status:    sample.Status,
+				LatencyMs: sample.LatencyMs,
+				Error:     sample.Error,
+			}
+		}
+	}
+	return out
+}
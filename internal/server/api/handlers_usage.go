@@ -0,0 +1,42 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/mephistofox/fxtun.dev/internal/server/api/dto"
+	"github.com/mephistofox/fxtun.dev/internal/server/auth"
+	"github.com/mephistofox/fxtun.dev/internal/server/database"
+)
+
+// handleGetUsage returns the user's tunnel traffic for the current month
+// alongside the plan's monthly cap. Admins are never capped.
+func (s *Server) handleGetUsage(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		s.respondError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var usage MonthlyUsage
+	if s.tunnelProvider != nil {
+		var err error
+		usage, err = s.tunnelProvider.GetMonthlyUsage(user.ID)
+		if err != nil {
+			s.log.Error().Err(err).Int64("user_id", user.ID).Msg("Failed to get monthly usage")
+			s.respondError(w, http.StatusInternalServerError, "failed to get usage")
+			return
+		}
+	}
+
+	resp := dto.UsageDTO{
+		Period:     database.UsagePeriod(time.Now()).Format("2006-01"),
+		BytesIn:    usage.BytesIn,
+		BytesOut:   usage.BytesOut,
+		BytesTotal: usage.BytesIn + usage.BytesOut,
+	}
+	if user.Plan != nil && !user.IsAdmin {
+		resp.LimitBytes = user.Plan.MonthlyBytes
+	}
+	s.respondJSON(w, http.StatusOK, resp)
+}
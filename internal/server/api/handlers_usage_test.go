@@ -0,0 +1,71 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mephistofox/fxtun.dev/internal/server/api/dto"
+	"github.com/mephistofox/fxtun.dev/internal/server/auth"
+	"github.com/mephistofox/fxtun.dev/internal/server/database"
+)
+
+func usageRequest(user *auth.AuthenticatedUser) *http.Request {
+	req := httptest.NewRequest("GET", "/api/usage", nil)
+	return req.WithContext(context.WithValue(req.Context(), auth.UserContextKey, user))
+}
+
+func TestHandleGetUsage(t *testing.T) {
+	provider := newMockTunnelProvider()
+	provider.usage = map[int64]MonthlyUsage{7: {BytesIn: 1000, BytesOut: 500}}
+	s := &Server{tunnelProvider: provider, log: zerolog.Nop()}
+
+	tests := []struct {
+		name  string
+		user  *auth.AuthenticatedUser
+		limit int64
+	}{
+		{"Capped", &auth.AuthenticatedUser{ID: 7, Plan: &database.Plan{MonthlyBytes: 4096}}, 4096},
+		{"Unlimited plan", &auth.AuthenticatedUser{ID: 7, Plan: &database.Plan{}}, 0},
+		{"Admin", &auth.AuthenticatedUser{ID: 7, IsAdmin: true, Plan: &database.Plan{MonthlyBytes: 4096}}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			s.handleGetUsage(w, usageRequest(tt.user))
+			require.Equal(t, http.StatusOK, w.Code)
+
+			var got dto.UsageDTO
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+			assert.Equal(t, dto.UsageDTO{
+				Period:     database.UsagePeriod(time.Now()).Format("2006-01"),
+				BytesIn:    1000,
+				BytesOut:   500,
+				BytesTotal: 1500,
+				LimitBytes: tt.limit,
+			}, got)
+		})
+	}
+}
+
+func TestHandleGetUsage_Errors(t *testing.T) {
+	provider := newMockTunnelProvider()
+	provider.usageErr = errors.New("db down")
+	s := &Server{tunnelProvider: provider, log: zerolog.Nop()}
+
+	w := httptest.NewRecorder()
+	s.handleGetUsage(w, httptest.NewRequest("GET", "/api/usage", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	s.handleGetUsage(w, usageRequest(&auth.AuthenticatedUser{ID: 7}))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"net/http"
+	"strings"
 )
 
 // VersionResponse represents the version endpoint response
@@ -10,6 +11,7 @@ type VersionResponse struct {
 	ClientVersion string            `json:"client_version"`
 	MinVersion    string            `json:"min_version"`
 	Downloads     map[string]string `json:"downloads"`
+	Checksums     map[string]string `json:"checksums,omitempty"` // hex SHA-256 keyed like Downloads
 }
 
 func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
@@ -21,10 +23,21 @@ func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
 		"windows_amd64": "/api/downloads/cli-windows-amd64",
 	}
 
+	// Checksums let the updater verify the binary it downloads; platforms
+	// without a binary in the downloads directory are simply omitted.
+	found, _, _ := s.scanDownloads()
+	checksums := make(map[string]string)
+	for key := range downloads {
+		if info, ok := found["cli-"+strings.Replace(key, "_", "-", 1)]; ok {
+			checksums[key] = info.SHA256
+		}
+	}
+
 	s.respondJSON(w, http.StatusOK, VersionResponse{
 		ServerVersion: s.version,
-		ClientVersion: s.version,
+		ClientVersion: s.loadDownloadsManifest().version(s.version),
 		MinVersion:    s.minVersion,
 		Downloads:     downloads,
+		Checksums:     checksums,
 	})
 }
@@ -42,6 +42,22 @@ function Main {
         exit 1
     }
 
+    # Verify checksum
+    try {
+        $Expected = ((Invoke-WebRequest -Uri "$DownloadURL.sha256" -UseBasicParsing).Content -split '\s+')[0]
+    } catch {
+        Remove-Item -Force $TempFile
+        Write-Host "  Error: could not fetch checksum - $_" -ForegroundColor Red
+        exit 1
+    }
+    $Actual = (Get-FileHash -Algorithm SHA256 $TempFile).Hash.ToLower()
+    if ($Actual -ne $Expected.ToLower()) {
+        Remove-Item -Force $TempFile
+        Write-Host "  Error: checksum mismatch (expected $Expected, got $Actual)" -ForegroundColor Red
+        exit 1
+    }
+    Write-Host "  Checksum verified." -ForegroundColor Green
+
     # Install
     Write-Host "  Installing to $InstallDir..." -ForegroundColor White
     Move-Item -Force $TempFile $Target
@@ -5,6 +5,14 @@ BINARY_NAME="fxtunnel"
 INSTALL_DIR="$HOME/.local/bin"
 BASE_URL="${FXTUNNEL_BASE_URL:-{{.BaseURL}}}"
 WEBSITE_URL="${FXTUNNEL_WEBSITE_URL:-{{.WebsiteURL}}}"
+# Hex ed25519 release signing key. The key this server embeds comes from the
+# same host as the binary, so it cannot catch a compromised server; pin the
+# key published with the releases in FXTUNNEL_PUBLIC_KEY to guard against that.
+# Empty when neither is set.
+PUBLIC_KEY="${FXTUNNEL_PUBLIC_KEY:-{{.PublicKey}}}"
+# Signature checks need OpenSSL 3 (LibreSSL, as shipped with macOS, cannot
+# verify ed25519 here); point FXTUNNEL_OPENSSL at one if it is not first in PATH.
+OPENSSL="${FXTUNNEL_OPENSSL:-openssl}"
 
 main() {
     detect_os
@@ -32,6 +40,8 @@ main() {
     TARGET="${TMP_DIR}/${BINARY_NAME}"
 
     download "$DOWNLOAD_URL" "$TARGET"
+    verify_checksum "${DOWNLOAD_URL}.sha256" "$TARGET"
+    verify_signature "${DOWNLOAD_URL}.sig" "$TARGET"
 
     chmod +x "$TARGET"
 
@@ -106,6 +116,98 @@ download() {
     fi
 }
 
+verify_checksum() {
+    sum_url="$1"
+    file="$2"
+
+    if command -v sha256sum >/dev/null 2>&1; then
+        ACTUAL=$(sha256sum "$file" | cut -d' ' -f1)
+    elif command -v shasum >/dev/null 2>&1; then
+        ACTUAL=$(shasum -a 256 "$file" | cut -d' ' -f1)
+    else
+        echo "Warning: sha256sum/shasum not found, skipping checksum verification" >&2
+        return
+    fi
+
+    if [ "$DOWNLOADER" = "curl" ]; then
+        EXPECTED=$(curl -fsSL "$sum_url" | cut -d' ' -f1)
+    else
+        EXPECTED=$(wget -qO- "$sum_url" | cut -d' ' -f1)
+    fi
+
+    if [ -z "$EXPECTED" ]; then
+        echo "Error: could not fetch checksum from ${sum_url}" >&2
+        exit 1
+    fi
+    if [ "$ACTUAL" != "$EXPECTED" ]; then
+        echo "Error: checksum mismatch (expected ${EXPECTED}, got ${ACTUAL})" >&2
+        exit 1
+    fi
+    echo "Checksum verified."
+}
+
+verify_signature() {
+    sig_url="$1"
+    file="$2"
+
+    if [ -z "$PUBLIC_KEY" ]; then
+        return
+    fi
+    if ! command -v "$OPENSSL" >/dev/null 2>&1; then
+        echo "Error: openssl is required to verify the release signature" >&2
+        exit 1
+    fi
+    OPENSSL_VERSION=$("$OPENSSL" version 2>/dev/null || true)
+    case "$OPENSSL_VERSION" in
+        "OpenSSL "[3-9].*|"OpenSSL "[1-9][0-9].*) ;;
+        *)
+            echo "Error: verifying the release signature needs OpenSSL 3 or newer, found '${OPENSSL_VERSION:-unknown}'" >&2
+            echo "Install it (on macOS: brew install openssl@3) and set FXTUNNEL_OPENSSL to its openssl binary" >&2
+            exit 1
+            ;;
+    esac
+    if [ ${#PUBLIC_KEY} -ne 64 ] || [ -n "$(printf '%s' "$PUBLIC_KEY" | tr -d '0-9a-fA-F')" ]; then
+        echo "Error: FXTUNNEL_PUBLIC_KEY must be a hex ed25519 public key (64 characters)" >&2
+        exit 1
+    fi
+    if [ -z "$FXTUNNEL_PUBLIC_KEY" ]; then
+        echo "Note: verifying with the signing key served by ${BASE_URL%/api/downloads}; set FXTUNNEL_PUBLIC_KEY to pin it"
+    fi
+
+    if [ "$DOWNLOADER" = "curl" ]; then
+        SIG_HEX=$(curl -fsSL "$sig_url")
+    else
+        SIG_HEX=$(wget -qO- "$sig_url")
+    fi
+    if [ -z "$SIG_HEX" ]; then
+        echo "Error: could not fetch signature from ${sig_url}" >&2
+        exit 1
+    fi
+
+    # Wrap the raw key in an ed25519 SubjectPublicKeyInfo so openssl can load it.
+    {
+        echo "-----BEGIN PUBLIC KEY-----"
+        echo "302a300506032b6570032100${PUBLIC_KEY}" | hex_to_bin | base64
+        echo "-----END PUBLIC KEY-----"
+    } > "${TMP_DIR}/release.pub"
+    echo "$SIG_HEX" | hex_to_bin > "${TMP_DIR}/release.sig"
+
+    if ! "$OPENSSL" pkeyutl -verify -pubin -inkey "${TMP_DIR}/release.pub" -rawin \
+        -in "$file" -sigfile "${TMP_DIR}/release.sig" >/dev/null 2>&1; then
+        echo "Error: release signature verification failed" >&2
+        exit 1
+    fi
+    echo "Signature verified."
+}
+
+hex_to_bin() {
+    LC_ALL=C awk '{
+        h = "0123456789abcdef"; s = tolower($0)
+        for (i = 1; i < length(s); i += 2)
+            printf "%c", (index(h, substr(s, i, 1)) - 1) * 16 + index(h, substr(s, i + 1, 1)) - 1
+    }'
+}
+
 ensure_path() {
     case ":$PATH:" in
         *":$INSTALL_DIR:"*) return ;;
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/mephistofox/fxtun.dev/internal/i18n"
+	"github.com/mephistofox/fxtun.dev/internal/server/auth"
+)
+
+// localeWriter carries what an error message is translated by: the
+// request's Accept-Language and, once it is authenticated, its user, whose
+// own locale setting wins. The setting is only looked up when an error is
+// written.
+type localeWriter struct {
+	http.ResponseWriter
+	accept string // locale matched from Accept-Language, empty if none
+	userID int64
+}
+
+func (w *localeWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *localeWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// localeMiddleware lets respondError translate messages for the request.
+// It has to be the last middleware that wraps the ResponseWriter.
+func localeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&localeWriter{ResponseWriter: w, accept: i18n.Match(r.Header.Get("Accept-Language"))}, r)
+	})
+}
+
+// userLocaleMiddleware records the authenticated user of the request, so
+// their locale setting applies to its errors. It goes after the auth
+// middleware.
+func userLocaleMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if lw, ok := w.(*localeWriter); ok {
+			if user := auth.GetUserFromContext(r.Context()); user != nil {
+				lw.userID = user.ID
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// localize translates message into the locale of the request w answers.
+func (s *Server) localize(w http.ResponseWriter, message string) string {
+	lw, ok := w.(*localeWriter)
+	if !ok {
+		return message
+	}
+	locale := lw.accept
+	if lw.userID > 0 && s.db != nil {
+		if l, err := s.db.UserSettings.Get(lw.userID, i18n.UserSetting); err == nil && i18n.Supported(l) {
+			locale = l
+		}
+	}
+	return i18n.Translate(locale, message)
+}
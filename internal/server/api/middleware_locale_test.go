@@ -0,0 +1,48 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/mephistofox/fxtun.dev/internal/server/api/dto"
+)
+
+func TestLocaleMiddleware_TranslatesErrors(t *testing.T) {
+	s := &Server{log: zerolog.Nop()}
+	h := localeMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(http.Flusher); !ok {
+			t.Error("the locale writer must keep streaming responses working")
+		}
+		s.respondErrorWithCode(w, http.StatusUnauthorized, "UNAUTHORIZED", r.URL.Query().Get("msg"))
+	}))
+
+	tests := []struct {
+		acceptLanguage, msg, want string
+	}{
+		{"", "unauthorized", "unauthorized"},
+		{"ru-RU,ru;q=0.9,en;q=0.8", "unauthorized", "требуется авторизация"},
+		{"de-DE", "unauthorized", "unauthorized"},
+		{"ru", "not in the catalog", "not in the catalog"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/?msg="+url.QueryEscape(tt.msg), nil)
+		if tt.acceptLanguage != "" {
+			req.Header.Set("Accept-Language", tt.acceptLanguage)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		var resp dto.ErrorResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if resp.Error != tt.want || resp.Code != "UNAUTHORIZED" {
+			t.Errorf("Accept-Language %q: expected %q, got %q (%s)", tt.acceptLanguage, tt.want, resp.Error, resp.Code)
+		}
+	}
+}
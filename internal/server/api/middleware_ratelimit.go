@@ -2,6 +2,7 @@ package api
 
 import (
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
@@ -17,6 +18,14 @@ var _ store.RateChecker = (*ipRateLimiter)(nil)
 // TOTP brute-force beyond the broader auth-group rate limit.
 const loginAttemptsPerMin = 8
 
+// domainReservationsPerMin caps subdomain reservations per user, so nobody
+// can sweep through names by reserving and releasing them in a loop.
+const domainReservationsPerMin = 5
+
+// emailVerificationsPerMin caps verification emails per user, so the
+// endpoint cannot be used to flood an inbox.
+const emailVerificationsPerMin = 2
+
 type limiterEntry struct {
 	limiter  *rate.Limiter
 	lastSeen time.Time
@@ -103,3 +112,20 @@ func rateLimitMiddleware(rl store.RateChecker) func(http.Handler) http.Handler {
 		})
 	}
 }
+
+// userRateLimitMiddleware limits requests per authenticated user rather than
+// per IP. It must run after the auth middleware; requests without a user are
+// passed through.
+func userRateLimitMiddleware(rl store.RateChecker) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if user := auth.GetUserFromContext(r.Context()); user != nil {
+				if !rl.Allow("user:" + strconv.FormatInt(user.ID, 10)) {
+					http.Error(w, `{"error":"rate limit exceeded"}`, http.StatusTooManyRequests)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,348 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+	"github.com/mephistofox/fxtun.dev/internal/server/auth"
+)
+
+// OAuthProvider is an identity provider users can sign in with and link to
+// their account. The login, link and callback flows are shared; a provider
+// only knows its endpoints and how to read its user profile.
+type OAuthProvider interface {
+	// Name identifies the provider in routes and redirects (one of the
+	// auth.OAuth* names).
+	Name() string
+	// Title is the provider name shown to users.
+	Title() string
+	// Configured reports whether the provider has credentials for host.
+	Configured(host string) bool
+	// AuthorizeURL returns the provider's consent page URL.
+	AuthorizeURL(host, redirectURI, state string) string
+	// ExchangeCode trades an authorization code for an access token.
+	ExchangeCode(ctx context.Context, host, code, redirectURI string) (string, error)
+	// FetchUser returns the profile the access token belongs to.
+	FetchUser(ctx context.Context, accessToken string) (*auth.OAuthUserInfo, error)
+}
+
+// newOAuthProviders returns the supported providers, configured or not, in
+// the order they are offered to users.
+func newOAuthProviders(cfg *config.OAuthSettings, client *http.Client, log zerolog.Logger) []OAuthProvider {
+	return []OAuthProvider{
+		&githubProvider{cfg: &cfg.GitHub, client: client, log: log},
+		&googleProvider{cfg: &cfg.Google, client: client},
+		&gitlabProvider{cfg: &cfg.GitLab, client: client},
+	}
+}
+
+type oauthTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+}
+
+// exchangeOAuthCode posts an authorization code grant to tokenURL and
+// returns the access token.
+func exchangeOAuthCode(ctx context.Context, client *http.Client, tokenURL, clientID, clientSecret, code, redirectURI string) (string, error) {
+	data := url.Values{}
+	data.Set("client_id", clientID)
+	data.Set("client_secret", clientSecret)
+	data.Set("code", code)
+	data.Set("redirect_uri", redirectURI)
+	data.Set("grant_type", "authorization_code")
+
+	req, err := http.NewRequestWithContext(ctx, "POST", tokenURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := doOAuthRequest(client, req)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var tokenResp oauthTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return "", fmt.Errorf("decode response: %w", err)
+	}
+
+	if tokenResp.AccessToken == "" {
+		return "", fmt.Errorf("empty access token in response")
+	}
+
+	return tokenResp.AccessToken, nil
+}
+
+// fetchOAuthJSON gets an API resource with the access token and decodes it
+// into v.
+func fetchOAuthJSON(ctx context.Context, client *http.Client, apiURL, accessToken string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := doOAuthRequest(client, req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
+const (
+	githubAuthorizeURL  = "https://github.com/login/oauth/authorize"
+	githubTokenURL      = "https://github.com/login/oauth/access_token" //nolint:gosec // not a credential, this is GitHub's OAuth endpoint URL
+	githubUserURL       = "https://api.github.com/user"
+	githubUserEmailsURL = "https://api.github.com/user/emails"
+)
+
+type githubUser struct {
+	ID        int64  `json:"id"`
+	Login     string `json:"login"`
+	Email     string `json:"email"`
+	Name      string `json:"name"`
+	AvatarURL string `json:"avatar_url"`
+}
+
+type githubUserEmail struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+// githubProvider signs users in with GitHub. Each domain has its own OAuth
+// app, since GitHub allows a single callback URL per app.
+type githubProvider struct {
+	cfg    *config.GitHubOAuthSettings
+	client *http.Client
+	log    zerolog.Logger
+}
+
+func (p *githubProvider) Name() string  { return auth.OAuthGitHub }
+func (p *githubProvider) Title() string { return "GitHub" }
+
+func (p *githubProvider) Configured(host string) bool {
+	return p.cfg.GetCredentials(host) != nil
+}
+
+func (p *githubProvider) AuthorizeURL(host, redirectURI, state string) string {
+	params := url.Values{}
+	if creds := p.cfg.GetCredentials(host); creds != nil {
+		params.Set("client_id", creds.ClientID)
+	}
+	params.Set("redirect_uri", redirectURI)
+	params.Set("scope", "read:user,user:email")
+	params.Set("state", state)
+	return githubAuthorizeURL + "?" + params.Encode()
+}
+
+func (p *githubProvider) ExchangeCode(ctx context.Context, host, code, redirectURI string) (string, error) {
+	creds := p.cfg.GetCredentials(host)
+	if creds == nil {
+		return "", fmt.Errorf("no GitHub credentials for %s", host)
+	}
+	return exchangeOAuthCode(ctx, p.client, githubTokenURL, creds.ClientID, creds.ClientSecret, code, redirectURI)
+}
+
+// FetchUser fetches the authenticated user's info from GitHub. If the user
+// has a private email, it falls back to the /user/emails endpoint.
+func (p *githubProvider) FetchUser(ctx context.Context, accessToken string) (*auth.OAuthUserInfo, error) {
+	var user githubUser
+	if err := fetchOAuthJSON(ctx, p.client, githubUserURL, accessToken, &user); err != nil {
+		return nil, err
+	}
+
+	// GitHub only lets users show a verified address on their profile
+	verified := user.Email != ""
+	if user.Email == "" {
+		email, err := p.primaryEmail(ctx, accessToken)
+		if err != nil {
+			p.log.Warn().Err(err).Int64("github_id", user.ID).Msg("failed to fetch GitHub primary email")
+		} else {
+			user.Email, verified = email.Email, email.Verified
+		}
+	}
+
+	displayName := user.Name
+	if displayName == "" {
+		displayName = user.Login
+	}
+	return &auth.OAuthUserInfo{
+		Provider:      auth.OAuthGitHub,
+		ID:            strconv.FormatInt(user.ID, 10),
+		Email:         user.Email,
+		DisplayName:   displayName,
+		AvatarURL:     user.AvatarURL,
+		EmailVerified: verified,
+	}, nil
+}
+
+// primaryEmail fetches the primary verified email from /user/emails.
+func (p *githubProvider) primaryEmail(ctx context.Context, accessToken string) (githubUserEmail, error) {
+	var emails []githubUserEmail
+	if err := fetchOAuthJSON(ctx, p.client, githubUserEmailsURL, accessToken, &emails); err != nil {
+		return githubUserEmail{}, err
+	}
+
+	// Prefer primary+verified, then any verified, then any email
+	var verified, fallback *githubUserEmail
+	for i, e := range emails {
+		if e.Primary && e.Verified {
+			return e, nil
+		}
+		if e.Verified && verified == nil {
+			verified = &emails[i]
+		}
+		if fallback == nil {
+			fallback = &emails[i]
+		}
+	}
+
+	if verified != nil {
+		return *verified, nil
+	}
+	if fallback != nil {
+		return *fallback, nil
+	}
+
+	return githubUserEmail{}, fmt.Errorf("no emails found")
+}
+
+const (
+	googleAuthorizeURL = "https://accounts.google.com/o/oauth2/v2/auth"
+	googleTokenURL     = "https://oauth2.googleapis.com/token" //nolint:gosec // not a credential, this is Google's OAuth endpoint URL
+	googleUserInfoURL  = "https://www.googleapis.com/oauth2/v2/userinfo"
+)
+
+type googleUser struct {
+	ID            string `json:"id"`
+	Email         string `json:"email"`
+	VerifiedEmail bool   `json:"verified_email"`
+	Name          string `json:"name"`
+	Picture       string `json:"picture"`
+}
+
+// googleProvider signs users in with Google (single app for all domains).
+type googleProvider struct {
+	cfg    *config.GoogleOAuthSettings
+	client *http.Client
+}
+
+func (p *googleProvider) Name() string  { return auth.OAuthGoogle }
+func (p *googleProvider) Title() string { return "Google" }
+
+func (p *googleProvider) Configured(string) bool {
+	return p.cfg.ClientID != ""
+}
+
+func (p *googleProvider) AuthorizeURL(_, redirectURI, state string) string {
+	params := url.Values{}
+	params.Set("client_id", p.cfg.ClientID)
+	params.Set("redirect_uri", redirectURI)
+	params.Set("response_type", "code")
+	params.Set("scope", "openid email profile")
+	params.Set("state", state)
+	return googleAuthorizeURL + "?" + params.Encode()
+}
+
+func (p *googleProvider) ExchangeCode(ctx context.Context, _, code, redirectURI string) (string, error) {
+	return exchangeOAuthCode(ctx, p.client, googleTokenURL, p.cfg.ClientID, p.cfg.ClientSecret, code, redirectURI)
+}
+
+func (p *googleProvider) FetchUser(ctx context.Context, accessToken string) (*auth.OAuthUserInfo, error) {
+	var user googleUser
+	if err := fetchOAuthJSON(ctx, p.client, googleUserInfoURL, accessToken, &user); err != nil {
+		return nil, err
+	}
+	return &auth.OAuthUserInfo{
+		Provider:      auth.OAuthGoogle,
+		ID:            user.ID,
+		Email:         user.Email,
+		DisplayName:   user.Name,
+		AvatarURL:     user.Picture,
+		EmailVerified: user.VerifiedEmail,
+	}, nil
+}
+
+type gitlabUser struct {
+	ID        int64  `json:"id"`
+	Username  string `json:"username"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	AvatarURL string `json:"avatar_url"`
+	// ConfirmedAt is set once the user has confirmed their primary email
+	ConfirmedAt *string `json:"confirmed_at"`
+}
+
+// gitlabProvider signs users in with gitlab.com or a self-hosted GitLab
+// instance (single app for all domains).
+type gitlabProvider struct {
+	cfg    *config.GitLabOAuthSettings
+	client *http.Client
+}
+
+func (p *gitlabProvider) Name() string  { return auth.OAuthGitLab }
+func (p *gitlabProvider) Title() string { return "GitLab" }
+
+func (p *gitlabProvider) Configured(string) bool {
+	return p.cfg.ClientID != ""
+}
+
+// endpoint returns the URL of path on the configured instance.
+func (p *gitlabProvider) endpoint(path string) string {
+	return strings.TrimSuffix(p.cfg.BaseURL, "/") + path
+}
+
+func (p *gitlabProvider) AuthorizeURL(_, redirectURI, state string) string {
+	params := url.Values{}
+	params.Set("client_id", p.cfg.ClientID)
+	params.Set("redirect_uri", redirectURI)
+	params.Set("response_type", "code")
+	params.Set("scope", "read_user")
+	params.Set("state", state)
+	return p.endpoint("/oauth/authorize") + "?" + params.Encode()
+}
+
+func (p *gitlabProvider) ExchangeCode(ctx context.Context, _, code, redirectURI string) (string, error) {
+	return exchangeOAuthCode(ctx, p.client, p.endpoint("/oauth/token"), p.cfg.ClientID, p.cfg.ClientSecret, code, redirectURI)
+}
+
+func (p *gitlabProvider) FetchUser(ctx context.Context, accessToken string) (*auth.OAuthUserInfo, error) {
+	var user gitlabUser
+	if err := fetchOAuthJSON(ctx, p.client, p.endpoint("/api/v4/user"), accessToken, &user); err != nil {
+		return nil, err
+	}
+	displayName := user.Name
+	if displayName == "" {
+		displayName = user.Username
+	}
+	return &auth.OAuthUserInfo{
+		Provider:      auth.OAuthGitLab,
+		ID:            strconv.FormatInt(user.ID, 10),
+		Email:         user.Email,
+		DisplayName:   displayName,
+		AvatarURL:     user.AvatarURL,
+		EmailVerified: user.ConfirmedAt != nil,
+	}, nil
+}
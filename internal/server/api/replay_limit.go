@@ -0,0 +1,43 @@
+package api
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultReplayTimeout bounds a replay when web.replay.timeout is not set.
+const defaultReplayTimeout = 15 * time.Second
+
+// replaySlots counts the replays each user has in flight.
+type replaySlots struct {
+	mu    sync.Mutex
+	max   int // 0 = unlimited
+	inUse map[int64]int
+}
+
+func newReplaySlots(max int) *replaySlots {
+	return &replaySlots{max: max, inUse: make(map[int64]int)}
+}
+
+// acquire takes one of the user's slots. It returns false when they are
+// all in use; a successful acquire must be followed by release.
+func (rs *replaySlots) acquire(userID int64) bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rs.max > 0 && rs.inUse[userID] >= rs.max {
+		return false
+	}
+	rs.inUse[userID]++
+	return true
+}
+
+// release frees a slot taken by acquire.
+func (rs *replaySlots) release(userID int64) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rs.inUse[userID] <= 1 {
+		delete(rs.inUse, userID)
+		return
+	}
+	rs.inUse[userID]--
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+	"github.com/mephistofox/fxtun.dev/internal/inspect"
+	"github.com/mephistofox/fxtun.dev/internal/server/api/dto"
+	"github.com/mephistofox/fxtun.dev/internal/server/auth"
+)
+
+// slowReplayProvider stands for a local service that never answers: it
+// blocks until the replay is given up.
+type slowReplayProvider struct {
+	started chan struct{}
+}
+
+func (p *slowReplayProvider) ReplayRequest(subdomain string, req *http.Request) (*inspect.ReplayResult, error) {
+	p.started <- struct{}{}
+	<-req.Context().Done()
+	return nil, req.Context().Err()
+}
+
+func newReplayTestServer(t *testing.T, replay config.ReplaySettings) (*Server, *slowReplayProvider) {
+	t.Helper()
+	cfg := &config.ServerConfig{
+		Domain: config.DomainSettings{Base: "test.localhost"},
+		Web:    config.WebSettings{Port: 8081, Replay: replay},
+	}
+	tp := newMockTunnelProvider()
+	tp.userTunnels[1] = []TunnelInfo{{ID: "t1", Type: "http", Subdomain: "app", UserID: 1}}
+	srv := New(cfg, nil, nil, tp, nil, nil, zerolog.New(os.Stderr).Level(zerolog.Disabled))
+	t.Cleanup(func() { close(srv.shutdownCh) })
+	slow := &slowReplayProvider{started: make(chan struct{}, 4)}
+	srv.SetReplayProvider(slow)
+	return srv, slow
+}
+
+func replay(srv *Server) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/", nil)
+	srv.replayThroughTunnel(w, r, &auth.AuthenticatedUser{ID: 1}, "t1", "", "", "GET", "/", http.Header{}, nil)
+	return w
+}
+
+func TestReplayTimesOut(t *testing.T) {
+	srv, _ := newReplayTestServer(t, config.ReplaySettings{Timeout: 50 * time.Millisecond})
+
+	start := time.Now()
+	w := replay(srv)
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("expected 504, got %d: %s", w.Code, w.Body.String())
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("replay took %s despite the timeout", elapsed)
+	}
+	var resp dto.ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Code != "REPLAY_TIMEOUT" {
+		t.Errorf("expected REPLAY_TIMEOUT, got %q (%s)", resp.Code, resp.Error)
+	}
+}
+
+func TestReplayConcurrencyLimit(t *testing.T) {
+	srv, slow := newReplayTestServer(t, config.ReplaySettings{Timeout: 300 * time.Millisecond, MaxConcurrent: 1})
+
+	done := make(chan int)
+	go func() { done <- replay(srv).Code }()
+	<-slow.started
+
+	if w := replay(srv); w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected 429 while a replay is in flight, got %d", w.Code)
+	}
+	if code := <-done; code != http.StatusGatewayTimeout {
+		t.Errorf("expected the first replay to time out, got %d", code)
+	}
+
+	go func() { done <- replay(srv).Code }()
+	<-slow.started
+	if code := <-done; code != http.StatusGatewayTimeout {
+		t.Errorf("expected the slot to be free again, got %d", code)
+	}
+}
+
+func TestReplaySlots(t *testing.T) {
+	unlimited := newReplaySlots(0)
+	for i := 0; i < 10; i++ {
+		if !unlimited.acquire(1) {
+			t.Fatal("max 0 must not limit replays")
+		}
+	}
+
+	rs := newReplaySlots(2)
+	if !rs.acquire(1) || !rs.acquire(1) {
+		t.Fatal("expected two slots")
+	}
+	if rs.acquire(1) {
+		t.Error("a third replay must wait")
+	}
+	if !rs.acquire(2) {
+		t.Error("slots are per user")
+	}
+	rs.release(1)
+	if !rs.acquire(1) {
+		t.Error("a released slot must be reusable")
+	}
+}
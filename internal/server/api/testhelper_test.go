@@ -23,6 +23,15 @@ type mockTunnelProvider struct {
 	userTunnels map[int64][]TunnelInfo
 	closeErr    error
 	stats       Stats
+	health      map[string]*TunnelHealth
+	drain       DrainStatus
+	usage       map[int64]MonthlyUsage
+	usageErr    error
+	clients     map[int64][]ClientInfo
+	cached      map[string]int // stored responses by tunnel ID
+	closedSubs  []string       // subdomains passed to CloseTunnelBySubdomain
+	suspended   []string       // subdomains passed to SuspendSubdomain
+	unsuspended []string       // subdomains passed to UnsuspendSubdomain
 }
 
 func newMockTunnelProvider() *mockTunnelProvider {
@@ -51,6 +60,75 @@ func (m *mockTunnelProvider) AdminCloseTunnel(tunnelID string) error {
 	return m.closeErr
 }
 
+func (m *mockTunnelProvider) GetTunnelHealth(tunnelID string, userID int64) *TunnelHealth {
+	return m.health[tunnelID]
+}
+
+func (m *mockTunnelProvider) GetDrainStatus() DrainStatus {
+	return m.drain
+}
+
+func (m *mockTunnelProvider) GetMonthlyUsage(userID int64) (MonthlyUsage, error) {
+	return m.usage[userID], m.usageErr
+}
+
+func (m *mockTunnelProvider) GetClientsByUserID(userID int64) []ClientInfo {
+	return m.clients[userID]
+}
+
+func (m *mockTunnelProvider) DisconnectClient(clientID string, userID int64) error {
+	for _, c := range m.clients[userID] {
+		if c.ID == clientID {
+			return nil
+		}
+	}
+	return fmt.Errorf("client not found")
+}
+
+func (m *mockTunnelProvider) GetAllClients() []ClientInfo {
+	var all []ClientInfo
+	for _, clients := range m.clients {
+		all = append(all, clients...)
+	}
+	return all
+}
+
+func (m *mockTunnelProvider) AdminDisconnectClient(clientID string) error {
+	for _, clients := range m.clients {
+		for _, c := range clients {
+			if c.ID == clientID {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("client not found")
+}
+
+func (m *mockTunnelProvider) PurgeTunnelCache(tunnelID string, userID int64) (int, error) {
+	for _, t := range m.userTunnels[userID] {
+		if t.ID == tunnelID {
+			n := m.cached[tunnelID]
+			delete(m.cached, tunnelID)
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("tunnel not found")
+}
+
+func (m *mockTunnelProvider) CloseTunnelBySubdomain(subdomain string) bool {
+	m.closedSubs = append(m.closedSubs, subdomain)
+	return true
+}
+
+func (m *mockTunnelProvider) SuspendSubdomain(subdomain string) int {
+	m.suspended = append(m.suspended, subdomain)
+	return 1
+}
+
+func (m *mockTunnelProvider) UnsuspendSubdomain(subdomain string) {
+	m.unsuspended = append(m.unsuspended, subdomain)
+}
+
 // testEnv holds all dependencies for API integration tests.
 type testEnv struct {
 	DB             *database.Database
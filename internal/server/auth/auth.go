@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,7 +20,7 @@ var (
 	ErrTOTPRequired          = errors.New("TOTP code required")
 	ErrInvalidPhone          = errors.New("invalid phone number format")
 	ErrSuspiciousDisplayName = errors.New("display name rejected")
-	ErrTokenReuse            = errors.New("refresh token reuse detected; sessions revoked")
+	ErrTokenReuse            = errors.New("refresh token reuse detected; session family revoked")
 )
 
 // e164PhoneRegex matches E.164 international phone numbers: + followed by 8-15 digits, first digit non-zero.
@@ -74,6 +75,7 @@ func NewService(db *database.Database, jwtSecret string, accessTTL, refreshTTL t
 	return &Service{
 		db:         db,
 		sessions:   db.Sessions,
+		rotated:    db.Sessions,
 		jwt:        NewJWTManager(jwtSecret, accessTTL, refreshTTL),
 		totp:       NewTOTPManager(totpIssuer, totpKey),
 		log:        log.With().Str("component", "auth").Logger(),
@@ -104,7 +106,7 @@ func (s *Service) Register(phone, password, displayName, ipAddress string) (*dat
 	// Reject known bot/abuse display name patterns
 	displayName = strings.TrimSpace(displayName)
 	if IsSuspiciousDisplayName(displayName) {
-		s.log.Warn().Str("phone", MaskPhone(phone)).Str("ip", ipAddress).Str("display_name", displayName).Msg("Registration rejected: suspicious display name")
+		s.log.Warn().Str("phone", MaskPhone(phone)).Str("remote_ip", ipAddress).Str("display_name", displayName).Msg("Registration rejected: suspicious display name")
 		return nil, nil, ErrSuspiciousDisplayName
 	}
 
@@ -142,12 +144,17 @@ func (s *Service) Register(phone, password, displayName, ipAddress string) (*dat
 	if err != nil {
 		return nil, nil, fmt.Errorf("generate tokens: %w", err)
 	}
+	familyID, err := newSessionFamily()
+	if err != nil {
+		return nil, nil, err
+	}
 
 	// Create session
 	session := &database.Session{
 		UserID:           user.ID,
 		RefreshTokenHash: refreshTokenHash,
 		ExpiresAt:        time.Now().Add(s.jwt.GetRefreshTokenTTL()),
+		FamilyID:         familyID,
 	}
 	if err := s.sessions.Create(session); err != nil {
 		return nil, nil, fmt.Errorf("create session: %w", err)
@@ -236,6 +243,10 @@ func (s *Service) Login(identifier, password, totpCode, userAgent, ipAddress str
 	if err != nil {
 		return nil, nil, fmt.Errorf("generate tokens: %w", err)
 	}
+	familyID, err := newSessionFamily()
+	if err != nil {
+		return nil, nil, err
+	}
 
 	// Create session
 	session := &database.Session{
@@ -244,6 +255,7 @@ func (s *Service) Login(identifier, password, totpCode, userAgent, ipAddress str
 		UserAgent:        userAgent,
 		IPAddress:        ipAddress,
 		ExpiresAt:        time.Now().Add(s.jwt.GetRefreshTokenTTL()),
+		FamilyID:         familyID,
 	}
 	if err := s.sessions.Create(session); err != nil {
 		return nil, nil, fmt.Errorf("create session: %w", err)
@@ -297,12 +309,8 @@ func (s *Service) RefreshTokens(refreshToken, userAgent, ipAddress string) (*dat
 			// presenting it again is reuse (a sign of theft): revoke the whole
 			// family so the stolen token and any descendants are invalidated.
 			if s.rotated != nil {
-				if uid, found, rerr := s.rotated.RotatedOwner(tokenHash); rerr == nil && found {
-					if derr := s.sessions.DeleteByUserID(uid); derr != nil {
-						s.log.Error().Err(derr).Int64("user_id", uid).Msg("Refresh token reuse detected but session revocation failed")
-					} else {
-						s.log.Warn().Int64("user_id", uid).Msg("Refresh token reuse detected; revoked all sessions")
-					}
+				if uid, familyID, found, rerr := s.rotated.RotatedOwner(tokenHash); rerr == nil && found {
+					s.revokeSessionFamily(uid, familyID, userAgent, ipAddress)
 					return nil, nil, ErrTokenReuse
 				}
 			}
@@ -337,6 +345,15 @@ func (s *Service) RefreshTokens(refreshToken, userAgent, ipAddress string) (*dat
 		return nil, nil, fmt.Errorf("generate tokens: %w", err)
 	}
 
+	// The new session stays in the old one's family. Sessions from before
+	// families existed start one here.
+	familyID := session.FamilyID
+	if familyID == "" {
+		if familyID, err = newSessionFamily(); err != nil {
+			return nil, nil, err
+		}
+	}
+
 	// Create new session
 	newSession := &database.Session{
 		UserID:           user.ID,
@@ -344,6 +361,7 @@ func (s *Service) RefreshTokens(refreshToken, userAgent, ipAddress string) (*dat
 		UserAgent:        userAgent,
 		IPAddress:        ipAddress,
 		ExpiresAt:        time.Now().Add(s.jwt.GetRefreshTokenTTL()),
+		FamilyID:         familyID,
 	}
 	if err := s.sessions.Create(newSession); err != nil {
 		return nil, nil, fmt.Errorf("create session: %w", err)
@@ -352,7 +370,7 @@ func (s *Service) RefreshTokens(refreshToken, userAgent, ipAddress string) (*dat
 	// Remember the just-rotated token so that presenting it again is detected
 	// as reuse for the remaining lifetime it would otherwise have been valid.
 	if s.rotated != nil {
-		if err := s.rotated.MarkRotated(tokenHash, user.ID, s.jwt.GetRefreshTokenTTL()); err != nil {
+		if err := s.rotated.MarkRotated(tokenHash, user.ID, familyID, s.jwt.GetRefreshTokenTTL()); err != nil {
 			s.log.Warn().Err(err).Msg("Failed to record rotated refresh token; reuse detection degraded for this token")
 		}
 	}
@@ -360,6 +378,35 @@ func (s *Service) RefreshTokens(refreshToken, userAgent, ipAddress string) (*dat
 	return user, tokenPair, nil
 }
 
+// newSessionFamily returns the ID of a new session family. Every login
+// starts one; the sessions its refresh token rotates into keep it.
+func newSessionFamily() (string, error) {
+	return GenerateToken("sf_")
+}
+
+// revokeSessionFamily handles a rotated refresh token that was presented
+// again. Whoever holds a copy may have refreshed it already, so every session
+// of its family is revoked, leaving the user's other devices signed in.
+// Tokens from before session families existed revoke all sessions.
+func (s *Service) revokeSessionFamily(userID int64, familyID, userAgent, ipAddress string) {
+	var err error
+	if familyID != "" {
+		err = s.sessions.DeleteByFamily(userID, familyID)
+	} else {
+		err = s.sessions.DeleteByUserID(userID)
+	}
+	if err != nil {
+		s.log.Error().Err(err).Int64("user_id", userID).Str("family_id", familyID).Msg("Refresh token reuse detected but session revocation failed")
+	} else {
+		s.log.Warn().Int64("user_id", userID).Str("family_id", familyID).Msg("Refresh token reuse detected; revoked its session family")
+	}
+
+	_ = s.db.Audit.Log(&userID, database.ActionRefreshTokenReuse, map[string]interface{}{
+		"family_id":  familyID,
+		"user_agent": userAgent,
+	}, ipAddress)
+}
+
 // ValidateAccessToken validates an access token and returns claims
 func (s *Service) ValidateAccessToken(token string) (*Claims, error) {
 	return s.jwt.ValidateAccessToken(token)
@@ -519,12 +566,72 @@ func (s *Service) IsTOTPEnabled(userID int64) (bool, error) {
 	return s.db.TOTP.IsEnabled(userID)
 }
 
-// OAuthUserInfo contains user information from an OAuth provider
+// OAuth provider names, as used in routes and audit logs.
+const (
+	OAuthGitHub = "github"
+	OAuthGoogle = "google"
+	OAuthGitLab = "gitlab"
+)
+
+// OAuthUserInfo contains user information from an OAuth provider, normalized
+// across providers.
 type OAuthUserInfo struct {
-	GitHubID    int64
+	Provider    string // one of the OAuth* provider names
+	ID          string // the user's ID at the provider
 	Email       string
 	DisplayName string
 	AvatarURL   string
+	// EmailVerified tells that the provider has verified Email
+	EmailVerified bool
+}
+
+// numericID parses the provider user ID for providers with numeric IDs.
+func (info *OAuthUserInfo) numericID() (int64, error) {
+	id, err := strconv.ParseInt(info.ID, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s user id %q", info.Provider, info.ID)
+	}
+	return id, nil
+}
+
+// setOAuthID stores the provider user ID on a user that is about to be created.
+func (info *OAuthUserInfo) setOAuthID(user *database.User) error {
+	switch info.Provider {
+	case OAuthGitHub, OAuthGitLab:
+		id, err := info.numericID()
+		if err != nil {
+			return err
+		}
+		if info.Provider == OAuthGitHub {
+			user.GitHubID = &id
+		} else {
+			user.GitLabID = &id
+		}
+	case OAuthGoogle:
+		id := info.ID
+		user.GoogleID = &id
+	default:
+		return fmt.Errorf("unknown oauth provider %q", info.Provider)
+	}
+	return nil
+}
+
+// GetUserByOAuth returns the user the provider account is linked to.
+func (s *Service) GetUserByOAuth(info *OAuthUserInfo) (*database.User, error) {
+	switch info.Provider {
+	case OAuthGitHub, OAuthGitLab:
+		id, err := info.numericID()
+		if err != nil {
+			return nil, err
+		}
+		if info.Provider == OAuthGitHub {
+			return s.db.Users.GetByGitHubID(id)
+		}
+		return s.db.Users.GetByGitLabID(id)
+	case OAuthGoogle:
+		return s.db.Users.GetByGoogleID(info.ID)
+	}
+	return nil, fmt.Errorf("unknown oauth provider %q", info.Provider)
 }
 
 // RegisterOrLoginOAuth authenticates a user via OAuth, creating the account if needed.
@@ -532,10 +639,10 @@ type OAuthUserInfo struct {
 func (s *Service) RegisterOrLoginOAuth(info *OAuthUserInfo, userAgent, ipAddress string) (*database.User, *TokenPair, bool, error) {
 	var isNew bool
 
-	// Try to find existing user by GitHub ID
-	user, err := s.db.Users.GetByGitHubID(info.GitHubID)
+	// Try to find existing user by provider ID
+	user, err := s.GetUserByOAuth(info)
 	if err != nil && !errors.Is(err, database.ErrUserNotFound) {
-		return nil, nil, false, fmt.Errorf("get user by github id: %w", err)
+		return nil, nil, false, fmt.Errorf("get user by %s id: %w", info.Provider, err)
 	}
 
 	if user == nil {
@@ -549,21 +656,23 @@ func (s *Service) RegisterOrLoginOAuth(info *OAuthUserInfo, userAgent, ipAddress
 			DisplayName: info.DisplayName,
 			IsActive:    true,
 			IsAdmin:     false,
-			GitHubID:    &info.GitHubID,
 			Email:       info.Email,
 			AvatarURL:   info.AvatarURL,
 			PlanID:      oauthPlanID,
 		}
+		if err := info.setOAuthID(user); err != nil {
+			return nil, nil, false, err
+		}
 		if err := s.db.Users.CreateOAuth(user); err != nil {
 			return nil, nil, false, fmt.Errorf("create oauth user: %w", err)
 		}
 
 		_ = s.db.Audit.Log(&user.ID, database.ActionRegister, map[string]interface{}{
-			"method":    "github",
-			"github_id": info.GitHubID,
+			"method":              info.Provider,
+			info.Provider + "_id": info.ID,
 		}, ipAddress)
 
-		s.log.Info().Int64("user_id", user.ID).Int64("github_id", info.GitHubID).Msg("OAuth user registered")
+		s.log.Info().Int64("user_id", user.ID).Str("provider", info.Provider).Str("provider_id", info.ID).Msg("OAuth user registered")
 	}
 
 	if !user.IsActive {
@@ -582,11 +691,19 @@ func (s *Service) RegisterOrLoginOAuth(info *OAuthUserInfo, userAgent, ipAddress
 		user.Phone = info.Email
 	}
 
+	if !user.EmailVerified && s.markEmailVerified(user.ID, info) {
+		user.EmailVerified = true
+	}
+
 	// Generate tokens
 	tokenPair, refreshTokenHash, err := s.jwt.GenerateTokenPair(user.ID, userIdentifier(user), user.IsAdmin)
 	if err != nil {
 		return nil, nil, false, fmt.Errorf("generate tokens: %w", err)
 	}
+	familyID, err := newSessionFamily()
+	if err != nil {
+		return nil, nil, false, err
+	}
 
 	// Create session
 	session := &database.Session{
@@ -595,6 +712,7 @@ func (s *Service) RegisterOrLoginOAuth(info *OAuthUserInfo, userAgent, ipAddress
 		UserAgent:        userAgent,
 		IPAddress:        ipAddress,
 		ExpiresAt:        time.Now().Add(s.jwt.GetRefreshTokenTTL()),
+		FamilyID:         familyID,
 	}
 	if err := s.sessions.Create(session); err != nil {
 		return nil, nil, false, fmt.Errorf("create session: %w", err)
@@ -604,117 +722,53 @@ func (s *Service) RegisterOrLoginOAuth(info *OAuthUserInfo, userAgent, ipAddress
 	_ = s.db.Users.UpdateLastLogin(user.ID)
 
 	_ = s.db.Audit.Log(&user.ID, database.ActionLogin, map[string]interface{}{
-		"method":     "github",
+		"method":     info.Provider,
 		"user_agent": userAgent,
 	}, ipAddress)
 
-	s.log.Info().Int64("user_id", user.ID).Int64("github_id", info.GitHubID).Msg("OAuth user logged in")
+	s.log.Info().Int64("user_id", user.ID).Str("provider", info.Provider).Str("provider_id", info.ID).Msg("OAuth user logged in")
 
 	return user, tokenPair, isNew, nil
 }
 
-// LinkGitHub links a GitHub account to an existing user
-func (s *Service) LinkGitHub(userID, githubID int64, email, avatarURL string) error {
-	return s.db.Users.LinkGitHub(userID, githubID, email, avatarURL)
-}
-
-// GoogleOAuthUserInfo contains user information from Google OAuth
-type GoogleOAuthUserInfo struct {
-	GoogleID    string
-	Email       string
-	DisplayName string
-	AvatarURL   string
-}
-
-// RegisterOrLoginGoogleOAuth authenticates a user via Google OAuth, creating the account if needed.
-// The returned bool indicates whether a new user was created (true) or an existing user logged in (false).
-func (s *Service) RegisterOrLoginGoogleOAuth(info *GoogleOAuthUserInfo, userAgent, ipAddress string) (*database.User, *TokenPair, bool, error) {
-	var isNew bool
-
-	// Try to find existing user by Google ID
-	user, err := s.db.Users.GetByGoogleID(info.GoogleID)
-	if err != nil && !errors.Is(err, database.ErrUserNotFound) {
-		return nil, nil, false, fmt.Errorf("get user by google id: %w", err)
+// LinkOAuth links a provider account to an existing user
+func (s *Service) LinkOAuth(userID int64, info *OAuthUserInfo) error {
+	if err := s.linkOAuth(userID, info); err != nil {
+		return err
 	}
+	s.markEmailVerified(userID, info)
+	return nil
+}
 
-	if user == nil {
-		isNew = true
-		// Create new OAuth user
-		var googlePlanID int64
-		if dp, err := s.db.Plans.GetDefault(); err == nil {
-			googlePlanID = dp.ID
-		}
-		user = &database.User{
-			DisplayName: info.DisplayName,
-			IsActive:    true,
-			IsAdmin:     false,
-			GoogleID:    &info.GoogleID,
-			Email:       info.Email,
-			AvatarURL:   info.AvatarURL,
-			PlanID:      googlePlanID,
+func (s *Service) linkOAuth(userID int64, info *OAuthUserInfo) error {
+	switch info.Provider {
+	case OAuthGitHub, OAuthGitLab:
+		id, err := info.numericID()
+		if err != nil {
+			return err
 		}
-		if err := s.db.Users.CreateOAuth(user); err != nil {
-			return nil, nil, false, fmt.Errorf("create oauth user: %w", err)
+		if info.Provider == OAuthGitHub {
+			return s.db.Users.LinkGitHub(userID, id, info.Email, info.AvatarURL)
 		}
-
-		_ = s.db.Audit.Log(&user.ID, database.ActionRegister, map[string]interface{}{
-			"method":    "google",
-			"google_id": info.GoogleID,
-		}, ipAddress)
-
-		s.log.Info().Int64("user_id", user.ID).Str("google_id", info.GoogleID).Msg("Google OAuth user registered")
-	}
-
-	if !user.IsActive {
-		return nil, nil, false, ErrUserNotActive
-	}
-
-	// Update email from OAuth if user has no email
-	if user.Email == "" && info.Email != "" {
-		_ = s.db.Users.UpdateEmail(user.ID, info.Email)
-		user.Email = info.Email
+		return s.db.Users.LinkGitLab(userID, id, info.Email, info.AvatarURL)
+	case OAuthGoogle:
+		return s.db.Users.LinkGoogle(userID, info.ID, info.Email, info.AvatarURL)
 	}
+	return fmt.Errorf("unknown oauth provider %q", info.Provider)
+}
 
-	// Set phone to email if phone is empty (OAuth users have no phone)
-	if user.Phone == "" && info.Email != "" {
-		_ = s.db.Users.UpdatePhone(user.ID, info.Email)
-		user.Phone = info.Email
+// markEmailVerified records the user's email as verified when the provider
+// has verified the same address. It reports whether it did.
+func (s *Service) markEmailVerified(userID int64, info *OAuthUserInfo) bool {
+	if !info.EmailVerified || info.Email == "" {
+		return false
 	}
-
-	// Generate tokens
-	tokenPair, refreshTokenHash, err := s.jwt.GenerateTokenPair(user.ID, userIdentifier(user), user.IsAdmin)
+	marked, err := s.db.Users.MarkEmailVerified(userID, info.Email)
 	if err != nil {
-		return nil, nil, false, fmt.Errorf("generate tokens: %w", err)
-	}
-
-	// Create session
-	session := &database.Session{
-		UserID:           user.ID,
-		RefreshTokenHash: refreshTokenHash,
-		UserAgent:        userAgent,
-		IPAddress:        ipAddress,
-		ExpiresAt:        time.Now().Add(s.jwt.GetRefreshTokenTTL()),
-	}
-	if err := s.sessions.Create(session); err != nil {
-		return nil, nil, false, fmt.Errorf("create session: %w", err)
+		s.log.Warn().Err(err).Int64("user_id", userID).Msg("Failed to mark email verified")
+		return false
 	}
-
-	// Update last login
-	_ = s.db.Users.UpdateLastLogin(user.ID)
-
-	_ = s.db.Audit.Log(&user.ID, database.ActionLogin, map[string]interface{}{
-		"method":     "google",
-		"user_agent": userAgent,
-	}, ipAddress)
-
-	s.log.Info().Int64("user_id", user.ID).Str("google_id", info.GoogleID).Msg("Google OAuth user logged in")
-
-	return user, tokenPair, isNew, nil
-}
-
-// LinkGoogle links a Google account to an existing user
-func (s *Service) LinkGoogle(userID int64, googleID, email, avatarURL string) error {
-	return s.db.Users.LinkGoogle(userID, googleID, email, avatarURL)
+	return marked
 }
 
 // GetMaxDomains returns the maximum number of domains per user
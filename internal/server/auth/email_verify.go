@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// emailVerifyAudience marks email verification tokens.
+const emailVerifyAudience = "email-verify"
+
+// EmailVerifyClaims are the claims of an email verification token. It
+// proves that whoever holds it received mail at Email, the address the user
+// asked to verify.
+type EmailVerifyClaims struct {
+	jwt.RegisteredClaims
+	UserID int64  `json:"user_id"`
+	Email  string `json:"email"`
+}
+
+// GenerateEmailVerifyToken issues a token verifying email for the user,
+// valid for ttl.
+func (m *JWTManager) GenerateEmailVerifyToken(userID int64, email string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := &EmailVerifyClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    m.issuer,
+			Subject:   fmt.Sprintf("%d", userID),
+			Audience:  jwt.ClaimStrings{emailVerifyAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+		},
+		UserID: userID,
+		Email:  email,
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(m.verifyKey)
+}
+
+// ValidateEmailVerifyToken validates an email verification token and
+// returns its claims.
+func (m *JWTManager) ValidateEmailVerifyToken(tokenString string) (*EmailVerifyClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &EmailVerifyClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return m.verifyKey, nil
+	}, jwt.WithAudience(emailVerifyAudience), jwt.WithIssuer(m.issuer))
+
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrTokenExpired
+		}
+		return nil, ErrInvalidToken
+	}
+
+	claims, ok := token.Claims.(*EmailVerifyClaims)
+	if !ok || !token.Valid || claims.UserID <= 0 || claims.Email == "" {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
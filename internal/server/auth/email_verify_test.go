@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmailVerifyTokenRoundTrip(t *testing.T) {
+	m := NewJWTManager("secret", time.Hour, time.Hour)
+	token, err := m.GenerateEmailVerifyToken(42, "user@example.com", time.Hour)
+	require.NoError(t, err)
+
+	claims, err := m.ValidateEmailVerifyToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), claims.UserID)
+	assert.Equal(t, "user@example.com", claims.Email)
+}
+
+// Verification, share and access tokens are signed with different keys, so
+// none can stand in for another.
+func TestEmailVerifyTokenIsNotOtherToken(t *testing.T) {
+	m := NewJWTManager("secret", time.Hour, time.Hour)
+
+	verify, err := m.GenerateEmailVerifyToken(42, "user@example.com", time.Hour)
+	require.NoError(t, err)
+	_, err = m.ValidateAccessToken(verify)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, err = m.ValidateShareToken(verify)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	share, _, err := m.GenerateShareToken(1, 42, "myapp", time.Hour)
+	require.NoError(t, err)
+	_, err = m.ValidateEmailVerifyToken(share)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestEmailVerifyTokenExpired(t *testing.T) {
+	m := NewJWTManager("secret", time.Hour, time.Hour)
+	token, err := m.GenerateEmailVerifyToken(42, "user@example.com", time.Millisecond)
+	require.NoError(t, err)
+
+	time.Sleep(10 * time.Millisecond)
+
+	_, err = m.ValidateEmailVerifyToken(token)
+	assert.ErrorIs(t, err, ErrTokenExpired)
+}
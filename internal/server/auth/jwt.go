@@ -28,6 +28,8 @@ type Claims struct {
 // JWTManager handles JWT token operations
 type JWTManager struct {
 	secretKey       []byte
+	shareKey        []byte // signs inspector share tokens
+	verifyKey       []byte // signs email verification tokens
 	accessTokenTTL  time.Duration
 	refreshTokenTTL time.Duration
 	issuer          string
@@ -40,20 +42,27 @@ func NewJWTManager(secretKey string, accessTTL, refreshTTL time.Duration) *JWTMa
 	if len(raw) < 32 {
 		log.Warn().Int("key_length", len(raw)).Msg("JWT secret key is shorter than 32 bytes, consider using a stronger key")
 	}
-	// Derive 32-byte key with HKDF-SHA256
-	derived := make([]byte, 32)
-	r := hkdf.New(sha256.New, raw, []byte("fxtunnel-jwt-salt"), []byte("auth-signing-key"))
-	if _, err := io.ReadFull(r, derived); err != nil {
-		panic("HKDF key derivation failed: " + err.Error())
-	}
 	return &JWTManager{
-		secretKey:       derived,
+		secretKey:       deriveKey(raw, "auth-signing-key"),
+		shareKey:        deriveKey(raw, "inspect-share-key"),
+		verifyKey:       deriveKey(raw, "email-verify-key"),
 		accessTokenTTL:  accessTTL,
 		refreshTokenTTL: refreshTTL,
 		issuer:          "fxtunnel",
 	}
 }
 
+// deriveKey derives a 32-byte key for one purpose from the secret with
+// HKDF-SHA256, so tokens signed for one purpose never verify for another.
+func deriveKey(secret []byte, purpose string) []byte {
+	derived := make([]byte, 32)
+	r := hkdf.New(sha256.New, secret, []byte("fxtunnel-jwt-salt"), []byte(purpose))
+	if _, err := io.ReadFull(r, derived); err != nil {
+		panic("HKDF key derivation failed: " + err.Error())
+	}
+	return derived
+}
+
 // GenerateAccessToken generates a new access token
 func (m *JWTManager) GenerateAccessToken(userID int64, phone string, isAdmin bool) (string, error) {
 	now := time.Now()
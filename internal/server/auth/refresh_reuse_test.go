@@ -20,11 +20,11 @@ import (
 type fakeSessionStore struct {
 	mu      sync.Mutex
 	byHash  map[string]*database.Session
-	rotated map[string]int64
+	rotated map[string]*database.Session
 }
 
 func newFakeSessionStore() *fakeSessionStore {
-	return &fakeSessionStore{byHash: map[string]*database.Session{}, rotated: map[string]int64{}}
+	return &fakeSessionStore{byHash: map[string]*database.Session{}, rotated: map[string]*database.Session{}}
 }
 
 var (
@@ -83,20 +83,34 @@ func (f *fakeSessionStore) DeleteByUserID(userID int64) error {
 	return nil
 }
 
+func (f *fakeSessionStore) DeleteByFamily(userID int64, familyID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for h, s := range f.byHash {
+		if s.UserID == userID && s.FamilyID == familyID {
+			delete(f.byHash, h)
+		}
+	}
+	return nil
+}
+
 func (f *fakeSessionStore) DeleteExpired() (int64, error) { return 0, nil }
 
-func (f *fakeSessionStore) MarkRotated(h string, userID int64, _ time.Duration) error {
+func (f *fakeSessionStore) MarkRotated(h string, userID int64, familyID string, _ time.Duration) error {
 	f.mu.Lock()
 	defer f.mu.Unlock()
-	f.rotated[h] = userID
+	f.rotated[h] = &database.Session{UserID: userID, FamilyID: familyID}
 	return nil
 }
 
-func (f *fakeSessionStore) RotatedOwner(h string) (int64, bool, error) {
+func (f *fakeSessionStore) RotatedOwner(h string) (int64, string, bool, error) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
-	uid, ok := f.rotated[h]
-	return uid, ok, nil
+	s, ok := f.rotated[h]
+	if !ok {
+		return 0, "", false, nil
+	}
+	return s.UserID, s.FamilyID, true, nil
 }
 
 func setupAuthTestUser(t *testing.T) (*database.Database, *database.User) {
@@ -128,7 +142,7 @@ func setupAuthTestUser(t *testing.T) (*database.Database, *database.User) {
 }
 
 // Reusing an already-rotated refresh token must be detected as theft and revoke
-// the user's entire session family.
+// its session family, leaving the user's other devices signed in.
 func TestRefreshTokens_ReuseRevokesFamily(t *testing.T) {
 	db, user := setupAuthTestUser(t)
 	log := zerolog.New(zerolog.NewTestWriter(t))
@@ -137,16 +151,27 @@ func TestRefreshTokens_ReuseRevokesFamily(t *testing.T) {
 	fake := newFakeSessionStore()
 	svc.SetSessionStore(fake)
 
-	// Seed an initial session for an opaque refresh token.
+	// Seed an initial session for an opaque refresh token, and a session of
+	// another device.
 	const firstToken = "refresh-token-one"
 	if err := fake.Create(&database.Session{
 		UserID:           user.ID,
 		RefreshTokenHash: HashToken(firstToken),
 		ExpiresAt:        time.Now().Add(24 * time.Hour),
 		CreatedAt:        time.Now(),
+		FamilyID:         "laptop",
 	}); err != nil {
 		t.Fatalf("seed session: %v", err)
 	}
+	if err := fake.Create(&database.Session{
+		UserID:           user.ID,
+		RefreshTokenHash: HashToken("phone-token"),
+		ExpiresAt:        time.Now().Add(24 * time.Hour),
+		CreatedAt:        time.Now(),
+		FamilyID:         "phone",
+	}); err != nil {
+		t.Fatalf("seed other session: %v", err)
+	}
 
 	// First refresh rotates the token successfully.
 	_, pair, err := svc.RefreshTokens(firstToken, "ua", "1.2.3.4")
@@ -167,7 +192,15 @@ func TestRefreshTokens_ReuseRevokesFamily(t *testing.T) {
 	if err != nil {
 		t.Fatalf("get sessions: %v", err)
 	}
-	if len(sessions) != 0 {
-		t.Fatalf("expected all sessions revoked after reuse, got %d", len(sessions))
+	if len(sessions) != 1 || sessions[0].FamilyID != "phone" {
+		t.Fatalf("expected only the other device's session to survive reuse, got %+v", sessions)
+	}
+
+	entry, err := db.Audit.GetLatestByUserAndAction(user.ID, database.ActionRefreshTokenReuse)
+	if err != nil || entry == nil {
+		t.Fatalf("expected a refresh_token_reuse audit event, got %v", err)
+	}
+	if entry.Details["family_id"] != "laptop" {
+		t.Fatalf("expected the laptop family in the audit event, got %v", entry.Details)
 	}
 }
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// shareAudience marks inspector share tokens.
+const shareAudience = "inspect-share"
+
+// ShareClaims are the claims of an inspector share token. It grants
+// read-only access to the inspector of the user's tunnel on Subdomain,
+// which stays the same when the tunnel reconnects, for as long as the
+// share link ShareID is not revoked.
+type ShareClaims struct {
+	jwt.RegisteredClaims
+	ShareID   int64  `json:"share_id"`
+	UserID    int64  `json:"user_id"`
+	Subdomain string `json:"subdomain"`
+}
+
+// GenerateShareToken issues the token of share link shareID for the
+// inspector of the user's tunnel on subdomain, valid for ttl.
+func (m *JWTManager) GenerateShareToken(shareID, userID int64, subdomain string, ttl time.Duration) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	claims := &ShareClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    m.issuer,
+			Subject:   fmt.Sprintf("%d", userID),
+			Audience:  jwt.ClaimStrings{shareAudience},
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+		},
+		ShareID:   shareID,
+		UserID:    userID,
+		Subdomain: subdomain,
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(m.shareKey)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// ValidateShareToken validates a share token and returns its claims.
+func (m *JWTManager) ValidateShareToken(tokenString string) (*ShareClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &ShareClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return m.shareKey, nil
+	}, jwt.WithAudience(shareAudience), jwt.WithIssuer(m.issuer))
+
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrTokenExpired
+		}
+		return nil, ErrInvalidToken
+	}
+
+	claims, ok := token.Claims.(*ShareClaims)
+	if !ok || !token.Valid || claims.ShareID <= 0 || claims.UserID <= 0 || claims.Subdomain == "" {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
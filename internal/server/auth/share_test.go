@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShareTokenRoundTrip(t *testing.T) {
+	m := NewJWTManager("secret", time.Hour, time.Hour)
+	token, expiresAt, err := m.GenerateShareToken(1, 42, "myapp", time.Hour)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), expiresAt, time.Second)
+
+	claims, err := m.ValidateShareToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), claims.ShareID)
+	assert.Equal(t, int64(42), claims.UserID)
+	assert.Equal(t, "myapp", claims.Subdomain)
+}
+
+// Share and access tokens are signed with different keys, so neither can
+// stand in for the other.
+func TestShareTokenIsNotAccessToken(t *testing.T) {
+	m := NewJWTManager("secret", time.Hour, time.Hour)
+
+	share, _, err := m.GenerateShareToken(1, 42, "myapp", time.Hour)
+	require.NoError(t, err)
+	_, err = m.ValidateAccessToken(share)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	access, err := m.GenerateAccessToken(42, "+1234", true)
+	require.NoError(t, err)
+	_, err = m.ValidateShareToken(access)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestShareTokenExpired(t *testing.T) {
+	m := NewJWTManager("secret", time.Hour, time.Hour)
+	token, _, err := m.GenerateShareToken(1, 42, "myapp", time.Millisecond)
+	require.NoError(t, err)
+
+	time.Sleep(10 * time.Millisecond)
+
+	_, err = m.ValidateShareToken(token)
+	assert.ErrorIs(t, err, ErrTokenExpired)
+}
@@ -0,0 +1,331 @@
+package core
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+	"github.com/mephistofox/fxtun.dev/internal/server/database"
+	"github.com/mephistofox/fxtun.dev/internal/server/monitor"
+)
+
+const (
+	// abuseReportPath serves the abuse report form on the base domain.
+	abuseReportPath = "/_fxreport"
+	// abuseReportsPerHour caps the reports one visitor IP may submit.
+	abuseReportsPerHour = 5
+	abuseReportMaxBody  = 16 << 10
+	abuseMaxDetails     = 4000
+	abuseMaxURL         = 500
+	abuseMaxEmail       = 254
+	// suspendedMessage is shown instead of a suspended tunnel's content and
+	// sent to its client.
+	suspendedMessage = "This tunnel has been suspended for abuse."
+	// suspensionSyncInterval is how often suspensions made on other nodes
+	// are picked up from the database.
+	suspensionSyncInterval = 30 * time.Second
+)
+
+var abuseTmpl = template.Must(template.ParseFS(templateFS, "templates/abuse.html"))
+
+// abusePageData holds template data for the abuse report and suspension pages.
+type abusePageData struct {
+	Title, Message, URL, BaseDomain string
+	Error, Form                     bool
+}
+
+// LoadSuspensions syncs the suspended subdomains with the database, where
+// every node records its suspensions. Tunnels on a subdomain suspended since
+// the last sync are closed and lifted suspensions are dropped.
+func (s *Server) LoadSuspensions() error {
+	if s.db == nil {
+		return nil
+	}
+	list, err := s.db.Abuse.ListSuspended()
+	if err != nil {
+		return err
+	}
+	subdomains := make([]string, 0, len(list))
+	for _, sub := range list {
+		subdomains = append(subdomains, sub.Subdomain)
+	}
+	for _, subdomain := range s.applySuspensions(subdomains) {
+		if closed := s.closeSuspendedTunnels(subdomain); closed > 0 {
+			s.log.Warn().Str("subdomain", subdomain).Int("closed_tunnels", closed).Msg("Subdomain suspended for abuse")
+		}
+	}
+	return nil
+}
+
+// applySuspensions replaces the synced part of the suspension set with
+// subdomains and returns the ones that were not in the previous sync. Only
+// changes since that sync are applied, so suspensions made or lifted on this
+// node in the meantime are not undone by a stale read.
+func (s *Server) applySuspensions(subdomains []string) []string {
+	current := make(map[string]struct{}, len(subdomains))
+	for _, sub := range subdomains {
+		current[strings.ToLower(sub)] = struct{}{}
+	}
+
+	s.suspendedMu.Lock()
+	defer s.suspendedMu.Unlock()
+	var added []string
+	for sub := range current {
+		if _, ok := s.suspendedSynced[sub]; !ok {
+			s.suspended[sub] = struct{}{}
+			added = append(added, sub)
+		}
+	}
+	for sub := range s.suspendedSynced {
+		if _, ok := current[sub]; !ok {
+			delete(s.suspended, sub)
+		}
+	}
+	s.suspendedSynced = current
+	return added
+}
+
+// runSuspensionSync reloads suspensions every suspensionSyncInterval until
+// the server stops.
+func (s *Server) runSuspensionSync() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(suspensionSyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.LoadSuspensions(); err != nil {
+				s.log.Warn().Err(err).Msg("Failed to sync suspended subdomains")
+			}
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// SuspendSubdomain blocks a subdomain for abuse: requests get the suspension
+// page, new tunnels on it are refused and the tunnels serving it are closed
+// with an error to their clients. It returns how many tunnels were closed.
+func (s *Server) SuspendSubdomain(subdomain string) int {
+	subdomain = strings.ToLower(subdomain)
+	s.suspendedMu.Lock()
+	s.suspended[subdomain] = struct{}{}
+	s.suspendedMu.Unlock()
+
+	closed := s.closeSuspendedTunnels(subdomain)
+	s.log.Warn().Str("subdomain", subdomain).Int("closed_tunnels", closed).Msg("Subdomain suspended for abuse")
+	return closed
+}
+
+// closeSuspendedTunnels closes the tunnels serving a suspended subdomain with
+// an error to their clients and returns how many were closed.
+func (s *Server) closeSuspendedTunnels(subdomain string) int {
+	closed := 0
+	for _, tunnel := range s.httpRouter.GetTunnels(subdomain) {
+		client := s.GetClient(tunnel.ClientID)
+		if client == nil {
+			continue
+		}
+		_ = client.sendControl(&protocol.TunnelErrorMessage{
+			Message:  protocol.NewMessage(protocol.MsgTunnelError),
+			TunnelID: tunnel.ID,
+			Error:    suspendedMessage,
+			Code:     protocol.ErrCodeSubdomainSuspended,
+		})
+		client.recordHistoryEvent(database.HistoryEventTunnelError, string(tunnel.Type), tunnel.LocalPort,
+			client.tunnelURL(tunnel), suspendedMessage)
+		client.emitTunnelEvent(config.WebhookTunnelError, tunnel, suspendedMessage)
+		client.closeTunnel(tunnel.ID)
+		closed++
+	}
+	return closed
+}
+
+// UnsuspendSubdomain lifts a suspension.
+func (s *Server) UnsuspendSubdomain(subdomain string) {
+	s.suspendedMu.Lock()
+	delete(s.suspended, strings.ToLower(subdomain))
+	s.suspendedMu.Unlock()
+}
+
+// isSuspended reports whether a subdomain is suspended for abuse.
+func (s *Server) isSuspended(subdomain string) bool {
+	s.suspendedMu.RLock()
+	defer s.suspendedMu.RUnlock()
+	_, ok := s.suspended[strings.ToLower(subdomain)]
+	return ok
+}
+
+// allowAbuseReport applies the per-IP report rate limit.
+func (s *Server) allowAbuseReport(ip string) bool {
+	v, _ := s.reportLimiters.LoadOrStore(ip, monitor.NewSlidingWindow(abuseReportsPerHour, time.Hour))
+	return v.(*monitor.SlidingWindow).Allow()
+}
+
+// cleanupReportLimiters removes idle abuse report rate limiters.
+func (s *Server) cleanupReportLimiters() {
+	s.reportLimiters.Range(func(key, value any) bool {
+		if value.(*monitor.SlidingWindow).IsIdle(time.Hour) {
+			s.reportLimiters.Delete(key)
+		}
+		return true
+	})
+}
+
+// handleAbuseReport serves the abuse report form and stores submitted
+// reports for the admin queue.
+func (r *HTTPRouter) handleAbuseReport(w http.ResponseWriter, req *http.Request) {
+	data := abusePageData{
+		Title:      "Report abuse",
+		Message:    "Report a tunnel serving phishing, malware or other abusive content.",
+		BaseDomain: r.server.cfg.Domain.Base,
+		Form:       true,
+	}
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		data.URL = req.URL.Query().Get("url")
+		r.serveAbusePage(w, http.StatusOK, data)
+		return
+	case http.MethodPost:
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.server.db == nil {
+		r.serveAbusePage(w, http.StatusServiceUnavailable, abusePageData{
+			Title: "Report abuse", Message: "Abuse reports are not accepted on this server.", Error: true,
+		})
+		return
+	}
+
+	ip := "unknown"
+	if clientIP := extractClientIP(req, r.server.trustedProxies); clientIP != nil {
+		ip = clientIP.String()
+	}
+	if !r.server.allowAbuseReport(ip) {
+		r.serveAbusePage(w, http.StatusTooManyRequests, abusePageData{
+			Title: "Report abuse", Message: "Too many reports, please try again later.", Error: true,
+		})
+		return
+	}
+
+	req.Body = http.MaxBytesReader(w, req.Body, abuseReportMaxBody)
+	if err := req.ParseForm(); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	data.URL = truncate(strings.TrimSpace(req.PostForm.Get("url")), abuseMaxURL)
+	subdomain := r.reportedSubdomain(data.URL)
+	if subdomain == "" {
+		data.Message = "Enter the address of a tunnel on " + r.server.cfg.Domain.Base + "."
+		data.Error = true
+		r.serveAbusePage(w, http.StatusBadRequest, data)
+		return
+	}
+
+	category := req.PostForm.Get("category")
+	if !database.IsAbuseCategory(category) {
+		category = database.AbuseCategoryOther
+	}
+	report := &database.AbuseReport{
+		Subdomain:     subdomain,
+		URL:           data.URL,
+		Category:      category,
+		Details:       truncate(strings.TrimSpace(req.PostForm.Get("details")), abuseMaxDetails),
+		ReporterEmail: truncate(strings.TrimSpace(req.PostForm.Get("email")), abuseMaxEmail),
+		ReporterIP:    ip,
+		UserID:        r.subdomainOwner(subdomain),
+	}
+	if err := r.server.db.Abuse.CreateReport(report); err != nil {
+		r.log.Error().Err(err).Str("subdomain", subdomain).Msg("Failed to store abuse report")
+		r.serveAbusePage(w, http.StatusInternalServerError, abusePageData{
+			Title: "Report abuse", Message: "The report could not be saved, please try again later.", Error: true,
+		})
+		return
+	}
+
+	r.log.Warn().Int64("report_id", report.ID).Str("subdomain", subdomain).Str("category", category).
+		Msg("Abuse report received")
+	r.serveAbusePage(w, http.StatusOK, abusePageData{
+		Title:   "Thank you",
+		Message: "Your report has been received and will be reviewed shortly.",
+	})
+}
+
+// reportedSubdomain returns the tunnel subdomain a reported address points
+// at, following verified custom domains. It is empty for other hosts.
+func (r *HTTPRouter) reportedSubdomain(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" {
+		return ""
+	}
+	if subdomain := r.extractSubdomain(u.Host); subdomain != "" {
+		return strings.ToLower(subdomain)
+	}
+	if cd := r.server.LookupCustomDomain(u.Host); cd != nil && cd.Verified {
+		return strings.ToLower(cd.TargetSubdomain)
+	}
+	return ""
+}
+
+// subdomainOwner returns the user serving a subdomain right now, on this
+// node or another, or nil when no tunnel of a known user serves it.
+func (r *HTTPRouter) subdomainOwner(subdomain string) *int64 {
+	if tunnel := r.GetTunnel(subdomain); tunnel != nil && tunnel.userID > 0 {
+		id := tunnel.userID
+		return &id
+	}
+	if reg := r.server.tunnelRegistry; reg != nil {
+		if entry, err := reg.LookupBySubdomain(subdomain); err == nil && entry != nil && entry.UserID > 0 {
+			id := entry.UserID
+			return &id
+		}
+	}
+	return nil
+}
+
+// serveSuspendedPage answers a request for a suspended subdomain.
+func (r *HTTPRouter) serveSuspendedPage(w http.ResponseWriter) {
+	r.serveAbusePage(w, http.StatusUnavailableForLegalReasons, abusePageData{
+		Title:   "Tunnel suspended",
+		Message: suspendedMessage,
+		Error:   true,
+	})
+}
+
+func (r *HTTPRouter) serveAbusePage(w http.ResponseWriter, status int, data abusePageData) {
+	var buf bytes.Buffer
+	_ = abuseTmpl.Execute(&buf, data)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_, _ = w.Write(buf.Bytes())
+}
+
+// truncate cuts s to at most n bytes without splitting a UTF-8 sequence.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
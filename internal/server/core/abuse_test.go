@@ -0,0 +1,132 @@
+package core
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+func TestSuspendSubdomain_ClosesTunnelsAndServesSuspendedPage(t *testing.T) {
+	router, srv := newTestRouter("example.com")
+	defer srv.cancel()
+
+	var control bytes.Buffer
+	client := &Client{ID: "c1", UserID: 7, server: srv, log: zerolog.Nop(), Tunnels: map[string]*Tunnel{},
+		ControlCodec: protocol.NewCodec(&control, &control)}
+	srv.clientMgr.addClient(client.ID, client)
+	tunnel := &Tunnel{ID: "t1", Type: protocol.TunnelHTTP, Subdomain: "phish", ClientID: "c1"}
+	client.Tunnels[tunnel.ID] = tunnel
+	require.NoError(t, router.RegisterTunnel("phish", tunnel))
+
+	assert.Equal(t, 1, srv.SuspendSubdomain("Phish"))
+	assert.Nil(t, router.GetTunnel("phish"))
+	assert.Empty(t, client.Tunnels)
+
+	var msg protocol.TunnelErrorMessage
+	require.NoError(t, client.ControlCodec.Decode(&msg))
+	assert.Equal(t, "t1", msg.TunnelID)
+	assert.Equal(t, protocol.ErrCodeSubdomainSuspended, msg.Code)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://phish.example.com/login", nil))
+	assert.Equal(t, http.StatusUnavailableForLegalReasons, w.Code)
+	assert.Contains(t, w.Body.String(), "suspended for abuse")
+
+	srv.UnsuspendSubdomain("phish")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://phish.example.com/login", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandleAbuseReport_Form(t *testing.T) {
+	router, srv := newTestRouter("example.com")
+	defer srv.cancel()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet,
+		"http://example.com/_fxreport?url=https://phish.example.com/login", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `action="/_fxreport"`)
+	assert.Contains(t, w.Body.String(), `value="https://phish.example.com/login"`)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://app.example.com/_fxreport", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code, "the form is only served on the base domain")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "http://example.com/_fxreport", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestHandleAbuseReport_NoDatabase(t *testing.T) {
+	router, srv := newTestRouter("example.com")
+	defer srv.cancel()
+
+	form := url.Values{"url": {"https://phish.example.com/"}, "category": {"phishing"}}
+	req := httptest.NewRequest(http.MethodPost, "http://example.com/_fxreport", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestReportedSubdomain(t *testing.T) {
+	router, srv := newTestRouter("example.com")
+	defer srv.cancel()
+
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"https://Phish.example.com/login?x=1", "phish"},
+		{"phish.example.com", "phish"},
+		{"https://example.com/", ""},
+		{"https://evil.org/", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, router.reportedSubdomain(tt.raw), tt.raw)
+	}
+}
+
+func TestAllowAbuseReport_RateLimit(t *testing.T) {
+	srv := &Server{}
+	for range abuseReportsPerHour {
+		assert.True(t, srv.allowAbuseReport("203.0.113.9"))
+	}
+	assert.False(t, srv.allowAbuseReport("203.0.113.9"))
+	assert.True(t, srv.allowAbuseReport("203.0.113.10"), "limits are per visitor IP")
+}
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, "abc", truncate("abc", 5))
+	assert.Equal(t, "ab", truncate("abcdef", 2))
+	assert.Equal(t, "п", truncate("пр", 3), "a rune is never split")
+}
+
+func TestApplySuspensions_SyncsWithDatabase(t *testing.T) {
+	_, srv := newTestRouter("example.com")
+	defer srv.cancel()
+
+	assert.ElementsMatch(t, []string{"phish", "spam"}, srv.applySuspensions([]string{"Phish", "spam"}))
+	assert.True(t, srv.isSuspended("phish"))
+
+	srv.SuspendSubdomain("local")
+	srv.UnsuspendSubdomain("spam")
+	assert.Empty(t, srv.applySuspensions([]string{"phish", "spam"}), "stale read")
+	assert.True(t, srv.isSuspended("local"), "suspended here since the last sync")
+	assert.False(t, srv.isSuspended("spam"), "lifted here since the last sync")
+
+	assert.Equal(t, []string{"local"}, srv.applySuspensions([]string{"local"}))
+	assert.False(t, srv.isSuspended("phish"), "lifted on another node")
+	assert.True(t, srv.isSuspended("local"))
+}
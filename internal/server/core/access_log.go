@@ -0,0 +1,329 @@
+package core
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+)
+
+const (
+	defaultAccessLogBuffer = 4096
+	// accessLogFlushInterval bounds how long written entries may sit in the
+	// write buffer while traffic is low.
+	accessLogFlushInterval = time.Second
+)
+
+// accessLogEntry is one request proxied through an HTTP tunnel.
+type accessLogEntry struct {
+	Time      time.Time
+	RemoteIP  string
+	Host      string
+	Subdomain string
+	Method    string
+	URI       string
+	Proto     string
+	Status    int
+	Bytes     int64
+	Duration  time.Duration
+	Referer   string
+	UserAgent string
+}
+
+// accessLogger writes access log entries from a single goroutine. Requests
+// only enqueue their entry; when the queue is full the entry is dropped, so
+// a slow or stuck log file never delays the proxy.
+type accessLogger struct {
+	format  string
+	out     io.Writer
+	closer  io.Closer // nil for stdout
+	w       *bufio.Writer
+	log     zerolog.Logger
+	entries chan accessLogEntry
+	stop    chan struct{}
+	done    chan struct{}
+	dropped atomic.Int64
+}
+
+// newAccessLogger opens the access log cfg describes and starts its writer.
+// It returns nil when the access log is disabled.
+func newAccessLogger(cfg config.AccessLogSettings, log zerolog.Logger) (*accessLogger, error) {
+	if cfg.Path == "" {
+		return nil, nil
+	}
+
+	l := &accessLogger{
+		format: cfg.Format,
+		log:    log.With().Str("component", "access_log").Logger(),
+	}
+	if cfg.Path == "stdout" {
+		l.out = os.Stdout
+	} else {
+		f, err := os.OpenFile(cfg.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o640)
+		if err != nil {
+			return nil, err
+		}
+		l.out, l.closer = f, f
+	}
+	return l.start(cfg.BufferSize), nil
+}
+
+func (l *accessLogger) start(bufferSize int) *accessLogger {
+	if bufferSize <= 0 {
+		bufferSize = defaultAccessLogBuffer
+	}
+	l.w = bufio.NewWriter(l.out)
+	l.entries = make(chan accessLogEntry, bufferSize)
+	l.stop = make(chan struct{})
+	l.done = make(chan struct{})
+	go l.run()
+	return l
+}
+
+// record queues e for writing without blocking.
+func (l *accessLogger) record(e accessLogEntry) {
+	select {
+	case l.entries <- e:
+	default:
+		l.dropped.Add(1)
+	}
+}
+
+func (l *accessLogger) run() {
+	defer close(l.done)
+	ticker := time.NewTicker(accessLogFlushInterval)
+	defer ticker.Stop()
+
+	var buf []byte
+	write := func(e accessLogEntry) {
+		buf = l.appendEntry(buf[:0], e)
+		if _, err := l.w.Write(buf); err != nil {
+			l.log.Warn().Err(err).Msg("Failed to write access log")
+		}
+	}
+	for {
+		select {
+		case e := <-l.entries:
+			write(e)
+		case <-ticker.C:
+			l.flush()
+		case <-l.stop:
+			for {
+				select {
+				case e := <-l.entries:
+					write(e)
+				default:
+					l.flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (l *accessLogger) flush() {
+	if err := l.w.Flush(); err != nil {
+		l.log.Warn().Err(err).Msg("Failed to write access log")
+	}
+	if n := l.dropped.Swap(0); n > 0 {
+		l.log.Warn().Int64("dropped", n).Msg("Access log entries dropped, writer is falling behind")
+	}
+}
+
+// close writes the queued entries and closes the log file. Upgraded
+// connections may still be open at shutdown; what they record afterwards is
+// discarded. A nil logger is a no-op.
+func (l *accessLogger) close() {
+	if l == nil {
+		return
+	}
+	close(l.stop)
+	<-l.done
+	if l.closer != nil {
+		_ = l.closer.Close()
+	}
+}
+
+func (l *accessLogger) appendEntry(buf []byte, e accessLogEntry) []byte {
+	if l.format == config.AccessLogJSON {
+		return appendAccessLogJSON(buf, e)
+	}
+	return appendAccessLogCombined(buf, e)
+}
+
+// appendAccessLogCombined formats e in the combined log format followed by
+// the host and the duration in milliseconds:
+//
+//	1.2.3.4 - - [02/Jan/2006:15:04:05 -0700] "GET / HTTP/1.1" 200 512 "-" "curl/8.0" "app.example.com" 12
+func appendAccessLogCombined(buf []byte, e accessLogEntry) []byte {
+	buf = append(buf, e.RemoteIP...)
+	buf = append(buf, " - - ["...)
+	buf = e.Time.AppendFormat(buf, "02/Jan/2006:15:04:05 -0700")
+	buf = append(buf, "] "...)
+	buf = appendQuotedLogField(buf, e.Method+" "+e.URI+" "+e.Proto)
+	buf = append(buf, ' ')
+	buf = strconv.AppendInt(buf, int64(e.Status), 10)
+	buf = append(buf, ' ')
+	if e.Bytes > 0 {
+		buf = strconv.AppendInt(buf, e.Bytes, 10)
+	} else {
+		buf = append(buf, '-')
+	}
+	buf = append(buf, ' ')
+	buf = appendQuotedLogField(buf, e.Referer)
+	buf = append(buf, ' ')
+	buf = appendQuotedLogField(buf, e.UserAgent)
+	buf = append(buf, ' ')
+	buf = appendQuotedLogField(buf, e.Host)
+	buf = append(buf, ' ')
+	buf = strconv.AppendInt(buf, e.Duration.Milliseconds(), 10)
+	return append(buf, '\n')
+}
+
+// appendQuotedLogField appends s in double quotes, or "-" when empty.
+// Quotes, backslashes and control characters are escaped as \xHH so a
+// crafted header cannot forge log lines.
+func appendQuotedLogField(buf []byte, s string) []byte {
+	if s == "" {
+		return append(buf, `"-"`...)
+	}
+	buf = append(buf, '"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '"' || c == '\\' || c < 0x20 || c == 0x7f {
+			buf = fmt.Appendf(buf, `\x%02X`, c)
+			continue
+		}
+		buf = append(buf, c)
+	}
+	return append(buf, '"')
+}
+
+type accessLogJSON struct {
+	Time       time.Time `json:"time"`
+	RemoteIP   string    `json:"remote_ip"`
+	Host       string    `json:"host"`
+	Subdomain  string    `json:"subdomain,omitempty"`
+	Method     string    `json:"method"`
+	URI        string    `json:"uri"`
+	Proto      string    `json:"proto"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	DurationMs float64   `json:"duration_ms"`
+	Referer    string    `json:"referer,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+}
+
+func appendAccessLogJSON(buf []byte, e accessLogEntry) []byte {
+	data, _ := json.Marshal(accessLogJSON{
+		Time:       e.Time,
+		RemoteIP:   e.RemoteIP,
+		Host:       e.Host,
+		Subdomain:  e.Subdomain,
+		Method:     e.Method,
+		URI:        e.URI,
+		Proto:      e.Proto,
+		Status:     e.Status,
+		Bytes:      e.Bytes,
+		DurationMs: float64(e.Duration.Microseconds()) / 1000,
+		Referer:    e.Referer,
+		UserAgent:  e.UserAgent,
+	})
+	buf = append(buf, data...)
+	return append(buf, '\n')
+}
+
+// accessLogWriter records the status and body size of a response for the
+// access log. It passes flushing and hijacking through to the wrapped
+// writer.
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *accessLogWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessLogWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *accessLogWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack hands the connection over for an upgrade. The upgraded stream is
+// not seen by the writer, so the request is logged as 101 Switching
+// Protocols with no body.
+func (w *accessLogWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("hijacking not supported")
+	}
+	conn, rw, err := hj.Hijack()
+	if err == nil && w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+func (w *accessLogWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// logAccess wraps w so the request can be recorded once served. The returned
+// function records it and must be deferred.
+func (r *HTTPRouter) logAccess(w http.ResponseWriter, req *http.Request) (http.ResponseWriter, func()) {
+	// Resolve the client address now: the proxy rewrites the forwarding
+	// headers before the request is done.
+	remoteIP := req.RemoteAddr
+	if ip := extractClientIP(req, r.server.trustedProxies); ip != nil {
+		remoteIP = ip.String()
+	}
+	start := time.Now()
+	rec := &accessLogWriter{ResponseWriter: w}
+
+	return rec, func() {
+		status := rec.status
+		if status == 0 {
+			// net/http answers 200 when the handler wrote nothing
+			status = http.StatusOK
+		}
+		r.accessLog.record(accessLogEntry{
+			Time:      start,
+			RemoteIP:  remoteIP,
+			Host:      req.Host,
+			Subdomain: r.extractSubdomain(req.Host),
+			Method:    req.Method,
+			URI:       req.URL.RequestURI(),
+			Proto:     req.Proto,
+			Status:    status,
+			Bytes:     rec.bytes,
+			Duration:  time.Since(start),
+			Referer:   req.Referer(),
+			UserAgent: req.UserAgent(),
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+)
+
+func testAccessLogEntry() accessLogEntry {
+	return accessLogEntry{
+		Time:      time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC),
+		RemoteIP:  "203.0.113.9",
+		Host:      "app.example.com",
+		Subdomain: "app",
+		Method:    "GET",
+		URI:       "/search?q=1",
+		Proto:     "HTTP/1.1",
+		Status:    200,
+		Bytes:     512,
+		Duration:  12500 * time.Microsecond,
+		UserAgent: "curl/8.0\n\"fake\"",
+	}
+}
+
+func TestAccessLog_CombinedFormat(t *testing.T) {
+	line := string(appendAccessLogCombined(nil, testAccessLogEntry()))
+	assert.Equal(t, `203.0.113.9 - - [04/Mar/2026:05:06:07 +0000] "GET /search?q=1 HTTP/1.1" 200 512 "-" "curl/8.0\x0A\x22fake\x22" "app.example.com" 12`+"\n", line)
+}
+
+func TestAccessLog_JSONFormat(t *testing.T) {
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(appendAccessLogJSON(nil, testAccessLogEntry()), &got))
+	assert.Equal(t, "app", got["subdomain"])
+	assert.Equal(t, "/search?q=1", got["uri"])
+	assert.Equal(t, float64(200), got["status"])
+	assert.Equal(t, float64(512), got["bytes"])
+	assert.Equal(t, 12.5, got["duration_ms"])
+	assert.NotContains(t, got, "referer")
+}
+
+func TestHTTPRouter_AccessLog(t *testing.T) {
+	router, _ := newTestRouter("example.com")
+	path := filepath.Join(t.TempDir(), "access.log")
+	accessLog, err := newAccessLogger(config.AccessLogSettings{Path: path, Format: config.AccessLogJSON}, zerolog.Nop())
+	require.NoError(t, err)
+	router.accessLog = accessLog
+
+	req := httptest.NewRequest("GET", "http://missing.example.com/page", nil)
+	req.RemoteAddr = "198.51.100.7:40000"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusNotFound, w.Code)
+
+	accessLog.close()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(data, &entry))
+	assert.Equal(t, "198.51.100.7", entry["remote_ip"])
+	assert.Equal(t, "missing", entry["subdomain"])
+	assert.Equal(t, "/page", entry["uri"])
+	assert.Equal(t, float64(http.StatusNotFound), entry["status"])
+	assert.Equal(t, float64(w.Body.Len()), entry["bytes"])
+}
+
+// blockingWriter stalls every write until release is closed.
+type blockingWriter struct {
+	release chan struct{}
+	mu      sync.Mutex
+	buf     bytes.Buffer
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.release
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+func TestAccessLogger_DropsWhenFull(t *testing.T) {
+	out := &blockingWriter{release: make(chan struct{})}
+	l := (&accessLogger{out: out, log: zerolog.Nop()}).start(2)
+
+	// The writer is stuck, so all but a few entries are dropped instead of
+	// blocking the caller
+	recorded := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			l.record(testAccessLogEntry())
+		}
+		close(recorded)
+	}()
+	select {
+	case <-recorded:
+	case <-time.After(2 * time.Second):
+		t.Fatal("record blocked on a stuck writer")
+	}
+	assert.Positive(t, l.dropped.Load())
+
+	close(out.release)
+	l.close()
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	assert.Positive(t, strings.Count(out.buf.String(), "\n"))
+}
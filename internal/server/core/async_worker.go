@@ -0,0 +1,63 @@
+package core
+
+import "context"
+
+// asyncWorker hands queued items to a handler running in a single
+// goroutine. The control plane only queues; when the queue is full push
+// drops the item, so a slow handler (webhook endpoint, reputation service)
+// never delays tunnels.
+type asyncWorker[T any] struct {
+	queue  chan T
+	handle func(ctx context.Context, item T)
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// newAsyncWorker starts a worker with room for size queued items. handle
+// gets a context that is canceled by close.
+func newAsyncWorker[T any](size int, handle func(ctx context.Context, item T)) *asyncWorker[T] {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &asyncWorker[T]{
+		queue:  make(chan T, size),
+		handle: handle,
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// push queues item without blocking and reports whether there was room.
+func (w *asyncWorker[T]) push(item T) bool {
+	select {
+	case w.queue <- item:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *asyncWorker[T]) run() {
+	defer close(w.done)
+	for {
+		select {
+		case item := <-w.queue:
+			w.handle(w.ctx, item)
+			if w.ctx.Err() != nil {
+				return
+			}
+		case <-w.ctx.Done():
+			return
+		}
+	}
+}
+
+// close stops the worker, aborting the item in progress through its
+// context, and returns how many queued items were discarded.
+func (w *asyncWorker[T]) close() int {
+	w.cancel()
+	<-w.done
+	return len(w.queue)
+}
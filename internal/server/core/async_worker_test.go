@@ -0,0 +1,22 @@
+package core
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAsyncWorker_DropsWhenFullAndAbortsOnClose(t *testing.T) {
+	started := make(chan int)
+	w := newAsyncWorker(1, func(ctx context.Context, item int) {
+		started <- item
+		<-ctx.Done()
+	})
+
+	assert.True(t, w.push(1))
+	assert.Equal(t, 1, <-started)
+	assert.True(t, w.push(2))
+	assert.False(t, w.push(3), "queue full")
+	assert.Equal(t, 1, w.close(), "queued item discarded")
+}
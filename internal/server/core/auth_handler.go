@@ -10,6 +10,7 @@ import (
 	"net"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/hashicorp/yamux"
 	"github.com/rs/zerolog"
@@ -72,6 +73,7 @@ func (s *Server) authenticate(conn net.Conn, session *yamux.Session, controlStre
 			client := s.createClientFromDBToken(conn, session, controlStream, codec, apiToken, log)
 			client.SessionSecret = generateSessionSecret()
 			client.SessionSecretExpiry = time.Now().Add(5 * time.Minute)
+			client.Hostname = clientHostname(authMsg.Hostname)
 
 			// Update last used
 			if err := s.db.Tokens.UpdateLastUsed(apiToken.ID); err != nil {
@@ -82,9 +84,10 @@ func (s *Server) authenticate(conn net.Conn, session *yamux.Session, controlStre
 			s.clientMgr.linkUserClient(apiToken.UserID, client.ID)
 
 			// Compute effective max tunnels
+			plan := client.currentPlan()
 			maxTunnels := apiToken.MaxTunnels
-			if client.Plan != nil && !IsUnlimited(client.Plan.MaxTunnels) && client.Plan.MaxTunnels < maxTunnels {
-				maxTunnels = client.Plan.MaxTunnels
+			if plan != nil && !IsUnlimited(plan.MaxTunnels) && plan.MaxTunnels < maxTunnels {
+				maxTunnels = plan.MaxTunnels
 			}
 
 			// Send success
@@ -93,14 +96,15 @@ func (s *Server) authenticate(conn net.Conn, session *yamux.Session, controlStre
 				Success:         true,
 				ClientID:        client.ID,
 				MaxTunnels:      maxTunnels,
-				MaxDataSessions: effectiveMaxDataSessions(client.Plan),
+				MaxDataSessions: effectiveMaxDataSessions(plan),
 				ServerName:      s.cfg.Domain.Base,
 				SessionID:       client.ID,
 				SessionSecret:   client.SessionSecret,
 				MinVersion:      s.cfg.Server.MinVersion,
-				Capabilities:    buildCapabilities(client.Plan, client.IsAdmin),
+				Capabilities:    buildCapabilities(plan, client.IsAdmin),
 			}
-			if err := codec.Encode(result); err != nil {
+			s.negotiate(client, authMsg, result)
+			if err := sendAuthResult(client, codec, result); err != nil {
 				client.Close()
 				return nil, fmt.Errorf("send auth result: %w", err)
 			}
@@ -140,15 +144,17 @@ func (s *Server) authenticate(conn net.Conn, session *yamux.Session, controlStre
 			client := s.createClientFromJWT(conn, session, controlStream, codec, claims, log)
 			client.SessionSecret = generateSessionSecret()
 			client.SessionSecretExpiry = time.Now().Add(5 * time.Minute)
+			client.Hostname = clientHostname(authMsg.Hostname)
 
 			// Link user to client
 			s.clientMgr.linkUserClient(claims.UserID, client.ID)
 
 			// Compute effective max tunnels for JWT auth
+			plan := client.currentPlan()
 			maxTunnels := 10
-			if client.Plan != nil && !IsUnlimited(client.Plan.MaxTunnels) {
-				maxTunnels = client.Plan.MaxTunnels
-			} else if client.Plan != nil && IsUnlimited(client.Plan.MaxTunnels) {
+			if plan != nil && !IsUnlimited(plan.MaxTunnels) {
+				maxTunnels = plan.MaxTunnels
+			} else if plan != nil && IsUnlimited(plan.MaxTunnels) {
 				maxTunnels = -1
 			}
 
@@ -158,14 +164,15 @@ func (s *Server) authenticate(conn net.Conn, session *yamux.Session, controlStre
 				Success:         true,
 				ClientID:        client.ID,
 				MaxTunnels:      maxTunnels,
-				MaxDataSessions: effectiveMaxDataSessions(client.Plan),
+				MaxDataSessions: effectiveMaxDataSessions(plan),
 				ServerName:      s.cfg.Domain.Base,
 				SessionID:       client.ID,
 				SessionSecret:   client.SessionSecret,
 				MinVersion:      s.cfg.Server.MinVersion,
-				Capabilities:    buildCapabilities(client.Plan, client.IsAdmin),
+				Capabilities:    buildCapabilities(plan, client.IsAdmin),
 			}
-			if err := codec.Encode(result); err != nil {
+			s.negotiate(client, authMsg, result)
+			if err := sendAuthResult(client, codec, result); err != nil {
 				client.Close()
 				return nil, fmt.Errorf("send auth result: %w", err)
 			}
@@ -192,6 +199,7 @@ func (s *Server) authenticate(conn net.Conn, session *yamux.Session, controlStre
 		client := s.createClient(conn, session, controlStream, codec, tokenCfg, log)
 		client.SessionSecret = generateSessionSecret()
 		client.SessionSecretExpiry = time.Now().Add(5 * time.Minute)
+		client.Hostname = clientHostname(authMsg.Hostname)
 
 		// Send success
 		result := &protocol.AuthResultMessage{
@@ -199,14 +207,15 @@ func (s *Server) authenticate(conn net.Conn, session *yamux.Session, controlStre
 			Success:         true,
 			ClientID:        client.ID,
 			MaxTunnels:      tokenCfg.MaxTunnels,
-			MaxDataSessions: effectiveMaxDataSessions(client.Plan),
+			MaxDataSessions: effectiveMaxDataSessions(client.currentPlan()),
 			ServerName:      s.cfg.Domain.Base,
 			SessionID:       client.ID,
 			SessionSecret:   client.SessionSecret,
 			MinVersion:      s.cfg.Server.MinVersion,
-			Capabilities:    buildCapabilities(client.Plan, client.IsAdmin),
+			Capabilities:    buildCapabilities(client.currentPlan(), client.IsAdmin),
 		}
-		if err := codec.Encode(result); err != nil {
+		s.negotiate(client, authMsg, result)
+		if err := sendAuthResult(client, codec, result); err != nil {
 			client.Close()
 			return nil, fmt.Errorf("send auth result: %w", err)
 		}
@@ -218,20 +227,22 @@ func (s *Server) authenticate(conn net.Conn, session *yamux.Session, controlStre
 	client := s.createClient(conn, session, controlStream, codec, nil, log)
 	client.SessionSecret = generateSessionSecret()
 	client.SessionSecretExpiry = time.Now().Add(5 * time.Minute)
+	client.Hostname = clientHostname(authMsg.Hostname)
 
 	result := &protocol.AuthResultMessage{
 		Message:         protocol.NewMessage(protocol.MsgAuthResult),
 		Success:         true,
 		ClientID:        client.ID,
 		MaxTunnels:      10, // Default limit
-		MaxDataSessions: effectiveMaxDataSessions(client.Plan),
+		MaxDataSessions: effectiveMaxDataSessions(client.currentPlan()),
 		ServerName:      s.cfg.Domain.Base,
 		SessionID:       client.ID,
 		SessionSecret:   client.SessionSecret,
 		MinVersion:      s.cfg.Server.MinVersion,
-		Capabilities:    buildCapabilities(client.Plan, client.IsAdmin),
+		Capabilities:    buildCapabilities(client.currentPlan(), client.IsAdmin),
 	}
-	if err := codec.Encode(result); err != nil {
+	s.negotiate(client, authMsg, result)
+	if err := sendAuthResult(client, codec, result); err != nil {
 		client.Close()
 		return nil, fmt.Errorf("send auth result: %w", err)
 	}
@@ -347,6 +358,25 @@ func (s *Server) createClient(conn net.Conn, session *yamux.Session, controlStre
 	return client
 }
 
+// maxHostnameLen caps the hostname a client reports; DNS names are no
+// longer than this.
+const maxHostnameLen = 253
+
+// clientHostname cleans up the hostname a client reports at auth so it can
+// be shown in the user's list of connected clients.
+func clientHostname(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) > maxHostnameLen {
+		s = s[:maxHostnameLen]
+	}
+	return strings.Map(func(r rune) rune {
+		if unicode.IsPrint(r) {
+			return r
+		}
+		return -1
+	}, s)
+}
+
 // generateSessionSecret creates a random secret for session pooling.
 func generateSessionSecret() string {
 	b := make([]byte, 32)
@@ -604,6 +634,7 @@ func (s *Server) authenticateViaHub(conn net.Conn, session *yamux.Session, contr
 	client.lastPing.Store(time.Now().UnixNano())
 	client.SessionSecret = generateSessionSecret()
 	client.SessionSecretExpiry = time.Now().Add(5 * time.Minute)
+	client.Hostname = clientHostname(authMsg.Hostname)
 
 	maxTunnels := info.MaxTunnels
 	if maxTunnels == 0 {
@@ -624,7 +655,8 @@ func (s *Server) authenticateViaHub(conn net.Conn, session *yamux.Session, contr
 			InspectorEnabled: info.InspectorEnabled,
 		},
 	}
-	if err := codec.Encode(result); err != nil {
+	s.negotiate(client, authMsg, result)
+	if err := sendAuthResult(client, codec, result); err != nil {
 		cancel()
 		return nil, fmt.Errorf("send auth result: %w", err)
 	}
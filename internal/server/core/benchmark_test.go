@@ -52,7 +52,7 @@ func newBenchEnv(b *testing.B) *benchEnv {
 	go srv.handleControlConnection(serverConn)
 
 	// Compression handshake (client side, no compression in benchmarks)
-	rwc, _, err := protocol.NegotiateCompression(clientConn, false, false)
+	rwc, _, err := protocol.NegotiateCompression(clientConn, nil, false)
 	if err != nil {
 		b.Fatalf("NegotiateCompression: %v", err)
 	}
@@ -2,7 +2,10 @@ package core
 
 import (
 	"fmt"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/rs/zerolog"
 
@@ -13,6 +16,7 @@ import (
 //  1. userClientsMu
 //  2. clientsMu
 //  3. client.TunnelsMu
+//  4. tunnelWarnMu
 //
 // Always acquire in this order. Never hold a higher-numbered lock
 // while acquiring a lower-numbered one.
@@ -25,14 +29,20 @@ type ClientManager struct {
 	userClientsMu  sync.RWMutex
 	tunnelCreateMu sync.Map // int64(userID) -> *sync.Mutex — serializes tunnel creation per user
 	log            zerolog.Logger
+
+	tunnelWarnThreshold int          // soft per-user tunnel cap, 0 = off
+	tunnelWarnings      atomic.Int64 // times a user reached the soft cap
+	tunnelWarnMu        sync.Mutex
+	tunnelWarnedAt      map[int64]int // userID -> multiple of the soft cap last warned at
 }
 
 // NewClientManager creates a new ClientManager.
 func NewClientManager(log zerolog.Logger) *ClientManager {
 	return &ClientManager{
 		clients:     make(map[string]*Client),
-		userClients: make(map[int64][]string),
-		log:         log,
+		userClients:    make(map[int64][]string),
+		log:            log,
+		tunnelWarnedAt: make(map[int64]int),
 	}
 }
 
@@ -96,9 +106,30 @@ func (cm *ClientManager) unlinkUserClient(userID int64, clientID string) {
 
 	if len(cm.userClients[userID]) == 0 {
 		delete(cm.userClients, userID)
+		cm.tunnelWarnMu.Lock()
+		delete(cm.tunnelWarnedAt, userID)
+		cm.tunnelWarnMu.Unlock()
 	}
 }
 
+// userClientList returns the connected clients of a user.
+func (cm *ClientManager) userClientList(userID int64) []*Client {
+	cm.userClientsMu.RLock()
+	clientIDs := cm.userClients[userID]
+	cm.userClientsMu.RUnlock()
+
+	cm.clientsMu.RLock()
+	defer cm.clientsMu.RUnlock()
+
+	clients := make([]*Client, 0, len(clientIDs))
+	for _, clientID := range clientIDs {
+		if client, ok := cm.clients[clientID]; ok {
+			clients = append(clients, client)
+		}
+	}
+	return clients
+}
+
 // GetTunnelsByUserID returns all tunnels for a user.
 func (cm *ClientManager) GetTunnelsByUserID(userID int64) []TunnelInfo {
 	var tunnels []TunnelInfo
@@ -118,17 +149,7 @@ func (cm *ClientManager) GetTunnelsByUserID(userID int64) []TunnelInfo {
 
 		client.TunnelsMu.RLock()
 		for _, tunnel := range client.Tunnels {
-			tunnels = append(tunnels, TunnelInfo{
-				ID:         tunnel.ID,
-				Type:       string(tunnel.Type),
-				Name:       tunnel.Name,
-				Subdomain:  tunnel.Subdomain,
-				RemotePort: tunnel.RemotePort,
-				LocalPort:  tunnel.LocalPort,
-				ClientID:   tunnel.ClientID,
-				UserID:     client.UserID,
-				CreatedAt:  tunnel.Created,
-			})
+			tunnels = append(tunnels, newTunnelInfo(client, tunnel))
 		}
 		client.TunnelsMu.RUnlock()
 	}
@@ -136,6 +157,155 @@ func (cm *ClientManager) GetTunnelsByUserID(userID int64) []TunnelInfo {
 	return tunnels
 }
 
+// newTunnelInfo describes a tunnel of client for the API. The caller holds
+// client.TunnelsMu.
+func newTunnelInfo(client *Client, tunnel *Tunnel) TunnelInfo {
+	return TunnelInfo{
+		ID:           tunnel.ID,
+		Type:         string(tunnel.Type),
+		Name:         tunnel.Name,
+		Subdomain:    tunnel.Subdomain,
+		RemotePort:   tunnel.RemotePort,
+		LocalPort:    tunnel.LocalPort,
+		ClientID:     tunnel.ClientID,
+		UserID:       client.UserID,
+		CreatedAt:    tunnel.Created,
+		Health:       tunnel.healthSnapshot(),
+		LastActivity: time.Unix(0, tunnel.LastActivity.Load()),
+	}
+}
+
+// GetClientsByUserID returns the connected clients of a user with their
+// tunnels, oldest connection first.
+func (cm *ClientManager) GetClientsByUserID(userID int64) []ClientInfo {
+	return clientInfos(cm.userClientList(userID))
+}
+
+// GetAllClients returns every connected client with its tunnels, oldest
+// connection first (for admin).
+func (cm *ClientManager) GetAllClients() []ClientInfo {
+	return clientInfos(cm.allClients())
+}
+
+func clientInfos(clients []*Client) []ClientInfo {
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].Connected.Before(clients[j].Connected)
+	})
+
+	infos := make([]ClientInfo, 0, len(clients))
+	for _, client := range clients {
+		info := ClientInfo{
+			ID:          client.ID,
+			Hostname:    client.Hostname,
+			RemoteAddr:  client.RemoteAddr,
+			UserID:      client.UserID,
+			ConnectedAt: client.Connected,
+			Tunnels:     []TunnelInfo{},
+			Sessions:    client.sessionPressure(),
+		}
+		client.TunnelsMu.RLock()
+		for _, tunnel := range client.Tunnels {
+			info.Tunnels = append(info.Tunnels, newTunnelInfo(client, tunnel))
+		}
+		client.TunnelsMu.RUnlock()
+		sort.Slice(info.Tunnels, func(i, j int) bool {
+			return info.Tunnels[i].CreatedAt.Before(info.Tunnels[j].CreatedAt)
+		})
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// DisconnectClient closes one of the user's clients. The client is told the
+// disconnect is final, so it exits instead of reconnecting.
+func (cm *ClientManager) DisconnectClient(clientID string, userID int64) error {
+	var client *Client
+	for _, c := range cm.userClientList(userID) {
+		if c.ID == clientID {
+			client = c
+			break
+		}
+	}
+	if client == nil {
+		return fmt.Errorf("client not found")
+	}
+
+	client.disconnect("disconnected from the dashboard")
+	client.log.Info().Msg("Client disconnected by its owner")
+	return nil
+}
+
+// AdminDisconnectClient closes any client by ID (admin only, no user check).
+// Like DisconnectClient, the disconnect is final.
+func (cm *ClientManager) AdminDisconnectClient(clientID string) error {
+	client := cm.GetClient(clientID)
+	if client == nil {
+		return fmt.Errorf("client not found")
+	}
+
+	client.disconnect("disconnected by an administrator")
+	client.log.Warn().Int64("user_id", client.UserID).Str("remote_addr", client.RemoteAddr).
+		Msg("Client disconnected by an administrator")
+	return nil
+}
+
+// disconnect sends the client a fatal error, so it exits instead of
+// reconnecting, and closes it.
+func (c *Client) disconnect(reason string) {
+	_ = c.sendControl(&protocol.ErrorMessage{
+		Message: protocol.NewMessage(protocol.MsgError),
+		Error:   reason,
+		Code:    protocol.ErrCodeDisconnected,
+		Fatal:   true,
+	})
+	c.Close()
+}
+
+// GetTunnelHealth returns the health check state of a user's tunnel, including
+// its probe history.
+func (cm *ClientManager) GetTunnelHealth(tunnelID string, userID int64) *TunnelHealth {
+	cm.userClientsMu.RLock()
+	clientIDs := cm.userClients[userID]
+	cm.userClientsMu.RUnlock()
+
+	cm.clientsMu.RLock()
+	defer cm.clientsMu.RUnlock()
+
+	for _, clientID := range clientIDs {
+		client, ok := cm.clients[clientID]
+		if !ok {
+			continue
+		}
+
+		client.TunnelsMu.RLock()
+		tunnel, exists := client.Tunnels[tunnelID]
+		client.TunnelsMu.RUnlock()
+		if exists && tunnel.health != nil {
+			return tunnel.health.snapshot(true)
+		}
+	}
+
+	return nil
+}
+
+// PurgeTunnelCache drops the stored responses of a user's HTTP tunnel and
+// returns how many there were. Tunnels without a response cache purge none.
+func (cm *ClientManager) PurgeTunnelCache(tunnelID string, userID int64) (int, error) {
+	for _, client := range cm.userClientList(userID) {
+		client.TunnelsMu.RLock()
+		tunnel, exists := client.Tunnels[tunnelID]
+		client.TunnelsMu.RUnlock()
+		if !exists {
+			continue
+		}
+		if tunnel.cache == nil {
+			return 0, nil
+		}
+		return tunnel.cache.purge(), nil
+	}
+	return 0, fmt.Errorf("tunnel not found")
+}
+
 // GetAllTunnels returns all tunnels from all clients.
 func (cm *ClientManager) GetAllTunnels() []TunnelInfo {
 	var tunnels []TunnelInfo
@@ -146,17 +316,7 @@ func (cm *ClientManager) GetAllTunnels() []TunnelInfo {
 	for _, client := range cm.clients {
 		client.TunnelsMu.RLock()
 		for _, tunnel := range client.Tunnels {
-			tunnels = append(tunnels, TunnelInfo{
-				ID:         tunnel.ID,
-				Type:       string(tunnel.Type),
-				Name:       tunnel.Name,
-				Subdomain:  tunnel.Subdomain,
-				RemotePort: tunnel.RemotePort,
-				LocalPort:  tunnel.LocalPort,
-				ClientID:   tunnel.ClientID,
-				UserID:     client.UserID,
-				CreatedAt:  tunnel.Created,
-			})
+			tunnels = append(tunnels, newTunnelInfo(client, tunnel))
 		}
 		client.TunnelsMu.RUnlock()
 	}
@@ -183,6 +343,23 @@ func (cm *ClientManager) AdminCloseTunnel(tunnelID string) error {
 	return fmt.Errorf("tunnel not found")
 }
 
+// findTunnel returns the tunnel with the given ID and the client that owns it.
+func (cm *ClientManager) findTunnel(tunnelID string) (*Client, *Tunnel) {
+	cm.clientsMu.RLock()
+	defer cm.clientsMu.RUnlock()
+
+	for _, client := range cm.clients {
+		client.TunnelsMu.RLock()
+		tunnel, exists := client.Tunnels[tunnelID]
+		client.TunnelsMu.RUnlock()
+
+		if exists {
+			return client, tunnel
+		}
+	}
+	return nil, nil
+}
+
 // CloseTunnelByID closes a tunnel by ID for a specific user.
 func (cm *ClientManager) CloseTunnelByID(tunnelID string, userID int64) error {
 	cm.userClientsMu.RLock()
@@ -219,6 +396,50 @@ func (cm *ClientManager) GetTunnelCreateMu(userID int64) *sync.Mutex {
 	return v.(*sync.Mutex)
 }
 
+// SetTunnelWarnThreshold sets the soft per-user tunnel cap checked by
+// checkTunnelCount. 0 disables it.
+func (cm *ClientManager) SetTunnelWarnThreshold(n int) {
+	cm.tunnelWarnThreshold = n
+}
+
+// checkTunnelCount logs a warning when a user's tunnel count reaches the
+// soft cap or a further multiple of it, so a runaway client is reported
+// once per step rather than on every new tunnel. Call it after a tunnel was
+// created. A step counts as reached however the count got there, tunnels
+// created in a batch included; once the count falls to a lower step the
+// higher ones are reported again.
+func (cm *ClientManager) checkTunnelCount(userID int64) {
+	threshold := cm.tunnelWarnThreshold
+	if threshold <= 0 || userID == 0 {
+		return
+	}
+	count := cm.CountTunnelsByUserID(userID)
+	step := count / threshold * threshold
+
+	cm.tunnelWarnMu.Lock()
+	last := cm.tunnelWarnedAt[userID]
+	if step == 0 {
+		delete(cm.tunnelWarnedAt, userID)
+	} else {
+		cm.tunnelWarnedAt[userID] = step
+	}
+	cm.tunnelWarnMu.Unlock()
+	if step <= last {
+		return
+	}
+
+	cm.tunnelWarnings.Add(1)
+	cm.userClientsMu.RLock()
+	sessions := len(cm.userClients[userID])
+	cm.userClientsMu.RUnlock()
+	cm.log.Warn().
+		Int64("user_id", userID).
+		Int("tunnels", count).
+		Int("sessions", sessions).
+		Int("threshold", threshold).
+		Msg("User has an abnormal number of tunnels")
+}
+
 // CountTunnelsByUserID returns total tunnel count across all sessions for a user.
 func (cm *ClientManager) CountTunnelsByUserID(userID int64) int {
 	cm.userClientsMu.RLock()
@@ -247,11 +468,16 @@ func (cm *ClientManager) GetStats() Stats {
 	defer cm.clientsMu.RUnlock()
 
 	stats := Stats{
-		ActiveClients: len(cm.clients),
+		ActiveClients:       len(cm.clients),
+		TunnelCountWarnings: cm.tunnelWarnings.Load(),
 	}
 
+	perUser := make(map[int64]int)
 	for _, client := range cm.clients {
 		client.TunnelsMu.RLock()
+		if client.UserID > 0 {
+			perUser[client.UserID] += len(client.Tunnels)
+		}
 		for _, tunnel := range client.Tunnels {
 			stats.ActiveTunnels++
 			switch tunnel.Type {
@@ -261,11 +487,22 @@ func (cm *ClientManager) GetStats() Stats {
 				stats.TCPTunnels++
 			case protocol.TunnelUDP:
 				stats.UDPTunnels++
+				if tunnel.udpFlows != nil {
+					stats.UDPFlows += int(tunnel.udpFlows.active.Load())
+				}
 			}
 		}
 		client.TunnelsMu.RUnlock()
 	}
 
+	if cm.tunnelWarnThreshold > 0 {
+		for _, count := range perUser {
+			if count >= cm.tunnelWarnThreshold {
+				stats.AbnormalTunnelUsers++
+			}
+		}
+	}
+
 	return stats
 }
 
@@ -0,0 +1,159 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+func TestClientManager_TunnelWarnThreshold(t *testing.T) {
+	var logs bytes.Buffer
+	cm := NewClientManager(zerolog.New(&logs))
+	cm.SetTunnelWarnThreshold(3)
+
+	a := &Client{ID: "a", UserID: 7, Tunnels: map[string]*Tunnel{}}
+	b := &Client{ID: "b", UserID: 7, Tunnels: map[string]*Tunnel{}}
+	other := &Client{ID: "c", UserID: 8, Tunnels: map[string]*Tunnel{"o": {ID: "o", Type: protocol.TunnelTCP}}}
+	for _, c := range []*Client{a, b, other} {
+		cm.addClient(c.ID, c)
+		cm.linkUserClient(c.UserID, c.ID)
+	}
+
+	// Tunnels are spread over two sessions of the same user.
+	for i := 1; i <= 7; i++ {
+		owner := a
+		if i%2 == 0 {
+			owner = b
+		}
+		id := fmt.Sprintf("t%d", i)
+		owner.Tunnels[id] = &Tunnel{ID: id, Type: protocol.TunnelHTTP}
+		cm.checkTunnelCount(7)
+	}
+	cm.checkTunnelCount(8)
+
+	// Warned at 3 and 6 tunnels only.
+	assert.Equal(t, 2, strings.Count(logs.String(), "abnormal number of tunnels"))
+	stats := cm.GetStats()
+	assert.Equal(t, 1, stats.AbnormalTunnelUsers)
+	assert.Equal(t, int64(2), stats.TunnelCountWarnings)
+
+	// Checking again at a step already reported, or after skipping past
+	// one, does not repeat the warning.
+	cm.checkTunnelCount(7)
+	for _, id := range []string{"t8", "t9", "t10"} {
+		a.Tunnels[id] = &Tunnel{ID: id, Type: protocol.TunnelHTTP}
+	}
+	cm.checkTunnelCount(7)
+	assert.Equal(t, int64(3), cm.GetStats().TunnelCountWarnings, "10 tunnels reach the step of 9")
+	cm.checkTunnelCount(7)
+	assert.Equal(t, int64(3), cm.GetStats().TunnelCountWarnings)
+
+	// Falling back to a lower step reports the higher ones again.
+	for _, id := range []string{"t4", "t5", "t6", "t7", "t8", "t9", "t10"} {
+		delete(a.Tunnels, id)
+		delete(b.Tunnels, id)
+	}
+	cm.checkTunnelCount(7)
+	b.Tunnels["t4"] = &Tunnel{ID: "t4", Type: protocol.TunnelHTTP}
+	b.Tunnels["t5"] = &Tunnel{ID: "t5", Type: protocol.TunnelHTTP}
+	b.Tunnels["t6"] = &Tunnel{ID: "t6", Type: protocol.TunnelHTTP}
+	cm.checkTunnelCount(7)
+	assert.Equal(t, int64(4), cm.GetStats().TunnelCountWarnings)
+
+	cm.SetTunnelWarnThreshold(0)
+	cm.checkTunnelCount(7)
+	assert.Equal(t, 0, cm.GetStats().AbnormalTunnelUsers)
+	assert.Equal(t, int64(4), cm.GetStats().TunnelCountWarnings)
+}
+
+func TestClientManager_GetClientsByUserID(t *testing.T) {
+	cm := NewClientManager(zerolog.Nop())
+	now := time.Now()
+	server := &Client{ID: "s", UserID: 7, RemoteAddr: "5.6.7.8:4000", Connected: now, Tunnels: map[string]*Tunnel{
+		"t3": {ID: "t3", Type: protocol.TunnelTCP, Created: now},
+	}}
+	laptop := &Client{ID: "l", UserID: 7, Hostname: "laptop", Connected: now.Add(-time.Hour), Tunnels: map[string]*Tunnel{
+		"t2": {ID: "t2", Type: protocol.TunnelTCP, Created: now.Add(-time.Minute)},
+		"t1": {ID: "t1", Type: protocol.TunnelHTTP, Created: now.Add(-time.Hour)},
+	}}
+	other := &Client{ID: "o", UserID: 8, Tunnels: map[string]*Tunnel{}}
+	for _, c := range []*Client{server, laptop, other} {
+		cm.addClient(c.ID, c)
+		cm.linkUserClient(c.UserID, c.ID)
+	}
+
+	clients := cm.GetClientsByUserID(7)
+	require.Len(t, clients, 2)
+	assert.Equal(t, "laptop", clients[0].Hostname, "oldest connection first")
+	require.Len(t, clients[0].Tunnels, 2)
+	assert.Equal(t, "t1", clients[0].Tunnels[0].ID)
+	assert.Equal(t, "5.6.7.8:4000", clients[1].RemoteAddr)
+	assert.Len(t, clients[1].Tunnels, 1)
+
+	assert.Empty(t, cm.GetClientsByUserID(9))
+}
+
+func TestClientManager_DisconnectClient(t *testing.T) {
+	srv := resumeTestServer(t, time.Minute)
+	session := dialServer(t, srv)
+	defer session.Close()
+	codec, _ := openControlStream(t, session)
+	require.NoError(t, codec.Encode(&protocol.AuthMessage{
+		Message:  protocol.NewMessage(protocol.MsgAuth),
+		Hostname: " laptop\n",
+	}))
+	var auth protocol.AuthResultMessage
+	require.NoError(t, codec.Decode(&auth))
+	require.True(t, auth.Success, auth.Error)
+	srv.clientMgr.linkUserClient(7, auth.ClientID)
+
+	clients := srv.GetClientsByUserID(7)
+	require.Len(t, clients, 1)
+	assert.Equal(t, "laptop", clients[0].Hostname)
+
+	assert.Error(t, srv.DisconnectClient(auth.ClientID, 8), "clients of other users are left alone")
+	assert.NotNil(t, srv.GetClient(auth.ClientID))
+
+	require.NoError(t, srv.DisconnectClient(auth.ClientID, 7))
+	var msg protocol.ErrorMessage
+	require.NoError(t, codec.Decode(&msg))
+	assert.Equal(t, protocol.ErrCodeDisconnected, msg.Code)
+	assert.True(t, msg.Fatal, "the client must not reconnect")
+
+	assert.Nil(t, srv.GetClient(auth.ClientID))
+	assert.Empty(t, srv.GetClientsByUserID(7))
+}
+
+func TestClientManager_AdminDisconnectClient(t *testing.T) {
+	srv := resumeTestServer(t, time.Minute)
+	session := dialServer(t, srv)
+	defer session.Close()
+	codec, _ := openControlStream(t, session)
+	require.NoError(t, codec.Encode(&protocol.AuthMessage{Message: protocol.NewMessage(protocol.MsgAuth)}))
+	var auth protocol.AuthResultMessage
+	require.NoError(t, codec.Decode(&auth))
+	require.True(t, auth.Success, auth.Error)
+
+	clients := srv.GetAllClients()
+	require.Len(t, clients, 1)
+	assert.Equal(t, auth.ClientID, clients[0].ID)
+
+	assert.Error(t, srv.AdminDisconnectClient("missing"))
+
+	require.NoError(t, srv.AdminDisconnectClient(auth.ClientID))
+	var msg protocol.ErrorMessage
+	require.NoError(t, codec.Decode(&msg))
+	assert.Equal(t, protocol.ErrCodeDisconnected, msg.Code)
+	assert.True(t, msg.Fatal, "the client must not reconnect")
+
+	assert.Nil(t, srv.GetClient(auth.ClientID))
+	assert.Empty(t, srv.GetAllClients())
+}
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+// errConnectionDeclined is returned by confirmConnection when the client
+// turned the connection down.
+var errConnectionDeclined = errors.New("connection declined by the client")
+
+// defaultConnectionConfirmTimeout applies when
+// server.connection_confirm_timeout is unset.
+const defaultConnectionConfirmTimeout = 5 * time.Second
+
+// confirmConnection announces a visitor connection of a tunnel that
+// confirms connections and waits for the client to accept it, so the client
+// can gate connections before a stream is opened. req carries the request
+// line of HTTP tunnels and is nil for TCP. The error wraps
+// errConnectionDeclined when the client said no; any other error means it
+// did not answer in time or went away.
+func (c *Client) confirmConnection(tunnel *Tunnel, remoteAddr string, req *http.Request) error {
+	connID := generateID()
+	answer := make(chan *protocol.ConnectionAcceptMessage, 1)
+	c.pendingConnsMu.Lock()
+	if c.pendingConns == nil {
+		c.pendingConns = make(map[string]chan *protocol.ConnectionAcceptMessage)
+	}
+	c.pendingConns[connID] = answer
+	c.pendingConnsMu.Unlock()
+	defer func() {
+		c.pendingConnsMu.Lock()
+		delete(c.pendingConns, connID)
+		c.pendingConnsMu.Unlock()
+	}()
+
+	msg := &protocol.NewConnectionMessage{
+		Message:      protocol.NewMessage(protocol.MsgNewConnection),
+		TunnelID:     tunnel.ID,
+		ConnectionID: connID,
+		RemoteAddr:   remoteAddr,
+	}
+	if req != nil {
+		msg.Host = req.Host
+		msg.Method = req.Method
+		msg.Path = req.URL.Path
+	}
+	if err := c.sendControl(msg); err != nil {
+		return fmt.Errorf("announce connection: %w", err)
+	}
+
+	timeout := c.server.cfg.Server.ConnectionConfirmTimeout
+	if timeout <= 0 {
+		timeout = defaultConnectionConfirmTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case accept := <-answer:
+		if accept.Reject {
+			return fmt.Errorf("%w: %s", errConnectionDeclined, accept.Reason)
+		}
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("client did not accept the connection in time")
+	case <-c.ctx.Done():
+		return fmt.Errorf("client disconnected")
+	}
+}
+
+// handleConnectionAccept passes the client's answer to the connection
+// waiting in confirmConnection. Answers for connections that already gave
+// up are dropped.
+func (c *Client) handleConnectionAccept(data []byte) {
+	parsed, err := c.encoding.ParseMessage(data, protocol.MsgConnectionAccept)
+	if err != nil {
+		c.log.Error().Err(err).Msg("Failed to parse connection accept")
+		return
+	}
+	msg := parsed.(*protocol.ConnectionAcceptMessage)
+
+	c.pendingConnsMu.Lock()
+	answer, ok := c.pendingConns[msg.ConnectionID]
+	c.pendingConnsMu.Unlock()
+	if !ok {
+		c.log.Debug().Str("connection_id", msg.ConnectionID).Msg("Connection accept for an unknown connection")
+		return
+	}
+	select {
+	case answer <- msg:
+	default:
+	}
+}
@@ -0,0 +1,118 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+func TestClient_ConfirmConnection(t *testing.T) {
+	srv := resumeTestServer(t, 0)
+	srv.cfg.Server.ConnectionConfirmTimeout = 200 * time.Millisecond
+	serverEnd, clientEnd := net.Pipe()
+	defer serverEnd.Close()
+	defer clientEnd.Close()
+	c := &Client{server: srv, ctx: context.Background(), log: zerolog.Nop(),
+		ControlCodec: protocol.NewCodec(serverEnd, serverEnd)}
+	peer := protocol.NewCodec(clientEnd, clientEnd)
+	tunnel := &Tunnel{ID: "t1"}
+
+	// answer plays the tunnel client: it reads the announcement and, unless
+	// silent, accepts or declines it
+	answer := func(reject, silent bool) <-chan *protocol.NewConnectionMessage {
+		seen := make(chan *protocol.NewConnectionMessage, 1)
+		go func() {
+			var msg protocol.NewConnectionMessage
+			if peer.Decode(&msg) != nil {
+				return
+			}
+			seen <- &msg
+			if silent {
+				return
+			}
+			data, _ := json.Marshal(&protocol.ConnectionAcceptMessage{
+				Message:      protocol.NewMessage(protocol.MsgConnectionAccept),
+				ConnectionID: msg.ConnectionID,
+				Reject:       reject,
+				Reason:       "not today",
+			})
+			c.handleConnectionAccept(data)
+		}()
+		return seen
+	}
+
+	seen := answer(false, false)
+	require.NoError(t, c.confirmConnection(tunnel, "198.51.100.7:40000", nil))
+	msg := <-seen
+	assert.Equal(t, "t1", msg.TunnelID)
+	assert.Equal(t, "198.51.100.7:40000", msg.RemoteAddr)
+
+	answer(true, false)
+	err := c.confirmConnection(tunnel, "198.51.100.7:40001", nil)
+	assert.ErrorIs(t, err, errConnectionDeclined)
+	assert.ErrorContains(t, err, "not today")
+
+	answer(false, true)
+	err = c.confirmConnection(tunnel, "198.51.100.7:40002", nil)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, errConnectionDeclined)
+	assert.Empty(t, c.pendingConns, "connections that gave up are forgotten")
+}
+
+func TestHandleConnection_DeclinedTCP(t *testing.T) {
+	srv := resumeTestServer(t, 0)
+	srv.cfg.Server.TCPPortRange = config.PortRange{Min: 41620, Max: 41630}
+	srv.cfg.Server.ConnectionConfirmTimeout = time.Second
+	srv.tcpManager = NewTCPManager(srv, srv.log)
+
+	session := dialServer(t, srv)
+	defer session.Close()
+	codec, _ := openControlStream(t, session)
+	require.NoError(t, codec.Encode(&protocol.AuthMessage{Message: protocol.NewMessage(protocol.MsgAuth)}))
+	var auth protocol.AuthResultMessage
+	require.NoError(t, codec.Decode(&auth))
+	require.True(t, auth.Success, auth.Error)
+
+	require.NoError(t, codec.Encode(&protocol.TunnelRequestMessage{
+		Message:            protocol.NewMessage(protocol.MsgTunnelRequest),
+		TunnelType:         protocol.TunnelTCP,
+		LocalPort:          22,
+		ConfirmConnections: true,
+	}))
+	var created protocol.TunnelCreatedMessage
+	require.NoError(t, codec.Decode(&created))
+	require.Equal(t, protocol.MsgTunnelCreated, created.Type)
+
+	visitor, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(created.RemotePort)))
+	require.NoError(t, err)
+	defer visitor.Close()
+
+	var announced protocol.NewConnectionMessage
+	require.NoError(t, codec.Decode(&announced))
+	require.Equal(t, protocol.MsgNewConnection, announced.Type)
+	assert.Equal(t, created.TunnelID, announced.TunnelID)
+	require.NoError(t, codec.Encode(&protocol.ConnectionAcceptMessage{
+		Message:      protocol.NewMessage(protocol.MsgConnectionAccept),
+		ConnectionID: announced.ConnectionID,
+		Reject:       true,
+		Reason:       "source not allowed",
+	}))
+
+	// The visitor is hung up on without a stream being forwarded
+	require.NoError(t, visitor.SetReadDeadline(time.Now().Add(2*time.Second)))
+	_, err = visitor.Read(make([]byte, 1))
+	require.Error(t, err)
+	var netErr net.Error
+	assert.False(t, errors.As(err, &netErr) && netErr.Timeout(), "connection closed, not left hanging")
+}
@@ -0,0 +1,101 @@
+package core
+
+import (
+	"net"
+	"sync"
+
+	"github.com/rs/zerolog"
+
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+// connLimiter counts the client connections open at once, in total and per
+// IP. A zero limit is no limit.
+type connLimiter struct {
+	max      int
+	maxPerIP int
+
+	mu    sync.Mutex
+	total int
+	perIP map[string]int
+}
+
+func newConnLimiter(max, maxPerIP int) *connLimiter {
+	return &connLimiter{max: max, maxPerIP: maxPerIP, perIP: make(map[string]int)}
+}
+
+// acquire takes a slot for a connection from ip, or returns why there is
+// none.
+func (l *connLimiter) acquire(ip string) (protocol.RejectReason, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.max > 0 && l.total >= l.max {
+		return protocol.RejectServerFull, false
+	}
+	if l.maxPerIP > 0 && l.perIP[ip] >= l.maxPerIP {
+		return protocol.RejectPerIPLimit, false
+	}
+	l.total++
+	l.perIP[ip]++
+	return 0, true
+}
+
+func (l *connLimiter) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.total--
+	if l.perIP[ip] <= 1 {
+		delete(l.perIP, ip)
+	} else {
+		l.perIP[ip]--
+	}
+}
+
+// limitedConn gives its slot back the first time it is closed, however
+// many times callers close it.
+type limitedConn struct {
+	net.Conn
+	release func()
+	once    sync.Once
+}
+
+func (c *limitedConn) Close() error {
+	c.once.Do(c.release)
+	return c.Conn.Close()
+}
+
+// admitControlConnection checks a new control or data connection from ip
+// against IP bans, the geo policy and the connection limits. The admitted conn is returned
+// wrapped so that closing it frees its slot.
+func (s *Server) admitControlConnection(conn net.Conn, ip string) (net.Conn, protocol.RejectReason, bool) {
+	if s.ipBans != nil {
+		if banned, _, err := s.ipBans.IsBanned(ip); err == nil && banned {
+			return nil, protocol.RejectBanned, false
+		}
+	}
+	if !s.geoAllowed(ip) {
+		return nil, protocol.RejectGeoPolicy, false
+	}
+	if reason, ok := s.connLimits.acquire(ip); !ok {
+		return nil, reason, false
+	}
+	return &limitedConn{Conn: conn, release: func() { s.connLimits.release(ip) }}, 0, true
+}
+
+// rejectControlConnection tells the client why it is refused and closes
+// the connection.
+func (s *Server) rejectControlConnection(conn net.Conn, reason protocol.RejectReason, log zerolog.Logger) {
+	switch reason {
+	case protocol.RejectBanned:
+		s.stats.reject(rejectIPBan)
+	case protocol.RejectGeoPolicy:
+		s.stats.reject(rejectGeoPolicy)
+	default:
+		s.stats.reject(rejectConnLimit)
+	}
+	log.Warn().Str("reason", reason.String()).Msg("Control connection rejected")
+	if err := protocol.RejectConnection(conn, reason); err != nil {
+		log.Debug().Err(err).Msg("Failed to send reject reason")
+	}
+	conn.Close()
+}
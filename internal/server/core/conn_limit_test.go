@@ -0,0 +1,60 @@
+package core
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+func TestConnLimiter(t *testing.T) {
+	l := newConnLimiter(3, 2)
+
+	_, ok := l.acquire("10.0.0.1")
+	require.True(t, ok)
+	_, ok = l.acquire("10.0.0.1")
+	require.True(t, ok)
+	reason, ok := l.acquire("10.0.0.1")
+	assert.False(t, ok)
+	assert.Equal(t, protocol.RejectPerIPLimit, reason)
+
+	_, ok = l.acquire("10.0.0.2")
+	require.True(t, ok)
+	reason, ok = l.acquire("10.0.0.3")
+	assert.False(t, ok)
+	assert.Equal(t, protocol.RejectServerFull, reason)
+
+	l.release("10.0.0.1")
+	_, ok = l.acquire("10.0.0.3")
+	assert.True(t, ok)
+
+	l.release("10.0.0.1")
+	l.release("10.0.0.2")
+	l.release("10.0.0.3")
+	assert.Zero(t, l.total)
+	assert.Empty(t, l.perIP)
+}
+
+func TestConnLimiter_Unlimited(t *testing.T) {
+	l := newConnLimiter(0, 0)
+	for i := 0; i < 100; i++ {
+		_, ok := l.acquire("10.0.0.1")
+		require.True(t, ok)
+	}
+}
+
+func TestLimitedConn_ReleasesOnce(t *testing.T) {
+	l := newConnLimiter(1, 0)
+	_, ok := l.acquire("10.0.0.1")
+	require.True(t, ok)
+
+	a, b := net.Pipe()
+	defer b.Close()
+	conn := &limitedConn{Conn: a, release: func() { l.release("10.0.0.1") }}
+	conn.Close()
+	conn.Close()
+	assert.Zero(t, l.total)
+}
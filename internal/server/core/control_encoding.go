@@ -0,0 +1,49 @@
+package core
+
+import (
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+// negotiate fills the session options of a successful auth result: the
+// resume token, the control encoding and the supported extensions.
+func (s *Server) negotiate(client *Client, authMsg *protocol.AuthMessage, result *protocol.AuthResultMessage) {
+	s.offerResume(client, authMsg, result)
+	if s.cfg.Server.DisableDataSessions {
+		// Without a secret clients do not try to open data connections
+		client.SessionSecret = ""
+		result.SessionSecret = ""
+	}
+	result.TunnelBatch = true
+
+	client.encoding = s.selectEncoding(authMsg.Encodings)
+	if client.encoding != protocol.EncodingJSON {
+		result.Encoding = client.encoding
+	}
+}
+
+// sendAuthResult writes a successful auth result and switches the control
+// codec to the negotiated encoding. The result itself is the last message in
+// JSON: the client switches as soon as it reads it. Switching here, rather
+// than once authenticate returns, keeps messages sent to the already
+// registered client in step with the client.
+func sendAuthResult(client *Client, codec *protocol.Codec, result *protocol.AuthResultMessage) error {
+	if err := codec.Encode(result); err != nil {
+		return err
+	}
+	codec.SetEncoding(client.encoding)
+	return nil
+}
+
+// selectEncoding picks the first binary encoding the client advertised that
+// the server supports. Clients that advertise nothing keep using JSON.
+func (s *Server) selectEncoding(offered []protocol.Encoding) protocol.Encoding {
+	if !s.cfg.Server.BinaryControl {
+		return protocol.EncodingJSON
+	}
+	for _, e := range offered {
+		if e == protocol.EncodingMsgpack {
+			return e
+		}
+	}
+	return protocol.EncodingJSON
+}
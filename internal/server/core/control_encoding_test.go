@@ -0,0 +1,62 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+// authWithEncodings authenticates a new primary connection advertising the
+// given encodings, switches to the negotiated one and checks that a ping
+// round trip works in it.
+func authWithEncodings(t *testing.T, srv *Server, encodings []protocol.Encoding) protocol.Encoding {
+	t.Helper()
+
+	session := dialServer(t, srv)
+	t.Cleanup(func() { session.Close() })
+	codec, _ := openControlStream(t, session)
+	require.NoError(t, codec.Encode(&protocol.AuthMessage{
+		Message:   protocol.NewMessage(protocol.MsgAuth),
+		Encodings: encodings,
+	}))
+	var result protocol.AuthResultMessage
+	require.NoError(t, codec.Decode(&result))
+	require.True(t, result.Success, result.Error)
+
+	codec.SetEncoding(result.Encoding)
+	require.NoError(t, codec.Encode(&protocol.PingMessage{Message: protocol.NewMessage(protocol.MsgPing)}))
+	data, base, err := codec.DecodeRaw()
+	require.NoError(t, err)
+	require.Equal(t, protocol.MsgPong, base.Type)
+	_, err = codec.Encoding().ParseMessage(data, protocol.MsgPong)
+	require.NoError(t, err)
+
+	return result.Encoding
+}
+
+func TestControlEncoding_MsgpackNegotiated(t *testing.T) {
+	srv := resumeTestServer(t, 0)
+	srv.cfg.Server.BinaryControl = true
+
+	got := authWithEncodings(t, srv, []protocol.Encoding{"cbor", protocol.EncodingMsgpack})
+	assert.Equal(t, protocol.EncodingMsgpack, got)
+}
+
+func TestControlEncoding_JSONOnlyClient(t *testing.T) {
+	srv := resumeTestServer(t, 0)
+	srv.cfg.Server.BinaryControl = true
+
+	got := authWithEncodings(t, srv, nil)
+	assert.Empty(t, got)
+}
+
+func TestControlEncoding_BinaryDisabled(t *testing.T) {
+	srv := resumeTestServer(t, 0)
+	srv.cfg.Server.BinaryControl = false
+
+	got := authWithEncodings(t, srv, []protocol.Encoding{protocol.EncodingMsgpack})
+	assert.Empty(t, got)
+}
@@ -0,0 +1,76 @@
+package core
+
+import (
+	"context"
+	"time"
+)
+
+// drainProgressInterval is how often Stop logs the connections left to drain.
+const drainProgressInterval = time.Second
+
+// DrainStatus reports the progress of a graceful shutdown.
+type DrainStatus struct {
+	Draining          bool
+	ActiveConnections int64
+	Deadline          time.Time // zero when not draining
+}
+
+// TimeLeft returns the time until the drain is cut short, or 0.
+func (d DrainStatus) TimeLeft() time.Duration {
+	if d.Deadline.IsZero() {
+		return 0
+	}
+	return max(time.Until(d.Deadline), 0)
+}
+
+// GetDrainStatus returns the number of proxied connections still open and,
+// once Stop has begun, the drain deadline.
+func (s *Server) GetDrainStatus() DrainStatus {
+	status := DrainStatus{ActiveConnections: s.activeConnCount.Load()}
+	if deadline := s.drainDeadline.Load(); deadline != 0 {
+		status.Draining = true
+		status.Deadline = time.Unix(0, deadline)
+	}
+	return status
+}
+
+// trackConn counts a proxied connection for the shutdown drain. Call the
+// returned function when the connection ends.
+func (s *Server) trackConn() func() {
+	s.activeConns.Add(1)
+	s.activeConnCount.Add(1)
+	return func() {
+		s.activeConnCount.Add(-1)
+		s.activeConns.Done()
+	}
+}
+
+// waitDrain waits for tracked connections to finish or ctx to expire,
+// logging the remaining count as it goes.
+func (s *Server) waitDrain(ctx context.Context) {
+	drainDone := make(chan struct{})
+	go func() {
+		s.activeConns.Wait()
+		close(drainDone)
+	}()
+
+	ticker := time.NewTicker(drainProgressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-drainDone:
+			s.log.Info().Msg("All connections drained")
+			return
+		case <-ctx.Done():
+			s.log.Warn().Int64("remaining", s.activeConnCount.Load()).Msg("Drain timeout, forcing shutdown")
+			return
+		case <-ticker.C:
+			status := s.GetDrainStatus()
+			s.log.Info().
+				Int64("remaining", status.ActiveConnections).
+				Dur("time_left", status.TimeLeft().Round(time.Second)).
+				Msg("Draining connections")
+		}
+	}
+}
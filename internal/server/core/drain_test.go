@@ -0,0 +1,55 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDrainStatusCountsConnections(t *testing.T) {
+	srv := resumeTestServer(t, 0)
+
+	status := srv.GetDrainStatus()
+	assert.False(t, status.Draining)
+	assert.Zero(t, status.TimeLeft())
+
+	doneA := srv.trackConn()
+	doneB := srv.trackConn()
+	assert.Equal(t, int64(2), srv.GetDrainStatus().ActiveConnections)
+
+	srv.drainDeadline.Store(time.Now().Add(drainTimeout).UnixNano())
+	drained := make(chan struct{})
+	go func() {
+		srv.waitDrain(context.Background())
+		close(drained)
+	}()
+
+	status = srv.GetDrainStatus()
+	assert.True(t, status.Draining)
+	assert.Greater(t, status.TimeLeft(), time.Duration(0))
+
+	doneA()
+	assert.Equal(t, int64(1), srv.GetDrainStatus().ActiveConnections)
+	doneB()
+
+	select {
+	case <-drained:
+	case <-time.After(2 * time.Second):
+		t.Fatal("waitDrain did not return after the last connection ended")
+	}
+	assert.Zero(t, srv.GetDrainStatus().ActiveConnections)
+}
+
+func TestWaitDrainTimeout(t *testing.T) {
+	srv := resumeTestServer(t, 0)
+	done := srv.trackConn()
+	defer done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	srv.waitDrain(ctx)
+
+	assert.Equal(t, int64(1), srv.GetDrainStatus().ActiveConnections)
+}
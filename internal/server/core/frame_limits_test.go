@@ -0,0 +1,65 @@
+package core
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+// writeFrameHeader announces a frame of the given length without sending it.
+func writeFrameHeader(t *testing.T, stream net.Conn, length uint32) {
+	t.Helper()
+	header := make([]byte, protocol.HeaderSize)
+	binary.BigEndian.PutUint32(header, length)
+	_, err := stream.Write(header)
+	require.NoError(t, err)
+}
+
+func requireProtocolError(t *testing.T, codec *protocol.Codec) {
+	t.Helper()
+	var msg protocol.ErrorMessage
+	require.NoError(t, codec.Decode(&msg))
+	assert.Equal(t, protocol.MsgError, msg.Type)
+	assert.Equal(t, protocol.ErrCodeProtocolError, msg.Code)
+	assert.True(t, msg.Fatal)
+}
+
+func TestOversizedFrameBeforeAuth(t *testing.T) {
+	srv := resumeTestServer(t, 0)
+	srv.cfg.Server.MaxMessageSize = 4096
+
+	session := dialServer(t, srv)
+	defer session.Close()
+	codec, stream := openControlStream(t, session)
+
+	writeFrameHeader(t, stream, 1<<30)
+	requireProtocolError(t, codec)
+}
+
+func TestOversizedFrameClosesClientWithoutResume(t *testing.T) {
+	srv := resumeTestServer(t, 5*time.Second)
+	srv.cfg.Server.MaxMessageSize = 4096
+
+	session := dialServer(t, srv)
+	defer session.Close()
+	codec, stream := openControlStream(t, session)
+	require.NoError(t, codec.Encode(&protocol.AuthMessage{
+		Message:   protocol.NewMessage(protocol.MsgAuth),
+		Resumable: true,
+	}))
+	var auth protocol.AuthResultMessage
+	require.NoError(t, codec.Decode(&auth))
+	require.True(t, auth.Success, auth.Error)
+
+	writeFrameHeader(t, stream, 4097)
+	requireProtocolError(t, codec)
+
+	require.Eventually(t, func() bool { return srv.GetClient(auth.ClientID) == nil },
+		2*time.Second, 10*time.Millisecond)
+}
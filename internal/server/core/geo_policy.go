@@ -0,0 +1,80 @@
+package core
+
+import (
+	"strings"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+)
+
+// geoPolicy allows or denies client connections by the country and
+// autonomous system of their IP (geoip.policy).
+type geoPolicy struct {
+	allowCountries map[string]struct{}
+	denyCountries  map[string]struct{}
+	allowASNs      map[uint]struct{}
+	denyASNs       map[uint]struct{}
+}
+
+// newGeoPolicy builds the policy cfg describes. It returns nil when there
+// are no rules.
+func newGeoPolicy(cfg config.GeoPolicySettings) *geoPolicy {
+	if cfg.Empty() {
+		return nil
+	}
+	countries := func(codes []string) map[string]struct{} {
+		set := make(map[string]struct{}, len(codes))
+		for _, c := range codes {
+			set[strings.ToUpper(c)] = struct{}{}
+		}
+		return set
+	}
+	asns := func(numbers []uint) map[uint]struct{} {
+		set := make(map[uint]struct{}, len(numbers))
+		for _, n := range numbers {
+			set[n] = struct{}{}
+		}
+		return set
+	}
+	return &geoPolicy{
+		allowCountries: countries(cfg.AllowCountries),
+		denyCountries:  countries(cfg.DenyCountries),
+		allowASNs:      asns(cfg.AllowASNs),
+		denyASNs:       asns(cfg.DenyASNs),
+	}
+}
+
+// allows reports whether a connection from country and asn may proceed.
+// An empty country or a zero asn is unknown: the IP is not in the database
+// or the database is not loaded. Unknown values match no rule, so a missing
+// database lets connections through instead of locking everyone out.
+func (p *geoPolicy) allows(country string, asn uint) bool {
+	if p == nil {
+		return true
+	}
+	if country != "" {
+		if _, ok := p.denyCountries[country]; ok {
+			return false
+		}
+		if _, ok := p.allowCountries[country]; !ok && len(p.allowCountries) > 0 {
+			return false
+		}
+	}
+	if asn != 0 {
+		if _, ok := p.denyASNs[asn]; ok {
+			return false
+		}
+		if _, ok := p.allowASNs[asn]; !ok && len(p.allowASNs) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// geoAllowed checks ip against the geo policy. Both lookups read
+// memory-mapped databases, so this adds no I/O to the accept path.
+func (s *Server) geoAllowed(ip string) bool {
+	if s.geoPolicy == nil {
+		return true
+	}
+	return s.geoPolicy.allows(s.geoIP.Country(ip), s.asnLookup.ASN(ip))
+}
@@ -0,0 +1,56 @@
+package core
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+)
+
+func TestGeoPolicy_Allows(t *testing.T) {
+	deny := newGeoPolicy(config.GeoPolicySettings{DenyCountries: []string{"xx"}, DenyASNs: []uint{14061}})
+	allow := newGeoPolicy(config.GeoPolicySettings{AllowCountries: []string{"DE", "NL"}, AllowASNs: []uint{3320}})
+
+	tests := []struct {
+		name    string
+		policy  *geoPolicy
+		country string
+		asn     uint
+		want    bool
+	}{
+		{"no policy", nil, "XX", 14061, true},
+		{"denied country", deny, "XX", 3320, false},
+		{"denied ASN", deny, "DE", 14061, false},
+		{"not denied", deny, "DE", 3320, true},
+		{"unknown IP", deny, "", 0, true},
+		{"allowed", allow, "DE", 3320, true},
+		{"country not allowed", allow, "US", 3320, false},
+		{"ASN not allowed", allow, "NL", 14061, false},
+		{"unknown ASN", allow, "NL", 0, true},
+		{"unknown country", allow, "", 3320, true},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.policy.allows(tt.country, tt.asn), tt.name)
+	}
+}
+
+func TestGeoPolicy_Empty(t *testing.T) {
+	assert.Nil(t, newGeoPolicy(config.GeoPolicySettings{}))
+}
+
+func TestAdmitControlConnection_GeoPolicyWithoutDatabase(t *testing.T) {
+	_, srv := newTestRouter("example.com")
+	defer srv.cancel()
+	srv.geoPolicy = newGeoPolicy(config.GeoPolicySettings{AllowCountries: []string{"DE"}})
+
+	// Neither database is loaded: the policy cannot tell and lets the
+	// connection through
+	a, b := net.Pipe()
+	defer b.Close()
+	conn, _, ok := srv.admitControlConnection(a, "203.0.113.7")
+	require.True(t, ok)
+	conn.Close()
+}
@@ -0,0 +1,81 @@
+package core
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+// applyRequestHeaderRules rewrites a proxied request's headers. A Host set
+// by the rules replaces req.Host, which is what req.Write sends.
+func applyRequestHeaderRules(req *http.Request, rules *protocol.HeaderRules) {
+	if rules == nil {
+		return
+	}
+	applyHeaderRuleSet(req.Header, rules.Request)
+	if host := req.Header.Get("Host"); host != "" {
+		req.Host = host
+		req.Header.Del("Host")
+	}
+}
+
+// applyResponseHeaderRules rewrites the headers of a tunnel response before
+// they are copied to the visitor. plainHTTP reports whether the visitor
+// reached the server without TLS.
+func applyResponseHeaderRules(h http.Header, rules *protocol.HeaderRules, plainHTTP bool) {
+	if rules == nil {
+		return
+	}
+	applyHeaderRuleSet(h, rules.Response)
+	if rules.StripSecureCookies && plainHTTP {
+		cookies := h.Values("Set-Cookie")
+		for i, c := range cookies {
+			cookies[i] = stripSecureAttr(c)
+		}
+	}
+}
+
+// applyHeaderRuleSet applies remove, then set, then add.
+func applyHeaderRuleSet(h http.Header, set protocol.HeaderRuleSet) {
+	for _, name := range set.Remove {
+		h.Del(name)
+	}
+	for name, value := range set.Set {
+		h.Set(name, value)
+	}
+	for name, value := range set.Add {
+		h.Add(name, value)
+	}
+}
+
+// stripSecureAttr removes the Secure attribute from a Set-Cookie value,
+// leaving the other attributes as they were.
+func stripSecureAttr(cookie string) string {
+	parts := strings.Split(cookie, ";")
+	kept := parts[:1]
+	for _, attr := range parts[1:] {
+		if strings.EqualFold(strings.TrimSpace(attr), "secure") {
+			continue
+		}
+		kept = append(kept, attr)
+	}
+	return strings.Join(kept, ";")
+}
+
+// isPlainHTTP reports whether the visitor connected without TLS. Behind a
+// trusted reverse proxy the proxy's X-Forwarded-Proto decides.
+func isPlainHTTP(req *http.Request, trusted map[string]struct{}) bool {
+	if req.TLS != nil {
+		return false
+	}
+	peer := req.RemoteAddr
+	if h, _, err := net.SplitHostPort(peer); err == nil {
+		peer = h
+	}
+	if _, ok := trusted[normalizeIP(peer)]; ok {
+		return !strings.EqualFold(req.Header.Get("X-Forwarded-Proto"), "https")
+	}
+	return true
+}
@@ -0,0 +1,72 @@
+package core
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+func TestApplyRequestHeaderRules(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://app.fxtun.dev/", nil)
+	req.Header.Set("X-Forwarded-Host", "app.fxtun.dev")
+	req.Header.Set("X-Debug", "1")
+	req.Header.Set("X-Env", "prod")
+
+	applyRequestHeaderRules(req, &protocol.HeaderRules{Request: protocol.HeaderRuleSet{
+		Remove: []string{"x-debug", "X-Env"},
+		Set:    map[string]string{"host": "localhost:3000", "X-Env": "dev"},
+		Add:    map[string]string{"X-Env": "test"},
+	}})
+
+	assert.Equal(t, "localhost:3000", req.Host)
+	assert.Empty(t, req.Header.Values("Host"))
+	assert.Empty(t, req.Header.Get("X-Debug"))
+	assert.Equal(t, []string{"dev", "test"}, req.Header.Values("X-Env"), "remove, then set, then add")
+	assert.Equal(t, "app.fxtun.dev", req.Header.Get("X-Forwarded-Host"))
+
+	applyRequestHeaderRules(req, nil)
+	assert.Equal(t, "localhost:3000", req.Host)
+}
+
+func TestApplyResponseHeaderRules_StripSecureCookies(t *testing.T) {
+	rules := &protocol.HeaderRules{
+		Response:           protocol.HeaderRuleSet{Remove: []string{"Server"}},
+		StripSecureCookies: true,
+	}
+
+	h := http.Header{}
+	h.Set("Server", "upstream")
+	h.Add("Set-Cookie", "sid=1; Path=/; Secure; HttpOnly")
+	h.Add("Set-Cookie", "pref=2; secure")
+	applyResponseHeaderRules(h, rules, true)
+	assert.Empty(t, h.Get("Server"))
+	assert.Equal(t, []string{"sid=1; Path=/; HttpOnly", "pref=2"}, h.Values("Set-Cookie"))
+
+	h = http.Header{}
+	h.Add("Set-Cookie", "sid=1; Secure")
+	applyResponseHeaderRules(h, rules, false)
+	assert.Equal(t, "sid=1; Secure", h.Get("Set-Cookie"), "HTTPS visitors keep Secure")
+}
+
+func TestIsPlainHTTP(t *testing.T) {
+	trusted := buildTrustedProxySet([]string{"127.0.0.1"})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "203.0.113.5:1234"
+	req.Header.Set("X-Forwarded-Proto", "https")
+	assert.True(t, isPlainHTTP(req, trusted), "untrusted peers cannot claim https")
+
+	req.RemoteAddr = "127.0.0.1:1234"
+	assert.False(t, isPlainHTTP(req, trusted))
+
+	req.Header.Del("X-Forwarded-Proto")
+	assert.True(t, isPlainHTTP(req, trusted))
+
+	req.TLS = &tls.ConnectionState{}
+	assert.False(t, isPlainHTTP(req, trusted))
+}
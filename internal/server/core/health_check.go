@@ -0,0 +1,223 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+const (
+	defaultHealthCheckInterval = 30 * time.Second
+	minHealthCheckInterval     = 5 * time.Second
+	healthCheckTimeout         = 10 * time.Second
+	healthCheckHistorySize     = 60
+)
+
+// Health check statuses reported through the API.
+const (
+	HealthStatusUnknown = "unknown"
+	HealthStatusUp      = "up"
+	HealthStatusDown    = "down"
+)
+
+// HealthSample is the outcome of a single health-check probe.
+type HealthSample struct {
+	Time      time.Time
+	Status    string
+	LatencyMs int64
+	Error     string
+}
+
+// TunnelHealth is a point-in-time snapshot of a tunnel's health check.
+type TunnelHealth struct {
+	Check    string // HTTP path or "tcp"
+	Interval time.Duration
+	Status   string
+	Last     *HealthSample
+	History  []HealthSample // oldest first
+}
+
+// tunnelHealth holds the probe configuration and a bounded ring of results.
+type tunnelHealth struct {
+	check    string
+	interval time.Duration
+	done     chan struct{}
+	stopOnce sync.Once
+
+	mu      sync.RWMutex
+	history []HealthSample
+}
+
+// parseHealthCheck validates the health check requested for a tunnel of the
+// given type and returns nil when no check was requested.
+func parseHealthCheck(tunnelType protocol.TunnelType, check, interval string) (*tunnelHealth, error) {
+	check = strings.TrimSpace(check)
+	if check == "" {
+		return nil, nil
+	}
+
+	switch tunnelType {
+	case protocol.TunnelHTTP:
+		if !strings.HasPrefix(check, "/") {
+			return nil, fmt.Errorf("health check path must start with /")
+		}
+	case protocol.TunnelTCP:
+		if check != protocol.HealthCheckTCP {
+			return nil, fmt.Errorf("tcp tunnels only support the %q health check", protocol.HealthCheckTCP)
+		}
+	default:
+		return nil, fmt.Errorf("health checks are not supported for %s tunnels", tunnelType)
+	}
+
+	d := defaultHealthCheckInterval
+	if interval != "" {
+		parsed, err := parseTunnelDuration(interval)
+		if err != nil {
+			return nil, err
+		}
+		if parsed < minHealthCheckInterval {
+			return nil, fmt.Errorf("health check interval must be at least %s", minHealthCheckInterval)
+		}
+		d = parsed
+	}
+
+	return &tunnelHealth{check: check, interval: d, done: make(chan struct{})}, nil
+}
+
+// stop ends the probe loop. It is safe to call more than once.
+func (h *tunnelHealth) stop() {
+	h.stopOnce.Do(func() { close(h.done) })
+}
+
+func (h *tunnelHealth) record(s HealthSample) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.history) == healthCheckHistorySize {
+		copy(h.history, h.history[1:])
+		h.history = h.history[:healthCheckHistorySize-1]
+	}
+	h.history = append(h.history, s)
+}
+
+// snapshot returns a copy of the current state. History is only included
+// when withHistory is set to keep tunnel listings small.
+func (h *tunnelHealth) snapshot(withHistory bool) *TunnelHealth {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	out := &TunnelHealth{
+		Check:    h.check,
+		Interval: h.interval,
+		Status:   HealthStatusUnknown,
+	}
+	if n := len(h.history); n > 0 {
+		last := h.history[n-1]
+		out.Last = &last
+		out.Status = last.Status
+	}
+	if withHistory {
+		out.History = append([]HealthSample(nil), h.history...)
+	}
+	return out
+}
+
+// healthSnapshot returns the tunnel's current health without history, or nil
+// when no health check is configured.
+func (t *Tunnel) healthSnapshot() *TunnelHealth {
+	if t.health == nil {
+		return nil
+	}
+	return t.health.snapshot(false)
+}
+
+// runHealthChecks probes the tunnel's local service until the tunnel is
+// closed or the client disconnects.
+func (c *Client) runHealthChecks(tunnel *Tunnel) {
+	h := tunnel.health
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-h.done:
+			return
+		case <-ticker.C:
+			h.record(c.probeTunnel(tunnel))
+		}
+	}
+}
+
+// probeTunnel runs one health check through the tunnel's client connection.
+func (c *Client) probeTunnel(tunnel *Tunnel) HealthSample {
+	start := time.Now()
+	sample := HealthSample{Time: start, Status: HealthStatusDown}
+
+	err := c.doProbe(tunnel)
+	sample.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		sample.Error = err.Error()
+		c.log.Debug().Err(err).Str("tunnel_id", tunnel.ID).Msg("Health check failed")
+		return sample
+	}
+	sample.Status = HealthStatusUp
+	return sample
+}
+
+func (c *Client) doProbe(tunnel *Tunnel) error {
+	ctx, cancel := context.WithTimeout(c.ctx, healthCheckTimeout)
+	defer cancel()
+
+	stream, err := c.OpenStream()
+	if err != nil {
+		return fmt.Errorf("open stream: %w", err)
+	}
+	defer stream.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = stream.SetDeadline(deadline)
+	}
+
+	if err := protocol.WriteStreamHeader(stream, tunnel.ID, protocol.HealthCheckRemoteAddr); err != nil {
+		return fmt.Errorf("send connection info: %w", err)
+	}
+
+	if tunnel.Type == protocol.TunnelTCP {
+		var status [1]byte
+		if _, err := io.ReadFull(stream, status[:]); err != nil {
+			return fmt.Errorf("read status: %w", err)
+		}
+		if status[0] != protocol.HealthCheckUp {
+			return fmt.Errorf("local service unreachable")
+		}
+		return nil
+	}
+
+	host := tunnel.Subdomain + "." + c.server.cfg.Domain.Base
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+host+tunnel.health.check, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "fxtunnel-healthcheck")
+	req.Close = true
+	if err := req.Write(stream); err != nil {
+		return fmt.Errorf("write request: %w", err)
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(stream), req)
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("unhealthy status %d", resp.StatusCode)
+	}
+	return nil
+}
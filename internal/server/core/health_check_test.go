@@ -0,0 +1,159 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+func TestParseHealthCheck(t *testing.T) {
+	tests := []struct {
+		name       string
+		tunnelType protocol.TunnelType
+		check      string
+		interval   string
+		want       time.Duration
+		wantErr    bool
+	}{
+		{"none", protocol.TunnelHTTP, "", "", 0, false},
+		{"http path", protocol.TunnelHTTP, "/healthz", "", defaultHealthCheckInterval, false},
+		{"http custom interval", protocol.TunnelHTTP, "/healthz", "1m", time.Minute, false},
+		{"http relative path", protocol.TunnelHTTP, "healthz", "", 0, true},
+		{"http interval too short", protocol.TunnelHTTP, "/healthz", "1s", 0, true},
+		{"http bad interval", protocol.TunnelHTTP, "/healthz", "soon", 0, true},
+		{"tcp connect", protocol.TunnelTCP, "tcp", "10s", 10 * time.Second, false},
+		{"tcp path", protocol.TunnelTCP, "/healthz", "", 0, true},
+		{"udp", protocol.TunnelUDP, "tcp", "", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := parseHealthCheck(tt.tunnelType, tt.check, tt.interval)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			if tt.check == "" {
+				assert.Nil(t, h)
+				return
+			}
+			require.NotNil(t, h)
+			assert.Equal(t, tt.want, h.interval)
+		})
+	}
+}
+
+func TestTunnelHealth_HistoryIsBounded(t *testing.T) {
+	h, err := parseHealthCheck(protocol.TunnelHTTP, "/healthz", "")
+	require.NoError(t, err)
+
+	snap := h.snapshot(true)
+	assert.Equal(t, HealthStatusUnknown, snap.Status)
+	assert.Nil(t, snap.Last)
+
+	for i := 0; i < healthCheckHistorySize+5; i++ {
+		h.record(HealthSample{Status: HealthStatusUp, LatencyMs: int64(i)})
+	}
+	h.record(HealthSample{Status: HealthStatusDown, Error: "boom"})
+
+	snap = h.snapshot(true)
+	require.Len(t, snap.History, healthCheckHistorySize)
+	assert.Equal(t, int64(6), snap.History[0].LatencyMs)
+	assert.Equal(t, HealthStatusDown, snap.Status)
+	assert.Equal(t, "boom", snap.Last.Error)
+
+	assert.Nil(t, h.snapshot(false).History)
+}
+
+// newProbeClient returns a client whose next stream is the server end of a
+// pipe; the other end is returned for the test to play the tunnel client.
+func newProbeClient(t *testing.T) (*Client, net.Conn) {
+	t.Helper()
+	serverEnd, clientEnd := net.Pipe()
+	t.Cleanup(func() {
+		serverEnd.Close()
+		clientEnd.Close()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	c := &Client{
+		server: &Server{cfg: &config.ServerConfig{Domain: config.DomainSettings{Base: "example.com"}}},
+		log:    zerolog.Nop(),
+		ctx:    ctx,
+		cancel: cancel,
+
+		streamPool: make(chan net.Conn, 1),
+	}
+	c.streamPool <- serverEnd
+	return c, clientEnd
+}
+
+func TestProbeTunnel_HTTP(t *testing.T) {
+	for _, tc := range []struct {
+		code int
+		want string
+	}{
+		{http.StatusOK, HealthStatusUp},
+		{http.StatusNotFound, HealthStatusUp},
+		{http.StatusBadGateway, HealthStatusDown},
+	} {
+		c, remote := newProbeClient(t)
+		h, err := parseHealthCheck(protocol.TunnelHTTP, "/healthz", "")
+		require.NoError(t, err)
+		tunnel := &Tunnel{ID: "t1", Type: protocol.TunnelHTTP, Subdomain: "app", health: h}
+
+		go func(code int) {
+			hdr, err := protocol.ReadStreamHeader(remote)
+			if err != nil || hdr.RemoteAddr != protocol.HealthCheckRemoteAddr {
+				return
+			}
+			req, err := http.ReadRequest(bufio.NewReader(remote))
+			if err != nil || req.URL.Path != "/healthz" || req.Host != "app.example.com" {
+				return
+			}
+			resp := &http.Response{StatusCode: code, ProtoMajor: 1, ProtoMinor: 1, Request: req}
+			_ = resp.Write(remote)
+		}(tc.code)
+
+		sample := c.probeTunnel(tunnel)
+		assert.Equal(t, tc.want, sample.Status, "status %d", tc.code)
+	}
+}
+
+func TestProbeTunnel_TCP(t *testing.T) {
+	for _, tc := range []struct {
+		reply byte
+		want  string
+	}{
+		{protocol.HealthCheckUp, HealthStatusUp},
+		{protocol.HealthCheckDown, HealthStatusDown},
+	} {
+		c, remote := newProbeClient(t)
+		h, err := parseHealthCheck(protocol.TunnelTCP, "tcp", "")
+		require.NoError(t, err)
+		tunnel := &Tunnel{ID: "t2", Type: protocol.TunnelTCP, health: h}
+
+		go func(reply byte) {
+			if _, err := protocol.ReadStreamHeader(remote); err != nil {
+				return
+			}
+			_, _ = remote.Write([]byte{reply})
+		}(tc.reply)
+
+		sample := c.probeTunnel(tunnel)
+		assert.Equal(t, tc.want, sample.Status)
+	}
+}
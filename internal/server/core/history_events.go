@@ -0,0 +1,149 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/rs/zerolog"
+
+	"github.com/mephistofox/fxtun.dev/internal/i18n"
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+	"github.com/mephistofox/fxtun.dev/internal/server/database"
+	"github.com/mephistofox/fxtun.dev/internal/server/monitor"
+)
+
+// historyQueueSize bounds the history events waiting to be written.
+const historyQueueSize = 1024
+
+// historyEvent is a point-in-time entry of a user's history.
+type historyEvent struct {
+	userID     int64
+	event      string
+	tunnelType string
+	localPort  int
+	url        string
+	details    string
+}
+
+// historyRecorder writes history events from a single goroutine. A client
+// repeating rejected requests queues events faster than the database takes
+// them; once the queue is full further events are dropped instead of piling
+// up goroutines.
+type historyRecorder struct {
+	worker  *asyncWorker[historyEvent]
+	write   func(e historyEvent) error
+	log     zerolog.Logger
+	dropped atomic.Int64
+}
+
+// newHistoryRecorder starts a recorder writing to db. It returns nil
+// without a database.
+func newHistoryRecorder(db *database.Database, log zerolog.Logger) *historyRecorder {
+	if db == nil {
+		return nil
+	}
+	return startHistoryRecorder(func(e historyEvent) error {
+		return db.UserHistory.RecordEvent(e.userID, e.event, e.tunnelType, e.localPort, e.url, e.details)
+	}, log)
+}
+
+func startHistoryRecorder(write func(e historyEvent) error, log zerolog.Logger) *historyRecorder {
+	h := &historyRecorder{write: write, log: log}
+	h.worker = newAsyncWorker(historyQueueSize, h.handle)
+	return h
+}
+
+// record queues e without blocking. A nil recorder is a no-op.
+func (h *historyRecorder) record(e historyEvent) {
+	if h == nil {
+		return
+	}
+	if !h.worker.push(e) {
+		h.dropped.Add(1)
+	}
+}
+
+func (h *historyRecorder) handle(_ context.Context, e historyEvent) {
+	if err := h.write(e); err != nil {
+		h.log.Warn().Err(err).Str("event", e.event).Int64("user_id", e.userID).Msg("Failed to record history event")
+	}
+	if n := h.dropped.Swap(0); n > 0 {
+		h.log.Warn().Int64("dropped", n).Msg("History events dropped, database is falling behind")
+	}
+}
+
+// close stops the recorder once the event being written is done.
+func (h *historyRecorder) close() {
+	if h == nil {
+		return
+	}
+	if n := h.worker.close(); n > 0 {
+		h.log.Warn().Int("discarded", n).Msg("History events discarded at shutdown")
+	}
+}
+
+// recordHistoryEvent stores a point-in-time event in the user's history.
+// The write happens in the background so control handling never waits on
+// the database; clients without a user (config tokens) are skipped.
+func (c *Client) recordHistoryEvent(event, tunnelType string, localPort int, url, details string) {
+	if c.UserID <= 0 {
+		return
+	}
+	c.server.history.record(historyEvent{
+		userID:     c.UserID,
+		event:      event,
+		tunnelType: tunnelType,
+		localPort:  localPort,
+		url:        url,
+		details:    details,
+	})
+}
+
+// rejectTunnel reports a failed tunnel request to the client in its user's
+// language, records it in the user's history and sends a tunnel.error
+// webhook.
+func (c *Client) rejectTunnel(req *protocol.TunnelRequestMessage, code, message string) {
+	c.sendTunnelError(req.RequestID, "", code, i18n.Translate(c.userLocale(), message))
+	details := fmt.Sprintf("%s: %s", code, message)
+	c.recordHistoryEvent(database.HistoryEventTunnelError, string(req.TunnelType), req.LocalPort, "", details)
+	c.emitTunnelRejected(req, details)
+}
+
+// userLocale returns the locale the client's user chose, empty when they
+// did not or the client has no user.
+func (c *Client) userLocale() string {
+	c.localeOnce.Do(func() {
+		if c.UserID == 0 || c.server == nil || c.server.db == nil {
+			return
+		}
+		if l, err := c.server.db.UserSettings.Get(c.UserID, i18n.UserSetting); err == nil && i18n.Supported(l) {
+			c.locale = l
+		}
+	})
+	return c.locale
+}
+
+// tunnelURL returns the public address of a tunnel for history entries.
+func (c *Client) tunnelURL(t *Tunnel) string {
+	if t.Type == protocol.TunnelHTTP {
+		return fmt.Sprintf("http://%s.%s", t.Subdomain, c.server.cfg.Domain.Base)
+	}
+	return fmt.Sprintf("%s:%d", c.server.NodePublicHost(), t.RemotePort)
+}
+
+// recordThrottled records a rate-limit alert as a throttling event. The
+// monitor re-alerts on every detection pass while the denied counter is
+// non-zero, so an event is only written when new requests were denied.
+func (s *Server) recordThrottled(alert monitor.Alert) {
+	client, tunnel := s.clientMgr.findTunnel(alert.TunnelID)
+	if tunnel == nil {
+		return
+	}
+	prev := tunnel.throttledDenied.Swap(alert.Denied)
+	if alert.Denied <= prev {
+		return
+	}
+	client.recordHistoryEvent(database.HistoryEventThrottled, string(tunnel.Type), tunnel.LocalPort,
+		client.tunnelURL(tunnel), fmt.Sprintf("%d requests denied by rate limit", alert.Denied-prev))
+}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+	"github.com/mephistofox/fxtun.dev/internal/server/monitor"
+)
+
+func TestRecordThrottled_TracksNewDenials(t *testing.T) {
+	s := &Server{
+		cfg:       &config.ServerConfig{Domain: config.DomainSettings{Base: "example.com"}},
+		clientMgr: NewClientManager(zerolog.Nop()),
+	}
+	tunnel := &Tunnel{ID: "t1", Type: protocol.TunnelHTTP, Subdomain: "app"}
+	c := &Client{ID: "c1", server: s, log: zerolog.Nop(), Tunnels: map[string]*Tunnel{"t1": tunnel}}
+	s.clientMgr.addClient(c.ID, c)
+
+	s.recordThrottled(monitor.Alert{Type: monitor.AlertRateLimit, TunnelID: "t1", Denied: 3})
+	assert.Equal(t, int64(3), tunnel.throttledDenied.Load())
+
+	// Repeated alerts for the same cumulative count are not new events.
+	s.recordThrottled(monitor.Alert{Type: monitor.AlertRateLimit, TunnelID: "t1", Denied: 3})
+	assert.Equal(t, int64(3), tunnel.throttledDenied.Load())
+
+	s.recordThrottled(monitor.Alert{Type: monitor.AlertRateLimit, TunnelID: "t1", Denied: 7})
+	assert.Equal(t, int64(7), tunnel.throttledDenied.Load())
+
+	// Alerts for tunnels that are already gone are ignored.
+	s.recordThrottled(monitor.Alert{Type: monitor.AlertRateLimit, TunnelID: "missing", Denied: 1})
+
+	assert.Equal(t, "http://app.example.com", c.tunnelURL(tunnel))
+}
+
+func TestHistoryRecorder_DropsWhenFull(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	var written atomic.Int32
+	h := startHistoryRecorder(func(historyEvent) error {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		written.Add(1)
+		return nil
+	}, zerolog.Nop())
+	defer h.close()
+
+	h.record(historyEvent{userID: 1, event: "tunnel_error"})
+	<-started
+	for range historyQueueSize + 5 {
+		h.record(historyEvent{userID: 1, event: "tunnel_error"})
+	}
+	assert.Equal(t, int64(5), h.dropped.Load(), "events beyond the queue are dropped")
+
+	close(release)
+	assert.Eventually(t, func() bool { return written.Load() == historyQueueSize+1 }, 5*time.Second, 10*time.Millisecond)
+
+	var nilRecorder *historyRecorder
+	nilRecorder.record(historyEvent{userID: 1})
+	nilRecorder.close()
+}
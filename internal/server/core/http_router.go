@@ -3,9 +3,11 @@ package core
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"crypto/rand"
 	"embed"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
@@ -17,7 +19,9 @@ import (
 
 	"github.com/rs/zerolog"
 
+	"github.com/mephistofox/fxtun.dev/internal/config"
 	"github.com/mephistofox/fxtun.dev/internal/inspect"
+	"github.com/mephistofox/fxtun.dev/internal/logging"
 	"github.com/mephistofox/fxtun.dev/internal/protocol"
 )
 
@@ -27,6 +31,8 @@ var templateFS embed.FS
 var (
 	interstitialTmpl = template.Must(template.ParseFS(templateFS, "templates/interstitial.html"))
 	errorTmpl        = template.Must(template.ParseFS(templateFS, "templates/error.html"))
+	landingTmpl      = template.Must(template.ParseFS(templateFS, "templates/landing.html"))
+	upgradeTmpl      = template.Must(template.ParseFS(templateFS, "templates/upgrade.html"))
 )
 
 // HTTPRouter routes HTTP requests to the appropriate tunnel.
@@ -34,52 +40,137 @@ var (
 type HTTPRouter struct {
 	server  *Server
 	log     zerolog.Logger
-	tunnels map[string]*Tunnel // subdomain -> tunnel
+	tunnels map[string]*tunnelGroup // subdomain -> tunnels serving it
 	mu      sync.RWMutex
+
+	landingTmpl      *template.Template // nil when the landing page is disabled
+	interstitialTmpl *template.Template // nil when server.interstitial.mode is off
+	accessLog        *accessLogger      // nil when server.access_log is not set
+	reqLog           zerolog.Logger     // per-request lines, sampled per logging settings
+
+	// Unified mode: requests for dashboardHosts go to dashboard (the API
+	// router) instead of a tunnel.
+	dashboardMu    sync.RWMutex
+	dashboard      http.Handler
+	dashboardHosts map[string]bool
 }
 
 // NewHTTPRouter creates a new HTTP router
 func NewHTTPRouter(server *Server, log zerolog.Logger) *HTTPRouter {
-	return &HTTPRouter{
+	r := &HTTPRouter{
 		server:  server,
 		log:     log.With().Str("component", "http_router").Logger(),
-		tunnels: make(map[string]*Tunnel),
+		tunnels: make(map[string]*tunnelGroup),
+	}
+	r.landingTmpl = r.loadLandingTemplate()
+	r.interstitialTmpl = r.loadInterstitialTemplate()
+	r.reqLog = logging.Sampled(r.log, server.cfg.Logging)
+	return r
+}
+
+// loadLandingTemplate returns the landing page template: the configured file
+// if one is set and parses, otherwise the embedded default.
+func (r *HTTPRouter) loadLandingTemplate() *template.Template {
+	lp := r.server.cfg.Server.LandingPage
+	if !lp.Enabled {
+		return nil
+	}
+	if lp.Template == "" {
+		return landingTmpl
+	}
+	tmpl, err := template.ParseFiles(lp.Template)
+	if err != nil {
+		r.log.Warn().Err(err).Str("path", lp.Template).Msg("Failed to load landing page template, using default")
+		return landingTmpl
+	}
+	return tmpl
+}
+
+// loadInterstitialTemplate returns the interstitial template: the configured
+// file if one is set and parses, otherwise the embedded default.
+func (r *HTTPRouter) loadInterstitialTemplate() *template.Template {
+	is := r.server.cfg.Server.Interstitial
+	if is.Mode == config.InterstitialOff {
+		return nil
+	}
+	if is.Template == "" {
+		return interstitialTmpl
+	}
+	tmpl, err := template.ParseFiles(is.Template)
+	if err != nil {
+		r.log.Warn().Err(err).Str("path", is.Template).Msg("Failed to load interstitial template, using default")
+		return interstitialTmpl
 	}
+	return tmpl
 }
 
-// RegisterTunnel registers a tunnel for a subdomain
+// RegisterTunnel registers a tunnel for a subdomain. With
+// server.shared_subdomains enabled, a subdomain already served by tunnels of
+// the same user gets this one added to them.
 func (r *HTTPRouter) RegisterTunnel(subdomain string, tunnel *Tunnel) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	subdomain = strings.ToLower(subdomain)
 
-	if _, exists := r.tunnels[subdomain]; exists {
-		return fmt.Errorf("subdomain already in use: %s", subdomain)
+	if group, exists := r.tunnels[subdomain]; exists {
+		if !r.server.cfg.Server.SharedSubdomains.Enabled || !group.mayJoin(tunnel) {
+			return fmt.Errorf("subdomain already in use: %s", subdomain)
+		}
+		group.add(tunnel)
+		r.log.Info().
+			Str("subdomain", subdomain).
+			Str("tunnel_id", tunnel.ID).
+			Int("tunnels", len(group.tunnels)).
+			Msg("Tunnel joined shared subdomain")
+		return nil
 	}
 
-	r.tunnels[subdomain] = tunnel
+	r.tunnels[subdomain] = &tunnelGroup{tunnels: []*Tunnel{tunnel}}
 	r.log.Debug().Str("subdomain", subdomain).Str("tunnel_id", tunnel.ID).Msg("Tunnel registered")
 	return nil
 }
 
-// UnregisterTunnel removes a tunnel for a subdomain
-func (r *HTTPRouter) UnregisterTunnel(subdomain string) {
+// UnregisterTunnel removes a tunnel from a subdomain. Other tunnels sharing
+// the subdomain keep serving it.
+func (r *HTTPRouter) UnregisterTunnel(subdomain, tunnelID string) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	subdomain = strings.ToLower(subdomain)
-	delete(r.tunnels, subdomain)
-	r.log.Debug().Str("subdomain", subdomain).Msg("Tunnel unregistered")
+	group, exists := r.tunnels[subdomain]
+	if !exists {
+		return
+	}
+	if !group.remove(tunnelID) {
+		delete(r.tunnels, subdomain)
+	}
+	r.log.Debug().Str("subdomain", subdomain).Str("tunnel_id", tunnelID).Msg("Tunnel unregistered")
 }
 
-// GetTunnel returns the tunnel for a subdomain
+// GetTunnel returns the tunnel for a subdomain, the first registered one
+// if it is shared
 func (r *HTTPRouter) GetTunnel(subdomain string) *Tunnel {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
 	subdomain = strings.ToLower(subdomain)
-	return r.tunnels[subdomain]
+	if group := r.tunnels[subdomain]; group != nil {
+		return group.tunnels[0]
+	}
+	return nil
+}
+
+// GetTunnels returns all tunnels serving a subdomain
+func (r *HTTPRouter) GetTunnels(subdomain string) []*Tunnel {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	subdomain = strings.ToLower(subdomain)
+	if group := r.tunnels[subdomain]; group != nil {
+		return group.tunnels
+	}
+	return nil
 }
 
 // customDomainOwnerMismatch reports whether a request that arrived via a
@@ -95,8 +186,25 @@ func customDomainOwnerMismatch(customOwnerID, tunnelOwnerID int64) bool {
 // ServeHTTP implements http.Handler. Go's net/http.Server handles HTTP/1.1
 // keep-alive automatically when using this interface.
 func (r *HTTPRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	r.server.activeConns.Add(1)
-	defer r.server.activeConns.Done()
+	// Unified mode: dashboard hosts bypass tunnel routing entirely. They are
+	// not counted in activeConns so long-lived API streams don't hold up the
+	// tunnel drain on shutdown.
+	if req.URL.Path == abuseReportPath && r.isBaseHost(req.Host) {
+		r.handleAbuseReport(w, req)
+		return
+	}
+	if h := r.dashboardHandler(req.Host); h != nil {
+		h.ServeHTTP(w, req)
+		return
+	}
+
+	defer r.server.trackConn()()
+
+	if r.accessLog != nil {
+		var done func()
+		w, done = r.logAccess(w, req)
+		defer done()
+	}
 
 	// ACME challenge intercept
 	if r.server.certManager != nil && strings.HasPrefix(req.URL.Path, "/.well-known/acme-challenge/") {
@@ -116,13 +224,22 @@ func (r *HTTPRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		}
 	}
 	if subdomain == "" {
+		if r.landingTmpl != nil && r.isBaseHost(req.Host) {
+			r.serveLandingPage(w, req, http.StatusOK, "")
+			return
+		}
 		r.log.Debug().Str("host", req.Host).Msg("No subdomain or custom domain found")
 		r.serveErrorPage(w, http.StatusNotFound, "Tunnel not found")
 		return
 	}
 
+	if r.server.isSuspended(subdomain) {
+		r.serveSuspendedPage(w)
+		return
+	}
+
 	// Find tunnel (local first, then Redis cross-node lookup)
-	tunnel := r.GetTunnel(subdomain)
+	tunnel, stick := r.pickTunnel(strings.ToLower(subdomain), req)
 	if tunnel == nil && r.server.tunnelRegistry != nil {
 		entry, err := r.server.tunnelRegistry.LookupBySubdomain(subdomain)
 		if err == nil && entry != nil && entry.ServerID != r.server.LocalNodeID() {
@@ -137,6 +254,10 @@ func (r *HTTPRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 	if tunnel == nil {
 		r.log.Debug().Str("subdomain", subdomain).Msg("Tunnel not found")
+		if r.landingTmpl != nil && customOwnerID < 0 && !r.isReserved(subdomain) {
+			r.serveLandingPage(w, req, http.StatusNotFound, subdomain)
+			return
+		}
 		r.serveErrorPage(w, http.StatusNotFound, "Tunnel not found")
 		return
 	}
@@ -158,46 +279,59 @@ func (r *HTTPRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	// Custom domains are a plan feature. When the owner's plan no longer
+	// includes them (e.g. after a downgrade), prompt an upgrade instead of
+	// proxying.
+	if customOwnerID >= 0 && !planAllowsCustomDomains(client) {
+		r.serveUpgradePage(w, req, featureCustomDomains)
+		return
+	}
+
 	// IP Allowlist check (before auth to reduce load)
 	if !checkIPAllowlist(w, req, tunnel, r.server.trustedProxies) {
+		r.server.stats.reject(rejectIPAllowlist)
 		return
 	}
 
 	// Rate limiting (tunnel-level + per-IP)
 	if !r.server.monitor.AllowHTTPRequest(tunnel.ID, req.RemoteAddr) {
+		r.server.stats.reject(rejectRateLimit)
 		http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
 		return
 	}
 
+	// Monthly traffic quota of the tunnel owner's plan
+	if client.refuseOverQuota(tunnel) {
+		r.server.stats.reject(rejectQuota)
+		r.serveErrorPage(w, http.StatusTooManyRequests, "Monthly traffic quota exceeded")
+		return
+	}
+
 	// Basic Auth check
 	if !checkBasicAuth(w, req, tunnel) {
 		return
 	}
 
+	limitedReq, ok := r.limitRequestBody(w, req, tunnel, subdomain)
+	if !ok {
+		return
+	}
+
+	if stick {
+		setStickyCookie(w, tunnel)
+	}
+
 	// Determine if interstitial might be needed (will check response Content-Type later)
 	isCustomDomain := r.server.LookupCustomDomain(req.Host) != nil
-	mayNeedInterstitial := !client.IsAdmin && !isCustomDomain && r.mayNeedInterstitial(req, subdomain)
+	mayNeedInterstitial := !isCustomDomain && r.interstitialApplies(client) && r.mayNeedInterstitial(req, subdomain)
 
 	// Generate trace ID for this request
 	traceID := generateShortID() + generateShortID() // 16 hex chars
 	req.Header.Set("X-Trace-Id", traceID)
 
-	// Open stream to client
-	stream, err := client.OpenStream()
-	if err != nil {
-		r.log.Error().Err(err).Msg("Failed to open stream to client")
-		r.serveErrorPage(w, http.StatusBadGateway, "Failed to connect to tunnel")
-		return
-	}
-	defer stream.Close()
-
-	// Send binary stream header
+	// Decide before the forwarding headers below are replaced.
 	remoteAddr := req.RemoteAddr
-	if err := protocol.WriteStreamHeader(stream, tunnel.ID, remoteAddr); err != nil {
-		r.log.Error().Err(err).Msg("Failed to send connection info")
-		r.serveErrorPage(w, http.StatusBadGateway, "Failed to connect to tunnel")
-		return
-	}
+	plainHTTP := isPlainHTTP(req, r.server.trustedProxies)
 
 	// Add forwarding headers
 	clientIP := remoteAddr
@@ -218,6 +352,73 @@ func (r *HTTPRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 	req.Header.Set("X-Forwarded-Host", forwardedHost)
 
+	applyPathPrefix(req, tunnel.StripPathPrefix, tunnel.AddPathPrefix)
+
+	// Tunnel header rules run after the server's own headers, so they can
+	// override them.
+	applyRequestHeaderRules(req, tunnel.HeaderRules)
+
+	// Response cache: a fresh stored response is served without opening a
+	// stream to the client, a stale one is revalidated by the local service.
+	var cached *cacheEntry
+	var restoreConditionals func()
+	useCache := tunnel.cache != nil && cacheableRequest(req, tunnel)
+	if useCache {
+		if e := tunnel.cache.get(req); e != nil {
+			if e.fresh(time.Now()) && !revalidationRequested(req) {
+				if mayNeedInterstitial && isHTMLHeader(e.header) {
+					r.serveInterstitialPage(w, req, subdomain)
+					return
+				}
+				r.serveCached(w, req, e, tunnel, plainHTTP, cacheHit)
+				tunnel.LastActivity.Store(time.Now().UnixNano())
+				return
+			}
+			if req.Method == http.MethodGet && e.hasValidators() {
+				cached = e
+				restoreConditionals = setCacheValidators(req, e)
+			}
+		}
+	}
+
+	// Let the client turn the connection down before a stream is opened
+	if tunnel.confirmConns {
+		if err := client.confirmConnection(tunnel, remoteAddr, req); err != nil {
+			r.log.Debug().Err(err).Str("tunnel_id", tunnel.ID).Msg("Connection not accepted by the client")
+			if errors.Is(err, errConnectionDeclined) {
+				r.serveErrorPage(w, http.StatusForbidden, "Connection declined by the tunnel")
+			} else {
+				r.serveErrorPage(w, http.StatusBadGateway, "Tunnel unavailable")
+			}
+			return
+		}
+	}
+
+	// Open stream to client
+	stream, err := client.OpenStream()
+	if err != nil {
+		r.log.Error().Err(err).Msg("Failed to open stream to client")
+		r.serveErrorPage(w, http.StatusBadGateway, "Failed to connect to tunnel")
+		return
+	}
+	defer stream.Close()
+
+	// The tunnel may have been closed since it was looked up
+	if !tunnel.conns.acquire(stream) {
+		r.serveErrorPage(w, http.StatusServiceUnavailable, "Tunnel is closing")
+		return
+	}
+	defer tunnel.conns.release(stream)
+
+	// Send binary stream header
+	stream, err = client.writeStreamHeader(stream, tunnel, remoteAddr)
+	if err != nil {
+		r.log.Error().Err(err).Msg("Failed to send connection info")
+		r.serveErrorPage(w, http.StatusBadGateway, "Failed to connect to tunnel")
+		return
+	}
+	stream = countTunnelBytes(stream, tunnel)
+
 	// WebSocket / HTTP Upgrade: hijack and do bidirectional proxy
 	if isUpgradeRequest(req) {
 		r.serveUpgrade(w, req, stream)
@@ -228,6 +429,9 @@ func (r *HTTPRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	inspectBuf := r.server.inspectMgr.Get(tunnel.ID)
 	if inspectBuf == nil {
 		r.log.Debug().Str("tunnel_id", tunnel.ID).Msg("Inspect buffer not found for tunnel")
+	} else if r.server.inspectMgr.CaptureMode(tunnel.ID) == inspect.CaptureNone {
+		// Capture is disabled for this tunnel: stream bodies without buffering.
+		inspectBuf = nil
 	}
 	startTime := time.Now()
 	var capturedReqBuf bytes.Buffer
@@ -240,6 +444,9 @@ func (r *HTTPRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 	// Write the HTTP request to the stream
 	if err := req.Write(stream); err != nil {
+		if r.abortTooLarge(w, limitedReq, tunnel, subdomain) {
+			return
+		}
 		r.log.Error().Err(err).Msg("Failed to write request to stream")
 		r.serveErrorPage(w, http.StatusBadGateway, "Failed to proxy request")
 		return
@@ -255,6 +462,24 @@ func (r *HTTPRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 	defer resp.Body.Close()
 
+	// The stored response is still current: serve it with the refreshed
+	// headers
+	if cached != nil && resp.StatusCode == http.StatusNotModified {
+		e := tunnel.cache.refresh(req, cached, resp.Header, time.Now())
+		restoreConditionals()
+		if mayNeedInterstitial && isHTMLHeader(e.header) {
+			r.serveInterstitialPage(w, req, subdomain)
+			return
+		}
+		r.serveCached(w, req, e, tunnel, plainHTTP, cacheRevalidated)
+		if inspectBuf != nil {
+			ex := r.buildCapturedExchangeFromResponse(tunnel.ID, traceID, req, startTime, capturedReqBuf.Bytes(), remoteAddr, resp, nil)
+			r.server.inspectMgr.AddAndPersist(tunnel.ID, ex)
+		}
+		tunnel.LastActivity.Store(time.Now().UnixNano())
+		return
+	}
+
 	// Check if interstitial is needed based on response Content-Type
 	// Only show interstitial for HTML responses to avoid blocking JSON/text/etc
 	if mayNeedInterstitial && r.isHTMLResponse(resp) {
@@ -262,6 +487,20 @@ func (r *HTTPRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	// Keep a copy of storable responses for the cache; the stored headers
+	// are the local service's, header rules apply whenever it is served
+	var cacheRec *cacheRecorder
+	var cacheHeader http.Header
+	if useCache {
+		w.Header().Set(cacheStatusHeader, cacheMiss)
+		if req.Method == http.MethodGet && resp.ContentLength <= tunnel.cache.maxEntry {
+			cacheRec = &cacheRecorder{r: resp.Body, limit: tunnel.cache.maxEntry}
+			cacheHeader = resp.Header.Clone()
+		}
+	}
+
+	applyResponseHeaderRules(resp.Header, tunnel.HeaderRules, plainHTTP)
+
 	// Copy response headers to ResponseWriter
 	for key, values := range resp.Header {
 		for _, v := range values {
@@ -274,9 +513,12 @@ func (r *HTTPRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	// --- Inspection: set up TeeReader to capture while streaming ---
 	var capturedRespBuf bytes.Buffer
 	bodyReader := io.Reader(resp.Body)
+	if cacheRec != nil {
+		bodyReader = cacheRec
+	}
 	if inspectBuf != nil {
 		maxBody := r.server.inspectMgr.MaxBodySize()
-		bodyReader = io.TeeReader(resp.Body, &limitedWriter{w: &capturedRespBuf, remaining: maxBody})
+		bodyReader = io.TeeReader(bodyReader, &limitedWriter{w: &capturedRespBuf, remaining: maxBody})
 	}
 
 	// Copy response body, using Flusher for streaming
@@ -301,6 +543,12 @@ func (r *HTTPRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		proxyBufPool.Put(bp)
 	}
 
+	if cacheRec != nil {
+		if body, ok := cacheRec.body(); ok {
+			tunnel.cache.put(req, resp.StatusCode, cacheHeader, body, time.Now())
+		}
+	}
+
 	// --- Inspection: build and store exchange ---
 	if inspectBuf != nil {
 		ex := r.buildCapturedExchangeFromResponse(tunnel.ID, traceID, req, startTime, capturedReqBuf.Bytes(), remoteAddr, resp, capturedRespBuf.Bytes())
@@ -315,7 +563,7 @@ func (r *HTTPRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	// Update LastActivity timestamp for auto-close tracking
 	tunnel.LastActivity.Store(time.Now().UnixNano())
 
-	r.log.Debug().
+	r.reqLog.Debug().
 		Str("trace_id", traceID).
 		Str("subdomain", subdomain).
 		Str("method", req.Method).
@@ -333,7 +581,9 @@ func isUpgradeRequest(req *http.Request) bool {
 }
 
 // serveUpgrade hijacks the connection and performs bidirectional proxying
-// for WebSocket and other HTTP upgrade protocols.
+// for WebSocket and other HTTP upgrade protocols. The upgraded connection is
+// long-lived, so the HTTP server's read/write/idle deadlines are cleared, and
+// an EOF from either side is passed on as a half-close.
 func (r *HTTPRouter) serveUpgrade(w http.ResponseWriter, req *http.Request, stream net.Conn) {
 	hj, ok := w.(http.Hijacker)
 	if !ok {
@@ -357,7 +607,11 @@ func (r *HTTPRouter) serveUpgrade(w http.ResponseWriter, req *http.Request, stre
 	}
 	defer clientConn.Close()
 
-	r.log.Debug().
+	// Hijacked connections keep the deadlines set from the server's
+	// ReadTimeout/WriteTimeout, which would cut the WebSocket off.
+	_ = clientConn.SetDeadline(time.Time{})
+
+	r.reqLog.Debug().
 		Str("upgrade", req.Header.Get("Upgrade")).
 		Str("path", req.URL.Path).
 		Msg("WebSocket/Upgrade connection established")
@@ -372,10 +626,8 @@ func (r *HTTPRouter) serveUpgrade(w http.ResponseWriter, req *http.Request, stre
 		bp := proxyBufPool.Get().(*[]byte)
 		_, _ = io.CopyBuffer(clientConn, stream, *bp)
 		proxyBufPool.Put(bp)
-		// Close write side to signal EOF
-		if tc, ok := clientConn.(*net.TCPConn); ok {
-			_ = tc.CloseWrite()
-		}
+		// Close write side to signal EOF (TCP or TLS)
+		_ = protocol.CloseWrite(clientConn)
 	}()
 
 	// client → stream (flush any buffered data, then copy)
@@ -393,9 +645,7 @@ func (r *HTTPRouter) serveUpgrade(w http.ResponseWriter, req *http.Request, stre
 		_, _ = io.CopyBuffer(stream, clientConn, *bp)
 		proxyBufPool.Put(bp)
 		// Close write side to signal EOF
-		if cs, ok := stream.(interface{ CloseWrite() error }); ok {
-			_ = cs.CloseWrite()
-		}
+		_ = protocol.CloseWrite(stream)
 	}()
 
 	wg.Wait()
@@ -428,6 +678,72 @@ func (r *HTTPRouter) extractSubdomain(host string) string {
 	return ""
 }
 
+// SetDashboard makes the router serve the given hosts with h (the API and
+// dashboard) so both can share the tunnel HTTP listener. A nil handler turns
+// unified routing off.
+func (r *HTTPRouter) SetDashboard(h http.Handler, hosts []string) {
+	set := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		set[strings.ToLower(normalizeHost(host))] = true
+	}
+
+	r.dashboardMu.Lock()
+	defer r.dashboardMu.Unlock()
+	r.dashboard = h
+	r.dashboardHosts = set
+}
+
+// dashboardHandler returns the dashboard handler when host is a dashboard
+// host in unified mode, or nil.
+func (r *HTTPRouter) dashboardHandler(host string) http.Handler {
+	r.dashboardMu.RLock()
+	defer r.dashboardMu.RUnlock()
+	if r.dashboard == nil || !r.dashboardHosts[strings.ToLower(normalizeHost(host))] {
+		return nil
+	}
+	return r.dashboard
+}
+
+// isBaseHost reports whether host is the base domain or one of its aliases
+// (optionally with a www. prefix or a port).
+func (r *HTTPRouter) isBaseHost(host string) bool {
+	host = strings.ToLower(normalizeHost(host))
+	host = strings.TrimPrefix(host, "www.")
+	if host == strings.ToLower(r.server.cfg.Domain.Base) {
+		return true
+	}
+	for _, alias := range r.server.cfg.Domain.Aliases {
+		if host == strings.ToLower(alias) {
+			return true
+		}
+	}
+	return false
+}
+
+// isReserved reports whether a subdomain is reserved by some user, in which
+// case a missing tunnel means "offline" rather than "unregistered". Without a
+// database nothing can be reserved.
+func (r *HTTPRouter) isReserved(subdomain string) bool {
+	if r.server.db == nil {
+		return false
+	}
+	return r.server.isReservedSubdomain(subdomain)
+}
+
+// interstitialApplies reports whether the client's tunnels get the
+// interstitial under server.interstitial.mode. Paid plans are exempt in free
+// mode; admins always are.
+func (r *HTTPRouter) interstitialApplies(client *Client) bool {
+	if r.interstitialTmpl == nil || client.IsAdmin {
+		return false
+	}
+	if r.server.cfg.Server.Interstitial.Mode == config.InterstitialFree {
+		plan := client.currentPlan()
+		return plan == nil || plan.Price <= 0
+	}
+	return true
+}
+
 // mayNeedInterstitial determines if an interstitial warning page might be needed.
 // The actual decision is made after seeing the response Content-Type.
 func (r *HTTPRouter) mayNeedInterstitial(req *http.Request, subdomain string) bool {
@@ -453,7 +769,12 @@ func (r *HTTPRouter) mayNeedInterstitial(req *http.Request, subdomain string) bo
 // isHTMLResponse checks if the response Content-Type indicates HTML content.
 // This is used to determine whether to show the interstitial warning.
 func (r *HTTPRouter) isHTMLResponse(resp *http.Response) bool {
-	contentType := resp.Header.Get("Content-Type")
+	return isHTMLHeader(resp.Header)
+}
+
+// isHTMLHeader reports whether h declares an HTML document.
+func isHTMLHeader(h http.Header) bool {
+	contentType := h.Get("Content-Type")
 	if contentType == "" {
 		return false
 	}
@@ -491,9 +812,15 @@ func detectLanguage(req *http.Request) string {
 	return "en"
 }
 
-// interstitialData holds template data for the interstitial page
+// defaultConsentTTL is how long the interstitial consent cookie lasts when
+// server.interstitial.consent_ttl is not set.
+const defaultConsentTTL = 12 * time.Hour
+
+// interstitialData holds template data for the interstitial page. MaxAge is
+// the consent cookie lifetime in seconds.
 type interstitialData struct {
 	Lang, Title, Host, Text, Subdomain, Button string
+	MaxAge                                     int
 }
 
 // serveInterstitialPage serves the interstitial warning page via http.ResponseWriter
@@ -501,15 +828,25 @@ func (r *HTTPRouter) serveInterstitialPage(w http.ResponseWriter, req *http.Requ
 	lang := detectLanguage(req)
 	texts := interstitialLocales[lang]
 
+	ttl := r.server.cfg.Server.Interstitial.ConsentTTL
+	if ttl <= 0 {
+		ttl = defaultConsentTTL
+	}
+
 	var buf bytes.Buffer
-	_ = interstitialTmpl.Execute(&buf, interstitialData{
+	if err := r.interstitialTmpl.Execute(&buf, interstitialData{
 		Lang:      texts.Lang,
 		Title:     texts.Title,
 		Host:      req.Host,
 		Text:      texts.Text,
 		Subdomain: subdomain,
 		Button:    texts.Button,
-	})
+		MaxAge:    int(ttl / time.Second),
+	}); err != nil {
+		r.log.Warn().Err(err).Msg("Failed to render interstitial page")
+		r.serveErrorPage(w, http.StatusInternalServerError, "Failed to render warning page")
+		return
+	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.Header().Set("Cache-Control", "no-store")
@@ -517,6 +854,144 @@ func (r *HTTPRouter) serveInterstitialPage(w http.ResponseWriter, req *http.Requ
 	_, _ = w.Write(buf.Bytes())
 }
 
+// landingTexts holds localized strings for the landing page. Base is used on
+// the base domain, Free on an unregistered subdomain.
+type landingTexts struct {
+	Lang, Title, Base, Free, Button string
+}
+
+var landingLocales = map[string]landingTexts{
+	"en": {
+		Lang:   "en",
+		Title:  "fxTunnel",
+		Base:   "Expose your local HTTP, TCP and UDP services to the internet through a secure tunnel in seconds.",
+		Free:   "No tunnel is running on this address yet. Sign up for fxTunnel and make it yours.",
+		Button: "Get started",
+	},
+	"ru": {
+		Lang:   "ru",
+		Title:  "fxTunnel",
+		Base:   "Откройте доступ к локальным HTTP, TCP и UDP сервисам из интернета через защищённый туннель за секунды.",
+		Free:   "На этом адресе пока нет туннеля. Зарегистрируйтесь в fxTunnel и займите его.",
+		Button: "Начать",
+	},
+}
+
+// landingData holds template data for the landing page
+type landingData struct {
+	Lang, Title, Host, Text, Button, SignupURL, BaseDomain string
+}
+
+// serveLandingPage serves the landing page. subdomain is empty on the base
+// domain and names the requested subdomain otherwise.
+func (r *HTTPRouter) serveLandingPage(w http.ResponseWriter, req *http.Request, status int, subdomain string) {
+	texts := landingLocales[detectLanguage(req)]
+	data := landingData{
+		Lang:       texts.Lang,
+		Title:      texts.Title,
+		Text:       texts.Base,
+		Button:     texts.Button,
+		SignupURL:  r.server.cfg.Server.LandingPage.SignupURL,
+		BaseDomain: r.server.cfg.Domain.Base,
+	}
+	if data.SignupURL == "" {
+		data.SignupURL = "https://" + r.server.cfg.Domain.Base + "/register"
+	}
+	if subdomain != "" {
+		data.Host = normalizeHost(req.Host)
+		data.Text = texts.Free
+	}
+
+	var buf bytes.Buffer
+	if err := r.landingTmpl.Execute(&buf, data); err != nil {
+		r.log.Warn().Err(err).Msg("Failed to render landing page")
+		r.serveErrorPage(w, http.StatusNotFound, "Tunnel not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = w.Write(buf.Bytes())
+}
+
+// planFeature identifies a plan-gated feature shown on the upgrade page.
+type planFeature int
+
+const (
+	featureCustomDomains planFeature = iota
+)
+
+// planAllowsCustomDomains reports whether the client's plan lets it serve
+// traffic on custom domains. Admins and clients without a plan (legacy
+// tokens) are not gated.
+func planAllowsCustomDomains(c *Client) bool {
+	if c.IsAdmin {
+		return true
+	}
+	plan := c.currentPlan()
+	return plan == nil || plan.MaxCustomDomains != 0
+}
+
+// upgradeTexts holds localized strings for the upgrade page, with one
+// explanation per plan-gated feature.
+type upgradeTexts struct {
+	Lang, Title, Button string
+	Features            map[planFeature]string
+}
+
+var upgradeLocales = map[string]upgradeTexts{
+	"en": {
+		Lang:   "en",
+		Title:  "Upgrade required",
+		Button: "See plans",
+		Features: map[planFeature]string{
+			featureCustomDomains: "Custom domains are not included in the owner's current plan. Upgrade to serve this tunnel on your own domain.",
+		},
+	},
+	"ru": {
+		Lang:   "ru",
+		Title:  "Требуется другой тариф",
+		Button: "Смотреть тарифы",
+		Features: map[planFeature]string{
+			featureCustomDomains: "Собственные домены не входят в текущий тариф владельца. Смените тариф, чтобы открыть туннель на своём домене.",
+		},
+	},
+}
+
+// upgradeData holds template data for the upgrade page
+type upgradeData struct {
+	Lang, Title, Host, Text, Button, PricingURL string
+}
+
+// serveUpgradePage serves a branded 403 page explaining that the requested
+// feature needs a different plan, with a link to the pricing page.
+func (r *HTTPRouter) serveUpgradePage(w http.ResponseWriter, req *http.Request, feature planFeature) {
+	texts := upgradeLocales[detectLanguage(req)]
+	data := upgradeData{
+		Lang:       texts.Lang,
+		Title:      texts.Title,
+		Host:       normalizeHost(req.Host),
+		Text:       texts.Features[feature],
+		Button:     texts.Button,
+		PricingURL: r.server.cfg.Server.LandingPage.PricingURL,
+	}
+	if data.PricingURL == "" {
+		data.PricingURL = "https://" + r.server.cfg.Domain.Base + "/pricing"
+	}
+
+	var buf bytes.Buffer
+	if err := upgradeTmpl.Execute(&buf, data); err != nil {
+		r.log.Warn().Err(err).Msg("Failed to render upgrade page")
+		r.serveErrorPage(w, http.StatusForbidden, "Not available on the current plan")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusForbidden)
+	_, _ = w.Write(buf.Bytes())
+}
+
 // errorData holds template data for the error page
 type errorData struct {
 	StatusCode int
@@ -603,8 +1078,19 @@ func (r *HTTPRouter) ReplayRequest(subdomain string, req *http.Request) (*inspec
 	}
 	defer stream.Close()
 
+	// The replay ends with its context, which the API bounds with the
+	// replay timeout.
+	ctx := req.Context()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = stream.SetDeadline(deadline)
+	}
+	conn := stream
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
 	// Send binary stream header
-	if err := protocol.WriteStreamHeader(stream, tunnel.ID, "replay"); err != nil {
+	stream, err = client.writeStreamHeader(stream, tunnel, "replay")
+	if err != nil {
 		return nil, fmt.Errorf("send connection info: %w", err)
 	}
 
@@ -619,12 +1105,16 @@ func (r *HTTPRouter) ReplayRequest(subdomain string, req *http.Request) (*inspec
 	}
 	defer resp.Body.Close()
 
-	body, _ := io.ReadAll(io.LimitReader(resp.Body, int64(inspect.MaxBodySize)))
+	body, truncated, _ := inspect.ReadBody(resp.Body, inspect.MaxBodySize)
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
 
 	return &inspect.ReplayResult{
 		StatusCode: resp.StatusCode,
 		Headers:    resp.Header,
 		Body:       body,
+		Truncated:  truncated,
 	}, nil
 }
 
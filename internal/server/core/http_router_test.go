@@ -1,15 +1,20 @@
 package core
 
 import (
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/rs/zerolog"
 
 	"github.com/mephistofox/fxtun.dev/internal/config"
 	"github.com/mephistofox/fxtun.dev/internal/protocol"
+	"github.com/mephistofox/fxtun.dev/internal/server/database"
 )
 
 func newTestRouter(baseDomain string) (*HTTPRouter, *Server) {
@@ -106,7 +111,7 @@ func TestUnregisterTunnel(t *testing.T) {
 
 	tunnel := &Tunnel{ID: "t1", ClientID: "c1"}
 	_ = router.RegisterTunnel("gone", tunnel)
-	router.UnregisterTunnel("gone")
+	router.UnregisterTunnel("gone", "t1")
 
 	if got := router.GetTunnel("gone"); got != nil {
 		t.Fatal("expected nil after unregister")
@@ -143,6 +148,87 @@ func TestServeHTTPNoSubdomain(t *testing.T) {
 	}
 }
 
+func TestServeHTTPLandingPage(t *testing.T) {
+	router, srv := newTestRouter("example.com")
+	defer srv.cancel()
+	srv.cfg.Server.LandingPage.Enabled = true
+	router.landingTmpl = router.loadLandingTemplate()
+
+	tests := []struct {
+		host       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"example.com", http.StatusOK, "Expose your local"},
+		{"www.example.com", http.StatusOK, "Expose your local"},
+		{"xyz.example.com", http.StatusNotFound, "xyz.example.com"},
+		{"other.com", http.StatusNotFound, "No active tunnel"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://"+tt.host+"/", nil)
+			req.Host = tt.host
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d", tt.wantStatus, w.Code)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Fatalf("expected body to contain %q", tt.wantBody)
+			}
+			if tt.host != "other.com" && !strings.Contains(w.Body.String(), "https://example.com/register") {
+				t.Fatal("expected signup link on landing page")
+			}
+		})
+	}
+}
+
+func TestServeHTTPUnifiedDashboard(t *testing.T) {
+	router, srv := newTestRouter("example.com")
+	defer srv.cancel()
+
+	dashboard := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("dashboard"))
+	})
+	router.SetDashboard(dashboard, srv.cfg.DashboardHosts())
+
+	tests := []struct {
+		host          string
+		wantDashboard bool
+	}{
+		{"example.com", true},
+		{"EXAMPLE.com:443", true},
+		{"www.example.com", true},
+		{"foo.example.com", false},
+		{"other.com", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://"+tt.host+"/api/health", nil)
+			req.Host = tt.host
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			if got := w.Body.String() == "dashboard"; got != tt.wantDashboard {
+				t.Fatalf("dashboard served = %v, want %v (status %d)", got, tt.wantDashboard, w.Code)
+			}
+		})
+	}
+
+	router.SetDashboard(nil, nil)
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Body.String() == "dashboard" {
+		t.Fatal("expected dashboard routing to be off after SetDashboard(nil)")
+	}
+}
+
 func TestMayNeedInterstitial(t *testing.T) {
 	router, _ := newTestRouter("example.com")
 
@@ -176,6 +262,64 @@ func TestMayNeedInterstitial(t *testing.T) {
 	}
 }
 
+func TestInterstitialApplies(t *testing.T) {
+	free := &database.Plan{Slug: "free"}
+	paid := &database.Plan{Slug: "pro", Price: 5}
+
+	tests := []struct {
+		mode   string
+		client *Client
+		want   bool
+	}{
+		{config.InterstitialAll, &Client{Plan: paid}, true},
+		{config.InterstitialAll, &Client{IsAdmin: true}, false},
+		{config.InterstitialFree, &Client{Plan: free}, true},
+		{config.InterstitialFree, &Client{}, true},
+		{config.InterstitialFree, &Client{Plan: paid}, false},
+		{config.InterstitialOff, &Client{Plan: free}, false},
+	}
+
+	for _, tt := range tests {
+		router, srv := newTestRouter("example.com")
+		srv.cfg.Server.Interstitial.Mode = tt.mode
+		router.interstitialTmpl = router.loadInterstitialTemplate()
+		if got := router.interstitialApplies(tt.client); got != tt.want {
+			t.Errorf("mode %s, plan %v, admin %v: interstitialApplies = %v, want %v",
+				tt.mode, tt.client.Plan, tt.client.IsAdmin, got, tt.want)
+		}
+	}
+}
+
+func TestServeInterstitialPage(t *testing.T) {
+	router, srv := newTestRouter("example.com")
+
+	req := httptest.NewRequest(http.MethodGet, "http://app.example.com/", nil)
+	w := httptest.NewRecorder()
+	router.serveInterstitialPage(w, req, "app")
+	if body := w.Body.String(); !strings.Contains(body, "_fxt_consent_app=1; Path=/; Max-Age=43200") {
+		t.Errorf("default consent cookie missing from page:\n%s", body)
+	}
+
+	srv.cfg.Server.Interstitial.ConsentTTL = 30 * 24 * time.Hour
+	w = httptest.NewRecorder()
+	router.serveInterstitialPage(w, req, "app")
+	if body := w.Body.String(); !strings.Contains(body, "Max-Age=2592000") {
+		t.Errorf("configured consent TTL missing from page:\n%s", body)
+	}
+
+	path := filepath.Join(t.TempDir(), "interstitial.html")
+	if err := os.WriteFile(path, []byte(`<p>{{.Host}} is a developer tunnel</p>`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	srv.cfg.Server.Interstitial.Template = path
+	router.interstitialTmpl = router.loadInterstitialTemplate()
+	w = httptest.NewRecorder()
+	router.serveInterstitialPage(w, req, "app")
+	if body := w.Body.String(); body != "<p>app.example.com is a developer tunnel</p>" {
+		t.Errorf("custom template body = %q", body)
+	}
+}
+
 func TestIsHTMLResponse(t *testing.T) {
 	router, _ := newTestRouter("example.com")
 
@@ -256,3 +400,104 @@ func TestIsUpgradeRequest(t *testing.T) {
 		}
 	}
 }
+
+func TestServeHTTPCustomDomainUpgradePage(t *testing.T) {
+	router, srv := newTestRouter("example.com")
+	defer srv.cancel()
+
+	client := &Client{ID: "c1", UserID: 5, server: srv, log: zerolog.Nop(), Tunnels: map[string]*Tunnel{},
+		Plan: &database.Plan{Slug: "free", MaxCustomDomains: 0}}
+	srv.clientMgr.addClient(client.ID, client)
+	if err := router.RegisterTunnel("app", &Tunnel{ID: "t1", Type: protocol.TunnelHTTP, Subdomain: "app", ClientID: "c1"}); err != nil {
+		t.Fatal(err)
+	}
+	srv.AddCustomDomain(&database.CustomDomain{Domain: "app.custom.com", TargetSubdomain: "app", UserID: 5, Verified: true})
+
+	req := httptest.NewRequest(http.MethodGet, "http://app.custom.com/", nil)
+	req.Header.Set("Accept-Language", "ru-RU")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", w.Code)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, "https://example.com/pricing") || !strings.Contains(body, "Смотреть тарифы") {
+		t.Fatalf("expected localized upgrade prompt with pricing link, got %q", body)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Fatalf("expected HTML page, got %q", ct)
+	}
+}
+
+// Requests rejected by a tunnel's allowlist or basic auth are answered by the
+// router itself. The client has no session here, so reaching the proxy
+// would fail the test.
+func TestServeHTTPProtectedTunnel(t *testing.T) {
+	router, srv := newTestRouter("example.com")
+	defer srv.cancel()
+	srv.trustedProxies = trustLoopback
+
+	client := &Client{ID: "c1", server: srv, log: zerolog.Nop(), Tunnels: map[string]*Tunnel{}}
+	srv.clientMgr.addClient(client.ID, client)
+	tunnel := &Tunnel{
+		ID:            "t1",
+		Type:          protocol.TunnelHTTP,
+		Subdomain:     "staging",
+		ClientID:      "c1",
+		BasicAuthHash: hashCredentials(t, "qa", "s3cret"),
+		AllowedIPs:    []net.IP{net.ParseIP("203.0.113.50")},
+	}
+	if err := router.RegisterTunnel("staging", tunnel); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     map[string]string
+		want       int
+	}{
+		{"blocked IP", "198.51.100.7:5000", nil, http.StatusForbidden},
+		{"spoofed XFF from untrusted peer", "198.51.100.7:5000", map[string]string{"X-Forwarded-For": "203.0.113.50"}, http.StatusForbidden},
+		{"allowed IP without credentials", "203.0.113.50:5000", nil, http.StatusUnauthorized},
+		{"XFF from trusted proxy", "127.0.0.1:5000", map[string]string{"X-Forwarded-For": "203.0.113.50"}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://staging.example.com/", nil)
+		req.RemoteAddr = tt.remoteAddr
+		for k, v := range tt.header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, w.Code)
+		}
+		if tt.want == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: expected a WWW-Authenticate challenge", tt.name)
+		}
+	}
+}
+
+func TestPlanAllowsCustomDomains(t *testing.T) {
+	cases := []struct {
+		name   string
+		client *Client
+		want   bool
+	}{
+		{"legacy token without plan", &Client{}, true},
+		{"admin", &Client{IsAdmin: true, Plan: &database.Plan{}}, true},
+		{"plan without custom domains", &Client{Plan: &database.Plan{MaxCustomDomains: 0}}, false},
+		{"plan with custom domains", &Client{Plan: &database.Plan{MaxCustomDomains: 3}}, true},
+		{"unlimited plan", &Client{Plan: &database.Plan{MaxCustomDomains: -1}}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := planAllowsCustomDomains(tc.client); got != tc.want {
+				t.Errorf("planAllowsCustomDomains() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package core
+
+import "net"
+
+// lingerListener sets SO_LINGER on every connection it accepts.
+type lingerListener struct {
+	net.Listener
+	sec int
+}
+
+// withLinger wraps l so accepted TCP connections linger for *sec seconds on
+// close. A nil sec keeps the system behaviour and returns l unchanged.
+func withLinger(l net.Listener, sec *int) net.Listener {
+	if sec == nil {
+		return l
+	}
+	return &lingerListener{Listener: l, sec: *sec}
+}
+
+func (l *lingerListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if tc, ok := conn.(*net.TCPConn); ok {
+		_ = tc.SetLinger(l.sec)
+	}
+	return conn, nil
+}
@@ -4,22 +4,63 @@ package core
 
 import (
 	"context"
+	"fmt"
 	"net"
 	"syscall"
 
 	"golang.org/x/sys/unix"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
 )
 
-// newReusePortListener creates a TCP listener with SO_REUSEPORT enabled.
-func newReusePortListener(ctx context.Context, addr string) (net.Listener, error) {
+// newTCPListener creates a TCP listener tuned by opts: SO_REUSEPORT,
+// SO_REUSEADDR, the accept backlog and SO_LINGER on accepted connections.
+func newTCPListener(ctx context.Context, addr string, opts config.ListenerSettings) (net.Listener, error) {
 	lc := net.ListenConfig{
 		Control: func(network, address string, c syscall.RawConn) error {
-			// Best-effort: ignore SO_REUSEPORT errors (not fatal)
+			// Best-effort: ignore socket option errors (not fatal)
 			_ = c.Control(func(fd uintptr) {
-				_ = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+				if opts.ReusePort {
+					_ = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+				}
+				// Go enables SO_REUSEADDR on every listener; only turn it off.
+				if !opts.ReuseAddr {
+					_ = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 0)
+				}
 			})
 			return nil
 		},
 	}
-	return lc.Listen(ctx, "tcp", addr)
+	l, err := lc.Listen(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Backlog > 0 {
+		if err := setListenBacklog(l, opts.Backlog); err != nil {
+			l.Close()
+			return nil, fmt.Errorf("set backlog: %w", err)
+		}
+	}
+	return withLinger(l, opts.Linger), nil
+}
+
+// setListenBacklog re-issues listen(2) on an already listening socket, which
+// Linux accepts as a request to resize the accept queue. The kernel still
+// caps the value at net.core.somaxconn.
+func setListenBacklog(l net.Listener, backlog int) error {
+	tl, ok := l.(*net.TCPListener)
+	if !ok {
+		return nil
+	}
+	rc, err := tl.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var listenErr error
+	if err := rc.Control(func(fd uintptr) {
+		listenErr = unix.Listen(int(fd), backlog)
+	}); err != nil {
+		return err
+	}
+	return listenErr
 }
@@ -5,9 +5,16 @@ package core
 import (
 	"context"
 	"net"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
 )
 
-// newReusePortListener creates a standard TCP listener (SO_REUSEPORT not available).
-func newReusePortListener(_ context.Context, addr string) (net.Listener, error) {
-	return net.Listen("tcp", addr)
+// newTCPListener creates a standard TCP listener. SO_REUSEPORT, SO_REUSEADDR
+// and the backlog are Linux-only; only SO_LINGER from opts is applied.
+func newTCPListener(_ context.Context, addr string, opts config.ListenerSettings) (net.Listener, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return withLinger(l, opts.Linger), nil
 }
@@ -0,0 +1,46 @@
+package core
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+)
+
+func TestNewTCPListener_Options(t *testing.T) {
+	linger := 0
+	opts := config.ListenerSettings{Backlog: 1024, ReusePort: true, ReuseAddr: true, Linger: &linger}
+	l, err := newTCPListener(context.Background(), "127.0.0.1:0", opts)
+	require.NoError(t, err)
+	defer l.Close()
+	_, ok := l.(*lingerListener)
+	assert.True(t, ok, "linger option should wrap the listener")
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+		close(accepted)
+	}()
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+
+	conn := <-accepted
+	require.NotNil(t, conn)
+	conn.Close()
+}
+
+func TestWithLinger_Unset(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	assert.Same(t, l, withLinger(l, nil))
+}
@@ -0,0 +1,318 @@
+package core
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+// Reasons a visitor connection or request is refused before reaching a
+// tunnel, or a client connection before its session starts.
+const (
+	rejectIPAllowlist   = "ip_allowlist"
+	rejectRateLimit     = "rate_limit"
+	rejectAuthRateLimit = "auth_rate_limit"
+	rejectQuota         = "quota"
+	rejectConnLimit     = "connection_limit"
+	rejectIPBan         = "ip_ban"
+	rejectGeoPolicy     = "geo_policy"
+)
+
+// dataPlaneStats holds the server-wide data-plane counters exported by
+// MetricsCollector. Per-tunnel byte counts live on the Tunnel itself.
+type dataPlaneStats struct {
+	streamsOpened atomic.Int64
+	streamsClosed atomic.Int64
+
+	rejectedIPAllowlist   atomic.Int64
+	rejectedRateLimit     atomic.Int64
+	rejectedAuthRateLimit atomic.Int64
+	rejectedQuota         atomic.Int64
+	rejectedConnLimit     atomic.Int64
+	rejectedIPBan         atomic.Int64
+	rejectedGeoPolicy     atomic.Int64
+
+	// Control and data connections by negotiated compression
+	compressionNone   atomic.Int64
+	compressionZstd   atomic.Int64
+	compressionSnappy atomic.Int64
+}
+
+func (s *dataPlaneStats) reject(reason string) {
+	switch reason {
+	case rejectIPAllowlist:
+		s.rejectedIPAllowlist.Add(1)
+	case rejectRateLimit:
+		s.rejectedRateLimit.Add(1)
+	case rejectAuthRateLimit:
+		s.rejectedAuthRateLimit.Add(1)
+	case rejectQuota:
+		s.rejectedQuota.Add(1)
+	case rejectConnLimit:
+		s.rejectedConnLimit.Add(1)
+	case rejectIPBan:
+		s.rejectedIPBan.Add(1)
+	case rejectGeoPolicy:
+		s.rejectedGeoPolicy.Add(1)
+	}
+}
+
+func (s *dataPlaneStats) negotiated(c protocol.Compression) {
+	switch c {
+	case protocol.CompressionNone:
+		s.compressionNone.Add(1)
+	case protocol.CompressionZstd:
+		s.compressionZstd.Add(1)
+	case protocol.CompressionSnappy:
+		s.compressionSnappy.Add(1)
+	}
+}
+
+// countedStream counts a yamux stream as closed the first time Close is
+// called, however many times callers close it. Writes are timed against the
+// owning client's session pressure when there is one.
+type countedStream struct {
+	net.Conn
+	stats    *dataPlaneStats
+	pressure *sessionPressure
+	once     sync.Once
+}
+
+func (s *dataPlaneStats) trackStream(stream net.Conn, pressure *sessionPressure) net.Conn {
+	s.streamsOpened.Add(1)
+	return &countedStream{Conn: stream, stats: s, pressure: pressure}
+}
+
+func (c *countedStream) Write(p []byte) (int, error) {
+	if c.pressure == nil {
+		return c.Conn.Write(p)
+	}
+	return c.pressure.write(c.Conn, p)
+}
+
+func (c *countedStream) Close() error {
+	c.once.Do(func() { c.stats.streamsClosed.Add(1) })
+	return c.Conn.Close()
+}
+
+func (c *countedStream) CloseWrite() error {
+	return protocol.CloseWrite(c.Conn)
+}
+
+// tunnelConn attributes the bytes of one stream to its tunnel: writes carry
+// visitor traffic into the tunnel, reads carry the client's replies out.
+type tunnelConn struct {
+	net.Conn
+	tunnel *Tunnel
+}
+
+func countTunnelBytes(stream net.Conn, tunnel *Tunnel) net.Conn {
+	return &tunnelConn{Conn: stream, tunnel: tunnel}
+}
+
+func (c *tunnelConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.tunnel.countOut(int64(n))
+	return n, err
+}
+
+func (c *tunnelConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.tunnel.countIn(int64(n))
+	return n, err
+}
+
+func (c *tunnelConn) CloseWrite() error {
+	return protocol.CloseWrite(c.Conn)
+}
+
+var (
+	clientsDesc = prometheus.NewDesc(
+		"fxtunnel_server_clients",
+		"Number of clients connected to the tunnel server",
+		nil, nil)
+	tunnelsDesc = prometheus.NewDesc(
+		"fxtunnel_server_tunnels",
+		"Number of active tunnels by type and owner plan",
+		[]string{"type", "plan"}, nil)
+	tunnelBytesDesc = prometheus.NewDesc(
+		"fxtunnel_server_tunnel_bytes_total",
+		"Bytes carried by an active tunnel; direction in is visitor to client",
+		[]string{"tunnel_id", "type", "plan", "direction"}, nil)
+	streamsOpenedDesc = prometheus.NewDesc(
+		"fxtunnel_server_streams_opened_total",
+		"Yamux streams opened to clients",
+		nil, nil)
+	streamsClosedDesc = prometheus.NewDesc(
+		"fxtunnel_server_streams_closed_total",
+		"Yamux streams to clients closed by the server",
+		nil, nil)
+	udpFlowsDesc = prometheus.NewDesc(
+		"fxtunnel_server_udp_flows",
+		"Visitor sources with a live flow through a UDP tunnel",
+		nil, nil)
+	udpBlockedPacketsDesc = prometheus.NewDesc(
+		"fxtunnel_server_udp_blocked_packets_total",
+		"Visitor packets an active UDP tunnel dropped because their source is not in its allowlist",
+		[]string{"tunnel_id", "plan"}, nil)
+	rejectedDesc = prometheus.NewDesc(
+		"fxtunnel_server_rejected_connections_total",
+		"Visitor connections, requests, auth attempts and client connections refused by reason",
+		[]string{"reason"}, nil)
+	compressionDesc = prometheus.NewDesc(
+		"fxtunnel_server_connections_compression_total",
+		"Client connections by negotiated connection compression",
+		[]string{"algorithm"}, nil)
+	sessionStreamsDesc = prometheus.NewDesc(
+		"fxtunnel_server_session_streams",
+		"Open yamux streams across a client's sessions",
+		[]string{"client_id"}, nil)
+	sessionPendingWritesDesc = prometheus.NewDesc(
+		"fxtunnel_server_session_pending_writes",
+		"Stream writes to a client still in progress; they block while the stream window is full",
+		[]string{"client_id"}, nil)
+	sessionWritesDesc = prometheus.NewDesc(
+		"fxtunnel_server_session_writes_total",
+		"Stream writes to a client",
+		[]string{"client_id"}, nil)
+	sessionStalledWritesDesc = prometheus.NewDesc(
+		"fxtunnel_server_session_stalled_writes_total",
+		"Stream writes to a client that waited at least 100ms for window space",
+		[]string{"client_id"}, nil)
+	sessionWriteWaitDesc = prometheus.NewDesc(
+		"fxtunnel_server_session_write_wait_seconds_total",
+		"Time spent in stream writes to a client",
+		[]string{"client_id"}, nil)
+	inspectPersistDesc = prometheus.NewDesc(
+		"fxtunnel_server_inspect_persist_total",
+		"Captured exchanges queued for the database by result: persisted, failed or dropped on a full queue",
+		[]string{"result"}, nil)
+	inspectPersistQueueDesc = prometheus.NewDesc(
+		"fxtunnel_server_inspect_persist_queue",
+		"Captured exchanges waiting to be written to the database",
+		nil, nil)
+)
+
+// metricsCollector reads the server's live state on every scrape, so closed
+// tunnels drop out of the per-tunnel series instead of lingering as stale
+// label sets.
+type metricsCollector struct {
+	s *Server
+}
+
+// MetricsCollector returns a Prometheus collector for the tunnel data plane:
+// connected clients, active tunnels, per-tunnel traffic, packets UDP
+// tunnels blocked, yamux streams, per-client session pressure, rejected
+// connections, negotiated compression and inspector persistence. Register it with the registry that serves the API's /metrics
+// endpoint.
+func (s *Server) MetricsCollector() prometheus.Collector {
+	return &metricsCollector{s: s}
+}
+
+func (c *metricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- clientsDesc
+	ch <- tunnelsDesc
+	ch <- tunnelBytesDesc
+	ch <- streamsOpenedDesc
+	ch <- streamsClosedDesc
+	ch <- udpFlowsDesc
+	ch <- udpBlockedPacketsDesc
+	ch <- rejectedDesc
+	ch <- compressionDesc
+	ch <- sessionStreamsDesc
+	ch <- sessionPendingWritesDesc
+	ch <- sessionWritesDesc
+	ch <- sessionStalledWritesDesc
+	ch <- sessionWriteWaitDesc
+	ch <- inspectPersistDesc
+	ch <- inspectPersistQueueDesc
+}
+
+func (c *metricsCollector) Collect(ch chan<- prometheus.Metric) {
+	clients := c.s.clientMgr.allClients()
+	ch <- prometheus.MustNewConstMetric(clientsDesc, prometheus.GaugeValue, float64(len(clients)))
+
+	type tunnelKey struct{ typ, plan string }
+	counts := make(map[tunnelKey]int)
+	var udpFlows int64
+	for _, client := range clients {
+		plan := clientPlanLabel(client)
+		client.TunnelsMu.RLock()
+		for _, t := range client.Tunnels {
+			typ := string(t.Type)
+			counts[tunnelKey{typ, plan}]++
+			ch <- prometheus.MustNewConstMetric(tunnelBytesDesc, prometheus.CounterValue,
+				float64(t.BytesIn.Load()), t.ID, typ, plan, "in")
+			ch <- prometheus.MustNewConstMetric(tunnelBytesDesc, prometheus.CounterValue,
+				float64(t.BytesOut.Load()), t.ID, typ, plan, "out")
+			if t.udpFlows != nil {
+				udpFlows += t.udpFlows.active.Load()
+			}
+			if t.Type == protocol.TunnelUDP {
+				ch <- prometheus.MustNewConstMetric(udpBlockedPacketsDesc, prometheus.CounterValue,
+					float64(t.BlockedPackets.Load()), t.ID, plan)
+			}
+		}
+		client.TunnelsMu.RUnlock()
+
+		p := client.sessionPressure()
+		ch <- prometheus.MustNewConstMetric(sessionStreamsDesc, prometheus.GaugeValue, float64(p.Streams), client.ID)
+		ch <- prometheus.MustNewConstMetric(sessionPendingWritesDesc, prometheus.GaugeValue, float64(p.PendingWrites), client.ID)
+		ch <- prometheus.MustNewConstMetric(sessionWritesDesc, prometheus.CounterValue, float64(p.Writes), client.ID)
+		ch <- prometheus.MustNewConstMetric(sessionStalledWritesDesc, prometheus.CounterValue, float64(p.StalledWrites), client.ID)
+		ch <- prometheus.MustNewConstMetric(sessionWriteWaitDesc, prometheus.CounterValue, p.WriteWait.Seconds(), client.ID)
+	}
+	for k, n := range counts {
+		ch <- prometheus.MustNewConstMetric(tunnelsDesc, prometheus.GaugeValue, float64(n), k.typ, k.plan)
+	}
+
+	ch <- prometheus.MustNewConstMetric(udpFlowsDesc, prometheus.GaugeValue, float64(udpFlows))
+
+	st := &c.s.stats
+	ch <- prometheus.MustNewConstMetric(streamsOpenedDesc, prometheus.CounterValue, float64(st.streamsOpened.Load()))
+	ch <- prometheus.MustNewConstMetric(streamsClosedDesc, prometheus.CounterValue, float64(st.streamsClosed.Load()))
+	for reason, v := range map[string]*atomic.Int64{
+		rejectIPAllowlist:   &st.rejectedIPAllowlist,
+		rejectRateLimit:     &st.rejectedRateLimit,
+		rejectAuthRateLimit: &st.rejectedAuthRateLimit,
+		rejectQuota:         &st.rejectedQuota,
+		rejectConnLimit:     &st.rejectedConnLimit,
+		rejectIPBan:         &st.rejectedIPBan,
+		rejectGeoPolicy:     &st.rejectedGeoPolicy,
+	} {
+		ch <- prometheus.MustNewConstMetric(rejectedDesc, prometheus.CounterValue, float64(v.Load()), reason)
+	}
+	for alg, v := range map[protocol.Compression]*atomic.Int64{
+		protocol.CompressionNone:   &st.compressionNone,
+		protocol.CompressionZstd:   &st.compressionZstd,
+		protocol.CompressionSnappy: &st.compressionSnappy,
+	} {
+		ch <- prometheus.MustNewConstMetric(compressionDesc, prometheus.CounterValue, float64(v.Load()), alg.String())
+	}
+
+	if c.s.inspectMgr != nil {
+		ps := c.s.inspectMgr.PersistStats()
+		ch <- prometheus.MustNewConstMetric(inspectPersistDesc, prometheus.CounterValue, float64(ps.Persisted), "persisted")
+		ch <- prometheus.MustNewConstMetric(inspectPersistDesc, prometheus.CounterValue, float64(ps.Failed), "failed")
+		ch <- prometheus.MustNewConstMetric(inspectPersistDesc, prometheus.CounterValue, float64(ps.Dropped), "dropped")
+		ch <- prometheus.MustNewConstMetric(inspectPersistQueueDesc, prometheus.GaugeValue, float64(ps.Queued))
+	}
+}
+
+// clientPlanLabel is the plan slug of the client's owner, "admin" for admins
+// without a plan, and "none" for legacy tokens and users without one.
+func clientPlanLabel(c *Client) string {
+	plan := c.currentPlan()
+	switch {
+	case plan != nil && plan.Slug != "":
+		return plan.Slug
+	case c.IsAdmin:
+		return "admin"
+	default:
+		return "none"
+	}
+}
@@ -0,0 +1,121 @@
+package core
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+	"github.com/mephistofox/fxtun.dev/internal/server/database"
+)
+
+func TestMetricsCollector(t *testing.T) {
+	s := &Server{clientMgr: NewClientManager(zerolog.Nop())}
+
+	web := &Tunnel{ID: "t1", Type: protocol.TunnelHTTP}
+	web.BytesIn.Store(100)
+	web.BytesOut.Store(2500)
+	s.clientMgr.addClient("c1", &Client{ID: "c1", Plan: &database.Plan{Slug: "pro"},
+		Tunnels: map[string]*Tunnel{"t1": web, "t2": {ID: "t2", Type: protocol.TunnelTCP}}})
+	s.clientMgr.addClient("c2", &Client{ID: "c2",
+		Tunnels: map[string]*Tunnel{"t3": {ID: "t3", Type: protocol.TunnelTCP}}})
+
+	s.stats.reject(rejectRateLimit)
+	s.stats.reject(rejectRateLimit)
+	s.stats.reject(rejectIPAllowlist)
+	s.stats.reject(rejectGeoPolicy)
+
+	expected := `
+# HELP fxtunnel_server_clients Number of clients connected to the tunnel server
+# TYPE fxtunnel_server_clients gauge
+fxtunnel_server_clients 2
+# HELP fxtunnel_server_tunnels Number of active tunnels by type and owner plan
+# TYPE fxtunnel_server_tunnels gauge
+fxtunnel_server_tunnels{plan="none",type="tcp"} 1
+fxtunnel_server_tunnels{plan="pro",type="http"} 1
+fxtunnel_server_tunnels{plan="pro",type="tcp"} 1
+# HELP fxtunnel_server_rejected_connections_total Visitor connections, requests, auth attempts and client connections refused by reason
+# TYPE fxtunnel_server_rejected_connections_total counter
+fxtunnel_server_rejected_connections_total{reason="auth_rate_limit"} 0
+fxtunnel_server_rejected_connections_total{reason="connection_limit"} 0
+fxtunnel_server_rejected_connections_total{reason="geo_policy"} 1
+fxtunnel_server_rejected_connections_total{reason="ip_allowlist"} 1
+fxtunnel_server_rejected_connections_total{reason="ip_ban"} 0
+fxtunnel_server_rejected_connections_total{reason="quota"} 0
+fxtunnel_server_rejected_connections_total{reason="rate_limit"} 2
+`
+	err := testutil.CollectAndCompare(s.MetricsCollector(), strings.NewReader(expected),
+		"fxtunnel_server_clients", "fxtunnel_server_tunnels", "fxtunnel_server_rejected_connections_total")
+	require.NoError(t, err)
+
+	bytes := `
+# HELP fxtunnel_server_tunnel_bytes_total Bytes carried by an active tunnel; direction in is visitor to client
+# TYPE fxtunnel_server_tunnel_bytes_total counter
+fxtunnel_server_tunnel_bytes_total{direction="in",plan="none",tunnel_id="t3",type="tcp"} 0
+fxtunnel_server_tunnel_bytes_total{direction="in",plan="pro",tunnel_id="t1",type="http"} 100
+fxtunnel_server_tunnel_bytes_total{direction="in",plan="pro",tunnel_id="t2",type="tcp"} 0
+fxtunnel_server_tunnel_bytes_total{direction="out",plan="none",tunnel_id="t3",type="tcp"} 0
+fxtunnel_server_tunnel_bytes_total{direction="out",plan="pro",tunnel_id="t1",type="http"} 2500
+fxtunnel_server_tunnel_bytes_total{direction="out",plan="pro",tunnel_id="t2",type="tcp"} 0
+`
+	err = testutil.CollectAndCompare(s.MetricsCollector(), strings.NewReader(bytes), "fxtunnel_server_tunnel_bytes_total")
+	require.NoError(t, err)
+
+	dns := &Tunnel{ID: "t4", Type: protocol.TunnelUDP}
+	dns.BlockedPackets.Store(7)
+	s.clientMgr.addClient("c3", &Client{ID: "c3", Tunnels: map[string]*Tunnel{"t4": dns}})
+	blocked := `
+# HELP fxtunnel_server_udp_blocked_packets_total Visitor packets an active UDP tunnel dropped because their source is not in its allowlist
+# TYPE fxtunnel_server_udp_blocked_packets_total counter
+fxtunnel_server_udp_blocked_packets_total{plan="none",tunnel_id="t4"} 7
+`
+	err = testutil.CollectAndCompare(s.MetricsCollector(), strings.NewReader(blocked), "fxtunnel_server_udp_blocked_packets_total")
+	require.NoError(t, err)
+}
+
+func TestTrackStreamCountsCloseOnce(t *testing.T) {
+	var stats dataPlaneStats
+	a, b := net.Pipe()
+	defer b.Close()
+
+	stream := stats.trackStream(a, nil)
+	assert.Equal(t, int64(1), stats.streamsOpened.Load())
+
+	stream.Close()
+	stream.Close()
+	assert.Equal(t, int64(1), stats.streamsClosed.Load())
+}
+
+func TestCountTunnelBytes(t *testing.T) {
+	tunnel := &Tunnel{ID: "t1"}
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	conn := countTunnelBytes(a, tunnel)
+	go func() {
+		buf := make([]byte, 5)
+		_, _ = b.Read(buf)
+		_, _ = b.Write([]byte("pong!!"))
+	}()
+
+	_, err := conn.Write([]byte("ping!"))
+	require.NoError(t, err)
+	buf := make([]byte, 16)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(5), tunnel.BytesIn.Load())
+	assert.Equal(t, int64(n), tunnel.BytesOut.Load())
+}
+
+func TestClientPlanLabel(t *testing.T) {
+	assert.Equal(t, "pro", clientPlanLabel(&Client{Plan: &database.Plan{Slug: "pro"}}))
+	assert.Equal(t, "admin", clientPlanLabel(&Client{IsAdmin: true}))
+	assert.Equal(t, "none", clientPlanLabel(&Client{}))
+}
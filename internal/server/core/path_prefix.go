@@ -0,0 +1,49 @@
+package core
+
+import (
+	"net/http"
+	"strings"
+)
+
+// applyPathPrefix rewrites the path of a request to an HTTP tunnel: strip is
+// removed when the path starts with it as whole segments, then add is put in
+// front. A stripped prefix is passed on in X-Forwarded-Prefix so the local
+// service can still build external links.
+func applyPathPrefix(req *http.Request, strip, add string) {
+	if strip == "" && add == "" {
+		return
+	}
+	if strip != "" {
+		// Only the proxy may tell the service which prefix it removed
+		req.Header.Del("X-Forwarded-Prefix")
+		if p, ok := stripPathPrefix(req.URL.Path, strip); ok {
+			req.URL.Path = p
+			req.Header.Set("X-Forwarded-Prefix", strip)
+			if req.URL.RawPath != "" {
+				// If the escaped form does not match, EscapedPath ignores
+				// it and escapes Path instead
+				req.URL.RawPath, _ = stripPathPrefix(req.URL.RawPath, strip)
+			}
+		}
+	}
+	if add != "" {
+		req.URL.Path = add + req.URL.Path
+		if req.URL.RawPath != "" {
+			req.URL.RawPath = add + req.URL.RawPath
+		}
+	}
+}
+
+// stripPathPrefix removes prefix from path if the path is the prefix or
+// continues it with a new segment, so "/api" matches "/api/users" but not
+// "/apix".
+func stripPathPrefix(path, prefix string) (string, bool) {
+	rest, ok := strings.CutPrefix(path, prefix)
+	if !ok || (rest != "" && rest[0] != '/') {
+		return path, false
+	}
+	if rest == "" {
+		rest = "/"
+	}
+	return rest, true
+}
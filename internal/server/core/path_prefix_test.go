@@ -0,0 +1,47 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyPathPrefix(t *testing.T) {
+	tests := []struct {
+		name, target, strip, add, want string
+	}{
+		{"strip", "/api/users?page=2", "/api", "", "/api/users?page=2 -> /users?page=2"},
+		{"strip whole path", "/api", "/api", "", "/api -> /"},
+		{"strip segment boundary", "/apix/users", "/api", "", "/apix/users -> /apix/users"},
+		{"add", "/users", "", "/v2", "/users -> /v2/users"},
+		{"replace", "/api/users", "/api", "/v2", "/api/users -> /v2/users"},
+		{"add to unmatched", "/health", "/api", "/v2", "/health -> /v2/health"},
+		{"escaped path", "/api/a%2Fb", "/api", "", "/api/a%2Fb -> /a%2Fb"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://app.fxtun.dev"+tt.target, nil)
+			applyPathPrefix(req, tt.strip, tt.add)
+			assert.Equal(t, tt.want, tt.target+" -> "+req.URL.RequestURI())
+		})
+	}
+}
+
+func TestApplyPathPrefix_ForwardedPrefix(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://app.fxtun.dev/api/users", nil)
+	applyPathPrefix(req, "/api", "")
+	assert.Equal(t, "/api", req.Header.Get("X-Forwarded-Prefix"))
+
+	// A visitor cannot make the service believe a prefix was stripped
+	req = httptest.NewRequest(http.MethodGet, "http://app.fxtun.dev/other", nil)
+	req.Header.Set("X-Forwarded-Prefix", "/admin")
+	applyPathPrefix(req, "/api", "")
+	assert.Empty(t, req.Header.Get("X-Forwarded-Prefix"))
+
+	req = httptest.NewRequest(http.MethodGet, "http://app.fxtun.dev/other", nil)
+	req.Header.Set("X-Forwarded-Prefix", "/admin")
+	applyPathPrefix(req, "", "")
+	assert.Equal(t, "/admin", req.Header.Get("X-Forwarded-Prefix"), "untouched without rewriting")
+}
@@ -0,0 +1,114 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+	"github.com/mephistofox/fxtun.dev/internal/server/database"
+)
+
+// ownedTunnel is a tunnel together with the client that holds it.
+type ownedTunnel struct {
+	client *Client
+	tunnel *Tunnel
+}
+
+// RefreshUserPlan reloads a user's plan from the database into their
+// connected clients, e.g. after the scheduler changed it. Tunnels above the
+// new plan's limit are handled as server.plan_downgrade says.
+func (s *Server) RefreshUserPlan(userID int64) error {
+	if s.db == nil || userID <= 0 {
+		return nil
+	}
+	user, err := s.db.Users.GetByID(userID)
+	if err != nil {
+		return fmt.Errorf("load user: %w", err)
+	}
+	if user == nil || user.PlanID <= 0 {
+		return nil
+	}
+	plan, err := s.db.Plans.GetByID(user.PlanID)
+	if err != nil {
+		return fmt.Errorf("load plan: %w", err)
+	}
+	s.applyUserPlan(userID, plan)
+	return nil
+}
+
+// applyUserPlan switches the user's connected clients to plan and closes the
+// tunnels over its limit, telling the client why before each close.
+func (s *Server) applyUserPlan(userID int64, plan *database.Plan) {
+	// Hold the creation lock so no tunnel is created against the old plan
+	// while the excess is picked
+	mu := s.clientMgr.GetTunnelCreateMu(userID)
+	mu.Lock()
+	var tunnels []ownedTunnel
+	for _, c := range s.clientMgr.userClientList(userID) {
+		c.setPlan(plan)
+		c.TunnelsMu.RLock()
+		for _, t := range c.Tunnels {
+			tunnels = append(tunnels, ownedTunnel{client: c, tunnel: t})
+		}
+		c.TunnelsMu.RUnlock()
+	}
+	mu.Unlock()
+
+	excess := overPlanTunnels(tunnels, plan.MaxTunnels, s.cfg.Server.PlanDowngrade)
+	if len(excess) == 0 {
+		return
+	}
+
+	s.log.Info().
+		Int64("user_id", userID).
+		Str("plan", plan.Slug).
+		Int("max_tunnels", plan.MaxTunnels).
+		Int("closing", len(excess)).
+		Msg("Closing tunnels over the new plan limit")
+
+	message := fmt.Sprintf("tunnel closed: your plan now allows %d tunnels", plan.MaxTunnels)
+	for _, o := range excess {
+		resp := &protocol.TunnelErrorMessage{
+			Message:  protocol.NewMessage(protocol.MsgTunnelError),
+			TunnelID: o.tunnel.ID,
+			Error:    message,
+			Code:     protocol.ErrCodePlanLimit,
+		}
+		_ = o.client.sendControl(resp)
+		o.client.recordHistoryEvent(database.HistoryEventTunnelError, string(o.tunnel.Type), o.tunnel.LocalPort, o.client.tunnelURL(o.tunnel), message)
+		o.client.emitTunnelEvent(config.WebhookTunnelError, o.tunnel, message)
+		o.client.closeTunnel(o.tunnel.ID)
+	}
+}
+
+// currentPlan returns the client's plan. It can change while the client is
+// connected, so anything running after registration reads it here.
+func (c *Client) currentPlan() *database.Plan {
+	c.planMu.RLock()
+	defer c.planMu.RUnlock()
+	return c.Plan
+}
+
+func (c *Client) setPlan(plan *database.Plan) {
+	c.planMu.Lock()
+	c.Plan = plan
+	c.planMu.Unlock()
+}
+
+// overPlanTunnels picks the tunnels to close so that at most limit remain.
+// A limit of 0 or less is unlimited.
+func overPlanTunnels(tunnels []ownedTunnel, limit int, policy string) []ownedTunnel {
+	if limit <= 0 || len(tunnels) <= limit || policy == config.PlanDowngradeKeep {
+		return nil
+	}
+
+	sort.Slice(tunnels, func(i, j int) bool {
+		return tunnels[i].tunnel.Created.Before(tunnels[j].tunnel.Created)
+	})
+	excess := len(tunnels) - limit
+	if policy == config.PlanDowngradeCloseOldest {
+		return tunnels[:excess]
+	}
+	return tunnels[limit:]
+}
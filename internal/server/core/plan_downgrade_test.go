@@ -0,0 +1,91 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+	"github.com/mephistofox/fxtun.dev/internal/server/database"
+)
+
+func TestOverPlanTunnels(t *testing.T) {
+	start := time.Now()
+	owned := func() []ownedTunnel {
+		var tunnels []ownedTunnel
+		// Out of order, to check they are sorted by creation time
+		for _, i := range []int{3, 0, 4, 1, 2} {
+			tunnels = append(tunnels, ownedTunnel{tunnel: &Tunnel{
+				ID:      fmt.Sprintf("t%d", i),
+				Created: start.Add(time.Duration(i) * time.Minute),
+			}})
+		}
+		return tunnels
+	}
+	ids := func(tunnels []ownedTunnel) []string {
+		var out []string
+		for _, o := range tunnels {
+			out = append(out, o.tunnel.ID)
+		}
+		return out
+	}
+
+	assert.Equal(t, []string{"t2", "t3", "t4"}, ids(overPlanTunnels(owned(), 2, config.PlanDowngradeCloseNewest)))
+	assert.Equal(t, []string{"t2", "t3", "t4"}, ids(overPlanTunnels(owned(), 2, "")), "close_newest is the default")
+	assert.Equal(t, []string{"t0", "t1", "t2"}, ids(overPlanTunnels(owned(), 2, config.PlanDowngradeCloseOldest)))
+	assert.Empty(t, overPlanTunnels(owned(), 2, config.PlanDowngradeKeep))
+	assert.Empty(t, overPlanTunnels(owned(), 5, config.PlanDowngradeCloseNewest), "within the limit")
+	assert.Empty(t, overPlanTunnels(owned(), -1, config.PlanDowngradeCloseNewest), "unlimited plan")
+}
+
+func TestApplyUserPlan_ClosesExcessTunnels(t *testing.T) {
+	srv := resumeTestServer(t, 0)
+
+	session := dialServer(t, srv)
+	defer session.Close()
+	codec, _ := openControlStream(t, session)
+	require.NoError(t, codec.Encode(&protocol.AuthMessage{Message: protocol.NewMessage(protocol.MsgAuth)}))
+	var auth protocol.AuthResultMessage
+	require.NoError(t, codec.Decode(&auth))
+	require.True(t, auth.Success, auth.Error)
+
+	client := srv.GetClient(auth.ClientID)
+	require.NotNil(t, client)
+	client.UserID = 7
+	client.Plan = &database.Plan{MaxTunnels: -1}
+	srv.clientMgr.linkUserClient(7, client.ID)
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, codec.Encode(&protocol.TunnelRequestMessage{
+			Message:    protocol.NewMessage(protocol.MsgTunnelRequest),
+			TunnelType: protocol.TunnelHTTP,
+			Subdomain:  fmt.Sprintf("app-%d", i),
+			LocalPort:  3000 + i,
+		}))
+		var created protocol.TunnelCreatedMessage
+		require.NoError(t, codec.Decode(&created))
+		require.Equal(t, protocol.MsgTunnelCreated, created.Type)
+	}
+
+	srv.applyUserPlan(7, &database.Plan{Slug: "free", MaxTunnels: 3})
+
+	// Every closed tunnel is announced with the reason, then closed
+	for i := 0; i < 7; i++ {
+		var notice protocol.TunnelErrorMessage
+		require.NoError(t, codec.Decode(&notice))
+		assert.Equal(t, protocol.MsgTunnelError, notice.Type)
+		assert.Equal(t, protocol.ErrCodePlanLimit, notice.Code)
+
+		var closed protocol.TunnelClosedMessage
+		require.NoError(t, codec.Decode(&closed))
+		assert.Equal(t, protocol.MsgTunnelClosed, closed.Type)
+		assert.Equal(t, notice.TunnelID, closed.TunnelID)
+	}
+
+	assert.Equal(t, 3, srv.clientMgr.CountTunnelsByUserID(7))
+	assert.Equal(t, 3, client.Plan.MaxTunnels)
+}
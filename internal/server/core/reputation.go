@@ -0,0 +1,291 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+	"github.com/mephistofox/fxtun.dev/internal/server/database"
+)
+
+const (
+	defaultReputationTimeout  = 5 * time.Second
+	defaultReputationCacheTTL = time.Hour
+	reputationQueueSize       = 256
+	// reputationCachePrune is the cache size above which expired hosts
+	// are swept on the next check.
+	reputationCachePrune = 4096
+	safeBrowsingEndpoint = "https://safebrowsing.googleapis.com/v4/threatMatches:find"
+)
+
+// reputationTarget is a URL of a new tunnel waiting to be checked.
+type reputationTarget struct {
+	subdomain string
+	url       string
+	userID    int64
+}
+
+// reputationChecker looks up the URLs of new HTTP tunnels through an
+// asyncWorker, so a slow reputation service never delays tunnels.
+type reputationChecker struct {
+	cfg      config.ReputationSettings
+	client   *http.Client
+	cacheTTL time.Duration
+	log      zerolog.Logger
+	// match is called for every URL the service reports
+	match func(t reputationTarget, threat string)
+
+	mu      sync.Mutex
+	checked map[string]time.Time // URL -> when it was last queued
+
+	worker *asyncWorker[reputationTarget]
+}
+
+// newReputationChecker starts the checker cfg describes. It returns nil
+// when the check is disabled.
+func newReputationChecker(cfg config.ReputationSettings, log zerolog.Logger, match func(reputationTarget, string)) *reputationChecker {
+	if cfg.Provider == "" {
+		return nil
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultReputationTimeout
+	}
+	cacheTTL := cfg.CacheTTL
+	if cacheTTL <= 0 {
+		cacheTTL = defaultReputationCacheTTL
+	}
+
+	rc := &reputationChecker{
+		cfg:      cfg,
+		client:   &http.Client{Timeout: timeout},
+		cacheTTL: cacheTTL,
+		log:      log.With().Str("component", "reputation").Logger(),
+		match:    match,
+		checked:  make(map[string]time.Time),
+	}
+	rc.worker = newAsyncWorker(reputationQueueSize, rc.handle)
+	return rc
+}
+
+// check queues t unless its URL was checked within the cache TTL. A nil
+// checker is a no-op.
+func (rc *reputationChecker) check(t reputationTarget) {
+	if rc == nil {
+		return
+	}
+	now := time.Now()
+	rc.mu.Lock()
+	if last, ok := rc.checked[t.url]; ok && now.Sub(last) < rc.cacheTTL {
+		rc.mu.Unlock()
+		return
+	}
+	if len(rc.checked) > reputationCachePrune {
+		for u, last := range rc.checked {
+			if now.Sub(last) >= rc.cacheTTL {
+				delete(rc.checked, u)
+			}
+		}
+	}
+	rc.checked[t.url] = now
+	rc.mu.Unlock()
+
+	if !rc.worker.push(t) {
+		rc.log.Debug().Str("url", t.url).Msg("Reputation queue full, check skipped")
+	}
+}
+
+func (rc *reputationChecker) handle(ctx context.Context, t reputationTarget) {
+	threat, err := rc.lookup(ctx, t.url)
+	if err != nil {
+		rc.log.Warn().Err(err).Str("url", t.url).Msg("Reputation lookup failed")
+		// Let the next tunnel on this URL try again
+		rc.mu.Lock()
+		delete(rc.checked, t.url)
+		rc.mu.Unlock()
+		return
+	}
+	if threat != "" {
+		rc.match(t, threat)
+	}
+}
+
+// lookup asks the configured provider about u and returns the threat it
+// reports, empty when the URL is clean.
+func (rc *reputationChecker) lookup(ctx context.Context, u string) (string, error) {
+	if rc.cfg.Provider == config.ReputationSafeBrowsing {
+		return rc.lookupSafeBrowsing(ctx, u)
+	}
+	return rc.lookupHTTP(ctx, u)
+}
+
+func (rc *reputationChecker) lookupSafeBrowsing(ctx context.Context, u string) (string, error) {
+	endpoint := rc.cfg.URL
+	if endpoint == "" {
+		endpoint = safeBrowsingEndpoint
+	}
+	body := map[string]any{
+		"client": map[string]string{"clientId": "fxtunnel", "clientVersion": "1.0"},
+		"threatInfo": map[string]any{
+			"threatTypes":      []string{"MALWARE", "SOCIAL_ENGINEERING", "UNWANTED_SOFTWARE", "POTENTIALLY_HARMFUL_APPLICATION"},
+			"platformTypes":    []string{"ANY_PLATFORM"},
+			"threatEntryTypes": []string{"URL"},
+			"threatEntries":    []map[string]string{{"url": u}},
+		},
+	}
+	var resp struct {
+		Matches []struct {
+			ThreatType string `json:"threatType"`
+		} `json:"matches"`
+	}
+	if err := rc.post(ctx, endpoint+"?key="+url.QueryEscape(rc.cfg.APIKey), "", body, &resp); err != nil {
+		return "", err
+	}
+	if len(resp.Matches) == 0 {
+		return "", nil
+	}
+	return resp.Matches[0].ThreatType, nil
+}
+
+func (rc *reputationChecker) lookupHTTP(ctx context.Context, u string) (string, error) {
+	var resp struct {
+		Match  bool   `json:"match"`
+		Threat string `json:"threat"`
+	}
+	if err := rc.post(ctx, rc.cfg.URL, rc.cfg.APIKey, map[string]string{"url": u}, &resp); err != nil {
+		return "", err
+	}
+	if !resp.Match {
+		return "", nil
+	}
+	if resp.Threat == "" {
+		return "unknown", nil
+	}
+	return resp.Threat, nil
+}
+
+// post sends body as JSON and decodes a 2xx answer into out.
+func (rc *reputationChecker) post(ctx context.Context, endpoint, bearer string, body, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "fxTunnel-Reputation")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+
+	resp, err := rc.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("reputation service returned %s", resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out)
+}
+
+// close stops the checker; queued targets are discarded. A nil checker is
+// a no-op.
+func (rc *reputationChecker) close() {
+	if rc == nil {
+		return
+	}
+	rc.worker.close()
+}
+
+// checkTunnelReputation queues the URLs of a new HTTP tunnel: its
+// subdomain and the verified custom domains of its owner pointing at it.
+func (c *Client) checkTunnelReputation(tunnel *Tunnel) {
+	rc := c.server.reputation
+	if rc == nil {
+		return
+	}
+	rc.check(reputationTarget{
+		subdomain: tunnel.Subdomain,
+		url:       fmt.Sprintf("https://%s.%s/", tunnel.Subdomain, c.server.cfg.Domain.Base),
+		userID:    c.UserID,
+	})
+
+	c.server.customDomainMu.RLock()
+	defer c.server.customDomainMu.RUnlock()
+	for _, d := range c.server.customDomains {
+		if d.Verified && d.UserID == c.UserID && strings.EqualFold(d.TargetSubdomain, tunnel.Subdomain) {
+			rc.check(reputationTarget{subdomain: tunnel.Subdomain, url: "https://" + d.Domain + "/", userID: c.UserID})
+		}
+	}
+}
+
+// reputationMatch flags a tunnel URL the reputation service reported: an
+// abuse report is opened for admin review and, with the suspend action,
+// the subdomain is suspended at once.
+func (s *Server) reputationMatch(t reputationTarget, threat string) {
+	s.log.Warn().Str("subdomain", t.subdomain).Str("url", t.url).Str("threat", threat).Int64("user_id", t.userID).
+		Msg("Tunnel URL flagged by reputation check")
+
+	var userID *int64
+	if t.userID > 0 {
+		userID = &t.userID
+	}
+	var reportID *int64
+	if s.db != nil {
+		report := &database.AbuseReport{
+			Subdomain: t.subdomain,
+			URL:       t.url,
+			Category:  reputationCategory(threat),
+			Details:   "Flagged by the URL reputation check (" + s.cfg.Server.Reputation.Provider + "): " + threat,
+			UserID:    userID,
+		}
+		if err := s.db.Abuse.CreateReport(report); err != nil {
+			s.log.Error().Err(err).Str("subdomain", t.subdomain).Msg("Failed to store reputation report")
+		} else {
+			reportID = &report.ID
+		}
+	}
+
+	if s.cfg.Server.Reputation.Action != config.ReputationSuspend {
+		return
+	}
+	if s.db != nil {
+		err := s.db.Abuse.Suspend(&database.SuspendedSubdomain{
+			Subdomain: t.subdomain,
+			UserID:    userID,
+			Reason:    "reputation check: " + threat,
+			ReportID:  reportID,
+		})
+		if err != nil {
+			s.log.Error().Err(err).Str("subdomain", t.subdomain).Msg("Failed to store suspension")
+		}
+	}
+	s.SuspendSubdomain(t.subdomain)
+}
+
+// reputationCategory maps a reported threat to an abuse report category.
+func reputationCategory(threat string) string {
+	threat = strings.ToLower(threat)
+	switch {
+	case strings.Contains(threat, "social") || strings.Contains(threat, "phish"):
+		return database.AbuseCategoryPhishing
+	case strings.Contains(threat, "malware") || strings.Contains(threat, "unwanted") || strings.Contains(threat, "harmful"):
+		return database.AbuseCategoryMalware
+	case strings.Contains(threat, "spam"):
+		return database.AbuseCategorySpam
+	}
+	return database.AbuseCategoryOther
+}
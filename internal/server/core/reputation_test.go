@@ -0,0 +1,152 @@
+package core
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+	"github.com/mephistofox/fxtun.dev/internal/server/database"
+)
+
+type reputationMatchCall struct {
+	target reputationTarget
+	threat string
+}
+
+func newTestReputationChecker(t *testing.T, cfg config.ReputationSettings) (*reputationChecker, chan reputationMatchCall) {
+	t.Helper()
+	matches := make(chan reputationMatchCall, 4)
+	rc := newReputationChecker(cfg, zerolog.Nop(), func(target reputationTarget, threat string) {
+		matches <- reputationMatchCall{target, threat}
+	})
+	t.Cleanup(rc.close)
+	return rc, matches
+}
+
+func TestReputationChecker_SafeBrowsing(t *testing.T) {
+	var requests atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		assert.Equal(t, "k3y", r.URL.Query().Get("key"))
+		var body struct {
+			ThreatInfo struct {
+				ThreatEntries []struct {
+					URL string `json:"url"`
+				} `json:"threatEntries"`
+			} `json:"threatInfo"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		if body.ThreatInfo.ThreatEntries[0].URL == "https://phish.example.com/" {
+			_, _ = w.Write([]byte(`{"matches":[{"threatType":"SOCIAL_ENGINEERING"}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	rc, matches := newTestReputationChecker(t, config.ReputationSettings{
+		Provider: config.ReputationSafeBrowsing,
+		URL:      srv.URL,
+		APIKey:   "k3y",
+	})
+
+	rc.check(reputationTarget{subdomain: "clean", url: "https://clean.example.com/"})
+	rc.check(reputationTarget{subdomain: "phish", url: "https://phish.example.com/", userID: 7})
+	select {
+	case m := <-matches:
+		assert.Equal(t, "phish", m.target.subdomain)
+		assert.Equal(t, int64(7), m.target.userID)
+		assert.Equal(t, "SOCIAL_ENGINEERING", m.threat)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no match reported")
+	}
+	assert.Equal(t, int64(2), requests.Load())
+
+	rc.check(reputationTarget{subdomain: "phish", url: "https://phish.example.com/"})
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int64(2), requests.Load(), "a checked URL is cached")
+	assert.Empty(t, matches)
+}
+
+func TestReputationChecker_HTTPProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer t0ken", r.Header.Get("Authorization"))
+		var body struct {
+			URL string `json:"url"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		_ = json.NewEncoder(w).Encode(map[string]any{"match": body.URL == "https://bad.example.com/"})
+	}))
+	defer srv.Close()
+
+	rc, matches := newTestReputationChecker(t, config.ReputationSettings{
+		Provider: config.ReputationHTTP,
+		URL:      srv.URL,
+		APIKey:   "t0ken",
+	})
+	rc.check(reputationTarget{subdomain: "bad", url: "https://bad.example.com/"})
+	select {
+	case m := <-matches:
+		assert.Equal(t, "bad", m.target.subdomain)
+		assert.Equal(t, "unknown", m.threat)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no match reported")
+	}
+}
+
+func TestReputationChecker_FailedLookupIsRetried(t *testing.T) {
+	var requests atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	rc, _ := newTestReputationChecker(t, config.ReputationSettings{Provider: config.ReputationHTTP, URL: srv.URL})
+	target := reputationTarget{subdomain: "app", url: "https://app.example.com/"}
+	rc.check(target)
+	require.Eventually(t, func() bool {
+		rc.mu.Lock()
+		defer rc.mu.Unlock()
+		return requests.Load() == 1 && len(rc.checked) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	rc.check(target)
+	require.Eventually(t, func() bool { return requests.Load() == 2 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestReputationChecker_Disabled(t *testing.T) {
+	rc := newReputationChecker(config.ReputationSettings{}, zerolog.Nop(), nil)
+	assert.Nil(t, rc)
+	rc.check(reputationTarget{url: "https://app.example.com/"})
+	rc.close()
+}
+
+func TestReputationMatch_Suspend(t *testing.T) {
+	_, srv := newTestRouter("example.com")
+	defer srv.cancel()
+
+	srv.reputationMatch(reputationTarget{subdomain: "app", url: "https://app.example.com/"}, "MALWARE")
+	assert.False(t, srv.isSuspended("app"), "the flag action leaves the tunnel up for review")
+
+	srv.cfg.Server.Reputation.Action = config.ReputationSuspend
+	srv.reputationMatch(reputationTarget{subdomain: "app", url: "https://app.example.com/"}, "MALWARE")
+	assert.True(t, srv.isSuspended("app"))
+}
+
+func TestReputationCategory(t *testing.T) {
+	assert.Equal(t, database.AbuseCategoryPhishing, reputationCategory("SOCIAL_ENGINEERING"))
+	assert.Equal(t, database.AbuseCategoryPhishing, reputationCategory("phishing"))
+	assert.Equal(t, database.AbuseCategoryMalware, reputationCategory("MALWARE"))
+	assert.Equal(t, database.AbuseCategoryMalware, reputationCategory("UNWANTED_SOFTWARE"))
+	assert.Equal(t, database.AbuseCategorySpam, reputationCategory("spam"))
+	assert.Equal(t, database.AbuseCategoryOther, reputationCategory("unknown"))
+}
@@ -0,0 +1,90 @@
+package core
+
+import (
+	"errors"
+	"io"
+	"net/http"
+)
+
+// errRequestTooLarge ends a request body that went over its tunnel's limit.
+var errRequestTooLarge = errors.New("request body too large")
+
+// limitedBody counts a request body as it is read and fails the read that
+// takes it over limit. The error itself does not survive Request.Write, so
+// callers check exceeded instead.
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+	exceeded  bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.exceeded {
+		return 0, errRequestTooLarge
+	}
+	// Read one byte past the limit to tell a body that ends exactly at it
+	// from one that goes on
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) > b.remaining {
+		b.exceeded = true
+		return int(b.remaining), errRequestTooLarge
+	}
+	b.remaining -= int64(n)
+	return n, err
+}
+
+// requestLimit is the request body limit of an HTTP tunnel that asked for
+// requested bytes on a server limiting bodies to serverLimit. Either may be
+// 0 for no limit; the server's limit caps the tunnel's.
+func requestLimit(serverLimit, requested int64) int64 {
+	if requested <= 0 || (serverLimit > 0 && requested > serverLimit) {
+		return serverLimit
+	}
+	return requested
+}
+
+// limitRequestBody enforces the tunnel's request body limit. A request that
+// declares a longer body is refused with 413 before a stream is opened;
+// other bodies are counted as they are forwarded and cut off at the limit,
+// so nothing is buffered. Upgrade requests are exempt since their traffic
+// is not a request body. It reports whether the request may go on, and
+// returns the capped body to check with abortTooLarge if forwarding fails.
+func (r *HTTPRouter) limitRequestBody(w http.ResponseWriter, req *http.Request, tunnel *Tunnel, subdomain string) (*limitedBody, bool) {
+	limit := tunnel.maxRequestBytes
+	if limit <= 0 || req.Body == nil || req.Body == http.NoBody || isUpgradeRequest(req) {
+		return nil, true
+	}
+	if req.ContentLength > limit {
+		r.refuseTooLarge(w, tunnel, subdomain, req.ContentLength)
+		return nil, false
+	}
+	body := &limitedBody{ReadCloser: req.Body, remaining: limit}
+	req.Body = body
+	return body, true
+}
+
+// abortTooLarge answers 413 when forwarding a request failed because its
+// body went over the tunnel's limit. Only the bytes forwarded before the cut
+// count towards the tunnel's traffic. It reports whether it answered.
+func (r *HTTPRouter) abortTooLarge(w http.ResponseWriter, body *limitedBody, tunnel *Tunnel, subdomain string) bool {
+	if body == nil || !body.exceeded {
+		return false
+	}
+	r.refuseTooLarge(w, tunnel, subdomain, -1)
+	return true
+}
+
+func (r *HTTPRouter) refuseTooLarge(w http.ResponseWriter, tunnel *Tunnel, subdomain string, declared int64) {
+	ev := r.log.Warn().
+		Str("tunnel_id", tunnel.ID).
+		Str("subdomain", subdomain).
+		Int64("limit", tunnel.maxRequestBytes)
+	if declared >= 0 {
+		ev = ev.Int64("content_length", declared)
+	}
+	ev.Msg("Request body over the tunnel's limit")
+	r.serveErrorPage(w, http.StatusRequestEntityTooLarge, "Request body too large")
+}
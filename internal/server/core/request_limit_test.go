@@ -0,0 +1,129 @@
+package core
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+func TestRequestLimit(t *testing.T) {
+	assert.Equal(t, int64(0), requestLimit(0, 0))
+	assert.Equal(t, int64(100), requestLimit(100, 0), "server default")
+	assert.Equal(t, int64(10), requestLimit(100, 10), "tunnel may go lower")
+	assert.Equal(t, int64(100), requestLimit(100, 1000), "but not higher")
+	assert.Equal(t, int64(1000), requestLimit(0, 1000))
+	assert.Equal(t, int64(100), requestLimit(100, -1))
+}
+
+func TestLimitedBody(t *testing.T) {
+	body := &limitedBody{ReadCloser: io.NopCloser(strings.NewReader("12345678")), remaining: 8}
+	data, err := io.ReadAll(body)
+	require.NoError(t, err, "a body of exactly the limit passes")
+	assert.Equal(t, "12345678", string(data))
+	assert.False(t, body.exceeded)
+
+	body = &limitedBody{ReadCloser: io.NopCloser(strings.NewReader("123456789")), remaining: 8}
+	data, err = io.ReadAll(body)
+	assert.ErrorIs(t, err, errRequestTooLarge)
+	assert.Equal(t, "12345678", string(data), "nothing past the limit is read through")
+	assert.True(t, body.exceeded)
+}
+
+func TestLimitRequestBody_UpgradeExempt(t *testing.T) {
+	router, _ := newTestRouter("example.com")
+	tunnel := &Tunnel{ID: "t1", maxRequestBytes: 4}
+
+	req := httptest.NewRequest(http.MethodGet, "http://app.example.com/ws", strings.NewReader("more than four"))
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	body := req.Body
+	limited, ok := router.limitRequestBody(httptest.NewRecorder(), req, tunnel, "app")
+	require.True(t, ok)
+	assert.Nil(t, limited)
+	assert.Equal(t, body, req.Body, "upgrade requests are not capped")
+}
+
+// TestServeHTTP_RequestBodyLimit sends uploads through an HTTP tunnel with a
+// body limit and checks which of them reach the local service.
+func TestServeHTTP_RequestBodyLimit(t *testing.T) {
+	srv := resumeTestServer(t, 0)
+	srv.cfg.Server.MaxRequestBytes = 1 << 20
+	// Every pooled stream would park a handler below, and closing the
+	// session under hundreds of them takes tens of seconds
+	srv.noStreamPool = true
+
+	var originRequests atomic.Int64
+	origin := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return
+		}
+		originRequests.Add(1)
+		_, _ = w.Write([]byte(strconv.Itoa(len(body))))
+	})
+	originLn, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	originSrv := &http.Server{Handler: origin, ReadHeaderTimeout: time.Second}
+	go func() { _ = originSrv.Serve(originLn) }()
+	defer originSrv.Close()
+
+	session := dialServer(t, srv)
+	defer session.Close()
+	codec, _ := openControlStream(t, session)
+	require.NoError(t, codec.Encode(&protocol.AuthMessage{Message: protocol.NewMessage(protocol.MsgAuth)}))
+	var auth protocol.AuthResultMessage
+	require.NoError(t, codec.Decode(&auth))
+	require.True(t, auth.Success, auth.Error)
+
+	require.NoError(t, codec.Encode(&protocol.TunnelRequestMessage{
+		Message:         protocol.NewMessage(protocol.MsgTunnelRequest),
+		TunnelType:      protocol.TunnelHTTP,
+		Subdomain:       "upload",
+		LocalPort:       80,
+		MaxRequestBytes: 16,
+	}))
+	var created protocol.TunnelCreatedMessage
+	require.NoError(t, codec.Decode(&created))
+	require.Equal(t, protocol.MsgTunnelCreated, created.Type)
+
+	go func() {
+		for {
+			stream, err := session.Accept()
+			if err != nil {
+				return
+			}
+			go handleBenchStream(stream, originLn.Addr().String())
+		}
+	}()
+
+	post := func(body io.Reader) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		srv.httpRouter.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "http://upload.test.local/files", body))
+		return w
+	}
+
+	w := post(strings.NewReader("small upload"))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "12", w.Body.String())
+
+	// A declared length over the limit is refused up front
+	w = post(strings.NewReader(strings.Repeat("x", 100)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, int64(1), originRequests.Load())
+
+	// A body of unknown length is cut off once it goes over
+	w = post(io.MultiReader(strings.NewReader(strings.Repeat("x", 100))))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, int64(1), originRequests.Load())
+}
@@ -0,0 +1,120 @@
+package core
+
+import (
+	"time"
+
+	"github.com/mephistofox/fxtun.dev/internal/server/database"
+)
+
+// reservedRefreshInterval is how often the in-memory reservation index is
+// reloaded. Reservations are made and released through the API, possibly on
+// another node, so the index can lag by up to this long; that decides
+// whether a missing tunnel gets the landing page or the offline page, and
+// how soon tunnels of a released reservation are closed.
+const reservedRefreshInterval = time.Minute
+
+// loadReserved replaces the reservation index with the reservations
+// currently active in the database and closes the tunnels of those released
+// since the previous load.
+func (s *Server) loadReserved() error {
+	domains, err := s.db.Domains.ListActive()
+	if err != nil {
+		return err
+	}
+	for _, d := range s.applyReserved(domains, time.Now()) {
+		if n := s.closeReleasedTunnels(d.reservation, d.cutoff); n > 0 {
+			s.log.Info().
+				Int64("user_id", d.reservation.UserID).
+				Str("subdomain", d.reservation.Subdomain).
+				Int("tunnels", n).
+				Msg("Closed tunnels of released domain reservation")
+		}
+	}
+	return nil
+}
+
+// releasedReservation is a reservation gone from the index. Tunnels its
+// owner created before cutoff were opened under the reservation.
+type releasedReservation struct {
+	reservation *database.ReservedDomain
+	cutoff      time.Time
+}
+
+// applyReserved replaces the reservation index with domains, loaded at now,
+// and returns the reservations of the previous index that are gone or now
+// belong to someone else. Every node sees the same database, so each closes
+// its own tunnels of an expired or deleted reservation, whichever node
+// released it.
+func (s *Server) applyReserved(domains []*database.ReservedDomain, now time.Time) []releasedReservation {
+	reserved := make(map[string]*database.ReservedDomain, len(domains))
+	for _, d := range domains {
+		reserved[d.Subdomain] = d
+	}
+
+	s.reservedMu.Lock()
+	defer s.reservedMu.Unlock()
+	var released []releasedReservation
+	for sub, prev := range s.reserved {
+		if cur, ok := reserved[sub]; ok && cur.UserID == prev.UserID {
+			continue
+		}
+		// The reservation ended at its expiry if that has passed, and
+		// otherwise at some point since the previous load
+		cutoff := s.reservedAt
+		if prev.ExpiresAt != nil && !prev.ExpiresAt.After(now) {
+			cutoff = *prev.ExpiresAt
+		}
+		released = append(released, releasedReservation{reservation: prev, cutoff: cutoff})
+	}
+	s.reserved = reserved
+	s.reservedAt = now
+	return released
+}
+
+// closeReleasedTunnels closes the HTTP tunnels the owner of a released
+// reservation opened on its subdomain before cutoff. A tunnel opened later
+// took the subdomain as a free one and is left alone.
+func (s *Server) closeReleasedTunnels(d *database.ReservedDomain, cutoff time.Time) int {
+	closed := 0
+	for _, tunnel := range s.httpRouter.GetTunnels(d.Subdomain) {
+		client := s.GetClient(tunnel.ClientID)
+		if client == nil || client.UserID != d.UserID || !tunnel.Created.Before(cutoff) {
+			continue
+		}
+		client.closeTunnel(tunnel.ID)
+		closed++
+	}
+	return closed
+}
+
+// runReservedRefresher keeps the reservation index in sync with the
+// database until the server stops. Requests for unknown subdomains consult
+// the index instead of querying the database each time.
+func (s *Server) runReservedRefresher() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(reservedRefreshInterval)
+	defer ticker.Stop()
+	for {
+		if err := s.loadReserved(); err != nil {
+			s.log.Warn().Err(err).Msg("Failed to load reserved subdomains")
+		}
+		select {
+		case <-ticker.C:
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// isReservedSubdomain reports whether the reservation index holds subdomain.
+// Until the first load succeeds every subdomain counts as reserved, so a
+// subdomain is never advertised as free when it could not be checked.
+func (s *Server) isReservedSubdomain(subdomain string) bool {
+	s.reservedMu.RLock()
+	defer s.reservedMu.RUnlock()
+	if s.reserved == nil {
+		return true
+	}
+	_, ok := s.reserved[subdomain]
+	return ok
+}
@@ -0,0 +1,78 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+	"github.com/mephistofox/fxtun.dev/internal/server/database"
+)
+
+func TestIsReservedSubdomain(t *testing.T) {
+	srv := &Server{}
+	assert.True(t, srv.isReservedSubdomain("anything"), "not loaded yet")
+
+	srv.applyReserved([]*database.ReservedDomain{{UserID: 1, Subdomain: "mine"}}, time.Now())
+	assert.True(t, srv.isReservedSubdomain("mine"))
+	assert.False(t, srv.isReservedSubdomain("free"))
+}
+
+func TestApplyReserved_Released(t *testing.T) {
+	srv := &Server{}
+	loaded := time.Now().Add(-time.Minute)
+	expiry := loaded.Add(30 * time.Second)
+	assert.Empty(t, srv.applyReserved([]*database.ReservedDomain{
+		{UserID: 1, Subdomain: "kept"},
+		{UserID: 1, Subdomain: "expired", ExpiresAt: &expiry},
+		{UserID: 1, Subdomain: "deleted"},
+		{UserID: 1, Subdomain: "retaken", ExpiresAt: &expiry},
+	}, loaded), "the first load releases nothing")
+
+	released := srv.applyReserved([]*database.ReservedDomain{
+		{UserID: 1, Subdomain: "kept"},
+		{UserID: 2, Subdomain: "retaken"},
+	}, time.Now())
+
+	cutoffs := make(map[string]time.Time, len(released))
+	for _, r := range released {
+		cutoffs[r.reservation.Subdomain] = r.cutoff
+	}
+	require.Len(t, cutoffs, 3)
+	assert.Equal(t, expiry, cutoffs["expired"], "an expired reservation ends at its expiry")
+	assert.Equal(t, expiry, cutoffs["retaken"])
+	assert.Equal(t, loaded, cutoffs["deleted"], "a deleted one ended after the previous load")
+	assert.False(t, srv.isReservedSubdomain("expired"))
+}
+
+func TestCloseReleasedTunnels(t *testing.T) {
+	router, srv := newTestRouter("example.com")
+	defer srv.cancel()
+	srv.cfg.Server.SharedSubdomains.Enabled = true
+
+	var control bytes.Buffer
+	client := &Client{ID: "c1", UserID: 7, server: srv, log: zerolog.Nop(), Tunnels: map[string]*Tunnel{},
+		ControlCodec: protocol.NewCodec(&control, &control)}
+	srv.clientMgr.addClient(client.ID, client)
+	released := time.Now()
+	for id, created := range map[string]time.Time{
+		"old-1": released.Add(-time.Hour),
+		"old-2": released.Add(-time.Hour),
+		"new":   released.Add(time.Second),
+	} {
+		tunnel := &Tunnel{ID: id, Type: protocol.TunnelHTTP, Subdomain: "shop", ClientID: "c1", userID: 7, Created: created}
+		client.Tunnels[id] = tunnel
+		require.NoError(t, router.RegisterTunnel("shop", tunnel))
+	}
+
+	closed := srv.closeReleasedTunnels(&database.ReservedDomain{UserID: 7, Subdomain: "shop"}, released)
+	assert.Equal(t, 2, closed, "every tunnel of the group opened under the reservation")
+	assert.Len(t, client.Tunnels, 1)
+	assert.Contains(t, client.Tunnels, "new", "a tunnel opened after the release took a free subdomain")
+	assert.Zero(t, srv.closeReleasedTunnels(&database.ReservedDomain{UserID: 8, Subdomain: "shop"}, released.Add(time.Hour)),
+		"only the owner's tunnels are closed")
+}
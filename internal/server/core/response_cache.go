@@ -0,0 +1,497 @@
+package core
+
+import (
+	"bytes"
+	"container/list"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// cacheHeuristicMax caps the freshness guessed from Last-Modified for
+	// responses that carry no explicit expiry.
+	cacheHeuristicMax = 5 * time.Minute
+	// cacheStatusHeader tells the visitor how a cacheable request was
+	// served: HIT, MISS or REVALIDATED.
+	cacheStatusHeader = "X-FxTunnel-Cache"
+)
+
+// Values of cacheStatusHeader
+const (
+	cacheHit         = "HIT"
+	cacheMiss        = "MISS"
+	cacheRevalidated = "REVALIDATED"
+)
+
+// cacheUnstoredHeaders are hop-by-hop or recomputed when a stored response
+// is served, so they are neither stored nor updated by a 304.
+var cacheUnstoredHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Connection", "Transfer-Encoding",
+	"Upgrade", "Trailer", "Te", "Content-Length", "Age", cacheStatusHeader,
+}
+
+// cacheEntry is a stored response. Entries are never modified once stored;
+// revalidation replaces them.
+type cacheEntry struct {
+	primary  string // host and request URI
+	variant  string // values of the headers the response varies on
+	status   int
+	header   http.Header
+	body     []byte
+	size     int64
+	stored   time.Time     // when the response was received
+	age      time.Duration // Age of the response when it was received
+	lifetime time.Duration // how long after it was generated it is fresh
+}
+
+func (e *cacheEntry) currentAge(now time.Time) time.Duration {
+	return e.age + now.Sub(e.stored)
+}
+
+func (e *cacheEntry) fresh(now time.Time) bool {
+	return e.currentAge(now) < e.lifetime
+}
+
+// hasValidators reports whether the entry can be revalidated with a
+// conditional request.
+func (e *cacheEntry) hasValidators() bool {
+	return e.header.Get("ETag") != "" || e.header.Get("Last-Modified") != ""
+}
+
+// cacheVariants holds the stored responses for one URL. vary is the Vary
+// header of the latest response; a response with different Vary headers
+// replaces all variants.
+type cacheVariants struct {
+	vary      []string
+	byVariant map[string]*list.Element
+}
+
+// responseCache is the response cache of one HTTP tunnel: responses to GET
+// requests keyed by host and request URI plus the request headers named in
+// their Vary header, evicted least recently used first once the total size
+// exceeds maxSize.
+type responseCache struct {
+	maxSize int64
+	// maxEntry caps a single response so one large download cannot flush
+	// the whole cache.
+	maxEntry int64
+
+	mu      sync.Mutex
+	size    int64
+	entries map[string]*cacheVariants // by primary key
+	lru     *list.List                // of *cacheEntry, most recent first
+}
+
+func newResponseCache(maxSize int64) *responseCache {
+	return &responseCache{
+		maxSize:  maxSize,
+		maxEntry: maxSize / 4,
+		entries:  make(map[string]*cacheVariants),
+		lru:      list.New(),
+	}
+}
+
+func cachePrimaryKey(req *http.Request) string {
+	return req.Host + req.URL.RequestURI()
+}
+
+func cacheVariantKey(req *http.Request, vary []string) string {
+	var b strings.Builder
+	for _, name := range vary {
+		b.WriteString(strings.Join(req.Header.Values(name), ","))
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// get returns the stored response matching req, fresh or not, or nil.
+func (c *responseCache) get(req *http.Request) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.entries[cachePrimaryKey(req)]
+	if !ok {
+		return nil
+	}
+	el, ok := v.byVariant[cacheVariantKey(req, v.vary)]
+	if !ok {
+		return nil
+	}
+	c.lru.MoveToFront(el)
+	return el.Value.(*cacheEntry)
+}
+
+// put stores the response to the GET request req if its headers allow it,
+// replacing the response stored for the same request. It returns the entry,
+// or nil when the response is not stored.
+func (c *responseCache) put(req *http.Request, status int, header http.Header, body []byte, now time.Time) *cacheEntry {
+	e := newCacheEntry(status, header, body, now)
+	vary, ok := varyHeaders(header)
+	if e != nil && ok {
+		e.primary = cachePrimaryKey(req)
+		e.variant = cacheVariantKey(req, vary)
+		e.size += int64(len(e.primary) + len(e.variant))
+	}
+	if e == nil || !ok || e.size > c.maxEntry {
+		// The response replaces whatever was stored, even if it is not
+		// stored itself
+		c.remove(req)
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.entries[e.primary]
+	if ok && !slices.Equal(v.vary, vary) {
+		for _, el := range v.byVariant {
+			c.removeLocked(el)
+		}
+		ok = false
+	}
+	if !ok {
+		v = &cacheVariants{vary: vary, byVariant: make(map[string]*list.Element)}
+		c.entries[e.primary] = v
+	}
+	if el, ok := v.byVariant[e.variant]; ok {
+		c.removeLocked(el)
+	}
+	v.byVariant[e.variant] = c.lru.PushFront(e)
+	c.size += e.size
+	for c.size > c.maxSize {
+		c.removeLocked(c.lru.Back())
+	}
+	return e
+}
+
+// refresh updates the entry stored for req with the headers of a 304 Not
+// Modified answer to its revalidation. It returns the updated entry, which
+// is served even if the new headers no longer allow storing it.
+func (c *responseCache) refresh(req *http.Request, old *cacheEntry, notModified http.Header, now time.Time) *cacheEntry {
+	header := old.header.Clone()
+	for name, values := range notModified {
+		header[name] = values
+	}
+	if e := c.put(req, old.status, header, old.body, now); e != nil {
+		return e
+	}
+	deleteHeaders(header, cacheUnstoredHeaders)
+	return &cacheEntry{status: old.status, header: header, body: old.body, stored: now}
+}
+
+// remove drops the entry stored for req, if any.
+func (c *responseCache) remove(req *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if v, ok := c.entries[cachePrimaryKey(req)]; ok {
+		if el, ok := v.byVariant[cacheVariantKey(req, v.vary)]; ok {
+			c.removeLocked(el)
+		}
+	}
+}
+
+func (c *responseCache) removeLocked(el *list.Element) {
+	e := c.lru.Remove(el).(*cacheEntry)
+	c.size -= e.size
+	v := c.entries[e.primary]
+	delete(v.byVariant, e.variant)
+	if len(v.byVariant) == 0 {
+		delete(c.entries, e.primary)
+	}
+}
+
+// purge drops every stored response and returns how many there were.
+func (c *responseCache) purge() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := c.lru.Len()
+	c.entries = make(map[string]*cacheVariants)
+	c.lru.Init()
+	c.size = 0
+	return n
+}
+
+// newCacheEntry builds the entry for a response, or returns nil when its
+// status or headers forbid storing it or storing it would gain nothing.
+func newCacheEntry(status int, header http.Header, body []byte, now time.Time) *cacheEntry {
+	lifetime, ok := cacheLifetime(status, header, now)
+	if !ok {
+		return nil
+	}
+	e := &cacheEntry{
+		status:   status,
+		header:   header.Clone(),
+		body:     body,
+		stored:   now,
+		lifetime: lifetime,
+	}
+	if age, err := strconv.ParseInt(header.Get("Age"), 10, 64); err == nil && age > 0 {
+		e.age = time.Duration(age) * time.Second
+	}
+	deleteHeaders(e.header, cacheUnstoredHeaders)
+	e.size = int64(len(body))
+	for name, values := range e.header {
+		e.size += int64(len(name))
+		for _, v := range values {
+			e.size += int64(len(v))
+		}
+	}
+	return e
+}
+
+// cacheLifetime returns how long a response stays fresh after it was
+// generated, following its Cache-Control, Expires and Last-Modified
+// headers. It reports false when the response must not be stored, or has
+// neither a freshness lifetime nor validators to revalidate it with.
+func cacheLifetime(status int, header http.Header, now time.Time) (time.Duration, bool) {
+	switch status {
+	case http.StatusOK, http.StatusNonAuthoritativeInfo, http.StatusMovedPermanently,
+		http.StatusNotFound, http.StatusGone:
+	default:
+		return 0, false
+	}
+	// Set-Cookie belongs to a single visitor
+	if header.Get("Set-Cookie") != "" {
+		return 0, false
+	}
+	cc := parseCacheControl(header)
+	if _, ok := cc["no-store"]; ok {
+		return 0, false
+	}
+	if _, ok := cc["private"]; ok {
+		return 0, false
+	}
+
+	date, err := http.ParseTime(header.Get("Date"))
+	if err != nil {
+		date = now
+	}
+	var lifetime time.Duration
+	if _, ok := cc["no-cache"]; ok {
+		// Stored, but revalidated before every use
+	} else if d, ok := cacheControlSeconds(cc, "s-maxage"); ok {
+		lifetime = d
+	} else if d, ok := cacheControlSeconds(cc, "max-age"); ok {
+		lifetime = d
+	} else if expires := header.Get("Expires"); expires != "" {
+		// An invalid Expires means already expired
+		if t, err := http.ParseTime(expires); err == nil {
+			lifetime = t.Sub(date)
+		}
+	} else if lm, err := http.ParseTime(header.Get("Last-Modified")); err == nil && date.After(lm) {
+		// Heuristic freshness: a tenth of the time since the last change
+		lifetime = min(date.Sub(lm)/10, cacheHeuristicMax)
+	}
+
+	hasValidators := header.Get("ETag") != "" || header.Get("Last-Modified") != ""
+	if lifetime <= 0 && !hasValidators {
+		return 0, false
+	}
+	return max(lifetime, 0), true
+}
+
+// parseCacheControl returns the directives of the Cache-Control header in
+// h, with lowercase names and unquoted values.
+func parseCacheControl(h http.Header) map[string]string {
+	cc := make(map[string]string)
+	for _, line := range h.Values("Cache-Control") {
+		for _, directive := range strings.Split(line, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name == "" {
+				continue
+			}
+			cc[strings.ToLower(name)] = strings.Trim(value, `"`)
+		}
+	}
+	return cc
+}
+
+func cacheControlSeconds(cc map[string]string, name string) (time.Duration, bool) {
+	v, ok := cc[name]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		// A malformed delta means stale
+		return 0, true
+	}
+	return time.Duration(min(n, int64(365*24*time.Hour/time.Second))) * time.Second, true
+}
+
+// varyHeaders returns the canonical, sorted header names of the Vary header
+// in h. It reports false for "Vary: *", which no stored response can match.
+func varyHeaders(h http.Header) ([]string, bool) {
+	var names []string
+	for _, line := range h.Values("Vary") {
+		for _, name := range strings.Split(line, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				return nil, false
+			}
+			if name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names), true
+}
+
+func deleteHeaders(h http.Header, names []string) {
+	for _, name := range names {
+		h.Del(name)
+	}
+}
+
+// cacheableRequest reports whether req may be answered from the cache of
+// tunnel. Requests carrying credentials are only cached on tunnels whose
+// basic auth consumes them: every visitor past the check sees the same
+// content.
+func cacheableRequest(req *http.Request, tunnel *Tunnel) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	if isUpgradeRequest(req) || req.Header.Get("Range") != "" {
+		return false
+	}
+	if req.Header.Get("Authorization") != "" && tunnel.BasicAuthHash == "" {
+		return false
+	}
+	_, noStore := parseCacheControl(req.Header)["no-store"]
+	return !noStore
+}
+
+// revalidationRequested reports whether the visitor asked for a stored
+// response to be revalidated, as browsers do on a hard reload. A plain
+// reload (max-age=0) is still served from the cache.
+func revalidationRequested(req *http.Request) bool {
+	if _, ok := parseCacheControl(req.Header)["no-cache"]; ok {
+		return true
+	}
+	return req.Header.Get("Cache-Control") == "" && req.Header.Get("Pragma") == "no-cache"
+}
+
+// setCacheValidators turns req into a revalidation of e, so the local
+// service can answer 304 Not Modified instead of sending the body again.
+// The visitor's own conditional headers are replaced; restore puts them
+// back so they can be evaluated against the refreshed entry.
+func setCacheValidators(req *http.Request, e *cacheEntry) (restore func()) {
+	ifNoneMatch := req.Header.Values("If-None-Match")
+	ifModifiedSince := req.Header.Values("If-Modified-Since")
+	req.Header.Del("If-None-Match")
+	req.Header.Del("If-Modified-Since")
+	if etag := e.header.Get("ETag"); etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lm := e.header.Get("Last-Modified"); lm != "" {
+		req.Header.Set("If-Modified-Since", lm)
+	}
+	return func() {
+		req.Header.Del("If-None-Match")
+		req.Header.Del("If-Modified-Since")
+		if len(ifNoneMatch) > 0 {
+			req.Header["If-None-Match"] = ifNoneMatch
+		}
+		if len(ifModifiedSince) > 0 {
+			req.Header["If-Modified-Since"] = ifModifiedSince
+		}
+	}
+}
+
+// cacheNotModified reports whether the visitor's conditional headers match
+// e, so a 304 Not Modified can be sent instead of the body. If-None-Match
+// takes precedence over If-Modified-Since.
+func cacheNotModified(req *http.Request, e *cacheEntry) bool {
+	if e.status != http.StatusOK {
+		return false
+	}
+	if inm := req.Header.Get("If-None-Match"); inm != "" {
+		return etagMatches(inm, e.header.Get("ETag"))
+	}
+	ims, err := http.ParseTime(req.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lm, err := http.ParseTime(e.header.Get("Last-Modified"))
+	return err == nil && !lm.After(ims)
+}
+
+// etagMatches compares an If-None-Match header with an ETag using the weak
+// comparison, so W/"x" matches "x".
+func etagMatches(ifNoneMatch, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheRecorder keeps a copy of a response body for the cache while it is
+// streamed to the visitor. Bodies over limit are not kept.
+type cacheRecorder struct {
+	r        io.Reader
+	limit    int64
+	buf      bytes.Buffer
+	overflow bool
+	eof      bool
+}
+
+func (c *cacheRecorder) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if n > 0 && !c.overflow {
+		if int64(c.buf.Len()+n) > c.limit {
+			c.overflow = true
+			c.buf = bytes.Buffer{}
+		} else {
+			c.buf.Write(p[:n])
+		}
+	}
+	if err == io.EOF {
+		c.eof = true
+	}
+	return n, err
+}
+
+// body returns the recorded body, or false when the response was not read
+// to the end or was too large to keep.
+func (c *cacheRecorder) body() ([]byte, bool) {
+	if !c.eof || c.overflow {
+		return nil, false
+	}
+	return c.buf.Bytes(), true
+}
+
+// serveCached answers req from the stored response e, with 304 Not Modified
+// when the visitor's conditional headers match it.
+func (r *HTTPRouter) serveCached(w http.ResponseWriter, req *http.Request, e *cacheEntry, tunnel *Tunnel, plainHTTP bool, cacheStatus string) {
+	header := e.header.Clone()
+	applyResponseHeaderRules(header, tunnel.HeaderRules, plainHTTP)
+	for name, values := range header {
+		w.Header()[name] = values
+	}
+	w.Header().Set("Age", strconv.FormatInt(int64(e.currentAge(time.Now())/time.Second), 10))
+	w.Header().Set(cacheStatusHeader, cacheStatus)
+	w.Header().Set("X-FxTunnel-Node", r.server.NodeName())
+
+	if cacheNotModified(req, e) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(e.body)))
+	w.WriteHeader(e.status)
+	if req.Method != http.MethodHead {
+		_, _ = w.Write(e.body)
+	}
+}
@@ -0,0 +1,238 @@
+package core
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+func TestCacheLifetime(t *testing.T) {
+	now := time.Date(2026, 3, 4, 12, 0, 0, 0, time.UTC)
+	date := now.Format(http.TimeFormat)
+
+	tests := []struct {
+		name   string
+		status int
+		header http.Header
+		want   time.Duration
+		ok     bool
+	}{
+		{"max-age", 200, http.Header{"Cache-Control": {"public, max-age=60"}}, time.Minute, true},
+		{"s-maxage wins", 200, http.Header{"Cache-Control": {"max-age=60, s-maxage=10"}}, 10 * time.Second, true},
+		{"expires", 200, http.Header{"Date": {date}, "Expires": {now.Add(time.Hour).Format(http.TimeFormat)}}, time.Hour, true},
+		{"heuristic", 200, http.Header{"Date": {date}, "Last-Modified": {now.Add(-10 * time.Minute).Format(http.TimeFormat)}}, time.Minute, true},
+		{"heuristic capped", 200, http.Header{"Date": {date}, "Last-Modified": {now.Add(-30 * 24 * time.Hour).Format(http.TimeFormat)}}, cacheHeuristicMax, true},
+		{"no-cache with etag", 200, http.Header{"Cache-Control": {"no-cache"}, "Etag": {`"v1"`}}, 0, true},
+		{"no-cache without validators", 200, http.Header{"Cache-Control": {"no-cache"}}, 0, false},
+		{"no freshness", 200, http.Header{}, 0, false},
+		{"no-store", 200, http.Header{"Cache-Control": {"no-store, max-age=60"}}, 0, false},
+		{"private", 200, http.Header{"Cache-Control": {"private, max-age=60"}}, 0, false},
+		{"set-cookie", 200, http.Header{"Cache-Control": {"max-age=60"}, "Set-Cookie": {"sid=1"}}, 0, false},
+		{"uncacheable status", 500, http.Header{"Cache-Control": {"max-age=60"}}, 0, false},
+		{"not found", 404, http.Header{"Cache-Control": {"max-age=60"}}, time.Minute, true},
+	}
+	for _, tt := range tests {
+		got, ok := cacheLifetime(tt.status, tt.header, now)
+		assert.Equal(t, tt.ok, ok, tt.name)
+		assert.Equal(t, tt.want, got, tt.name)
+	}
+}
+
+func TestEtagMatches(t *testing.T) {
+	assert.True(t, etagMatches(`"v1"`, `"v1"`))
+	assert.True(t, etagMatches(`"v0", W/"v1"`, `"v1"`))
+	assert.True(t, etagMatches(`"v1"`, `W/"v1"`))
+	assert.True(t, etagMatches("*", `"v1"`))
+	assert.False(t, etagMatches(`"v2"`, `"v1"`))
+	assert.False(t, etagMatches(`"v1"`, ""))
+}
+
+func TestSetCacheValidators(t *testing.T) {
+	e := newCacheEntry(200, http.Header{"Cache-Control": {"no-cache"}, "Etag": {`"v2"`}}, []byte("body"), time.Now())
+	require.NotNil(t, e)
+
+	req := cacheRequest("http://app.example.com/", "If-None-Match", `"v1"`)
+	restore := setCacheValidators(req, e)
+	assert.Equal(t, `"v2"`, req.Header.Get("If-None-Match"))
+
+	restore()
+	assert.Equal(t, `"v1"`, req.Header.Get("If-None-Match"))
+	assert.False(t, cacheNotModified(req, e), "the visitor's own validator no longer matches")
+
+	req = cacheRequest("http://app.example.com/")
+	restore = setCacheValidators(req, e)
+	restore()
+	assert.Empty(t, req.Header.Get("If-None-Match"))
+	assert.False(t, cacheNotModified(req, e))
+}
+
+func cacheRequest(target string, header ...string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	return req
+}
+
+func TestResponseCache_Vary(t *testing.T) {
+	c := newResponseCache(1 << 20)
+	now := time.Now()
+	header := http.Header{"Cache-Control": {"max-age=60"}, "Vary": {"accept-encoding"}}
+
+	gz := cacheRequest("http://app.example.com/app.js", "Accept-Encoding", "gzip")
+	plain := cacheRequest("http://app.example.com/app.js")
+	require.NotNil(t, c.put(gz, 200, header, []byte("gzipped"), now))
+	require.NotNil(t, c.put(plain, 200, header, []byte("plain"), now))
+
+	assert.Equal(t, "gzipped", string(c.get(gz).body))
+	assert.Equal(t, "plain", string(c.get(plain).body))
+	assert.Nil(t, c.get(cacheRequest("http://app.example.com/app.js", "Accept-Encoding", "br")))
+
+	// A response that may no longer be stored replaces the stored one
+	assert.Nil(t, c.put(gz, 200, http.Header{"Cache-Control": {"no-store"}, "Vary": {"Accept-Encoding"}}, nil, now))
+	assert.Nil(t, c.get(gz))
+	assert.NotNil(t, c.get(plain))
+
+	assert.Nil(t, c.put(plain, 200, http.Header{"Cache-Control": {"max-age=60"}, "Vary": {"*"}}, nil, now))
+	assert.Equal(t, 0, c.purge())
+}
+
+func TestResponseCache_Eviction(t *testing.T) {
+	c := newResponseCache(4096)
+	now := time.Now()
+	header := http.Header{"Cache-Control": {"max-age=60"}}
+	body := []byte(strings.Repeat("x", 900))
+
+	for _, path := range []string{"/a", "/b", "/c", "/d"} {
+		require.NotNil(t, c.put(cacheRequest("http://app.example.com"+path), 200, header, body, now))
+	}
+	c.get(cacheRequest("http://app.example.com/a")) // now the most recently used
+	require.NotNil(t, c.put(cacheRequest("http://app.example.com/e"), 200, header, body, now))
+
+	assert.LessOrEqual(t, c.size, c.maxSize)
+	assert.NotNil(t, c.get(cacheRequest("http://app.example.com/a")))
+	assert.Nil(t, c.get(cacheRequest("http://app.example.com/b")), "least recently used entry evicted")
+
+	// One response may not take more than a quarter of the cache
+	assert.Nil(t, c.put(cacheRequest("http://app.example.com/big"), 200, header, make([]byte, 2048), now))
+	assert.Equal(t, 4, c.purge())
+	assert.Equal(t, int64(0), c.size)
+}
+
+// TestServeHTTP_ResponseCache runs requests through a cached HTTP tunnel and
+// checks which of them reach the local service.
+func TestServeHTTP_ResponseCache(t *testing.T) {
+	srv := resumeTestServer(t, 0)
+	srv.cfg.Server.TunnelCacheMaxSize = 1 << 20
+
+	var originRequests atomic.Int64
+	var lastIfNoneMatch atomic.Value
+	origin := http.NewServeMux()
+	origin.HandleFunc("/logo.png", func(w http.ResponseWriter, r *http.Request) {
+		originRequests.Add(1)
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		_, _ = w.Write([]byte("png"))
+	})
+	origin.HandleFunc("/app.js", func(w http.ResponseWriter, r *http.Request) {
+		originRequests.Add(1)
+		lastIfNoneMatch.Store(r.Header.Get("If-None-Match"))
+		w.Header().Set("Content-Type", "application/javascript")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = w.Write([]byte("console.log(1)"))
+	})
+	originLn, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	originSrv := &http.Server{Handler: origin, ReadHeaderTimeout: time.Second}
+	go func() { _ = originSrv.Serve(originLn) }()
+	defer originSrv.Close()
+
+	session := dialServer(t, srv)
+	defer session.Close()
+	codec, _ := openControlStream(t, session)
+	require.NoError(t, codec.Encode(&protocol.AuthMessage{Message: protocol.NewMessage(protocol.MsgAuth)}))
+	var auth protocol.AuthResultMessage
+	require.NoError(t, codec.Decode(&auth))
+	require.True(t, auth.Success, auth.Error)
+
+	require.NoError(t, codec.Encode(&protocol.TunnelRequestMessage{
+		Message:      protocol.NewMessage(protocol.MsgTunnelRequest),
+		TunnelType:   protocol.TunnelHTTP,
+		Subdomain:    "static",
+		LocalPort:    80,
+		Cache:        true,
+		CacheMaxSize: 64 << 20,
+	}))
+	var created protocol.TunnelCreatedMessage
+	require.NoError(t, codec.Decode(&created))
+	require.Equal(t, protocol.MsgTunnelCreated, created.Type)
+
+	go func() {
+		for {
+			stream, err := session.Accept()
+			if err != nil {
+				return
+			}
+			go handleBenchStream(stream, originLn.Addr().String())
+		}
+	}()
+
+	get := func(path string, header ...string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		srv.httpRouter.ServeHTTP(w, cacheRequest("http://static.test.local"+path, header...))
+		return w
+	}
+
+	w := get("/logo.png")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, cacheMiss, w.Header().Get(cacheStatusHeader))
+
+	w = get("/logo.png")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, cacheHit, w.Header().Get(cacheStatusHeader))
+	assert.Equal(t, "png", w.Body.String())
+	assert.Equal(t, int64(1), originRequests.Load(), "a hit does not reach the local service")
+
+	// no-cache responses are revalidated on every request
+	w = get("/app.js")
+	assert.Equal(t, cacheMiss, w.Header().Get(cacheStatusHeader))
+	w = get("/app.js")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, cacheRevalidated, w.Header().Get(cacheStatusHeader))
+	assert.Equal(t, "console.log(1)", w.Body.String())
+	assert.Equal(t, `"v1"`, lastIfNoneMatch.Load())
+
+	w = get("/app.js", "If-None-Match", `"v1"`)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	// A hard reload revalidates even fresh responses
+	w = get("/logo.png", "Cache-Control", "no-cache")
+	assert.Equal(t, cacheMiss, w.Header().Get(cacheStatusHeader))
+	assert.Equal(t, int64(5), originRequests.Load())
+
+	// Auth is disabled in this server; link the client to a user by hand
+	srv.clientMgr.linkUserClient(7, auth.ClientID)
+	_, err = srv.PurgeTunnelCache(created.TunnelID, 8)
+	assert.Error(t, err, "tunnel of another user")
+	n, err := srv.PurgeTunnelCache(created.TunnelID, 7)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	w = get("/logo.png")
+	assert.Equal(t, cacheMiss, w.Header().Get(cacheStatusHeader))
+}
@@ -11,10 +11,10 @@ import (
 	"net"
 	"net/http"
 	"os"
-	"regexp"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/hashicorp/yamux"
@@ -23,6 +23,7 @@ import (
 
 	"github.com/mephistofox/fxtun.dev/internal/config"
 	"github.com/mephistofox/fxtun.dev/internal/inspect"
+	"github.com/mephistofox/fxtun.dev/internal/logging"
 	"github.com/mephistofox/fxtun.dev/internal/protocol"
 	"github.com/mephistofox/fxtun.dev/internal/server/auth"
 	"github.com/mephistofox/fxtun.dev/internal/server/database"
@@ -32,20 +33,6 @@ import (
 	fxtls "github.com/mephistofox/fxtun.dev/internal/server/tls"
 )
 
-var (
-	// subdomainRegex validates subdomain format
-	subdomainRegex = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,30}[a-z0-9])?$`)
-
-	// reservedSubdomains are subdomains that cannot be claimed by tunnel clients
-	reservedSubdomains = map[string]bool{
-		"api": true, "www": true, "admin": true, "mail": true,
-		"smtp": true, "imap": true, "pop": true, "ftp": true,
-		"ns1": true, "ns2": true, "ns3": true, "ns4": true,
-		"autoconfig": true, "autodiscover": true, "_dmarc": true,
-		"status": true, "metrics": true, "grafana": true,
-	}
-)
-
 const (
 	// yamuxMaxStreamWindowSize is the yamux stream window size for high throughput.
 	yamuxMaxStreamWindowSize = 16 * 1024 * 1024 // 16MB
@@ -148,6 +135,17 @@ type Server struct {
 	// Cross-server tunnel registry (optional)
 	tunnelRegistry store.TunnelRegistry
 
+	// Tunnel lifecycle webhooks; nil when not configured (see webhooks.go)
+	webhooks *webhookEmitter
+
+	// URL reputation check of new HTTP tunnels; nil when not configured
+	// (see reputation.go)
+	reputation *reputationChecker
+
+	// Background writer of user history events; nil without a database
+	// (see history_events.go)
+	history *historyRecorder
+
 	// Edge node system
 	mode         config.ServerMode
 	nodeRegistry store.NodeRegistry
@@ -161,15 +159,58 @@ type Server struct {
 	customDomains  map[string]*database.CustomDomain // domain -> entry
 	customDomainMu sync.RWMutex
 
+	// Shared session ticket keys of every TLS listener; nil when not configured
+	ticketKeys *fxtls.SessionTicketKeys
+
 	// Trusted reverse-proxy IPs whose forwarded headers may be believed
 	// (data-plane equivalent of the API's trustedRealIPMiddleware).
 	trustedProxies map[string]struct{}
 
+	// Signs tunnel restore tokens; nil when no secret is configured
+	restoreKey []byte
+
 	// Auth rate limiting per IP
 	authLimiters sync.Map // remoteIP -> *monitor.SlidingWindow
 
-	// Active connections tracking for graceful drain
-	activeConns sync.WaitGroup
+	// Subdomains suspended for abuse, the part of them loaded by the last
+	// database sync, and the abuse report rate limit per visitor IP (see
+	// abuse.go)
+	suspended       map[string]struct{}
+	suspendedSynced map[string]struct{}
+	suspendedMu     sync.RWMutex
+	reportLimiters  sync.Map // visitorIP -> *monitor.SlidingWindow
+
+	// Index of active reservations by subdomain, reloaded from the database
+	// at reservedAt; nil until the first load (see reserved_index.go)
+	reserved   map[string]*database.ReservedDomain
+	reservedAt time.Time
+	reservedMu sync.RWMutex
+
+	// Client connection limits and IP bans (see conn_limit.go)
+	connLimits *connLimiter
+	ipBans     store.IPBanStore // nil when bans are not shared with the server
+
+	// Country and ASN rules for client connections (see geo_policy.go)
+	geoPolicy *geoPolicy // nil without rules
+	asnLookup *geoip.ASNLookup
+
+	// Destinations socks tunnels may connect to (server.socks)
+	socksPolicy *socksPolicy
+
+	// Data-plane counters exported by MetricsCollector (see metrics.go)
+	stats dataPlaneStats
+
+	// Leaves client stream pools empty, for tests that need to know
+	// which streams a session carries (see stream_pool.go)
+	noStreamPool bool
+
+	// Monthly traffic per user; nil without a database (see usage.go)
+	usage *usageTracker
+
+	// Active connections tracking for graceful drain (see drain.go)
+	activeConns     sync.WaitGroup
+	activeConnCount atomic.Int64
+	drainDeadline   atomic.Int64 // unix nanos; 0 until Stop starts draining
 
 	// Shutdown
 	ctx    context.Context
@@ -188,22 +229,25 @@ type Client struct {
 	Tunnels      map[string]*Tunnel
 	TunnelsMu    sync.RWMutex
 	Connected    time.Time
+	Hostname     string // as reported by the client, may be empty
 	lastPing     atomic.Int64
 
 	// Multi-session pool: additional data connections for parallelism
 	DataSessions        []*yamux.Session
 	DataConns           []net.Conn // underlying TCP connections for data sessions
 	DataMu              sync.RWMutex
-	sessionIdx          atomic.Uint32 // round-robin counter
-	SessionSecret       string        // secret for joining additional connections
-	SessionSecretExpiry time.Time     // secret valid until this time
+	sessionIdx          atomic.Uint32   // round-robin counter
+	pressure            sessionPressure // flow-control load across all sessions
+	SessionSecret       string          // secret for joining additional connections
+	SessionSecretExpiry time.Time       // secret valid until this time
 
 	// Database integration
 	UserID     int64              // 0 if legacy token
 	APITokenID int64              // 0 if legacy token
 	DBToken    *database.APIToken // nil if legacy token
 	IsAdmin    bool               // true if user is admin
-	Plan       *database.Plan     // user's plan (nil if none)
+	Plan       *database.Plan     // user's plan (nil if none), read with currentPlan once registered
+	planMu     sync.RWMutex       // guards Plan, which changes when the user's plan does
 
 	server    *Server
 	conn      net.Conn
@@ -215,6 +259,36 @@ type Client struct {
 
 	// Stream pool: pre-opened yamux streams for low-latency connection handling
 	streamPool chan net.Conn
+
+	// Per-stream compression threshold in bytes; 0 when not negotiated
+	streamCompressThreshold int
+
+	// Session resumption: non-nil once the client advertised support and
+	// the server has a resume window configured (see session_resume.go)
+	resumed     chan struct{}
+	resumeToken string // authorizes the next resume; rotated on each one
+	resumeMu    sync.Mutex
+	detached    atomic.Bool
+
+	// Control message encoding negotiated at auth (see control_encoding.go)
+	encoding protocol.Encoding
+
+	// Collects tunnel request results while a batch is being handled; only
+	// touched by the control loop (see tunnel_batch.go)
+	tunnelBatch *protocol.TunnelBatchResultMessage
+
+	// Visitor connections waiting for the client to accept them, by
+	// connection ID (see conn_confirm.go)
+	pendingConns   map[string]chan *protocol.ConnectionAcceptMessage
+	pendingConnsMu sync.Mutex
+
+	// The user's locale setting, looked up once (see history_events.go)
+	locale     string
+	localeOnce sync.Once
+
+	// Limits on the outbound connections of socks tunnels (see socks.go)
+	outbound     *outboundLimits
+	outboundOnce sync.Once
 }
 
 // Tunnel represents an active tunnel
@@ -236,9 +310,60 @@ type Tunnel struct {
 	MaxLifetime   time.Duration // max tunnel lifetime
 	LastActivity  atomic.Int64  // UnixNano timestamp
 
+	// Optional server-run health check (nil when not configured)
+	health *tunnelHealth
+
+	// Header rewriting for HTTP tunnels (nil when not configured)
+	HeaderRules *protocol.HeaderRules
+
+	// Path prefix rewriting for HTTP tunnels (see applyPathPrefix)
+	StripPathPrefix string
+	AddPathPrefix   string
+
+	// Response cache of an HTTP tunnel (nil when not enabled)
+	cache *responseCache
+
+	// Visitor connections in flight, drained when the tunnel is closed
+	conns tunnelConns
+
+	// Owning user of an HTTP tunnel, 0 without an account; decides who may
+	// share its subdomain
+	userID int64
+
+	// Bytes streamed to each connection of a sink tunnel
+	SinkBytes int64
+
+	// Send a PROXY protocol v2 header ahead of each TCP connection
+	proxyProtocol bool
+
+	// Request body limit of an HTTP tunnel in bytes, 0 for none
+	maxRequestBytes int64
+
+	// Announce each visitor connection and wait for the client to accept
+	// it before opening a stream (HTTP and TCP tunnels)
+	confirmConns bool
+
+	// Keep the tunnel's streams out of per-stream compression
+	noCompress bool
+
+	// Traffic carried for visitors: in is towards the client, out is back
+	BytesIn  atomic.Int64
+	BytesOut atomic.Int64
+
+	// Visitor packets a UDP tunnel dropped because their source is not in
+	// its allowlist
+	BlockedPackets atomic.Int64
+
+	// Monthly traffic of the owning user (nil when not tracked)
+	usage *userUsage
+
+	// Rate-limit denials already recorded in the user's history
+	throttledDenied atomic.Int64
+
 	// For TCP/UDP
 	listener net.Listener
 	udpConn  *net.UDPConn
+	udpFlows *udpFlowTable
 }
 
 // New creates a new server
@@ -250,12 +375,19 @@ func New(cfg *config.ServerConfig, log zerolog.Logger) *Server {
 		log:            log.With().Str("component", "server").Logger(),
 		clientMgr:      NewClientManager(log.With().Str("component", "server").Logger()),
 		customDomains:  make(map[string]*database.CustomDomain),
+		suspended:      make(map[string]struct{}),
 		proxyPool:      newRemoteProxyPool(),
 		trustedProxies: buildTrustedProxySet(cfg.Auth.TrustedProxies),
+		restoreKey:     restoreKey(cfg.Server.RestoreSecret, cfg.Auth.JWTSecret),
+		connLimits:     newConnLimiter(cfg.Server.MaxConnections, cfg.Server.MaxConnectionsPerIP),
+		geoPolicy:      newGeoPolicy(cfg.GeoIP.Policy),
+		socksPolicy:    newSOCKSPolicy(cfg.Server.SOCKS),
 		ctx:            ctx,
 		cancel:         cancel,
 	}
 
+	s.clientMgr.SetTunnelWarnThreshold(cfg.Server.TunnelWarnThreshold)
+
 	s.httpRouter = NewHTTPRouter(s, log)
 	s.tcpManager = NewTCPManager(s, log)
 	s.udpManager = NewUDPManager(s, log)
@@ -283,14 +415,18 @@ func New(cfg *config.ServerConfig, log zerolog.Logger) *Server {
 		maxBody = inspect.MaxBodySize
 	}
 	s.inspectMgr = inspect.NewManager(capacity, maxBody)
+	s.inspectMgr.SetRedactParams(cfg.Inspect.RedactParams)
 
 	return s
 }
 
 func (s *Server) handleMonitorAlert(alert monitor.Alert) {
+	if alert.Type == monitor.AlertRateLimit {
+		s.recordThrottled(alert)
+	}
 	if alert.Severity == monitor.SeverityCritical {
 		s.log.Error().
-			Str("tunnel", alert.TunnelID).
+			Str("tunnel_id", alert.TunnelID).
 			Str("alert", string(alert.Type)).
 			Msg("critical security alert: " + alert.Message)
 	}
@@ -299,6 +435,9 @@ func (s *Server) handleMonitorAlert(alert monitor.Alert) {
 // SetDatabase sets the database for the server
 func (s *Server) SetDatabase(db *database.Database) {
 	s.db = db
+	if db != nil {
+		s.usage = newUsageTracker(db.Usage, s.log)
+	}
 }
 
 // SetAuthService sets the auth service for JWT validation
@@ -311,6 +450,11 @@ func (s *Server) SetTunnelRegistry(r store.TunnelRegistry) {
 	s.tunnelRegistry = r
 }
 
+// SetIPBanStore makes banned IPs unable to connect as clients.
+func (s *Server) SetIPBanStore(bans store.IPBanStore) {
+	s.ipBans = bans
+}
+
 // TunnelRegistry returns the tunnel registry (may be nil).
 func (s *Server) TunnelRegistry() store.TunnelRegistry {
 	return s.tunnelRegistry
@@ -346,11 +490,18 @@ func (s *Server) SetHubClient(h HubAuthVerifier) {
 	s.hubClient = h
 }
 
-// SetGeoIP sets the GeoIP lookup for region-based edge node selection.
+// SetGeoIP sets the GeoIP lookup for region-based edge node selection and
+// the country rules of the connection policy.
 func (s *Server) SetGeoIP(g *geoip.Lookup) {
 	s.geoIP = g
 }
 
+// SetASNLookup sets the ASN lookup for the network rules of the connection
+// policy.
+func (s *Server) SetASNLookup(l *geoip.ASNLookup) {
+	s.asnLookup = l
+}
+
 // SetLocalNodeID sets this server's node identifier.
 func (s *Server) SetLocalNodeID(id string) {
 	s.localNodeID = id
@@ -449,11 +600,16 @@ func (s *Server) LookupCustomDomain(host string) *database.CustomDomain {
 	return s.customDomains[host]
 }
 
-// AddCustomDomain adds a custom domain to the in-memory cache.
+// AddCustomDomain adds a custom domain to the in-memory cache and queues a
+// verified one for the reputation check.
 func (s *Server) AddCustomDomain(d *database.CustomDomain) {
 	s.customDomainMu.Lock()
-	defer s.customDomainMu.Unlock()
 	s.customDomains[strings.ToLower(d.Domain)] = d
+	s.customDomainMu.Unlock()
+
+	if d.Verified {
+		s.reputation.check(reputationTarget{subdomain: d.TargetSubdomain, url: "https://" + d.Domain + "/", userID: d.UserID})
+	}
 }
 
 // RemoveCustomDomain removes a custom domain from the in-memory cache.
@@ -482,63 +638,62 @@ func (s *Server) InitCustomDomains() error {
 	return nil
 }
 
-// Start starts the server
-func (s *Server) Start() error {
-	// Start control plane listener
-	controlAddr := fmt.Sprintf(":%d", s.cfg.Server.ControlPort)
-	var err error
+// InitWildcardCert makes the TLS cert manager obtain and serve a wildcard
+// certificate for the base domain, publishing ACME challenges through
+// provider. It creates the cert manager if custom domains have not.
+func (s *Server) InitWildcardCert(provider fxtls.DNSProvider) error {
+	if s.db == nil {
+		return fmt.Errorf("wildcard certificate requires a database")
+	}
 
-	if s.cfg.TLS.Enabled {
-		var cert tls.Certificate
-		cert, err = tls.LoadX509KeyPair(s.cfg.TLS.CertFile, s.cfg.TLS.KeyFile)
-		if err != nil {
-			return fmt.Errorf("load TLS certificate: %w", err)
-		}
-		tlsCfg := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
-		s.controlListener, err = tls.Listen("tcp", controlAddr, tlsCfg)
-	} else {
-		s.controlListener, err = newReusePortListener(s.ctx, controlAddr)
+	if s.certManager != nil {
+		// Replace the custom-domain manager so that its renewal loop
+		// starts with the wildcard enabled
+		s.certManager.Stop()
 	}
-	if err != nil {
-		return fmt.Errorf("listen control: %w", err)
+	s.certManager = fxtls.NewCertManager(s.cfg.TLS, s.db, s.log)
+	if s.cfg.CustomDomains.Enabled {
+		if err := s.certManager.LoadFromDB(); err != nil {
+			s.log.Warn().Err(err).Msg("Failed to load TLS certs from DB")
+		}
 	}
-	s.log.Info().Str("addr", controlAddr).Msg("Control plane listening")
+	s.certManager.EnableWildcard(s.cfg.Domain.Base, provider)
+	s.certManager.StartRenewal()
 
-	// Start HTTP listener. Empty bind = all interfaces (legacy). In production
-	// it should be "127.0.0.1" so external clients can only reach the HTTP
-	// tunnel proxy through nginx (which sets X-Real-IP and terminates TLS).
-	httpAddr := fmt.Sprintf("%s:%d", s.cfg.Server.HTTPBind, s.cfg.Server.HTTPPort)
-	s.httpListener, err = newReusePortListener(s.ctx, httpAddr)
+	return nil
+}
+
+// Start binds every listener before serving on any of them, so a port that
+// is already taken fails the start with nothing left running or bound.
+func (s *Server) Start() error {
+	if err := s.bindListeners(); err != nil {
+		return err
+	}
+	accessLog, err := newAccessLogger(s.cfg.Server.AccessLog, s.log)
 	if err != nil {
-		s.controlListener.Close()
-		return fmt.Errorf("listen http: %w", err)
+		s.closeListeners()
+		return fmt.Errorf("open access log: %w", err)
 	}
-	s.log.Info().Str("addr", httpAddr).Msg("HTTP listener started")
+	s.httpRouter.accessLog = accessLog
+	s.webhooks = newWebhookEmitter(s.cfg.Server.Webhooks, s.log)
+	s.reputation = newReputationChecker(s.cfg.Server.Reputation, s.log, s.reputationMatch)
+	s.history = newHistoryRecorder(s.db, s.log)
 
-	// Start HTTPS listener for custom domains (if CertManager is available)
-	if s.certManager != nil && s.cfg.TLS.HTTPSPort > 0 {
-		httpsAddr := fmt.Sprintf(":%d", s.cfg.TLS.HTTPSPort)
-		tlsListener, err := newReusePortListener(s.ctx, httpsAddr)
-		if err != nil {
-			s.log.Warn().Err(err).Str("addr", httpsAddr).Msg("Failed to start HTTPS listener for custom domains")
-		} else {
-			s.httpsListener = tls.NewListener(tlsListener, s.certManager.TLSConfig())
-			s.httpsServer = &http.Server{
-				Handler:           s.httpRouter,
-				ReadHeaderTimeout: 10 * time.Second,
-				ReadTimeout:       30 * time.Second,
-				WriteTimeout:      60 * time.Second,
-				IdleTimeout:       120 * time.Second,
-			}
-			s.wg.Add(1)
-			go func() {
-				defer s.wg.Done()
-				if err := s.httpsServer.Serve(s.httpsListener); err != nil && err != http.ErrServerClosed {
-					s.log.Error().Err(err).Msg("HTTPS server error")
-				}
-			}()
-			s.log.Info().Str("addr", httpsAddr).Msg("HTTPS listener started for custom domains")
+	if s.httpsListener != nil {
+		s.httpsServer = &http.Server{
+			Handler:           s.httpRouter,
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       30 * time.Second,
+			WriteTimeout:      60 * time.Second,
+			IdleTimeout:       120 * time.Second,
 		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			if err := s.httpsServer.Serve(s.httpsListener); err != nil && err != http.ErrServerClosed {
+				s.log.Error().Err(err).Msg("HTTPS server error")
+			}
+		}()
 	}
 
 	// Periodic cleanup of idle auth rate limiters to prevent memory leaks
@@ -551,20 +706,30 @@ func (s *Server) Start() error {
 			select {
 			case <-ticker.C:
 				s.cleanupAuthLimiters()
+				s.cleanupReportLimiters()
 			case <-s.ctx.Done():
 				return
 			}
 		}
 	}()
 
-	// Additional TLS control listeners (DPI-resilient HTTPS-looking endpoint,
-	// e.g. a second IP on :443). Optional; legacy plaintext 4443 keeps running.
-	if s.cfg.Server.ControlTLS.Enabled {
-		if err := s.startControlTLSListeners(); err != nil {
-			s.controlListener.Close()
-			s.httpListener.Close()
-			return fmt.Errorf("listen control tls: %w", err)
-		}
+	if s.usage != nil {
+		s.wg.Add(1)
+		go s.runUsageFlusher()
+	}
+
+	if s.db != nil {
+		s.wg.Add(2)
+		go s.runReservedRefresher()
+		go s.runSuspensionSync()
+	}
+
+	if s.ticketKeys != nil {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.ticketKeys.Watch(s.ctx, time.Minute)
+		}()
 	}
 
 	// Accept control connections (plaintext + any TLS listeners)
@@ -594,6 +759,121 @@ func (s *Server) Start() error {
 	return nil
 }
 
+// bindListeners opens the control, HTTP, HTTPS and control TLS listeners
+// without serving on them. On failure every listener opened so far is
+// closed again.
+func (s *Server) bindListeners() (err error) {
+	defer func() {
+		if err != nil {
+			s.closeListeners()
+		}
+	}()
+
+	// Load certificates and session ticket keys before binding anything.
+	s.ticketKeys, err = fxtls.NewSessionTicketKeys(s.cfg.TLS, s.log)
+	if err != nil {
+		return fmt.Errorf("load session ticket keys: %w", err)
+	}
+	var controlTLS *tls.Config
+	if s.cfg.TLS.Enabled {
+		if s.cfg.TLS.CertFile == "" && s.certManager != nil {
+			// No static certificate: serve the ACME-issued ones
+			controlTLS = &tls.Config{GetCertificate: s.certManager.GetCertificate, MinVersion: tls.VersionTLS12}
+		} else {
+			cert, err := tls.LoadX509KeyPair(s.cfg.TLS.CertFile, s.cfg.TLS.KeyFile)
+			if err != nil {
+				return fmt.Errorf("load TLS certificate: %w", err)
+			}
+			controlTLS = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+		}
+	}
+
+	// Control plane listener
+	controlAddr := fmt.Sprintf(":%d", s.cfg.Server.ControlPort)
+	s.controlListener, err = newTCPListener(s.ctx, controlAddr, s.cfg.Server.Listener)
+	if err != nil {
+		return listenError("control", controlAddr, err)
+	}
+	if controlTLS != nil {
+		s.ticketKeys.Apply(controlTLS)
+		s.controlListener = tls.NewListener(s.controlListener, controlTLS)
+	}
+	s.log.Info().Str("addr", controlAddr).Msg("Control plane listening")
+
+	// HTTP listener. Empty bind = all interfaces (legacy). In production
+	// it should be "127.0.0.1" so external clients can only reach the HTTP
+	// tunnel proxy through nginx (which sets X-Real-IP and terminates TLS).
+	httpAddr := fmt.Sprintf("%s:%d", s.cfg.Server.HTTPBind, s.cfg.Server.HTTPPort)
+	s.httpListener, err = newTCPListener(s.ctx, httpAddr, s.cfg.Server.Listener)
+	if err != nil {
+		return listenError("http", httpAddr, err)
+	}
+	s.log.Info().Str("addr", httpAddr).Msg("HTTP listener started")
+
+	// HTTPS listener for custom domains (if CertManager is available). It is
+	// optional: failing to bind it only disables custom-domain HTTPS.
+	if s.certManager != nil && s.cfg.TLS.HTTPSPort > 0 {
+		httpsAddr := fmt.Sprintf(":%d", s.cfg.TLS.HTTPSPort)
+		tlsListener, err := newTCPListener(s.ctx, httpsAddr, s.cfg.Server.Listener)
+		if err != nil {
+			s.log.Warn().Err(listenError("https", httpsAddr, err)).Msg("Failed to start HTTPS listener for custom domains")
+		} else {
+			httpsTLS := s.certManager.TLSConfig()
+			s.ticketKeys.Apply(httpsTLS)
+			s.httpsListener = tls.NewListener(tlsListener, httpsTLS)
+			s.log.Info().Str("addr", httpsAddr).Msg("HTTPS listener started for custom domains")
+		}
+	}
+
+	// Additional TLS control listeners (DPI-resilient HTTPS-looking endpoint,
+	// e.g. a second IP on :443). Optional; legacy plaintext 4443 keeps running.
+	if s.cfg.Server.ControlTLS.Enabled {
+		if err := s.startControlTLSListeners(); err != nil {
+			return fmt.Errorf("listen control tls: %w", err)
+		}
+	}
+	return nil
+}
+
+// closeListeners closes and forgets every listener bindListeners opened.
+func (s *Server) closeListeners() {
+	if s.controlListener != nil {
+		s.controlListener.Close()
+		s.controlListener = nil
+	}
+	if s.httpListener != nil {
+		s.httpListener.Close()
+		s.httpListener = nil
+	}
+	if s.httpsListener != nil {
+		s.httpsListener.Close()
+		s.httpsListener = nil
+	}
+	for _, l := range s.controlTLSListeners {
+		l.Close()
+	}
+	s.controlTLSListeners = nil
+}
+
+// listenError turns a bind failure into an error naming the listener, with
+// a plain "port in use" message for the common EADDRINUSE case.
+func listenError(name, addr string, err error) error {
+	if errors.Is(err, syscall.EADDRINUSE) {
+		return fmt.Errorf("listen %s: port %s already in use: %w", name, addr, err)
+	}
+	return fmt.Errorf("listen %s %s: %w", name, addr, err)
+}
+
+// CheckPortAvailable reports whether addr can be bound right now. It is a
+// pre-flight check for listeners started outside Start, such as the web API.
+func CheckPortAvailable(name, addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return listenError(name, addr, err)
+	}
+	return l.Close()
+}
+
 // Stop stops the server gracefully
 func (s *Server) Stop() error {
 	s.log.Info().Msg("Shutting down server...")
@@ -614,6 +894,7 @@ func (s *Server) Stop() error {
 
 	// Phase 2: drain in-flight connections (max 10s)
 	s.log.Info().Msg("Draining active connections...")
+	s.drainDeadline.Store(time.Now().Add(drainTimeout).UnixNano())
 	drainCtx, drainCancel := context.WithTimeout(context.Background(), drainTimeout)
 	defer drainCancel()
 
@@ -629,17 +910,7 @@ func (s *Server) Stop() error {
 		}
 	}
 
-	drainDone := make(chan struct{})
-	go func() {
-		s.activeConns.Wait()
-		close(drainDone)
-	}()
-	select {
-	case <-drainDone:
-		s.log.Info().Msg("All connections drained")
-	case <-drainCtx.Done():
-		s.log.Warn().Msg("Drain timeout, forcing shutdown")
-	}
+	s.waitDrain(drainCtx)
 
 	// Phase 3: notify clients and gracefully close sessions
 	clients := s.clientMgr.allClients()
@@ -651,10 +922,10 @@ func (s *Server) Stop() error {
 			Reason:  "server shutting down",
 		}
 		_ = c.sendControl(shutdownMsg)
+		c.DataMu.RLock()
 		if c.Session != nil {
 			_ = c.Session.GoAway()
 		}
-		c.DataMu.RLock()
 		for _, ds := range c.DataSessions {
 			_ = ds.GoAway()
 		}
@@ -684,6 +955,11 @@ func (s *Server) Stop() error {
 	}
 
 	s.wg.Wait()
+	s.flushUsage()
+	s.httpRouter.accessLog.close()
+	s.webhooks.close()
+	s.reputation.close()
+	s.history.close()
 	s.log.Info().Msg("Server stopped")
 	return nil
 }
@@ -698,18 +974,19 @@ func (s *Server) startControlTLSListeners() error {
 		return fmt.Errorf("load control TLS certificate: %w", err)
 	}
 	tlsCfg := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	s.ticketKeys.Apply(tlsCfg)
 
 	for _, addr := range s.cfg.Server.ControlTLS.Listen {
-		l, err := tls.Listen("tcp", addr, tlsCfg)
+		l, err := newTCPListener(s.ctx, addr, s.cfg.Server.Listener)
 		if err != nil {
 			// Close any TLS listeners already opened before failing.
 			for _, opened := range s.controlTLSListeners {
 				opened.Close()
 			}
 			s.controlTLSListeners = nil
-			return fmt.Errorf("listen %s: %w", addr, err)
+			return listenError("control tls", addr, err)
 		}
-		s.controlTLSListeners = append(s.controlTLSListeners, l)
+		s.controlTLSListeners = append(s.controlTLSListeners, tls.NewListener(l, tlsCfg))
 		s.log.Info().Str("addr", addr).Msg("Control plane TLS listening")
 	}
 	return nil
@@ -746,19 +1023,30 @@ func (s *Server) handleControlConnection(conn net.Conn) {
 	tuneTCPConn(conn)
 
 	remoteAddr := conn.RemoteAddr().String()
-	log := s.log.With().Str("remote", remoteAddr).Logger()
+	ip := logging.RemoteIP(remoteAddr)
+	log := s.log.With().Str("remote_ip", ip).Logger()
 	log.Debug().Msg("New control connection")
 
+	admitted, reason, ok := s.admitControlConnection(conn, ip)
+	if !ok {
+		s.rejectControlConnection(conn, reason, log)
+		return
+	}
+	conn = admitted
+
 	// Negotiate compression before yamux
-	rwc, compressed, err := protocol.NegotiateCompression(conn, s.cfg.Server.CompressionEnabled, true)
+	start := time.Now()
+	rwc, compression, err := protocol.NegotiateCompression(conn, s.cfg.Server.CompressionOffer(), true)
 	if err != nil {
 		log.Error().Err(err).Msg("Compression negotiation failed")
 		conn.Close()
 		return
 	}
-	if compressed {
-		log.Debug().Msg("Compression enabled (zstd)")
-	}
+	s.stats.negotiated(compression)
+	log.Debug().
+		Str("compression", compression.String()).
+		Dur("handshake", time.Since(start)).
+		Msg("Compression negotiated")
 
 	// Create yamux session FIRST (server mode) with optimized config
 	yamuxCfg := yamux.DefaultConfig()
@@ -783,6 +1071,7 @@ func (s *Server) handleControlConnection(conn net.Conn) {
 
 	// Create codec for the control stream
 	codec := protocol.NewCodec(controlStream, controlStream)
+	codec.SetMaxMessageSize(s.cfg.Server.MaxMessageSize)
 
 	// Wait for authentication with timeout
 	_ = controlStream.SetReadDeadline(time.Now().Add(authTimeout))
@@ -791,6 +1080,9 @@ func (s *Server) handleControlConnection(conn net.Conn) {
 	data, baseMsg, err := codec.DecodeRaw()
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to read auth message")
+		if protocol.IsFrameError(err) {
+			s.sendError(codec, protocol.ErrCodeProtocolError, err.Error(), true)
+		}
 		session.Close()
 		return
 	}
@@ -803,10 +1095,22 @@ func (s *Server) handleControlConnection(conn net.Conn) {
 		s.handleJoinSession(conn, session, controlStream, codec, data, log)
 		return
 
+	case protocol.MsgResumeSession:
+		// Replacement control connection for a client that lost its own
+		s.handleResumeSession(conn, session, controlStream, codec, data, log)
+		return
+
 	case protocol.MsgAuth:
 		// Rate limit only actual auth attempts (not data connections / JoinSession)
 		if !s.allowAuth(remoteAddr) {
+			s.stats.reject(rejectAuthRateLimit)
 			log.Warn().Msg("Auth rate limited")
+			_ = codec.Encode(&protocol.AuthResultMessage{
+				Message: protocol.NewMessage(protocol.MsgAuthResult),
+				Success: false,
+				Error:   "too many authentication attempts, try again later",
+				Code:    protocol.ErrCodeRateLimited,
+			})
 			session.Close()
 			return
 		}
@@ -851,7 +1155,19 @@ func (s *Server) handleControlConnection(conn net.Conn) {
 		}
 
 		log = log.With().Str("client_id", client.ID).Logger()
-		log.Info().Msg("Client authenticated")
+		log.Info().Str("encoding", string(client.encoding)).Msg("Client authenticated")
+
+		// Per-stream compression only pays off when the connection itself is
+		// not already compressed.
+		if authMsg.StreamCompression && compression == protocol.CompressionNone && s.cfg.Server.StreamCompressionThreshold > 0 {
+			client.streamCompressThreshold = s.cfg.Server.StreamCompressionThreshold
+			log.Debug().Int("threshold", client.streamCompressThreshold).Msg("Per-stream compression enabled")
+		}
+
+		if authMsg.ReconnectAttempt > 0 {
+			client.recordHistoryEvent(database.HistoryEventReconnect, "", 0, "",
+				fmt.Sprintf("reconnected after %d attempt(s)", authMsg.ReconnectAttempt))
+		}
 
 		// Handle client messages
 		client.handle()
@@ -872,6 +1188,20 @@ func (s *Server) handleJoinSession(conn net.Conn, session *yamux.Session, contro
 	}
 	joinMsg := parsed.(*protocol.JoinSessionMessage)
 
+	if s.cfg.Server.DisableDataSessions {
+		// Only clients that authenticated before the switch get this far
+		log.Debug().Str("client_id", joinMsg.ClientID).Msg("Join session refused: data sessions are disabled")
+		result := &protocol.JoinSessionResult{
+			Message: protocol.NewMessage(protocol.MsgJoinSessionResult),
+			Success: false,
+			Error:   "data sessions are disabled",
+			Code:    protocol.ErrCodeDataSessionsDisabled,
+		}
+		_ = codec.Encode(result)
+		session.Close()
+		return
+	}
+
 	client := s.findClientBySecret(joinMsg.ClientID, joinMsg.Secret)
 	if client == nil {
 		log.Warn().Str("client_id", joinMsg.ClientID).Msg("Join session failed: invalid client or secret")
@@ -888,8 +1218,8 @@ func (s *Server) handleJoinSession(conn net.Conn, session *yamux.Session, contro
 	// Enforce data session limit
 	client.DataMu.Lock()
 	maxDS := 0 // unlimited by default
-	if client.Plan != nil && !IsUnlimited(client.Plan.MaxDataSessions) {
-		maxDS = client.Plan.MaxDataSessions
+	if plan := client.currentPlan(); plan != nil && !IsUnlimited(plan.MaxDataSessions) {
+		maxDS = plan.MaxDataSessions
 		if maxDS == 0 {
 			maxDS = defaultMaxDataSessions
 		}
@@ -912,6 +1242,12 @@ func (s *Server) handleJoinSession(conn net.Conn, session *yamux.Session, contro
 	dataCount := len(client.DataSessions)
 	client.DataMu.Unlock()
 
+	// Data streams move off the primary session once a data session exists;
+	// streams pre-opened on it would keep carrying data next to control
+	if dataCount == 1 {
+		client.drainStreamPool()
+	}
+
 	// Send success
 	result := &protocol.JoinSessionResult{
 		Message: protocol.NewMessage(protocol.MsgJoinSessionResult),
@@ -930,8 +1266,7 @@ func (s *Server) findClientBySecret(clientID, secret string) *Client {
 	if client == nil {
 		return nil
 	}
-	if client.SessionSecret == "" ||
-		subtle.ConstantTimeCompare([]byte(client.SessionSecret), []byte(secret)) != 1 {
+	if !client.secretMatches(secret) {
 		return nil
 	}
 	// Check session secret TTL
@@ -941,6 +1276,12 @@ func (s *Server) findClientBySecret(clientID, secret string) *Client {
 	return client
 }
 
+// secretMatches reports whether secret is this client's session secret.
+func (c *Client) secretMatches(secret string) bool {
+	return c.SessionSecret != "" &&
+		subtle.ConstantTimeCompare([]byte(c.SessionSecret), []byte(secret)) == 1
+}
+
 func (s *Server) removeClient(clientID string) {
 	s.clientMgr.removeClient(clientID)
 }
@@ -992,6 +1333,12 @@ func (c *Client) handle() {
 	// Start keepalive
 	go c.keepalive()
 
+	// Take the streams of socks tunnels, which the client opens
+	if c.server.cfg.Server.SOCKS.Enabled {
+		go c.acceptOutbound(c.Session)
+	}
+
+	codec := c.controlCodec()
 	for {
 		select {
 		case <-c.ctx.Done():
@@ -999,10 +1346,20 @@ func (c *Client) handle() {
 		default:
 		}
 
-		data, baseMsg, err := c.ControlCodec.DecodeRaw()
+		data, baseMsg, err := codec.DecodeRaw()
 		if err != nil {
-			c.log.Debug().Err(err).Msg("Read error, closing client")
-			return
+			// A malformed frame leaves the stream out of sync: never resume
+			if protocol.IsFrameError(err) {
+				c.log.Warn().Err(err).Msg("Protocol violation, closing client")
+				c.server.sendError(codec, protocol.ErrCodeProtocolError, err.Error(), true)
+				return
+			}
+			if !c.awaitResume(codec) {
+				c.log.Debug().Err(err).Msg("Read error, closing client")
+				return
+			}
+			codec = c.controlCodec()
+			continue
 		}
 
 		c.lastPing.Store(time.Now().UnixNano())
@@ -1010,6 +1367,8 @@ func (c *Client) handle() {
 		switch baseMsg.Type {
 		case protocol.MsgTunnelRequest:
 			c.handleTunnelRequest(data)
+		case protocol.MsgTunnelBatchRequest:
+			c.handleTunnelBatchRequest(data)
 		case protocol.MsgTunnelClose:
 			c.handleTunnelClose(data)
 		case protocol.MsgConnectionAccept:
@@ -1018,20 +1377,48 @@ func (c *Client) handle() {
 			c.handlePing()
 		case protocol.MsgPong:
 			// Keepalive response, just update LastPing (already done above)
+		case protocol.MsgClientShutdown:
+			// A deliberate close is not a dropped connection: skip the
+			// resume window so the subdomains and ports are free again
+			c.log.Info().Msg("Client closed the session")
+			return
 		default:
-			c.log.Warn().Str("type", string(baseMsg.Type)).Msg("Unknown message type")
+			if !c.handleUnknownMessage(codec, baseMsg.Type) {
+				return
+			}
 		}
 	}
 }
 
+// handleUnknownMessage applies server.unknown_messages to a control message
+// of an unknown type. It returns false when the client must be disconnected.
+func (c *Client) handleUnknownMessage(codec *protocol.Codec, msgType protocol.MessageType) bool {
+	switch c.server.cfg.Server.UnknownMessages {
+	case config.UnknownMessagesIgnore:
+		c.log.Debug().Str("type", string(msgType)).Msg("Ignoring unknown message type")
+	case config.UnknownMessagesDisconnect:
+		c.log.Warn().Str("type", string(msgType)).Msg("Unknown message type, closing client")
+		c.server.sendError(codec, protocol.ErrCodeProtocolError,
+			fmt.Sprintf("unknown message type: %s", msgType), true)
+		return false
+	default:
+		c.log.Warn().Str("type", string(msgType)).Msg("Unknown message type")
+	}
+	return true
+}
+
 func (c *Client) handleTunnelRequest(data []byte) {
-	parsed, err := protocol.ParseMessage(data, protocol.MsgTunnelRequest)
+	parsed, err := c.encoding.ParseMessage(data, protocol.MsgTunnelRequest)
 	if err != nil {
 		c.log.Error().Err(err).Msg("Failed to parse tunnel request")
 		return
 	}
-	req := parsed.(*protocol.TunnelRequestMessage)
+	c.createTunnel(parsed.(*protocol.TunnelRequestMessage))
+}
 
+// createTunnel checks the limits and creates the requested tunnel. The
+// result goes back to the client through replyTunnel.
+func (c *Client) createTunnel(req *protocol.TunnelRequestMessage) {
 	// Serialize tunnel creation per user to prevent race condition on count check
 	if c.UserID > 0 {
 		mu := c.server.clientMgr.GetTunnelCreateMu(c.UserID)
@@ -1041,11 +1428,11 @@ func (c *Client) handleTunnelRequest(data []byte) {
 
 	// Global limit from plan
 	globalMax := defaultMaxTunnels
-	if c.Plan != nil {
-		if IsUnlimited(c.Plan.MaxTunnels) {
+	if plan := c.currentPlan(); plan != nil {
+		if IsUnlimited(plan.MaxTunnels) {
 			globalMax = 0 // no global limit
 		} else {
-			globalMax = c.Plan.MaxTunnels
+			globalMax = plan.MaxTunnels
 		}
 	}
 
@@ -1068,7 +1455,7 @@ func (c *Client) handleTunnelRequest(data []byte) {
 	}
 
 	if globalMax > 0 && tunnelCount >= globalMax {
-		c.sendTunnelError(req.RequestID, "", protocol.ErrCodeTunnelLimit, "tunnel limit reached")
+		c.rejectTunnel(req, protocol.ErrCodeTunnelLimit, "tunnel limit reached")
 		return
 	}
 
@@ -1078,56 +1465,97 @@ func (c *Client) handleTunnelRequest(data []byte) {
 		clientTunnels := len(c.Tunnels)
 		c.TunnelsMu.RUnlock()
 		if clientTunnels >= tokenMax {
-			c.sendTunnelError(req.RequestID, "", protocol.ErrCodeTunnelLimit, "token tunnel limit reached")
+			c.rejectTunnel(req, protocol.ErrCodeTunnelLimit, "token tunnel limit reached")
 			return
 		}
 	}
 
+	if c.quotaExceeded(c.tunnelUsage()) {
+		c.rejectTunnel(req, protocol.ErrCodeQuotaExceeded, "monthly traffic quota exceeded")
+		return
+	}
+
+	// A restore asks for the address the tunnel had before the client lost
+	// its session, typically to a server restart
+	restore := c.applyRestoreToken(req)
+
 	switch req.TunnelType {
 	case protocol.TunnelHTTP:
-		c.createHTTPTunnel(req)
+		c.createHTTPTunnel(req, restore)
 	case protocol.TunnelTCP:
-		c.createTCPTunnel(req)
+		c.createTCPTunnel(req, restore)
 	case protocol.TunnelUDP:
 		// Gate UDP behind the plan flag — Free has udp_enabled=false.
 		// Admins (no plan, or unlimited) are allowed unconditionally.
-		if c.Plan != nil && !c.Plan.UDPEnabled {
-			c.sendTunnelError(req.RequestID, "", protocol.ErrCodePlanLimit,
+		if plan := c.currentPlan(); plan != nil && !plan.UDPEnabled {
+			c.rejectTunnel(req, protocol.ErrCodePlanLimit,
 				"UDP tunnels are not available on your plan — upgrade to enable UDP")
 			return
 		}
-		c.createUDPTunnel(req)
+		c.createUDPTunnel(req, restore)
+	case protocol.TunnelSink:
+		if !c.IsAdmin {
+			c.rejectTunnel(req, protocol.ErrCodePermissionDenied, "sink tunnels are admin-only")
+			return
+		}
+		if req.SinkBytes < 0 {
+			c.rejectTunnel(req, protocol.ErrCodeProtocolError, "sink_bytes must not be negative")
+			return
+		}
+		c.createTCPTunnel(req, restore)
+	case protocol.TunnelSOCKS:
+		// Socks tunnels dial out from the server's address, so plans opt in
+		// with socks_enabled. Admins (no plan) are allowed unconditionally.
+		if plan := c.currentPlan(); plan != nil && !plan.SOCKSEnabled {
+			c.rejectTunnel(req, protocol.ErrCodePlanLimit,
+				"socks tunnels are not available on your plan")
+			return
+		}
+		c.createSOCKSTunnel(req)
 	default:
-		c.sendTunnelError(req.RequestID, "", protocol.ErrCodeProtocolError, "unknown tunnel type")
+		c.rejectTunnel(req, protocol.ErrCodeProtocolError, "unknown tunnel type")
+		return
 	}
 }
 
-func (c *Client) createHTTPTunnel(req *protocol.TunnelRequestMessage) {
+func (c *Client) createHTTPTunnel(req *protocol.TunnelRequestMessage, restore bool) {
 	subdomain := req.Subdomain
-	subdomain = strings.ToLower(subdomain)
+	if subdomain != "" {
+		normalized, err := config.NormalizeSubdomain(subdomain)
+		if err != nil {
+			c.rejectTunnel(req, protocol.ErrCodeSubdomainInvalid, err.Error())
+			return
+		}
+		subdomain = normalized
+	}
+	addressChanged := false
+	if restore && subdomain != "" && !c.subdomainFree(subdomain) {
+		c.log.Info().Str("subdomain", subdomain).Msg("Previous subdomain taken, restoring tunnel with a new one")
+		subdomain = ""
+		addressChanged = true
+	}
 	if subdomain == "" {
 		subdomain = c.server.generateUniqueSubdomain()
 	}
 
-	// Validate subdomain format
-	if !subdomainRegex.MatchString(subdomain) {
-		c.sendTunnelError(req.RequestID, "", protocol.ErrCodeSubdomainInvalid, "invalid subdomain format")
+	// Block subdomains serving the dashboard in unified mode
+	if c.server.httpRouter.dashboardHandler(subdomain+"."+c.server.cfg.Domain.Base) != nil {
+		c.rejectTunnel(req, protocol.ErrCodeSubdomainInvalid, "subdomain is reserved")
 		return
 	}
 
-	// Block reserved subdomains
-	if reservedSubdomains[subdomain] {
-		c.sendTunnelError(req.RequestID, "", protocol.ErrCodeSubdomainInvalid, "subdomain is reserved")
+	if c.server.isSuspended(subdomain) {
+		c.rejectTunnel(req, protocol.ErrCodeSubdomainSuspended, "subdomain is suspended for abuse")
 		return
 	}
 
 	// Check subdomain permission
 	if c.Token != nil && !c.Token.CanUseSubdomain(subdomain) {
-		c.sendTunnelError(req.RequestID, "", protocol.ErrCodePermissionDenied, "subdomain not allowed")
+		c.rejectTunnel(req, protocol.ErrCodePermissionDenied, "subdomain not allowed")
 		return
 	}
 	if c.DBToken != nil && !c.DBToken.CanUseSubdomain(subdomain) {
-		c.sendTunnelError(req.RequestID, "", protocol.ErrCodePermissionDenied, "subdomain not allowed by token")
+		c.rejectTunnel(req, protocol.ErrCodePermissionDenied, "subdomain not allowed by token")
 		return
 	}
 
@@ -1136,7 +1564,7 @@ func (c *Client) createHTTPTunnel(req *protocol.TunnelRequestMessage) {
 		owned, _ := c.server.db.Domains.IsOwnedByUser(subdomain, c.UserID)
 		available, _ := c.server.db.Domains.IsAvailable(subdomain)
 		if !available && !owned {
-			c.sendTunnelError(req.RequestID, "", protocol.ErrCodeSubdomainTaken, "subdomain is reserved by another user")
+			c.rejectTunnel(req, protocol.ErrCodeSubdomainTaken, "subdomain is reserved by another user")
 			return
 		}
 	}
@@ -1152,13 +1580,15 @@ func (c *Client) createHTTPTunnel(req *protocol.TunnelRequestMessage) {
 		LocalPort:     req.LocalPort,
 		Created:       time.Now(),
 		BasicAuthHash: req.BasicAuthHash,
+		usage:         c.tunnelUsage(),
+		userID:        c.UserID,
 	}
 
 	// Parse IP allowlist
 	if len(req.AllowIPs) > 0 {
 		ips, nets, err := parseAllowIPs(req.AllowIPs)
 		if err != nil {
-			c.sendTunnelError(req.RequestID, "", protocol.ErrCodeProtocolError, fmt.Sprintf("invalid allow_ips: %v", err))
+			c.rejectTunnel(req, protocol.ErrCodeProtocolError, fmt.Sprintf("invalid allow_ips: %v", err))
 			return
 		}
 		tunnel.AllowedIPs = ips
@@ -1169,7 +1599,7 @@ func (c *Client) createHTTPTunnel(req *protocol.TunnelRequestMessage) {
 	if req.AutoClose != "" {
 		d, err := parseTunnelDuration(req.AutoClose)
 		if err != nil {
-			c.sendTunnelError(req.RequestID, "", protocol.ErrCodeProtocolError, fmt.Sprintf("invalid auto_close: %v", err))
+			c.rejectTunnel(req, protocol.ErrCodeProtocolError, fmt.Sprintf("invalid auto_close: %v", err))
 			return
 		}
 		tunnel.AutoClose = d
@@ -1179,20 +1609,68 @@ func (c *Client) createHTTPTunnel(req *protocol.TunnelRequestMessage) {
 	if req.MaxLifetime != "" {
 		d, err := parseTunnelDuration(req.MaxLifetime)
 		if err != nil {
-			c.sendTunnelError(req.RequestID, "", protocol.ErrCodeProtocolError, fmt.Sprintf("invalid max_lifetime: %v", err))
+			c.rejectTunnel(req, protocol.ErrCodeProtocolError, fmt.Sprintf("invalid max_lifetime: %v", err))
 			return
 		}
 		tunnel.MaxLifetime = d
 	}
 
+	health, err := parseHealthCheck(protocol.TunnelHTTP, req.HealthCheck, req.HealthCheckInterval)
+	if err != nil {
+		c.rejectTunnel(req, protocol.ErrCodeProtocolError, fmt.Sprintf("invalid health_check: %v", err))
+		return
+	}
+	tunnel.health = health
+
+	capture, err := inspect.ParseCaptureMode(req.Capture)
+	if err != nil {
+		c.rejectTunnel(req, protocol.ErrCodeProtocolError, fmt.Sprintf("invalid capture: %v", err))
+		return
+	}
+
+	if err := req.HeaderRules.Validate(); err != nil {
+		c.rejectTunnel(req, protocol.ErrCodeProtocolError, fmt.Sprintf("invalid header_rules: %v", err))
+		return
+	}
+	if !req.HeaderRules.Empty() {
+		tunnel.HeaderRules = req.HeaderRules
+	}
+
+	for name, prefix := range map[string]string{"strip_path_prefix": req.StripPathPrefix, "add_path_prefix": req.AddPathPrefix} {
+		if err := protocol.ValidatePathPrefix(prefix); err != nil {
+			c.rejectTunnel(req, protocol.ErrCodeProtocolError, fmt.Sprintf("invalid %s: %v", name, err))
+			return
+		}
+	}
+	tunnel.StripPathPrefix = req.StripPathPrefix
+	tunnel.AddPathPrefix = req.AddPathPrefix
+	tunnel.maxRequestBytes = requestLimit(c.server.cfg.Server.MaxRequestBytes, req.MaxRequestBytes)
+	tunnel.confirmConns = req.ConfirmConnections
+	tunnel.noCompress = c.server.skipsCompression(req)
+
+	if req.Cache {
+		if limit := c.server.cfg.Server.TunnelCacheMaxSize; limit > 0 {
+			size := req.CacheMaxSize
+			if size <= 0 || size > limit {
+				size = limit
+			}
+			tunnel.cache = newResponseCache(size)
+		}
+	}
+
 	// Initialize LastActivity to creation time
 	tunnel.LastActivity.Store(time.Now().UnixNano())
 
-	c.server.inspectMgr.GetOrCreateWithUser(tunnelID, c.UserID)
+	inspectEntries := 0 // server default
+	if plan := c.currentPlan(); plan != nil {
+		inspectEntries = plan.InspectMaxEntries
+	}
+	c.server.inspectMgr.GetOrCreateWithUser(tunnelID, c.UserID, inspectEntries)
+	c.server.inspectMgr.SetCaptureMode(tunnelID, capture)
 
 	if err := c.server.httpRouter.RegisterTunnel(subdomain, tunnel); err != nil {
 		c.server.inspectMgr.Remove(tunnelID)
-		c.sendTunnelError(req.RequestID, "", protocol.ErrCodeSubdomainTaken, err.Error())
+		c.rejectTunnel(req, protocol.ErrCodeSubdomainTaken, err.Error())
 		return
 	}
 
@@ -1201,6 +1679,9 @@ func (c *Client) createHTTPTunnel(req *protocol.TunnelRequestMessage) {
 	c.TunnelsMu.Unlock()
 
 	c.registerTunnelMonitor(tunnel)
+	if tunnel.health != nil {
+		go c.runHealthChecks(tunnel)
+	}
 
 	url := fmt.Sprintf("http://%s.%s", subdomain, c.server.cfg.Domain.Base)
 	httpsURL := fmt.Sprintf("https://%s.%s", subdomain, c.server.cfg.Domain.Base)
@@ -1217,26 +1698,36 @@ func (c *Client) createHTTPTunnel(req *protocol.TunnelRequestMessage) {
 		AllowIPsCount:    len(tunnel.AllowedIPs) + len(tunnel.AllowedNets),
 		AutoClose:        req.AutoClose,
 		MaxLifetime:      req.MaxLifetime,
+		AddressChanged:   addressChanged,
 	}
 	resp.RequestID = req.RequestID
 
-	_ = c.sendControl(resp)
+	c.replyTunnel(resp)
 	c.log.Info().Str("tunnel_id", tunnelID).Str("url", url).Msg("HTTP tunnel created")
 	c.registerTunnelInRegistry(tunnel)
+	c.emitTunnelEvent(config.WebhookTunnelCreated, tunnel, "")
+	c.server.clientMgr.checkTunnelCount(c.UserID)
+	c.checkTunnelReputation(tunnel)
 	c.notifyFirstTunnel("HTTP", url)
 }
 
-func (c *Client) createTCPTunnel(req *protocol.TunnelRequestMessage) {
+func (c *Client) createTCPTunnel(req *protocol.TunnelRequestMessage, restore bool) {
 	// SSRF prevention: block sensitive ports for non-admin users
 	if portBlocked(req.RemotePort, c.IsAdmin, blockedTCPPorts) {
-		c.sendTunnelError(req.RequestID, "", protocol.ErrCodePortUnavailable,
+		c.rejectTunnel(req, protocol.ErrCodePortUnavailable,
 			fmt.Sprintf("port %d is blocked for security reasons", req.RemotePort))
 		return
 	}
 
 	port, listener, err := c.server.tcpManager.AllocatePort(req.RemotePort)
+	addressChanged := false
+	if err != nil && restore && req.RemotePort != 0 {
+		c.log.Info().Err(err).Int("port", req.RemotePort).Msg("Previous port unavailable, restoring tunnel on a new one")
+		port, listener, err = c.server.tcpManager.AllocatePort(0)
+		addressChanged = true
+	}
 	if err != nil {
-		c.sendTunnelError(req.RequestID, "", protocol.ErrCodePortUnavailable, err.Error())
+		c.rejectTunnel(req, protocol.ErrCodePortUnavailable, err.Error())
 		return
 	}
 
@@ -1244,12 +1735,18 @@ func (c *Client) createTCPTunnel(req *protocol.TunnelRequestMessage) {
 	tunnel := &Tunnel{
 		ID:         tunnelID,
 		ClientID:   c.ID,
-		Type:       protocol.TunnelTCP,
+		Type:       req.TunnelType, // TCP or sink
 		Name:       req.Name,
 		RemotePort: port,
 		LocalPort:  req.LocalPort,
 		Created:    time.Now(),
+		SinkBytes:  req.SinkBytes,
 		listener:   listener,
+		usage:      c.tunnelUsage(),
+
+		proxyProtocol: req.ProxyProtocol && req.TunnelType == protocol.TunnelTCP,
+		confirmConns:  req.ConfirmConnections && req.TunnelType == protocol.TunnelTCP,
+		noCompress:    c.server.skipsCompression(req),
 	}
 
 	// Parse IP allowlist
@@ -1257,7 +1754,7 @@ func (c *Client) createTCPTunnel(req *protocol.TunnelRequestMessage) {
 		ips, nets, err := parseAllowIPs(req.AllowIPs)
 		if err != nil {
 			listener.Close()
-			c.sendTunnelError(req.RequestID, "", protocol.ErrCodeProtocolError, fmt.Sprintf("invalid allow_ips: %v", err))
+			c.rejectTunnel(req, protocol.ErrCodeProtocolError, fmt.Sprintf("invalid allow_ips: %v", err))
 			return
 		}
 		tunnel.AllowedIPs = ips
@@ -1269,7 +1766,7 @@ func (c *Client) createTCPTunnel(req *protocol.TunnelRequestMessage) {
 		d, err := parseTunnelDuration(req.AutoClose)
 		if err != nil {
 			listener.Close()
-			c.sendTunnelError(req.RequestID, "", protocol.ErrCodeProtocolError, fmt.Sprintf("invalid auto_close: %v", err))
+			c.rejectTunnel(req, protocol.ErrCodeProtocolError, fmt.Sprintf("invalid auto_close: %v", err))
 			return
 		}
 		tunnel.AutoClose = d
@@ -1280,12 +1777,20 @@ func (c *Client) createTCPTunnel(req *protocol.TunnelRequestMessage) {
 		d, err := parseTunnelDuration(req.MaxLifetime)
 		if err != nil {
 			listener.Close()
-			c.sendTunnelError(req.RequestID, "", protocol.ErrCodeProtocolError, fmt.Sprintf("invalid max_lifetime: %v", err))
+			c.rejectTunnel(req, protocol.ErrCodeProtocolError, fmt.Sprintf("invalid max_lifetime: %v", err))
 			return
 		}
 		tunnel.MaxLifetime = d
 	}
 
+	health, err := parseHealthCheck(tunnel.Type, req.HealthCheck, req.HealthCheckInterval)
+	if err != nil {
+		listener.Close()
+		c.rejectTunnel(req, protocol.ErrCodeProtocolError, fmt.Sprintf("invalid health_check: %v", err))
+		return
+	}
+	tunnel.health = health
+
 	// Initialize LastActivity to creation time
 	tunnel.LastActivity.Store(time.Now().UnixNano())
 
@@ -1294,6 +1799,9 @@ func (c *Client) createTCPTunnel(req *protocol.TunnelRequestMessage) {
 	c.TunnelsMu.Unlock()
 
 	c.registerTunnelMonitor(tunnel)
+	if tunnel.health != nil {
+		go c.runHealthChecks(tunnel)
+	}
 
 	// Start accepting connections
 	go c.server.tcpManager.AcceptConnections(tunnel, c)
@@ -1301,35 +1809,44 @@ func (c *Client) createTCPTunnel(req *protocol.TunnelRequestMessage) {
 	remoteAddr := fmt.Sprintf("%s:%d", c.server.NodePublicHost(), port)
 
 	resp := &protocol.TunnelCreatedMessage{
-		Message:       protocol.NewMessage(protocol.MsgTunnelCreated),
-		TunnelID:      tunnelID,
-		TunnelType:    protocol.TunnelTCP,
-		Name:          req.Name,
-		RemotePort:    port,
-		RemoteAddr:    remoteAddr,
-		AllowIPsCount: len(tunnel.AllowedIPs) + len(tunnel.AllowedNets),
-		AutoClose:     req.AutoClose,
-		MaxLifetime:   req.MaxLifetime,
+		Message:        protocol.NewMessage(protocol.MsgTunnelCreated),
+		TunnelID:       tunnelID,
+		TunnelType:     tunnel.Type,
+		Name:           req.Name,
+		RemotePort:     port,
+		RemoteAddr:     remoteAddr,
+		AllowIPsCount:  len(tunnel.AllowedIPs) + len(tunnel.AllowedNets),
+		AutoClose:      req.AutoClose,
+		MaxLifetime:    req.MaxLifetime,
+		AddressChanged: addressChanged,
 	}
 	resp.RequestID = req.RequestID
 
-	_ = c.sendControl(resp)
-	c.log.Info().Str("tunnel_id", tunnelID).Int("port", port).Msg("TCP tunnel created")
+	c.replyTunnel(resp)
+	c.log.Info().Str("tunnel_id", tunnelID).Str("type", string(tunnel.Type)).Int("port", port).Msg("TCP tunnel created")
 	c.registerTunnelInRegistry(tunnel)
+	c.emitTunnelEvent(config.WebhookTunnelCreated, tunnel, "")
+	c.server.clientMgr.checkTunnelCount(c.UserID)
 	c.notifyFirstTunnel("TCP", remoteAddr)
 }
 
-func (c *Client) createUDPTunnel(req *protocol.TunnelRequestMessage) {
+func (c *Client) createUDPTunnel(req *protocol.TunnelRequestMessage, restore bool) {
 	// SSRF prevention: block sensitive ports for non-admin users.
 	if portBlocked(req.RemotePort, c.IsAdmin, blockedUDPPorts) {
-		c.sendTunnelError(req.RequestID, "", protocol.ErrCodePortUnavailable,
+		c.rejectTunnel(req, protocol.ErrCodePortUnavailable,
 			fmt.Sprintf("port %d is blocked for security reasons", req.RemotePort))
 		return
 	}
 
 	port, udpConn, err := c.server.udpManager.AllocatePort(req.RemotePort)
+	addressChanged := false
+	if err != nil && restore && req.RemotePort != 0 {
+		c.log.Info().Err(err).Int("port", req.RemotePort).Msg("Previous port unavailable, restoring tunnel on a new one")
+		port, udpConn, err = c.server.udpManager.AllocatePort(0)
+		addressChanged = true
+	}
 	if err != nil {
-		c.sendTunnelError(req.RequestID, "", protocol.ErrCodePortUnavailable, err.Error())
+		c.rejectTunnel(req, protocol.ErrCodePortUnavailable, err.Error())
 		return
 	}
 
@@ -1343,6 +1860,8 @@ func (c *Client) createUDPTunnel(req *protocol.TunnelRequestMessage) {
 		LocalPort:  req.LocalPort,
 		Created:    time.Now(),
 		udpConn:    udpConn,
+		udpFlows:   newUDPFlowTable(c.server.cfg.Server.UDPFlowTimeout),
+		usage:      c.tunnelUsage(),
 	}
 
 	// Parse IP allowlist
@@ -1350,7 +1869,7 @@ func (c *Client) createUDPTunnel(req *protocol.TunnelRequestMessage) {
 		ips, nets, err := parseAllowIPs(req.AllowIPs)
 		if err != nil {
 			udpConn.Close()
-			c.sendTunnelError(req.RequestID, "", protocol.ErrCodeProtocolError, fmt.Sprintf("invalid allow_ips: %v", err))
+			c.rejectTunnel(req, protocol.ErrCodeProtocolError, fmt.Sprintf("invalid allow_ips: %v", err))
 			return
 		}
 		tunnel.AllowedIPs = ips
@@ -1362,18 +1881,24 @@ func (c *Client) createUDPTunnel(req *protocol.TunnelRequestMessage) {
 		d, err := parseTunnelDuration(req.AutoClose)
 		if err != nil {
 			udpConn.Close()
-			c.sendTunnelError(req.RequestID, "", protocol.ErrCodeProtocolError, fmt.Sprintf("invalid auto_close: %v", err))
+			c.rejectTunnel(req, protocol.ErrCodeProtocolError, fmt.Sprintf("invalid auto_close: %v", err))
 			return
 		}
 		tunnel.AutoClose = d
 	}
 
+	if req.HealthCheck != "" {
+		udpConn.Close()
+		c.rejectTunnel(req, protocol.ErrCodeProtocolError, "health checks are not supported for udp tunnels")
+		return
+	}
+
 	// Parse max-lifetime duration
 	if req.MaxLifetime != "" {
 		d, err := parseTunnelDuration(req.MaxLifetime)
 		if err != nil {
 			udpConn.Close()
-			c.sendTunnelError(req.RequestID, "", protocol.ErrCodeProtocolError, fmt.Sprintf("invalid max_lifetime: %v", err))
+			c.rejectTunnel(req, protocol.ErrCodeProtocolError, fmt.Sprintf("invalid max_lifetime: %v", err))
 			return
 		}
 		tunnel.MaxLifetime = d
@@ -1394,26 +1919,29 @@ func (c *Client) createUDPTunnel(req *protocol.TunnelRequestMessage) {
 	remoteAddr := fmt.Sprintf("%s:%d", c.server.NodePublicHost(), port)
 
 	resp := &protocol.TunnelCreatedMessage{
-		Message:       protocol.NewMessage(protocol.MsgTunnelCreated),
-		TunnelID:      tunnelID,
-		TunnelType:    protocol.TunnelUDP,
-		Name:          req.Name,
-		RemotePort:    port,
-		RemoteAddr:    remoteAddr,
-		AllowIPsCount: len(tunnel.AllowedIPs) + len(tunnel.AllowedNets),
-		AutoClose:     req.AutoClose,
-		MaxLifetime:   req.MaxLifetime,
+		Message:        protocol.NewMessage(protocol.MsgTunnelCreated),
+		TunnelID:       tunnelID,
+		TunnelType:     protocol.TunnelUDP,
+		Name:           req.Name,
+		RemotePort:     port,
+		RemoteAddr:     remoteAddr,
+		AllowIPsCount:  len(tunnel.AllowedIPs) + len(tunnel.AllowedNets),
+		AutoClose:      req.AutoClose,
+		MaxLifetime:    req.MaxLifetime,
+		AddressChanged: addressChanged,
 	}
 	resp.RequestID = req.RequestID
 
-	_ = c.sendControl(resp)
+	c.replyTunnel(resp)
 	c.log.Info().Str("tunnel_id", tunnelID).Int("port", port).Msg("UDP tunnel created")
 	c.registerTunnelInRegistry(tunnel)
+	c.emitTunnelEvent(config.WebhookTunnelCreated, tunnel, "")
+	c.server.clientMgr.checkTunnelCount(c.UserID)
 	c.notifyFirstTunnel("UDP", remoteAddr)
 }
 
 func (c *Client) handleTunnelClose(data []byte) {
-	parsed, err := protocol.ParseMessage(data, protocol.MsgTunnelClose)
+	parsed, err := c.encoding.ParseMessage(data, protocol.MsgTunnelClose)
 	if err != nil {
 		c.log.Error().Err(err).Msg("Failed to parse tunnel close")
 		return
@@ -1425,11 +1953,11 @@ func (c *Client) handleTunnelClose(data []byte) {
 
 func (c *Client) registerTunnelMonitor(tunnel *Tunnel) {
 	var limits monitor.TunnelLimits
-	if c.Plan != nil {
+	if plan := c.currentPlan(); plan != nil {
 		limits = monitor.TunnelLimits{
-			TCPConnPerMin:    c.Plan.RateLimitTCP,
-			UDPPacketsPerSec: c.Plan.RateLimitUDP,
-			HTTPReqPerMin:    c.Plan.RateLimitHTTP,
+			TCPConnPerMin:    plan.RateLimitTCP,
+			UDPPacketsPerSec: plan.RateLimitUDP,
+			HTTPReqPerMin:    plan.RateLimitHTTP,
 		}
 	}
 	c.server.monitor.RegisterTunnel(tunnel.ID, string(tunnel.Type), limits)
@@ -1449,32 +1977,65 @@ func (c *Client) closeTunnel(tunnelID string) {
 
 	c.server.monitor.RemoveTunnel(tunnelID)
 
+	if tunnel.health != nil {
+		tunnel.health.stop()
+	}
+
 	// Remove from cross-server registry
 	if c.server.tunnelRegistry != nil {
 		_ = c.server.tunnelRegistry.Unregister(tunnelID)
 	}
 
+	// Stop taking new visitors; HTTP and TCP connections already in flight
+	// are drained before the closure is confirmed
+	drain := false
 	switch tunnel.Type {
 	case protocol.TunnelHTTP:
-		c.server.httpRouter.UnregisterTunnel(tunnel.Subdomain)
-		c.server.inspectMgr.Remove(tunnelID)
-	case protocol.TunnelTCP:
+		c.server.httpRouter.UnregisterTunnel(tunnel.Subdomain, tunnelID)
+		drain = true
+	case protocol.TunnelTCP, protocol.TunnelSink:
 		if tunnel.listener != nil {
 			tunnel.listener.Close()
 		}
+		drain = true
+	case protocol.TunnelSOCKS:
+		drain = true
 	case protocol.TunnelUDP:
 		if tunnel.udpConn != nil {
 			tunnel.udpConn.Close()
 		}
 	}
 
+	if !drain {
+		c.finishTunnelClose(tunnel, "")
+		return
+	}
+	idle := tunnel.conns.startDrain()
+	if idle == nil {
+		c.finishTunnelClose(tunnel, c.drainTunnel(tunnel, nil))
+		return
+	}
+	go func() {
+		c.finishTunnelClose(tunnel, c.drainTunnel(tunnel, idle))
+	}()
+}
+
+// finishTunnelClose confirms the closure of a tunnel to the client once
+// its connections are drained.
+func (c *Client) finishTunnelClose(tunnel *Tunnel, drain string) {
+	if tunnel.Type == protocol.TunnelHTTP {
+		c.server.inspectMgr.Remove(tunnel.ID)
+	}
+
 	resp := &protocol.TunnelClosedMessage{
 		Message:  protocol.NewMessage(protocol.MsgTunnelClosed),
-		TunnelID: tunnelID,
+		TunnelID: tunnel.ID,
+		Drain:    drain,
 	}
 	_ = c.sendControl(resp)
+	c.emitTunnelEvent(config.WebhookTunnelClosed, tunnel, "")
 
-	c.log.Info().Str("tunnel_id", tunnelID).Msg("Tunnel closed")
+	c.log.Info().Str("tunnel_id", tunnel.ID).Str("drain", drain).Msg("Tunnel closed")
 }
 
 // registerTunnelInRegistry registers the tunnel in the cross-server Redis registry
@@ -1525,10 +2086,6 @@ func (c *Client) registerTunnelInRegistry(tunnel *Tunnel) {
 	}()
 }
 
-func (c *Client) handleConnectionAccept(data []byte) {
-	// This is handled via yamux streams directly
-}
-
 func (c *Client) handlePing() {
 	pong := &protocol.PongMessage{
 		Message: protocol.NewMessage(protocol.MsgPong),
@@ -1548,7 +2105,8 @@ func (c *Client) keepalive() {
 		case <-c.ctx.Done():
 			return
 		case <-ticker.C:
-			if time.Since(time.Unix(0, c.lastPing.Load())) > clientTimeout {
+			// While detached the resume window bounds the wait instead
+			if !c.detached.Load() && time.Since(time.Unix(0, c.lastPing.Load())) > clientTimeout {
 				c.log.Warn().Msg("Client timeout, closing")
 				c.Close()
 				return
@@ -1581,7 +2139,7 @@ func (c *Client) sendTunnelError(requestID, tunnelID, code, message string) {
 		Code:     code,
 	}
 	msg.RequestID = requestID
-	_ = c.sendControl(msg)
+	c.replyTunnel(msg)
 }
 
 // notifyFirstTunnel checks if this is the user's first-ever tunnel and notifies admin.
@@ -1615,6 +2173,7 @@ func (c *Client) Close() {
 		c.TunnelsMu.Lock()
 		for tunnelID, tunnel := range c.Tunnels {
 			c.server.monitor.RemoveTunnel(tunnelID)
+			c.emitTunnelEvent(config.WebhookTunnelClosed, tunnel, "")
 
 			// Unregister from cross-server registry
 			if c.server.tunnelRegistry != nil {
@@ -1623,9 +2182,9 @@ func (c *Client) Close() {
 
 			switch tunnel.Type {
 			case protocol.TunnelHTTP:
-				c.server.httpRouter.UnregisterTunnel(tunnel.Subdomain)
+				c.server.httpRouter.UnregisterTunnel(tunnel.Subdomain, tunnelID)
 				c.server.inspectMgr.Remove(tunnelID)
-			case protocol.TunnelTCP:
+			case protocol.TunnelTCP, protocol.TunnelSink:
 				if tunnel.listener != nil {
 					tunnel.listener.Close()
 				}
@@ -1638,6 +2197,8 @@ func (c *Client) Close() {
 		}
 		c.TunnelsMu.Unlock()
 
+		// Close the primary connection and all data sessions
+		c.DataMu.Lock()
 		if c.ControlConn != nil {
 			c.ControlConn.Close()
 		}
@@ -1647,9 +2208,6 @@ func (c *Client) Close() {
 		if c.conn != nil {
 			c.conn.Close()
 		}
-
-		// Close all data sessions
-		c.DataMu.Lock()
 		for _, ds := range c.DataSessions {
 			ds.Close()
 		}
@@ -1711,6 +2269,22 @@ type TunnelInfo struct {
 	ClientID   string
 	UserID     int64
 	CreatedAt  time.Time
+	Health     *TunnelHealth // nil when the tunnel has no health check
+
+	// LastActivity is when traffic last went through the tunnel, or when
+	// it was created if none has yet.
+	LastActivity time.Time
+}
+
+// ClientInfo represents a connected client and its tunnels for the API
+type ClientInfo struct {
+	ID          string
+	Hostname    string
+	RemoteAddr  string
+	UserID      int64
+	ConnectedAt time.Time
+	Tunnels     []TunnelInfo
+	Sessions    SessionPressure
 }
 
 // Stats represents server statistics
@@ -1720,6 +2294,26 @@ type Stats struct {
 	HTTPTunnels   int
 	TCPTunnels    int
 	UDPTunnels    int
+	// UDPFlows is the number of visitor sources with a live flow through a
+	// UDP tunnel.
+	UDPFlows int
+	// AbnormalTunnelUsers is the number of users currently at or above
+	// server.tunnel_warn_threshold; TunnelCountWarnings counts how often a
+	// user reached it since startup.
+	AbnormalTunnelUsers int
+	TunnelCountWarnings int64
+}
+
+// GetTunnelHealth returns the health check state and history of a tunnel owned
+// by the user, or nil when the tunnel does not exist or has no health check.
+func (s *Server) GetTunnelHealth(tunnelID string, userID int64) *TunnelHealth {
+	return s.clientMgr.GetTunnelHealth(tunnelID, userID)
+}
+
+// PurgeTunnelCache drops the response cache of a tunnel owned by the user
+// and returns how many responses it held.
+func (s *Server) PurgeTunnelCache(tunnelID string, userID int64) (int, error) {
+	return s.clientMgr.PurgeTunnelCache(tunnelID, userID)
 }
 
 // GetTunnelsByUserID returns all tunnels for a user
@@ -1727,6 +2321,26 @@ func (s *Server) GetTunnelsByUserID(userID int64) []TunnelInfo {
 	return s.clientMgr.GetTunnelsByUserID(userID)
 }
 
+// GetClientsByUserID returns the connected clients of a user
+func (s *Server) GetClientsByUserID(userID int64) []ClientInfo {
+	return s.clientMgr.GetClientsByUserID(userID)
+}
+
+// DisconnectClient disconnects one of the user's clients
+func (s *Server) DisconnectClient(clientID string, userID int64) error {
+	return s.clientMgr.DisconnectClient(clientID, userID)
+}
+
+// GetAllClients returns all connected clients (for admin)
+func (s *Server) GetAllClients() []ClientInfo {
+	return s.clientMgr.GetAllClients()
+}
+
+// AdminDisconnectClient disconnects any client by ID (admin only, no user check)
+func (s *Server) AdminDisconnectClient(clientID string) error {
+	return s.clientMgr.AdminDisconnectClient(clientID)
+}
+
 // GetAllTunnels returns all tunnels from all clients (for admin)
 func (s *Server) GetAllTunnels() []TunnelInfo {
 	return s.clientMgr.GetAllTunnels()
@@ -1737,6 +2351,18 @@ func (s *Server) AdminCloseTunnel(tunnelID string) error {
 	return s.clientMgr.AdminCloseTunnel(tunnelID)
 }
 
+// CloseTunnelBySubdomain closes the HTTP tunnels serving subdomain, whoever
+// owns them. It reports whether there were any.
+func (s *Server) CloseTunnelBySubdomain(subdomain string) bool {
+	closed := false
+	for _, tunnel := range s.httpRouter.GetTunnels(subdomain) {
+		if s.clientMgr.AdminCloseTunnel(tunnel.ID) == nil {
+			closed = true
+		}
+	}
+	return closed
+}
+
 // CloseTunnelByID closes a tunnel by ID for a specific user
 func (s *Server) CloseTunnelByID(tunnelID string, userID int64) error {
 	return s.clientMgr.CloseTunnelByID(tunnelID, userID)
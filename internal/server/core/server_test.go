@@ -3,6 +3,7 @@ package core
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
 	"net"
 	"os"
 	"path/filepath"
@@ -111,7 +112,7 @@ func dialServer(t *testing.T, srv *Server) *yamux.Session {
 	go srv.handleControlConnection(serverConn)
 
 	// Perform compression handshake (client side, no compression in tests)
-	rwc, _, err := protocol.NegotiateCompression(clientConn, false, false)
+	rwc, _, err := protocol.NegotiateCompression(clientConn, nil, false)
 	if err != nil {
 		t.Fatalf("NegotiateCompression: %v", err)
 	}
@@ -399,6 +400,37 @@ func TestServerPingPong(t *testing.T) {
 
 // --- generateID tests ---
 
+func TestJoinSession_DataSessionsDisabled(t *testing.T) {
+	srv := resumeTestServer(t, 0)
+	srv.cfg.Server.DisableDataSessions = true
+
+	primary, auth := authResumable(t, srv)
+	defer primary.Close()
+	assert.Empty(t, auth.SessionSecret, "no secret, so clients do not try to join")
+
+	// A client that authenticated before the switch still has one
+	client := srv.GetClient(auth.ClientID)
+	require.NotNil(t, client)
+	client.SessionSecret = "old-secret"
+
+	data := dialServer(t, srv)
+	defer data.Close()
+	codec, _ := openControlStream(t, data)
+	require.NoError(t, codec.Encode(&protocol.JoinSessionMessage{
+		Message:  protocol.NewMessage(protocol.MsgJoinSession),
+		ClientID: auth.ClientID,
+		Secret:   "old-secret",
+	}))
+	var joined protocol.JoinSessionResult
+	require.NoError(t, codec.Decode(&joined))
+	assert.False(t, joined.Success)
+	assert.Equal(t, protocol.ErrCodeDataSessionsDisabled, joined.Code)
+
+	client.DataMu.RLock()
+	defer client.DataMu.RUnlock()
+	assert.Empty(t, client.DataSessions)
+}
+
 func TestGenerateIDLength(t *testing.T) {
 	for i := 0; i < 100; i++ {
 		id := generateID()
@@ -438,3 +470,54 @@ func TestGenerateIDNoDuplicatePositions(t *testing.T) {
 	// With the bug: 1000/1000 matches
 	assert.Less(t, matchCount, 100, "positions 0 and 9 should not always correlate — entropy bug likely present")
 }
+
+// freePort returns a TCP port that was free a moment ago.
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	require.NoError(t, l.Close())
+	return port
+}
+
+func TestStart_HTTPPortInUseReleasesControlPort(t *testing.T) {
+	// A plain listener (no SO_REUSEPORT) blocks the HTTP port.
+	busy, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	defer busy.Close()
+
+	controlPort := freePort(t)
+	cfg := &config.ServerConfig{
+		Server: config.ServerSettings{
+			ControlPort: controlPort,
+			HTTPPort:    busy.Addr().(*net.TCPAddr).Port,
+		},
+		Domain: config.DomainSettings{Base: "example.com"},
+	}
+	srv := New(cfg, zerolog.Nop())
+	defer srv.cancel()
+
+	err = srv.Start()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "already in use")
+	assert.Nil(t, srv.controlListener)
+	assert.Nil(t, srv.httpListener)
+
+	// The control port bound before the failure is free again.
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", controlPort))
+	require.NoError(t, err)
+	l.Close()
+}
+
+func TestCheckPortAvailable(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer busy.Close()
+
+	err = CheckPortAvailable("web", busy.Addr().String())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "listen web: port "+busy.Addr().String()+" already in use")
+
+	assert.NoError(t, CheckPortAvailable("web", fmt.Sprintf("127.0.0.1:%d", freePort(t))))
+}
@@ -0,0 +1,80 @@
+package core
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/yamux"
+)
+
+// writeStallThreshold is how long a stream write may take before it counts
+// as stalled on flow control.
+const writeStallThreshold = 100 * time.Millisecond
+
+// sessionPressure tracks flow-control back-pressure on the streams a client's
+// yamux sessions carry. yamux does not expose its send windows, but a stream
+// write only blocks once the client's receive window for that stream is used
+// up, so the time spent inside Write measures how saturated the windows are.
+type sessionPressure struct {
+	writes        atomic.Int64
+	stalledWrites atomic.Int64
+	pendingWrites atomic.Int64
+	writeWait     atomic.Int64 // nanoseconds
+}
+
+func (p *sessionPressure) write(stream net.Conn, b []byte) (int, error) {
+	p.pendingWrites.Add(1)
+	start := time.Now()
+	n, err := stream.Write(b)
+	wait := time.Since(start)
+	p.pendingWrites.Add(-1)
+
+	p.writes.Add(1)
+	p.writeWait.Add(int64(wait))
+	if wait >= writeStallThreshold {
+		p.stalledWrites.Add(1)
+	}
+	return n, err
+}
+
+// SessionPressure is a snapshot of a client's yamux session load for the API.
+type SessionPressure struct {
+	Sessions      int   // primary plus data sessions still open
+	Streams       int   // open streams across those sessions
+	PendingWrites int64 // stream writes currently blocked
+	Writes        int64
+	StalledWrites int64 // writes that waited at least writeStallThreshold
+	WriteWait     time.Duration
+}
+
+// StallRatio is the share of stream writes that stalled on a full window;
+// a value near 1 means flow control is what limits the client's throughput.
+func (p SessionPressure) StallRatio() float64 {
+	if p.Writes == 0 {
+		return 0
+	}
+	return float64(p.StalledWrites) / float64(p.Writes)
+}
+
+// sessionPressure reports the load on the client's sessions.
+func (c *Client) sessionPressure() SessionPressure {
+	snap := SessionPressure{
+		PendingWrites: c.pressure.pendingWrites.Load(),
+		Writes:        c.pressure.writes.Load(),
+		StalledWrites: c.pressure.stalledWrites.Load(),
+		WriteWait:     time.Duration(c.pressure.writeWait.Load()),
+	}
+	primary, data := c.sessionsByRole()
+	if primary == nil {
+		return snap
+	}
+	for _, s := range append([]*yamux.Session{primary}, data...) {
+		if s.IsClosed() {
+			continue
+		}
+		snap.Sessions++
+		snap.Streams += s.NumStreams()
+	}
+	return snap
+}
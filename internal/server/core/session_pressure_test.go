@@ -0,0 +1,76 @@
+package core
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionPressureCountsStalledWrites(t *testing.T) {
+	var stats dataPlaneStats
+	var pressure sessionPressure
+	a, b := net.Pipe()
+	defer b.Close()
+	stream := stats.trackStream(a, &pressure)
+	defer stream.Close()
+
+	// A pipe write blocks until the peer reads, like a yamux write on a
+	// stream whose window is used up
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = stream.Write([]byte("slow"))
+	}()
+	require.Eventually(t, func() bool { return pressure.pendingWrites.Load() == 1 },
+		time.Second, time.Millisecond)
+	time.Sleep(writeStallThreshold)
+	buf := make([]byte, 4)
+	_, err := b.Read(buf)
+	require.NoError(t, err)
+	<-done
+
+	go func() { _, _ = b.Read(buf) }()
+	_, err = stream.Write([]byte("fast"))
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(0), pressure.pendingWrites.Load())
+	assert.Equal(t, int64(2), pressure.writes.Load())
+	assert.Equal(t, int64(1), pressure.stalledWrites.Load())
+	assert.GreaterOrEqual(t, time.Duration(pressure.writeWait.Load()), writeStallThreshold)
+}
+
+func TestSessionPressureStallRatio(t *testing.T) {
+	assert.Equal(t, 0.0, SessionPressure{}.StallRatio())
+	assert.Equal(t, 0.25, SessionPressure{Writes: 8, StalledWrites: 2}.StallRatio())
+}
+
+func TestMetricsCollectorSessionPressure(t *testing.T) {
+	s := &Server{clientMgr: NewClientManager(zerolog.Nop())}
+	c := &Client{ID: "c1", Tunnels: map[string]*Tunnel{}}
+	c.pressure.writes.Store(10)
+	c.pressure.stalledWrites.Store(9)
+	c.pressure.pendingWrites.Store(3)
+	s.clientMgr.addClient("c1", c)
+
+	expected := `
+# HELP fxtunnel_server_session_pending_writes Stream writes to a client still in progress; they block while the stream window is full
+# TYPE fxtunnel_server_session_pending_writes gauge
+fxtunnel_server_session_pending_writes{client_id="c1"} 3
+# HELP fxtunnel_server_session_stalled_writes_total Stream writes to a client that waited at least 100ms for window space
+# TYPE fxtunnel_server_session_stalled_writes_total counter
+fxtunnel_server_session_stalled_writes_total{client_id="c1"} 9
+# HELP fxtunnel_server_session_writes_total Stream writes to a client
+# TYPE fxtunnel_server_session_writes_total counter
+fxtunnel_server_session_writes_total{client_id="c1"} 10
+`
+	err := testutil.CollectAndCompare(s.MetricsCollector(), strings.NewReader(expected),
+		"fxtunnel_server_session_pending_writes", "fxtunnel_server_session_stalled_writes_total",
+		"fxtunnel_server_session_writes_total")
+	require.NoError(t, err)
+}
@@ -0,0 +1,197 @@
+package core
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/hashicorp/yamux"
+	"github.com/rs/zerolog"
+
+	"github.com/mephistofox/fxtun.dev/internal/logging"
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+	"github.com/mephistofox/fxtun.dev/internal/server/database"
+)
+
+var (
+	errResumeInvalid     = errors.New("invalid client_id or resume token")
+	errResumeUnsupported = errors.New("session is not resumable")
+	errResumeClosed      = errors.New("session already closed")
+)
+
+// offerResume issues a resume token in the auth result when both the client
+// and the server support resumption. From then on the client survives the
+// loss of its control connection for the configured resume window.
+func (s *Server) offerResume(client *Client, authMsg *protocol.AuthMessage, result *protocol.AuthResultMessage) {
+	if !authMsg.Resumable || s.cfg.Server.ResumeWindow <= 0 {
+		return
+	}
+
+	client.resumeMu.Lock()
+	client.resumed = make(chan struct{}, 1)
+	client.resumeToken = generateSessionSecret()
+	result.ResumeToken = client.resumeToken
+	client.resumeMu.Unlock()
+
+	result.ResumeWindow = int(s.cfg.Server.ResumeWindow / time.Second)
+}
+
+// controlCodec returns the codec of the current control stream.
+func (c *Client) controlCodec() *protocol.Codec {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ControlCodec
+}
+
+// awaitResume is called when reading from the control stream behind failed
+// fails. Tunnels, data sessions and the streams running over them are left
+// alone while the client has a chance to resume; it reports whether a new
+// control stream took over.
+func (c *Client) awaitResume(failed *protocol.Codec) bool {
+	c.resumeMu.Lock()
+	resumed := c.resumed
+	c.resumeMu.Unlock()
+	if resumed == nil || c.ctx.Err() != nil {
+		return false
+	}
+	// A resume can arrive before this side notices the old connection died
+	if c.controlCodec() != failed {
+		return true
+	}
+
+	c.detached.Store(true)
+	defer c.detached.Store(false)
+
+	window := c.server.cfg.Server.ResumeWindow
+	c.log.Info().Dur("window", window).Msg("Control connection lost, waiting for resume")
+
+	// Streams pre-opened on the dead primary session would fail when used
+	c.drainStreamPool()
+
+	timer := time.NewTimer(window)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-resumed:
+			if c.controlCodec() != failed {
+				return true
+			}
+		case <-timer.C:
+			c.resumeMu.Lock()
+			defer c.resumeMu.Unlock()
+			if c.controlCodec() != failed {
+				return true
+			}
+			c.log.Info().Msg("Resume window expired")
+			// Cancel under resumeMu so a late resume is rejected
+			c.cancel()
+			return false
+		case <-c.ctx.Done():
+			return false
+		}
+	}
+}
+
+// resume replaces the primary session and control stream with a fresh
+// connection. The success result is written before the swap so it is the
+// first message the client reads on the new control stream; it carries a
+// new resume token, so each token reattaches at most once.
+func (c *Client) resume(token string, conn net.Conn, session *yamux.Session, controlStream net.Conn, codec *protocol.Codec) error {
+	c.resumeMu.Lock()
+	defer c.resumeMu.Unlock()
+
+	if c.resumed == nil {
+		return errResumeUnsupported
+	}
+	if subtle.ConstantTimeCompare([]byte(c.resumeToken), []byte(token)) != 1 {
+		return errResumeInvalid
+	}
+	if c.ctx.Err() != nil {
+		return errResumeClosed
+	}
+
+	c.TunnelsMu.RLock()
+	tunnelIDs := make([]string, 0, len(c.Tunnels))
+	for id := range c.Tunnels {
+		tunnelIDs = append(tunnelIDs, id)
+	}
+	c.TunnelsMu.RUnlock()
+
+	nextToken := generateSessionSecret()
+	result := &protocol.ResumeSessionResult{
+		Message:     protocol.NewMessage(protocol.MsgResumeSessionResult),
+		Success:     true,
+		ResumeToken: nextToken,
+		TunnelIDs:   tunnelIDs,
+	}
+	if err := codec.Encode(result); err != nil {
+		return err
+	}
+	codec.SetEncoding(c.encoding)
+	c.resumeToken = nextToken
+
+	c.DataMu.Lock()
+	oldControl, oldSession, oldConn := c.ControlConn, c.Session, c.conn
+	c.ControlConn, c.Session, c.conn = controlStream, session, conn
+	c.DataMu.Unlock()
+
+	// Closing the old connection unblocks a control read that has not
+	// noticed the drop yet, and any write stuck on it.
+	if oldControl != nil {
+		oldControl.Close()
+	}
+	if oldSession != nil {
+		oldSession.Close()
+	}
+	if oldConn != nil {
+		oldConn.Close()
+	}
+
+	c.mu.Lock()
+	c.ControlCodec = codec
+	c.mu.Unlock()
+
+	c.lastPing.Store(time.Now().UnixNano())
+	c.drainStreamPool()
+	if c.server.cfg.Server.SOCKS.Enabled {
+		go c.acceptOutbound(session)
+	}
+
+	select {
+	case c.resumed <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (s *Server) handleResumeSession(conn net.Conn, session *yamux.Session, controlStream net.Conn, codec *protocol.Codec, data []byte, log zerolog.Logger) {
+	parsed, err := protocol.ParseMessage(data, protocol.MsgResumeSession)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to parse resume_session message")
+		session.Close()
+		return
+	}
+	resumeMsg := parsed.(*protocol.ResumeSessionMessage)
+
+	err = errResumeInvalid
+	client := s.clientMgr.GetClient(resumeMsg.ClientID)
+	if client != nil {
+		err = client.resume(resumeMsg.Token, conn, session, controlStream, codec)
+	}
+	if err != nil {
+		log.Warn().Err(err).Str("client_id", resumeMsg.ClientID).Msg("Resume session failed")
+		result := &protocol.ResumeSessionResult{
+			Message: protocol.NewMessage(protocol.MsgResumeSessionResult),
+			Success: false,
+			Error:   err.Error(),
+		}
+		_ = codec.Encode(result)
+		session.Close()
+		return
+	}
+
+	client.log.Info().Str("remote_ip", logging.RemoteIP(conn.RemoteAddr().String())).Msg("Session resumed")
+	client.recordHistoryEvent(database.HistoryEventReconnect, "", 0, "", "resumed session, tunnels kept")
+}
@@ -0,0 +1,254 @@
+package core
+
+import (
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/yamux"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+// resumeTestServer returns a server without a database or auth, so any
+// client is accepted, with the given resume window.
+func resumeTestServer(t *testing.T, window time.Duration) *Server {
+	t.Helper()
+
+	cfg := &config.ServerConfig{
+		Server: config.ServerSettings{
+			ControlPort:  14443,
+			HTTPPort:     18080,
+			ResumeWindow: window,
+		},
+		Domain: config.DomainSettings{Base: "test.local"},
+	}
+	srv := New(cfg, zerolog.New(os.Stderr).Level(zerolog.Disabled))
+	t.Cleanup(srv.cancel)
+	return srv
+}
+
+// authResumable authenticates a new primary connection that advertises
+// session resumption.
+func authResumable(t *testing.T, srv *Server) (*yamux.Session, *protocol.AuthResultMessage) {
+	t.Helper()
+
+	session := dialServer(t, srv)
+	codec, _ := openControlStream(t, session)
+	require.NoError(t, codec.Encode(&protocol.AuthMessage{
+		Message:   protocol.NewMessage(protocol.MsgAuth),
+		Resumable: true,
+	}))
+	var result protocol.AuthResultMessage
+	require.NoError(t, codec.Decode(&result))
+	require.True(t, result.Success, result.Error)
+
+	// A ping round trip ensures the server is in its control loop, so a
+	// test dropping the connection right away does not race the auth reply.
+	require.NoError(t, codec.Encode(&protocol.PingMessage{Message: protocol.NewMessage(protocol.MsgPing)}))
+	var pong protocol.PongMessage
+	require.NoError(t, codec.Decode(&pong))
+	return session, &result
+}
+
+// sendResume opens a new connection and asks to resume the given session.
+func sendResume(t *testing.T, srv *Server, clientID, token string) (*yamux.Session, *protocol.Codec, *protocol.ResumeSessionResult) {
+	t.Helper()
+
+	session := dialServer(t, srv)
+	codec, _ := openControlStream(t, session)
+	require.NoError(t, codec.Encode(&protocol.ResumeSessionMessage{
+		Message:  protocol.NewMessage(protocol.MsgResumeSession),
+		ClientID: clientID,
+		Token:    token,
+	}))
+	var result protocol.ResumeSessionResult
+	require.NoError(t, codec.Decode(&result))
+	return session, codec, &result
+}
+
+// acceptMarked returns the stream on session that starts with marker,
+// skipping any other stream the server opened, such as pooled ones.
+func acceptMarked(t *testing.T, session *yamux.Session, marker string) net.Conn {
+	t.Helper()
+
+	found := make(chan net.Conn, 1)
+	go func() {
+		for {
+			stream, err := session.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				buf := make([]byte, len(marker))
+				if _, err := io.ReadFull(stream, buf); err == nil && string(buf) == marker {
+					found <- stream
+				}
+			}()
+		}
+	}()
+
+	select {
+	case stream := <-found:
+		return stream
+	case <-time.After(2 * time.Second):
+		t.Fatal("marked stream not accepted")
+		return nil
+	}
+}
+
+// openStream opens a stream on session, failing the test instead of
+// hanging when the peer does not take it in time.
+func openStream(t *testing.T, session *yamux.Session) net.Conn {
+	t.Helper()
+
+	type opened struct {
+		stream net.Conn
+		err    error
+	}
+	done := make(chan opened, 1)
+	go func() {
+		stream, err := session.Open()
+		done <- opened{stream, err}
+	}()
+
+	select {
+	case o := <-done:
+		require.NoError(t, o.err)
+		return o.stream
+	case <-time.After(2 * time.Second):
+		t.Fatal("stream open timed out")
+		return nil
+	}
+}
+
+func TestResumeSession_KeepsDataStreams(t *testing.T) {
+	srv := resumeTestServer(t, 5*time.Second)
+	// Pooled streams would queue on the data session ahead of the one under
+	// test, and draining them slows the resume down
+	srv.noStreamPool = true
+
+	primary, auth := authResumable(t, srv)
+	assert.Equal(t, 5, auth.ResumeWindow)
+	client := srv.GetClient(auth.ClientID)
+	require.NotNil(t, client)
+
+	// Join a data session and open a stream over it, as for a TCP transfer
+	data := dialServer(t, srv)
+	defer data.Close()
+	joinCodec, _ := openControlStream(t, data)
+	require.NoError(t, joinCodec.Encode(&protocol.JoinSessionMessage{
+		Message:  protocol.NewMessage(protocol.MsgJoinSession),
+		ClientID: auth.ClientID,
+		Secret:   auth.SessionSecret,
+	}))
+	var joined protocol.JoinSessionResult
+	require.NoError(t, joinCodec.Decode(&joined))
+	require.True(t, joined.Success, joined.Error)
+
+	client.DataMu.RLock()
+	dataSession := client.DataSessions[0]
+	client.DataMu.RUnlock()
+	serverStream := openStream(t, dataSession)
+	defer serverStream.Close()
+	_, err := serverStream.Write([]byte("transfer"))
+	require.NoError(t, err)
+	clientStream := acceptMarked(t, data, "transfer")
+	defer clientStream.Close()
+
+	// Lose the control connection
+	primary.Close()
+	require.Eventually(t, client.detached.Load, 2*time.Second, 10*time.Millisecond)
+
+	resumed, codec, result := sendResume(t, srv, auth.ClientID, auth.ResumeToken)
+	defer resumed.Close()
+	require.True(t, result.Success, result.Error)
+	assert.Same(t, client, srv.GetClient(auth.ClientID))
+
+	// The stream opened before the drop still carries data
+	go func() { _, _ = serverStream.Write([]byte("still here")) }()
+	buf := make([]byte, len("still here"))
+	_, err = io.ReadFull(clientStream, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "still here", string(buf))
+
+	// And the new control stream is served
+	require.NoError(t, codec.Encode(&protocol.PingMessage{Message: protocol.NewMessage(protocol.MsgPing)}))
+	var pong protocol.PongMessage
+	require.NoError(t, codec.Decode(&pong))
+	assert.Equal(t, protocol.MsgPong, pong.Type)
+}
+
+func TestResumeSession_WindowExpires(t *testing.T) {
+	srv := resumeTestServer(t, 100*time.Millisecond)
+
+	primary, auth := authResumable(t, srv)
+	primary.Close()
+
+	require.Eventually(t, func() bool { return srv.GetClient(auth.ClientID) == nil },
+		2*time.Second, 10*time.Millisecond)
+
+	resumed, _, result := sendResume(t, srv, auth.ClientID, auth.ResumeToken)
+	defer resumed.Close()
+	assert.False(t, result.Success)
+}
+
+func TestResumeSession_ReattachesTunnels(t *testing.T) {
+	srv := resumeTestServer(t, 5*time.Second)
+
+	primary, auth := authResumable(t, srv)
+	require.NotEmpty(t, auth.ResumeToken)
+	assert.NotEqual(t, auth.SessionSecret, auth.ResumeToken)
+	client := srv.GetClient(auth.ClientID)
+	require.NotNil(t, client)
+
+	client.TunnelsMu.Lock()
+	client.Tunnels["tcp-1"] = &Tunnel{ID: "tcp-1", ClientID: client.ID, Type: protocol.TunnelTCP, RemotePort: 30001}
+	client.TunnelsMu.Unlock()
+
+	primary.Close()
+	require.Eventually(t, client.detached.Load, 2*time.Second, 10*time.Millisecond)
+
+	resumed, _, result := sendResume(t, srv, auth.ClientID, auth.ResumeToken)
+	defer resumed.Close()
+	require.True(t, result.Success, result.Error)
+	assert.Equal(t, []string{"tcp-1"}, result.TunnelIDs)
+	require.NotEmpty(t, result.ResumeToken)
+	assert.NotEqual(t, auth.ResumeToken, result.ResumeToken)
+
+	// The token is single-use: it was rotated by the resume
+	stale, _, staleResult := sendResume(t, srv, auth.ClientID, auth.ResumeToken)
+	defer stale.Close()
+	assert.False(t, staleResult.Success)
+}
+
+func TestResumeSession_InvalidToken(t *testing.T) {
+	srv := resumeTestServer(t, 5*time.Second)
+
+	primary, auth := authResumable(t, srv)
+	defer primary.Close()
+
+	// The session secret for data connections is not a resume token
+	resumed, _, result := sendResume(t, srv, auth.ClientID, auth.SessionSecret)
+	defer resumed.Close()
+	assert.False(t, result.Success)
+	assert.NotNil(t, srv.GetClient(auth.ClientID))
+}
+
+func TestResumeSession_DisabledClosesClient(t *testing.T) {
+	srv := resumeTestServer(t, 0)
+
+	primary, auth := authResumable(t, srv)
+	assert.Zero(t, auth.ResumeWindow)
+	assert.Empty(t, auth.ResumeToken)
+
+	primary.Close()
+	require.Eventually(t, func() bool { return srv.GetClient(auth.ClientID) == nil },
+		2*time.Second, 10*time.Millisecond)
+}
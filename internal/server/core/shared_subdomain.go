@@ -0,0 +1,124 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync/atomic"
+)
+
+// stickyCookieName is the cookie that pins a visitor of a shared subdomain
+// to one of its tunnels.
+const stickyCookieName = "fxtun_backend"
+
+// tunnelGroup is the set of HTTP tunnels serving one subdomain. Without
+// server.shared_subdomains it never holds more than one tunnel.
+type tunnelGroup struct {
+	// tunnels is replaced, never modified in place, so a slice read under
+	// the router's read lock stays valid after it is released
+	tunnels []*Tunnel
+	next    atomic.Uint64
+}
+
+// mayJoin reports whether tunnel may serve the group's subdomain too: only
+// tunnels of the same signed-in user share one.
+func (g *tunnelGroup) mayJoin(tunnel *Tunnel) bool {
+	if tunnel.userID <= 0 {
+		return false
+	}
+	for _, t := range g.tunnels {
+		if t.userID != tunnel.userID {
+			return false
+		}
+	}
+	return true
+}
+
+func (g *tunnelGroup) add(tunnel *Tunnel) {
+	tunnels := make([]*Tunnel, 0, len(g.tunnels)+1)
+	g.tunnels = append(append(tunnels, g.tunnels...), tunnel)
+}
+
+// remove drops the tunnel with id and reports whether any are left.
+func (g *tunnelGroup) remove(id string) bool {
+	tunnels := make([]*Tunnel, 0, len(g.tunnels))
+	for _, t := range g.tunnels {
+		if t.ID != id {
+			tunnels = append(tunnels, t)
+		}
+	}
+	g.tunnels = tunnels
+	return len(tunnels) > 0
+}
+
+// stickyKey identifies a tunnel in the sticky cookie without giving its ID
+// away to visitors.
+func stickyKey(t *Tunnel) string {
+	sum := sha256.Sum256([]byte(t.ID))
+	return hex.EncodeToString(sum[:8])
+}
+
+// tunnelDown reports whether the tunnel's health check last failed.
+func tunnelDown(t *Tunnel) bool {
+	h := t.healthSnapshot()
+	return h != nil && h.Status == HealthStatusDown
+}
+
+// pickTunnel returns the tunnel that serves req on subdomain, or nil if
+// none does. On a shared subdomain a visitor's sticky cookie is honoured
+// while its tunnel is up; otherwise tunnels take turns, skipping those
+// whose health check fails. stick is set when the visitor should get a
+// cookie for the returned tunnel.
+func (r *HTTPRouter) pickTunnel(subdomain string, req *http.Request) (tunnel *Tunnel, stick bool) {
+	r.mu.RLock()
+	group := r.tunnels[subdomain]
+	var tunnels []*Tunnel
+	if group != nil {
+		tunnels = group.tunnels
+	}
+	r.mu.RUnlock()
+
+	switch len(tunnels) {
+	case 0:
+		return nil, false
+	case 1:
+		return tunnels[0], false
+	}
+
+	candidates := make([]*Tunnel, 0, len(tunnels))
+	for _, t := range tunnels {
+		if !tunnelDown(t) {
+			candidates = append(candidates, t)
+		}
+	}
+	if len(candidates) == 0 {
+		// Health checks may be wrong; let the visitor see what happens
+		candidates = tunnels
+	}
+
+	sticky := r.server.cfg.Server.SharedSubdomains.StickySessions
+	if sticky {
+		if c, err := req.Cookie(stickyCookieName); err == nil {
+			for _, t := range candidates {
+				if stickyKey(t) == c.Value {
+					return t, false
+				}
+			}
+		}
+	}
+
+	n := group.next.Add(1) - 1
+	return candidates[n%uint64(len(candidates))], sticky
+}
+
+// setStickyCookie pins the visitor to tunnel for the rest of the browser
+// session.
+func setStickyCookie(w http.ResponseWriter, tunnel *Tunnel) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     stickyCookieName,
+		Value:    stickyKey(tunnel),
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
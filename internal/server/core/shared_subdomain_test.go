@@ -0,0 +1,92 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+)
+
+func TestRegisterTunnel_SharedSubdomain(t *testing.T) {
+	router, srv := newTestRouter("example.com")
+	defer srv.cancel()
+
+	first := &Tunnel{ID: "t1", ClientID: "c1", userID: 7}
+	require.NoError(t, router.RegisterTunnel("app", first))
+	assert.Error(t, router.RegisterTunnel("app", &Tunnel{ID: "t2", ClientID: "c2", userID: 7}), "sharing is disabled")
+
+	srv.cfg.Server.SharedSubdomains.Enabled = true
+	require.NoError(t, router.RegisterTunnel("APP", &Tunnel{ID: "t2", ClientID: "c2", userID: 7}))
+	assert.Error(t, router.RegisterTunnel("app", &Tunnel{ID: "t3", ClientID: "c3", userID: 8}), "another user")
+	assert.Error(t, router.RegisterTunnel("app", &Tunnel{ID: "t4", ClientID: "c4"}), "no account")
+	assert.Len(t, router.GetTunnels("app"), 2)
+
+	router.UnregisterTunnel("app", "t1")
+	require.Len(t, router.GetTunnels("app"), 1)
+	assert.Equal(t, "t2", router.GetTunnel("app").ID)
+
+	router.UnregisterTunnel("app", "t2")
+	assert.Nil(t, router.GetTunnel("app"))
+	require.NoError(t, router.RegisterTunnel("app", &Tunnel{ID: "t3", ClientID: "c3", userID: 8}), "free again")
+}
+
+func TestPickTunnel(t *testing.T) {
+	router, srv := newTestRouter("example.com")
+	defer srv.cancel()
+	srv.cfg.Server.SharedSubdomains = config.SharedSubdomainSettings{Enabled: true, StickySessions: true}
+
+	t1 := &Tunnel{ID: "t1", ClientID: "c1", userID: 7}
+	t2 := &Tunnel{ID: "t2", ClientID: "c2", userID: 7}
+	require.NoError(t, router.RegisterTunnel("app", t1))
+
+	req := httptest.NewRequest(http.MethodGet, "http://app.example.com/", nil)
+	got, stick := router.pickTunnel("app", req)
+	assert.Same(t, t1, got)
+	assert.False(t, stick, "no cookie for a subdomain with a single tunnel")
+
+	require.NoError(t, router.RegisterTunnel("app", t2))
+	seen := map[string]int{}
+	for i := 0; i < 4; i++ {
+		got, stick = router.pickTunnel("app", req)
+		assert.True(t, stick)
+		seen[got.ID]++
+	}
+	assert.Equal(t, map[string]int{"t1": 2, "t2": 2}, seen, "round-robin")
+
+	pinned := httptest.NewRequest(http.MethodGet, "http://app.example.com/", nil)
+	pinned.AddCookie(&http.Cookie{Name: stickyCookieName, Value: stickyKey(t2)})
+	for i := 0; i < 3; i++ {
+		got, stick = router.pickTunnel("app", pinned)
+		assert.Same(t, t2, got)
+		assert.False(t, stick, "the visitor already has the cookie")
+	}
+
+	// A failing health check moves pinned visitors to the others
+	t2.health = &tunnelHealth{done: make(chan struct{})}
+	t2.health.record(HealthSample{Status: HealthStatusDown})
+	got, stick = router.pickTunnel("app", pinned)
+	assert.Same(t, t1, got)
+	assert.True(t, stick)
+
+	// So does the tunnel going away
+	t2.health = nil
+	router.UnregisterTunnel("app", "t2")
+	got, stick = router.pickTunnel("app", pinned)
+	assert.Same(t, t1, got)
+	assert.False(t, stick)
+}
+
+func TestSetStickyCookie(t *testing.T) {
+	w := httptest.NewRecorder()
+	setStickyCookie(w, &Tunnel{ID: "t1"})
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, stickyCookieName, cookies[0].Name)
+	assert.Equal(t, stickyKey(&Tunnel{ID: "t1"}), cookies[0].Value)
+	assert.NotContains(t, cookies[0].Value, "t1")
+	assert.True(t, cookies[0].HttpOnly)
+}
@@ -0,0 +1,73 @@
+package core
+
+import (
+	"io"
+	"net"
+	"time"
+
+	"github.com/mephistofox/fxtun.dev/internal/logging"
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+// sinkChunk is the zero-filled buffer sink tunnels stream from. It is only
+// ever read, so one copy is shared by all connections.
+var sinkChunk = make([]byte, 64*1024)
+
+// serveSink answers a connection to a sink tunnel on the server itself:
+// everything the peer uploads is discarded while tunnel.SinkBytes zero bytes
+// are streamed back, followed by a half-close. Throughput for both
+// directions is logged when the connection ends.
+func (m *TCPManager) serveSink(conn net.Conn, tunnel *Tunnel) {
+	start := time.Now()
+
+	uploaded := make(chan int64, 1)
+	go func() {
+		n, _ := io.Copy(io.Discard, conn)
+		uploaded <- n
+	}()
+
+	downloaded := writeSinkBytes(conn, tunnel.SinkBytes)
+	_ = protocol.CloseWrite(conn)
+	up := <-uploaded
+	tunnel.countIn(up)
+	tunnel.countOut(downloaded)
+
+	elapsed := time.Since(start)
+	tunnel.LastActivity.Store(time.Now().UnixNano())
+
+	m.log.Info().
+		Str("tunnel_id", tunnel.ID).
+		Str("remote_ip", logging.RemoteIP(conn.RemoteAddr().String())).
+		Int64("uploaded", up).
+		Int64("downloaded", downloaded).
+		Dur("duration", elapsed).
+		Float64("upload_mbps", sinkMbps(up, elapsed)).
+		Float64("download_mbps", sinkMbps(downloaded, elapsed)).
+		Msg("Sink connection completed")
+}
+
+// writeSinkBytes writes n zero bytes to w and returns how many were written
+// before the first error.
+func writeSinkBytes(w io.Writer, n int64) int64 {
+	var written int64
+	for written < n {
+		chunk := sinkChunk
+		if rest := n - written; rest < int64(len(chunk)) {
+			chunk = chunk[:rest]
+		}
+		k, err := w.Write(chunk)
+		written += int64(k)
+		if err != nil {
+			break
+		}
+	}
+	return written
+}
+
+// sinkMbps converts a byte count over a duration to megabits per second.
+func sinkMbps(bytes int64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(bytes) * 8 / 1e6 / d.Seconds()
+}
@@ -0,0 +1,53 @@
+package core
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeSink(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	m := &TCPManager{log: zerolog.Nop()}
+	tunnel := &Tunnel{ID: "sink-1", SinkBytes: 200_000}
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		m.serveSink(conn, tunnel)
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write(make([]byte, 100_000))
+	require.NoError(t, err)
+	require.NoError(t, conn.(*net.TCPConn).CloseWrite())
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	got, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Len(t, got, 200_000)
+	assert.Equal(t, make([]byte, 200_000), got, "sink streams zero bytes")
+
+	<-served
+	assert.NotZero(t, tunnel.LastActivity.Load())
+}
+
+func TestWriteSinkBytes(t *testing.T) {
+	assert.Equal(t, int64(0), writeSinkBytes(io.Discard, 0))
+	assert.Equal(t, int64(len(sinkChunk)*3+7), writeSinkBytes(io.Discard, int64(len(sinkChunk)*3+7)))
+}
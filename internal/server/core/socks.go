@@ -0,0 +1,278 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/yamux"
+	"golang.org/x/time/rate"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+const (
+	// outboundHeaderTimeout bounds how long a client-opened stream may take
+	// to send its stream header.
+	outboundHeaderTimeout = 10 * time.Second
+
+	// defaultSOCKSDialTimeout applies when server.socks.dial_timeout is 0.
+	defaultSOCKSDialTimeout = 10 * time.Second
+)
+
+// outboundLimits caps the outbound connections of one client's socks
+// tunnels (server.socks.dials_per_min and max_conns).
+type outboundLimits struct {
+	dials    *rate.Limiter // nil without a rate limit
+	conns    atomic.Int64
+	maxConns int64
+}
+
+func newOutboundLimits(cfg config.SOCKSSettings) *outboundLimits {
+	l := &outboundLimits{maxConns: int64(cfg.MaxConns)}
+	if cfg.DialsPerMin > 0 {
+		l.dials = rate.NewLimiter(rate.Every(time.Minute/time.Duration(cfg.DialsPerMin)), cfg.DialsPerMin)
+	}
+	return l
+}
+
+// acquire takes a connection slot. It returns an error naming the limit
+// that was hit; otherwise release must be called when the connection ends.
+func (l *outboundLimits) acquire() error {
+	if l.dials != nil && !l.dials.Allow() {
+		return fmt.Errorf("too many outbound connections per minute")
+	}
+	if n := l.conns.Add(1); l.maxConns > 0 && n > l.maxConns {
+		l.conns.Add(-1)
+		return fmt.Errorf("too many open outbound connections (max %d)", l.maxConns)
+	}
+	return nil
+}
+
+func (l *outboundLimits) release() {
+	l.conns.Add(-1)
+}
+
+// createSOCKSTunnel registers a socks tunnel. It has no address on the
+// server: the client opens a stream for each connection to its local
+// SOCKS5 proxy and the server dials the destination (see handleOutbound).
+func (c *Client) createSOCKSTunnel(req *protocol.TunnelRequestMessage) {
+	if !c.server.cfg.Server.SOCKS.Enabled {
+		c.rejectTunnel(req, protocol.ErrCodePermissionDenied, "socks tunnels are disabled on this server")
+		return
+	}
+	if req.HealthCheck != "" {
+		c.rejectTunnel(req, protocol.ErrCodeProtocolError, "health checks are not supported for socks tunnels")
+		return
+	}
+
+	tunnelID := generateID()
+	tunnel := &Tunnel{
+		ID:        tunnelID,
+		ClientID:  c.ID,
+		Type:      protocol.TunnelSOCKS,
+		Name:      req.Name,
+		LocalPort: req.LocalPort,
+		Created:   time.Now(),
+		usage:     c.tunnelUsage(),
+	}
+
+	// Parse auto-close duration
+	if req.AutoClose != "" {
+		d, err := parseTunnelDuration(req.AutoClose)
+		if err != nil {
+			c.rejectTunnel(req, protocol.ErrCodeProtocolError, fmt.Sprintf("invalid auto_close: %v", err))
+			return
+		}
+		tunnel.AutoClose = d
+	}
+
+	// Parse max-lifetime duration
+	if req.MaxLifetime != "" {
+		d, err := parseTunnelDuration(req.MaxLifetime)
+		if err != nil {
+			c.rejectTunnel(req, protocol.ErrCodeProtocolError, fmt.Sprintf("invalid max_lifetime: %v", err))
+			return
+		}
+		tunnel.MaxLifetime = d
+	}
+
+	// Initialize LastActivity to creation time
+	tunnel.LastActivity.Store(time.Now().UnixNano())
+
+	c.TunnelsMu.Lock()
+	c.Tunnels[tunnelID] = tunnel
+	c.TunnelsMu.Unlock()
+
+	c.registerTunnelMonitor(tunnel)
+
+	resp := &protocol.TunnelCreatedMessage{
+		Message:     protocol.NewMessage(protocol.MsgTunnelCreated),
+		TunnelID:    tunnelID,
+		TunnelType:  protocol.TunnelSOCKS,
+		Name:        req.Name,
+		AutoClose:   req.AutoClose,
+		MaxLifetime: req.MaxLifetime,
+	}
+	resp.RequestID = req.RequestID
+
+	c.replyTunnel(resp)
+	c.log.Info().Str("tunnel_id", tunnelID).Msg("SOCKS tunnel created")
+	c.registerTunnelInRegistry(tunnel)
+	c.emitTunnelEvent(config.WebhookTunnelCreated, tunnel, "")
+	c.server.clientMgr.checkTunnelCount(c.UserID)
+}
+
+// acceptOutbound takes the streams the client opens on session for its
+// socks tunnels, until the session ends.
+func (c *Client) acceptOutbound(session *yamux.Session) {
+	for {
+		stream, err := session.Accept()
+		if err != nil {
+			return
+		}
+		go c.handleOutbound(stream)
+	}
+}
+
+// socksTunnel returns the client's socks tunnel with the given ID, or nil.
+func (c *Client) socksTunnel(tunnelID string) *Tunnel {
+	c.TunnelsMu.RLock()
+	defer c.TunnelsMu.RUnlock()
+	if t := c.Tunnels[tunnelID]; t != nil && t.Type == protocol.TunnelSOCKS {
+		return t
+	}
+	return nil
+}
+
+// outboundLimits returns the client's outbound connection limits, created
+// on first use.
+func (c *Client) outboundLimits() *outboundLimits {
+	c.outboundOnce.Do(func() {
+		c.outbound = newOutboundLimits(c.server.cfg.Server.SOCKS)
+	})
+	return c.outbound
+}
+
+// handleOutbound serves one stream of a socks tunnel: it reads the
+// destination from the stream header, checks it against the limits and the
+// destination policy, dials it and proxies the stream to it.
+func (c *Client) handleOutbound(stream net.Conn) {
+	defer c.server.trackConn()()
+	defer stream.Close()
+
+	_ = stream.SetReadDeadline(time.Now().Add(outboundHeaderTimeout))
+	hdr, err := protocol.ReadStreamHeader(stream)
+	if err != nil {
+		c.log.Debug().Err(err).Msg("Failed to read outbound stream header")
+		return
+	}
+	_ = stream.SetReadDeadline(time.Time{})
+
+	refuse := func(code byte, reason string) {
+		c.log.Debug().Str("tunnel_id", hdr.TunnelID).Str("destination", hdr.RemoteAddr).Str("reason", reason).
+			Msg("Outbound connection refused")
+		_ = protocol.WriteDialReply(stream, code, reason)
+	}
+
+	tunnel := c.socksTunnel(hdr.TunnelID)
+	if tunnel == nil {
+		refuse(protocol.DialNotAllowed, "unknown socks tunnel")
+		return
+	}
+	if hdr.Compressed {
+		refuse(protocol.DialFailed, "compressed outbound streams are not supported")
+		return
+	}
+	if !tunnel.conns.acquire(stream) {
+		refuse(protocol.DialFailed, "tunnel is closing")
+		return
+	}
+	defer tunnel.conns.release(stream)
+
+	limits := c.outboundLimits()
+	if err := limits.acquire(); err != nil {
+		refuse(protocol.DialNotAllowed, err.Error())
+		return
+	}
+	defer limits.release()
+
+	if c.refuseOverQuota(tunnel) {
+		refuse(protocol.DialNotAllowed, "monthly traffic quota exceeded")
+		return
+	}
+
+	dest, err := c.server.dialOutbound(c.ctx, hdr.RemoteAddr)
+	if err != nil {
+		refuse(dialReplyCode(err), err.Error())
+		return
+	}
+	defer dest.Close()
+
+	if err := protocol.WriteDialReply(stream, protocol.DialSucceeded, ""); err != nil {
+		return
+	}
+	tuneTCPConn(dest)
+
+	// Traffic from the destination counts as in, towards the client
+	done := make(chan struct{}, 2)
+
+	go func() {
+		bp := proxyBufPool.Get().(*[]byte)
+		n, _ := io.CopyBuffer(dest, stream, *bp)
+		proxyBufPool.Put(bp)
+		tunnel.countOut(n)
+		done <- struct{}{}
+	}()
+
+	go func() {
+		bp := proxyBufPool.Get().(*[]byte)
+		n, _ := io.CopyBuffer(stream, dest, *bp)
+		proxyBufPool.Put(bp)
+		tunnel.countIn(n)
+		done <- struct{}{}
+	}()
+
+	<-done
+	// Close both to unblock the other goroutine
+	_ = dest.Close()
+	_ = stream.Close()
+	<-done
+
+	// Update LastActivity timestamp for auto-close tracking
+	tunnel.LastActivity.Store(time.Now().UnixNano())
+
+	c.server.tcpManager.connLog.Debug().
+		Str("tunnel_id", tunnel.ID).
+		Str("destination", hdr.RemoteAddr).
+		Msg("Outbound connection completed")
+}
+
+// dialOutbound connects to dest (host:port) for a socks tunnel, within the
+// destination policy and server.socks.dial_timeout.
+func (s *Server) dialOutbound(ctx context.Context, dest string) (net.Conn, error) {
+	timeout := s.cfg.Server.SOCKS.DialTimeout
+	if timeout <= 0 {
+		timeout = defaultSOCKSDialTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	addrs, err := s.socksPolicy.resolve(ctx, net.DefaultResolver, dest)
+	if err != nil {
+		return nil, err
+	}
+	var d net.Dialer
+	for _, addr := range addrs {
+		var conn net.Conn
+		conn, err = d.DialContext(ctx, "tcp", addr)
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
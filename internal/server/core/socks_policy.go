@@ -0,0 +1,209 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+// errDestinationNotAllowed refuses an outbound connection by policy.
+var errDestinationNotAllowed = errors.New("destination not allowed")
+
+// socksRules is one side (allow or deny) of the socks destination policy.
+type socksRules struct {
+	nets    []*net.IPNet
+	domains []string
+}
+
+func newSOCKSRules(rules []string) socksRules {
+	var r socksRules
+	for _, rule := range rules {
+		if ip := net.ParseIP(rule); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			r.nets = append(r.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		if _, n, err := net.ParseCIDR(rule); err == nil {
+			r.nets = append(r.nets, n)
+			continue
+		}
+		r.domains = append(r.domains, strings.ToLower(strings.TrimSuffix(rule, ".")))
+	}
+	return r
+}
+
+func (r socksRules) empty() bool {
+	return len(r.nets) == 0 && len(r.domains) == 0
+}
+
+func (r socksRules) matchIP(ip net.IP) bool {
+	for _, n := range r.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchDomain reports whether host is one of the domains or below one.
+func (r socksRules) matchDomain(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, d := range r.domains {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// nonPublicNets are special-purpose ranges net.IP has no predicate for:
+// shared carrier-grade NAT space, which often holds a provider's internal
+// hosts, documentation and benchmarking ranges, reserved space, and the
+// IPv6 prefixes that translate to IPv4 addresses the policy cannot see.
+var nonPublicNets = func() []*net.IPNet {
+	cidrs := []string{
+		"0.0.0.0/8",
+		"100.64.0.0/10",
+		"192.0.0.0/24",
+		"192.0.2.0/24",
+		"198.18.0.0/15",
+		"198.51.100.0/24",
+		"203.0.113.0/24",
+		"240.0.0.0/4",
+		"64:ff9b::/96",
+		"64:ff9b:1::/48",
+		"100::/64",
+		"2001::/32",
+		"2001:db8::/32",
+		"2002::/16",
+	}
+	nets := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, nets[i], _ = net.ParseCIDR(cidr)
+	}
+	return nets
+}()
+
+func isNonPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return true
+	}
+	for _, n := range nonPublicNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// socksPolicy decides which destinations socks tunnels may connect to
+// (server.socks).
+type socksPolicy struct {
+	allow     socksRules
+	deny      socksRules
+	denyPorts map[int]struct{}
+}
+
+func newSOCKSPolicy(cfg config.SOCKSSettings) *socksPolicy {
+	p := &socksPolicy{
+		allow:     newSOCKSRules(cfg.Allow),
+		deny:      newSOCKSRules(cfg.Deny),
+		denyPorts: make(map[int]struct{}, len(cfg.DenyPorts)),
+	}
+	for _, port := range cfg.DenyPorts {
+		p.denyPorts[port] = struct{}{}
+	}
+	return p
+}
+
+// allowsIP reports whether ip may be dialed. named tells that the
+// destination was given as a domain the allow list matches. Addresses
+// inside the server's networks and other non-public ranges are only
+// reachable through an allowed CIDR.
+func (p *socksPolicy) allowsIP(ip net.IP, named bool) bool {
+	if p.deny.matchIP(ip) {
+		return false
+	}
+	if p.allow.matchIP(ip) {
+		return true
+	}
+	if isNonPublicIP(ip) {
+		return false
+	}
+	return named || p.allow.empty()
+}
+
+// resolve checks dest (host:port) against the policy and returns the
+// addresses it may be dialed at. Host names are resolved here and every
+// address is checked, so a name cannot smuggle in an address the policy
+// refuses.
+func (p *socksPolicy) resolve(ctx context.Context, resolver *net.Resolver, dest string) ([]string, error) {
+	host, portStr, err := net.SplitHostPort(dest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid destination %q: %w", dest, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return nil, fmt.Errorf("invalid destination port %q", portStr)
+	}
+	if _, denied := p.denyPorts[port]; denied {
+		return nil, fmt.Errorf("%w: port %d", errDestinationNotAllowed, port)
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		if !p.allowsIP(ip, false) {
+			return nil, fmt.Errorf("%w: %s", errDestinationNotAllowed, ip)
+		}
+		return []string{net.JoinHostPort(ip.String(), portStr)}, nil
+	}
+
+	if p.deny.matchDomain(host) {
+		return nil, fmt.Errorf("%w: %s", errDestinationNotAllowed, host)
+	}
+	named := p.allow.matchDomain(host)
+	ips, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		if !p.allowsIP(ip.IP, named) {
+			return nil, fmt.Errorf("%w: %s resolves to %s", errDestinationNotAllowed, host, ip.IP)
+		}
+		addrs = append(addrs, net.JoinHostPort(ip.IP.String(), portStr))
+	}
+	return addrs, nil
+}
+
+// dialReplyCode maps an outbound dial error to the dial reply the client
+// passes on to its SOCKS5 peer.
+func dialReplyCode(err error) byte {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, errDestinationNotAllowed):
+		return protocol.DialNotAllowed
+	case errors.As(err, &dnsErr):
+		return protocol.DialHostUnreachable
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return protocol.DialTimedOut
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return protocol.DialConnectionRefused
+	case errors.Is(err, syscall.ENETUNREACH):
+		return protocol.DialNetworkUnreachable
+	case errors.Is(err, syscall.EHOSTUNREACH):
+		return protocol.DialHostUnreachable
+	}
+	return protocol.DialFailed
+}
@@ -0,0 +1,185 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+func TestSOCKSPolicy_Resolve(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.SOCKSSettings
+		dest    string
+		allowed bool
+	}{
+		{"public address", config.SOCKSSettings{}, "93.184.216.34:443", true},
+		{"loopback", config.SOCKSSettings{}, "127.0.0.1:80", false},
+		{"loopback ipv6", config.SOCKSSettings{}, "[::1]:80", false},
+		{"private", config.SOCKSSettings{}, "10.0.0.5:80", false},
+		{"metadata service", config.SOCKSSettings{}, "169.254.169.254:80", false},
+		{"carrier-grade nat", config.SOCKSSettings{}, "100.64.0.1:80", false},
+		{"documentation range", config.SOCKSSettings{}, "198.51.100.1:80", false},
+		{"reserved", config.SOCKSSettings{}, "240.0.0.1:80", false},
+		{"ipv4-mapped private", config.SOCKSSettings{}, "[::ffff:10.0.0.5]:80", false},
+		{"nat64 of a private address", config.SOCKSSettings{}, "[64:ff9b::a00:5]:80", false},
+		{"6to4 of a private address", config.SOCKSSettings{}, "[2002:a00:5::1]:80", false},
+		{"allowed carrier-grade nat", config.SOCKSSettings{Allow: []string{"100.64.0.0/10"}}, "100.64.0.1:80", true},
+		{"denied port", config.SOCKSSettings{DenyPorts: []int{25}}, "93.184.216.34:25", false},
+		{"allowed cidr", config.SOCKSSettings{Allow: []string{"203.0.113.0/24"}}, "203.0.113.5:80", true},
+		{"outside the allow list", config.SOCKSSettings{Allow: []string{"203.0.113.0/24"}}, "198.51.100.1:80", false},
+		{"allowed loopback", config.SOCKSSettings{Allow: []string{"127.0.0.1"}}, "127.0.0.1:8080", true},
+		{"denied cidr", config.SOCKSSettings{Deny: []string{"198.51.100.0/24"}}, "198.51.100.1:80", false},
+		{"deny wins over allow", config.SOCKSSettings{Allow: []string{"198.51.100.1"}, Deny: []string{"198.51.100.0/24"}}, "198.51.100.1:80", false},
+		{"denied domain", config.SOCKSSettings{Deny: []string{"blocked.test"}}, "www.blocked.test:80", false},
+		{"name of a loopback address", config.SOCKSSettings{}, "localhost:80", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addrs, err := newSOCKSPolicy(tt.cfg).resolve(context.Background(), net.DefaultResolver, tt.dest)
+			if tt.allowed {
+				require.NoError(t, err)
+				assert.Len(t, addrs, 1)
+				return
+			}
+			assert.ErrorIs(t, err, errDestinationNotAllowed)
+		})
+	}
+}
+
+func TestSOCKSPolicy_InvalidDestination(t *testing.T) {
+	p := newSOCKSPolicy(config.SOCKSSettings{})
+	_, err := p.resolve(context.Background(), net.DefaultResolver, "example.com")
+	assert.Error(t, err)
+	_, err = p.resolve(context.Background(), net.DefaultResolver, "example.com:0")
+	assert.Error(t, err)
+}
+
+func TestDialReplyCode(t *testing.T) {
+	assert.Equal(t, protocol.DialNotAllowed, dialReplyCode(fmt.Errorf("%w: 10.0.0.1", errDestinationNotAllowed)))
+	assert.Equal(t, protocol.DialConnectionRefused, dialReplyCode(&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}))
+	assert.Equal(t, protocol.DialHostUnreachable, dialReplyCode(&net.DNSError{Err: "no such host", Name: "nowhere.test"}))
+	assert.Equal(t, protocol.DialFailed, dialReplyCode(io.ErrUnexpectedEOF))
+}
+
+func TestOutboundLimits(t *testing.T) {
+	l := newOutboundLimits(config.SOCKSSettings{MaxConns: 2})
+	require.NoError(t, l.acquire())
+	require.NoError(t, l.acquire())
+	assert.Error(t, l.acquire(), "a third open connection is over max_conns")
+	l.release()
+	assert.NoError(t, l.acquire())
+
+	l = newOutboundLimits(config.SOCKSSettings{DialsPerMin: 2})
+	require.NoError(t, l.acquire())
+	l.release()
+	require.NoError(t, l.acquire())
+	l.release()
+	assert.Error(t, l.acquire(), "a third dial in the same minute is over dials_per_min")
+}
+
+// socksTestClient authenticates to srv and opens a socks tunnel. dial sends
+// a stream for a destination through it and reads the dial reply.
+func socksTestClient(t *testing.T, srv *Server) (*protocol.TunnelCreatedMessage, func(dest string) (net.Conn, byte, string)) {
+	t.Helper()
+
+	session := dialServer(t, srv)
+	t.Cleanup(func() { session.Close() })
+	codec, _ := openControlStream(t, session)
+	require.NoError(t, codec.Encode(&protocol.AuthMessage{Message: protocol.NewMessage(protocol.MsgAuth)}))
+	var auth protocol.AuthResultMessage
+	require.NoError(t, codec.Decode(&auth))
+	require.True(t, auth.Success, auth.Error)
+
+	require.NoError(t, codec.Encode(&protocol.TunnelRequestMessage{
+		Message:    protocol.NewMessage(protocol.MsgTunnelRequest),
+		TunnelType: protocol.TunnelSOCKS,
+		LocalPort:  1080,
+	}))
+	var created protocol.TunnelCreatedMessage
+	require.NoError(t, codec.Decode(&created))
+
+	dial := func(dest string) (net.Conn, byte, string) {
+		stream, err := session.Open()
+		require.NoError(t, err)
+		require.NoError(t, protocol.WriteStreamHeader(stream, created.TunnelID, dest))
+		code, reason, err := protocol.ReadDialReply(stream)
+		require.NoError(t, err)
+		return stream, code, reason
+	}
+	return &created, dial
+}
+
+func TestSOCKSTunnel_Outbound(t *testing.T) {
+	srv := resumeTestServer(t, 0)
+	srv.cfg.Server.SOCKS = config.SOCKSSettings{Enabled: true, Allow: []string{"127.0.0.1"}}
+	srv.socksPolicy = newSOCKSPolicy(srv.cfg.Server.SOCKS)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	created, dial := socksTestClient(t, srv)
+	require.Equal(t, protocol.MsgTunnelCreated, created.Type)
+	assert.Equal(t, protocol.TunnelSOCKS, created.TunnelType)
+
+	stream, code, reason := dial(ln.Addr().String())
+	defer stream.Close()
+	require.Equal(t, protocol.DialSucceeded, code, reason)
+	_, err = stream.Write([]byte("ping"))
+	require.NoError(t, err)
+	buf := make([]byte, 4)
+	require.NoError(t, stream.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, err = io.ReadFull(stream, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(buf))
+
+	denied, code, _ := dial("10.0.0.1:80")
+	defer denied.Close()
+	assert.Equal(t, protocol.DialNotAllowed, code, "private addresses outside the allow list are refused")
+}
+
+func TestSOCKSTunnel_Disabled(t *testing.T) {
+	srv := resumeTestServer(t, 0)
+
+	session := dialServer(t, srv)
+	defer session.Close()
+	codec, _ := openControlStream(t, session)
+	require.NoError(t, codec.Encode(&protocol.AuthMessage{Message: protocol.NewMessage(protocol.MsgAuth)}))
+	var auth protocol.AuthResultMessage
+	require.NoError(t, codec.Decode(&auth))
+	require.True(t, auth.Success, auth.Error)
+
+	require.NoError(t, codec.Encode(&protocol.TunnelRequestMessage{
+		Message:    protocol.NewMessage(protocol.MsgTunnelRequest),
+		TunnelType: protocol.TunnelSOCKS,
+		LocalPort:  1080,
+	}))
+	var rejected protocol.TunnelErrorMessage
+	require.NoError(t, codec.Decode(&rejected))
+	assert.Equal(t, protocol.MsgTunnelError, rejected.Type)
+	assert.Equal(t, protocol.ErrCodePermissionDenied, rejected.Code)
+}
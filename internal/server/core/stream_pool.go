@@ -2,9 +2,12 @@ package core
 
 import (
 	"net"
+	"slices"
 	"time"
 
 	"github.com/hashicorp/yamux"
+
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
 )
 
 const streamPoolSize = 256
@@ -21,9 +24,32 @@ func (c *Client) OpenStream() (net.Conn, error) {
 	}
 }
 
-// openStreamRoundRobin opens a stream from one of the available sessions using round-robin.
+// writeStreamHeader sends the stream header and, when per-stream compression
+// was negotiated for this client and the tunnel does not opt out of it,
+// returns the stream wrapped for framed compression. Callers must use the
+// returned conn for the rest of the stream.
+func (c *Client) writeStreamHeader(stream net.Conn, tunnel *Tunnel, remoteAddr string) (net.Conn, error) {
+	if c.streamCompressThreshold <= 0 || tunnel.noCompress {
+		return stream, protocol.WriteStreamHeader(stream, tunnel.ID, remoteAddr)
+	}
+	if err := protocol.WriteCompressedStreamHeader(stream, tunnel.ID, remoteAddr); err != nil {
+		return nil, err
+	}
+	return protocol.NewCompressedStream(stream, c.streamCompressThreshold), nil
+}
+
+// skipsCompression reports whether a tunnel's streams stay out of per-stream
+// compression, because the client asked or the server skips its type.
+func (s *Server) skipsCompression(req *protocol.TunnelRequestMessage) bool {
+	return req.NoCompression || slices.Contains(s.cfg.Server.StreamCompressionSkipTypes, string(req.TunnelType))
+}
+
+// openStreamRoundRobin opens a stream from one of the data sessions using
+// round-robin. The primary session carries the control stream, so it is only
+// used when the client has no live data session: keeping bulk transfers off
+// it means pings and tunnel requests never queue behind data frames.
 func (c *Client) openStreamRoundRobin() (net.Conn, error) {
-	sessions := c.allSessions()
+	primary, sessions := c.sessionsByRole()
 	n := uint32(len(sessions)) //nolint:gosec // length is bounded by pool size
 	idx := c.sessionIdx.Add(1)
 	// Try starting from idx, fall through to others on error
@@ -34,11 +60,23 @@ func (c *Client) openStreamRoundRobin() (net.Conn, error) {
 		}
 		stream, err := s.Open()
 		if err == nil {
-			return stream, nil
+			return c.server.stats.trackStream(stream, &c.pressure), nil
 		}
 	}
 	// Last resort: primary session
-	return c.Session.Open()
+	stream, err := primary.Open()
+	if err != nil {
+		return nil, err
+	}
+	return c.server.stats.trackStream(stream, &c.pressure), nil
+}
+
+// sessionsByRole returns the primary session and a snapshot of the data
+// sessions.
+func (c *Client) sessionsByRole() (*yamux.Session, []*yamux.Session) {
+	c.DataMu.RLock()
+	defer c.DataMu.RUnlock()
+	return c.Session, slices.Clone(c.DataSessions)
 }
 
 // allSessions returns the primary session plus all data sessions.
@@ -54,6 +92,9 @@ func (c *Client) allSessions() []*yamux.Session {
 // startStreamPool launches a background goroutine that keeps the stream pool full.
 func (c *Client) startStreamPool() {
 	c.streamPool = make(chan net.Conn, streamPoolSize)
+	if c.server.noStreamPool {
+		return
+	}
 	go c.refillStreamPool()
 }
 
@@ -61,15 +102,8 @@ func (c *Client) refillStreamPool() {
 	for {
 		select {
 		case <-c.ctx.Done():
-			// Drain and close pooled streams
-			for {
-				select {
-				case s := <-c.streamPool:
-					s.Close()
-				default:
-					return
-				}
-			}
+			c.drainStreamPool()
+			return
 		default:
 		}
 
@@ -102,3 +136,16 @@ func (c *Client) refillStreamPool() {
 		}
 	}
 }
+
+// drainStreamPool closes all pooled streams. It is also used when the primary
+// session is replaced, since streams pre-opened on it are no longer usable.
+func (c *Client) drainStreamPool() {
+	for {
+		select {
+		case s := <-c.streamPool:
+			s.Close()
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package core
+
+import (
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/yamux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+func TestWriteStreamHeader_NoCompression(t *testing.T) {
+	srv := &Server{cfg: &config.ServerConfig{}}
+	c := &Client{server: srv, streamCompressThreshold: 256}
+
+	web := &Tunnel{ID: "web", noCompress: srv.skipsCompression(&protocol.TunnelRequestMessage{TunnelType: protocol.TunnelHTTP})}
+	tls := &Tunnel{ID: "tls", noCompress: srv.skipsCompression(&protocol.TunnelRequestMessage{TunnelType: protocol.TunnelTCP, NoCompression: true})}
+
+	header := func(tunnel *Tunnel) (*protocol.StreamHeader, bool) {
+		serverEnd, clientEnd := net.Pipe()
+		t.Cleanup(func() { serverEnd.Close(); clientEnd.Close() })
+		written := make(chan net.Conn, 1)
+		go func() {
+			conn, err := c.writeStreamHeader(serverEnd, tunnel, "198.51.100.7:40000")
+			assert.NoError(t, err)
+			written <- conn
+		}()
+		hdr, err := protocol.ReadStreamHeader(clientEnd)
+		require.NoError(t, err)
+		return hdr, <-written != serverEnd
+	}
+
+	hdr, wrapped := header(web)
+	assert.Equal(t, "web", hdr.TunnelID)
+	assert.True(t, hdr.Compressed)
+	assert.True(t, wrapped)
+
+	hdr, wrapped = header(tls)
+	assert.Equal(t, "tls", hdr.TunnelID)
+	assert.False(t, hdr.Compressed)
+	assert.False(t, wrapped)
+}
+
+func TestServer_SkipsCompression(t *testing.T) {
+	srv := &Server{cfg: &config.ServerConfig{}}
+	srv.cfg.Server.StreamCompressionSkipTypes = []string{"tcp"}
+
+	assert.True(t, srv.skipsCompression(&protocol.TunnelRequestMessage{TunnelType: protocol.TunnelTCP}))
+	assert.False(t, srv.skipsCompression(&protocol.TunnelRequestMessage{TunnelType: protocol.TunnelHTTP}))
+	assert.True(t, srv.skipsCompression(&protocol.TunnelRequestMessage{TunnelType: protocol.TunnelHTTP, NoCompression: true}))
+}
+
+// yamuxPair returns the server and client ends of a yamux session over an
+// in-memory connection.
+func yamuxPair(t *testing.T) (*yamux.Session, *yamux.Session) {
+	t.Helper()
+	serverConn, clientConn := net.Pipe()
+	cfg := yamux.DefaultConfig()
+	cfg.EnableKeepAlive = false
+	cfg.LogOutput = io.Discard
+	server, err := yamux.Server(serverConn, cfg)
+	require.NoError(t, err)
+	client, err := yamux.Client(clientConn, cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close(); server.Close() })
+	return server, client
+}
+
+func TestOpenStream_KeepsDataOffControlSession(t *testing.T) {
+	primary, peerPrimary := yamuxPair(t)
+	data, peerData := yamuxPair(t)
+	c := &Client{server: &Server{}, Session: primary, DataSessions: []*yamux.Session{data}}
+
+	// The tunnel client opens the control stream on the primary session
+	controlStream, err := peerPrimary.Open()
+	require.NoError(t, err)
+	serverControl, err := primary.AcceptStream()
+	require.NoError(t, err)
+	go func() {
+		codec := protocol.NewCodec(serverControl, serverControl)
+		for {
+			var ping protocol.PingMessage
+			if codec.Decode(&ping) != nil {
+				return
+			}
+			if codec.Encode(&protocol.PongMessage{Message: protocol.NewMessage(protocol.MsgPong)}) != nil {
+				return
+			}
+		}
+	}()
+
+	// A bulk transfer to the client runs until the test ends
+	go func() {
+		for {
+			stream, err := peerData.AcceptStream()
+			if err != nil {
+				return
+			}
+			go func() { _, _ = io.Copy(io.Discard, stream) }()
+		}
+	}()
+	var sent atomic.Int64
+	stop := make(chan struct{})
+	defer close(stop)
+	for range 4 {
+		stream, err := c.OpenStream()
+		require.NoError(t, err)
+		go func() {
+			defer stream.Close()
+			chunk := make([]byte, 256*1024)
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				n, err := stream.Write(chunk)
+				if err != nil {
+					return
+				}
+				sent.Add(int64(n))
+			}
+		}()
+	}
+	require.Eventually(t, func() bool { return sent.Load() > 32<<20 }, 10*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, 1, primary.NumStreams(), "data streams must not share the control session")
+	assert.Equal(t, 4, data.NumStreams())
+
+	codec := protocol.NewCodec(controlStream, controlStream)
+	for range 5 {
+		start := time.Now()
+		require.NoError(t, codec.Encode(&protocol.PingMessage{Message: protocol.NewMessage(protocol.MsgPing)}))
+		var pong protocol.PongMessage
+		require.NoError(t, codec.Decode(&pong))
+		assert.Less(t, time.Since(start), 500*time.Millisecond)
+	}
+	before := sent.Load()
+	require.Eventually(t, func() bool { return sent.Load() > before }, 5*time.Second, 10*time.Millisecond,
+		"the transfer must still be running")
+}
+
+func TestOpenStream_PrimaryWithoutDataSessions(t *testing.T) {
+	primary, peerPrimary := yamuxPair(t)
+	c := &Client{server: &Server{}, Session: primary}
+	go func() { _, _ = peerPrimary.AcceptStream() }()
+
+	stream, err := c.OpenStream()
+	require.NoError(t, err)
+	defer stream.Close()
+	assert.Equal(t, 1, primary.NumStreams())
+}
@@ -8,22 +8,26 @@ import (
 
 	"github.com/rs/zerolog"
 
+	"github.com/mephistofox/fxtun.dev/internal/logging"
 	"github.com/mephistofox/fxtun.dev/internal/protocol"
 )
 
 // TCPManager manages TCP tunnel ports
 type TCPManager struct {
-	server *Server
-	log    zerolog.Logger
-	ports  *PortAllocator
+	server  *Server
+	log     zerolog.Logger
+	connLog zerolog.Logger // per-connection lines, sampled per logging settings
+	ports   *PortAllocator
 }
 
 // NewTCPManager creates a new TCP manager
 func NewTCPManager(server *Server, log zerolog.Logger) *TCPManager {
+	log = log.With().Str("component", "tcp_manager").Logger()
 	return &TCPManager{
-		server: server,
-		log:    log.With().Str("component", "tcp_manager").Logger(),
-		ports:  NewPortAllocator(server.cfg.Server.TCPPortRange),
+		server:  server,
+		log:     log,
+		connLog: logging.Sampled(log, server.cfg.Logging),
+		ports:   NewPortAllocator(server.cfg.Server.TCPPortRange),
 	}
 }
 
@@ -91,25 +95,53 @@ func (m *TCPManager) AcceptConnections(tunnel *Tunnel, client *Client) {
 }
 
 func (m *TCPManager) handleConnection(conn net.Conn, tunnel *Tunnel, client *Client) {
-	m.server.activeConns.Add(1)
-	defer m.server.activeConns.Done()
+	defer m.server.trackConn()()
 	defer conn.Close()
 
 	// Enforce IP allowlist
 	host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
 	if clientIP := net.ParseIP(host); clientIP != nil {
 		if !isIPAllowed(clientIP, tunnel) {
-			m.log.Warn().Str("remote_addr", conn.RemoteAddr().String()).
+			m.log.Warn().Str("remote_ip", host).
 				Str("tunnel_id", tunnel.ID).Msg("TCP connection blocked by IP allowlist")
+			m.server.stats.reject(rejectIPAllowlist)
 			return
 		}
 	}
 
+	// The listener may still hand out connections after the tunnel closed
+	if !tunnel.conns.acquire(conn) {
+		return
+	}
+	defer tunnel.conns.release(conn)
+
+	// Sink tunnels are answered here and skip rate limiting: they exist to
+	// push the data plane as hard as possible.
+	if tunnel.Type == protocol.TunnelSink {
+		tuneTCPConn(conn)
+		m.serveSink(conn, tunnel)
+		return
+	}
+
 	// Rate limiting (tunnel-level + per-IP)
 	if !m.server.monitor.AllowTCPConnection(tunnel.ID, conn.RemoteAddr().String()) {
+		m.server.stats.reject(rejectRateLimit)
+		return
+	}
+
+	if client.refuseOverQuota(tunnel) {
+		m.server.stats.reject(rejectQuota)
 		return
 	}
 
+	// Let the client turn the connection down before a stream is opened
+	if tunnel.confirmConns {
+		if err := client.confirmConnection(tunnel, conn.RemoteAddr().String(), nil); err != nil {
+			m.log.Debug().Err(err).Str("tunnel_id", tunnel.ID).Msg("Connection not accepted by the client")
+			return
+		}
+	}
+
 	tuneTCPConn(conn)
 
 	// Open stream to client
@@ -121,25 +153,36 @@ func (m *TCPManager) handleConnection(conn net.Conn, tunnel *Tunnel, client *Cli
 	defer stream.Close()
 
 	// Send binary stream header
-	if err := protocol.WriteStreamHeader(stream, tunnel.ID, conn.RemoteAddr().String()); err != nil {
+	stream, err = client.writeStreamHeader(stream, tunnel, conn.RemoteAddr().String())
+	if err != nil {
 		m.log.Error().Err(err).Msg("Failed to send connection info")
 		return
 	}
 
+	// The PROXY header goes to the local service ahead of any payload
+	if tunnel.proxyProtocol {
+		if err := protocol.WriteProxyHeaderV2(stream, conn.RemoteAddr(), conn.LocalAddr()); err != nil {
+			m.log.Error().Err(err).Str("tunnel_id", tunnel.ID).Msg("Failed to send PROXY header")
+			return
+		}
+	}
+
 	// Bidirectional copy with large buffers
 	done := make(chan struct{}, 2)
 
 	go func() {
 		bp := proxyBufPool.Get().(*[]byte)
-		_, _ = io.CopyBuffer(stream, conn, *bp)
+		n, _ := io.CopyBuffer(stream, conn, *bp)
 		proxyBufPool.Put(bp)
+		tunnel.countIn(n)
 		done <- struct{}{}
 	}()
 
 	go func() {
 		bp := proxyBufPool.Get().(*[]byte)
-		_, _ = io.CopyBuffer(conn, stream, *bp)
+		n, _ := io.CopyBuffer(conn, stream, *bp)
 		proxyBufPool.Put(bp)
+		tunnel.countOut(n)
 		done <- struct{}{}
 	}()
 
@@ -152,9 +195,9 @@ func (m *TCPManager) handleConnection(conn net.Conn, tunnel *Tunnel, client *Cli
 	// Update LastActivity timestamp for auto-close tracking
 	tunnel.LastActivity.Store(time.Now().UnixNano())
 
-	m.log.Debug().
+	m.connLog.Debug().
 		Str("tunnel_id", tunnel.ID).
-		Str("remote", conn.RemoteAddr().String()).
+		Str("remote_ip", logging.RemoteIP(conn.RemoteAddr().String())).
 		Msg("TCP connection completed")
 }
 
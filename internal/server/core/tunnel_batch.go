@@ -0,0 +1,49 @@
+package core
+
+import (
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+// handleTunnelBatchRequest creates every tunnel of a batch in order and
+// answers with all the results in a single message.
+func (c *Client) handleTunnelBatchRequest(data []byte) {
+	parsed, err := c.encoding.ParseMessage(data, protocol.MsgTunnelBatchRequest)
+	if err != nil {
+		c.log.Error().Err(err).Msg("Failed to parse tunnel batch request")
+		return
+	}
+	batch := parsed.(*protocol.TunnelBatchRequestMessage)
+
+	result := &protocol.TunnelBatchResultMessage{
+		Message: protocol.NewMessage(protocol.MsgTunnelBatchResult),
+		Results: make([]protocol.TunnelBatchResult, 0, len(batch.Tunnels)),
+	}
+	result.RequestID = batch.RequestID
+
+	c.tunnelBatch = result
+	for i := range batch.Tunnels {
+		c.createTunnel(&batch.Tunnels[i])
+	}
+	c.tunnelBatch = nil
+
+	c.log.Debug().Int("tunnels", len(batch.Tunnels)).Msg("Tunnel batch handled")
+	_ = c.sendControl(result)
+}
+
+// replyTunnel sends the result of a tunnel request, or adds it to the
+// current batch result.
+func (c *Client) replyTunnel(msg any) {
+	if created, ok := msg.(*protocol.TunnelCreatedMessage); ok {
+		c.issueRestoreToken(created)
+	}
+	if c.tunnelBatch == nil {
+		_ = c.sendControl(msg)
+		return
+	}
+	switch msg := msg.(type) {
+	case *protocol.TunnelCreatedMessage:
+		c.tunnelBatch.Results = append(c.tunnelBatch.Results, protocol.TunnelBatchResult{Created: msg})
+	case *protocol.TunnelErrorMessage:
+		c.tunnelBatch.Results = append(c.tunnelBatch.Results, protocol.TunnelBatchResult{Error: msg})
+	}
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+	"github.com/mephistofox/fxtun.dev/internal/server/database"
+)
+
+func TestTunnelBatchRequest(t *testing.T) {
+	srv := resumeTestServer(t, 0)
+
+	session := dialServer(t, srv)
+	defer session.Close()
+	codec, _ := openControlStream(t, session)
+	require.NoError(t, codec.Encode(&protocol.AuthMessage{Message: protocol.NewMessage(protocol.MsgAuth)}))
+	var auth protocol.AuthResultMessage
+	require.NoError(t, codec.Decode(&auth))
+	require.True(t, auth.Success, auth.Error)
+	assert.True(t, auth.TunnelBatch)
+
+	client := srv.GetClient(auth.ClientID)
+	require.NotNil(t, client)
+	client.Plan = &database.Plan{MaxTunnels: -1}
+
+	batch := &protocol.TunnelBatchRequestMessage{Message: protocol.NewMessage(protocol.MsgTunnelBatchRequest)}
+	batch.RequestID = "batch-1"
+	for i := 0; i < 20; i++ {
+		req := protocol.TunnelRequestMessage{
+			Message:    protocol.NewMessage(protocol.MsgTunnelRequest),
+			TunnelType: protocol.TunnelHTTP,
+			Subdomain:  fmt.Sprintf("app-%d", i),
+			LocalPort:  3000 + i,
+		}
+		req.RequestID = fmt.Sprintf("req-%d", i)
+		batch.Tunnels = append(batch.Tunnels, req)
+	}
+	// A taken subdomain and an unknown type fail on their own
+	taken := batch.Tunnels[0]
+	taken.RequestID = "req-taken"
+	unknown := protocol.TunnelRequestMessage{Message: protocol.NewMessage(protocol.MsgTunnelRequest), TunnelType: "sctp"}
+	unknown.RequestID = "req-unknown"
+	batch.Tunnels = append(batch.Tunnels, taken, unknown)
+
+	require.NoError(t, codec.Encode(batch))
+
+	var result protocol.TunnelBatchResultMessage
+	require.NoError(t, codec.Decode(&result))
+	assert.Equal(t, protocol.MsgTunnelBatchResult, result.Type)
+	assert.Equal(t, "batch-1", result.RequestID)
+	require.Len(t, result.Results, 22)
+
+	for i, r := range result.Results[:20] {
+		require.NotNil(t, r.Created, "tunnel %d: %+v", i, r.Error)
+		assert.Nil(t, r.Error)
+		assert.Equal(t, fmt.Sprintf("req-%d", i), r.Created.RequestID)
+		assert.Equal(t, fmt.Sprintf("app-%d", i), r.Created.Subdomain)
+	}
+	require.NotNil(t, result.Results[20].Error)
+	assert.Equal(t, protocol.ErrCodeSubdomainTaken, result.Results[20].Error.Code)
+	assert.Equal(t, "req-taken", result.Results[20].Error.RequestID)
+	require.NotNil(t, result.Results[21].Error)
+	assert.Equal(t, protocol.ErrCodeProtocolError, result.Results[21].Error.Code)
+
+	client.TunnelsMu.RLock()
+	assert.Len(t, client.Tunnels, 20)
+	client.TunnelsMu.RUnlock()
+
+	// Single requests are still answered on their own after a batch
+	single := &protocol.TunnelRequestMessage{
+		Message:    protocol.NewMessage(protocol.MsgTunnelRequest),
+		TunnelType: protocol.TunnelHTTP,
+		Subdomain:  "single",
+		LocalPort:  4000,
+	}
+	require.NoError(t, codec.Encode(single))
+	var created protocol.TunnelCreatedMessage
+	require.NoError(t, codec.Decode(&created))
+	assert.Equal(t, protocol.MsgTunnelCreated, created.Type)
+	assert.Equal(t, "single", created.Subdomain)
+}
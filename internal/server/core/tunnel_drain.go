@@ -0,0 +1,104 @@
+package core
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+// tunnelConns tracks the visitor connections in flight on a tunnel, so that
+// closing the tunnel can let them finish first. The zero value is ready to
+// use.
+type tunnelConns struct {
+	mu       sync.Mutex
+	conns    map[io.Closer]struct{}
+	draining bool
+	idle     chan struct{} // closed when the last connection ends while draining
+}
+
+// acquire counts conn as in flight. It reports false once the tunnel is
+// draining; the caller must then drop the connection.
+func (tc *tunnelConns) acquire(conn io.Closer) bool {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if tc.draining {
+		return false
+	}
+	if tc.conns == nil {
+		tc.conns = make(map[io.Closer]struct{})
+	}
+	tc.conns[conn] = struct{}{}
+	return true
+}
+
+func (tc *tunnelConns) release(conn io.Closer) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	delete(tc.conns, conn)
+	if tc.idle != nil && len(tc.conns) == 0 {
+		close(tc.idle)
+		tc.idle = nil
+	}
+}
+
+// startDrain refuses new connections from now on. It returns a channel
+// closed when the ones in flight have ended, or nil if there are none.
+func (tc *tunnelConns) startDrain() <-chan struct{} {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	tc.draining = true
+	if len(tc.conns) == 0 {
+		return nil
+	}
+	if tc.idle == nil {
+		tc.idle = make(chan struct{})
+	}
+	return tc.idle
+}
+
+// closeAll cuts the connections still in flight.
+func (tc *tunnelConns) closeAll() int {
+	tc.mu.Lock()
+	conns := make([]io.Closer, 0, len(tc.conns))
+	for conn := range tc.conns {
+		conns = append(conns, conn)
+	}
+	tc.mu.Unlock()
+
+	for _, conn := range conns {
+		_ = conn.Close()
+	}
+	return len(conns)
+}
+
+// drainTunnel waits for the connections in flight on a closed tunnel to
+// end, for up to the configured drain timeout, and returns the outcome for
+// TunnelClosedMessage.Drain. Empty means the tunnel is not drained.
+func (c *Client) drainTunnel(tunnel *Tunnel, idle <-chan struct{}) string {
+	timeout := c.server.cfg.Server.TunnelDrainTimeout
+	if timeout <= 0 {
+		return ""
+	}
+	if idle == nil {
+		return protocol.DrainComplete
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-idle:
+		return protocol.DrainComplete
+	case <-timer.C:
+	case <-c.ctx.Done():
+	}
+
+	n := tunnel.conns.closeAll()
+	c.log.Warn().
+		Str("tunnel_id", tunnel.ID).
+		Int("connections", n).
+		Dur("timeout", timeout).
+		Msg("Tunnel drain timed out, closing remaining connections")
+	return protocol.DrainTimedOut
+}
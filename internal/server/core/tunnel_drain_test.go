@@ -0,0 +1,62 @@
+package core
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+func TestTunnelConns_Drain(t *testing.T) {
+	var tc tunnelConns
+	a, b := net.Pipe()
+	defer b.Close()
+
+	require.True(t, tc.acquire(a))
+	idle := tc.startDrain()
+	require.NotNil(t, idle)
+	assert.False(t, tc.acquire(b), "no new connections while draining")
+
+	select {
+	case <-idle:
+		t.Fatal("drained with a connection in flight")
+	default:
+	}
+	tc.release(a)
+	select {
+	case <-idle:
+	case <-time.After(time.Second):
+		t.Fatal("not drained after the last connection ended")
+	}
+
+	var empty tunnelConns
+	assert.Nil(t, empty.startDrain(), "nothing to wait for")
+}
+
+func TestClient_DrainTunnel(t *testing.T) {
+	srv := resumeTestServer(t, 0)
+	c := &Client{server: srv, ctx: context.Background(), log: zerolog.Nop()}
+	tunnel := &Tunnel{ID: "t1"}
+
+	assert.Empty(t, c.drainTunnel(tunnel, nil), "draining is disabled")
+
+	srv.cfg.Server.TunnelDrainTimeout = 50 * time.Millisecond
+	assert.Equal(t, protocol.DrainComplete, c.drainTunnel(tunnel, nil))
+
+	visitor, peer := net.Pipe()
+	defer peer.Close()
+	require.True(t, tunnel.conns.acquire(visitor))
+	idle := tunnel.conns.startDrain()
+	assert.Equal(t, protocol.DrainTimedOut, c.drainTunnel(tunnel, idle))
+
+	// The connection left over was cut
+	_, err := visitor.Write([]byte("x"))
+	assert.ErrorIs(t, err, io.ErrClosedPipe)
+}
@@ -0,0 +1,152 @@
+package core
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+// restoreClaims is what a tunnel restore token vouches for: the address a
+// tunnel held and who held it.
+type restoreClaims struct {
+	Owner     string              `json:"o"`
+	Type      protocol.TunnelType `json:"t"`
+	Subdomain string              `json:"s,omitempty"`
+	Port      int                 `json:"p,omitempty"`
+}
+
+// restoreKey derives the key restore tokens are signed with. It only
+// depends on configuration, so tokens stay valid across restarts. A nil key
+// disables restore tokens.
+func restoreKey(restoreSecret, jwtSecret string) []byte {
+	secret := restoreSecret
+	if secret == "" {
+		secret = jwtSecret
+	}
+	if secret == "" {
+		return nil
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("fxtunnel tunnel restore"))
+	return mac.Sum(nil)
+}
+
+// signRestoreToken encodes claims as <payload>.<signature>, both base64url.
+func signRestoreToken(key []byte, claims restoreClaims) string {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return ""
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(encoded))
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// parseRestoreToken returns the claims of a token signed with key.
+func parseRestoreToken(key []byte, token string) (*restoreClaims, bool) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok || key == nil {
+		return nil, false
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return nil, false
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(encoded))
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return nil, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, false
+	}
+	var claims restoreClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, false
+	}
+	return &claims, true
+}
+
+// restoreOwner identifies the account a restore token is bound to, so a
+// token leaked to another account does not restore anything there.
+func (c *Client) restoreOwner() string {
+	switch {
+	case c.UserID > 0:
+		return "user:" + strconv.FormatInt(c.UserID, 10)
+	case c.Token != nil:
+		return "token:" + c.Token.Name
+	default:
+		return "anonymous"
+	}
+}
+
+// issueRestoreToken signs the address of a created tunnel into its reply.
+func (c *Client) issueRestoreToken(resp *protocol.TunnelCreatedMessage) {
+	if c.server.restoreKey == nil {
+		return
+	}
+	resp.RestoreToken = signRestoreToken(c.server.restoreKey, restoreClaims{
+		Owner:     c.restoreOwner(),
+		Type:      resp.TunnelType,
+		Subdomain: resp.Subdomain,
+		Port:      resp.RemotePort,
+	})
+}
+
+// restoreClaims returns the claims of the request's restore token when it
+// is valid for this client and tunnel type and does not contradict an
+// address the request names explicitly.
+func (c *Client) restoreClaims(req *protocol.TunnelRequestMessage) *restoreClaims {
+	if req.RestoreToken == "" {
+		return nil
+	}
+	claims, ok := parseRestoreToken(c.server.restoreKey, req.RestoreToken)
+	if !ok || claims.Owner != c.restoreOwner() || claims.Type != req.TunnelType {
+		return nil
+	}
+	if req.Subdomain != "" && !strings.EqualFold(req.Subdomain, claims.Subdomain) {
+		return nil
+	}
+	if req.RemotePort != 0 && req.RemotePort != claims.Port {
+		return nil
+	}
+	return claims
+}
+
+// applyRestoreToken fills in the address of a restore request from its
+// token and reports whether the request is a valid restore. A restore whose
+// address was taken meanwhile gets a new one instead of failing.
+func (c *Client) applyRestoreToken(req *protocol.TunnelRequestMessage) bool {
+	claims := c.restoreClaims(req)
+	if claims == nil {
+		return false
+	}
+	req.Subdomain = claims.Subdomain
+	req.RemotePort = claims.Port
+	return true
+}
+
+// subdomainFree reports whether an HTTP tunnel of this client could register
+// subdomain right now.
+func (c *Client) subdomainFree(subdomain string) bool {
+	if tunnel := c.server.httpRouter.GetTunnel(subdomain); tunnel != nil {
+		if !c.server.cfg.Server.SharedSubdomains.Enabled || c.UserID <= 0 || tunnel.userID != c.UserID {
+			return false
+		}
+	}
+	if c.server.db != nil && c.UserID > 0 {
+		owned, _ := c.server.db.Domains.IsOwnedByUser(subdomain, c.UserID)
+		available, _ := c.server.db.Domains.IsAvailable(subdomain)
+		if !available && !owned {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,109 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+	"github.com/mephistofox/fxtun.dev/internal/server/database"
+)
+
+func TestRestoreToken_SignAndParse(t *testing.T) {
+	key := restoreKey("", "jwt-secret")
+	require.NotNil(t, key)
+	assert.Nil(t, restoreKey("", ""))
+
+	claims := restoreClaims{Owner: "user:7", Type: protocol.TunnelTCP, Port: 40001}
+	token := signRestoreToken(key, claims)
+
+	got, ok := parseRestoreToken(key, token)
+	require.True(t, ok)
+	assert.Equal(t, claims, *got)
+
+	_, ok = parseRestoreToken(restoreKey("other-secret", "jwt-secret"), token)
+	assert.False(t, ok, "token signed with another key")
+	_, ok = parseRestoreToken(key, token[:len(token)-2]+"xx")
+	assert.False(t, ok, "tampered signature")
+	_, ok = parseRestoreToken(key, "garbage")
+	assert.False(t, ok)
+	_, ok = parseRestoreToken(nil, token)
+	assert.False(t, ok, "restore disabled")
+}
+
+// restoreTestClient authenticates a client against srv with restore tokens
+// enabled.
+func restoreTestClient(t *testing.T, srv *Server) (*protocol.Codec, *Client) {
+	t.Helper()
+
+	session := dialServer(t, srv)
+	t.Cleanup(func() { session.Close() })
+	codec, _ := openControlStream(t, session)
+	require.NoError(t, codec.Encode(&protocol.AuthMessage{Message: protocol.NewMessage(protocol.MsgAuth)}))
+	var auth protocol.AuthResultMessage
+	require.NoError(t, codec.Decode(&auth))
+	require.True(t, auth.Success, auth.Error)
+
+	client := srv.GetClient(auth.ClientID)
+	require.NotNil(t, client)
+	client.Plan = &database.Plan{MaxTunnels: -1}
+	return codec, client
+}
+
+func requestHTTPTunnel(t *testing.T, codec *protocol.Codec, subdomain, restoreToken string) *protocol.TunnelCreatedMessage {
+	t.Helper()
+
+	require.NoError(t, codec.Encode(&protocol.TunnelRequestMessage{
+		Message:      protocol.NewMessage(protocol.MsgTunnelRequest),
+		TunnelType:   protocol.TunnelHTTP,
+		Subdomain:    subdomain,
+		LocalPort:    3000,
+		RestoreToken: restoreToken,
+	}))
+	var created protocol.TunnelCreatedMessage
+	require.NoError(t, codec.Decode(&created))
+	require.Equal(t, protocol.MsgTunnelCreated, created.Type)
+	return &created
+}
+
+func TestTunnelRestore_HTTP(t *testing.T) {
+	srv := resumeTestServer(t, 0)
+	srv.restoreKey = restoreKey("restore-secret", "")
+
+	codec, client := restoreTestClient(t, srv)
+	created := requestHTTPTunnel(t, codec, "", "")
+	require.NotEmpty(t, created.RestoreToken)
+	subdomain := created.Subdomain
+
+	// Simulate the session ending, as on a server restart
+	client.closeTunnel(created.TunnelID)
+
+	codec, _ = restoreTestClient(t, srv)
+	restored := requestHTTPTunnel(t, codec, "", created.RestoreToken)
+	assert.Equal(t, subdomain, restored.Subdomain)
+	assert.False(t, restored.AddressChanged)
+	assert.NotEmpty(t, restored.RestoreToken)
+
+	// The address is taken now, so a second restore falls back to a new one
+	codec, _ = restoreTestClient(t, srv)
+	moved := requestHTTPTunnel(t, codec, "", created.RestoreToken)
+	assert.NotEqual(t, subdomain, moved.Subdomain)
+	assert.True(t, moved.AddressChanged)
+}
+
+func TestTunnelRestore_InvalidTokenIgnored(t *testing.T) {
+	srv := resumeTestServer(t, 0)
+	srv.restoreKey = restoreKey("restore-secret", "")
+
+	codec, _ := restoreTestClient(t, srv)
+	token := signRestoreToken(srv.restoreKey, restoreClaims{Owner: "user:42", Type: protocol.TunnelHTTP, Subdomain: "stolen"})
+	created := requestHTTPTunnel(t, codec, "", token)
+	assert.NotEqual(t, "stolen", created.Subdomain, "token of another owner")
+	assert.False(t, created.AddressChanged)
+
+	// A token for another subdomain than the requested one is ignored too
+	token = signRestoreToken(srv.restoreKey, restoreClaims{Owner: "anonymous", Type: protocol.TunnelHTTP, Subdomain: "other"})
+	created = requestHTTPTunnel(t, codec, "mine", token)
+	assert.Equal(t, "mine", created.Subdomain)
+}
@@ -0,0 +1,115 @@
+package core
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultUDPFlowTimeout applies when server.udp_flow_timeout is not set.
+const defaultUDPFlowTimeout = 60 * time.Second
+
+// udpFlow is one visitor source address talking to a UDP tunnel, like a NAT
+// mapping: replies from the client are only sent to sources with a live flow.
+type udpFlow struct {
+	addr     *net.UDPAddr
+	hash     uint32
+	lastSeen time.Time
+}
+
+// udpFlowTable tracks the flows of one UDP tunnel. Replies from the client
+// carry the flow's address hash, so flows are indexed by both.
+type udpFlowTable struct {
+	timeout time.Duration
+
+	mu     sync.Mutex
+	byAddr map[string]*udpFlow
+	byHash map[uint32]*udpFlow
+	closed bool
+
+	// active mirrors len(byAddr) for lock-free stats
+	active atomic.Int64
+}
+
+func newUDPFlowTable(timeout time.Duration) *udpFlowTable {
+	if timeout <= 0 {
+		timeout = defaultUDPFlowTimeout
+	}
+	return &udpFlowTable{
+		timeout: timeout,
+		byAddr:  make(map[string]*udpFlow),
+		byHash:  make(map[uint32]*udpFlow),
+	}
+}
+
+// touch records a packet from addr, opening its flow if needed, and returns
+// the hash the client echoes in replies. It returns false once the table is
+// closed.
+func (t *udpFlowTable) touch(addr *net.UDPAddr, now time.Time) (uint32, bool) {
+	key := addr.String()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return 0, false
+	}
+	f, ok := t.byAddr[key]
+	if !ok {
+		f = &udpFlow{addr: addr, hash: hashAddr(addr)}
+		t.byAddr[key] = f
+		t.active.Add(1)
+	}
+	// On a hash collision the most recent source gets the replies
+	t.byHash[f.hash] = f
+	f.lastSeen = now
+	return f.hash, true
+}
+
+// lookup returns the address of the live flow with hash, or nil when the
+// flow expired or never existed, e.g. a reply that overtook nothing.
+func (t *udpFlowTable) lookup(hash uint32) *net.UDPAddr {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if f, ok := t.byHash[hash]; ok {
+		return f.addr
+	}
+	return nil
+}
+
+// expire drops flows idle for longer than the timeout and returns how many.
+func (t *udpFlowTable) expire(now time.Time) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := 0
+	for key, f := range t.byAddr {
+		if now.Sub(f.lastSeen) > t.timeout {
+			t.removeLocked(key, f)
+			n++
+		}
+	}
+	return n
+}
+
+func (t *udpFlowTable) removeLocked(key string, f *udpFlow) {
+	delete(t.byAddr, key)
+	if t.byHash[f.hash] == f {
+		delete(t.byHash, f.hash)
+	}
+	t.active.Add(-1)
+}
+
+// close drops every flow and refuses new ones.
+func (t *udpFlowTable) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	for key, f := range t.byAddr {
+		t.removeLocked(key, f)
+	}
+}
+
+// sweepInterval is how often idle flows are looked for: often enough that a
+// flow outlives its timeout by at most half of it.
+func (t *udpFlowTable) sweepInterval() time.Duration {
+	return min(max(t.timeout/2, time.Second), 30*time.Second)
+}
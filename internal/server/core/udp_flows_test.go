@@ -0,0 +1,205 @@
+package core
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/yamux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+func TestUDPFlowTable_Expire(t *testing.T) {
+	flows := newUDPFlowTable(time.Minute)
+	a := &net.UDPAddr{IP: net.ParseIP("203.0.113.1"), Port: 5000}
+	b := &net.UDPAddr{IP: net.ParseIP("203.0.113.2"), Port: 5000}
+
+	start := time.Now()
+	hashA, ok := flows.touch(a, start)
+	require.True(t, ok)
+	hashB, _ := flows.touch(b, start.Add(45*time.Second))
+	_, _ = flows.touch(a, start.Add(10*time.Second)) // repeat packets keep one flow
+	assert.Equal(t, int64(2), flows.active.Load())
+	assert.Equal(t, a, flows.lookup(hashA))
+
+	assert.Equal(t, 1, flows.expire(start.Add(90*time.Second)))
+	assert.Nil(t, flows.lookup(hashA), "replies to an expired flow are dropped")
+	assert.Equal(t, b, flows.lookup(hashB))
+	assert.Equal(t, int64(1), flows.active.Load())
+
+	assert.Nil(t, flows.lookup(hashA+1), "reply for a flow that was never opened")
+}
+
+func TestUDPFlowTable_Close(t *testing.T) {
+	flows := newUDPFlowTable(0)
+	assert.Equal(t, defaultUDPFlowTimeout, flows.timeout)
+
+	addr := &net.UDPAddr{IP: net.ParseIP("203.0.113.1"), Port: 5000}
+	hash, _ := flows.touch(addr, time.Now())
+	flows.close()
+
+	assert.Nil(t, flows.lookup(hash))
+	assert.Equal(t, int64(0), flows.active.Load())
+	_, ok := flows.touch(addr, time.Now())
+	assert.False(t, ok, "no flows are opened after close")
+}
+
+func TestUDPFlowTable_SweepInterval(t *testing.T) {
+	assert.Equal(t, time.Second, newUDPFlowTable(time.Second).sweepInterval())
+	assert.Equal(t, 10*time.Second, newUDPFlowTable(20*time.Second).sweepInterval())
+	assert.Equal(t, 30*time.Second, newUDPFlowTable(time.Hour).sweepInterval())
+}
+
+func TestHandlePackets_TunnelCloseTearsDownFlows(t *testing.T) {
+	srv := resumeTestServer(t, 0)
+	srv.cfg.Server.UDPPortRange = config.PortRange{Min: 41600, Max: 41610}
+	srv.udpManager = NewUDPManager(srv, srv.log)
+
+	session := dialServer(t, srv)
+	defer session.Close()
+	codec, _ := openControlStream(t, session)
+	require.NoError(t, codec.Encode(&protocol.AuthMessage{Message: protocol.NewMessage(protocol.MsgAuth)}))
+	var auth protocol.AuthResultMessage
+	require.NoError(t, codec.Decode(&auth))
+	require.True(t, auth.Success, auth.Error)
+
+	require.NoError(t, codec.Encode(&protocol.TunnelRequestMessage{
+		Message:    protocol.NewMessage(protocol.MsgTunnelRequest),
+		TunnelType: protocol.TunnelUDP,
+		LocalPort:  5353,
+	}))
+	var created protocol.TunnelCreatedMessage
+	require.NoError(t, codec.Decode(&created))
+	require.Equal(t, protocol.MsgTunnelCreated, created.Type)
+
+	client := srv.GetClient(auth.ClientID)
+	require.NotNil(t, client)
+	client.TunnelsMu.RLock()
+	tunnel := client.Tunnels[created.TunnelID]
+	client.TunnelsMu.RUnlock()
+	require.NotNil(t, tunnel)
+
+	stream := acceptTunnelStream(t, session, created.TunnelID)
+	defer stream.Close()
+
+	visitor, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: created.RemotePort})
+	require.NoError(t, err)
+	defer visitor.Close()
+	_, err = visitor.Write([]byte("query"))
+	require.NoError(t, err)
+
+	header := make([]byte, udpHeaderSize)
+	_, err = io.ReadFull(stream, header)
+	require.NoError(t, err)
+	payload := make([]byte, binary.BigEndian.Uint16(header[0:2]))
+	_, err = io.ReadFull(stream, payload)
+	require.NoError(t, err)
+	assert.Equal(t, "query", string(payload))
+	assert.Equal(t, 1, srv.GetStats().UDPFlows)
+
+	// The reply goes back to the visitor's flow
+	reply := append(append([]byte{0, 6}, header[2:6]...), "answer"...)
+	_, err = stream.Write(reply)
+	require.NoError(t, err)
+	require.NoError(t, visitor.SetReadDeadline(time.Now().Add(2*time.Second)))
+	buf := make([]byte, 64)
+	n, err := visitor.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "answer", string(buf[:n]))
+
+	// Closing the tunnel drops its flows and stream without waiting for
+	// the flow timeout
+	client.closeTunnel(created.TunnelID)
+	require.Eventually(t, func() bool { return tunnel.udpFlows.active.Load() == 0 }, 2*time.Second, 10*time.Millisecond)
+	require.NoError(t, stream.SetReadDeadline(time.Now().Add(2*time.Second)))
+	_, err = stream.Read(buf)
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestHandlePackets_BlocksDisallowedSources(t *testing.T) {
+	srv := resumeTestServer(t, 0)
+	srv.cfg.Server.UDPPortRange = config.PortRange{Min: 41611, Max: 41619}
+	srv.udpManager = NewUDPManager(srv, srv.log)
+	// Only the tunnel's stream is opened, so teardown does not wait on
+	// hundreds of pooled ones
+	srv.noStreamPool = true
+
+	session := dialServer(t, srv)
+	defer session.Close()
+	codec, _ := openControlStream(t, session)
+	require.NoError(t, codec.Encode(&protocol.AuthMessage{Message: protocol.NewMessage(protocol.MsgAuth)}))
+	var auth protocol.AuthResultMessage
+	require.NoError(t, codec.Decode(&auth))
+	require.True(t, auth.Success, auth.Error)
+
+	require.NoError(t, codec.Encode(&protocol.TunnelRequestMessage{
+		Message:    protocol.NewMessage(protocol.MsgTunnelRequest),
+		TunnelType: protocol.TunnelUDP,
+		LocalPort:  5353,
+		AllowIPs:   []string{"10.0.0.0/8"},
+	}))
+	var created protocol.TunnelCreatedMessage
+	require.NoError(t, codec.Decode(&created))
+	require.Equal(t, protocol.MsgTunnelCreated, created.Type)
+
+	client := srv.GetClient(auth.ClientID)
+	require.NotNil(t, client)
+	client.TunnelsMu.RLock()
+	tunnel := client.Tunnels[created.TunnelID]
+	client.TunnelsMu.RUnlock()
+	require.NotNil(t, tunnel)
+
+	stream := acceptTunnelStream(t, session, created.TunnelID)
+	defer stream.Close()
+
+	visitor, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: created.RemotePort})
+	require.NoError(t, err)
+	defer visitor.Close()
+	for range 3 {
+		_, err = visitor.Write([]byte("query"))
+		require.NoError(t, err)
+	}
+
+	require.Eventually(t, func() bool { return tunnel.BlockedPackets.Load() == 3 }, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(3), srv.stats.rejectedIPAllowlist.Load())
+	assert.Equal(t, int64(0), tunnel.BytesIn.Load(), "nothing reaches the client")
+	assert.Equal(t, 0, srv.GetStats().UDPFlows)
+}
+
+// acceptTunnelStream returns the stream the server opened for tunnelID. The
+// server also pre-opens pooled streams that stay silent until used, so the
+// first stream accepted is not necessarily the tunnel's.
+func acceptTunnelStream(t *testing.T, session *yamux.Session, tunnelID string) net.Conn {
+	t.Helper()
+
+	found := make(chan net.Conn, 1)
+	go func() {
+		for {
+			stream, err := session.AcceptStream()
+			if err != nil {
+				return
+			}
+			go func() {
+				header, err := protocol.ReadStreamHeader(stream)
+				if err != nil || header.TunnelID != tunnelID {
+					return
+				}
+				found <- stream
+			}()
+		}
+	}()
+
+	select {
+	case stream := <-found:
+		return stream
+	case <-time.After(5 * time.Second):
+		t.Fatal("no stream opened for the tunnel")
+		return nil
+	}
+}
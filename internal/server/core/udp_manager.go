@@ -65,8 +65,7 @@ func (m *UDPManager) ReleasePort(port int) {
 
 // HandlePackets handles incoming UDP packets for a tunnel
 func (m *UDPManager) HandlePackets(tunnel *Tunnel, client *Client) {
-	m.server.activeConns.Add(1)
-	defer m.server.activeConns.Done()
+	defer m.server.trackConn()()
 	defer func() {
 		m.ReleasePort(tunnel.RemotePort)
 		if tunnel.udpConn != nil {
@@ -88,31 +87,31 @@ func (m *UDPManager) HandlePackets(tunnel *Tunnel, client *Client) {
 		return
 	}
 
-	// Track client addresses for responses (keyed by addr.String() to avoid hash collisions)
-	clientAddrs := make(map[string]*net.UDPAddr)
-	hashToKey := make(map[uint32]string)
-	clientLastSeen := make(map[string]time.Time)
-	var addrMu sync.RWMutex
+	flows := tunnel.udpFlows
+	if flows == nil {
+		flows = newUDPFlowTable(m.server.cfg.Server.UDPFlowTimeout)
+	}
+	done := make(chan struct{})
+	defer func() {
+		close(done)
+		flows.close()
+	}()
 
-	// Cleanup goroutine to evict stale entries
+	// Expire idle flows so long-running tunnels do not keep every source
+	// they ever saw
 	go func() {
-		ticker := time.NewTicker(30 * time.Second)
+		ticker := time.NewTicker(flows.sweepInterval())
 		defer ticker.Stop()
 		for {
 			select {
 			case <-client.ctx.Done():
 				return
-			case <-ticker.C:
-				now := time.Now()
-				addrMu.Lock()
-				for key, lastSeen := range clientLastSeen {
-					if now.Sub(lastSeen) > 60*time.Second {
-						delete(clientAddrs, key)
-						delete(clientLastSeen, key)
-						// Note: don't clean hashToKey as it's small and hash collisions are rare
-					}
+			case <-done:
+				return
+			case now := <-ticker.C:
+				if n := flows.expire(now); n > 0 {
+					m.log.Debug().Str("tunnel_id", tunnel.ID).Int("flows", n).Msg("Expired idle UDP flows")
 				}
-				addrMu.Unlock()
 			}
 		}
 	}()
@@ -134,34 +133,45 @@ func (m *UDPManager) HandlePackets(tunnel *Tunnel, client *Client) {
 					continue
 				}
 				m.log.Debug().Err(err).Msg("UDP read error")
+				// The tunnel closed: drop its flows now and unblock the
+				// reply loop instead of waiting for the client
+				flows.close()
+				stream.Close()
 				return
 			}
 
-			// Enforce IP allowlist
+			// Enforce IP allowlist. Only the first blocked packet is logged
+			// as a warning: a flood from a disallowed source would drown
+			// the log otherwise, and the count is exported as a metric.
 			if !isIPAllowed(addr.IP, tunnel) {
-				m.log.Warn().Str("remote_addr", addr.String()).
+				ev := m.log.Debug()
+				if tunnel.BlockedPackets.Add(1) == 1 {
+					ev = m.log.Warn()
+				}
+				ev.Str("remote_ip", addr.IP.String()).
 					Str("tunnel_id", tunnel.ID).Msg("UDP packet blocked by IP allowlist")
+				m.server.stats.reject(rejectIPAllowlist)
 				continue
 			}
 
 			// Rate limiting (tunnel-level + per-IP)
 			if !m.server.monitor.AllowUDPPacket(tunnel.ID, addr.String(), n) {
+				m.server.stats.reject(rejectRateLimit)
+				continue
+			}
+
+			if client.refuseOverQuota(tunnel) {
+				m.server.stats.reject(rejectQuota)
 				continue
 			}
 
 			// Update LastActivity timestamp for auto-close tracking
 			tunnel.LastActivity.Store(time.Now().UnixNano())
 
-			// Use string key to avoid hash collisions
-			addrKey := addr.String()
-			addrHash := hashAddr(addr)
-
-			// Store address for responses
-			addrMu.Lock()
-			clientAddrs[addrKey] = addr
-			hashToKey[addrHash] = addrKey
-			clientLastSeen[addrKey] = time.Now()
-			addrMu.Unlock()
+			addrHash, ok := flows.touch(addr, time.Now())
+			if !ok {
+				return
+			}
 
 			// Frame: [2 bytes length][4 bytes addr hash][payload]
 			fp := udpFramePool.Get().(*[]byte)
@@ -173,6 +183,7 @@ func (m *UDPManager) HandlePackets(tunnel *Tunnel, client *Client) {
 
 			// Record incoming bytes for amplification detection
 			m.server.monitor.RecordUDPBytes(tunnel.ID, int64(n), 0)
+			tunnel.countIn(int64(n))
 
 			_, werr := stream.Write(frame[:frameLen])
 			udpFramePool.Put(fp)
@@ -210,16 +221,12 @@ func (m *UDPManager) HandlePackets(tunnel *Tunnel, client *Client) {
 			return
 		}
 
-		// Find client address via hash-to-key reverse lookup
-		addrMu.RLock()
-		key := hashToKey[addrHash]
-		addr := clientAddrs[key]
-		addrMu.RUnlock()
-
-		if addr != nil {
+		// Replies for flows that expired or were never opened are dropped
+		if addr := flows.lookup(addrHash); addr != nil {
 			_, _ = tunnel.udpConn.WriteToUDP(frame[:length], addr)
 			// Record outgoing bytes for amplification detection
 			m.server.monitor.RecordUDPBytes(tunnel.ID, 0, int64(length))
+			tunnel.countOut(int64(length))
 		}
 		udpFramePool.Put(fp)
 	}
@@ -0,0 +1,56 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+// authAndSendUnknown authenticates a client and sends it a control message
+// of a type the server does not know.
+func authAndSendUnknown(t *testing.T, srv *Server) (*protocol.Codec, string) {
+	t.Helper()
+
+	session := dialServer(t, srv)
+	t.Cleanup(func() { session.Close() })
+	codec, _ := openControlStream(t, session)
+	require.NoError(t, codec.Encode(&protocol.AuthMessage{Message: protocol.NewMessage(protocol.MsgAuth)}))
+	var auth protocol.AuthResultMessage
+	require.NoError(t, codec.Decode(&auth))
+	require.True(t, auth.Success, auth.Error)
+
+	require.NoError(t, codec.Encode(protocol.NewMessage("future_feature")))
+	return codec, auth.ClientID
+}
+
+func TestUnknownMessage_DisconnectMode(t *testing.T) {
+	srv := resumeTestServer(t, 5*time.Second)
+	srv.cfg.Server.UnknownMessages = config.UnknownMessagesDisconnect
+
+	codec, clientID := authAndSendUnknown(t, srv)
+	requireProtocolError(t, codec)
+
+	require.Eventually(t, func() bool { return srv.GetClient(clientID) == nil },
+		2*time.Second, 10*time.Millisecond)
+}
+
+func TestUnknownMessage_LenientModes(t *testing.T) {
+	for _, mode := range []string{"", config.UnknownMessagesIgnore, config.UnknownMessagesLog} {
+		t.Run(mode, func(t *testing.T) {
+			srv := resumeTestServer(t, 0)
+			srv.cfg.Server.UnknownMessages = mode
+
+			codec, clientID := authAndSendUnknown(t, srv)
+
+			require.NoError(t, codec.Encode(&protocol.PingMessage{Message: protocol.NewMessage(protocol.MsgPing)}))
+			var pong protocol.PongMessage
+			require.NoError(t, codec.Decode(&pong))
+			require.Equal(t, protocol.MsgPong, pong.Type)
+			require.NotNil(t, srv.GetClient(clientID))
+		})
+	}
+}
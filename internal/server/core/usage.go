@@ -0,0 +1,264 @@
+package core
+
+import (
+	"fmt"
+	"maps"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+	"github.com/mephistofox/fxtun.dev/internal/server/database"
+)
+
+// usageFlushInterval is how often accumulated tunnel traffic is written to
+// the monthly_usage table.
+const usageFlushInterval = time.Minute
+
+// usageStore persists monthly traffic totals per user.
+type usageStore interface {
+	Add(userID int64, period time.Time, bytesIn, bytesOut int64) (*database.MonthlyUsage, error)
+	Get(userID int64, period time.Time) (*database.MonthlyUsage, error)
+}
+
+// userUsage is one user's traffic in the tracker's current month: what is
+// already stored plus what still waits for the next flush. Every tunnel of
+// the user, across all of their clients, shares the same userUsage.
+type userUsage struct {
+	storedIn   atomic.Int64
+	storedOut  atomic.Int64
+	pendingIn  atomic.Int64
+	pendingOut atomic.Int64
+
+	// Set once the user has been told their quota is used up this month
+	notified atomic.Bool
+}
+
+// total returns the month-to-date traffic in both directions.
+func (u *userUsage) total() int64 {
+	return u.storedIn.Load() + u.pendingIn.Load() + u.storedOut.Load() + u.pendingOut.Load()
+}
+
+// usageTracker accumulates tunnel traffic per user in memory and flushes it
+// to the store periodically, so the data path never waits on the database.
+type usageTracker struct {
+	store usageStore
+	log   zerolog.Logger
+	now   func() time.Time
+
+	mu     sync.Mutex
+	period time.Time
+	users  map[int64]*userUsage
+}
+
+func newUsageTracker(store usageStore, log zerolog.Logger) *usageTracker {
+	return &usageTracker{
+		store:  store,
+		log:    log.With().Str("component", "usage").Logger(),
+		now:    time.Now,
+		period: database.UsagePeriod(time.Now()),
+		users:  make(map[int64]*userUsage),
+	}
+}
+
+// forUser returns the usage of userID, loading the month's stored totals the
+// first time the user is seen. The store is read without holding the lock;
+// if another tunnel of the user got there first, its usage is returned. If
+// loading fails the user starts from zero; the flush still adds to whatever
+// the store holds.
+func (t *usageTracker) forUser(userID int64) *userUsage {
+	t.mu.Lock()
+	u, period := t.users[userID], t.period
+	t.mu.Unlock()
+	if u != nil {
+		return u
+	}
+
+	u = &userUsage{}
+	if stored, err := t.store.Get(userID, period); err != nil {
+		t.log.Warn().Err(err).Int64("user_id", userID).Msg("Failed to load monthly usage")
+	} else {
+		u.storedIn.Store(stored.BytesIn)
+		u.storedOut.Store(stored.BytesOut)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if cur := t.users[userID]; cur != nil {
+		return cur
+	}
+	if !period.Equal(t.period) {
+		// The month ended while loading, the new one starts from zero
+		u.storedIn.Store(0)
+		u.storedOut.Store(0)
+	}
+	t.users[userID] = u
+	return u
+}
+
+// current returns the month-to-date totals of a user the tracker knows.
+func (t *usageTracker) current(userID int64) (in, out int64, ok bool) {
+	t.mu.Lock()
+	u := t.users[userID]
+	t.mu.Unlock()
+	if u == nil {
+		return 0, 0, false
+	}
+	return u.storedIn.Load() + u.pendingIn.Load(), u.storedOut.Load() + u.pendingOut.Load(), true
+}
+
+// flush writes pending traffic to the store and forgets users for whom
+// connected reports false and nothing is pending. The store is written
+// without holding the lock; connected is asked under it, so a user whose
+// client connects meanwhile is kept. Traffic that fails to write stays
+// pending for the next flush. When the month has changed since the last
+// flush, the pending traffic still goes to the old month and the totals
+// start again from zero. Flushes must not run concurrently.
+//
+// Each write returns the user's stored totals, including what other nodes
+// flushed, so a quota holds across nodes with a lag of up to
+// usageFlushInterval. The totals of a user with no traffic on this node are
+// not refreshed until the user has some.
+func (t *usageTracker) flush(connected func(userID int64) bool) {
+	t.mu.Lock()
+	period := t.period
+	users := maps.Clone(t.users)
+	t.mu.Unlock()
+
+	for userID, u := range users {
+		in, out := u.pendingIn.Swap(0), u.pendingOut.Swap(0)
+		if in == 0 && out == 0 {
+			continue
+		}
+		stored, err := t.store.Add(userID, period, in, out)
+		if err != nil {
+			u.pendingIn.Add(in)
+			u.pendingOut.Add(out)
+			t.log.Warn().Err(err).Int64("user_id", userID).Msg("Failed to flush monthly usage")
+			continue
+		}
+		u.storedIn.Store(stored.BytesIn)
+		u.storedOut.Store(stored.BytesOut)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for userID, u := range t.users {
+		if u.pendingIn.Load() == 0 && u.pendingOut.Load() == 0 && !connected(userID) {
+			delete(t.users, userID)
+		}
+	}
+
+	if period := database.UsagePeriod(t.now()); !period.Equal(t.period) {
+		t.period = period
+		for _, u := range t.users {
+			u.storedIn.Store(0)
+			u.storedOut.Store(0)
+			u.notified.Store(false)
+		}
+	}
+}
+
+// runUsageFlusher flushes tunnel traffic every usageFlushInterval until the
+// server shuts down.
+func (s *Server) runUsageFlusher() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(usageFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.flushUsage()
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// flushUsage writes accumulated traffic to the database. Users stay tracked
+// while any of their clients is connected. A client is linked to its user
+// before it opens a tunnel, so asking at the time of deletion never forgets
+// a user whose new tunnel already holds the usage.
+func (s *Server) flushUsage() {
+	if s.usage == nil {
+		return
+	}
+	s.usage.flush(func(userID int64) bool {
+		return len(s.clientMgr.userClientList(userID)) > 0
+	})
+}
+
+// GetMonthlyUsage returns a user's tunnel traffic for the current month,
+// including traffic not yet flushed to the database.
+func (s *Server) GetMonthlyUsage(userID int64) (bytesIn, bytesOut int64, err error) {
+	if s.usage == nil {
+		return 0, 0, nil
+	}
+	if in, out, ok := s.usage.current(userID); ok {
+		return in, out, nil
+	}
+	stored, err := s.usage.store.Get(userID, time.Now())
+	if err != nil {
+		return 0, 0, err
+	}
+	return stored.BytesIn, stored.BytesOut, nil
+}
+
+// countIn records n bytes of visitor traffic carried into the tunnel.
+func (t *Tunnel) countIn(n int64) {
+	t.BytesIn.Add(n)
+	if t.usage != nil {
+		t.usage.pendingIn.Add(n)
+	}
+}
+
+// countOut records n bytes of the client's replies carried out of the tunnel.
+func (t *Tunnel) countOut(n int64) {
+	t.BytesOut.Add(n)
+	if t.usage != nil {
+		t.usage.pendingOut.Add(n)
+	}
+}
+
+// tunnelUsage returns the usage this client's tunnels are accounted to, or
+// nil when traffic is not tracked (no database, or a config token).
+func (c *Client) tunnelUsage() *userUsage {
+	if c.server.usage == nil || c.UserID <= 0 {
+		return nil
+	}
+	return c.server.usage.forUser(c.UserID)
+}
+
+// quotaExceeded reports whether u has reached the monthly traffic cap of the
+// client's plan. Admins and plans without a cap are never over quota.
+func (c *Client) quotaExceeded(u *userUsage) bool {
+	if u == nil || c.IsAdmin {
+		return false
+	}
+	plan := c.currentPlan()
+	if plan == nil || plan.MonthlyBytes <= 0 {
+		return false
+	}
+	return u.total() >= plan.MonthlyBytes
+}
+
+// refuseOverQuota reports whether new traffic for the tunnel must be refused
+// because the user's monthly quota is used up. The first refusal in a month
+// tells the client with a protocol error and records it in the history.
+func (c *Client) refuseOverQuota(t *Tunnel) bool {
+	if !c.quotaExceeded(t.usage) {
+		return false
+	}
+	if t.usage.notified.CompareAndSwap(false, true) {
+		message := fmt.Sprintf("monthly traffic quota of %d bytes used up, new tunnel traffic is refused", c.currentPlan().MonthlyBytes)
+		_ = c.sendControl(&protocol.ErrorMessage{
+			Message: protocol.NewMessage(protocol.MsgError),
+			Error:   message,
+			Code:    protocol.ErrCodeQuotaExceeded,
+		})
+		c.recordHistoryEvent(database.HistoryEventQuota, string(t.Type), t.LocalPort, c.tunnelURL(t), message)
+	}
+	return true
+}
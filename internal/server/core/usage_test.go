@@ -0,0 +1,202 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+	"github.com/mephistofox/fxtun.dev/internal/server/database"
+)
+
+type usageKey struct {
+	userID int64
+	period time.Time
+}
+
+// fakeUsageStore keeps monthly totals in memory.
+type fakeUsageStore struct {
+	totals map[usageKey]*database.MonthlyUsage
+	addErr error
+	onGet  func()
+}
+
+func newFakeUsageStore() *fakeUsageStore {
+	return &fakeUsageStore{totals: make(map[usageKey]*database.MonthlyUsage)}
+}
+
+func (f *fakeUsageStore) Add(userID int64, period time.Time, in, out int64) (*database.MonthlyUsage, error) {
+	if f.addErr != nil {
+		return nil, f.addErr
+	}
+	u, _ := f.Get(userID, period)
+	u.BytesIn += in
+	u.BytesOut += out
+	f.totals[usageKey{userID, database.UsagePeriod(period)}] = u
+	c := *u
+	return &c, nil
+}
+
+func (f *fakeUsageStore) Get(userID int64, period time.Time) (*database.MonthlyUsage, error) {
+	if f.onGet != nil {
+		f.onGet()
+	}
+	if u := f.totals[usageKey{userID, database.UsagePeriod(period)}]; u != nil {
+		c := *u
+		return &c, nil
+	}
+	return &database.MonthlyUsage{UserID: userID, Period: database.UsagePeriod(period)}, nil
+}
+
+func connectedNone(int64) bool { return false }
+func connectedAll(int64) bool  { return true }
+
+func TestUsageTracker_LoadsStoredTotals(t *testing.T) {
+	store := newFakeUsageStore()
+	_, err := store.Add(1, time.Now(), 100, 50)
+	require.NoError(t, err)
+	tr := newUsageTracker(store, zerolog.Nop())
+
+	u := tr.forUser(1)
+	assert.Same(t, u, tr.forUser(1))
+	assert.Equal(t, int64(150), u.total())
+}
+
+func TestUsageTracker_LoadsWithoutLock(t *testing.T) {
+	store := newFakeUsageStore()
+	tr := newUsageTracker(store, zerolog.Nop())
+	var first *userUsage
+	store.onGet = func() {
+		// A second tunnel of the user is set up while the first loads
+		store.onGet = nil
+		_, _, ok := tr.current(2)
+		assert.False(t, ok)
+		first = tr.forUser(1)
+	}
+
+	assert.Same(t, first, tr.forUser(1), "the usage added first wins")
+}
+
+func TestUsageTracker_FlushRefreshesStoredTotals(t *testing.T) {
+	store := newFakeUsageStore()
+	tr := newUsageTracker(store, zerolog.Nop())
+	u := tr.forUser(1)
+
+	// Another node flushes its traffic of the same user
+	_, err := store.Add(1, time.Now(), 500, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), u.total())
+
+	u.pendingOut.Add(20)
+	tr.flush(connectedAll)
+	assert.Equal(t, int64(520), u.total())
+}
+
+func TestUsageTracker_Flush(t *testing.T) {
+	store := newFakeUsageStore()
+	tr := newUsageTracker(store, zerolog.Nop())
+
+	tunnel := &Tunnel{usage: tr.forUser(1)}
+	tunnel.countIn(300)
+	tunnel.countOut(700)
+	assert.Equal(t, int64(300), tunnel.BytesIn.Load())
+
+	in, out, ok := tr.current(1)
+	require.True(t, ok)
+	assert.Equal(t, []int64{300, 700}, []int64{in, out})
+
+	tr.flush(connectedAll)
+	stored, _ := store.Get(1, time.Now())
+	assert.Equal(t, int64(300), stored.BytesIn)
+	assert.Equal(t, int64(700), stored.BytesOut)
+	assert.Equal(t, int64(1000), tunnel.usage.total(), "flushed traffic still counts towards the month")
+
+	// Disconnected users with nothing pending are forgotten.
+	tr.flush(connectedNone)
+	_, _, ok = tr.current(1)
+	assert.False(t, ok)
+}
+
+func TestUsageTracker_FlushFailureKeepsPending(t *testing.T) {
+	store := newFakeUsageStore()
+	tr := newUsageTracker(store, zerolog.Nop())
+	u := tr.forUser(1)
+	u.pendingIn.Add(10)
+
+	store.addErr = errors.New("db down")
+	tr.flush(connectedNone)
+	assert.Equal(t, int64(10), u.pendingIn.Load())
+	_, _, ok := tr.current(1)
+	assert.True(t, ok, "users with unflushed traffic are kept")
+
+	store.addErr = nil
+	tr.flush(connectedNone)
+	stored, _ := store.Get(1, time.Now())
+	assert.Equal(t, int64(10), stored.BytesIn)
+}
+
+func TestUsageTracker_MonthRollover(t *testing.T) {
+	store := newFakeUsageStore()
+	tr := newUsageTracker(store, zerolog.Nop())
+	september := time.Date(2026, 9, 30, 23, 59, 0, 0, time.UTC)
+	tr.period = database.UsagePeriod(september)
+	tr.now = func() time.Time { return september.Add(2 * time.Minute) }
+
+	u := tr.forUser(1)
+	u.pendingOut.Add(40)
+	u.notified.Store(true)
+	tr.flush(connectedAll)
+
+	stored, _ := store.Get(1, september)
+	assert.Equal(t, int64(40), stored.BytesOut, "pending traffic goes to the month it was counted in")
+	assert.Equal(t, int64(0), u.total())
+	assert.False(t, u.notified.Load())
+	assert.Equal(t, time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), tr.period)
+}
+
+func TestClient_RefuseOverQuota(t *testing.T) {
+	var control bytes.Buffer
+	s := &Server{cfg: &config.ServerConfig{Domain: config.DomainSettings{Base: "example.com"}}}
+	s.usage = newUsageTracker(newFakeUsageStore(), zerolog.Nop())
+	c := &Client{ID: "c1", UserID: 1, server: s, log: zerolog.Nop(),
+		ControlCodec: protocol.NewCodec(&control, &control),
+		Plan:         &database.Plan{MonthlyBytes: 1000}}
+	tunnel := &Tunnel{ID: "t1", Type: protocol.TunnelHTTP, Subdomain: "app", usage: c.tunnelUsage()}
+
+	tunnel.countIn(999)
+	assert.False(t, c.refuseOverQuota(tunnel))
+	assert.Zero(t, control.Len())
+
+	tunnel.countOut(1)
+	assert.True(t, c.refuseOverQuota(tunnel))
+	assert.True(t, c.refuseOverQuota(tunnel))
+
+	var msg protocol.ErrorMessage
+	require.NoError(t, c.ControlCodec.Decode(&msg))
+	assert.Equal(t, protocol.ErrCodeQuotaExceeded, msg.Code)
+	assert.False(t, msg.Fatal)
+	assert.Zero(t, control.Len(), "the client is told only once")
+
+	c.IsAdmin = true
+	assert.False(t, c.refuseOverQuota(tunnel), "admins are never capped")
+	c.IsAdmin = false
+	c.Plan = &database.Plan{}
+	assert.False(t, c.refuseOverQuota(tunnel), "plans without a cap are unlimited")
+}
+
+func TestClient_TunnelUsageUntracked(t *testing.T) {
+	s := &Server{usage: newUsageTracker(newFakeUsageStore(), zerolog.Nop())}
+	assert.Nil(t, (&Client{server: s}).tunnelUsage(), "config tokens have no user")
+	assert.Nil(t, (&Client{UserID: 1, server: &Server{}}).tunnelUsage(), "no database")
+
+	// Untracked tunnels still count their own traffic.
+	tunnel := &Tunnel{}
+	tunnel.countIn(5)
+	assert.Equal(t, int64(5), tunnel.BytesIn.Load())
+}
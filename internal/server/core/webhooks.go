@@ -0,0 +1,217 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+const (
+	defaultWebhookBuffer      = 1024
+	defaultWebhookTimeout     = 10 * time.Second
+	defaultWebhookMaxAttempts = 5
+	// webhookBackoff is the wait before the second attempt of a delivery;
+	// it doubles for every further attempt up to webhookMaxBackoff.
+	webhookBackoff    = time.Second
+	webhookMaxBackoff = 30 * time.Second
+	// webhookSignatureHeader carries "sha256=" and the hex HMAC-SHA256 of
+	// the request body keyed with server.webhooks.secret.
+	webhookSignatureHeader = "X-FxTunnel-Signature"
+)
+
+// webhookEvent is the JSON body of one webhook delivery.
+type webhookEvent struct {
+	Event      string    `json:"event"`
+	TunnelID   string    `json:"tunnel_id,omitempty"`
+	TunnelType string    `json:"tunnel_type"`
+	Name       string    `json:"name,omitempty"`
+	Subdomain  string    `json:"subdomain,omitempty"`
+	RemotePort int       `json:"remote_port,omitempty"`
+	UserID     int64     `json:"user_id,omitempty"`
+	ClientID   string    `json:"client_id"`
+	Error      string    `json:"error,omitempty"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// webhookEmitter delivers tunnel events through an asyncWorker, so a slow or
+// failing endpoint never delays tunnels.
+type webhookEmitter struct {
+	url         string
+	secret      []byte
+	events      []string // nil sends every event
+	maxAttempts int
+	backoff     time.Duration
+	client      *http.Client
+	log         zerolog.Logger
+	worker      *asyncWorker[webhookEvent]
+	dropped     atomic.Int64
+}
+
+// newWebhookEmitter starts the emitter cfg describes. It returns nil when
+// webhooks are disabled.
+func newWebhookEmitter(cfg config.WebhookSettings, log zerolog.Logger) *webhookEmitter {
+	if cfg.URL == "" {
+		return nil
+	}
+	bufferSize := cfg.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = defaultWebhookBuffer
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultWebhookTimeout
+	}
+	maxAttempts := cfg.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultWebhookMaxAttempts
+	}
+
+	w := &webhookEmitter{
+		url:         cfg.URL,
+		secret:      []byte(cfg.Secret),
+		events:      cfg.Events,
+		maxAttempts: maxAttempts,
+		backoff:     webhookBackoff,
+		client:      &http.Client{Timeout: timeout},
+		log:         log.With().Str("component", "webhooks").Logger(),
+	}
+	w.worker = newAsyncWorker(bufferSize, w.handle)
+	return w
+}
+
+// emit queues e for delivery without blocking. A nil emitter is a no-op.
+func (w *webhookEmitter) emit(e webhookEvent) {
+	if w == nil || (len(w.events) > 0 && !slices.Contains(w.events, e.Event)) {
+		return
+	}
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now().UTC()
+	}
+	if !w.worker.push(e) {
+		w.dropped.Add(1)
+	}
+}
+
+func (w *webhookEmitter) handle(ctx context.Context, e webhookEvent) {
+	w.deliver(ctx, e)
+	if n := w.dropped.Swap(0); n > 0 {
+		w.log.Warn().Int64("dropped", n).Msg("Webhook events dropped, endpoint is falling behind")
+	}
+}
+
+// deliver posts e, retrying with exponential backoff on network errors,
+// 429 and 5xx responses. Other responses are final.
+func (w *webhookEmitter) deliver(ctx context.Context, e webhookEvent) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		w.log.Error().Err(err).Str("event", e.Event).Msg("Failed to encode webhook event")
+		return
+	}
+
+	backoff := w.backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := w.post(ctx, body)
+		if err == nil {
+			return
+		}
+		if !retry || attempt >= w.maxAttempts {
+			w.log.Warn().Err(err).Str("event", e.Event).Str("tunnel_id", e.TunnelID).Int("attempts", attempt).
+				Msg("Webhook delivery failed")
+			return
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff = min(backoff*2, webhookMaxBackoff)
+	}
+}
+
+// post sends one attempt and reports whether a failure is worth retrying.
+func (w *webhookEmitter) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "fxTunnel-Webhooks")
+	req.Header.Set(webhookSignatureHeader, "sha256="+signWebhook(w.secret, body))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("endpoint returned %s", resp.Status)
+	default:
+		return false, fmt.Errorf("endpoint returned %s", resp.Status)
+	}
+}
+
+// signWebhook returns the hex HMAC-SHA256 of body.
+func signWebhook(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// close stops the emitter. A delivery in progress is aborted and queued
+// events are discarded, so a dead endpoint cannot hold up shutdown. A nil
+// emitter is a no-op.
+func (w *webhookEmitter) close() {
+	if w == nil {
+		return
+	}
+	if n := w.worker.close(); n > 0 {
+		w.log.Warn().Int("discarded", n).Msg("Webhook events discarded at shutdown")
+	}
+}
+
+// emitTunnelEvent sends a webhook for one of the client's tunnels. errMsg
+// is only set for tunnel.error.
+func (c *Client) emitTunnelEvent(event string, tunnel *Tunnel, errMsg string) {
+	c.server.webhooks.emit(webhookEvent{
+		Event:      event,
+		TunnelID:   tunnel.ID,
+		TunnelType: string(tunnel.Type),
+		Name:       tunnel.Name,
+		Subdomain:  tunnel.Subdomain,
+		RemotePort: tunnel.RemotePort,
+		UserID:     c.UserID,
+		ClientID:   c.ID,
+		Error:      errMsg,
+	})
+}
+
+// emitTunnelRejected sends a tunnel.error webhook for a tunnel request that
+// was refused before a tunnel existed.
+func (c *Client) emitTunnelRejected(req *protocol.TunnelRequestMessage, errMsg string) {
+	c.server.webhooks.emit(webhookEvent{
+		Event:      config.WebhookTunnelError,
+		TunnelType: string(req.TunnelType),
+		Name:       req.Name,
+		Subdomain:  req.Subdomain,
+		RemotePort: req.RemotePort,
+		UserID:     c.UserID,
+		ClientID:   c.ID,
+		Error:      errMsg,
+	})
+}
@@ -0,0 +1,144 @@
+package core
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+	"github.com/mephistofox/fxtun.dev/internal/protocol"
+)
+
+// webhookReceiver records the deliveries made to it. fail makes the first
+// n requests answer 500.
+type webhookReceiver struct {
+	srv      *httptest.Server
+	bodies   chan []byte
+	sigs     chan string
+	requests atomic.Int64
+	fail     int64
+}
+
+func newWebhookReceiver(t *testing.T, fail int64) *webhookReceiver {
+	t.Helper()
+	r := &webhookReceiver{bodies: make(chan []byte, 16), sigs: make(chan string, 16), fail: fail}
+	r.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if r.requests.Add(1) <= r.fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body, _ := io.ReadAll(req.Body)
+		r.bodies <- body
+		r.sigs <- req.Header.Get(webhookSignatureHeader)
+	}))
+	t.Cleanup(r.srv.Close)
+	return r
+}
+
+func (r *webhookReceiver) next(t *testing.T) (webhookEvent, []byte, string) {
+	t.Helper()
+	select {
+	case body := <-r.bodies:
+		var e webhookEvent
+		require.NoError(t, json.Unmarshal(body, &e))
+		return e, body, <-r.sigs
+	case <-time.After(5 * time.Second):
+		t.Fatal("no webhook delivered")
+		return webhookEvent{}, nil, ""
+	}
+}
+
+func TestWebhookEmitter_TunnelEvents(t *testing.T) {
+	recv := newWebhookReceiver(t, 0)
+	w := newWebhookEmitter(config.WebhookSettings{URL: recv.srv.URL, Secret: "s3cret"}, zerolog.Nop())
+	defer w.close()
+
+	c := &Client{ID: "c1", UserID: 42, server: &Server{webhooks: w}}
+	tunnel := &Tunnel{ID: "t1", Type: protocol.TunnelHTTP, Name: "web", Subdomain: "myapp"}
+	c.emitTunnelEvent(config.WebhookTunnelCreated, tunnel, "")
+
+	e, body, sig := recv.next(t)
+	assert.Equal(t, config.WebhookTunnelCreated, e.Event)
+	assert.Equal(t, "t1", e.TunnelID)
+	assert.Equal(t, "http", e.TunnelType)
+	assert.Equal(t, "web", e.Name)
+	assert.Equal(t, "myapp", e.Subdomain)
+	assert.Equal(t, int64(42), e.UserID)
+	assert.Equal(t, "c1", e.ClientID)
+	assert.WithinDuration(t, time.Now(), e.Timestamp, 5*time.Second)
+	assert.Equal(t, "sha256="+signWebhook([]byte("s3cret"), body), sig)
+
+	c.emitTunnelRejected(&protocol.TunnelRequestMessage{TunnelType: protocol.TunnelTCP, RemotePort: 2222},
+		"PORT_UNAVAILABLE: port is taken")
+	e, _, _ = recv.next(t)
+	assert.Equal(t, config.WebhookTunnelError, e.Event)
+	assert.Equal(t, "tcp", e.TunnelType)
+	assert.Equal(t, 2222, e.RemotePort)
+	assert.Equal(t, "PORT_UNAVAILABLE: port is taken", e.Error)
+}
+
+func TestWebhookEmitter_RetriesServerErrors(t *testing.T) {
+	recv := newWebhookReceiver(t, 2)
+	w := newWebhookEmitter(config.WebhookSettings{URL: recv.srv.URL}, zerolog.Nop())
+	w.backoff = time.Millisecond
+	defer w.close()
+
+	w.emit(webhookEvent{Event: config.WebhookTunnelClosed, TunnelID: "t1"})
+	e, _, _ := recv.next(t)
+	assert.Equal(t, "t1", e.TunnelID)
+	assert.Equal(t, int64(3), recv.requests.Load())
+}
+
+func TestWebhookEmitter_EventFilter(t *testing.T) {
+	recv := newWebhookReceiver(t, 0)
+	w := newWebhookEmitter(config.WebhookSettings{
+		URL:    recv.srv.URL,
+		Events: []string{config.WebhookTunnelClosed},
+	}, zerolog.Nop())
+	defer w.close()
+
+	w.emit(webhookEvent{Event: config.WebhookTunnelCreated, TunnelID: "t1"})
+	w.emit(webhookEvent{Event: config.WebhookTunnelClosed, TunnelID: "t1"})
+	e, _, _ := recv.next(t)
+	assert.Equal(t, config.WebhookTunnelClosed, e.Event)
+	assert.Equal(t, int64(1), recv.requests.Load())
+}
+
+func TestWebhookEmitter_SlowEndpointDoesNotBlock(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-release:
+		case <-req.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	w := newWebhookEmitter(config.WebhookSettings{URL: srv.URL, BufferSize: 2}, zerolog.Nop())
+	start := time.Now()
+	for range 100 {
+		w.emit(webhookEvent{Event: config.WebhookTunnelCreated})
+	}
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Positive(t, w.dropped.Load())
+
+	start = time.Now()
+	w.close()
+	assert.Less(t, time.Since(start), time.Second, "close must abort a hanging delivery")
+}
+
+func TestWebhookEmitter_Disabled(t *testing.T) {
+	w := newWebhookEmitter(config.WebhookSettings{}, zerolog.Nop())
+	assert.Nil(t, w)
+	w.emit(webhookEvent{Event: config.WebhookTunnelCreated})
+	w.close()
+}
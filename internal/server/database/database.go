@@ -32,12 +32,16 @@ type Database struct {
 	UserBundles   *UserBundleRepository
 	UserHistory   *UserHistoryRepository
 	UserSettings  *UserSettingsRepository
+	Usage         *UsageRepository
 	Plans         *PlanRepository
 	Subscriptions *SubscriptionRepository
 	Payments      *PaymentRepository
 	Exchanges     *ExchangeRepository
 	EdgeNodes     *EdgeNodeRepository
 	InviteCodes   *InviteCodeRepository
+	Abuse         *AbuseRepository
+	Collections   *CollectionRepository
+	InspectShares *InspectShareRepository
 }
 
 // New creates a new PostgreSQL database connection pool and initializes repositories.
@@ -69,18 +73,22 @@ func New(dsn string, log zerolog.Logger) (*Database, error) {
 		Users:         &UserRepository{q: q, pool: pool},
 		Sessions:      &SessionRepository{q: q},
 		Tokens:        &APITokenRepository{q: q},
-		Domains:       &DomainRepository{q: q},
+		Domains:       &DomainRepository{q: q, pool: pool},
 		TOTP:          &TOTPRepository{q: q},
 		Audit:         &AuditRepository{q: q},
 		UserBundles:   &UserBundleRepository{q: q},
 		UserHistory:   &UserHistoryRepository{q: q},
 		UserSettings:  &UserSettingsRepository{q: q},
+		Usage:         &UsageRepository{q: q},
 		Plans:         &PlanRepository{q: q},
 		Subscriptions: &SubscriptionRepository{q: q},
 		Payments:      &PaymentRepository{q: q, pool: pool},
 		Exchanges:     &ExchangeRepository{q: q},
 		EdgeNodes:     &EdgeNodeRepository{pool: pool},
 		InviteCodes:   &InviteCodeRepository{pool: pool},
+		Abuse:         &AbuseRepository{pool: pool},
+		Collections:   &CollectionRepository{pool: pool},
+		InspectShares: &InspectShareRepository{pool: pool},
 	}
 
 	lg.Info().Msg("Database initialized")
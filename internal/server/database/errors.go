@@ -38,6 +38,15 @@ var (
 	ErrEdgeNodeNotFound = errors.New("edge node not found")
 
 	ErrInviteCodeNotFound = errors.New("invite code not found")
+
+	ErrAbuseReportNotFound = errors.New("abuse report not found")
+	ErrNotSuspended        = errors.New("subdomain is not suspended")
+
+	ErrCollectionNotFound     = errors.New("collection not found")
+	ErrCollectionExists       = errors.New("collection already exists")
+	ErrCollectionItemNotFound = errors.New("collection item not found")
+
+	ErrInspectShareNotFound = errors.New("inspect share not found")
 )
 
 // notFoundOrError returns the sentinel error if the underlying error is
@@ -0,0 +1,11 @@
+-- +goose Up
+-- History rows were only tunnel sessions (connect/disconnect with byte
+-- totals). Events such as rate-limit throttling, reconnects and rejected
+-- tunnel requests are stored in the same table as point-in-time rows:
+-- connected_at is the event time and details carries a short description.
+ALTER TABLE user_history ADD COLUMN event TEXT NOT NULL DEFAULT 'session';
+ALTER TABLE user_history ADD COLUMN details TEXT;
+
+-- +goose Down
+ALTER TABLE user_history DROP COLUMN details;
+ALTER TABLE user_history DROP COLUMN event;
@@ -0,0 +1,19 @@
+-- +goose Up
+-- Raw history older than the retention window (or beyond the per-user entry
+-- cap) is pruned by the scheduler. Pruned rows are folded into per-day
+-- totals here first, so lifetime stats survive pruning and GetHistoryStats
+-- only scans a bounded number of raw rows plus one row per day.
+CREATE TABLE user_history_daily (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    connections BIGINT NOT NULL DEFAULT 0,
+    bytes_sent BIGINT NOT NULL DEFAULT 0,
+    bytes_received BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY(user_id, day)
+);
+
+CREATE INDEX idx_user_history_user_connected ON user_history(user_id, connected_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_user_history_user_connected;
+DROP TABLE IF EXISTS user_history_daily;
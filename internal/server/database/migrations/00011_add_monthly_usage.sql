@@ -0,0 +1,19 @@
+-- +goose Up
+-- Tunnel traffic per user and calendar month (UTC), accumulated by the
+-- tunnel server and flushed here periodically. period is the first day of
+-- the month. bytes_in is visitor traffic towards the user's client,
+-- bytes_out the replies.
+CREATE TABLE monthly_usage (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    period DATE NOT NULL,
+    bytes_in BIGINT NOT NULL DEFAULT 0,
+    bytes_out BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY(user_id, period)
+);
+
+-- Monthly traffic cap in bytes (in + out). 0 means unlimited.
+ALTER TABLE plans ADD COLUMN monthly_bytes BIGINT NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE plans DROP COLUMN monthly_bytes;
+DROP TABLE IF EXISTS monthly_usage;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- GitLab user ID of a linked account. Only one GitLab instance (gitlab.com
+-- or a self-hosted one) is configured at a time, so the ID alone is unique.
+ALTER TABLE users ADD COLUMN gitlab_id BIGINT;
+CREATE UNIQUE INDEX idx_users_gitlab_id ON users(gitlab_id) WHERE gitlab_id IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_users_gitlab_id;
+ALTER TABLE users DROP COLUMN gitlab_id;
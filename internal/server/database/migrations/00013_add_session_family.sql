@@ -0,0 +1,12 @@
+-- +goose Up
+-- family_id groups the sessions a login rotates through; rotated_at marks a
+-- rotated-away session kept only to detect reuse of its refresh token.
+-- Sessions from before this migration have no family.
+ALTER TABLE sessions ADD COLUMN family_id VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN rotated_at TIMESTAMPTZ;
+CREATE INDEX idx_sessions_user_family ON sessions(user_id, family_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_sessions_user_family;
+ALTER TABLE sessions DROP COLUMN rotated_at;
+ALTER TABLE sessions DROP COLUMN family_id;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- expires_at ends a reservation; NULL keeps it until the user releases it.
+ALTER TABLE reserved_domains ADD COLUMN expires_at TIMESTAMPTZ;
+CREATE INDEX idx_reserved_domains_expires ON reserved_domains(expires_at) WHERE expires_at IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_reserved_domains_expires;
+ALTER TABLE reserved_domains DROP COLUMN expires_at;
@@ -0,0 +1,37 @@
+-- +goose Up
+-- Abuse reports submitted by visitors of public tunnels. user_id is the
+-- owner of the reported subdomain when the report came in, if known.
+CREATE TABLE abuse_reports (
+    id BIGSERIAL PRIMARY KEY,
+    subdomain TEXT NOT NULL,
+    url TEXT NOT NULL DEFAULT '',
+    category TEXT NOT NULL,
+    details TEXT NOT NULL DEFAULT '',
+    reporter_email TEXT NOT NULL DEFAULT '',
+    reporter_ip TEXT NOT NULL DEFAULT '',
+    user_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    status TEXT NOT NULL DEFAULT 'open',
+    resolved_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    resolved_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_abuse_reports_status ON abuse_reports(status, created_at DESC);
+
+-- Subdomains taken down for abuse. The tunnel server refuses tunnels on
+-- them and serves a suspension page instead.
+CREATE TABLE suspended_subdomains (
+    subdomain TEXT PRIMARY KEY,
+    user_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    report_id BIGINT REFERENCES abuse_reports(id) ON DELETE SET NULL,
+    suspended_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Set when one of the user's subdomains is suspended for abuse.
+ALTER TABLE users ADD COLUMN abuse_flagged_at TIMESTAMPTZ;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN abuse_flagged_at;
+DROP TABLE IF EXISTS suspended_subdomains;
+DROP TABLE IF EXISTS abuse_reports;
@@ -0,0 +1,30 @@
+-- +goose Up
+-- Named sets of saved requests, for re-running captured or hand-edited
+-- requests through a tunnel later.
+CREATE TABLE collections (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, name)
+);
+
+-- A saved request. source_exchange_id is the captured exchange it was
+-- saved from, if any; the exchange itself may be gone by now.
+CREATE TABLE collection_items (
+    id BIGSERIAL PRIMARY KEY,
+    collection_id BIGINT NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
+    name TEXT NOT NULL DEFAULT '',
+    method TEXT NOT NULL,
+    path TEXT NOT NULL,
+    host TEXT NOT NULL DEFAULT '',
+    headers JSONB NOT NULL DEFAULT '{}',
+    body BYTEA,
+    source_exchange_id TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_collection_items_collection ON collection_items(collection_id, id);
+
+-- +goose Down
+DROP TABLE IF EXISTS collection_items;
+DROP TABLE IF EXISTS collections;
@@ -0,0 +1,7 @@
+-- +goose Up
+-- Exchanges the traffic inspector keeps per tunnel for users of the plan.
+-- 0 means the server's inspect.max_entries.
+ALTER TABLE plans ADD COLUMN inspect_max_entries INTEGER NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE plans DROP COLUMN inspect_max_entries;
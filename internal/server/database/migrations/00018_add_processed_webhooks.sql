@@ -0,0 +1,20 @@
+-- +goose Up
+-- Payment webhook deliveries, one row per provider event. A delivery whose
+-- event is already here is a duplicate and is acknowledged without being
+-- processed again. status is the HTTP status the event was answered with,
+-- 0 while it is being processed. An event answered with 5xx, or left
+-- unanswered by a crash, is processed again when the provider retries it.
+CREATE TABLE processed_webhooks (
+    provider TEXT NOT NULL,
+    event_id TEXT NOT NULL,
+    event TEXT NOT NULL,
+    status INTEGER NOT NULL DEFAULT 0,
+    attempts INTEGER NOT NULL DEFAULT 1,
+    received_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    claimed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    processed_at TIMESTAMPTZ,
+    PRIMARY KEY(provider, event_id)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS processed_webhooks;
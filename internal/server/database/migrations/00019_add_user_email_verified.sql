@@ -0,0 +1,7 @@
+-- +goose Up
+-- Set when an OAuth provider vouches for the user's email address; checkout
+-- can require it (payments.require_verified_email).
+ALTER TABLE users ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN email_verified;
@@ -0,0 +1,7 @@
+-- +goose Up
+-- Socks tunnels send traffic out from the server's own address, so no plan
+-- offers them until an admin turns them on.
+ALTER TABLE plans ADD COLUMN socks_enabled BOOLEAN NOT NULL DEFAULT false;
+
+-- +goose Down
+ALTER TABLE plans DROP COLUMN socks_enabled;
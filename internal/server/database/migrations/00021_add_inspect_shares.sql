@@ -0,0 +1,15 @@
+-- +goose Up
+-- Read-only links to the inspector of a user's tunnel. A share token names
+-- its row, so a revoked link stops working before the token expires.
+CREATE TABLE inspect_shares (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    subdomain TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_inspect_shares_user ON inspect_shares(user_id, created_at DESC);
+
+-- +goose Down
+DROP TABLE IF EXISTS inspect_shares;
@@ -52,7 +52,9 @@ type User struct {
 	LastLoginAt   *time.Time `json:"last_login_at,omitempty"`
 	GitHubID      *int64     `json:"github_id,omitempty"`
 	GoogleID      *string    `json:"google_id,omitempty"`
+	GitLabID      *int64     `json:"gitlab_id,omitempty"`
 	Email         string     `json:"email,omitempty"`
+	EmailVerified bool       `json:"email_verified"`
 	AvatarURL     string     `json:"avatar_url,omitempty"`
 	PlanID        int64      `json:"plan_id"`
 	FirstTunnelAt *time.Time `json:"first_tunnel_at,omitempty"`
@@ -77,8 +79,11 @@ type Plan struct {
 	RateLimitUDP       int     `json:"rate_limit_udp"`  // UDP packets per tunnel per second (0=default, -1=unlimited)
 	RateLimitHTTP      int     `json:"rate_limit_http"` // HTTP requests per tunnel per minute (0=default, -1=unlimited)
 	CreemProductID     string  `json:"creem_product_id,omitempty"`
-	MaxDataSessions    int     `json:"max_data_sessions"` // Max data sessions per client (0=default(8), -1=unlimited)
-	UDPEnabled         bool    `json:"udp_enabled"`       // false => server rejects UDP tunnel requests from this plan
+	MaxDataSessions    int     `json:"max_data_sessions"`   // Max data sessions per client (0=default(8), -1=unlimited)
+	UDPEnabled         bool    `json:"udp_enabled"`         // false => server rejects UDP tunnel requests from this plan
+	MonthlyBytes       int64   `json:"monthly_bytes"`       // Monthly tunnel traffic cap, in + out (0=unlimited)
+	InspectMaxEntries  int     `json:"inspect_max_entries"` // Exchanges the inspector keeps per tunnel (0=server default)
+	SOCKSEnabled       bool    `json:"socks_enabled"`       // false => server rejects socks tunnel requests from this plan
 }
 
 // ReservedDomain represents a subdomain reserved by a user
@@ -87,6 +92,10 @@ type ReservedDomain struct {
 	UserID    int64     `json:"user_id"`
 	Subdomain string    `json:"subdomain"`
 	CreatedAt time.Time `json:"created_at"`
+
+	// ExpiresAt is when the reservation is released; nil keeps it until the
+	// user releases it.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
 }
 
 // Session represents a user session (refresh token)
@@ -98,6 +107,11 @@ type Session struct {
 	IPAddress        string    `json:"ip_address,omitempty"`
 	ExpiresAt        time.Time `json:"expires_at"`
 	CreatedAt        time.Time `json:"created_at"`
+
+	// FamilyID is shared by the sessions a login rotates through, so a
+	// reused refresh token revokes only its own device's chain. Empty for
+	// sessions created before families existed.
+	FamilyID string `json:"-"`
 }
 
 // IsExpired returns true if the session has expired
@@ -192,22 +206,27 @@ type AuditLog struct {
 
 // Audit log action constants
 const (
-	ActionLogin          = "login"
-	ActionLogout         = "logout"
-	ActionRegister       = "register"
-	ActionPasswordChange = "password_change"
-	ActionTokenCreated   = "token_created"
-	ActionTokenDeleted   = "token_deleted"
-	ActionDomainReserved = "domain_reserved"
-	ActionDomainReleased = "domain_released"
-	ActionTunnelCreated  = "tunnel_created"
-	ActionTunnelClosed   = "tunnel_closed"
-	ActionTOTPEnabled    = "totp_enabled"
-	ActionTOTPDisabled   = "totp_disabled"
-	ActionUserUpdated    = "user_updated"
-	ActionUserDeleted    = "user_deleted"
-	ActionUsersMerged    = "users_merged"
-	ActionPasswordReset  = "password_reset"
+	ActionLogin                = "login"
+	ActionLogout               = "logout"
+	ActionRegister             = "register"
+	ActionPasswordChange       = "password_change"
+	ActionTokenCreated         = "token_created"
+	ActionTokenDeleted         = "token_deleted"
+	ActionDomainReserved       = "domain_reserved"
+	ActionDomainReleased       = "domain_released"
+	ActionTunnelCreated        = "tunnel_created"
+	ActionTunnelClosed         = "tunnel_closed"
+	ActionClientDisconnected   = "client_disconnected"
+	ActionTOTPEnabled          = "totp_enabled"
+	ActionTOTPDisabled         = "totp_disabled"
+	ActionUserUpdated          = "user_updated"
+	ActionUserDeleted          = "user_deleted"
+	ActionUsersMerged          = "users_merged"
+	ActionPasswordReset        = "password_reset"
+	ActionRefreshTokenReuse    = "refresh_token_reuse"
+	ActionSubdomainSuspended   = "subdomain_suspended"
+	ActionAbuseDismissed       = "abuse_report_dismissed"
+	ActionSubdomainUnsuspended = "subdomain_unsuspended"
 )
 
 // CustomDomain represents a user-bound custom domain
@@ -260,6 +279,103 @@ type UserHistoryEntry struct {
 	DisconnectedAt *time.Time `json:"disconnected_at,omitempty"`
 	BytesSent      int64      `json:"bytes_sent"`
 	BytesReceived  int64      `json:"bytes_received"`
+	Event          string     `json:"event"`
+	Details        string     `json:"details,omitempty"`
+}
+
+// History event kinds. Session rows span a connection; the others are
+// point-in-time events stamped with ConnectedAt.
+const (
+	HistoryEventSession     = "session"
+	HistoryEventReconnect   = "reconnect"
+	HistoryEventThrottled   = "throttled"
+	HistoryEventTunnelError = "tunnel_error"
+	HistoryEventQuota       = "quota_exceeded"
+)
+
+// AbuseReport is a visitor's report of a tunnel serving phishing, malware
+// or other abusive content.
+type AbuseReport struct {
+	ID            int64      `json:"id"`
+	Subdomain     string     `json:"subdomain"`
+	URL           string     `json:"url,omitempty"`
+	Category      string     `json:"category"`
+	Details       string     `json:"details,omitempty"`
+	ReporterEmail string     `json:"reporter_email,omitempty"`
+	ReporterIP    string     `json:"reporter_ip,omitempty"`
+	UserID        *int64     `json:"user_id,omitempty"` // owner of the subdomain when reported
+	Status        string     `json:"status"`
+	ResolvedBy    *int64     `json:"resolved_by,omitempty"`
+	ResolvedAt    *time.Time `json:"resolved_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	// OwnerFlagged is true when the owner has been flagged for abuse.
+	OwnerFlagged bool `json:"owner_flagged"`
+}
+
+// Abuse report categories and statuses.
+const (
+	AbuseCategoryPhishing = "phishing"
+	AbuseCategoryMalware  = "malware"
+	AbuseCategorySpam     = "spam"
+	AbuseCategoryOther    = "other"
+
+	AbuseStatusOpen      = "open"
+	AbuseStatusSuspended = "suspended"
+	AbuseStatusDismissed = "dismissed"
+)
+
+// IsAbuseCategory reports whether c is a known abuse report category.
+func IsAbuseCategory(c string) bool {
+	switch c {
+	case AbuseCategoryPhishing, AbuseCategoryMalware, AbuseCategorySpam, AbuseCategoryOther:
+		return true
+	}
+	return false
+}
+
+// SuspendedSubdomain is a subdomain taken down for abuse.
+type SuspendedSubdomain struct {
+	Subdomain   string    `json:"subdomain"`
+	UserID      *int64    `json:"user_id,omitempty"`
+	Reason      string    `json:"reason"`
+	ReportID    *int64    `json:"report_id,omitempty"`
+	SuspendedBy *int64    `json:"suspended_by,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Collection is a user's named set of saved requests.
+type Collection struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	Name      string    `json:"name"`
+	ItemCount int       `json:"item_count"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CollectionItem is a request saved to a collection, ready to be sent
+// through a tunnel again.
+type CollectionItem struct {
+	ID               int64               `json:"id"`
+	CollectionID     int64               `json:"collection_id"`
+	Name             string              `json:"name,omitempty"`
+	Method           string              `json:"method"`
+	Path             string              `json:"path"`
+	Host             string              `json:"host,omitempty"`
+	Headers          map[string][]string `json:"headers"`
+	Body             []byte              `json:"body,omitempty"`
+	SourceExchangeID string              `json:"source_exchange_id,omitempty"`
+	CreatedAt        time.Time           `json:"created_at"`
+}
+
+// InspectShare is a read-only link to the inspector of the user's tunnel on
+// Subdomain.
+type InspectShare struct {
+	ID        int64      `json:"id"`
+	UserID    int64      `json:"user_id"`
+	Subdomain string     `json:"subdomain"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
 }
 
 // HistoryStats represents aggregated history statistics
@@ -269,6 +385,22 @@ type HistoryStats struct {
 	TotalBytesReceived int64 `json:"total_bytes_received"`
 }
 
+// MonthlyUsage is a user's tunnel traffic for one calendar month (UTC).
+// BytesIn is visitor traffic towards the user's client, BytesOut the replies.
+type MonthlyUsage struct {
+	UserID   int64     `json:"user_id"`
+	Period   time.Time `json:"period"` // first day of the month
+	BytesIn  int64     `json:"bytes_in"`
+	BytesOut int64     `json:"bytes_out"`
+}
+
+// UsagePeriod returns the month t falls in, as the first day of that month
+// in UTC.
+func UsagePeriod(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
 // UserSetting represents a user setting key-value pair
 type UserSetting struct {
 	UserID    int64     `json:"user_id"`
@@ -81,3 +81,12 @@ func TestMatchWildcard(t *testing.T) {
 		})
 	}
 }
+
+func TestUsagePeriod(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	assert.Equal(t, time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+		UsagePeriod(time.Date(2026, 10, 16, 12, 30, 0, 0, time.UTC)))
+	// 00:30 on the 1st at UTC+3 is still the previous month in UTC.
+	assert.Equal(t, time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC),
+		UsagePeriod(time.Date(2026, 10, 1, 0, 30, 0, 0, loc)))
+}
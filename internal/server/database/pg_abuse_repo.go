@@ -0,0 +1,190 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// AbuseRepository handles abuse reports and suspended subdomains using raw SQL.
+type AbuseRepository struct {
+	pool *pgxpool.Pool
+}
+
+const abuseReportColumns = `r.id, r.subdomain, r.url, r.category, r.details, r.reporter_email, r.reporter_ip,
+	r.user_id, r.status, r.resolved_by, r.resolved_at, r.created_at, u.abuse_flagged_at IS NOT NULL`
+
+func scanAbuseReport(row pgx.Row) (*AbuseReport, error) {
+	r := &AbuseReport{}
+	var flagged *bool
+	err := row.Scan(&r.ID, &r.Subdomain, &r.URL, &r.Category, &r.Details, &r.ReporterEmail, &r.ReporterIP,
+		&r.UserID, &r.Status, &r.ResolvedBy, &r.ResolvedAt, &r.CreatedAt, &flagged)
+	if flagged != nil {
+		r.OwnerFlagged = *flagged
+	}
+	return r, err
+}
+
+// CreateReport stores a new open report and fills in its ID, status and
+// creation time.
+func (r *AbuseRepository) CreateReport(report *AbuseReport) error {
+	ctx := context.Background()
+	query := `INSERT INTO abuse_reports (subdomain, url, category, details, reporter_email, reporter_ip, user_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, status, created_at`
+
+	err := r.pool.QueryRow(ctx, query, report.Subdomain, report.URL, report.Category, report.Details,
+		report.ReporterEmail, report.ReporterIP, report.UserID).Scan(&report.ID, &report.Status, &report.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("create abuse report: %w", err)
+	}
+	return nil
+}
+
+// GetReport returns a report by ID.
+func (r *AbuseRepository) GetReport(id int64) (*AbuseReport, error) {
+	ctx := context.Background()
+	query := `SELECT ` + abuseReportColumns + `
+		FROM abuse_reports r LEFT JOIN users u ON u.id = r.user_id
+		WHERE r.id = $1`
+
+	report, err := scanAbuseReport(r.pool.QueryRow(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrAbuseReportNotFound
+		}
+		return nil, fmt.Errorf("get abuse report: %w", err)
+	}
+	return report, nil
+}
+
+// ListReports returns reports newest first, optionally only those with the
+// given status. Returns reports, total count, and error.
+func (r *AbuseRepository) ListReports(status string, limit, offset int) ([]*AbuseReport, int, error) {
+	ctx := context.Background()
+
+	if limit <= 0 {
+		limit = 100
+	}
+
+	var total int
+	err := r.pool.QueryRow(ctx, `SELECT COUNT(*) FROM abuse_reports WHERE $1 = '' OR status = $1`, status).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("count abuse reports: %w", err)
+	}
+
+	query := `SELECT ` + abuseReportColumns + `
+		FROM abuse_reports r LEFT JOIN users u ON u.id = r.user_id
+		WHERE $1 = '' OR r.status = $1
+		ORDER BY r.created_at DESC
+		LIMIT $2 OFFSET $3`
+
+	rows, err := r.pool.Query(ctx, query, status, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list abuse reports: %w", err)
+	}
+	defer rows.Close()
+
+	var reports []*AbuseReport
+	for rows.Next() {
+		report, err := scanAbuseReport(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("scan abuse report: %w", err)
+		}
+		reports = append(reports, report)
+	}
+	return reports, total, rows.Err()
+}
+
+// DismissReport closes an open report without action.
+func (r *AbuseRepository) DismissReport(id, adminID int64) error {
+	ctx := context.Background()
+	query := `UPDATE abuse_reports SET status = $2, resolved_by = $3, resolved_at = NOW()
+		WHERE id = $1 AND status = $4`
+
+	tag, err := r.pool.Exec(ctx, query, id, AbuseStatusDismissed, adminID, AbuseStatusOpen)
+	if err != nil {
+		return fmt.Errorf("dismiss abuse report: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrAbuseReportNotFound
+	}
+	return nil
+}
+
+// Suspend takes a subdomain down: it records the suspension, resolves every
+// open report for the subdomain and flags the owner, in one transaction.
+func (r *AbuseRepository) Suspend(s *SuspendedSubdomain) error {
+	ctx := context.Background()
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin suspend: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	err = tx.QueryRow(ctx, `INSERT INTO suspended_subdomains (subdomain, user_id, reason, report_id, suspended_by)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (subdomain) DO UPDATE SET reason = EXCLUDED.reason, report_id = EXCLUDED.report_id,
+			suspended_by = EXCLUDED.suspended_by
+		RETURNING created_at`,
+		s.Subdomain, s.UserID, s.Reason, s.ReportID, s.SuspendedBy).Scan(&s.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("suspend subdomain: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE abuse_reports SET status = $2, resolved_by = $3, resolved_at = NOW()
+		WHERE subdomain = $1 AND status = $4`,
+		s.Subdomain, AbuseStatusSuspended, s.SuspendedBy, AbuseStatusOpen)
+	if err != nil {
+		return fmt.Errorf("resolve abuse reports: %w", err)
+	}
+
+	if s.UserID != nil {
+		_, err = tx.Exec(ctx, `UPDATE users SET abuse_flagged_at = COALESCE(abuse_flagged_at, NOW()) WHERE id = $1`, *s.UserID)
+		if err != nil {
+			return fmt.Errorf("flag user: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit suspend: %w", err)
+	}
+	return nil
+}
+
+// Unsuspend lifts the suspension of a subdomain. The owner stays flagged.
+func (r *AbuseRepository) Unsuspend(subdomain string) error {
+	ctx := context.Background()
+	tag, err := r.pool.Exec(ctx, `DELETE FROM suspended_subdomains WHERE subdomain = $1`, subdomain)
+	if err != nil {
+		return fmt.Errorf("unsuspend subdomain: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotSuspended
+	}
+	return nil
+}
+
+// ListSuspended returns all suspended subdomains, newest first.
+func (r *AbuseRepository) ListSuspended() ([]*SuspendedSubdomain, error) {
+	ctx := context.Background()
+	rows, err := r.pool.Query(ctx, `SELECT subdomain, user_id, reason, report_id, suspended_by, created_at
+		FROM suspended_subdomains ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("list suspended subdomains: %w", err)
+	}
+	defer rows.Close()
+
+	var out []*SuspendedSubdomain
+	for rows.Next() {
+		s := &SuspendedSubdomain{}
+		if err := rows.Scan(&s.Subdomain, &s.UserID, &s.Reason, &s.ReportID, &s.SuspendedBy, &s.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan suspended subdomain: %w", err)
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,165 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// CollectionRepository handles collections of saved requests using raw SQL.
+type CollectionRepository struct {
+	pool *pgxpool.Pool
+}
+
+// Create stores a new collection and fills in its ID and creation time.
+func (r *CollectionRepository) Create(c *Collection) error {
+	ctx := context.Background()
+	err := r.pool.QueryRow(ctx, `INSERT INTO collections (user_id, name) VALUES ($1, $2) RETURNING id, created_at`,
+		c.UserID, c.Name).Scan(&c.ID, &c.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrCollectionExists
+		}
+		return fmt.Errorf("create collection: %w", err)
+	}
+	return nil
+}
+
+// GetByID returns a collection by ID.
+func (r *CollectionRepository) GetByID(id int64) (*Collection, error) {
+	ctx := context.Background()
+	c := &Collection{}
+	err := r.pool.QueryRow(ctx, `SELECT c.id, c.user_id, c.name, c.created_at,
+			(SELECT COUNT(*) FROM collection_items i WHERE i.collection_id = c.id)
+		FROM collections c WHERE c.id = $1`, id).Scan(&c.ID, &c.UserID, &c.Name, &c.CreatedAt, &c.ItemCount)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrCollectionNotFound
+		}
+		return nil, fmt.Errorf("get collection: %w", err)
+	}
+	return c, nil
+}
+
+// ListByUser returns the user's collections by name.
+func (r *CollectionRepository) ListByUser(userID int64) ([]*Collection, error) {
+	ctx := context.Background()
+	rows, err := r.pool.Query(ctx, `SELECT c.id, c.user_id, c.name, c.created_at,
+			(SELECT COUNT(*) FROM collection_items i WHERE i.collection_id = c.id)
+		FROM collections c WHERE c.user_id = $1 ORDER BY c.name`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list collections: %w", err)
+	}
+	defer rows.Close()
+
+	var out []*Collection
+	for rows.Next() {
+		c := &Collection{}
+		if err := rows.Scan(&c.ID, &c.UserID, &c.Name, &c.CreatedAt, &c.ItemCount); err != nil {
+			return nil, fmt.Errorf("scan collection: %w", err)
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// Delete removes a collection with all its items.
+func (r *CollectionRepository) Delete(id int64) error {
+	ctx := context.Background()
+	tag, err := r.pool.Exec(ctx, `DELETE FROM collections WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("delete collection: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrCollectionNotFound
+	}
+	return nil
+}
+
+const collectionItemColumns = `id, collection_id, name, method, path, host, headers, body, source_exchange_id, created_at`
+
+func scanCollectionItem(row pgx.Row) (*CollectionItem, error) {
+	item := &CollectionItem{}
+	var headers []byte
+	err := row.Scan(&item.ID, &item.CollectionID, &item.Name, &item.Method, &item.Path, &item.Host,
+		&headers, &item.Body, &item.SourceExchangeID, &item.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(headers, &item.Headers); err != nil {
+		return nil, fmt.Errorf("decode headers: %w", err)
+	}
+	return item, nil
+}
+
+// CreateItem saves a request to a collection and fills in its ID and
+// creation time.
+func (r *CollectionRepository) CreateItem(item *CollectionItem) error {
+	ctx := context.Background()
+	headers, err := json.Marshal(item.Headers)
+	if err != nil {
+		return fmt.Errorf("encode headers: %w", err)
+	}
+	err = r.pool.QueryRow(ctx, `INSERT INTO collection_items
+			(collection_id, name, method, path, host, headers, body, source_exchange_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at`,
+		item.CollectionID, item.Name, item.Method, item.Path, item.Host, headers, item.Body, item.SourceExchangeID,
+	).Scan(&item.ID, &item.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("create collection item: %w", err)
+	}
+	return nil
+}
+
+// GetItem returns an item of a collection.
+func (r *CollectionRepository) GetItem(collectionID, id int64) (*CollectionItem, error) {
+	ctx := context.Background()
+	item, err := scanCollectionItem(r.pool.QueryRow(ctx, `SELECT `+collectionItemColumns+`
+		FROM collection_items WHERE collection_id = $1 AND id = $2`, collectionID, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrCollectionItemNotFound
+		}
+		return nil, fmt.Errorf("get collection item: %w", err)
+	}
+	return item, nil
+}
+
+// ListItems returns the items of a collection in the order they were saved.
+func (r *CollectionRepository) ListItems(collectionID int64) ([]*CollectionItem, error) {
+	ctx := context.Background()
+	rows, err := r.pool.Query(ctx, `SELECT `+collectionItemColumns+`
+		FROM collection_items WHERE collection_id = $1 ORDER BY id`, collectionID)
+	if err != nil {
+		return nil, fmt.Errorf("list collection items: %w", err)
+	}
+	defer rows.Close()
+
+	var out []*CollectionItem
+	for rows.Next() {
+		item, err := scanCollectionItem(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan collection item: %w", err)
+		}
+		out = append(out, item)
+	}
+	return out, rows.Err()
+}
+
+// DeleteItem removes an item from a collection.
+func (r *CollectionRepository) DeleteItem(collectionID, id int64) error {
+	ctx := context.Background()
+	tag, err := r.pool.Exec(ctx, `DELETE FROM collection_items WHERE collection_id = $1 AND id = $2`, collectionID, id)
+	if err != nil {
+		return fmt.Errorf("delete collection item: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrCollectionItemNotFound
+	}
+	return nil
+}
@@ -4,12 +4,15 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/jackc/pgx/v5/pgxpool"
+
 	"github.com/mephistofox/fxtun.dev/internal/server/database/sqlc"
 )
 
 // DomainRepository handles reserved domain database operations using PostgreSQL via sqlc.
 type DomainRepository struct {
-	q *sqlc.Queries
+	q    *sqlc.Queries
+	pool *pgxpool.Pool
 }
 
 // sqlcDomainToDomain converts a sqlc.ReservedDomain to a domain ReservedDomain.
@@ -19,6 +22,7 @@ func sqlcDomainToDomain(d sqlc.ReservedDomain) *ReservedDomain {
 		UserID:    d.UserID,
 		Subdomain: d.Subdomain,
 		CreatedAt: tsToTime(d.CreatedAt),
+		ExpiresAt: tsToTimePtr(d.ExpiresAt),
 	}
 }
 
@@ -28,6 +32,7 @@ func (r *DomainRepository) Create(domain *ReservedDomain) error {
 	row, err := r.q.CreateReservedDomain(ctx, sqlc.CreateReservedDomainParams{
 		UserID:    domain.UserID,
 		Subdomain: domain.Subdomain,
+		ExpiresAt: timePtrToPgtz(domain.ExpiresAt),
 	})
 	if err != nil {
 		if isUniqueViolation(err) {
@@ -40,6 +45,45 @@ func (r *DomainRepository) Create(domain *ReservedDomain) error {
 	return nil
 }
 
+// CreateWithinLimit creates a new reserved domain unless the user already
+// holds maxDomains of them (negative means no limit). The insert runs in a
+// transaction holding the owner's user row, so parallel requests for one
+// user take turns and cannot overshoot the limit.
+func (r *DomainRepository) CreateWithinLimit(domain *ReservedDomain, maxDomains int) error {
+	ctx := context.Background()
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin reserve domain: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	q := r.q.WithTx(tx)
+	if err := q.LockReservedDomainOwner(ctx, domain.UserID); err != nil {
+		return fmt.Errorf("lock domain owner: %w", err)
+	}
+	row, err := q.CreateReservedDomainWithinLimit(ctx, sqlc.CreateReservedDomainWithinLimitParams{
+		UserID:     domain.UserID,
+		Subdomain:  domain.Subdomain,
+		ExpiresAt:  timePtrToPgtz(domain.ExpiresAt),
+		MaxDomains: int32(maxDomains),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return ErrMaxDomainsReached
+		}
+		if isUniqueViolation(err) {
+			return ErrDomainAlreadyExists
+		}
+		return fmt.Errorf("create reserved domain: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit reserve domain: %w", err)
+	}
+	domain.ID = row.ID
+	domain.CreatedAt = tsToTime(row.CreatedAt)
+	return nil
+}
+
 // GetByID retrieves a reserved domain by ID.
 func (r *DomainRepository) GetByID(id int64) (*ReservedDomain, error) {
 	ctx := context.Background()
@@ -100,6 +144,21 @@ func (r *DomainRepository) DeleteByUserID(userID int64) error {
 	return nil
 }
 
+// DeleteExpired deletes the reservations whose expiry has passed and returns
+// them.
+func (r *DomainRepository) DeleteExpired() ([]*ReservedDomain, error) {
+	ctx := context.Background()
+	rows, err := r.q.DeleteExpiredReservedDomains(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("delete expired reserved domains: %w", err)
+	}
+	domains := make([]*ReservedDomain, 0, len(rows))
+	for _, d := range rows {
+		domains = append(domains, sqlcDomainToDomain(d))
+	}
+	return domains, nil
+}
+
 // Count returns the number of reserved domains for a user.
 func (r *DomainRepository) Count(userID int64) (int, error) {
 	ctx := context.Background()
@@ -110,6 +169,21 @@ func (r *DomainRepository) Count(userID int64) (int, error) {
 	return int(count), nil
 }
 
+// ListActive returns every reservation that has not expired. Expired ones
+// count as free even before the scheduler deletes them.
+func (r *DomainRepository) ListActive() ([]*ReservedDomain, error) {
+	ctx := context.Background()
+	rows, err := r.q.ListActiveReservedDomains(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list active reserved domains: %w", err)
+	}
+	domains := make([]*ReservedDomain, 0, len(rows))
+	for _, d := range rows {
+		domains = append(domains, sqlcDomainToDomain(d))
+	}
+	return domains, nil
+}
+
 // IsAvailable checks if a subdomain is available (not reserved).
 func (r *DomainRepository) IsAvailable(subdomain string) (bool, error) {
 	ctx := context.Background()
@@ -87,6 +87,27 @@ func (r *ExchangeRepository) GetByID(id string) (*inspect.CapturedExchange, erro
 	), nil
 }
 
+// GetByIDAndUser retrieves a single exchange by ID if it was captured on a
+// tunnel of the user. Returns nil, nil if there is no such exchange.
+func (r *ExchangeRepository) GetByIDAndUser(id string, userID int64) (*inspect.CapturedExchange, error) {
+	ctx := context.Background()
+	row, err := r.q.GetExchangeByIDAndUser(ctx, sqlc.GetExchangeByIDAndUserParams{ID: id, UserID: userID})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get inspect exchange: %w", err)
+	}
+	return exchangeRowToDomain(
+		row.ID, row.TunnelID, row.TraceID, row.ReplayRef,
+		row.Timestamp, row.DurationNs,
+		row.Method, row.Path, row.Host,
+		row.RequestHeaders, row.RequestBody, int64(row.RequestBodySize),
+		row.ResponseHeaders, row.ResponseBody, int64(row.ResponseBodySize),
+		row.StatusCode, row.RemoteAddr,
+	), nil
+}
+
 // ListByTunnelID returns exchanges for a tunnel, newest first, with pagination.
 func (r *ExchangeRepository) ListByTunnelID(tunnelID string, offset, limit int) ([]*inspect.CapturedExchange, int, error) {
 	ctx := context.Background()
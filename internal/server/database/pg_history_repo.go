@@ -27,13 +27,17 @@ func sqlcHistoryToDomain(h sqlc.UserHistory) *UserHistoryEntry {
 		DisconnectedAt: tsToTimePtr(h.DisconnectedAt),
 		BytesSent:      h.BytesSent,
 		BytesReceived:  h.BytesReceived,
+		Event:          h.Event,
+		Details:        textToString(h.Details),
 	}
 }
 
-// Create creates a new history entry.
-func (r *UserHistoryRepository) Create(entry *UserHistoryEntry) error {
-	ctx := context.Background()
-	id, err := r.q.CreateHistoryEntry(ctx, sqlc.CreateHistoryEntryParams{
+// historyEntryParams builds insert params, defaulting the event to a session.
+func historyEntryParams(entry *UserHistoryEntry) sqlc.CreateHistoryEntryParams {
+	if entry.Event == "" {
+		entry.Event = HistoryEventSession
+	}
+	return sqlc.CreateHistoryEntryParams{
 		UserID:         entry.UserID,
 		BundleName:     stringToPgtext(entry.BundleName),
 		TunnelType:     entry.TunnelType,
@@ -44,7 +48,15 @@ func (r *UserHistoryRepository) Create(entry *UserHistoryEntry) error {
 		DisconnectedAt: timePtrToPgtz(entry.DisconnectedAt),
 		BytesSent:      entry.BytesSent,
 		BytesReceived:  entry.BytesReceived,
-	})
+		Event:          entry.Event,
+		Details:        stringToPgtext(entry.Details),
+	}
+}
+
+// Create creates a new history entry.
+func (r *UserHistoryRepository) Create(entry *UserHistoryEntry) error {
+	ctx := context.Background()
+	id, err := r.q.CreateHistoryEntry(ctx, historyEntryParams(entry))
 	if err != nil {
 		return fmt.Errorf("create history entry: %w", err)
 	}
@@ -118,18 +130,7 @@ func (r *UserHistoryRepository) AddBulk(userID int64, entries []*UserHistoryEntr
 	ctx := context.Background()
 	for _, entry := range entries {
 		entry.UserID = userID
-		id, err := r.q.CreateHistoryEntry(ctx, sqlc.CreateHistoryEntryParams{
-			UserID:         entry.UserID,
-			BundleName:     stringToPgtext(entry.BundleName),
-			TunnelType:     entry.TunnelType,
-			LocalPort:      int32(entry.LocalPort),
-			RemoteAddr:     stringToPgtext(entry.RemoteAddr),
-			Url:            stringToPgtext(entry.URL),
-			ConnectedAt:    timeToPgtz(entry.ConnectedAt),
-			DisconnectedAt: timePtrToPgtz(entry.DisconnectedAt),
-			BytesSent:      entry.BytesSent,
-			BytesReceived:  entry.BytesReceived,
-		})
+		id, err := r.q.CreateHistoryEntry(ctx, historyEntryParams(entry))
 		if err != nil {
 			return fmt.Errorf("insert history entry: %w", err)
 		}
@@ -138,7 +139,7 @@ func (r *UserHistoryRepository) AddBulk(userID int64, entries []*UserHistoryEntr
 	return nil
 }
 
-// Clear deletes all history entries for a user.
+// Clear deletes all history entries and daily totals for a user.
 func (r *UserHistoryRepository) Clear(userID int64) error {
 	ctx := context.Background()
 	err := r.q.ClearHistory(ctx, userID)
@@ -167,20 +168,27 @@ func (r *UserHistoryRepository) GetStats(userID int64) (*HistoryStats, error) {
 	}
 
 	stats := &HistoryStats{
-		TotalConnections: int(row.TotalConnections),
-	}
-
-	// TotalBytesSent and TotalBytesReceived come as interface{} from COALESCE(SUM(...))
-	if v, ok := row.TotalBytesSent.(int64); ok {
-		stats.TotalBytesSent = v
-	}
-	if v, ok := row.TotalBytesReceived.(int64); ok {
-		stats.TotalBytesReceived = v
+		TotalConnections:   int(row.TotalConnections),
+		TotalBytesSent:     row.TotalBytesSent,
+		TotalBytesReceived: row.TotalBytesReceived,
 	}
 
 	return stats, nil
 }
 
+// RecordEvent stores a point-in-time history event for a user.
+func (r *UserHistoryRepository) RecordEvent(userID int64, event, tunnelType string, localPort int, url, details string) error {
+	return r.Create(&UserHistoryEntry{
+		UserID:      userID,
+		TunnelType:  tunnelType,
+		LocalPort:   localPort,
+		URL:         url,
+		ConnectedAt: time.Now(),
+		Event:       event,
+		Details:     details,
+	})
+}
+
 // DeleteOlderThan deletes history entries older than the given time.
 func (r *UserHistoryRepository) DeleteOlderThan(userID int64, before time.Time) (int64, error) {
 	ctx := context.Background()
@@ -193,3 +201,33 @@ func (r *UserHistoryRepository) DeleteOlderThan(userID int64, before time.Time)
 	}
 	return count, nil
 }
+
+// PruneBefore deletes up to batchSize history entries older than the given
+// time across all users, folding them into the daily totals. It returns the
+// number of entries removed.
+func (r *UserHistoryRepository) PruneBefore(before time.Time, batchSize int) (int64, error) {
+	ctx := context.Background()
+	count, err := r.q.PruneHistoryBefore(ctx, sqlc.PruneHistoryBeforeParams{
+		Before:    timeToPgtz(before),
+		BatchSize: int32(batchSize),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("prune history before: %w", err)
+	}
+	return count, nil
+}
+
+// PruneExcess deletes up to batchSize history entries beyond the newest
+// maxEntries of each user, folding them into the daily totals. It returns the
+// number of entries removed.
+func (r *UserHistoryRepository) PruneExcess(maxEntries, batchSize int) (int64, error) {
+	ctx := context.Background()
+	count, err := r.q.PruneHistoryExcess(ctx, sqlc.PruneHistoryExcessParams{
+		MaxEntries: int64(maxEntries),
+		BatchSize:  int32(batchSize),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("prune excess history: %w", err)
+	}
+	return count, nil
+}
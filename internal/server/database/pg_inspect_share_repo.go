@@ -0,0 +1,92 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// InspectShareRepository handles inspector share links using raw SQL.
+type InspectShareRepository struct {
+	pool *pgxpool.Pool
+}
+
+// Create stores a new share link and fills in its ID and creation time.
+func (r *InspectShareRepository) Create(s *InspectShare) error {
+	ctx := context.Background()
+	err := r.pool.QueryRow(ctx, `INSERT INTO inspect_shares (user_id, subdomain, expires_at) VALUES ($1, $2, $3)
+		RETURNING id, created_at`, s.UserID, s.Subdomain, s.ExpiresAt).Scan(&s.ID, &s.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("create inspect share: %w", err)
+	}
+	return nil
+}
+
+// GetByID returns a share link by ID, revoked or not.
+func (r *InspectShareRepository) GetByID(id int64) (*InspectShare, error) {
+	ctx := context.Background()
+	s := &InspectShare{}
+	err := r.pool.QueryRow(ctx, `SELECT id, user_id, subdomain, expires_at, revoked_at, created_at
+		FROM inspect_shares WHERE id = $1`, id).
+		Scan(&s.ID, &s.UserID, &s.Subdomain, &s.ExpiresAt, &s.RevokedAt, &s.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrInspectShareNotFound
+		}
+		return nil, fmt.Errorf("get inspect share: %w", err)
+	}
+	return s, nil
+}
+
+// ListActiveByUser returns the user's share links that are neither revoked
+// nor expired, newest first.
+func (r *InspectShareRepository) ListActiveByUser(userID int64) ([]*InspectShare, error) {
+	ctx := context.Background()
+	rows, err := r.pool.Query(ctx, `SELECT id, user_id, subdomain, expires_at, revoked_at, created_at
+		FROM inspect_shares WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list inspect shares: %w", err)
+	}
+	defer rows.Close()
+
+	var out []*InspectShare
+	for rows.Next() {
+		s := &InspectShare{}
+		if err := rows.Scan(&s.ID, &s.UserID, &s.Subdomain, &s.ExpiresAt, &s.RevokedAt, &s.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan inspect share: %w", err)
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// Revoke ends a share link of the user before it expires. It returns
+// ErrInspectShareNotFound when the user has no such link still in force.
+func (r *InspectShareRepository) Revoke(id, userID int64) error {
+	ctx := context.Background()
+	tag, err := r.pool.Exec(ctx, `UPDATE inspect_shares SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > NOW()`, id, userID)
+	if err != nil {
+		return fmt.Errorf("revoke inspect share: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrInspectShareNotFound
+	}
+	return nil
+}
+
+// DeleteExpiredBefore removes share links that expired before the given
+// time, revoked or not. Their tokens no longer validate by then.
+func (r *InspectShareRepository) DeleteExpiredBefore(before time.Time) (int64, error) {
+	ctx := context.Background()
+	tag, err := r.pool.Exec(ctx, `DELETE FROM inspect_shares WHERE expires_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("delete expired inspect shares: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
@@ -209,3 +209,42 @@ func (r *PaymentRepository) PaymentsByDay(days int) ([]DailyStat, error) {
 	}
 	return results, rows.Err()
 }
+
+// webhookClaimTimeout is how long a claimed webhook event may stay
+// unanswered before a retry may process it again.
+const webhookClaimTimeout = 5 * time.Minute
+
+// ClaimWebhook records a webhook delivery of a provider event and reports
+// whether the caller should process it. It returns false for a duplicate:
+// an event that is being processed or was answered without a server error.
+// An event that failed with a 5xx, or whose claim is older than
+// webhookClaimTimeout without an answer, is claimed again, so provider
+// retries still go through.
+func (r *PaymentRepository) ClaimWebhook(provider, eventID, event string) (bool, error) {
+	ctx := context.Background()
+	query := `INSERT INTO processed_webhooks (provider, event_id, event)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (provider, event_id) DO UPDATE
+		SET status = 0, attempts = processed_webhooks.attempts + 1, claimed_at = NOW(), processed_at = NULL
+		WHERE processed_webhooks.status >= 500
+			OR (processed_webhooks.status = 0 AND processed_webhooks.claimed_at < NOW() - make_interval(secs := $4))`
+
+	tag, err := r.pool.Exec(ctx, query, provider, eventID, event, webhookClaimTimeout.Seconds())
+	if err != nil {
+		return false, fmt.Errorf("claim webhook: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// FinishWebhook records the HTTP status a claimed webhook event was
+// answered with.
+func (r *PaymentRepository) FinishWebhook(provider, eventID string, status int) error {
+	ctx := context.Background()
+	query := `UPDATE processed_webhooks SET status = $3, processed_at = NOW()
+		WHERE provider = $1 AND event_id = $2`
+
+	if _, err := r.pool.Exec(ctx, query, provider, eventID, status); err != nil {
+		return fmt.Errorf("finish webhook: %w", err)
+	}
+	return nil
+}
@@ -34,6 +34,9 @@ func sqlcPlanToDomain(p sqlc.Plan) *Plan {
 		CreemProductID:     p.CreemProductID,
 		MaxDataSessions:    int(p.MaxDataSessions),
 		UDPEnabled:         p.UdpEnabled,
+		MonthlyBytes:       p.MonthlyBytes,
+		InspectMaxEntries:  int(p.InspectMaxEntries),
+		SOCKSEnabled:       p.SocksEnabled,
 	}
 }
 
@@ -98,6 +101,9 @@ func (r *PlanRepository) Create(plan *Plan) error {
 		CreemProductID:     plan.CreemProductID,
 		MaxDataSessions:    int32(plan.MaxDataSessions),
 		UdpEnabled:         plan.UDPEnabled,
+		MonthlyBytes:       plan.MonthlyBytes,
+		InspectMaxEntries:  int32(plan.InspectMaxEntries),
+		SocksEnabled:       plan.SOCKSEnabled,
 	})
 	if err != nil {
 		return fmt.Errorf("create plan: %w", err)
@@ -128,6 +134,9 @@ func (r *PlanRepository) Update(plan *Plan) error {
 		CreemProductID:     plan.CreemProductID,
 		MaxDataSessions:    int32(plan.MaxDataSessions),
 		UdpEnabled:         plan.UDPEnabled,
+		MonthlyBytes:       plan.MonthlyBytes,
+		InspectMaxEntries:  int32(plan.InspectMaxEntries),
+		SocksEnabled:       plan.SOCKSEnabled,
 	})
 	if err != nil {
 		return fmt.Errorf("update plan: %w", err)
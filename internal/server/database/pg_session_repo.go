@@ -3,6 +3,7 @@ package database
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/mephistofox/fxtun.dev/internal/server/database/sqlc"
 )
@@ -22,6 +23,7 @@ func sqlcSessionToDomain(s sqlc.Session) *Session {
 		IPAddress:        textToString(s.IpAddress),
 		ExpiresAt:        tsToTime(s.ExpiresAt),
 		CreatedAt:        tsToTime(s.CreatedAt),
+		FamilyID:         s.FamilyID,
 	}
 }
 
@@ -34,6 +36,7 @@ func (r *SessionRepository) Create(session *Session) error {
 		UserAgent:        stringToPgtext(session.UserAgent),
 		IpAddress:        stringToPgtext(session.IPAddress),
 		ExpiresAt:        timeToPgtz(session.ExpiresAt),
+		FamilyID:         session.FamilyID,
 	})
 	if err != nil {
 		return fmt.Errorf("create session: %w", err)
@@ -100,6 +103,19 @@ func (r *SessionRepository) DeleteByUserID(userID int64) error {
 	return nil
 }
 
+// DeleteByFamily deletes the active sessions of one session family.
+func (r *SessionRepository) DeleteByFamily(userID int64, familyID string) error {
+	ctx := context.Background()
+	err := r.q.DeleteSessionsByFamily(ctx, sqlc.DeleteSessionsByFamilyParams{
+		UserID:   userID,
+		FamilyID: familyID,
+	})
+	if err != nil {
+		return fmt.Errorf("delete sessions by family: %w", err)
+	}
+	return nil
+}
+
 // DeleteExpired deletes all expired sessions.
 func (r *SessionRepository) DeleteExpired() (int64, error) {
 	ctx := context.Background()
@@ -109,3 +125,36 @@ func (r *SessionRepository) DeleteExpired() (int64, error) {
 	}
 	return count, nil
 }
+
+// MarkRotated keeps a rotated refresh token as a session row that no longer
+// authenticates, so presenting it again is detected as reuse. The row is
+// removed by DeleteExpired once ttl has passed.
+func (r *SessionRepository) MarkRotated(tokenHash string, userID int64, familyID string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+	ctx := context.Background()
+	err := r.q.CreateRotatedSession(ctx, sqlc.CreateRotatedSessionParams{
+		UserID:           userID,
+		RefreshTokenHash: tokenHash,
+		FamilyID:         familyID,
+		ExpiresAt:        timeToPgtz(time.Now().Add(ttl)),
+	})
+	if err != nil {
+		return fmt.Errorf("mark session rotated: %w", err)
+	}
+	return nil
+}
+
+// RotatedOwner returns the user and session family a rotated token belonged to.
+func (r *SessionRepository) RotatedOwner(tokenHash string) (int64, string, bool, error) {
+	ctx := context.Background()
+	row, err := r.q.GetRotatedSessionByTokenHash(ctx, tokenHash)
+	if err != nil {
+		if isNotFound(err) {
+			return 0, "", false, nil
+		}
+		return 0, "", false, fmt.Errorf("get rotated session: %w", err)
+	}
+	return row.UserID, row.FamilyID, true, nil
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mephistofox/fxtun.dev/internal/server/database/sqlc"
+)
+
+// UsageRepository handles monthly traffic accounting using PostgreSQL via sqlc.
+type UsageRepository struct {
+	q *sqlc.Queries
+}
+
+// Add adds traffic to a user's total for the month containing period and
+// returns the new total.
+func (r *UsageRepository) Add(userID int64, period time.Time, bytesIn, bytesOut int64) (*MonthlyUsage, error) {
+	ctx := context.Background()
+	u, err := r.q.AddMonthlyUsage(ctx, sqlc.AddMonthlyUsageParams{
+		UserID:   userID,
+		Period:   timeToPgdate(UsagePeriod(period)),
+		BytesIn:  bytesIn,
+		BytesOut: bytesOut,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("add monthly usage: %w", err)
+	}
+	return &MonthlyUsage{
+		UserID:   u.UserID,
+		Period:   dateToTime(u.Period),
+		BytesIn:  u.BytesIn,
+		BytesOut: u.BytesOut,
+	}, nil
+}
+
+// Get returns a user's traffic for the month containing period. A month
+// without recorded traffic yields zero totals rather than an error.
+func (r *UsageRepository) Get(userID int64, period time.Time) (*MonthlyUsage, error) {
+	ctx := context.Background()
+	month := UsagePeriod(period)
+	u, err := r.q.GetMonthlyUsage(ctx, sqlc.GetMonthlyUsageParams{
+		UserID: userID,
+		Period: timeToPgdate(month),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return &MonthlyUsage{UserID: userID, Period: month}, nil
+		}
+		return nil, fmt.Errorf("get monthly usage: %w", err)
+	}
+	return &MonthlyUsage{
+		UserID:   u.UserID,
+		Period:   dateToTime(u.Period),
+		BytesIn:  u.BytesIn,
+		BytesOut: u.BytesOut,
+	}, nil
+}
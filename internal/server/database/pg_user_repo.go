@@ -32,7 +32,9 @@ func sqlcUserToDomain(u sqlc.User) *User {
 		LastLoginAt:   tsToTimePtr(u.LastLoginAt),
 		GitHubID:      int8ToInt64Ptr(u.GithubID),
 		GoogleID:      textToStringPtr(u.GoogleID),
+		GitLabID:      int8ToInt64Ptr(u.GitlabID),
 		Email:         textToString(u.Email),
+		EmailVerified: u.EmailVerified,
 		AvatarURL:     textToString(u.AvatarUrl),
 		PlanID:        int8ToInt64(u.PlanID),
 		FirstTunnelAt: tsToTimePtr(u.FirstTunnelAt),
@@ -135,6 +137,19 @@ func (r *UserRepository) GetByGitHubID(githubID int64) (*User, error) {
 	return sqlcUserToDomain(u), nil
 }
 
+// GetByGitLabID retrieves a user by GitLab ID.
+func (r *UserRepository) GetByGitLabID(gitlabID int64) (*User, error) {
+	ctx := context.Background()
+	u, err := r.q.GetUserByGitLabID(ctx, int64ToPgint8(gitlabID))
+	if err != nil {
+		if isNotFound(err) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("get user by gitlab id: %w", err)
+	}
+	return sqlcUserToDomain(u), nil
+}
+
 // GetByGoogleID retrieves a user by Google ID.
 func (r *UserRepository) GetByGoogleID(googleID string) (*User, error) {
 	ctx := context.Background()
@@ -195,7 +210,7 @@ func (r *UserRepository) UpdatePassword(userID int64, passwordHash string) error
 	return nil
 }
 
-// UpdateEmail updates user's email.
+// UpdateEmail updates user's email. The new address is unverified.
 func (r *UserRepository) UpdateEmail(userID int64, email string) error {
 	ctx := context.Background()
 	err := r.q.UpdateUserEmail(ctx, sqlc.UpdateUserEmailParams{
@@ -208,6 +223,38 @@ func (r *UserRepository) UpdateEmail(userID int64, email string) error {
 	return nil
 }
 
+// MarkEmailVerified records that the user's email is verified, if it is
+// still email. It reports whether the user was updated.
+func (r *UserRepository) MarkEmailVerified(userID int64, email string) (bool, error) {
+	ctx := context.Background()
+	rows, err := r.q.SetUserEmailVerified(ctx, sqlc.SetUserEmailVerifiedParams{
+		ID:    userID,
+		Lower: email,
+	})
+	if err != nil {
+		return false, fmt.Errorf("mark email verified: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// VerifyEmail makes email the user's address, verified, once the user
+// proved to receive mail there. It reports whether the user was updated
+// and returns ErrUserAlreadyExists when another user has the address.
+func (r *UserRepository) VerifyEmail(userID int64, email string) (bool, error) {
+	ctx := context.Background()
+	rows, err := r.q.VerifyUserEmail(ctx, sqlc.VerifyUserEmailParams{
+		ID:    userID,
+		Email: stringToPgtext(email),
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			return false, ErrUserAlreadyExists
+		}
+		return false, fmt.Errorf("verify email: %w", err)
+	}
+	return rows > 0, nil
+}
+
 // UpdatePhone updates a user's phone field.
 func (r *UserRepository) UpdatePhone(userID int64, phone string) error {
 	ctx := context.Background()
@@ -280,6 +327,24 @@ func (r *UserRepository) LinkGoogle(userID int64, googleID, email, avatarURL str
 	return nil
 }
 
+// LinkGitLab links a GitLab account to an existing user.
+func (r *UserRepository) LinkGitLab(userID, gitlabID int64, email, avatarURL string) error {
+	ctx := context.Background()
+	err := r.q.LinkGitLab(ctx, sqlc.LinkGitLabParams{
+		ID:        userID,
+		GitlabID:  int64ToPgint8(gitlabID),
+		Email:     stringToPgtext(email),
+		AvatarUrl: stringToPgtext(avatarURL),
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("gitlab account already linked to another user")
+		}
+		return fmt.Errorf("link gitlab: %w", err)
+	}
+	return nil
+}
+
 // CreateOAuth creates a new user via OAuth (no phone/password required).
 func (r *UserRepository) CreateOAuth(user *User) error {
 	ctx := context.Background()
@@ -290,6 +355,7 @@ func (r *UserRepository) CreateOAuth(user *User) error {
 		IsActive:    user.IsActive,
 		GithubID:    int64PtrToPgint8(user.GitHubID),
 		GoogleID:    stringPtrToPgtext(user.GoogleID),
+		GitlabID:    int64PtrToPgint8(user.GitLabID),
 		Email:       stringToPgtext(user.Email),
 		AvatarUrl:   stringToPgtext(user.AvatarURL),
 		PlanID:      int64ToPgint8(user.PlanID),
@@ -454,7 +520,7 @@ func (r *UserRepository) listWithSort(ctx context.Context, params UserListParams
 
 	//nolint:gosec // sortCol is from allowedSortColumns whitelist, order is hardcoded ASC/DESC
 	query := fmt.Sprintf(`SELECT id, phone, password_hash, display_name, is_admin, is_active,
-		created_at, last_login_at, github_id, google_id, email, avatar_url, plan_id, first_tunnel_at
+		created_at, last_login_at, github_id, google_id, email, avatar_url, plan_id, first_tunnel_at, gitlab_id, email_verified
 		FROM users
 		WHERE ($1::boolean IS NULL OR is_active = $1)
 		  AND ($2::boolean IS NULL OR is_admin = $2)
@@ -475,7 +541,7 @@ func (r *UserRepository) listWithSort(ctx context.Context, params UserListParams
 			&u.ID, &u.Phone, &u.PasswordHash, &u.DisplayName,
 			&u.IsAdmin, &u.IsActive, &u.CreatedAt, &u.LastLoginAt,
 			&u.GithubID, &u.GoogleID, &u.Email, &u.AvatarUrl,
-			&u.PlanID, &u.FirstTunnelAt,
+			&u.PlanID, &u.FirstTunnelAt, &u.GitlabID, &u.EmailVerified,
 		); err != nil {
 			return nil, 0, fmt.Errorf("scan sorted user: %w", err)
 		}
@@ -574,15 +640,30 @@ func (r *UserRepository) MergeUsers(primaryID, secondaryID int64) error {
 		return fmt.Errorf("cleanup user_settings: %w", err)
 	}
 
-	// Copy OAuth fields from secondary to primary if primary's are empty
+	// Copy OAuth fields from secondary to primary if primary's are empty.
+	// Provider IDs are unique, so they are taken off the secondary user
+	// before being set on the primary.
+	var githubID, gitlabID pgtype.Int8
+	var googleID pgtype.Text
+	err = tx.QueryRow(ctx, `SELECT github_id, google_id, gitlab_id FROM users WHERE id = $1`, secondaryID).
+		Scan(&githubID, &googleID, &gitlabID)
+	if err != nil {
+		return fmt.Errorf("get secondary oauth fields: %w", err)
+	}
+	_, err = tx.Exec(ctx, `UPDATE users SET github_id = NULL, google_id = NULL, gitlab_id = NULL WHERE id = $1`, secondaryID)
+	if err != nil {
+		return fmt.Errorf("unlink secondary oauth accounts: %w", err)
+	}
 	_, err = tx.Exec(ctx, `
 		UPDATE users SET
-			github_id = COALESCE(github_id, (SELECT github_id FROM users WHERE id = $1)),
-			google_id = COALESCE(google_id, (SELECT google_id FROM users WHERE id = $1)),
+			github_id = COALESCE(github_id, $3),
+			google_id = COALESCE(google_id, $4),
+			gitlab_id = COALESCE(gitlab_id, $5),
 			email = CASE WHEN email = '' OR email IS NULL THEN (SELECT email FROM users WHERE id = $1) ELSE email END,
+			email_verified = CASE WHEN email = '' OR email IS NULL THEN (SELECT email_verified FROM users WHERE id = $1) ELSE email_verified END,
 			avatar_url = CASE WHEN avatar_url = '' OR avatar_url IS NULL THEN (SELECT avatar_url FROM users WHERE id = $1) ELSE avatar_url END
 		WHERE id = $2
-	`, secondaryID, primaryID)
+	`, secondaryID, primaryID, githubID, googleID, gitlabID)
 	if err != nil {
 		return fmt.Errorf("merge oauth fields: %w", err)
 	}
@@ -61,6 +61,13 @@ func int4ToInt(i pgtype.Int4) int {
 	return 0
 }
 
+func dateToTime(d pgtype.Date) time.Time {
+	if d.Valid {
+		return d.Time
+	}
+	return time.Time{}
+}
+
 // Go → pgtype conversions
 
 func timeToPgtz(t time.Time) pgtype.Timestamptz {
@@ -77,6 +84,13 @@ func timePtrToPgtz(t *time.Time) pgtype.Timestamptz {
 	return pgtype.Timestamptz{Time: *t, Valid: true}
 }
 
+func timeToPgdate(t time.Time) pgtype.Date {
+	if t.IsZero() {
+		return pgtype.Date{}
+	}
+	return pgtype.Date{Time: t, Valid: true}
+}
+
 func stringToPgtext(s string) pgtype.Text {
 	if s == "" {
 		return pgtype.Text{}
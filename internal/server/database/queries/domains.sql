@@ -1,16 +1,30 @@
 -- name: CreateReservedDomain :one
-INSERT INTO reserved_domains (user_id, subdomain, created_at)
-VALUES ($1, $2, NOW())
+INSERT INTO reserved_domains (user_id, subdomain, created_at, expires_at)
+VALUES ($1, $2, NOW(), $3)
 RETURNING id, created_at;
 
+-- name: CreateReservedDomainWithinLimit :one
+INSERT INTO reserved_domains (user_id, subdomain, created_at, expires_at)
+SELECT sqlc.arg('user_id')::bigint, sqlc.arg('subdomain')::text, NOW(), sqlc.arg('expires_at')::timestamptz
+WHERE sqlc.arg('max_domains')::int < 0
+   OR (SELECT COUNT(*) FROM reserved_domains d WHERE d.user_id = sqlc.arg('user_id')::bigint) < sqlc.arg('max_domains')::int
+RETURNING id, created_at;
+
+-- name: LockReservedDomainOwner :exec
+SELECT id FROM users WHERE id = $1 FOR NO KEY UPDATE;
+
 -- name: GetReservedDomainByID :one
-SELECT id, user_id, subdomain, created_at FROM reserved_domains WHERE id = $1;
+SELECT id, user_id, subdomain, created_at, expires_at FROM reserved_domains WHERE id = $1;
 
 -- name: GetReservedDomainBySubdomain :one
-SELECT id, user_id, subdomain, created_at FROM reserved_domains WHERE subdomain = $1;
+SELECT id, user_id, subdomain, created_at, expires_at FROM reserved_domains WHERE subdomain = $1;
 
 -- name: ListReservedDomainsByUserID :many
-SELECT id, user_id, subdomain, created_at FROM reserved_domains WHERE user_id = $1 ORDER BY created_at DESC;
+SELECT id, user_id, subdomain, created_at, expires_at FROM reserved_domains WHERE user_id = $1 ORDER BY created_at DESC;
+
+-- name: ListActiveReservedDomains :many
+SELECT id, user_id, subdomain, created_at, expires_at FROM reserved_domains
+WHERE expires_at IS NULL OR expires_at > NOW();
 
 -- name: DeleteReservedDomain :exec
 DELETE FROM reserved_domains WHERE id = $1;
@@ -18,6 +32,10 @@ DELETE FROM reserved_domains WHERE id = $1;
 -- name: DeleteReservedDomainsByUserID :exec
 DELETE FROM reserved_domains WHERE user_id = $1;
 
+-- name: DeleteExpiredReservedDomains :many
+DELETE FROM reserved_domains WHERE expires_at IS NOT NULL AND expires_at <= NOW()
+RETURNING id, user_id, subdomain, created_at, expires_at;
+
 -- name: CountReservedDomainsByUserID :one
 SELECT COUNT(*) FROM reserved_domains WHERE user_id = $1;
 
@@ -6,6 +6,10 @@ VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $
 SELECT id, tunnel_id, trace_id, replay_ref, timestamp, duration_ns, method, path, host, request_headers, request_body, request_body_size, response_headers, response_body, response_body_size, status_code, remote_addr
 FROM inspect_exchanges WHERE id = $1;
 
+-- name: GetExchangeByIDAndUser :one
+SELECT id, tunnel_id, trace_id, replay_ref, timestamp, duration_ns, method, path, host, request_headers, request_body, request_body_size, response_headers, response_body, response_body_size, status_code, remote_addr
+FROM inspect_exchanges WHERE id = $1 AND user_id = $2;
+
 -- name: ListExchangesByTunnelID :many
 SELECT id, tunnel_id, trace_id, replay_ref, timestamp, duration_ns, method, path, host, request_headers, request_body, request_body_size, response_headers, response_body, response_body_size, status_code, remote_addr
 FROM inspect_exchanges WHERE tunnel_id = $1 ORDER BY timestamp DESC LIMIT $2 OFFSET $3;
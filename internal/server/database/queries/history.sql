@@ -1,6 +1,6 @@
 -- name: CreateHistoryEntry :one
-INSERT INTO user_history (user_id, bundle_name, tunnel_type, local_port, remote_addr, url, connected_at, disconnected_at, bytes_sent, bytes_received)
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+INSERT INTO user_history (user_id, bundle_name, tunnel_type, local_port, remote_addr, url, connected_at, disconnected_at, bytes_sent, bytes_received, event, details)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 RETURNING id;
 
 -- name: UpdateHistoryEntry :exec
@@ -8,14 +8,17 @@ UPDATE user_history SET disconnected_at = $3, bytes_sent = $4, bytes_received =
 WHERE id = $1 AND user_id = $2;
 
 -- name: GetHistoryEntryByID :one
-SELECT id, user_id, bundle_name, tunnel_type, local_port, remote_addr, url, connected_at, disconnected_at, bytes_sent, bytes_received
+SELECT id, user_id, bundle_name, tunnel_type, local_port, remote_addr, url, connected_at, disconnected_at, bytes_sent, bytes_received, event, details
 FROM user_history WHERE id = $1 AND user_id = $2;
 
 -- name: ListHistoryByUserID :many
-SELECT id, user_id, bundle_name, tunnel_type, local_port, remote_addr, url, connected_at, disconnected_at, bytes_sent, bytes_received
+SELECT id, user_id, bundle_name, tunnel_type, local_port, remote_addr, url, connected_at, disconnected_at, bytes_sent, bytes_received, event, details
 FROM user_history WHERE user_id = $1 ORDER BY connected_at DESC LIMIT $2 OFFSET $3;
 
 -- name: ClearHistory :exec
+WITH daily AS (
+    DELETE FROM user_history_daily WHERE user_id = $1
+)
 DELETE FROM user_history WHERE user_id = $1;
 
 -- name: CountHistoryByUserID :one
@@ -23,10 +26,59 @@ SELECT COUNT(*) FROM user_history WHERE user_id = $1;
 
 -- name: GetHistoryStats :one
 SELECT
-    COUNT(*) AS total_connections,
-    COALESCE(SUM(bytes_sent), 0) AS total_bytes_sent,
-    COALESCE(SUM(bytes_received), 0) AS total_bytes_received
-FROM user_history WHERE user_id = $1;
+    COALESCE(SUM(t.connections), 0)::bigint AS total_connections,
+    COALESCE(SUM(t.bytes_sent), 0)::bigint AS total_bytes_sent,
+    COALESCE(SUM(t.bytes_received), 0)::bigint AS total_bytes_received
+FROM (
+    SELECT COUNT(*) FILTER (WHERE h.event = 'session') AS connections,
+           SUM(h.bytes_sent) AS bytes_sent, SUM(h.bytes_received) AS bytes_received
+    FROM user_history h WHERE h.user_id = $1
+    UNION ALL
+    SELECT d.connections, d.bytes_sent, d.bytes_received
+    FROM user_history_daily d WHERE d.user_id = $1
+) t;
 
 -- name: DeleteHistoryOlderThan :execrows
 DELETE FROM user_history WHERE user_id = $1 AND connected_at < $2;
+
+-- name: PruneHistoryBefore :one
+WITH pruned AS (
+    DELETE FROM user_history WHERE id IN (
+        SELECT h.id FROM user_history h WHERE h.connected_at < sqlc.arg('before')::timestamptz LIMIT sqlc.arg('batch_size')::int
+    )
+    RETURNING user_id, connected_at, event, bytes_sent, bytes_received
+), rolled AS (
+    INSERT INTO user_history_daily (user_id, day, connections, bytes_sent, bytes_received)
+    SELECT user_id, (connected_at AT TIME ZONE 'UTC')::date,
+           COUNT(*) FILTER (WHERE event = 'session'), SUM(bytes_sent), SUM(bytes_received)
+    FROM pruned GROUP BY 1, 2
+    ON CONFLICT (user_id, day) DO UPDATE SET
+        connections = user_history_daily.connections + EXCLUDED.connections,
+        bytes_sent = user_history_daily.bytes_sent + EXCLUDED.bytes_sent,
+        bytes_received = user_history_daily.bytes_received + EXCLUDED.bytes_received
+    RETURNING 1
+)
+SELECT COUNT(*) FROM pruned;
+
+-- name: PruneHistoryExcess :one
+WITH ranked AS (
+    SELECT h.id, ROW_NUMBER() OVER (PARTITION BY h.user_id ORDER BY h.connected_at DESC, h.id DESC) AS rn
+    FROM user_history h
+    WHERE h.user_id IN (SELECT c.user_id FROM user_history c GROUP BY c.user_id HAVING COUNT(*) > sqlc.arg('max_entries')::bigint)
+), pruned AS (
+    DELETE FROM user_history WHERE id IN (
+        SELECT ranked.id FROM ranked WHERE ranked.rn > sqlc.arg('max_entries')::bigint LIMIT sqlc.arg('batch_size')::int
+    )
+    RETURNING user_id, connected_at, event, bytes_sent, bytes_received
+), rolled AS (
+    INSERT INTO user_history_daily (user_id, day, connections, bytes_sent, bytes_received)
+    SELECT user_id, (connected_at AT TIME ZONE 'UTC')::date,
+           COUNT(*) FILTER (WHERE event = 'session'), SUM(bytes_sent), SUM(bytes_received)
+    FROM pruned GROUP BY 1, 2
+    ON CONFLICT (user_id, day) DO UPDATE SET
+        connections = user_history_daily.connections + EXCLUDED.connections,
+        bytes_sent = user_history_daily.bytes_sent + EXCLUDED.bytes_sent,
+        bytes_received = user_history_daily.bytes_received + EXCLUDED.bytes_received
+    RETURNING 1
+)
+SELECT COUNT(*) FROM pruned;
@@ -2,42 +2,48 @@
 SELECT id, slug, name, price, max_tunnels, max_domains, max_custom_domains,
        max_tokens, max_tunnels_per_token, inspector_enabled, is_public,
        is_recommended, bandwidth_mbps, rate_limit_tcp, rate_limit_udp,
-       rate_limit_http, creem_product_id, max_data_sessions, udp_enabled
+       rate_limit_http, creem_product_id, max_data_sessions, udp_enabled,
+       monthly_bytes, inspect_max_entries, socks_enabled
 FROM plans WHERE id = $1;
 
 -- name: GetPlanBySlug :one
 SELECT id, slug, name, price, max_tunnels, max_domains, max_custom_domains,
        max_tokens, max_tunnels_per_token, inspector_enabled, is_public,
        is_recommended, bandwidth_mbps, rate_limit_tcp, rate_limit_udp,
-       rate_limit_http, creem_product_id, max_data_sessions, udp_enabled
+       rate_limit_http, creem_product_id, max_data_sessions, udp_enabled,
+       monthly_bytes, inspect_max_entries, socks_enabled
 FROM plans WHERE slug = $1;
 
 -- name: GetDefaultPlan :one
 SELECT id, slug, name, price, max_tunnels, max_domains, max_custom_domains,
        max_tokens, max_tunnels_per_token, inspector_enabled, is_public,
        is_recommended, bandwidth_mbps, rate_limit_tcp, rate_limit_udp,
-       rate_limit_http, creem_product_id, max_data_sessions, udp_enabled
+       rate_limit_http, creem_product_id, max_data_sessions, udp_enabled,
+       monthly_bytes, inspect_max_entries, socks_enabled
 FROM plans WHERE slug = 'free' LIMIT 1;
 
 -- name: ListPlans :many
 SELECT id, slug, name, price, max_tunnels, max_domains, max_custom_domains,
        max_tokens, max_tunnels_per_token, inspector_enabled, is_public,
        is_recommended, bandwidth_mbps, rate_limit_tcp, rate_limit_udp,
-       rate_limit_http, creem_product_id, max_data_sessions, udp_enabled
+       rate_limit_http, creem_product_id, max_data_sessions, udp_enabled,
+       monthly_bytes, inspect_max_entries, socks_enabled
 FROM plans ORDER BY price ASC;
 
 -- name: ListPublicPlans :many
 SELECT id, slug, name, price, max_tunnels, max_domains, max_custom_domains,
        max_tokens, max_tunnels_per_token, inspector_enabled, is_public,
        is_recommended, bandwidth_mbps, rate_limit_tcp, rate_limit_udp,
-       rate_limit_http, creem_product_id, max_data_sessions, udp_enabled
+       rate_limit_http, creem_product_id, max_data_sessions, udp_enabled,
+       monthly_bytes, inspect_max_entries, socks_enabled
 FROM plans WHERE is_public = TRUE ORDER BY price ASC;
 
 -- name: ListAllPlans :many
 SELECT id, slug, name, price, max_tunnels, max_domains, max_custom_domains,
        max_tokens, max_tunnels_per_token, inspector_enabled, is_public,
        is_recommended, bandwidth_mbps, rate_limit_tcp, rate_limit_udp,
-       rate_limit_http, creem_product_id, max_data_sessions, udp_enabled
+       rate_limit_http, creem_product_id, max_data_sessions, udp_enabled,
+       monthly_bytes, inspect_max_entries, socks_enabled
 FROM plans ORDER BY price ASC LIMIT $1 OFFSET $2;
 
 -- name: CountAllPlans :one
@@ -47,8 +53,9 @@ SELECT COUNT(*) FROM plans;
 INSERT INTO plans (slug, name, price, max_tunnels, max_domains, max_custom_domains,
                    max_tokens, max_tunnels_per_token, inspector_enabled, is_public,
                    is_recommended, bandwidth_mbps, rate_limit_tcp, rate_limit_udp,
-                   rate_limit_http, creem_product_id, max_data_sessions, udp_enabled)
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
+                   rate_limit_http, creem_product_id, max_data_sessions, udp_enabled,
+                   monthly_bytes, inspect_max_entries, socks_enabled)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)
 RETURNING id;
 
 -- name: UpdatePlan :exec
@@ -58,7 +65,8 @@ UPDATE plans SET
     inspector_enabled = $9, is_public = $10, is_recommended = $11,
     bandwidth_mbps = $12, rate_limit_tcp = $13, rate_limit_udp = $14,
     rate_limit_http = $15, creem_product_id = $16, max_data_sessions = $17,
-    udp_enabled = $18
+    udp_enabled = $18, monthly_bytes = $19, inspect_max_entries = $20,
+    socks_enabled = $21
 WHERE id = $1;
 
 -- name: DeletePlan :exec
@@ -1,24 +1,36 @@
 -- name: CreateSession :one
-INSERT INTO sessions (user_id, refresh_token_hash, user_agent, ip_address, expires_at)
-VALUES ($1, $2, $3, $4, $5)
+INSERT INTO sessions (user_id, refresh_token_hash, user_agent, ip_address, expires_at, family_id)
+VALUES ($1, $2, $3, $4, $5, $6)
 RETURNING id, created_at;
 
 -- name: GetSessionByTokenHash :one
-SELECT id, user_id, refresh_token_hash, user_agent, ip_address, expires_at, created_at
-FROM sessions WHERE refresh_token_hash = $1;
+SELECT id, user_id, refresh_token_hash, user_agent, ip_address, expires_at, created_at, family_id, rotated_at
+FROM sessions WHERE refresh_token_hash = $1 AND rotated_at IS NULL;
 
 -- name: GetSessionsByUserID :many
-SELECT id, user_id, refresh_token_hash, user_agent, ip_address, expires_at, created_at
-FROM sessions WHERE user_id = $1 ORDER BY created_at DESC;
+SELECT id, user_id, refresh_token_hash, user_agent, ip_address, expires_at, created_at, family_id, rotated_at
+FROM sessions WHERE user_id = $1 AND rotated_at IS NULL ORDER BY created_at DESC;
 
 -- name: DeleteSession :exec
 DELETE FROM sessions WHERE id = $1;
 
 -- name: DeleteSessionByTokenHash :exec
-DELETE FROM sessions WHERE refresh_token_hash = $1;
+DELETE FROM sessions WHERE refresh_token_hash = $1 AND rotated_at IS NULL;
 
 -- name: DeleteSessionsByUserID :exec
-DELETE FROM sessions WHERE user_id = $1;
+DELETE FROM sessions WHERE user_id = $1 AND rotated_at IS NULL;
+
+-- name: DeleteSessionsByFamily :exec
+DELETE FROM sessions WHERE user_id = $1 AND family_id = $2 AND rotated_at IS NULL;
 
 -- name: DeleteExpiredSessions :execrows
 DELETE FROM sessions WHERE expires_at < NOW();
+
+-- name: CreateRotatedSession :exec
+INSERT INTO sessions (user_id, refresh_token_hash, family_id, expires_at, rotated_at)
+VALUES ($1, $2, $3, $4, NOW());
+
+-- name: GetRotatedSessionByTokenHash :one
+SELECT user_id, family_id FROM sessions
+WHERE refresh_token_hash = $1 AND rotated_at IS NOT NULL
+ORDER BY rotated_at DESC LIMIT 1;
@@ -0,0 +1,11 @@
+-- name: AddMonthlyUsage :one
+INSERT INTO monthly_usage (user_id, period, bytes_in, bytes_out)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (user_id, period) DO UPDATE SET
+    bytes_in = monthly_usage.bytes_in + EXCLUDED.bytes_in,
+    bytes_out = monthly_usage.bytes_out + EXCLUDED.bytes_out
+RETURNING user_id, period, bytes_in, bytes_out;
+
+-- name: GetMonthlyUsage :one
+SELECT user_id, period, bytes_in, bytes_out
+FROM monthly_usage WHERE user_id = $1 AND period = $2;
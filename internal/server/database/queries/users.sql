@@ -4,32 +4,36 @@ VALUES ($1, $2, $3, $4, $5, $6, NOW())
 RETURNING id, created_at;
 
 -- name: CreateOAuthUser :one
-INSERT INTO users (phone, password_hash, display_name, is_admin, is_active, github_id, google_id, email, avatar_url, plan_id, created_at)
-VALUES ($1, '', $2, $3, $4, $5, $6, $7, $8, $9, NOW())
+INSERT INTO users (phone, password_hash, display_name, is_admin, is_active, github_id, google_id, gitlab_id, email, avatar_url, plan_id, created_at)
+VALUES ($1, '', $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW())
 RETURNING id, created_at;
 
 -- name: GetUserByID :one
-SELECT id, phone, password_hash, display_name, is_admin, is_active, created_at, last_login_at, github_id, email, avatar_url, google_id, plan_id, first_tunnel_at
+SELECT id, phone, password_hash, display_name, is_admin, is_active, created_at, last_login_at, github_id, email, avatar_url, google_id, plan_id, first_tunnel_at, gitlab_id, email_verified
 FROM users WHERE id = $1;
 
 -- name: GetUserByPhone :one
-SELECT id, phone, password_hash, display_name, is_admin, is_active, created_at, last_login_at, github_id, email, avatar_url, google_id, plan_id, first_tunnel_at
+SELECT id, phone, password_hash, display_name, is_admin, is_active, created_at, last_login_at, github_id, email, avatar_url, google_id, plan_id, first_tunnel_at, gitlab_id, email_verified
 FROM users WHERE phone = $1;
 
 -- name: GetUserByEmail :one
-SELECT id, phone, password_hash, display_name, is_admin, is_active, created_at, last_login_at, github_id, email, avatar_url, google_id, plan_id, first_tunnel_at
+SELECT id, phone, password_hash, display_name, is_admin, is_active, created_at, last_login_at, github_id, email, avatar_url, google_id, plan_id, first_tunnel_at, gitlab_id, email_verified
 FROM users WHERE email = $1;
 
 -- name: GetUserByGitHubID :one
-SELECT id, phone, password_hash, display_name, is_admin, is_active, created_at, last_login_at, github_id, email, avatar_url, google_id, plan_id, first_tunnel_at
+SELECT id, phone, password_hash, display_name, is_admin, is_active, created_at, last_login_at, github_id, email, avatar_url, google_id, plan_id, first_tunnel_at, gitlab_id, email_verified
 FROM users WHERE github_id = $1;
 
 -- name: GetUserByGoogleID :one
-SELECT id, phone, password_hash, display_name, is_admin, is_active, created_at, last_login_at, github_id, email, avatar_url, google_id, plan_id, first_tunnel_at
+SELECT id, phone, password_hash, display_name, is_admin, is_active, created_at, last_login_at, github_id, email, avatar_url, google_id, plan_id, first_tunnel_at, gitlab_id, email_verified
 FROM users WHERE google_id = $1;
 
+-- name: GetUserByGitLabID :one
+SELECT id, phone, password_hash, display_name, is_admin, is_active, created_at, last_login_at, github_id, email, avatar_url, google_id, plan_id, first_tunnel_at, gitlab_id, email_verified
+FROM users WHERE gitlab_id = $1;
+
 -- name: GetUsersByIDs :many
-SELECT id, phone, password_hash, display_name, is_admin, is_active, created_at, last_login_at, github_id, email, avatar_url, google_id, plan_id, first_tunnel_at
+SELECT id, phone, password_hash, display_name, is_admin, is_active, created_at, last_login_at, github_id, email, avatar_url, google_id, plan_id, first_tunnel_at, gitlab_id, email_verified
 FROM users WHERE id = ANY($1::bigint[]);
 
 -- name: UpdateUser :exec
@@ -40,7 +44,13 @@ WHERE id = $1;
 UPDATE users SET password_hash = $2 WHERE id = $1;
 
 -- name: UpdateUserEmail :exec
-UPDATE users SET email = $2 WHERE id = $1;
+UPDATE users SET email = $2, email_verified = FALSE WHERE id = $1;
+
+-- name: SetUserEmailVerified :execrows
+UPDATE users SET email_verified = TRUE WHERE id = $1 AND LOWER(email) = LOWER($2);
+
+-- name: VerifyUserEmail :execrows
+UPDATE users SET email = $2, email_verified = TRUE WHERE id = $1;
 
 -- name: UpdateUserPhone :exec
 UPDATE users SET phone = $2 WHERE id = $1;
@@ -66,6 +76,12 @@ UPDATE users SET google_id = $2,
     avatar_url = COALESCE(NULLIF(avatar_url, ''), $4)
 WHERE id = $1;
 
+-- name: LinkGitLab :exec
+UPDATE users SET gitlab_id = $2,
+    email = COALESCE(NULLIF(email, ''), $3),
+    avatar_url = COALESCE(NULLIF(avatar_url, ''), $4)
+WHERE id = $1;
+
 -- name: SetFirstTunnelAt :execrows
 UPDATE users SET first_tunnel_at = $2 WHERE id = $1 AND first_tunnel_at IS NULL;
 
@@ -73,7 +89,7 @@ UPDATE users SET first_tunnel_at = $2 WHERE id = $1 AND first_tunnel_at IS NULL;
 SELECT COUNT(*) FROM users;
 
 -- name: ListUsersFiltered :many
-SELECT id, phone, password_hash, display_name, is_admin, is_active, created_at, last_login_at, github_id, email, avatar_url, google_id, plan_id, first_tunnel_at
+SELECT id, phone, password_hash, display_name, is_admin, is_active, created_at, last_login_at, github_id, email, avatar_url, google_id, plan_id, first_tunnel_at, gitlab_id, email_verified
 FROM users
 WHERE (sqlc.narg('is_active')::boolean IS NULL OR is_active = sqlc.narg('is_active'))
   AND (sqlc.narg('is_admin')::boolean IS NULL OR is_admin = sqlc.narg('is_admin'))
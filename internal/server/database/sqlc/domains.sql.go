@@ -23,14 +23,15 @@ func (q *Queries) CountReservedDomainsByUserID(ctx context.Context, userID int64
 }
 
 const createReservedDomain = `-- name: CreateReservedDomain :one
-INSERT INTO reserved_domains (user_id, subdomain, created_at)
-VALUES ($1, $2, NOW())
+INSERT INTO reserved_domains (user_id, subdomain, created_at, expires_at)
+VALUES ($1, $2, NOW(), $3)
 RETURNING id, created_at
 `
 
 type CreateReservedDomainParams struct {
-	UserID    int64  `json:"user_id"`
-	Subdomain string `json:"subdomain"`
+	UserID    int64              `json:"user_id"`
+	Subdomain string             `json:"subdomain"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
 }
 
 type CreateReservedDomainRow struct {
@@ -39,12 +40,75 @@ type CreateReservedDomainRow struct {
 }
 
 func (q *Queries) CreateReservedDomain(ctx context.Context, arg CreateReservedDomainParams) (CreateReservedDomainRow, error) {
-	row := q.db.QueryRow(ctx, createReservedDomain, arg.UserID, arg.Subdomain)
+	row := q.db.QueryRow(ctx, createReservedDomain, arg.UserID, arg.Subdomain, arg.ExpiresAt)
 	var i CreateReservedDomainRow
 	err := row.Scan(&i.ID, &i.CreatedAt)
 	return i, err
 }
 
+const createReservedDomainWithinLimit = `-- name: CreateReservedDomainWithinLimit :one
+INSERT INTO reserved_domains (user_id, subdomain, created_at, expires_at)
+SELECT $1::bigint, $2::text, NOW(), $3::timestamptz
+WHERE $4::int < 0
+   OR (SELECT COUNT(*) FROM reserved_domains d WHERE d.user_id = $1::bigint) < $4::int
+RETURNING id, created_at
+`
+
+type CreateReservedDomainWithinLimitParams struct {
+	UserID     int64              `json:"user_id"`
+	Subdomain  string             `json:"subdomain"`
+	ExpiresAt  pgtype.Timestamptz `json:"expires_at"`
+	MaxDomains int32              `json:"max_domains"`
+}
+
+type CreateReservedDomainWithinLimitRow struct {
+	ID        int64              `json:"id"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
+func (q *Queries) CreateReservedDomainWithinLimit(ctx context.Context, arg CreateReservedDomainWithinLimitParams) (CreateReservedDomainWithinLimitRow, error) {
+	row := q.db.QueryRow(ctx, createReservedDomainWithinLimit,
+		arg.UserID,
+		arg.Subdomain,
+		arg.ExpiresAt,
+		arg.MaxDomains,
+	)
+	var i CreateReservedDomainWithinLimitRow
+	err := row.Scan(&i.ID, &i.CreatedAt)
+	return i, err
+}
+
+const deleteExpiredReservedDomains = `-- name: DeleteExpiredReservedDomains :many
+DELETE FROM reserved_domains WHERE expires_at IS NOT NULL AND expires_at <= NOW()
+RETURNING id, user_id, subdomain, created_at, expires_at
+`
+
+func (q *Queries) DeleteExpiredReservedDomains(ctx context.Context) ([]ReservedDomain, error) {
+	rows, err := q.db.Query(ctx, deleteExpiredReservedDomains)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ReservedDomain{}
+	for rows.Next() {
+		var i ReservedDomain
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Subdomain,
+			&i.CreatedAt,
+			&i.ExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const deleteReservedDomain = `-- name: DeleteReservedDomain :exec
 DELETE FROM reserved_domains WHERE id = $1
 `
@@ -64,7 +128,7 @@ func (q *Queries) DeleteReservedDomainsByUserID(ctx context.Context, userID int6
 }
 
 const getReservedDomainByID = `-- name: GetReservedDomainByID :one
-SELECT id, user_id, subdomain, created_at FROM reserved_domains WHERE id = $1
+SELECT id, user_id, subdomain, created_at, expires_at FROM reserved_domains WHERE id = $1
 `
 
 func (q *Queries) GetReservedDomainByID(ctx context.Context, id int64) (ReservedDomain, error) {
@@ -75,12 +139,13 @@ func (q *Queries) GetReservedDomainByID(ctx context.Context, id int64) (Reserved
 		&i.UserID,
 		&i.Subdomain,
 		&i.CreatedAt,
+		&i.ExpiresAt,
 	)
 	return i, err
 }
 
 const getReservedDomainBySubdomain = `-- name: GetReservedDomainBySubdomain :one
-SELECT id, user_id, subdomain, created_at FROM reserved_domains WHERE subdomain = $1
+SELECT id, user_id, subdomain, created_at, expires_at FROM reserved_domains WHERE subdomain = $1
 `
 
 func (q *Queries) GetReservedDomainBySubdomain(ctx context.Context, subdomain string) (ReservedDomain, error) {
@@ -91,6 +156,7 @@ func (q *Queries) GetReservedDomainBySubdomain(ctx context.Context, subdomain st
 		&i.UserID,
 		&i.Subdomain,
 		&i.CreatedAt,
+		&i.ExpiresAt,
 	)
 	return i, err
 }
@@ -122,8 +188,39 @@ func (q *Queries) IsSubdomainOwnedByUser(ctx context.Context, arg IsSubdomainOwn
 	return owned, err
 }
 
+const listActiveReservedDomains = `-- name: ListActiveReservedDomains :many
+SELECT id, user_id, subdomain, created_at, expires_at FROM reserved_domains
+WHERE expires_at IS NULL OR expires_at > NOW()
+`
+
+func (q *Queries) ListActiveReservedDomains(ctx context.Context) ([]ReservedDomain, error) {
+	rows, err := q.db.Query(ctx, listActiveReservedDomains)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ReservedDomain{}
+	for rows.Next() {
+		var i ReservedDomain
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Subdomain,
+			&i.CreatedAt,
+			&i.ExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listReservedDomainsByUserID = `-- name: ListReservedDomainsByUserID :many
-SELECT id, user_id, subdomain, created_at FROM reserved_domains WHERE user_id = $1 ORDER BY created_at DESC
+SELECT id, user_id, subdomain, created_at, expires_at FROM reserved_domains WHERE user_id = $1 ORDER BY created_at DESC
 `
 
 func (q *Queries) ListReservedDomainsByUserID(ctx context.Context, userID int64) ([]ReservedDomain, error) {
@@ -140,6 +237,7 @@ func (q *Queries) ListReservedDomainsByUserID(ctx context.Context, userID int64)
 			&i.UserID,
 			&i.Subdomain,
 			&i.CreatedAt,
+			&i.ExpiresAt,
 		); err != nil {
 			return nil, err
 		}
@@ -150,3 +248,12 @@ func (q *Queries) ListReservedDomainsByUserID(ctx context.Context, userID int64)
 	}
 	return items, nil
 }
+
+const lockReservedDomainOwner = `-- name: LockReservedDomainOwner :exec
+SELECT id FROM users WHERE id = $1 FOR NO KEY UPDATE
+`
+
+func (q *Queries) LockReservedDomainOwner(ctx context.Context, id int64) error {
+	_, err := q.db.Exec(ctx, lockReservedDomainOwner, id)
+	return err
+}
@@ -112,6 +112,61 @@ func (q *Queries) GetExchangeByID(ctx context.Context, id string) (GetExchangeBy
 	return i, err
 }
 
+const getExchangeByIDAndUser = `-- name: GetExchangeByIDAndUser :one
+SELECT id, tunnel_id, trace_id, replay_ref, timestamp, duration_ns, method, path, host, request_headers, request_body, request_body_size, response_headers, response_body, response_body_size, status_code, remote_addr
+FROM inspect_exchanges WHERE id = $1 AND user_id = $2
+`
+
+type GetExchangeByIDAndUserParams struct {
+	ID     string `json:"id"`
+	UserID int64  `json:"user_id"`
+}
+
+type GetExchangeByIDAndUserRow struct {
+	ID               string             `json:"id"`
+	TunnelID         string             `json:"tunnel_id"`
+	TraceID          pgtype.Text        `json:"trace_id"`
+	ReplayRef        pgtype.Text        `json:"replay_ref"`
+	Timestamp        pgtype.Timestamptz `json:"timestamp"`
+	DurationNs       int64              `json:"duration_ns"`
+	Method           string             `json:"method"`
+	Path             string             `json:"path"`
+	Host             string             `json:"host"`
+	RequestHeaders   []byte             `json:"request_headers"`
+	RequestBody      []byte             `json:"request_body"`
+	RequestBodySize  int32              `json:"request_body_size"`
+	ResponseHeaders  []byte             `json:"response_headers"`
+	ResponseBody     []byte             `json:"response_body"`
+	ResponseBodySize int32              `json:"response_body_size"`
+	StatusCode       int32              `json:"status_code"`
+	RemoteAddr       pgtype.Text        `json:"remote_addr"`
+}
+
+func (q *Queries) GetExchangeByIDAndUser(ctx context.Context, arg GetExchangeByIDAndUserParams) (GetExchangeByIDAndUserRow, error) {
+	row := q.db.QueryRow(ctx, getExchangeByIDAndUser, arg.ID, arg.UserID)
+	var i GetExchangeByIDAndUserRow
+	err := row.Scan(
+		&i.ID,
+		&i.TunnelID,
+		&i.TraceID,
+		&i.ReplayRef,
+		&i.Timestamp,
+		&i.DurationNs,
+		&i.Method,
+		&i.Path,
+		&i.Host,
+		&i.RequestHeaders,
+		&i.RequestBody,
+		&i.RequestBodySize,
+		&i.ResponseHeaders,
+		&i.ResponseBody,
+		&i.ResponseBodySize,
+		&i.StatusCode,
+		&i.RemoteAddr,
+	)
+	return i, err
+}
+
 const listExchangesByHostAndUser = `-- name: ListExchangesByHostAndUser :many
 SELECT id, tunnel_id, trace_id, replay_ref, timestamp, duration_ns, method, path, host, request_headers, request_body, request_body_size, response_headers, response_body, response_body_size, status_code, remote_addr
 FROM inspect_exchanges WHERE host = $1 AND user_id = $2 ORDER BY timestamp DESC LIMIT $3 OFFSET $4
@@ -12,6 +12,9 @@ import (
 )
 
 const clearHistory = `-- name: ClearHistory :exec
+WITH daily AS (
+    DELETE FROM user_history_daily WHERE user_id = $1
+)
 DELETE FROM user_history WHERE user_id = $1
 `
 
@@ -32,8 +35,8 @@ func (q *Queries) CountHistoryByUserID(ctx context.Context, userID int64) (int64
 }
 
 const createHistoryEntry = `-- name: CreateHistoryEntry :one
-INSERT INTO user_history (user_id, bundle_name, tunnel_type, local_port, remote_addr, url, connected_at, disconnected_at, bytes_sent, bytes_received)
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+INSERT INTO user_history (user_id, bundle_name, tunnel_type, local_port, remote_addr, url, connected_at, disconnected_at, bytes_sent, bytes_received, event, details)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 RETURNING id
 `
 
@@ -48,6 +51,8 @@ type CreateHistoryEntryParams struct {
 	DisconnectedAt pgtype.Timestamptz `json:"disconnected_at"`
 	BytesSent      int64              `json:"bytes_sent"`
 	BytesReceived  int64              `json:"bytes_received"`
+	Event          string             `json:"event"`
+	Details        pgtype.Text        `json:"details"`
 }
 
 func (q *Queries) CreateHistoryEntry(ctx context.Context, arg CreateHistoryEntryParams) (int64, error) {
@@ -62,6 +67,8 @@ func (q *Queries) CreateHistoryEntry(ctx context.Context, arg CreateHistoryEntry
 		arg.DisconnectedAt,
 		arg.BytesSent,
 		arg.BytesReceived,
+		arg.Event,
+		arg.Details,
 	)
 	var id int64
 	err := row.Scan(&id)
@@ -86,7 +93,7 @@ func (q *Queries) DeleteHistoryOlderThan(ctx context.Context, arg DeleteHistoryO
 }
 
 const getHistoryEntryByID = `-- name: GetHistoryEntryByID :one
-SELECT id, user_id, bundle_name, tunnel_type, local_port, remote_addr, url, connected_at, disconnected_at, bytes_sent, bytes_received
+SELECT id, user_id, bundle_name, tunnel_type, local_port, remote_addr, url, connected_at, disconnected_at, bytes_sent, bytes_received, event, details
 FROM user_history WHERE id = $1 AND user_id = $2
 `
 
@@ -110,22 +117,31 @@ func (q *Queries) GetHistoryEntryByID(ctx context.Context, arg GetHistoryEntryBy
 		&i.DisconnectedAt,
 		&i.BytesSent,
 		&i.BytesReceived,
+		&i.Event,
+		&i.Details,
 	)
 	return i, err
 }
 
 const getHistoryStats = `-- name: GetHistoryStats :one
 SELECT
-    COUNT(*) AS total_connections,
-    COALESCE(SUM(bytes_sent), 0) AS total_bytes_sent,
-    COALESCE(SUM(bytes_received), 0) AS total_bytes_received
-FROM user_history WHERE user_id = $1
+    COALESCE(SUM(t.connections), 0)::bigint AS total_connections,
+    COALESCE(SUM(t.bytes_sent), 0)::bigint AS total_bytes_sent,
+    COALESCE(SUM(t.bytes_received), 0)::bigint AS total_bytes_received
+FROM (
+    SELECT COUNT(*) FILTER (WHERE h.event = 'session') AS connections,
+           SUM(h.bytes_sent) AS bytes_sent, SUM(h.bytes_received) AS bytes_received
+    FROM user_history h WHERE h.user_id = $1
+    UNION ALL
+    SELECT d.connections, d.bytes_sent, d.bytes_received
+    FROM user_history_daily d WHERE d.user_id = $1
+) t
 `
 
 type GetHistoryStatsRow struct {
-	TotalConnections   int64       `json:"total_connections"`
-	TotalBytesSent     interface{} `json:"total_bytes_sent"`
-	TotalBytesReceived interface{} `json:"total_bytes_received"`
+	TotalConnections   int64 `json:"total_connections"`
+	TotalBytesSent     int64 `json:"total_bytes_sent"`
+	TotalBytesReceived int64 `json:"total_bytes_received"`
 }
 
 func (q *Queries) GetHistoryStats(ctx context.Context, userID int64) (GetHistoryStatsRow, error) {
@@ -136,7 +152,7 @@ func (q *Queries) GetHistoryStats(ctx context.Context, userID int64) (GetHistory
 }
 
 const listHistoryByUserID = `-- name: ListHistoryByUserID :many
-SELECT id, user_id, bundle_name, tunnel_type, local_port, remote_addr, url, connected_at, disconnected_at, bytes_sent, bytes_received
+SELECT id, user_id, bundle_name, tunnel_type, local_port, remote_addr, url, connected_at, disconnected_at, bytes_sent, bytes_received, event, details
 FROM user_history WHERE user_id = $1 ORDER BY connected_at DESC LIMIT $2 OFFSET $3
 `
 
@@ -167,6 +183,8 @@ func (q *Queries) ListHistoryByUserID(ctx context.Context, arg ListHistoryByUser
 			&i.DisconnectedAt,
 			&i.BytesSent,
 			&i.BytesReceived,
+			&i.Event,
+			&i.Details,
 		); err != nil {
 			return nil, err
 		}
@@ -178,6 +196,74 @@ func (q *Queries) ListHistoryByUserID(ctx context.Context, arg ListHistoryByUser
 	return items, nil
 }
 
+const pruneHistoryBefore = `-- name: PruneHistoryBefore :one
+WITH pruned AS (
+    DELETE FROM user_history WHERE id IN (
+        SELECT h.id FROM user_history h WHERE h.connected_at < $1::timestamptz LIMIT $2::int
+    )
+    RETURNING user_id, connected_at, event, bytes_sent, bytes_received
+), rolled AS (
+    INSERT INTO user_history_daily (user_id, day, connections, bytes_sent, bytes_received)
+    SELECT user_id, (connected_at AT TIME ZONE 'UTC')::date,
+           COUNT(*) FILTER (WHERE event = 'session'), SUM(bytes_sent), SUM(bytes_received)
+    FROM pruned GROUP BY 1, 2
+    ON CONFLICT (user_id, day) DO UPDATE SET
+        connections = user_history_daily.connections + EXCLUDED.connections,
+        bytes_sent = user_history_daily.bytes_sent + EXCLUDED.bytes_sent,
+        bytes_received = user_history_daily.bytes_received + EXCLUDED.bytes_received
+    RETURNING 1
+)
+SELECT COUNT(*) FROM pruned
+`
+
+type PruneHistoryBeforeParams struct {
+	Before    pgtype.Timestamptz `json:"before"`
+	BatchSize int32              `json:"batch_size"`
+}
+
+func (q *Queries) PruneHistoryBefore(ctx context.Context, arg PruneHistoryBeforeParams) (int64, error) {
+	row := q.db.QueryRow(ctx, pruneHistoryBefore, arg.Before, arg.BatchSize)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const pruneHistoryExcess = `-- name: PruneHistoryExcess :one
+WITH ranked AS (
+    SELECT h.id, ROW_NUMBER() OVER (PARTITION BY h.user_id ORDER BY h.connected_at DESC, h.id DESC) AS rn
+    FROM user_history h
+    WHERE h.user_id IN (SELECT c.user_id FROM user_history c GROUP BY c.user_id HAVING COUNT(*) > $1::bigint)
+), pruned AS (
+    DELETE FROM user_history WHERE id IN (
+        SELECT ranked.id FROM ranked WHERE ranked.rn > $1::bigint LIMIT $2::int
+    )
+    RETURNING user_id, connected_at, event, bytes_sent, bytes_received
+), rolled AS (
+    INSERT INTO user_history_daily (user_id, day, connections, bytes_sent, bytes_received)
+    SELECT user_id, (connected_at AT TIME ZONE 'UTC')::date,
+           COUNT(*) FILTER (WHERE event = 'session'), SUM(bytes_sent), SUM(bytes_received)
+    FROM pruned GROUP BY 1, 2
+    ON CONFLICT (user_id, day) DO UPDATE SET
+        connections = user_history_daily.connections + EXCLUDED.connections,
+        bytes_sent = user_history_daily.bytes_sent + EXCLUDED.bytes_sent,
+        bytes_received = user_history_daily.bytes_received + EXCLUDED.bytes_received
+    RETURNING 1
+)
+SELECT COUNT(*) FROM pruned
+`
+
+type PruneHistoryExcessParams struct {
+	MaxEntries int64 `json:"max_entries"`
+	BatchSize  int32 `json:"batch_size"`
+}
+
+func (q *Queries) PruneHistoryExcess(ctx context.Context, arg PruneHistoryExcessParams) (int64, error) {
+	row := q.db.QueryRow(ctx, pruneHistoryExcess, arg.MaxEntries, arg.BatchSize)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const updateHistoryEntry = `-- name: UpdateHistoryEntry :exec
 UPDATE user_history SET disconnected_at = $3, bytes_sent = $4, bytes_received = $5
 WHERE id = $1 AND user_id = $2
@@ -91,6 +91,13 @@ type InviteCode struct {
 	CreatedAt       pgtype.Timestamptz `json:"created_at"`
 }
 
+type MonthlyUsage struct {
+	UserID   int64       `json:"user_id"`
+	Period   pgtype.Date `json:"period"`
+	BytesIn  int64       `json:"bytes_in"`
+	BytesOut int64       `json:"bytes_out"`
+}
+
 type Payment struct {
 	ID             int64              `json:"id"`
 	UserID         int64              `json:"user_id"`
@@ -125,6 +132,9 @@ type Plan struct {
 	CreemProductID     string  `json:"creem_product_id"`
 	MaxDataSessions    int32   `json:"max_data_sessions"`
 	UdpEnabled         bool    `json:"udp_enabled"`
+	MonthlyBytes       int64   `json:"monthly_bytes"`
+	InspectMaxEntries  int32   `json:"inspect_max_entries"`
+	SocksEnabled       bool    `json:"socks_enabled"`
 }
 
 type ReservedDomain struct {
@@ -132,6 +142,7 @@ type ReservedDomain struct {
 	UserID    int64              `json:"user_id"`
 	Subdomain string             `json:"subdomain"`
 	CreatedAt pgtype.Timestamptz `json:"created_at"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
 }
 
 type Session struct {
@@ -142,6 +153,8 @@ type Session struct {
 	IpAddress        pgtype.Text        `json:"ip_address"`
 	ExpiresAt        pgtype.Timestamptz `json:"expires_at"`
 	CreatedAt        pgtype.Timestamptz `json:"created_at"`
+	FamilyID         string             `json:"family_id"`
+	RotatedAt        pgtype.Timestamptz `json:"rotated_at"`
 }
 
 type Subscription struct {
@@ -194,6 +207,8 @@ type User struct {
 	GoogleID      pgtype.Text        `json:"google_id"`
 	PlanID        pgtype.Int8        `json:"plan_id"`
 	FirstTunnelAt pgtype.Timestamptz `json:"first_tunnel_at"`
+	GitlabID      pgtype.Int8        `json:"gitlab_id"`
+	EmailVerified bool               `json:"email_verified"`
 }
 
 type UserBundle struct {
@@ -221,6 +236,8 @@ type UserHistory struct {
 	DisconnectedAt pgtype.Timestamptz `json:"disconnected_at"`
 	BytesSent      int64              `json:"bytes_sent"`
 	BytesReceived  int64              `json:"bytes_received"`
+	Event          string             `json:"event"`
+	Details        pgtype.Text        `json:"details"`
 }
 
 type UserSetting struct {
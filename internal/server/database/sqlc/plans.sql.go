@@ -37,8 +37,9 @@ const createPlan = `-- name: CreatePlan :one
 INSERT INTO plans (slug, name, price, max_tunnels, max_domains, max_custom_domains,
                    max_tokens, max_tunnels_per_token, inspector_enabled, is_public,
                    is_recommended, bandwidth_mbps, rate_limit_tcp, rate_limit_udp,
-                   rate_limit_http, creem_product_id, max_data_sessions, udp_enabled)
-VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
+                   rate_limit_http, creem_product_id, max_data_sessions, udp_enabled,
+                   monthly_bytes, inspect_max_entries, socks_enabled)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)
 RETURNING id
 `
 
@@ -61,6 +62,9 @@ type CreatePlanParams struct {
 	CreemProductID     string  `json:"creem_product_id"`
 	MaxDataSessions    int32   `json:"max_data_sessions"`
 	UdpEnabled         bool    `json:"udp_enabled"`
+	MonthlyBytes       int64   `json:"monthly_bytes"`
+	InspectMaxEntries  int32   `json:"inspect_max_entries"`
+	SocksEnabled       bool    `json:"socks_enabled"`
 }
 
 func (q *Queries) CreatePlan(ctx context.Context, arg CreatePlanParams) (int64, error) {
@@ -83,6 +87,9 @@ func (q *Queries) CreatePlan(ctx context.Context, arg CreatePlanParams) (int64,
 		arg.CreemProductID,
 		arg.MaxDataSessions,
 		arg.UdpEnabled,
+		arg.MonthlyBytes,
+		arg.InspectMaxEntries,
+		arg.SocksEnabled,
 	)
 	var id int64
 	err := row.Scan(&id)
@@ -102,7 +109,8 @@ const getDefaultPlan = `-- name: GetDefaultPlan :one
 SELECT id, slug, name, price, max_tunnels, max_domains, max_custom_domains,
        max_tokens, max_tunnels_per_token, inspector_enabled, is_public,
        is_recommended, bandwidth_mbps, rate_limit_tcp, rate_limit_udp,
-       rate_limit_http, creem_product_id, max_data_sessions, udp_enabled
+       rate_limit_http, creem_product_id, max_data_sessions, udp_enabled,
+       monthly_bytes, inspect_max_entries, socks_enabled
 FROM plans WHERE slug = 'free' LIMIT 1
 `
 
@@ -129,6 +137,9 @@ func (q *Queries) GetDefaultPlan(ctx context.Context) (Plan, error) {
 		&i.CreemProductID,
 		&i.MaxDataSessions,
 		&i.UdpEnabled,
+		&i.MonthlyBytes,
+		&i.InspectMaxEntries,
+		&i.SocksEnabled,
 	)
 	return i, err
 }
@@ -137,7 +148,8 @@ const getPlanByID = `-- name: GetPlanByID :one
 SELECT id, slug, name, price, max_tunnels, max_domains, max_custom_domains,
        max_tokens, max_tunnels_per_token, inspector_enabled, is_public,
        is_recommended, bandwidth_mbps, rate_limit_tcp, rate_limit_udp,
-       rate_limit_http, creem_product_id, max_data_sessions, udp_enabled
+       rate_limit_http, creem_product_id, max_data_sessions, udp_enabled,
+       monthly_bytes, inspect_max_entries, socks_enabled
 FROM plans WHERE id = $1
 `
 
@@ -164,6 +176,9 @@ func (q *Queries) GetPlanByID(ctx context.Context, id int64) (Plan, error) {
 		&i.CreemProductID,
 		&i.MaxDataSessions,
 		&i.UdpEnabled,
+		&i.MonthlyBytes,
+		&i.InspectMaxEntries,
+		&i.SocksEnabled,
 	)
 	return i, err
 }
@@ -172,7 +187,8 @@ const getPlanBySlug = `-- name: GetPlanBySlug :one
 SELECT id, slug, name, price, max_tunnels, max_domains, max_custom_domains,
        max_tokens, max_tunnels_per_token, inspector_enabled, is_public,
        is_recommended, bandwidth_mbps, rate_limit_tcp, rate_limit_udp,
-       rate_limit_http, creem_product_id, max_data_sessions, udp_enabled
+       rate_limit_http, creem_product_id, max_data_sessions, udp_enabled,
+       monthly_bytes, inspect_max_entries, socks_enabled
 FROM plans WHERE slug = $1
 `
 
@@ -199,6 +215,9 @@ func (q *Queries) GetPlanBySlug(ctx context.Context, slug string) (Plan, error)
 		&i.CreemProductID,
 		&i.MaxDataSessions,
 		&i.UdpEnabled,
+		&i.MonthlyBytes,
+		&i.InspectMaxEntries,
+		&i.SocksEnabled,
 	)
 	return i, err
 }
@@ -207,7 +226,8 @@ const listAllPlans = `-- name: ListAllPlans :many
 SELECT id, slug, name, price, max_tunnels, max_domains, max_custom_domains,
        max_tokens, max_tunnels_per_token, inspector_enabled, is_public,
        is_recommended, bandwidth_mbps, rate_limit_tcp, rate_limit_udp,
-       rate_limit_http, creem_product_id, max_data_sessions, udp_enabled
+       rate_limit_http, creem_product_id, max_data_sessions, udp_enabled,
+       monthly_bytes, inspect_max_entries, socks_enabled
 FROM plans ORDER BY price ASC LIMIT $1 OFFSET $2
 `
 
@@ -245,6 +265,9 @@ func (q *Queries) ListAllPlans(ctx context.Context, arg ListAllPlansParams) ([]P
 			&i.CreemProductID,
 			&i.MaxDataSessions,
 			&i.UdpEnabled,
+			&i.MonthlyBytes,
+			&i.InspectMaxEntries,
+			&i.SocksEnabled,
 		); err != nil {
 			return nil, err
 		}
@@ -260,7 +283,8 @@ const listPlans = `-- name: ListPlans :many
 SELECT id, slug, name, price, max_tunnels, max_domains, max_custom_domains,
        max_tokens, max_tunnels_per_token, inspector_enabled, is_public,
        is_recommended, bandwidth_mbps, rate_limit_tcp, rate_limit_udp,
-       rate_limit_http, creem_product_id, max_data_sessions, udp_enabled
+       rate_limit_http, creem_product_id, max_data_sessions, udp_enabled,
+       monthly_bytes, inspect_max_entries, socks_enabled
 FROM plans ORDER BY price ASC
 `
 
@@ -293,6 +317,9 @@ func (q *Queries) ListPlans(ctx context.Context) ([]Plan, error) {
 			&i.CreemProductID,
 			&i.MaxDataSessions,
 			&i.UdpEnabled,
+			&i.MonthlyBytes,
+			&i.InspectMaxEntries,
+			&i.SocksEnabled,
 		); err != nil {
 			return nil, err
 		}
@@ -308,7 +335,8 @@ const listPublicPlans = `-- name: ListPublicPlans :many
 SELECT id, slug, name, price, max_tunnels, max_domains, max_custom_domains,
        max_tokens, max_tunnels_per_token, inspector_enabled, is_public,
        is_recommended, bandwidth_mbps, rate_limit_tcp, rate_limit_udp,
-       rate_limit_http, creem_product_id, max_data_sessions, udp_enabled
+       rate_limit_http, creem_product_id, max_data_sessions, udp_enabled,
+       monthly_bytes, inspect_max_entries, socks_enabled
 FROM plans WHERE is_public = TRUE ORDER BY price ASC
 `
 
@@ -341,6 +369,9 @@ func (q *Queries) ListPublicPlans(ctx context.Context) ([]Plan, error) {
 			&i.CreemProductID,
 			&i.MaxDataSessions,
 			&i.UdpEnabled,
+			&i.MonthlyBytes,
+			&i.InspectMaxEntries,
+			&i.SocksEnabled,
 		); err != nil {
 			return nil, err
 		}
@@ -359,7 +390,8 @@ UPDATE plans SET
     inspector_enabled = $9, is_public = $10, is_recommended = $11,
     bandwidth_mbps = $12, rate_limit_tcp = $13, rate_limit_udp = $14,
     rate_limit_http = $15, creem_product_id = $16, max_data_sessions = $17,
-    udp_enabled = $18
+    udp_enabled = $18, monthly_bytes = $19, inspect_max_entries = $20,
+    socks_enabled = $21
 WHERE id = $1
 `
 
@@ -382,6 +414,9 @@ type UpdatePlanParams struct {
 	CreemProductID     string  `json:"creem_product_id"`
 	MaxDataSessions    int32   `json:"max_data_sessions"`
 	UdpEnabled         bool    `json:"udp_enabled"`
+	MonthlyBytes       int64   `json:"monthly_bytes"`
+	InspectMaxEntries  int32   `json:"inspect_max_entries"`
+	SocksEnabled       bool    `json:"socks_enabled"`
 }
 
 func (q *Queries) UpdatePlan(ctx context.Context, arg UpdatePlanParams) error {
@@ -404,6 +439,9 @@ func (q *Queries) UpdatePlan(ctx context.Context, arg UpdatePlanParams) error {
 		arg.CreemProductID,
 		arg.MaxDataSessions,
 		arg.UdpEnabled,
+		arg.MonthlyBytes,
+		arg.InspectMaxEntries,
+		arg.SocksEnabled,
 	)
 	return err
 }
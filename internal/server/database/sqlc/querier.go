@@ -11,6 +11,7 @@ import (
 )
 
 type Querier interface {
+	AddMonthlyUsage(ctx context.Context, arg AddMonthlyUsageParams) (MonthlyUsage, error)
 	ClearHistory(ctx context.Context, userID int64) error
 	ClearSettings(ctx context.Context, userID int64) error
 	CountAPITokensByUserID(ctx context.Context, userID int64) (int64, error)
@@ -41,6 +42,8 @@ type Querier interface {
 	CreatePayment(ctx context.Context, arg CreatePaymentParams) (CreatePaymentRow, error)
 	CreatePlan(ctx context.Context, arg CreatePlanParams) (int64, error)
 	CreateReservedDomain(ctx context.Context, arg CreateReservedDomainParams) (CreateReservedDomainRow, error)
+	CreateReservedDomainWithinLimit(ctx context.Context, arg CreateReservedDomainWithinLimitParams) (CreateReservedDomainWithinLimitRow, error)
+	CreateRotatedSession(ctx context.Context, arg CreateRotatedSessionParams) error
 	CreateSession(ctx context.Context, arg CreateSessionParams) (CreateSessionRow, error)
 	CreateSubscription(ctx context.Context, arg CreateSubscriptionParams) (CreateSubscriptionRow, error)
 	CreateTOTPSecret(ctx context.Context, arg CreateTOTPSecretParams) (CreateTOTPSecretRow, error)
@@ -54,6 +57,7 @@ type Querier interface {
 	DeleteCustomDomain(ctx context.Context, id int64) error
 	DeleteExchangesByTunnelID(ctx context.Context, tunnelID string) (int64, error)
 	DeleteExchangesOlderThan(ctx context.Context, createdAt pgtype.Timestamptz) (int64, error)
+	DeleteExpiredReservedDomains(ctx context.Context) ([]ReservedDomain, error)
 	DeleteExpiredSessions(ctx context.Context) (int64, error)
 	DeleteHistoryOlderThan(ctx context.Context, arg DeleteHistoryOlderThanParams) (int64, error)
 	DeletePlan(ctx context.Context, id int64) error
@@ -61,6 +65,7 @@ type Querier interface {
 	DeleteReservedDomainsByUserID(ctx context.Context, userID int64) error
 	DeleteSession(ctx context.Context, id int64) error
 	DeleteSessionByTokenHash(ctx context.Context, refreshTokenHash string) error
+	DeleteSessionsByFamily(ctx context.Context, arg DeleteSessionsByFamilyParams) error
 	DeleteSessionsByUserID(ctx context.Context, userID int64) error
 	DeleteSetting(ctx context.Context, arg DeleteSettingParams) error
 	DeleteSubscription(ctx context.Context, id int64) error
@@ -82,11 +87,13 @@ type Querier interface {
 	GetCustomDomainByID(ctx context.Context, id int64) (CustomDomain, error)
 	GetDefaultPlan(ctx context.Context) (Plan, error)
 	GetExchangeByID(ctx context.Context, id string) (GetExchangeByIDRow, error)
+	GetExchangeByIDAndUser(ctx context.Context, arg GetExchangeByIDAndUserParams) (GetExchangeByIDAndUserRow, error)
 	GetExpiredSubscriptions(ctx context.Context) ([]Subscription, error)
 	GetExpiringSubscriptions(ctx context.Context, currentPeriodEnd pgtype.Timestamptz) ([]Subscription, error)
 	GetHistoryEntryByID(ctx context.Context, arg GetHistoryEntryByIDParams) (UserHistory, error)
 	GetHistoryStats(ctx context.Context, userID int64) (GetHistoryStatsRow, error)
 	GetLatestAuditLogByUserAndAction(ctx context.Context, arg GetLatestAuditLogByUserAndActionParams) (AuditLog, error)
+	GetMonthlyUsage(ctx context.Context, arg GetMonthlyUsageParams) (MonthlyUsage, error)
 	GetNextInvoiceID(ctx context.Context) (int32, error)
 	GetPaymentByID(ctx context.Context, id int64) (Payment, error)
 	GetPaymentByInvoiceID(ctx context.Context, invoiceID int64) (Payment, error)
@@ -96,6 +103,7 @@ type Querier interface {
 	GetPlanBySlug(ctx context.Context, slug string) (Plan, error)
 	GetReservedDomainByID(ctx context.Context, id int64) (ReservedDomain, error)
 	GetReservedDomainBySubdomain(ctx context.Context, subdomain string) (ReservedDomain, error)
+	GetRotatedSessionByTokenHash(ctx context.Context, refreshTokenHash string) (GetRotatedSessionByTokenHashRow, error)
 	GetSessionByTokenHash(ctx context.Context, refreshTokenHash string) (Session, error)
 	GetSessionsByUserID(ctx context.Context, userID int64) ([]Session, error)
 	GetSetting(ctx context.Context, arg GetSettingParams) (string, error)
@@ -107,6 +115,7 @@ type Querier interface {
 	GetTOTPByUserID(ctx context.Context, userID int64) (TotpSecret, error)
 	GetUserByEmail(ctx context.Context, email pgtype.Text) (User, error)
 	GetUserByGitHubID(ctx context.Context, githubID pgtype.Int8) (User, error)
+	GetUserByGitLabID(ctx context.Context, gitlabID pgtype.Int8) (User, error)
 	GetUserByGoogleID(ctx context.Context, googleID pgtype.Text) (User, error)
 	GetUserByID(ctx context.Context, id int64) (User, error)
 	GetUserByPhone(ctx context.Context, phone pgtype.Text) (User, error)
@@ -116,8 +125,10 @@ type Querier interface {
 	IsSubdomainOwnedByUser(ctx context.Context, arg IsSubdomainOwnedByUserParams) (bool, error)
 	IsTOTPEnabled(ctx context.Context, userID int64) (bool, error)
 	LinkGitHub(ctx context.Context, arg LinkGitHubParams) error
+	LinkGitLab(ctx context.Context, arg LinkGitLabParams) error
 	LinkGoogle(ctx context.Context, arg LinkGoogleParams) error
 	ListAPITokensByUserID(ctx context.Context, userID int64) ([]ApiToken, error)
+	ListActiveReservedDomains(ctx context.Context) ([]ReservedDomain, error)
 	ListAllCustomDomains(ctx context.Context, arg ListAllCustomDomainsParams) ([]CustomDomain, error)
 	ListAllPayments(ctx context.Context, arg ListAllPaymentsParams) ([]Payment, error)
 	ListAllPlans(ctx context.Context, arg ListAllPlansParams) ([]Plan, error)
@@ -138,10 +149,14 @@ type Querier interface {
 	ListSubscriptionsByUserID(ctx context.Context, userID int64) ([]Subscription, error)
 	ListUsersFiltered(ctx context.Context, arg ListUsersFilteredParams) ([]User, error)
 	ListVerifiedCustomDomains(ctx context.Context) ([]CustomDomain, error)
+	LockReservedDomainOwner(ctx context.Context, id int64) error
+	PruneHistoryBefore(ctx context.Context, arg PruneHistoryBeforeParams) (int64, error)
+	PruneHistoryExcess(ctx context.Context, arg PruneHistoryExcessParams) (int64, error)
 	SaveExchange(ctx context.Context, arg SaveExchangeParams) error
 	SetCustomDomainVerificationToken(ctx context.Context, arg SetCustomDomainVerificationTokenParams) error
 	SetCustomDomainVerified(ctx context.Context, arg SetCustomDomainVerifiedParams) error
 	SetFirstTunnelAt(ctx context.Context, arg SetFirstTunnelAtParams) (int64, error)
+	SetUserEmailVerified(ctx context.Context, arg SetUserEmailVerifiedParams) (int64, error)
 	UpdateAPITokenLastUsed(ctx context.Context, id int64) error
 	UpdateBundle(ctx context.Context, arg UpdateBundleParams) error
 	UpdateHistoryEntry(ctx context.Context, arg UpdateHistoryEntryParams) error
@@ -160,6 +175,7 @@ type Querier interface {
 	UpsertSetting(ctx context.Context, arg UpsertSettingParams) error
 	UpsertSettingIfNewer(ctx context.Context, arg UpsertSettingIfNewerParams) error
 	UpsertTLSCertificate(ctx context.Context, arg UpsertTLSCertificateParams) (int64, error)
+	VerifyUserEmail(ctx context.Context, arg VerifyUserEmailParams) (int64, error)
 }
 
 var _ Querier = (*Queries)(nil)
@@ -11,9 +11,31 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const createRotatedSession = `-- name: CreateRotatedSession :exec
+INSERT INTO sessions (user_id, refresh_token_hash, family_id, expires_at, rotated_at)
+VALUES ($1, $2, $3, $4, NOW())
+`
+
+type CreateRotatedSessionParams struct {
+	UserID           int64              `json:"user_id"`
+	RefreshTokenHash string             `json:"refresh_token_hash"`
+	FamilyID         string             `json:"family_id"`
+	ExpiresAt        pgtype.Timestamptz `json:"expires_at"`
+}
+
+func (q *Queries) CreateRotatedSession(ctx context.Context, arg CreateRotatedSessionParams) error {
+	_, err := q.db.Exec(ctx, createRotatedSession,
+		arg.UserID,
+		arg.RefreshTokenHash,
+		arg.FamilyID,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
 const createSession = `-- name: CreateSession :one
-INSERT INTO sessions (user_id, refresh_token_hash, user_agent, ip_address, expires_at)
-VALUES ($1, $2, $3, $4, $5)
+INSERT INTO sessions (user_id, refresh_token_hash, user_agent, ip_address, expires_at, family_id)
+VALUES ($1, $2, $3, $4, $5, $6)
 RETURNING id, created_at
 `
 
@@ -23,6 +45,7 @@ type CreateSessionParams struct {
 	UserAgent        pgtype.Text        `json:"user_agent"`
 	IpAddress        pgtype.Text        `json:"ip_address"`
 	ExpiresAt        pgtype.Timestamptz `json:"expires_at"`
+	FamilyID         string             `json:"family_id"`
 }
 
 type CreateSessionRow struct {
@@ -37,6 +60,7 @@ func (q *Queries) CreateSession(ctx context.Context, arg CreateSessionParams) (C
 		arg.UserAgent,
 		arg.IpAddress,
 		arg.ExpiresAt,
+		arg.FamilyID,
 	)
 	var i CreateSessionRow
 	err := row.Scan(&i.ID, &i.CreatedAt)
@@ -65,7 +89,7 @@ func (q *Queries) DeleteSession(ctx context.Context, id int64) error {
 }
 
 const deleteSessionByTokenHash = `-- name: DeleteSessionByTokenHash :exec
-DELETE FROM sessions WHERE refresh_token_hash = $1
+DELETE FROM sessions WHERE refresh_token_hash = $1 AND rotated_at IS NULL
 `
 
 func (q *Queries) DeleteSessionByTokenHash(ctx context.Context, refreshTokenHash string) error {
@@ -73,8 +97,22 @@ func (q *Queries) DeleteSessionByTokenHash(ctx context.Context, refreshTokenHash
 	return err
 }
 
+const deleteSessionsByFamily = `-- name: DeleteSessionsByFamily :exec
+DELETE FROM sessions WHERE user_id = $1 AND family_id = $2 AND rotated_at IS NULL
+`
+
+type DeleteSessionsByFamilyParams struct {
+	UserID   int64  `json:"user_id"`
+	FamilyID string `json:"family_id"`
+}
+
+func (q *Queries) DeleteSessionsByFamily(ctx context.Context, arg DeleteSessionsByFamilyParams) error {
+	_, err := q.db.Exec(ctx, deleteSessionsByFamily, arg.UserID, arg.FamilyID)
+	return err
+}
+
 const deleteSessionsByUserID = `-- name: DeleteSessionsByUserID :exec
-DELETE FROM sessions WHERE user_id = $1
+DELETE FROM sessions WHERE user_id = $1 AND rotated_at IS NULL
 `
 
 func (q *Queries) DeleteSessionsByUserID(ctx context.Context, userID int64) error {
@@ -82,9 +120,27 @@ func (q *Queries) DeleteSessionsByUserID(ctx context.Context, userID int64) erro
 	return err
 }
 
+const getRotatedSessionByTokenHash = `-- name: GetRotatedSessionByTokenHash :one
+SELECT user_id, family_id FROM sessions
+WHERE refresh_token_hash = $1 AND rotated_at IS NOT NULL
+ORDER BY rotated_at DESC LIMIT 1
+`
+
+type GetRotatedSessionByTokenHashRow struct {
+	UserID   int64  `json:"user_id"`
+	FamilyID string `json:"family_id"`
+}
+
+func (q *Queries) GetRotatedSessionByTokenHash(ctx context.Context, refreshTokenHash string) (GetRotatedSessionByTokenHashRow, error) {
+	row := q.db.QueryRow(ctx, getRotatedSessionByTokenHash, refreshTokenHash)
+	var i GetRotatedSessionByTokenHashRow
+	err := row.Scan(&i.UserID, &i.FamilyID)
+	return i, err
+}
+
 const getSessionByTokenHash = `-- name: GetSessionByTokenHash :one
-SELECT id, user_id, refresh_token_hash, user_agent, ip_address, expires_at, created_at
-FROM sessions WHERE refresh_token_hash = $1
+SELECT id, user_id, refresh_token_hash, user_agent, ip_address, expires_at, created_at, family_id, rotated_at
+FROM sessions WHERE refresh_token_hash = $1 AND rotated_at IS NULL
 `
 
 func (q *Queries) GetSessionByTokenHash(ctx context.Context, refreshTokenHash string) (Session, error) {
@@ -98,13 +154,15 @@ func (q *Queries) GetSessionByTokenHash(ctx context.Context, refreshTokenHash st
 		&i.IpAddress,
 		&i.ExpiresAt,
 		&i.CreatedAt,
+		&i.FamilyID,
+		&i.RotatedAt,
 	)
 	return i, err
 }
 
 const getSessionsByUserID = `-- name: GetSessionsByUserID :many
-SELECT id, user_id, refresh_token_hash, user_agent, ip_address, expires_at, created_at
-FROM sessions WHERE user_id = $1 ORDER BY created_at DESC
+SELECT id, user_id, refresh_token_hash, user_agent, ip_address, expires_at, created_at, family_id, rotated_at
+FROM sessions WHERE user_id = $1 AND rotated_at IS NULL ORDER BY created_at DESC
 `
 
 func (q *Queries) GetSessionsByUserID(ctx context.Context, userID int64) ([]Session, error) {
@@ -124,6 +182,8 @@ func (q *Queries) GetSessionsByUserID(ctx context.Context, userID int64) ([]Sess
 			&i.IpAddress,
 			&i.ExpiresAt,
 			&i.CreatedAt,
+			&i.FamilyID,
+			&i.RotatedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -47,8 +47,8 @@ func (q *Queries) CountUsersFiltered(ctx context.Context, arg CountUsersFiltered
 }
 
 const createOAuthUser = `-- name: CreateOAuthUser :one
-INSERT INTO users (phone, password_hash, display_name, is_admin, is_active, github_id, google_id, email, avatar_url, plan_id, created_at)
-VALUES ($1, '', $2, $3, $4, $5, $6, $7, $8, $9, NOW())
+INSERT INTO users (phone, password_hash, display_name, is_admin, is_active, github_id, google_id, gitlab_id, email, avatar_url, plan_id, created_at)
+VALUES ($1, '', $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW())
 RETURNING id, created_at
 `
 
@@ -59,6 +59,7 @@ type CreateOAuthUserParams struct {
 	IsActive    bool        `json:"is_active"`
 	GithubID    pgtype.Int8 `json:"github_id"`
 	GoogleID    pgtype.Text `json:"google_id"`
+	GitlabID    pgtype.Int8 `json:"gitlab_id"`
 	Email       pgtype.Text `json:"email"`
 	AvatarUrl   pgtype.Text `json:"avatar_url"`
 	PlanID      pgtype.Int8 `json:"plan_id"`
@@ -77,6 +78,7 @@ func (q *Queries) CreateOAuthUser(ctx context.Context, arg CreateOAuthUserParams
 		arg.IsActive,
 		arg.GithubID,
 		arg.GoogleID,
+		arg.GitlabID,
 		arg.Email,
 		arg.AvatarUrl,
 		arg.PlanID,
@@ -130,7 +132,7 @@ func (q *Queries) DeleteUser(ctx context.Context, id int64) error {
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, phone, password_hash, display_name, is_admin, is_active, created_at, last_login_at, github_id, email, avatar_url, google_id, plan_id, first_tunnel_at
+SELECT id, phone, password_hash, display_name, is_admin, is_active, created_at, last_login_at, github_id, email, avatar_url, google_id, plan_id, first_tunnel_at, gitlab_id, email_verified
 FROM users WHERE email = $1
 `
 
@@ -152,12 +154,14 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email pgtype.Text) (User,
 		&i.GoogleID,
 		&i.PlanID,
 		&i.FirstTunnelAt,
+		&i.GitlabID,
+		&i.EmailVerified,
 	)
 	return i, err
 }
 
 const getUserByGitHubID = `-- name: GetUserByGitHubID :one
-SELECT id, phone, password_hash, display_name, is_admin, is_active, created_at, last_login_at, github_id, email, avatar_url, google_id, plan_id, first_tunnel_at
+SELECT id, phone, password_hash, display_name, is_admin, is_active, created_at, last_login_at, github_id, email, avatar_url, google_id, plan_id, first_tunnel_at, gitlab_id, email_verified
 FROM users WHERE github_id = $1
 `
 
@@ -179,12 +183,43 @@ func (q *Queries) GetUserByGitHubID(ctx context.Context, githubID pgtype.Int8) (
 		&i.GoogleID,
 		&i.PlanID,
 		&i.FirstTunnelAt,
+		&i.GitlabID,
+		&i.EmailVerified,
+	)
+	return i, err
+}
+
+const getUserByGitLabID = `-- name: GetUserByGitLabID :one
+SELECT id, phone, password_hash, display_name, is_admin, is_active, created_at, last_login_at, github_id, email, avatar_url, google_id, plan_id, first_tunnel_at, gitlab_id, email_verified
+FROM users WHERE gitlab_id = $1
+`
+
+func (q *Queries) GetUserByGitLabID(ctx context.Context, gitlabID pgtype.Int8) (User, error) {
+	row := q.db.QueryRow(ctx, getUserByGitLabID, gitlabID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Phone,
+		&i.PasswordHash,
+		&i.DisplayName,
+		&i.IsAdmin,
+		&i.IsActive,
+		&i.CreatedAt,
+		&i.LastLoginAt,
+		&i.GithubID,
+		&i.Email,
+		&i.AvatarUrl,
+		&i.GoogleID,
+		&i.PlanID,
+		&i.FirstTunnelAt,
+		&i.GitlabID,
+		&i.EmailVerified,
 	)
 	return i, err
 }
 
 const getUserByGoogleID = `-- name: GetUserByGoogleID :one
-SELECT id, phone, password_hash, display_name, is_admin, is_active, created_at, last_login_at, github_id, email, avatar_url, google_id, plan_id, first_tunnel_at
+SELECT id, phone, password_hash, display_name, is_admin, is_active, created_at, last_login_at, github_id, email, avatar_url, google_id, plan_id, first_tunnel_at, gitlab_id, email_verified
 FROM users WHERE google_id = $1
 `
 
@@ -206,12 +241,14 @@ func (q *Queries) GetUserByGoogleID(ctx context.Context, googleID pgtype.Text) (
 		&i.GoogleID,
 		&i.PlanID,
 		&i.FirstTunnelAt,
+		&i.GitlabID,
+		&i.EmailVerified,
 	)
 	return i, err
 }
 
 const getUserByID = `-- name: GetUserByID :one
-SELECT id, phone, password_hash, display_name, is_admin, is_active, created_at, last_login_at, github_id, email, avatar_url, google_id, plan_id, first_tunnel_at
+SELECT id, phone, password_hash, display_name, is_admin, is_active, created_at, last_login_at, github_id, email, avatar_url, google_id, plan_id, first_tunnel_at, gitlab_id, email_verified
 FROM users WHERE id = $1
 `
 
@@ -233,12 +270,14 @@ func (q *Queries) GetUserByID(ctx context.Context, id int64) (User, error) {
 		&i.GoogleID,
 		&i.PlanID,
 		&i.FirstTunnelAt,
+		&i.GitlabID,
+		&i.EmailVerified,
 	)
 	return i, err
 }
 
 const getUserByPhone = `-- name: GetUserByPhone :one
-SELECT id, phone, password_hash, display_name, is_admin, is_active, created_at, last_login_at, github_id, email, avatar_url, google_id, plan_id, first_tunnel_at
+SELECT id, phone, password_hash, display_name, is_admin, is_active, created_at, last_login_at, github_id, email, avatar_url, google_id, plan_id, first_tunnel_at, gitlab_id, email_verified
 FROM users WHERE phone = $1
 `
 
@@ -260,6 +299,8 @@ func (q *Queries) GetUserByPhone(ctx context.Context, phone pgtype.Text) (User,
 		&i.GoogleID,
 		&i.PlanID,
 		&i.FirstTunnelAt,
+		&i.GitlabID,
+		&i.EmailVerified,
 	)
 	return i, err
 }
@@ -297,7 +338,7 @@ func (q *Queries) GetUserStats(ctx context.Context, search pgtype.Text) (GetUser
 }
 
 const getUsersByIDs = `-- name: GetUsersByIDs :many
-SELECT id, phone, password_hash, display_name, is_admin, is_active, created_at, last_login_at, github_id, email, avatar_url, google_id, plan_id, first_tunnel_at
+SELECT id, phone, password_hash, display_name, is_admin, is_active, created_at, last_login_at, github_id, email, avatar_url, google_id, plan_id, first_tunnel_at, gitlab_id, email_verified
 FROM users WHERE id = ANY($1::bigint[])
 `
 
@@ -325,6 +366,8 @@ func (q *Queries) GetUsersByIDs(ctx context.Context, dollar_1 []int64) ([]User,
 			&i.GoogleID,
 			&i.PlanID,
 			&i.FirstTunnelAt,
+			&i.GitlabID,
+			&i.EmailVerified,
 		); err != nil {
 			return nil, err
 		}
@@ -360,6 +403,30 @@ func (q *Queries) LinkGitHub(ctx context.Context, arg LinkGitHubParams) error {
 	return err
 }
 
+const linkGitLab = `-- name: LinkGitLab :exec
+UPDATE users SET gitlab_id = $2,
+    email = COALESCE(NULLIF(email, ''), $3),
+    avatar_url = COALESCE(NULLIF(avatar_url, ''), $4)
+WHERE id = $1
+`
+
+type LinkGitLabParams struct {
+	ID        int64       `json:"id"`
+	GitlabID  pgtype.Int8 `json:"gitlab_id"`
+	Email     pgtype.Text `json:"email"`
+	AvatarUrl pgtype.Text `json:"avatar_url"`
+}
+
+func (q *Queries) LinkGitLab(ctx context.Context, arg LinkGitLabParams) error {
+	_, err := q.db.Exec(ctx, linkGitLab,
+		arg.ID,
+		arg.GitlabID,
+		arg.Email,
+		arg.AvatarUrl,
+	)
+	return err
+}
+
 const linkGoogle = `-- name: LinkGoogle :exec
 UPDATE users SET google_id = $2,
     email = COALESCE(NULLIF(email, ''), $3),
@@ -385,7 +452,7 @@ func (q *Queries) LinkGoogle(ctx context.Context, arg LinkGoogleParams) error {
 }
 
 const listUsersFiltered = `-- name: ListUsersFiltered :many
-SELECT id, phone, password_hash, display_name, is_admin, is_active, created_at, last_login_at, github_id, email, avatar_url, google_id, plan_id, first_tunnel_at
+SELECT id, phone, password_hash, display_name, is_admin, is_active, created_at, last_login_at, github_id, email, avatar_url, google_id, plan_id, first_tunnel_at, gitlab_id, email_verified
 FROM users
 WHERE ($3::boolean IS NULL OR is_active = $3)
   AND ($4::boolean IS NULL OR is_admin = $4)
@@ -434,6 +501,8 @@ func (q *Queries) ListUsersFiltered(ctx context.Context, arg ListUsersFilteredPa
 			&i.GoogleID,
 			&i.PlanID,
 			&i.FirstTunnelAt,
+			&i.GitlabID,
+			&i.EmailVerified,
 		); err != nil {
 			return nil, err
 		}
@@ -445,6 +514,23 @@ func (q *Queries) ListUsersFiltered(ctx context.Context, arg ListUsersFilteredPa
 	return items, nil
 }
 
+const setUserEmailVerified = `-- name: SetUserEmailVerified :execrows
+UPDATE users SET email_verified = TRUE WHERE id = $1 AND LOWER(email) = LOWER($2)
+`
+
+type SetUserEmailVerifiedParams struct {
+	ID    int64  `json:"id"`
+	Lower string `json:"lower"`
+}
+
+func (q *Queries) SetUserEmailVerified(ctx context.Context, arg SetUserEmailVerifiedParams) (int64, error) {
+	result, err := q.db.Exec(ctx, setUserEmailVerified, arg.ID, arg.Lower)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const setFirstTunnelAt = `-- name: SetFirstTunnelAt :execrows
 UPDATE users SET first_tunnel_at = $2 WHERE id = $1 AND first_tunnel_at IS NULL
 `
@@ -489,7 +575,7 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) error {
 }
 
 const updateUserEmail = `-- name: UpdateUserEmail :exec
-UPDATE users SET email = $2 WHERE id = $1
+UPDATE users SET email = $2, email_verified = FALSE WHERE id = $1
 `
 
 type UpdateUserEmailParams struct {
@@ -552,3 +638,20 @@ func (q *Queries) UpdateUserPlan(ctx context.Context, arg UpdateUserPlanParams)
 	_, err := q.db.Exec(ctx, updateUserPlan, arg.ID, arg.PlanID)
 	return err
 }
+
+const verifyUserEmail = `-- name: VerifyUserEmail :execrows
+UPDATE users SET email = $2, email_verified = TRUE WHERE id = $1
+`
+
+type VerifyUserEmailParams struct {
+	ID    int64       `json:"id"`
+	Email pgtype.Text `json:"email"`
+}
+
+func (q *Queries) VerifyUserEmail(ctx context.Context, arg VerifyUserEmailParams) (int64, error) {
+	result, err := q.db.Exec(ctx, verifyUserEmail, arg.ID, arg.Email)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
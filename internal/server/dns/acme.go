@@ -0,0 +1,47 @@
+package dns
+
+import (
+	"context"
+	"slices"
+	"strings"
+)
+
+// Present publishes an ACME DNS-01 challenge value as a TXT record at fqdn,
+// making the server usable as the certificate manager's DNS provider. The
+// record is answered at once, so there is no propagation delay.
+func (s *Server) Present(_ context.Context, fqdn, value string) error {
+	name := challengeName(fqdn)
+	s.challengeMu.Lock()
+	defer s.challengeMu.Unlock()
+	if s.challenges == nil {
+		s.challenges = make(map[string][]string)
+	}
+	s.challenges[name] = append(s.challenges[name], value)
+	return nil
+}
+
+// CleanUp removes a challenge value published by Present.
+func (s *Server) CleanUp(_ context.Context, fqdn, value string) error {
+	name := challengeName(fqdn)
+	s.challengeMu.Lock()
+	defer s.challengeMu.Unlock()
+	values := slices.DeleteFunc(s.challenges[name], func(v string) bool { return v == value })
+	if len(values) == 0 {
+		delete(s.challenges, name)
+	} else {
+		s.challenges[name] = values
+	}
+	return nil
+}
+
+// challengeValues returns the challenge values published at qName.
+func (s *Server) challengeValues(qName string) []string {
+	s.challengeMu.Lock()
+	defer s.challengeMu.Unlock()
+	return slices.Clone(s.challenges[qName])
+}
+
+// challengeName normalizes fqdn like handle does query names.
+func challengeName(fqdn string) string {
+	return strings.ToLower(strings.TrimSuffix(fqdn, ".")) + "."
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/miekg/dns"
@@ -42,6 +43,10 @@ type Server struct {
 	log       zerolog.Logger
 	udpServer *dns.Server
 	tcpServer *dns.Server
+
+	// ACME DNS-01 challenge values by query name, see Present
+	challengeMu sync.Mutex
+	challenges  map[string][]string
 }
 
 // New constructs a DNS server, loading and validating the zone file.
@@ -138,6 +143,21 @@ func (s *Server) handle(w dns.ResponseWriter, r *dns.Msg) {
 		m.Answer = append(m.Answer, buildSOA(zone))
 	}
 
+	// ACME challenge records are short-lived, so they get a short TTL.
+	if q.Qtype == dns.TypeTXT || q.Qtype == dns.TypeANY {
+		for _, value := range s.challengeValues(qName) {
+			m.Answer = append(m.Answer, &dns.TXT{
+				Hdr: dns.RR_Header{
+					Name:   q.Name,
+					Rrtype: dns.TypeTXT,
+					Class:  dns.ClassINET,
+					Ttl:    10,
+				},
+				Txt: splitTXT(value),
+			})
+		}
+	}
+
 	// Dynamic tunnel lookup. Only consult the registry for actual subdomains
 	// (not the apex) and only when the zone enables tunnels.
 	if zone.TunnelsEnabled && subdomain != "" {
@@ -254,6 +254,7 @@ const (
 	TemplatePlanChanged             = "plan_changed"
 	TemplatePaymentSuccess          = "payment_success"
 	TemplatePaymentFailed           = "payment_failed"
+	TemplateEmailVerification       = "email_verification"
 )
 
 // TemplateData holds data for email templates
@@ -271,14 +272,21 @@ type TemplateData struct {
 	CheckoutURL     string
 	SupportEmail    string
 	ErrorMessage    string
+	VerifyURL       string // Email verification link
 }
 
 // LocalizedTemplateName returns the template name for the given language.
-// For "en" it appends "_en" suffix, otherwise returns the base name (Russian).
+// For "en", or another language a template was loaded for, it appends the
+// "_<lang>" suffix, otherwise returns the base name (Russian).
 func LocalizedTemplateName(base, lang string) string {
 	if lang == "en" {
 		return base + "_en"
 	}
+	if lang != "" && lang != defaultLang {
+		if _, ok := templates[base+"_"+lang]; ok {
+			return base + "_" + lang
+		}
+	}
 	return base
 }
 
@@ -422,6 +430,13 @@ func init() {
             </div>
             {{if .DashboardURL}}<a href="{{.DashboardURL}}" class="button">Перейти в личный кабинет</a>{{end}}` + emailFooterRU))
 
+	templates[TemplateEmailVerification] = template.Must(template.New("email_verification").Parse(emailHead + `
+            <h2><span class="status-dot dot-success"></span>Подтвердите email</h2>
+            <p>Здравствуйте{{if .UserName}}, {{.UserName}}{{end}}!</p>
+            <p>Подтвердите, что адрес <strong>{{.UserEmail}}</strong> принадлежит вам. Ссылка действует 24 часа.</p>
+            <p>Если вы не указывали этот адрес, просто проигнорируйте письмо.</p>
+            {{if .VerifyURL}}<a href="{{.VerifyURL}}" class="button">Подтвердить email</a>{{end}}` + emailFooterRU))
+
 	// ── English templates ──────────────────────────────────────────────
 
 	templates[TemplateSubscriptionExpiring+"_en"] = template.Must(template.New("subscription_expiring_en").Parse(emailHead + `
@@ -484,6 +499,13 @@ func init() {
                 </div>
             </div>
             {{if .DashboardURL}}<a href="{{.DashboardURL}}" class="button">Go to Dashboard</a>{{end}}` + emailFooterEN))
+
+	templates[TemplateEmailVerification+"_en"] = template.Must(template.New("email_verification_en").Parse(emailHead + `
+            <h2><span class="status-dot dot-success"></span>Verify your email</h2>
+            <p>Hello{{if .UserName}}, {{.UserName}}{{end}}!</p>
+            <p>Confirm that <strong>{{.UserEmail}}</strong> is your address. The link is valid for 24 hours.</p>
+            <p>If you did not enter this address, you can ignore this email.</p>
+            {{if .VerifyURL}}<a href="{{.VerifyURL}}" class="button">Verify Email</a>{{end}}` + emailFooterEN))
 }
 
 // RenderTemplate renders an email template with data
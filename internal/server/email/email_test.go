@@ -1,6 +1,9 @@
 package email
 
 import (
+	"html/template"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/rs/zerolog"
@@ -375,6 +378,27 @@ func TestRenderTemplate_PlanChanged_EN(t *testing.T) {
 	}
 }
 
+func TestRenderTemplate_EmailVerification(t *testing.T) {
+	data := TemplateData{
+		UserName:  "Eve",
+		UserEmail: "eve@example.com",
+		VerifyURL: "https://fxtun.dev/api/auth/verify-email?token=abc",
+	}
+
+	for _, lang := range []string{"ru", "en"} {
+		html, err := RenderTemplate(LocalizedTemplateName(TemplateEmailVerification, lang), data)
+		if err != nil {
+			t.Fatalf("RenderTemplate(%s) error: %v", lang, err)
+		}
+		if !contains(html, "eve@example.com") {
+			t.Errorf("Expected %s HTML to contain the address", lang)
+		}
+		if !contains(html, "verify-email?token=abc") {
+			t.Errorf("Expected %s HTML to contain the verification link", lang)
+		}
+	}
+}
+
 func TestLocalizedTemplateName(t *testing.T) {
 	if LocalizedTemplateName("payment_success", "en") != "payment_success_en" {
 		t.Error("Expected _en suffix for English")
@@ -384,6 +408,78 @@ func TestLocalizedTemplateName(t *testing.T) {
 	}
 }
 
+// restoreTemplates puts the built-in templates back after a test loads
+// custom ones.
+func restoreTemplates(t *testing.T) {
+	saved := make(map[string]*template.Template, len(templates))
+	for name, tmpl := range templates {
+		saved[name] = tmpl
+	}
+	t.Cleanup(func() { templates = saved })
+}
+
+func TestLoadTemplates(t *testing.T) {
+	restoreTemplates(t)
+	dir := t.TempDir()
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(dir, "plan_changed.html"), "<p>Now on {{.NewPlanName}}</p>")
+	write(filepath.Join(dir, "de", "plan_changed.html"), "<p>Jetzt {{.NewPlanName}}</p>")
+	write(filepath.Join(dir, "notes.html"), "{{.Unknown}}")
+
+	n, err := LoadTemplates(dir)
+	if err != nil {
+		t.Fatalf("LoadTemplates failed: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("Expected 2 templates loaded, got %d", n)
+	}
+
+	html, err := RenderTemplate(TemplatePlanChanged, TemplateData{NewPlanName: "Pro"})
+	if err != nil || html != "<p>Now on Pro</p>" {
+		t.Errorf("Expected the custom template, got %q (%v)", html, err)
+	}
+	html, err = RenderTemplate(LocalizedTemplateName(TemplatePlanChanged, "de"), TemplateData{NewPlanName: "Pro"})
+	if err != nil || html != "<p>Jetzt Pro</p>" {
+		t.Errorf("Expected the German template, got %q (%v)", html, err)
+	}
+	html, err = RenderTemplate(LocalizedTemplateName(TemplatePaymentSuccess, "de"), TemplateData{PlanName: "Pro"})
+	if err != nil || !contains(html, "Оплата прошла успешно") {
+		t.Errorf("Expected the built-in template for a missing file, got %v", err)
+	}
+}
+
+func TestLoadTemplates_Invalid(t *testing.T) {
+	restoreTemplates(t)
+	for _, content := range []string{"{{if .UserName}}", "{{.Unknown}}"} {
+		dir := t.TempDir()
+		if err := os.MkdirAll(filepath.Join(dir, "en"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "en", "payment_success.html"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadTemplates(dir); err == nil {
+			t.Errorf("Expected an error for %q", content)
+		}
+	}
+	html, err := RenderTemplate(LocalizedTemplateName(TemplatePaymentSuccess, "en"), TemplateData{})
+	if err != nil || !contains(html, "Payment successful") {
+		t.Errorf("Expected the built-in template to stay after a failed load, got %v", err)
+	}
+
+	if _, err := LoadTemplates(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("Expected an error for a missing directory")
+	}
+}
+
 func TestFormatAmount(t *testing.T) {
 	tests := []struct {
 		amount   float64
@@ -1,11 +1,14 @@
 package email
 
 import (
+	"errors"
 	"fmt"
 	"math"
+	"net/url"
 
 	"github.com/rs/zerolog"
 
+	"github.com/mephistofox/fxtun.dev/internal/i18n"
 	"github.com/mephistofox/fxtun.dev/internal/server/database"
 	"github.com/mephistofox/fxtun.dev/internal/server/scheduler"
 )
@@ -33,7 +36,9 @@ func NewNotifier(email *Service, db *database.Database, baseURL, baseURLEN, supp
 }
 
 // detectLang determines the email language from the subscription's payment provider.
-// Creem subscriptions → English, everything else → Russian.
+// Creem subscriptions → English, everything else → Russian. It also picks the
+// currency and site of the email, while a user's own locale setting, when set,
+// overrides the language.
 func detectLang(sub *database.Subscription) string {
 	if sub == nil {
 		return "ru"
@@ -55,6 +60,15 @@ func detectLangByProvider(provider string) string {
 	return "ru"
 }
 
+// userLang returns the locale the user chose for server messages, or
+// fallback when they did not choose one.
+func (n *Notifier) userLang(userID int64, fallback string) string {
+	if l, err := n.db.UserSettings.Get(userID, i18n.UserSetting); err == nil && i18n.Supported(l) {
+		return l
+	}
+	return fallback
+}
+
 // getBaseURL returns the appropriate base URL for the language.
 func (n *Notifier) getBaseURL(lang string) string {
 	if lang == "en" && n.baseURLEN != "" {
@@ -93,8 +107,9 @@ func (n *Notifier) HandleSchedulerEvent(event scheduler.Event) {
 		return
 	}
 
-	lang := detectLang(event.Subscription)
-	base := n.getBaseURL(lang)
+	region := detectLang(event.Subscription)
+	lang := n.userLang(user.ID, region)
+	base := n.getBaseURL(region)
 
 	var subject string
 	var templateName string
@@ -109,67 +124,39 @@ func (n *Notifier) HandleSchedulerEvent(event scheduler.Event) {
 	if event.Plan != nil {
 		data.PlanName = event.Plan.Name
 		data.Amount = event.Plan.Price
-		data.FormattedAmount = formatAmount(event.Plan.Price, lang)
+		data.FormattedAmount = formatAmount(event.Plan.Price, region)
 	}
 
 	switch event.Type {
 	case scheduler.EventSubscriptionExpiring:
 		data.DaysLeft = event.DaysLeft
 		if event.Subscription != nil && event.Subscription.CurrentPeriodEnd != nil {
-			if lang == "en" {
-				data.ExpiresAt = event.Subscription.CurrentPeriodEnd.Format("Jan 2, 2006")
-			} else {
-				data.ExpiresAt = event.Subscription.CurrentPeriodEnd.Format("02.01.2006")
-			}
-		}
-		if lang == "en" {
-			subject = fmt.Sprintf("Your subscription expires in %d day(s)", event.DaysLeft)
-		} else {
-			subject = fmt.Sprintf("Подписка истекает через %d дн.", event.DaysLeft)
+			data.ExpiresAt = event.Subscription.CurrentPeriodEnd.Format(i18n.T(lang, "email.date_format"))
 		}
+		subject = i18n.T(lang, "email.subject.subscription_expiring", event.DaysLeft)
 		templateName = LocalizedTemplateName(TemplateSubscriptionExpiring, lang)
 
 	case scheduler.EventSubscriptionExpired:
-		if lang == "en" {
-			subject = "Your subscription has expired"
-		} else {
-			subject = "Подписка истекла"
-		}
+		subject = i18n.T(lang, "email.subject.subscription_expired")
 		templateName = LocalizedTemplateName(TemplateSubscriptionExpired, lang)
 
 	case scheduler.EventSubscriptionRenewed:
 		if event.Subscription != nil && event.Subscription.CurrentPeriodEnd != nil {
-			if lang == "en" {
-				data.RenewalDate = event.Subscription.CurrentPeriodEnd.Format("Jan 2, 2006")
-			} else {
-				data.RenewalDate = event.Subscription.CurrentPeriodEnd.Format("02.01.2006")
-			}
-		}
-		if lang == "en" {
-			subject = "Subscription renewed"
-		} else {
-			subject = "Подписка продлена"
+			data.RenewalDate = event.Subscription.CurrentPeriodEnd.Format(i18n.T(lang, "email.date_format"))
 		}
+		subject = i18n.T(lang, "email.subject.subscription_renewed")
 		templateName = LocalizedTemplateName(TemplateSubscriptionRenewed, lang)
 
 	case scheduler.EventSubscriptionRenewFailed:
 		if event.Error != nil {
 			data.ErrorMessage = event.Error.Error()
 		}
-		if lang == "en" {
-			subject = "Subscription renewal failed"
-		} else {
-			subject = "Ошибка продления подписки"
-		}
+		subject = i18n.T(lang, "email.subject.subscription_renew_failed")
 		templateName = LocalizedTemplateName(TemplateSubscriptionRenewFailed, lang)
 
 	case scheduler.EventPlanChanged:
 		data.NewPlanName = data.PlanName
-		if lang == "en" {
-			subject = "Plan changed"
-		} else {
-			subject = "Тариф изменён"
-		}
+		subject = i18n.T(lang, "email.subject.plan_changed")
 		templateName = LocalizedTemplateName(TemplatePlanChanged, lang)
 
 	default:
@@ -201,28 +188,22 @@ func (n *Notifier) SendPaymentSuccessNotification(userID int64, planName string,
 		return nil
 	}
 
-	lang := detectLangByProvider(provider)
-	base := n.getBaseURL(lang)
+	region := detectLangByProvider(provider)
+	lang := n.userLang(userID, region)
+	base := n.getBaseURL(region)
 
 	data := TemplateData{
 		UserName:        user.DisplayName,
 		UserEmail:       user.Email,
 		PlanName:        planName,
 		Amount:          amount,
-		FormattedAmount: formatAmount(amount, lang),
+		FormattedAmount: formatAmount(amount, region),
 		DashboardURL:    base + "/dashboard",
 		SupportEmail:    n.supportEmail,
 	}
 
-	var subject string
-	if lang == "en" {
-		subject = "Payment successful"
-	} else {
-		subject = "Оплата прошла успешно"
-	}
-
 	templateName := LocalizedTemplateName(TemplatePaymentSuccess, lang)
-	return n.email.SendTemplate(user.Email, subject, templateName, data)
+	return n.email.SendTemplate(user.Email, i18n.T(lang, "email.subject.payment_success"), templateName, data)
 }
 
 // SendExpirationReminder sends subscription expiration reminder
@@ -240,16 +221,13 @@ func (n *Notifier) SendExpirationReminder(sub *database.Subscription, plan *data
 		return nil
 	}
 
-	lang := detectLang(sub)
-	base := n.getBaseURL(lang)
+	region := detectLang(sub)
+	lang := n.userLang(user.ID, region)
+	base := n.getBaseURL(region)
 
 	expiresAt := ""
 	if sub.CurrentPeriodEnd != nil {
-		if lang == "en" {
-			expiresAt = sub.CurrentPeriodEnd.Format("Jan 2, 2006")
-		} else {
-			expiresAt = sub.CurrentPeriodEnd.Format("02.01.2006")
-		}
+		expiresAt = sub.CurrentPeriodEnd.Format(i18n.T(lang, "email.date_format"))
 	}
 
 	data := TemplateData{
@@ -262,13 +240,30 @@ func (n *Notifier) SendExpirationReminder(sub *database.Subscription, plan *data
 		SupportEmail: n.supportEmail,
 	}
 
-	var subject string
-	if lang == "en" {
-		subject = fmt.Sprintf("Your subscription expires in %d day(s)", daysLeft)
-	} else {
-		subject = fmt.Sprintf("Подписка истекает через %d дн.", daysLeft)
+	templateName := LocalizedTemplateName(TemplateSubscriptionExpiring, lang)
+	return n.email.SendTemplate(user.Email, i18n.T(lang, "email.subject.subscription_expiring", daysLeft), templateName, data)
+}
+
+// SendEmailVerification sends the user a link that verifies email with
+// token. The link goes to the API, which redirects to the profile.
+func (n *Notifier) SendEmailVerification(userID int64, email, token string) error {
+	if n.email == nil || !n.email.IsEnabled() {
+		return errors.New("email service disabled")
 	}
 
-	templateName := LocalizedTemplateName(TemplateSubscriptionExpiring, lang)
-	return n.email.SendTemplate(user.Email, subject, templateName, data)
+	user, err := n.db.Users.GetByID(userID)
+	if err != nil || user == nil {
+		return fmt.Errorf("get user: %w", err)
+	}
+
+	lang := n.userLang(userID, defaultLang)
+	data := TemplateData{
+		UserName:     user.DisplayName,
+		UserEmail:    email,
+		VerifyURL:    n.getBaseURL(lang) + "/api/auth/verify-email?token=" + url.QueryEscape(token),
+		SupportEmail: n.supportEmail,
+	}
+
+	templateName := LocalizedTemplateName(TemplateEmailVerification, lang)
+	return n.email.SendTemplate(email, i18n.T(lang, "email.subject.email_verification"), templateName, data)
 }
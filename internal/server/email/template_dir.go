@@ -0,0 +1,84 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// defaultLang is the language of the templates without a suffix.
+const defaultLang = "ru"
+
+// templateNames lists the templates a template directory may provide.
+var templateNames = []string{
+	TemplateSubscriptionExpiring,
+	TemplateSubscriptionExpired,
+	TemplateSubscriptionRenewed,
+	TemplateSubscriptionRenewFailed,
+	TemplatePlanChanged,
+	TemplatePaymentSuccess,
+	TemplatePaymentFailed,
+	TemplateEmailVerification,
+}
+
+// LoadTemplates replaces built-in templates with the files in dir and
+// returns how many it loaded. <dir>/<template>.html replaces the default
+// (Russian) template and <dir>/<lang>/<template>.html the one for lang;
+// templates without a file keep the built-in. Every file is parsed and
+// rendered with empty TemplateData before any is used, so a broken
+// template fails here rather than when an email is sent.
+func LoadTemplates(dir string) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, fmt.Errorf("read template dir: %w", err)
+	}
+
+	loaded := make(map[string]*template.Template)
+	if err := loadTemplateFiles(dir, "", loaded); err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			if err := loadTemplateFiles(filepath.Join(dir, entry.Name()), entry.Name(), loaded); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	for name, tmpl := range loaded {
+		templates[name] = tmpl
+	}
+	return len(loaded), nil
+}
+
+// loadTemplateFiles parses the templates for lang found in dir into loaded.
+func loadTemplateFiles(dir, lang string, loaded map[string]*template.Template) error {
+	for _, base := range templateNames {
+		path := filepath.Join(dir, base+".html")
+		data, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("read template: %w", err)
+		}
+
+		name := base
+		if lang != "" && lang != defaultLang {
+			name = base + "_" + lang
+		}
+		tmpl, err := template.New(name).Parse(string(data))
+		if err != nil {
+			return fmt.Errorf("parse template %s: %w", path, err)
+		}
+		if err := tmpl.Execute(io.Discard, TemplateData{}); err != nil {
+			return fmt.Errorf("render template %s: %w", path, err)
+		}
+		loaded[name] = tmpl
+	}
+	return nil
+}
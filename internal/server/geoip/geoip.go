@@ -62,6 +62,51 @@ func (l *Lookup) Close() error {
 	return nil
 }
 
+// ASNLookup provides autonomous system lookups using a GeoLite2-ASN style
+// MMDB database. The file is memory-mapped, so lookups do not touch disk.
+type ASNLookup struct {
+	db *maxminddb.Reader
+}
+
+// asnResult is the MMDB query structure for ASN lookups.
+type asnResult struct {
+	Number uint `maxminddb:"autonomous_system_number"`
+}
+
+// NewASN opens an ASN MMDB database file and returns an ASNLookup.
+func NewASN(dbPath string) (*ASNLookup, error) {
+	db, err := maxminddb.Open(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	return &ASNLookup{db: db}, nil
+}
+
+// ASN returns the autonomous system number of the given IP address.
+// Returns 0 if lookup fails or the ASNLookup is nil.
+func (l *ASNLookup) ASN(ipStr string) uint {
+	if l == nil || l.db == nil {
+		return 0
+	}
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		return 0
+	}
+	var r asnResult
+	if err := l.db.Lookup(ip, &r); err != nil {
+		return 0
+	}
+	return r.Number
+}
+
+// Close releases the MMDB database resources.
+func (l *ASNLookup) Close() error {
+	if l != nil && l.db != nil {
+		return l.db.Close()
+	}
+	return nil
+}
+
 // RegionMatchesCountry checks whether a node region matches a client's country code.
 // The region string is split on "-" and the first segment is used as the prefix
 // (e.g., "ru-msk" -> "ru", "eu-fra" -> "eu").
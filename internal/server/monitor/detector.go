@@ -26,6 +26,7 @@ type Alert struct {
 	TunnelID   string
 	TunnelType string
 	Message    string
+	Denied     int64 // cumulative denied requests, set for rate-limit alerts
 }
 
 // DetectionConfig holds thresholds for heuristic detection.
@@ -103,6 +104,7 @@ func Detect(m *TunnelMetrics, cfg DetectionConfig) []Alert {
 				"rate limit hit: %d denied, current rate %d",
 				m.DeniedCount(), m.CurrentRate(),
 			),
+			Denied: m.DeniedCount(),
 		})
 	}
 
@@ -84,6 +84,9 @@ func TestDetector_RateLimitAlert(t *testing.T) {
 	for _, a := range alerts {
 		if a.Type == AlertRateLimit {
 			found = true
+			if a.Denied != 1 {
+				t.Errorf("expected 1 denied, got %d", a.Denied)
+			}
 		}
 	}
 	if !found {
@@ -6,6 +6,8 @@ import (
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+
+	"github.com/mephistofox/fxtun.dev/internal/logging"
 )
 
 // AlertFunc is called when suspicious activity is detected.
@@ -46,7 +48,7 @@ func (m *Monitor) Stop() {
 func (m *Monitor) RegisterTunnel(tunnelID, tunnelType string, limits TunnelLimits) {
 	metrics := NewTunnelMetrics(tunnelID, tunnelType, limits)
 	m.tunnels.Store(tunnelID, metrics)
-	m.log.Info().Str("tunnel", tunnelID).Str("type", tunnelType).
+	m.log.Info().Str("tunnel_id", tunnelID).Str("type", tunnelType).
 		Int("tcp_limit", limits.TCPConnPerMin).Int("udp_limit", limits.UDPPacketsPerSec).Int("http_limit", limits.HTTPReqPerMin).
 		Msg("tunnel registered with monitor")
 }
@@ -81,7 +83,7 @@ func (m *Monitor) getOrCreateMetrics(tunnelID, tunnelType string) *TunnelMetrics
 func (m *Monitor) AllowTCPConnection(tunnelID, remoteAddr string) bool {
 	metrics := m.getOrCreateMetrics(tunnelID, "tcp")
 	if !metrics.AllowConnectionFromIP(remoteAddr) {
-		m.log.Warn().Str("tunnel", tunnelID).Str("remote", remoteAddr).Msg("TCP connection rate limited")
+		m.log.Warn().Str("tunnel_id", tunnelID).Str("remote_ip", logging.RemoteIP(remoteAddr)).Msg("TCP connection rate limited")
 		return false
 	}
 	metrics.RecordConnection(remoteAddr)
@@ -104,7 +106,7 @@ func (m *Monitor) AllowUDPPacket(tunnelID, remoteAddr string, size int) bool {
 func (m *Monitor) AllowHTTPRequest(tunnelID, remoteAddr string) bool {
 	metrics := m.getOrCreateMetrics(tunnelID, "http")
 	if !metrics.AllowConnectionFromIP(remoteAddr) {
-		m.log.Warn().Str("tunnel", tunnelID).Str("remote", remoteAddr).Msg("HTTP request rate limited")
+		m.log.Warn().Str("tunnel_id", tunnelID).Str("remote_ip", logging.RemoteIP(remoteAddr)).Msg("HTTP request rate limited")
 		return false
 	}
 	metrics.RecordConnection(remoteAddr)
@@ -151,7 +153,7 @@ func (m *Monitor) runDetection() {
 		alerts := Detect(metrics, m.cfg.Detection)
 		for _, alert := range alerts {
 			m.log.Warn().
-				Str("tunnel", alert.TunnelID).
+				Str("tunnel_id", alert.TunnelID).
 				Str("type", string(alert.Type)).
 				Str("severity", string(alert.Severity)).
 				Msg(alert.Message)
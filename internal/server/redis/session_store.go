@@ -3,6 +3,7 @@ package redis
 import (
 	"context"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -47,6 +48,7 @@ func (s *SessionStore) Create(session *database.Session) error {
 		"ip_address": session.IPAddress,
 		"created_at": session.CreatedAt.Format(time.RFC3339),
 		"expires_at": session.ExpiresAt.Format(time.RFC3339),
+		"family_id":  session.FamilyID,
 	}
 
 	pipe := rdb.Pipeline()
@@ -183,38 +185,58 @@ func (s *SessionStore) DeleteByUserID(userID int64) error {
 	return rdb.Del(ctx, userSetKey).Err()
 }
 
+// DeleteByFamily removes the sessions of one session family.
+func (s *SessionStore) DeleteByFamily(userID int64, familyID string) error {
+	sessions, err := s.GetByUserID(userID)
+	if err != nil {
+		return err
+	}
+	for _, sess := range sessions {
+		if sess.FamilyID != familyID {
+			continue
+		}
+		if err := s.DeleteByTokenHash(sess.RefreshTokenHash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // DeleteExpired is a no-op — Redis TTL handles expiration automatically.
 func (s *SessionStore) DeleteExpired() (int64, error) {
 	return 0, nil
 }
 
-// MarkRotated records a rotated refresh-token hash with the owning user, kept
-// for ttl so a later reuse of the same token can be detected.
-func (s *SessionStore) MarkRotated(tokenHash string, userID int64, ttl time.Duration) error {
+// MarkRotated records a rotated refresh-token hash with the owning user and
+// session family as "userID:familyID", kept for ttl so a later reuse of the
+// same token can be detected.
+func (s *SessionStore) MarkRotated(tokenHash string, userID int64, familyID string, ttl time.Duration) error {
 	if ttl <= 0 {
 		return nil
 	}
 	ctx := context.Background()
 	key := s.c.Key("session", "rotated", tokenHash)
-	return s.c.RDB().Set(ctx, key, strconv.FormatInt(userID, 10), ttl).Err()
+	return s.c.RDB().Set(ctx, key, strconv.FormatInt(userID, 10)+":"+familyID, ttl).Err()
 }
 
-// RotatedOwner returns the user a recently rotated token belonged to.
-func (s *SessionStore) RotatedOwner(tokenHash string) (int64, bool, error) {
+// RotatedOwner returns the user and session family a recently rotated token
+// belonged to. Tokens rotated before families existed have no family.
+func (s *SessionStore) RotatedOwner(tokenHash string) (int64, string, bool, error) {
 	ctx := context.Background()
 	key := s.c.Key("session", "rotated", tokenHash)
 	v, err := s.c.RDB().Get(ctx, key).Result()
 	if err == redis.Nil {
-		return 0, false, nil
+		return 0, "", false, nil
 	}
 	if err != nil {
-		return 0, false, err
+		return 0, "", false, err
 	}
-	userID, err := strconv.ParseInt(v, 10, 64)
+	uid, familyID, _ := strings.Cut(v, ":")
+	userID, err := strconv.ParseInt(uid, 10, 64)
 	if err != nil {
-		return 0, false, err
+		return 0, "", false, err
 	}
-	return userID, true, nil
+	return userID, familyID, true, nil
 }
 
 // parseSession converts a Redis hash map into a database.Session.
@@ -239,5 +261,6 @@ func parseSession(tokenHash string, vals map[string]string) (*database.Session,
 		IPAddress:        vals["ip_address"],
 		CreatedAt:        createdAt,
 		ExpiresAt:        expiresAt,
+		FamilyID:         vals["family_id"],
 	}, nil
 }
@@ -8,6 +8,8 @@ import (
 
 	goredis "github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog"
+
+	"github.com/mephistofox/fxtun.dev/internal/server/database"
 )
 
 func testSessionStore(t *testing.T) *SessionStore {
@@ -31,24 +33,54 @@ func TestSessionStore_RotatedTokenTracker(t *testing.T) {
 	s := testSessionStore(t)
 
 	// Unknown hash: not found.
-	if _, found, err := s.RotatedOwner("never-seen"); err != nil || found {
+	if _, _, found, err := s.RotatedOwner("never-seen"); err != nil || found {
 		t.Fatalf("unknown hash: found=%v err=%v", found, err)
 	}
 
 	// Mark then look up.
-	if err := s.MarkRotated("hash-a", 42, time.Minute); err != nil {
+	if err := s.MarkRotated("hash-a", 42, "family-a", time.Minute); err != nil {
 		t.Fatalf("mark: %v", err)
 	}
-	uid, found, err := s.RotatedOwner("hash-a")
-	if err != nil || !found || uid != 42 {
-		t.Fatalf("expected (42,true,nil), got (%d,%v,%v)", uid, found, err)
+	uid, family, found, err := s.RotatedOwner("hash-a")
+	if err != nil || !found || uid != 42 || family != "family-a" {
+		t.Fatalf("expected (42,family-a,true,nil), got (%d,%s,%v,%v)", uid, family, found, err)
+	}
+
+	// Values written before session families existed hold only the user.
+	if err := s.c.RDB().Set(context.Background(), s.c.Key("session", "rotated", "hash-old"), "9", time.Minute).Err(); err != nil {
+		t.Fatalf("set legacy: %v", err)
+	}
+	uid, family, found, err = s.RotatedOwner("hash-old")
+	if err != nil || !found || uid != 9 || family != "" {
+		t.Fatalf("expected (9,,true,nil), got (%d,%s,%v,%v)", uid, family, found, err)
 	}
 
 	// Non-positive TTL is a no-op (nothing recorded).
-	if err := s.MarkRotated("hash-b", 7, 0); err != nil {
+	if err := s.MarkRotated("hash-b", 7, "family-b", 0); err != nil {
 		t.Fatalf("mark ttl<=0: %v", err)
 	}
-	if _, found, _ := s.RotatedOwner("hash-b"); found {
+	if _, _, found, _ := s.RotatedOwner("hash-b"); found {
 		t.Fatal("expected ttl<=0 mark to be a no-op")
 	}
 }
+
+func TestSessionStore_DeleteByFamily(t *testing.T) {
+	s := testSessionStore(t)
+	expires := time.Now().Add(time.Hour)
+	for hash, family := range map[string]string{"laptop-1": "laptop", "laptop-2": "laptop", "phone-1": "phone"} {
+		if err := s.Create(&database.Session{UserID: 42, RefreshTokenHash: hash, FamilyID: family, ExpiresAt: expires}); err != nil {
+			t.Fatalf("create %s: %v", hash, err)
+		}
+	}
+
+	if err := s.DeleteByFamily(42, "laptop"); err != nil {
+		t.Fatalf("delete family: %v", err)
+	}
+	sessions, err := s.GetByUserID(42)
+	if err != nil {
+		t.Fatalf("get sessions: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].RefreshTokenHash != "phone-1" || sessions[0].FamilyID != "phone" {
+		t.Fatalf("expected only the phone session to remain, got %+v", sessions)
+	}
+}
@@ -0,0 +1,68 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"github.com/mephistofox/fxtun.dev/internal/server/database"
+)
+
+// domainsAdvisoryLockKey keeps the release of expired reservations to one
+// node at a time, so each release is logged and announced once.
+const domainsAdvisoryLockKey int64 = 0x6678_646f_6d6e // "fxdomn"
+
+// StartDomainMaintenance releases expired subdomain reservations on every
+// scheduler tick. Like StartHistoryMaintenance it runs whether or not
+// payments are enabled, and returns when ctx is cancelled.
+func (s *Scheduler) StartDomainMaintenance(ctx context.Context) {
+	s.releaseExpiredDomains()
+
+	ticker := time.NewTicker(s.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.releaseExpiredDomains()
+		}
+	}
+}
+
+// releaseExpiredDomains deletes the reservations whose expiry has passed and
+// emits EventDomainExpired for each. The tunnels still serving them are
+// closed by every node's reservation index, not here, as only the node
+// holding the lock sees the event. Nothing is released in dry-run mode.
+func (s *Scheduler) releaseExpiredDomains() {
+	if s.dryRun {
+		s.log.Debug().Msg("Dry run: skipping release of expired domain reservations")
+		return
+	}
+	s.withAdvisoryLock(domainsAdvisoryLockKey, func() {
+		domains, err := s.db.Domains.DeleteExpired()
+		if err != nil {
+			s.log.Error().Err(err).Msg("Failed to release expired domain reservations")
+			return
+		}
+
+		for _, d := range domains {
+			s.log.Info().
+				Int64("user_id", d.UserID).
+				Str("subdomain", d.Subdomain).
+				Str("event", string(EventDomainExpired)).
+				Msg("Released expired domain reservation")
+
+			_ = s.db.Audit.Log(&d.UserID, database.ActionDomainReleased, map[string]interface{}{
+				"subdomain": d.Subdomain,
+				"reason":    "expired",
+			}, "scheduler")
+
+			s.emit(Event{
+				Type:      EventDomainExpired,
+				UserID:    d.UserID,
+				Subdomain: d.Subdomain,
+			})
+		}
+	})
+}
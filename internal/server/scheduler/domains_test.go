@@ -0,0 +1,68 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+	"github.com/mephistofox/fxtun.dev/internal/server/database"
+)
+
+func TestScheduler_ReleaseExpiredDomains(t *testing.T) {
+	db := setupTestDB(t)
+	log := zerolog.New(zerolog.NewTestWriter(t))
+
+	freePlan, err := db.Plans.GetBySlug("free")
+	if err != nil {
+		t.Fatalf("Failed to get free plan: %v", err)
+	}
+	user := &database.User{
+		Phone:        "+79990005566",
+		PasswordHash: "hash",
+		PlanID:       freePlan.ID,
+		IsActive:     true,
+	}
+	if err := db.Users.Create(user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	for _, d := range []*database.ReservedDomain{
+		{UserID: user.ID, Subdomain: "expired", ExpiresAt: &past},
+		{UserID: user.ID, Subdomain: "later", ExpiresAt: &future},
+		{UserID: user.ID, Subdomain: "forever"},
+	} {
+		if err := db.Domains.Create(d); err != nil {
+			t.Fatalf("Failed to reserve %s: %v", d.Subdomain, err)
+		}
+	}
+
+	s := New(db, &config.ServerConfig{}, nil, log)
+	var events []Event
+	s.OnEvent(func(e Event) { events = append(events, e) })
+
+	s.releaseExpiredDomains()
+
+	if len(events) != 1 || events[0].Type != EventDomainExpired || events[0].Subdomain != "expired" {
+		t.Fatalf("Expected one domain_expired event for 'expired', got %+v", events)
+	}
+	if events[0].UserID != user.ID {
+		t.Errorf("Expected user ID %d, got %d", user.ID, events[0].UserID)
+	}
+
+	left, err := db.Domains.GetByUserID(user.ID)
+	if err != nil {
+		t.Fatalf("Failed to list domains: %v", err)
+	}
+	if len(left) != 2 {
+		t.Fatalf("Expected 2 reservations left, got %d", len(left))
+	}
+	for _, d := range left {
+		if d.Subdomain == "expired" {
+			t.Fatal("Expired reservation was not released")
+		}
+	}
+}
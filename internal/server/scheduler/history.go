@@ -0,0 +1,91 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+)
+
+// historyAdvisoryLockKey keeps history pruning to one node at a time. It is
+// separate from the subscription lock so the two jobs never block each other.
+const historyAdvisoryLockKey int64 = 0x6678_6869_7374 // "fxhist"
+
+const (
+	// historyPruneBatch bounds each delete statement so a large backlog (the
+	// first run after enabling retention) does not hold long locks.
+	historyPruneBatch = 5000
+	// historyPruneMaxBatches caps the work done per tick; anything left is
+	// picked up on the next one.
+	historyPruneMaxBatches = 100
+)
+
+// StartHistoryMaintenance prunes raw user history on every scheduler tick.
+// It runs independently of Start, which is only used when payments are
+// enabled, and returns when ctx is cancelled.
+func (s *Scheduler) StartHistoryMaintenance(ctx context.Context) {
+	s.log.Info().
+		Int("retention_days", s.cfg.History.RetentionDays).
+		Int("max_entries_per_user", s.cfg.History.MaxEntriesPerUser).
+		Msg("History maintenance started")
+
+	s.pruneHistory()
+
+	ticker := time.NewTicker(s.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.pruneHistory()
+		}
+	}
+}
+
+// pruneHistory applies the retention settings under the history advisory
+// lock. Pruned entries are rolled up into daily totals by the database.
+func (s *Scheduler) pruneHistory() {
+	h := s.cfg.History
+	if h.RetentionDays <= 0 && h.MaxEntriesPerUser <= 0 {
+		return
+	}
+	if s.dryRun {
+		s.log.Debug().Msg("Dry run: skipping user history pruning")
+		return
+	}
+
+	s.withAdvisoryLock(historyAdvisoryLockKey, func() {
+		var pruned int64
+		if h.RetentionDays > 0 {
+			before := time.Now().AddDate(0, 0, -h.RetentionDays)
+			pruned += s.pruneInBatches("retention", func() (int64, error) {
+				return s.db.UserHistory.PruneBefore(before, historyPruneBatch)
+			})
+		}
+		if h.MaxEntriesPerUser > 0 {
+			pruned += s.pruneInBatches("entry cap", func() (int64, error) {
+				return s.db.UserHistory.PruneExcess(h.MaxEntriesPerUser, historyPruneBatch)
+			})
+		}
+		if pruned > 0 {
+			s.log.Info().Int64("count", pruned).Msg("Pruned old user history")
+		}
+	})
+}
+
+// pruneInBatches calls prune until it removes less than a full batch.
+func (s *Scheduler) pruneInBatches(reason string, prune func() (int64, error)) int64 {
+	var total int64
+	for i := 0; i < historyPruneMaxBatches; i++ {
+		n, err := prune()
+		if err != nil {
+			s.log.Error().Err(err).Str("reason", reason).Msg("Failed to prune user history")
+			return total
+		}
+		total += n
+		if n < historyPruneBatch {
+			break
+		}
+	}
+	return total
+}
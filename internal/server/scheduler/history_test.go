@@ -0,0 +1,79 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+	"github.com/mephistofox/fxtun.dev/internal/server/database"
+)
+
+func TestScheduler_PruneHistoryKeepsTotals(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := &config.ServerConfig{
+		History: config.HistorySettings{RetentionDays: 30, MaxEntriesPerUser: 3},
+	}
+	log := zerolog.New(zerolog.NewTestWriter(t))
+
+	freePlan, err := db.Plans.GetBySlug("free")
+	if err != nil {
+		t.Fatalf("Failed to get free plan: %v", err)
+	}
+	user := &database.User{
+		Phone:        "+79990003344",
+		PasswordHash: "hash",
+		PlanID:       freePlan.ID,
+		IsActive:     true,
+	}
+	if err := db.Users.Create(user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	// Two sessions past retention, five recent ones (two over the cap) and
+	// one event that must not count as a connection.
+	now := time.Now()
+	var entries []*database.UserHistoryEntry
+	for _, age := range []int{90, 60, 5, 4, 3, 2, 1} {
+		entries = append(entries, &database.UserHistoryEntry{
+			TunnelType:    "http",
+			LocalPort:     3000,
+			ConnectedAt:   now.AddDate(0, 0, -age),
+			BytesSent:     100,
+			BytesReceived: 10,
+		})
+	}
+	if err := db.UserHistory.AddBulk(user.ID, entries); err != nil {
+		t.Fatalf("Failed to add history: %v", err)
+	}
+	if err := db.UserHistory.RecordEvent(user.ID, database.HistoryEventThrottled, "http", 3000, "", "rate limited"); err != nil {
+		t.Fatalf("Failed to record event: %v", err)
+	}
+
+	before, err := db.UserHistory.GetStats(user.ID)
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+
+	New(db, cfg, nil, log).pruneHistory()
+
+	count, err := db.UserHistory.Count(user.ID)
+	if err != nil {
+		t.Fatalf("Failed to count history: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("Expected 3 raw entries after pruning, got %d", count)
+	}
+
+	after, err := db.UserHistory.GetStats(user.ID)
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if *after != *before {
+		t.Errorf("Stats changed by pruning: before %+v, after %+v", before, after)
+	}
+	if after.TotalConnections != 7 || after.TotalBytesSent != 700 {
+		t.Errorf("Unexpected totals: %+v", after)
+	}
+}
@@ -25,6 +25,7 @@ const (
 	EventSubscriptionRenewed     EventType = "subscription_renewed"
 	EventSubscriptionRenewFailed EventType = "subscription_renew_failed"
 	EventPlanChanged             EventType = "plan_changed"
+	EventDomainExpired           EventType = "domain_expired"
 )
 
 // Event represents a scheduler event for notifications
@@ -35,6 +36,7 @@ type Event struct {
 	Plan         *database.Plan
 	DaysLeft     int
 	Error        error
+	Subdomain    string // reservation released by EventDomainExpired
 }
 
 // EventHandler is called when a scheduler event occurs
@@ -51,6 +53,10 @@ type Scheduler struct {
 	// Check intervals
 	checkInterval time.Duration
 
+	// dryRun logs what the checks would do instead of writing to the
+	// database, calling payment providers or emitting events
+	dryRun bool
+
 	// Deduplication for expiration reminders
 	sentReminders   map[int64]time.Time // subscription_id -> last reminder sent at
 	sentRemindersMu sync.Mutex
@@ -68,6 +74,12 @@ func New(db *database.Database, cfg *config.ServerConfig, providers *payment.Reg
 	}
 }
 
+// SetDryRun makes the scheduler only log what it would do. The checks still
+// read the database, so a dry run shows what a real one would change.
+func (s *Scheduler) SetDryRun(dryRun bool) {
+	s.dryRun = dryRun
+}
+
 // OnEvent registers an event handler
 func (s *Scheduler) OnEvent(handler EventHandler) {
 	s.handlers = append(s.handlers, handler)
@@ -84,6 +96,7 @@ func (s *Scheduler) emit(event Event) {
 func (s *Scheduler) Start(ctx context.Context) {
 	s.log.Info().
 		Dur("interval", s.checkInterval).
+		Bool("dry_run", s.dryRun).
 		Msg("Subscription scheduler started")
 
 	// Run immediately on start
@@ -112,9 +125,14 @@ const schedulerAdvisoryLockKey int64 = 0x6678_7363_6864 // "fxschd"
 // so that with multiple nodes only the lock holder runs them in a given tick.
 func (s *Scheduler) runChecks() {
 	s.log.Debug().Msg("Running subscription checks")
+	s.withAdvisoryLock(schedulerAdvisoryLockKey, s.runCheckSteps)
+}
 
+// withAdvisoryLock runs fn while holding the given Postgres advisory lock and
+// skips it when another node holds the lock.
+func (s *Scheduler) withAdvisoryLock(key int64, fn func()) {
 	if s.db == nil || s.db.Pool() == nil {
-		s.runCheckSteps()
+		fn()
 		return
 	}
 
@@ -128,7 +146,7 @@ func (s *Scheduler) runChecks() {
 
 	var locked bool
 	lockCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	err = conn.QueryRow(lockCtx, "SELECT pg_try_advisory_lock($1)", schedulerAdvisoryLockKey).Scan(&locked)
+	err = conn.QueryRow(lockCtx, "SELECT pg_try_advisory_lock($1)", key).Scan(&locked)
 	cancel()
 	if err != nil {
 		conn.Release()
@@ -146,7 +164,7 @@ func (s *Scheduler) runChecks() {
 	// advisory lock would otherwise wedge later ticks cluster-wide.
 	defer func() {
 		unlockCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		_, uerr := conn.Exec(unlockCtx, "SELECT pg_advisory_unlock($1)", schedulerAdvisoryLockKey)
+		_, uerr := conn.Exec(unlockCtx, "SELECT pg_advisory_unlock($1)", key)
 		cancel()
 		if uerr != nil {
 			s.log.Warn().Err(uerr).Msg("scheduler: advisory unlock failed; discarding connection")
@@ -156,7 +174,7 @@ func (s *Scheduler) runChecks() {
 		conn.Release()
 	}()
 
-	s.runCheckSteps()
+	fn()
 }
 
 // runCheckSteps runs the actual subscription checks in order. The caller holds
@@ -211,6 +229,15 @@ func (s *Scheduler) processExpiredSubscriptions() {
 				Msg("Recurring subscription past renewal grace; downgrading to free")
 		}
 
+		if s.dryRun {
+			s.log.Info().
+				Int64("subscription_id", sub.ID).
+				Int64("user_id", sub.UserID).
+				Int64("plan_id", sub.PlanID).
+				Msg("Dry run: would deactivate expired subscription and downgrade user to free")
+			continue
+		}
+
 		s.log.Info().
 			Int64("subscription_id", sub.ID).
 			Int64("user_id", sub.UserID).
@@ -298,6 +325,15 @@ func (s *Scheduler) processRecurringRenewals() {
 			continue
 		}
 
+		if s.dryRun {
+			s.log.Info().
+				Int64("subscription_id", sub.ID).
+				Int64("user_id", sub.UserID).
+				Float64("amount", plan.Price).
+				Msg("Dry run: would charge recurring renewal")
+			continue
+		}
+
 		s.log.Info().
 			Int64("subscription_id", sub.ID).
 			Int64("user_id", sub.UserID).
@@ -488,6 +524,16 @@ func (s *Scheduler) applyPlanChanges() {
 
 		oldPlanID := sub.PlanID
 
+		if s.dryRun {
+			s.log.Info().
+				Int64("subscription_id", sub.ID).
+				Int64("user_id", sub.UserID).
+				Int64("old_plan_id", oldPlanID).
+				Int64("new_plan_id", *sub.NextPlanID).
+				Msg("Dry run: would apply scheduled plan change")
+			continue
+		}
+
 		s.log.Info().
 			Int64("subscription_id", sub.ID).
 			Int64("user_id", sub.UserID).
@@ -556,6 +602,15 @@ func (s *Scheduler) checkExpiringSubscriptions(daysAhead int) {
 		s.sentReminders[sub.ID] = time.Now()
 		s.sentRemindersMu.Unlock()
 
+		if s.dryRun {
+			s.log.Info().
+				Int64("subscription_id", sub.ID).
+				Int64("user_id", sub.UserID).
+				Int("days_left", daysAhead).
+				Msg("Dry run: would send expiration reminder")
+			continue
+		}
+
 		plan, _ := s.db.Plans.GetByID(sub.PlanID)
 
 		s.log.Debug().
@@ -625,6 +680,10 @@ func (s *Scheduler) downgradeToFreePlan(userID int64) error {
 // Checkout sessions (Creem ~30min, YooKassa ~1h) expire quickly,
 // so pending records should be cleaned up to unblock users.
 func (s *Scheduler) cleanupStalePendingPayments() {
+	if s.dryRun {
+		s.log.Debug().Msg("Dry run: skipping stale pending payment cleanup")
+		return
+	}
 	deleted, err := s.db.Payments.DeleteStalePending(1 * time.Hour)
 	if err != nil {
 		s.log.Error().Err(err).Msg("Failed to cleanup stale pending payments")
@@ -645,7 +704,8 @@ func (s *Scheduler) getUserEmail(userID int64) string {
 	return user.Email
 }
 
-// RunOnce runs all checks once (useful for testing)
+// RunOnce runs all checks once (useful for testing). In dry-run mode it
+// only logs what they would do.
 func (s *Scheduler) RunOnce() {
 	s.runChecks()
 }
@@ -437,3 +437,82 @@ func TestScheduler_ProcessExpiredSubscriptions(t *testing.T) {
 		t.Errorf("Expected 1 expired event, got %d", len(expiredEvents))
 	}
 }
+
+func TestScheduler_DryRunChangesNothing(t *testing.T) {
+	db := setupTestDB(t)
+	cfg := &config.ServerConfig{}
+	log := zerolog.New(zerolog.NewTestWriter(t))
+
+	paidPlan, err := db.Plans.GetBySlug("pro")
+	if err != nil {
+		t.Fatalf("Failed to get paid plan: %v", err)
+	}
+	businessPlan, err := db.Plans.GetBySlug("business")
+	if err != nil {
+		t.Fatalf("Failed to get business plan: %v", err)
+	}
+
+	expiredUser := &database.User{Phone: "+79001230001", PasswordHash: "hash", PlanID: paidPlan.ID, IsActive: true}
+	changingUser := &database.User{Phone: "+79001230002", PasswordHash: "hash", PlanID: paidPlan.ID, IsActive: true}
+	for _, u := range []*database.User{expiredUser, changingUser} {
+		if err := db.Users.Create(u); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+	}
+
+	// One subscription past its period, one with a plan change due
+	expiredTime := time.Now().Add(-1 * time.Hour)
+	startTime := expiredTime.Add(-30 * 24 * time.Hour)
+	futureTime := time.Now().Add(10 * 24 * time.Hour)
+	expired := &database.Subscription{
+		UserID:             expiredUser.ID,
+		PlanID:             paidPlan.ID,
+		Status:             database.SubscriptionStatusActive,
+		CurrentPeriodStart: &startTime,
+		CurrentPeriodEnd:   &expiredTime,
+	}
+	changing := &database.Subscription{
+		UserID:             changingUser.ID,
+		PlanID:             paidPlan.ID,
+		NextPlanID:         &businessPlan.ID,
+		Status:             database.SubscriptionStatusActive,
+		CurrentPeriodStart: &startTime,
+		CurrentPeriodEnd:   &futureTime,
+	}
+	for _, sub := range []*database.Subscription{expired, changing} {
+		if err := db.Subscriptions.Create(sub); err != nil {
+			t.Fatalf("Failed to create subscription: %v", err)
+		}
+	}
+
+	s := New(db, cfg, nil, log)
+	s.SetDryRun(true)
+	var events []Event
+	s.OnEvent(func(e Event) {
+		events = append(events, e)
+	})
+
+	s.RunOnce()
+
+	for _, sub := range []*database.Subscription{expired, changing} {
+		got, err := db.Subscriptions.GetByID(sub.ID)
+		if err != nil {
+			t.Fatalf("Failed to get subscription: %v", err)
+		}
+		if got.Status != database.SubscriptionStatusActive || got.PlanID != paidPlan.ID {
+			t.Errorf("subscription %d changed in a dry run: status %s, plan %d", sub.ID, got.Status, got.PlanID)
+		}
+	}
+	for _, u := range []*database.User{expiredUser, changingUser} {
+		got, err := db.Users.GetByID(u.ID)
+		if err != nil {
+			t.Fatalf("Failed to get user: %v", err)
+		}
+		if got.PlanID != paidPlan.ID {
+			t.Errorf("user %d moved to plan %d in a dry run", u.ID, got.PlanID)
+		}
+	}
+	if len(events) != 0 {
+		t.Errorf("Expected no events in a dry run, got %d", len(events))
+	}
+}
@@ -16,12 +16,14 @@ var ErrSubdomainTaken = errors.New("subdomain already claimed by another user")
 // token (a sign of token theft) can be detected as reuse. A SessionStore that
 // does not implement it simply has no reuse detection.
 type RotatedTokenTracker interface {
-	// MarkRotated records that tokenHash was rotated away for userID, retained
-	// for ttl (the remaining refresh-token lifetime).
-	MarkRotated(tokenHash string, userID int64, ttl time.Duration) error
-	// RotatedOwner returns the user a rotated token belonged to. found is false
-	// when the hash was never recorded (or has since expired).
-	RotatedOwner(tokenHash string) (userID int64, found bool, err error)
+	// MarkRotated records that tokenHash was rotated away for userID within
+	// the session family familyID, retained for ttl (the remaining
+	// refresh-token lifetime).
+	MarkRotated(tokenHash string, userID int64, familyID string, ttl time.Duration) error
+	// RotatedOwner returns the user and session family a rotated token
+	// belonged to. found is false when the hash was never recorded (or has
+	// since expired).
+	RotatedOwner(tokenHash string) (userID int64, familyID string, found bool, err error)
 }
 
 // SessionStore manages user refresh-token sessions.
@@ -32,6 +34,7 @@ type SessionStore interface {
 	Delete(id int64) error
 	DeleteByTokenHash(tokenHash string) error
 	DeleteByUserID(userID int64) error
+	DeleteByFamily(userID int64, familyID string) error
 	DeleteExpired() (int64, error)
 }
 
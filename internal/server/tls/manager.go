@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/rs/zerolog"
+	"golang.org/x/crypto/acme"
 	"golang.org/x/crypto/acme/autocert"
 
 	"github.com/mephistofox/fxtun.dev/internal/config"
@@ -30,8 +31,15 @@ type CertManager struct {
 	redisCache store.TLSCache
 	stopCh     chan struct{}
 	stopOnce   sync.Once
+
+	// Wildcard certificate for the base domain, see EnableWildcard
+	wildcardBase string
+	dnsProvider  DNSProvider
 }
 
+// renewBefore is how long before expiry certificates are renewed.
+const renewBefore = 30 * 24 * time.Hour
+
 // SetRedisCache sets an optional L2 Redis cache between memory and DB.
 func (cm *CertManager) SetRedisCache(c store.TLSCache) {
 	cm.redisCache = c
@@ -53,6 +61,9 @@ func NewCertManager(cfg config.TLSSettings, db *database.Database, log zerolog.L
 		Cache:      cm,
 		HostPolicy: cm.hostPolicy,
 	}
+	if cfg.ACMEDirectory != "" {
+		cm.acmeMgr.Client = &acme.Client{DirectoryURL: cfg.ACMEDirectory}
+	}
 
 	return cm
 }
@@ -87,8 +98,12 @@ func (cm *CertManager) LoadFromDB() error {
 
 // GetCertificate is the tls.Config.GetCertificate callback for SNI-based cert selection.
 // It first checks the local cache/DB, then falls back to autocert for on-demand ACME issuance.
+// The base domain and its subdomains are served the wildcard certificate, if enabled.
 func (cm *CertManager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
 	name := hello.ServerName
+	if key := cm.wildcardName(name); key != "" {
+		name = key
+	}
 
 	// L1: local memory cache
 	cm.mu.RLock()
@@ -128,6 +143,11 @@ func (cm *CertManager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certific
 		cm.log.Warn().Str("domain", name).Err(err).Msg("Failed to parse cached certificate, falling back to ACME")
 	}
 
+	// The wildcard certificate is only obtained by the renewal loop
+	if strings.HasPrefix(name, "*.") {
+		return nil, fmt.Errorf("no certificate for %s yet", hello.ServerName)
+	}
+
 	// Fall back to autocert — will obtain cert via ACME if domain is in hostPolicy
 	acmeCert, err := cm.acmeMgr.GetCertificate(hello)
 	if err != nil {
@@ -219,9 +239,12 @@ func (cm *CertManager) HandleACMEChallenge(w http.ResponseWriter, r *http.Reques
 	return true
 }
 
-// StartRenewal starts the background renewal goroutine.
+// StartRenewal starts the background renewal goroutine. It obtains the
+// wildcard certificate right away when there is none yet.
 func (cm *CertManager) StartRenewal() {
 	go func() {
+		cm.ensureWildcard()
+
 		ticker := time.NewTicker(12 * time.Hour)
 		defer ticker.Stop()
 
@@ -254,7 +277,7 @@ func (cm *CertManager) TLSConfig() *tls.Config {
 }
 
 func (cm *CertManager) renewExpiring() {
-	threshold := time.Now().Add(30 * 24 * time.Hour)
+	threshold := time.Now().Add(renewBefore)
 	certs, err := cm.db.TLSCerts.GetExpiring(threshold)
 	if err != nil {
 		cm.log.Error().Err(err).Msg("Failed to get expiring certificates")
@@ -263,6 +286,10 @@ func (cm *CertManager) renewExpiring() {
 
 	for _, cert := range certs {
 		cm.log.Info().Str("domain", cert.Domain).Time("expires", cert.ExpiresAt).Msg("Renewing certificate")
+		if cm.wildcardBase != "" && cert.Domain == "*."+cm.wildcardBase {
+			cm.obtainWildcard()
+			continue
+		}
 		cm.ObtainCert(cert.Domain)
 	}
 }
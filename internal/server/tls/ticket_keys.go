@@ -0,0 +1,148 @@
+package tls
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+)
+
+// SessionTicketKeys installs configured session ticket keys into the server's
+// TLS configs, so clients resume sessions after a restart or on another
+// instance sharing the keys.
+type SessionTicketKeys struct {
+	path string
+	log  zerolog.Logger
+
+	mu      sync.Mutex
+	keys    [][32]byte
+	modTime time.Time
+	configs []*tls.Config
+}
+
+// NewSessionTicketKeys loads the keys cfg names. It returns nil when none
+// are configured, which leaves Go's random per-process keys in place.
+func NewSessionTicketKeys(cfg config.TLSSettings, log zerolog.Logger) (*SessionTicketKeys, error) {
+	k := &SessionTicketKeys{
+		path: cfg.SessionTicketKeysFile,
+		log:  log.With().Str("component", "tls_tickets").Logger(),
+	}
+	switch {
+	case k.path != "":
+		keys, modTime, err := readTicketKeysFile(k.path)
+		if err != nil {
+			return nil, err
+		}
+		k.keys, k.modTime = keys, modTime
+	case len(cfg.SessionTicketKeys) > 0:
+		for i, s := range cfg.SessionTicketKeys {
+			key, err := config.ParseSessionTicketKey(s)
+			if err != nil {
+				return nil, fmt.Errorf("session ticket key %d: %w", i, err)
+			}
+			k.keys = append(k.keys, key)
+		}
+	default:
+		return nil, nil
+	}
+	return k, nil
+}
+
+// Apply installs the keys into c and keeps them current there. A nil
+// receiver leaves c alone.
+func (k *SessionTicketKeys) Apply(c *tls.Config) {
+	if k == nil {
+		return
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	c.SetSessionTicketKeys(k.keys)
+	k.configs = append(k.configs, c)
+}
+
+// Watch re-reads the key file every interval until ctx is done, installing
+// the keys whenever the file changed. It returns at once without a file.
+func (k *SessionTicketKeys) Watch(ctx context.Context, interval time.Duration) {
+	if k == nil || k.path == "" {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := k.reload(); err != nil {
+				k.log.Warn().Err(err).Msg("Failed to reload session ticket keys, keeping the previous ones")
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reload installs the key file's keys if it changed since the last read.
+func (k *SessionTicketKeys) reload() error {
+	info, err := os.Stat(k.path)
+	if err != nil {
+		return err
+	}
+	k.mu.Lock()
+	unchanged := info.ModTime().Equal(k.modTime)
+	k.mu.Unlock()
+	if unchanged {
+		return nil
+	}
+
+	keys, modTime, err := readTicketKeysFile(k.path)
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys, k.modTime = keys, modTime
+	for _, c := range k.configs {
+		c.SetSessionTicketKeys(keys)
+	}
+	k.log.Info().Int("keys", len(keys)).Msg("Session ticket keys rotated")
+	return nil
+}
+
+// readTicketKeysFile parses one key per line; blank lines and lines
+// starting with # are skipped.
+func readTicketKeysFile(path string) ([][32]byte, time.Time, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("read session ticket keys: %w", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("read session ticket keys: %w", err)
+	}
+
+	var keys [][32]byte
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 || text[0] == '#' {
+			continue
+		}
+		key, err := config.ParseSessionTicketKey(string(text))
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, time.Time{}, fmt.Errorf("%s: no session ticket keys", path)
+	}
+	return keys, info.ModTime(), nil
+}
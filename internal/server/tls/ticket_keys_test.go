@@ -0,0 +1,166 @@
+package tls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/mephistofox/fxtun.dev/internal/config"
+)
+
+func testCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// handshake runs one TLS handshake against a fresh listener using
+// serverCfg, as if the server had been restarted in between, and reports
+// whether the session was resumed.
+func handshake(t *testing.T, serverCfg, clientCfg *tls.Config) bool {
+	t.Helper()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", serverCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_ = conn.(*tls.Conn).Handshake()
+		// TLS 1.3 tickets are sent after the handshake; wait for the
+		// client to hang up so they reach it
+		_, _ = conn.Read(make([]byte, 1))
+	}()
+
+	conn, err := tls.Dial("tcp", ln.Addr().String(), clientCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// Reading lets the client process the ticket
+	_ = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	_, _ = conn.Read(make([]byte, 1))
+	return conn.ConnectionState().DidResume
+}
+
+func TestSessionTicketKeys_ResumeAfterRestart(t *testing.T) {
+	cert := testCertificate(t)
+	pool := x509.NewCertPool()
+	leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+	pool.AddCert(leaf)
+	clientCfg := &tls.Config{
+		RootCAs:            pool,
+		ServerName:         "example.com",
+		ClientSessionCache: tls.NewLRUClientSessionCache(4),
+	}
+
+	newServer := func(keys ...string) *tls.Config {
+		k, err := NewSessionTicketKeys(config.TLSSettings{SessionTicketKeys: keys}, zerolog.Nop())
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := &tls.Config{Certificates: []tls.Certificate{cert}}
+		k.Apply(c)
+		return c
+	}
+	oldKey := strings.Repeat("11", 32)
+	newKey := strings.Repeat("22", 32)
+
+	if handshake(t, newServer(oldKey), clientCfg) {
+		t.Fatal("first handshake cannot resume")
+	}
+	if !handshake(t, newServer(oldKey), clientCfg) {
+		t.Fatal("session not resumed by a server with the same key")
+	}
+	if !handshake(t, newServer(newKey, oldKey), clientCfg) {
+		t.Fatal("session not resumed after rotating in a new key")
+	}
+	if handshake(t, newServer(strings.Repeat("33", 32)), clientCfg) {
+		t.Fatal("session resumed without the key that issued it")
+	}
+}
+
+func TestSessionTicketKeys_None(t *testing.T) {
+	k, err := NewSessionTicketKeys(config.TLSSettings{}, zerolog.Nop())
+	if err != nil || k != nil {
+		t.Fatalf("got %v, %v; want nil, nil", k, err)
+	}
+	k.Apply(&tls.Config{}) // nil receiver is a no-op
+}
+
+func TestSessionTicketKeys_FileReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ticket-keys")
+	write := func(content string, mtime time.Time) {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := time.Now().Add(-time.Hour)
+	write("# current first\n"+strings.Repeat("11", 32)+"\n", start)
+
+	k, err := NewSessionTicketKeys(config.TLSSettings{SessionTicketKeysFile: path}, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("NewSessionTicketKeys: %v", err)
+	}
+	if len(k.keys) != 1 {
+		t.Fatalf("got %d keys, want 1", len(k.keys))
+	}
+
+	write("not a key\n", start.Add(time.Minute))
+	if err := k.reload(); err == nil {
+		t.Fatal("expected error for a malformed key file")
+	}
+	if len(k.keys) != 1 {
+		t.Fatal("failed reload must keep the previous keys")
+	}
+
+	write(strings.Repeat("22", 32)+"\n\n"+strings.Repeat("11", 32)+"\n", start.Add(2*time.Minute))
+	if err := k.reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if len(k.keys) != 2 || k.keys[0][0] != 0x22 {
+		t.Fatalf("got %x, want the rotated keys", k.keys)
+	}
+}
+
+func TestSessionTicketKeys_EmptyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ticket-keys")
+	if err := os.WriteFile(path, []byte("# nothing yet\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewSessionTicketKeys(config.TLSSettings{SessionTicketKeysFile: path}, zerolog.Nop()); err == nil {
+		t.Fatal("expected error for a file without keys")
+	}
+}
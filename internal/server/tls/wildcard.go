@@ -0,0 +1,257 @@
+package tls
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme"
+
+	"github.com/mephistofox/fxtun.dev/internal/server/database"
+)
+
+// DNSProvider publishes the TXT records of ACME DNS-01 challenges.
+type DNSProvider interface {
+	// Present publishes value as a TXT record at fqdn.
+	Present(ctx context.Context, fqdn, value string) error
+	// CleanUp removes a record published by Present.
+	CleanUp(ctx context.Context, fqdn, value string) error
+}
+
+// ExecDNSProvider publishes challenge records by running an external
+// command as "<path> present|cleanup <fqdn> <value>", so any DNS host with a
+// CLI or API can be scripted.
+type ExecDNSProvider struct {
+	Path string
+	// Propagation is how long Present waits after the command succeeds,
+	// giving the record time to reach the zone's name servers.
+	Propagation time.Duration
+}
+
+// Present runs the command with "present" and waits for propagation.
+func (p *ExecDNSProvider) Present(ctx context.Context, fqdn, value string) error {
+	if err := p.run(ctx, "present", fqdn, value); err != nil {
+		return err
+	}
+	select {
+	case <-time.After(p.Propagation):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// CleanUp runs the command with "cleanup".
+func (p *ExecDNSProvider) CleanUp(ctx context.Context, fqdn, value string) error {
+	return p.run(ctx, "cleanup", fqdn, value)
+}
+
+func (p *ExecDNSProvider) run(ctx context.Context, action, fqdn, value string) error {
+	out, err := exec.CommandContext(ctx, p.Path, action, fqdn, value).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s %s: %w: %s", p.Path, action, fqdn, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// EnableWildcard makes the manager obtain and renew a certificate for
+// baseDomain and *.baseDomain via ACME DNS-01 and serve it for the base
+// domain and its tunnel subdomains. Call it before StartRenewal.
+func (cm *CertManager) EnableWildcard(baseDomain string, provider DNSProvider) {
+	cm.wildcardBase = strings.ToLower(strings.TrimSuffix(baseDomain, "."))
+	cm.dnsProvider = provider
+}
+
+// wildcardName returns the certificate key of the wildcard certificate
+// covering name, or "" if name is not the base domain or one of its
+// direct subdomains.
+func (cm *CertManager) wildcardName(name string) string {
+	if cm.wildcardBase == "" {
+		return ""
+	}
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if name == cm.wildcardBase {
+		return "*." + cm.wildcardBase
+	}
+	label, ok := strings.CutSuffix(name, "."+cm.wildcardBase)
+	if !ok || label == "" || strings.Contains(label, ".") {
+		return ""
+	}
+	return "*." + cm.wildcardBase
+}
+
+// ensureWildcard obtains the wildcard certificate unless the database holds
+// one that is not due for renewal yet.
+func (cm *CertManager) ensureWildcard() {
+	if cm.wildcardBase == "" {
+		return
+	}
+	key := "*." + cm.wildcardBase
+	cert, err := cm.db.TLSCerts.GetByDomain(key)
+	if err == nil && time.Until(cert.ExpiresAt) > renewBefore {
+		return
+	}
+	cm.obtainWildcard()
+}
+
+// obtainWildcard runs an ACME DNS-01 order for the base domain and its
+// wildcard and stores the result like any other certificate.
+func (cm *CertManager) obtainWildcard() {
+	key := "*." + cm.wildcardBase
+	cm.log.Info().Str("domain", key).Msg("Obtaining wildcard TLS certificate")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	go func() {
+		select {
+		case <-cm.stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	cert, err := cm.orderWildcard(ctx)
+	if err != nil {
+		cm.log.Error().Str("domain", key).Err(err).Msg("Failed to obtain wildcard certificate")
+		return
+	}
+
+	certPEM, keyPEM, expiresAt, err := extractPEM(cert)
+	if err != nil {
+		cm.log.Error().Str("domain", key).Err(err).Msg("Failed to extract PEM")
+		return
+	}
+	if err := cm.db.TLSCerts.Upsert(&database.TLSCertificate{
+		Domain:    key,
+		CertPEM:   certPEM,
+		KeyPEM:    keyPEM,
+		ExpiresAt: expiresAt,
+		IssuedAt:  time.Now(),
+	}); err != nil {
+		cm.log.Error().Str("domain", key).Err(err).Msg("Failed to store certificate")
+		return
+	}
+
+	cm.mu.Lock()
+	cm.cache[key] = cert
+	cm.mu.Unlock()
+	if cm.redisCache != nil {
+		_ = cm.redisCache.Put(key, certPEM, keyPEM, expiresAt)
+	}
+
+	cm.log.Info().Str("domain", key).Time("expires", expiresAt).Msg("Wildcard TLS certificate obtained")
+}
+
+// orderWildcard talks to the ACME directory. It registers a fresh account
+// key per order: issuance happens every two months at most, so there is no
+// account worth persisting.
+func (cm *CertManager) orderWildcard(ctx context.Context) (*tls.Certificate, error) {
+	accountKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate account key: %w", err)
+	}
+	client := &acme.Client{Key: accountKey, DirectoryURL: cm.directoryURL()}
+
+	account := &acme.Account{}
+	if cm.cfg.ACMEEmail != "" {
+		account.Contact = []string{"mailto:" + cm.cfg.ACMEEmail}
+	}
+	if _, err := client.Register(ctx, account, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return nil, fmt.Errorf("register account: %w", err)
+	}
+
+	domains := []string{cm.wildcardBase, "*." + cm.wildcardBase}
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(domains...))
+	if err != nil {
+		return nil, fmt.Errorf("create order: %w", err)
+	}
+
+	// Both identifiers are validated at the same _acme-challenge name, so
+	// authorize them one at a time
+	for _, url := range order.AuthzURLs {
+		if err := cm.authorizeDNS01(ctx, client, url); err != nil {
+			return nil, err
+		}
+	}
+
+	order, err = client.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return nil, fmt.Errorf("wait order: %w", err)
+	}
+
+	certKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate certificate key: %w", err)
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: domains}, certKey)
+	if err != nil {
+		return nil, fmt.Errorf("create CSR: %w", err)
+	}
+	der, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, fmt.Errorf("finalize order: %w", err)
+	}
+
+	return &tls.Certificate{Certificate: der, PrivateKey: certKey}, nil
+}
+
+// authorizeDNS01 completes the dns-01 challenge of one authorization.
+func (cm *CertManager) authorizeDNS01(ctx context.Context, client *acme.Client, url string) error {
+	authz, err := client.GetAuthorization(ctx, url)
+	if err != nil {
+		return fmt.Errorf("get authorization: %w", err)
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+
+	var chal *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == "dns-01" {
+			chal = c
+			break
+		}
+	}
+	if chal == nil {
+		return fmt.Errorf("no dns-01 challenge offered for %s", authz.Identifier.Value)
+	}
+
+	value, err := client.DNS01ChallengeRecord(chal.Token)
+	if err != nil {
+		return fmt.Errorf("challenge record: %w", err)
+	}
+	fqdn := "_acme-challenge." + authz.Identifier.Value
+	if err := cm.dnsProvider.Present(ctx, fqdn, value); err != nil {
+		return fmt.Errorf("publish challenge: %w", err)
+	}
+	defer func() {
+		if err := cm.dnsProvider.CleanUp(context.WithoutCancel(ctx), fqdn, value); err != nil {
+			cm.log.Warn().Str("fqdn", fqdn).Err(err).Msg("Failed to remove ACME challenge record")
+		}
+	}()
+
+	if _, err := client.Accept(ctx, chal); err != nil {
+		return fmt.Errorf("accept challenge: %w", err)
+	}
+	if _, err := client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return fmt.Errorf("authorize %s: %w", authz.Identifier.Value, err)
+	}
+	return nil
+}
+
+// directoryURL returns the configured ACME directory, Let's Encrypt by
+// default.
+func (cm *CertManager) directoryURL() string {
+	if cm.cfg.ACMEDirectory != "" {
+		return cm.cfg.ACMEDirectory
+	}
+	return acme.LetsEncryptURL
+}
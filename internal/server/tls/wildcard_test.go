@@ -0,0 +1,74 @@
+package tls
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWildcardName(t *testing.T) {
+	cm := &CertManager{}
+	if got := cm.wildcardName("app.example.com"); got != "" {
+		t.Fatalf("wildcard disabled, got %q", got)
+	}
+
+	cm.EnableWildcard("Example.com.", nil)
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"example.com", "*.example.com"},
+		{"app.example.com", "*.example.com"},
+		{"APP.Example.com.", "*.example.com"},
+		{"a.b.example.com", ""},
+		{"notexample.com", ""},
+		{"shop.customer.org", ""},
+	}
+	for _, tt := range tests {
+		if got := cm.wildcardName(tt.name); got != tt.want {
+			t.Errorf("wildcardName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExecDNSProvider(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "calls")
+	script := filepath.Join(dir, "hook.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho \"$@\" >> "+log+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &ExecDNSProvider{Path: script}
+	ctx := context.Background()
+	if err := p.Present(ctx, "_acme-challenge.example.com", "token"); err != nil {
+		t.Fatalf("Present: %v", err)
+	}
+	if err := p.CleanUp(ctx, "_acme-challenge.example.com", "token"); err != nil {
+		t.Fatalf("CleanUp: %v", err)
+	}
+
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "present _acme-challenge.example.com token\ncleanup _acme-challenge.example.com token\n"
+	if string(data) != want {
+		t.Errorf("hook calls = %q, want %q", data, want)
+	}
+}
+
+func TestExecDNSProvider_Failure(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "hook.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho 'zone not found' >&2\nexit 1\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &ExecDNSProvider{Path: script}
+	err := p.Present(context.Background(), "_acme-challenge.example.com", "token")
+	if err == nil || !strings.Contains(err.Error(), "zone not found") {
+		t.Fatalf("Present error = %v, want the hook's output", err)
+	}
+}
@@ -78,6 +78,7 @@ export interface User {
   is_admin: boolean
   github_id?: number
   google_id?: string
+  gitlab_id?: number
   created_at: string
 }
 
@@ -99,12 +100,29 @@ export interface Tunnel {
   remote_port?: number
   local_port: number
   created_at: string
+  last_activity: string
+  idle_seconds: number
+}
+
+export interface TunnelListQuery {
+  min_idle?: number
+  sort_by?: 'created_at' | 'idle'
+  order?: 'asc' | 'desc'
+}
+
+export interface ConnectedClient {
+  id: string
+  hostname?: string
+  ip: string
+  connected_at: string
+  tunnels: Tunnel[]
 }
 
 export interface Domain {
   id: number
   subdomain: string
   created_at: string
+  expires_at?: string
 }
 
 export interface APIToken {
@@ -167,13 +185,19 @@ export const totpApi = {
 }
 
 export const tunnelsApi = {
-  list: () => api.get<{ tunnels: Tunnel[] }>('/tunnels'),
+  list: (query: TunnelListQuery = {}) => api.get<{ tunnels: Tunnel[] }>('/tunnels', { params: query }),
   close: (id: string) => api.delete(`/tunnels/${id}`),
 }
 
+export const clientsApi = {
+  list: () => api.get<{ clients: ConnectedClient[]; total: number }>('/clients'),
+  disconnect: (id: string) => api.delete(`/clients/${id}`),
+}
+
 export const domainsApi = {
   list: () => api.get<{ domains: Domain[]; max_domains: number }>('/domains'),
-  reserve: (subdomain: string) => api.post<Domain>('/domains', { subdomain }),
+  reserve: (subdomain: string, expiresIn?: number) =>
+    api.post<Domain>('/domains', { subdomain, expires_in: expiresIn }),
   release: (id: number) => api.delete(`/domains/${id}`),
   check: (subdomain: string) => api.get<{ available: boolean }>(`/domains/check/${subdomain}`),
 }
@@ -232,6 +256,7 @@ export interface AdminStats {
   http_tunnels: number
   tcp_tunnels: number
   udp_tunnels: number
+  udp_flows: number
   total_users: number
 }
 
@@ -249,6 +274,7 @@ export interface AdminUser {
   avatar_url?: string
   github_id?: string
   google_id?: string
+  gitlab_id?: string
 }
 
 export interface AuditLog {
@@ -273,6 +299,8 @@ export interface AdminTunnel {
   user_id: number
   user_phone: string
   created_at: string
+  last_activity: string
+  idle_seconds: number
 }
 
 export interface Plan {
@@ -357,6 +385,8 @@ export interface TunnelHistoryEntry {
   disconnected_at?: string
   bytes_sent: number
   bytes_received: number
+  event: 'session' | 'reconnect' | 'throttled' | 'tunnel_error'
+  details?: string
 }
 
 export interface TunnelHistoryStats {
@@ -397,7 +427,8 @@ export const adminApi = {
     }),
 
   // Tunnels
-  listTunnels: () => api.get<{ tunnels: AdminTunnel[]; total: number }>('/admin/tunnels'),
+  listTunnels: (filter: { subdomain?: string; type?: string; user_id?: number; port?: number } & TunnelListQuery = {}) =>
+    api.get<{ tunnels: AdminTunnel[]; total: number }>('/admin/tunnels', { params: filter }),
   closeTunnel: (id: string) => api.delete(`/admin/tunnels/${id}`),
 
   // Merge users
@@ -483,10 +514,21 @@ export const inspectApi = {
     api.get<CapturedExchange>(`/tunnels/${tunnelId}/inspect/${exchangeId}`).then(r => r.data),
   clear: (tunnelId: string) =>
     api.delete(`/tunnels/${tunnelId}/inspect`).then(r => r.data),
+  purgeCache: (tunnelId: string) =>
+    api.delete<{ purged: number }>(`/tunnels/${tunnelId}/inspect/cache`).then(r => r.data),
   replay: (tunnelId: string, exchangeId: string, mods?: ReplayRequest) =>
     api.post<ReplayResponse>(`/tunnels/${tunnelId}/inspect/${exchangeId}/replay`, mods || {}).then(r => r.data),
 }
 
+// Shared inspector links are authorized by their token alone, so they go
+// without the account's credentials
+export const sharedInspectApi = {
+  list: (token: string, offset = 0, limit = 50) =>
+    axios.get<ExchangeListResponse>(`/api/inspect/shared/${token}`, { params: { offset, limit } }).then(r => r.data),
+  get: (token: string, exchangeId: string) =>
+    axios.get<CapturedExchange>(`/api/inspect/shared/${token}/${exchangeId}`).then(r => r.data),
+}
+
 // Subscription types
 export interface Subscription {
   id: number
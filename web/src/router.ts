@@ -134,6 +134,11 @@ export const routes: RouteRecordRaw[] = [
     component: () => import('./views/DashboardView.vue'),
     meta: { requiresAuth: true },
   },
+  {
+    path: '/inspect/shared/:token',
+    name: 'inspect-shared',
+    component: () => import('./views/SharedInspectView.vue'),
+  },
   {
     path: '/inspect/:tunnelId',
     name: 'inspect',